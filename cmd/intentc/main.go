@@ -4,12 +4,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/lhaig/intent/internal/compiler"
+	"github.com/lhaig/intent/internal/conformance"
 	"github.com/lhaig/intent/internal/formatter"
+	"github.com/lhaig/intent/internal/jsbe"
 	"github.com/lhaig/intent/internal/linter"
+	"github.com/lhaig/intent/internal/lsp"
 	"github.com/lhaig/intent/internal/parser"
+	"github.com/lhaig/intent/internal/repl"
 	"github.com/lhaig/intent/internal/verify"
 )
 
@@ -20,21 +26,52 @@ const usage = `intentc - The Intent language compiler
 
 Usage:
   intentc build [--target <target>] [--emit] <file.intent>    Compile to binary or source
+  intentc run <file.intent>                                    Run with the built-in interpreter (no toolchain needed)
+  intentc repl                                                 Start an interactive session with live contract checks
   intentc check <file.intent>                                  Parse and type-check only
-  intentc verify <file.intent>                                 Verify contracts using Z3 SMT solver
+  intentc verify [options] <file.intent>                       Verify contracts with an SMT solver (Z3 by default)
   intentc test-gen [--emit] <file.intent>                      Generate Rust with property-based contract tests
   intentc fmt [--check] <file.intent>                          Format source to canonical style
   intentc lint <file.intent>                                   Run lint checks for style/best practices
+  intentc lsp                                                  Run the language server over stdio
+  intentc conformance [options] [paths...]                     Check that all targets agree with the interpreter
 
 Options:
   --target <target>   Target platform: rust (default), js, wasm
   --emit              Output generated source instead of building a binary
   --emit-rust         (deprecated) Same as --emit with --target rust
+  --checked-arith     Rust: abort on Int overflow or division by zero instead of wrapping
+  --int-mode=<mode>   JS Int representation: bigint (default, exact i64 wraparound)
+                      or number (faster; traps outside the 53-bit safe range)
+  --release           Verify first and leave out the runtime checks of proved
+                      contracts (except @always_check); prints what was elided
+  --contracts=<mode>  Runtime contract checks: all (default), requires (only
+                      preconditions), none, or debug (Rust debug_assert!, which
+                      cargo's release profile compiles out; JS and WASM checks
+                      switched off with INTENT_CONTRACTS=off)
+
+Verify options:
+  --float-model=<m>   How Float is reasoned about: real (default, exact reals)
+                      or ieee (IEEE-754 binary64 with rounding, NaN and infinity)
+  --jobs <n>          Solver processes to run at once (default: one per CPU)
+  --timeout <dur>     Solver limit per contract (default: 5s)
+  --cache-dir <dir>   Where proved results are cached (default: user cache dir)
+  --no-cache          Prove every contract again instead of reusing cached results
+  --solver <s>        z3 (default), cvc5, or the path of any SMT-LIB 2 solver
+                      that reads its query from stdin
+  --format <f>        Output format: text (default), json (every result and
+                      the intent rollup) or sarif (failures, for code scanning)
+
+Conformance options:
+  --targets <list>    Comma-separated targets to compare (default: rust,js,wasm)
+  --corpus <n>        Also check n generated programs (default: 0)
+  --seed <n>          Seed for the generated corpus (default: 1)
+  --timeout <dur>     Build-and-run limit per program and target (default: 2m)
 
 Targets:
   rust    Compile to native binary via Rust (default)
   js      Generate JavaScript source
-  wasm    Compile to WebAssembly (direct binary emission)
+  wasm    Compile to WebAssembly (direct binary emission) plus a JS loader
 
 Multi-file support:
   When the entry file contains import declarations, intentc automatically
@@ -46,15 +83,28 @@ Examples:
   intentc build --emit hello.intent             Emit hello.rs (Rust source)
   intentc build --target js hello.intent        Build hello.intent -> hello.js
   intentc build --target js --emit hello.intent Emit hello.js (JS source)
-  intentc build --target wasm hello.intent      Build hello.intent -> hello.wasm
+  intentc build --target js --int-mode=number hello.intent
+                                                Build hello.js using JS numbers for Int
+  intentc build --target wasm hello.intent      Build hello.intent -> hello.wasm + hello.loader.js
+  intentc build --target js --contracts=requires hello.intent
+                                                Build hello.js checking only preconditions
   intentc build main.intent                     Build multi-file project (auto-detects imports)
+  intentc run hello.intent                      Interpret hello.intent, checking contracts at runtime
+  intentc repl                                  Explore declarations and contracts interactively
   intentc check hello.intent                    Check for errors without building
   intentc verify hello.intent                   Verify contracts with Z3 (requires z3 on PATH)
+  intentc verify --float-model=ieee hello.intent
+                                                Verify with f64 rounding, NaN and infinity
+  intentc verify --jobs 4 --timeout 30s hello.intent
+                                                Verify on 4 workers, allowing 30s per contract
+  intentc verify --solver cvc5 hello.intent     Verify with cvc5 instead of Z3
   intentc test-gen fibonacci.intent             Generate Rust with contract tests to stdout
   intentc test-gen --emit fibonacci.intent      Write to fibonacci_test.rs
   intentc fmt hello.intent                      Format hello.intent in-place
   intentc fmt --check hello.intent              Check if already formatted (exit 1 if not)
   intentc lint hello.intent                     Lint for style/best practice issues
+  intentc conformance                           Compare all targets on every example in examples/
+  intentc conformance --corpus 50 --seed 7      Also compare 50 generated programs
 `
 
 func main() {
@@ -73,6 +123,10 @@ func main() {
 	switch command {
 	case "build":
 		handleBuild(os.Args[2:])
+	case "run":
+		handleRun(os.Args[2:])
+	case "repl":
+		handleRepl()
 	case "check":
 		handleCheck(os.Args[2:])
 	case "verify":
@@ -83,6 +137,10 @@ func main() {
 		handleFmt(os.Args[2:])
 	case "lint":
 		handleLint(os.Args[2:])
+	case "lsp":
+		handleLSP()
+	case "conformance":
+		handleConformance(os.Args[2:])
 	case "help", "--help", "-h":
 		fmt.Print(usage)
 	default:
@@ -95,6 +153,7 @@ func main() {
 func handleBuild(args []string) {
 	emit := false
 	target := "rust"
+	var opts compiler.Options
 	var filePath string
 
 	for i := 0; i < len(args); i++ {
@@ -106,6 +165,13 @@ func handleBuild(args []string) {
 			target = "rust"
 		case "--emit":
 			emit = true
+		case "--checked-arith":
+			opts.CheckedArith = true
+		case "--release":
+			opts.Release = true
+			if dir, err := verify.DefaultCacheDir(); err == nil {
+				opts.Verify.CacheDir = dir
+			}
 		case "--target":
 			if i+1 >= len(args) {
 				fmt.Fprintln(os.Stderr, "Error: --target requires an argument")
@@ -118,6 +184,24 @@ func handleBuild(args []string) {
 				os.Exit(1)
 			}
 		default:
+			if value, ok := strings.CutPrefix(arg, "--int-mode="); ok {
+				mode, err := jsbe.ParseIntMode(value)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+					os.Exit(1)
+				}
+				opts.IntMode = mode
+				continue
+			}
+			if value, ok := strings.CutPrefix(arg, "--contracts="); ok {
+				mode, err := compiler.ParseContractMode(value)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+					os.Exit(1)
+				}
+				opts.Contracts = mode
+				continue
+			}
 			if strings.HasPrefix(arg, "-") {
 				fmt.Fprintf(os.Stderr, "Unknown option: %s\n", arg)
 				os.Exit(1)
@@ -143,12 +227,12 @@ func handleBuild(args []string) {
 	if isMulti {
 		// Multi-file compilation path
 		if emit {
-			if err := compiler.EmitProjectToTarget(filePath, target, baseName); err != nil {
+			if err := compiler.EmitProjectToTarget(filePath, target, baseName, opts); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 				os.Exit(1)
 			}
 		} else {
-			if err := compiler.BuildProjectToTarget(filePath, target, baseName); err != nil {
+			if err := compiler.BuildProjectToTarget(filePath, target, baseName, opts); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 				os.Exit(1)
 			}
@@ -162,12 +246,12 @@ func handleBuild(args []string) {
 		}
 
 		if emit {
-			if err := compiler.EmitToTarget(string(source), target, baseName); err != nil {
+			if err := compiler.EmitToTarget(string(source), target, baseName, opts); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 				os.Exit(1)
 			}
 		} else {
-			if err := compiler.BuildToTarget(string(source), target, baseName); err != nil {
+			if err := compiler.BuildToTarget(string(source), target, baseName, opts); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 				os.Exit(1)
 			}
@@ -175,6 +259,20 @@ func handleBuild(args []string) {
 	}
 }
 
+func handleRun(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no input file specified")
+		os.Exit(1)
+	}
+
+	code, err := compiler.Run(args[0], os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", strings.TrimRight(err.Error(), "\n"))
+		os.Exit(1)
+	}
+	os.Exit(int(code))
+}
+
 func handleCheck(args []string) {
 	if len(args) == 0 {
 		fmt.Fprintln(os.Stderr, "Error: no input file specified")
@@ -337,13 +435,85 @@ func handleFmt(args []string) {
 }
 
 func handleVerify(args []string) {
-	if len(args) == 0 {
+	var opts verify.Options
+	var filePath string
+	useCache := true
+	format := "text"
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "--jobs", "--timeout", "--cache-dir", "--solver", "--format":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires an argument\n", arg)
+				os.Exit(1)
+			}
+			i++
+			var err error
+			switch arg {
+			case "--jobs":
+				opts.Jobs, err = strconv.Atoi(args[i])
+				if err == nil && opts.Jobs < 1 {
+					err = fmt.Errorf("must be at least 1")
+				}
+			case "--timeout":
+				opts.Timeout, err = time.ParseDuration(args[i])
+				if err == nil && opts.Timeout <= 0 {
+					err = fmt.Errorf("must be positive")
+				}
+			case "--cache-dir":
+				opts.CacheDir = args[i]
+			case "--format":
+				format = args[i]
+				if format != "text" && format != "json" && format != "sarif" {
+					err = fmt.Errorf("expected text, json or sarif")
+				}
+			case "--solver":
+				opts.Solver, err = verify.NewSolver(args[i])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+					os.Exit(1)
+				}
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid %s value: %s\n", arg, args[i])
+				os.Exit(1)
+			}
+		case "--no-cache":
+			useCache = false
+		default:
+			if value, ok := strings.CutPrefix(arg, "--float-model="); ok {
+				model, err := verify.ParseFloatModel(value)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+					os.Exit(1)
+				}
+				opts.FloatModel = model
+				continue
+			}
+			if strings.HasPrefix(arg, "-") {
+				fmt.Fprintf(os.Stderr, "Unknown option: %s\n", arg)
+				os.Exit(1)
+			}
+			filePath = arg
+		}
+	}
+
+	// Cache under the user cache directory unless told otherwise; without
+	// one, verification still works but proves everything again
+	if !useCache {
+		opts.CacheDir = ""
+	} else if opts.CacheDir == "" {
+		if dir, err := verify.DefaultCacheDir(); err == nil {
+			opts.CacheDir = dir
+		}
+	}
+
+	if filePath == "" {
 		fmt.Fprintln(os.Stderr, "Error: no input file specified")
 		os.Exit(1)
 	}
 
-	filePath := args[0]
-
 	// Check if this is a multi-file project
 	isMulti, err := compiler.IsMultiFile(filePath)
 	if err != nil {
@@ -353,14 +523,14 @@ func handleVerify(args []string) {
 
 	var output *compiler.VerifyOutput
 	if isMulti {
-		output, err = compiler.VerifyProjectWithReport(filePath)
+		output, err = compiler.VerifyProjectWithReport(filePath, opts)
 	} else {
 		source, readErr := os.ReadFile(filePath)
 		if readErr != nil {
 			fmt.Fprintf(os.Stderr, "Error reading file: %s\n", readErr)
 			os.Exit(1)
 		}
-		output, err = compiler.VerifyWithReport(string(source))
+		output, err = compiler.VerifyWithReport(string(source), opts)
 	}
 
 	if err != nil {
@@ -368,6 +538,38 @@ func handleVerify(args []string) {
 		os.Exit(1)
 	}
 
+	// Results of a single file carry no module path; locate them at the
+	// input. Project paths are made relative to the working directory so
+	// that code scanning can match them to files in the repository.
+	wd, _ := os.Getwd()
+	for _, result := range output.Results {
+		if result.File == "" {
+			result.File = filePath
+		} else if rel, err := filepath.Rel(wd, result.File); err == nil && !strings.HasPrefix(rel, "..") {
+			result.File = rel
+		}
+	}
+
+	if format != "text" {
+		var doc []byte
+		if format == "json" {
+			doc, err = verify.FormatJSON(output.Results, output.IntentReports)
+		} else {
+			doc, err = verify.FormatSARIF(output.Results)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(doc))
+		for _, result := range output.Results {
+			if result.Status != "verified" {
+				os.Exit(1)
+			}
+		}
+		return
+	}
+
 	// Track verification status
 	hasError := false
 	hasUnverified := false
@@ -375,17 +577,28 @@ func handleVerify(args []string) {
 	unverified := 0
 	errors := 0
 	timeouts := 0
+	cached := 0
 
 	// Print results
 	for _, result := range output.Results {
+		if result.Cached {
+			cached++
+		}
 		name := result.QualifiedName()
+		text := result.ContractText
+		if result.Line > 0 {
+			text += fmt.Sprintf(" (line %d:%d)", result.Line, result.Column)
+		}
+		if result.FloatModel != "" {
+			text += fmt.Sprintf(" [float model: %s]", result.FloatModel)
+		}
 
 		switch result.Status {
 		case "verified":
-			fmt.Printf("VERIFIED: %s: %s\n", name, result.ContractText)
+			fmt.Printf("VERIFIED: %s: %s\n", name, text)
 			verified++
 		case "unverified":
-			fmt.Printf("UNVERIFIED: %s: %s\n", name, result.ContractText)
+			fmt.Printf("UNVERIFIED: %s: %s\n", name, text)
 			fmt.Printf("  %s\n", result.Message)
 			unverified++
 			hasUnverified = true
@@ -394,7 +607,7 @@ func handleVerify(args []string) {
 			errors++
 			hasError = true
 		case "timeout":
-			fmt.Printf("TIMEOUT: %s: %s\n", name, result.ContractText)
+			fmt.Printf("TIMEOUT: %s: %s\n", name, text)
 			fmt.Printf("  %s\n", result.Message)
 			timeouts++
 			hasUnverified = true
@@ -405,6 +618,12 @@ func handleVerify(args []string) {
 	fmt.Println()
 	fmt.Printf("Verification summary: %d verified, %d unverified, %d timeouts, %d errors\n",
 		verified, unverified, timeouts, errors)
+	if cached > 0 {
+		fmt.Printf("%d of %d results reused from the verification cache\n", cached, len(output.Results))
+	}
+	if len(output.Results) > 0 && output.Results[0].Solver != "" {
+		fmt.Printf("Solver: %s %s\n", output.Results[0].Solver, output.Results[0].SolverVersion)
+	}
 
 	// Print intent verification report
 	if len(output.IntentReports) > 0 {
@@ -451,3 +670,106 @@ func handleLint(args []string) {
 	fmt.Println()
 	fmt.Printf("%d warning(s) found.\n", diag.Count())
 }
+
+func handleLSP() {
+	if err := lsp.NewServer(os.Stdin, os.Stdout, version).Serve(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func handleRepl() {
+	if err := repl.Run(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func handleConformance(args []string) {
+	targets := conformance.TargetNames
+	corpus := 0
+	seed := int64(1)
+	timeout := 2 * time.Minute
+	var paths []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "--targets", "--corpus", "--seed", "--timeout":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires an argument\n", arg)
+				os.Exit(1)
+			}
+			i++
+			var err error
+			switch arg {
+			case "--targets":
+				targets = strings.Split(args[i], ",")
+			case "--corpus":
+				corpus, err = strconv.Atoi(args[i])
+			case "--seed":
+				seed, err = strconv.ParseInt(args[i], 10, 64)
+			case "--timeout":
+				timeout, err = time.ParseDuration(args[i])
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid %s value: %s\n", arg, args[i])
+				os.Exit(1)
+			}
+		default:
+			if strings.HasPrefix(arg, "-") {
+				fmt.Fprintf(os.Stderr, "Unknown option: %s\n", arg)
+				os.Exit(1)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{"examples"}
+	}
+
+	runner, err := conformance.NewRunner(targets, timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	defer runner.Close()
+
+	for _, name := range runner.Unavailable() {
+		fmt.Printf("skipping %s: toolchain not found, comparing the other targets with the interpreter\n", name)
+	}
+
+	files, err := conformance.Discover(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	total, failed := 0, 0
+	report := func(name string, res *conformance.Result, err error) {
+		total++
+		switch {
+		case err != nil:
+			failed++
+			fmt.Printf("FAIL  %s\n  %s\n", name, strings.TrimRight(err.Error(), "\n"))
+		case res.Diverged():
+			failed++
+			fmt.Printf("FAIL  %s\n%s", name, res.Report())
+		default:
+			fmt.Printf("ok    %s (%s)\n", name, res.Oracle.Summary())
+		}
+	}
+	for _, file := range files {
+		res, err := runner.CheckFile(file)
+		report(file, res, err)
+	}
+	for _, p := range conformance.Corpus(seed, corpus) {
+		res, err := runner.CheckProgram(p)
+		report(p.Name, res, err)
+	}
+
+	fmt.Printf("\n%d program(s) checked, %d diverged.\n", total, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
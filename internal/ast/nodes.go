@@ -19,14 +19,23 @@ type Expression interface {
 	exprNode()
 }
 
+// Comments holds the source comments attached to a declaration, statement,
+// entity member, parameter or match arm. Texts include the comment markers.
+type Comments struct {
+	Leading  []string // comments on the lines before the node
+	Trailing string   // comment following the node on its last line
+}
+
 // Program represents the entire Intent program
 type Program struct {
-	Module    *ModuleDecl
-	Imports   []*ImportDecl
-	Functions []*FunctionDecl
-	Entities  []*EntityDecl
-	Enums     []*EnumDecl
-	Intents   []*IntentDecl
+	Module      *ModuleDecl
+	Imports     []*ImportDecl
+	Functions   []*FunctionDecl
+	Entities    []*EntityDecl
+	Enums       []*EnumDecl
+	Traits      []*TraitDecl
+	Intents     []*IntentDecl
+	EndComments []string // comments after the last declaration
 }
 
 func (p *Program) Pos() (int, int) {
@@ -38,20 +47,22 @@ func (p *Program) Pos() (int, int) {
 
 // ModuleDecl represents a module declaration
 type ModuleDecl struct {
-	Name    string
-	Version string
-	Line    int
-	Column  int
+	Name     string
+	Version  string
+	Comments Comments
+	Line     int
+	Column   int
 }
 
 func (m *ModuleDecl) Pos() (int, int) { return m.Line, m.Column }
 
 // ImportDecl represents an import declaration
 type ImportDecl struct {
-	Path   string // import path (e.g. "math.intent")
-	Alias  string // empty for now (no aliasing in v1)
-	Line   int
-	Column int
+	Path     string // import path (e.g. "math.intent")
+	Alias    string // empty for now (no aliasing in v1)
+	Comments Comments
+	Line     int
+	Column   int
 }
 
 func (i *ImportDecl) Pos() (int, int) { return i.Line, i.Column }
@@ -61,11 +72,13 @@ type FunctionDecl struct {
 	Name       string
 	IsEntry    bool
 	IsPublic   bool
+	TypeParams []*TypeParam
 	Params     []*Param
 	ReturnType *TypeRef
 	Requires   []*ContractClause
 	Ensures    []*ContractClause
 	Body       *Block
+	Comments   Comments
 	Line       int
 	Column     int
 }
@@ -74,13 +87,25 @@ func (f *FunctionDecl) Pos() (int, int) { return f.Line, f.Column }
 
 // Param represents a function parameter
 type Param struct {
+	Name     string
+	Type     *TypeRef
+	Comments Comments
+	Line     int
+	Column   int
+}
+
+func (p *Param) Pos() (int, int) { return p.Line, p.Column }
+
+// TypeParam represents a type parameter of a generic declaration, e.g. the
+// T in function max<T: Ord>
+type TypeParam struct {
 	Name   string
-	Type   *TypeRef
+	Bound  string // "Eq" or "Ord"; empty when unbounded
 	Line   int
 	Column int
 }
 
-func (p *Param) Pos() (int, int) { return p.Line, p.Column }
+func (t *TypeParam) Pos() (int, int) { return t.Line, t.Column }
 
 // TypeRef represents a type reference
 type TypeRef struct {
@@ -94,54 +119,69 @@ func (t *TypeRef) Pos() (int, int) { return t.Line, t.Column }
 
 // ContractClause represents a requires/ensures clause
 type ContractClause struct {
-	Expr    Expression
-	RawText string
-	Line    int
-	Column  int
+	Expr        Expression
+	RawText     string
+	AlwaysCheck bool // annotated @always_check: release builds keep its runtime check
+	Comments    Comments
+	Line        int
+	Column      int
+	EndLine     int // position just past the clause expression
+	EndColumn   int
 }
 
 func (c *ContractClause) Pos() (int, int) { return c.Line, c.Column }
 
 // DecreaseClause represents a decreases clause for termination checking
 type DecreaseClause struct {
-	Expr    Expression
-	RawText string
-	Line    int
-	Column  int
+	Expr     Expression
+	RawText  string
+	Comments Comments
+	Line     int
+	Column   int
 }
 
 func (d *DecreaseClause) Pos() (int, int) { return d.Line, d.Column }
 
 // EntityDecl represents an entity declaration
 type EntityDecl struct {
-	Name        string
-	IsPublic    bool
-	Fields      []*FieldDecl
-	Invariants  []*InvariantDecl
-	Constructor *ConstructorDecl
-	Methods     []*MethodDecl
-	Line        int
-	Column      int
+	Name         string
+	IsPublic     bool
+	TypeParams   []*TypeParam
+	Implements   []*TypeRef // traits named after 'implements'
+	Fields       []*FieldDecl
+	Invariants   []*InvariantDecl
+	Constructor  *ConstructorDecl
+	Methods      []*MethodDecl
+	Comments     Comments
+	BraceComment string   // comment after the opening brace, on the same line
+	EndComments  []string // comments before the closing brace
+	Line         int
+	Column       int
 }
 
 func (e *EntityDecl) Pos() (int, int) { return e.Line, e.Column }
 
 // FieldDecl represents an entity field declaration
 type FieldDecl struct {
-	Name   string
-	Type   *TypeRef
-	Line   int
-	Column int
+	Name     string
+	Type     *TypeRef
+	Comments Comments
+	Line     int
+	Column   int
 }
 
 func (f *FieldDecl) Pos() (int, int) { return f.Line, f.Column }
 
 // InvariantDecl represents an entity invariant
 type InvariantDecl struct {
-	Expr    Expression
-	RawText string
-	Line    int
-	Column  int
+	Expr        Expression
+	RawText     string
+	AlwaysCheck bool // annotated @always_check
+	Comments    Comments
+	Line        int
+	Column      int
+	EndLine     int // position just past the invariant expression
+	EndColumn   int
 }
 
 func (i *InvariantDecl) Pos() (int, int) { return i.Line, i.Column }
@@ -152,13 +192,15 @@ type ConstructorDecl struct {
 	Requires []*ContractClause
 	Ensures  []*ContractClause
 	Body     *Block
+	Comments Comments
 	Line     int
 	Column   int
 }
 
 func (c *ConstructorDecl) Pos() (int, int) { return c.Line, c.Column }
 
-// MethodDecl represents an entity method
+// MethodDecl represents an entity method, or a trait method signature when
+// Body is nil
 type MethodDecl struct {
 	Name       string
 	Params     []*Param
@@ -166,21 +208,40 @@ type MethodDecl struct {
 	Requires   []*ContractClause
 	Ensures    []*ContractClause
 	Body       *Block
+	Comments   Comments
 	Line       int
 	Column     int
 }
 
 func (m *MethodDecl) Pos() (int, int) { return m.Line, m.Column }
 
+// TraitDecl represents a trait declaration: method signatures with the
+// contracts every implementing entity must honour
+type TraitDecl struct {
+	Name         string
+	IsPublic     bool
+	Methods      []*MethodDecl
+	Comments     Comments
+	BraceComment string   // comment after the opening brace, on the same line
+	EndComments  []string // comments before the closing brace
+	Line         int
+	Column       int
+}
+
+func (t *TraitDecl) Pos() (int, int) { return t.Line, t.Column }
+
 // IntentDecl represents an intent declaration
 type IntentDecl struct {
-	Description string
-	Goals       []string
-	Constraints []string
-	Guarantees  []string
-	VerifiedBy  []*VerifiedByRef
-	Line        int
-	Column      int
+	Description  string
+	Goals        []string
+	Constraints  []string
+	Guarantees   []string
+	VerifiedBy   []*VerifiedByRef
+	Comments     Comments
+	BraceComment string   // comment after the opening brace, on the same line
+	EndComments  []string // comments before the closing brace
+	Line         int
+	Column       int
 }
 
 func (i *IntentDecl) Pos() (int, int) { return i.Line, i.Column }
@@ -196,9 +257,11 @@ func (v *VerifiedByRef) Pos() (int, int) { return v.Line, v.Column }
 
 // Block represents a block of statements
 type Block struct {
-	Statements []Statement
-	Line       int
-	Column     int
+	Statements   []Statement
+	BraceComment string   // comment after the opening brace, on the same line
+	EndComments  []string // comments before the closing brace
+	Line         int
+	Column       int
 }
 
 func (b *Block) Pos() (int, int) { return b.Line, b.Column }
@@ -206,12 +269,13 @@ func (b *Block) stmtNode()       {}
 
 // LetStmt represents a let statement
 type LetStmt struct {
-	Name    string
-	Mutable bool
-	Type    *TypeRef
-	Value   Expression
-	Line    int
-	Column  int
+	Name     string
+	Mutable  bool
+	Type     *TypeRef
+	Value    Expression
+	Comments Comments
+	Line     int
+	Column   int
 }
 
 func (l *LetStmt) Pos() (int, int) { return l.Line, l.Column }
@@ -219,10 +283,11 @@ func (l *LetStmt) stmtNode()       {}
 
 // AssignStmt represents an assignment statement
 type AssignStmt struct {
-	Target Expression
-	Value  Expression
-	Line   int
-	Column int
+	Target   Expression
+	Value    Expression
+	Comments Comments
+	Line     int
+	Column   int
 }
 
 func (a *AssignStmt) Pos() (int, int) { return a.Line, a.Column }
@@ -230,9 +295,10 @@ func (a *AssignStmt) stmtNode()       {}
 
 // ReturnStmt represents a return statement
 type ReturnStmt struct {
-	Value  Expression
-	Line   int
-	Column int
+	Value    Expression
+	Comments Comments
+	Line     int
+	Column   int
 }
 
 func (r *ReturnStmt) Pos() (int, int) { return r.Line, r.Column }
@@ -243,6 +309,7 @@ type IfStmt struct {
 	Condition Expression
 	Then      *Block
 	Else      Statement
+	Comments  Comments
 	Line      int
 	Column    int
 }
@@ -256,6 +323,7 @@ type WhileStmt struct {
 	Invariants []*ContractClause // zero or more invariant clauses
 	Decreases  *DecreaseClause   // optional decreases clause
 	Body       *Block
+	Comments   Comments
 	Line       int
 	Column     int
 }
@@ -265,8 +333,9 @@ func (w *WhileStmt) stmtNode()       {}
 
 // BreakStmt represents a break statement
 type BreakStmt struct {
-	Line   int
-	Column int
+	Comments Comments
+	Line     int
+	Column   int
 }
 
 func (b *BreakStmt) Pos() (int, int) { return b.Line, b.Column }
@@ -274,8 +343,9 @@ func (b *BreakStmt) stmtNode()       {}
 
 // ContinueStmt represents a continue statement
 type ContinueStmt struct {
-	Line   int
-	Column int
+	Comments Comments
+	Line     int
+	Column   int
 }
 
 func (c *ContinueStmt) Pos() (int, int) { return c.Line, c.Column }
@@ -283,9 +353,10 @@ func (c *ContinueStmt) stmtNode()       {}
 
 // ExprStmt represents an expression statement
 type ExprStmt struct {
-	Expr   Expression
-	Line   int
-	Column int
+	Expr     Expression
+	Comments Comments
+	Line     int
+	Column   int
 }
 
 func (e *ExprStmt) Pos() (int, int) { return e.Line, e.Column }
@@ -293,11 +364,12 @@ func (e *ExprStmt) stmtNode()       {}
 
 // BinaryExpr represents a binary expression
 type BinaryExpr struct {
-	Left   Expression
-	Op     lexer.TokenType
-	Right  Expression
-	Line   int
-	Column int
+	Left     Expression
+	Op       lexer.TokenType
+	Right    Expression
+	Comments []string
+	Line     int
+	Column   int
 }
 
 func (b *BinaryExpr) Pos() (int, int) { return b.Line, b.Column }
@@ -305,10 +377,11 @@ func (b *BinaryExpr) exprNode()       {}
 
 // UnaryExpr represents a unary expression
 type UnaryExpr struct {
-	Op      lexer.TokenType
-	Operand Expression
-	Line    int
-	Column  int
+	Op       lexer.TokenType
+	Operand  Expression
+	Comments []string
+	Line     int
+	Column   int
 }
 
 func (u *UnaryExpr) Pos() (int, int) { return u.Line, u.Column }
@@ -316,10 +389,13 @@ func (u *UnaryExpr) exprNode()       {}
 
 // CallExpr represents a function call
 type CallExpr struct {
-	Function string
-	Args     []Expression
-	Line     int
-	Column   int
+	Function  string
+	Args      []Expression
+	Comments  []string
+	Line      int
+	Column    int
+	EndLine   int // position just past the closing parenthesis
+	EndColumn int
 }
 
 func (c *CallExpr) Pos() (int, int) { return c.Line, c.Column }
@@ -327,11 +403,14 @@ func (c *CallExpr) exprNode()       {}
 
 // MethodCallExpr represents a method call
 type MethodCallExpr struct {
-	Object Expression
-	Method string
-	Args   []Expression
-	Line   int
-	Column int
+	Object    Expression
+	Method    string
+	Args      []Expression
+	Comments  []string
+	Line      int
+	Column    int
+	EndLine   int // position just past the closing parenthesis
+	EndColumn int
 }
 
 func (m *MethodCallExpr) Pos() (int, int) { return m.Line, m.Column }
@@ -339,10 +418,11 @@ func (m *MethodCallExpr) exprNode()       {}
 
 // FieldAccessExpr represents a field access
 type FieldAccessExpr struct {
-	Object Expression
-	Field  string
-	Line   int
-	Column int
+	Object   Expression
+	Field    string
+	Comments []string
+	Line     int
+	Column   int
 }
 
 func (f *FieldAccessExpr) Pos() (int, int) { return f.Line, f.Column }
@@ -350,9 +430,10 @@ func (f *FieldAccessExpr) exprNode()       {}
 
 // OldExpr represents an old() expression in contracts
 type OldExpr struct {
-	Expr   Expression
-	Line   int
-	Column int
+	Expr     Expression
+	Comments []string
+	Line     int
+	Column   int
 }
 
 func (o *OldExpr) Pos() (int, int) { return o.Line, o.Column }
@@ -360,9 +441,10 @@ func (o *OldExpr) exprNode()       {}
 
 // Identifier represents an identifier
 type Identifier struct {
-	Name   string
-	Line   int
-	Column int
+	Name     string
+	Comments []string
+	Line     int
+	Column   int
 }
 
 func (i *Identifier) Pos() (int, int) { return i.Line, i.Column }
@@ -370,8 +452,9 @@ func (i *Identifier) exprNode()       {}
 
 // SelfExpr represents the self keyword
 type SelfExpr struct {
-	Line   int
-	Column int
+	Comments []string
+	Line     int
+	Column   int
 }
 
 func (s *SelfExpr) Pos() (int, int) { return s.Line, s.Column }
@@ -379,8 +462,9 @@ func (s *SelfExpr) exprNode()       {}
 
 // ResultExpr represents the result keyword
 type ResultExpr struct {
-	Line   int
-	Column int
+	Comments []string
+	Line     int
+	Column   int
 }
 
 func (r *ResultExpr) Pos() (int, int) { return r.Line, r.Column }
@@ -388,9 +472,10 @@ func (r *ResultExpr) exprNode()       {}
 
 // IntLit represents an integer literal
 type IntLit struct {
-	Value  string
-	Line   int
-	Column int
+	Value    string
+	Comments []string
+	Line     int
+	Column   int
 }
 
 func (i *IntLit) Pos() (int, int) { return i.Line, i.Column }
@@ -398,9 +483,10 @@ func (i *IntLit) exprNode()       {}
 
 // FloatLit represents a float literal
 type FloatLit struct {
-	Value  string
-	Line   int
-	Column int
+	Value    string
+	Comments []string
+	Line     int
+	Column   int
 }
 
 func (f *FloatLit) Pos() (int, int) { return f.Line, f.Column }
@@ -408,9 +494,10 @@ func (f *FloatLit) exprNode()       {}
 
 // StringLit represents a string literal
 type StringLit struct {
-	Value  string
-	Line   int
-	Column int
+	Value    string
+	Comments []string
+	Line     int
+	Column   int
 }
 
 func (s *StringLit) Pos() (int, int) { return s.Line, s.Column }
@@ -418,9 +505,10 @@ func (s *StringLit) exprNode()       {}
 
 // StringInterp represents a string with embedded expressions: "hello {expr} world"
 type StringInterp struct {
-	Parts  []StringInterpPart // alternating static/expression parts
-	Line   int
-	Column int
+	Parts    []StringInterpPart // alternating static/expression parts
+	Comments []string
+	Line     int
+	Column   int
 }
 
 // StringInterpPart is a part of an interpolated string.
@@ -435,9 +523,10 @@ func (s *StringInterp) exprNode()       {}
 
 // BoolLit represents a boolean literal
 type BoolLit struct {
-	Value  bool
-	Line   int
-	Column int
+	Value    bool
+	Comments []string
+	Line     int
+	Column   int
 }
 
 func (b *BoolLit) Pos() (int, int) { return b.Line, b.Column }
@@ -446,6 +535,7 @@ func (b *BoolLit) exprNode()       {}
 // ArrayLit represents an array literal [expr, expr, ...]
 type ArrayLit struct {
 	Elements []Expression
+	Comments []string
 	Line     int
 	Column   int
 }
@@ -455,22 +545,26 @@ func (a *ArrayLit) exprNode()       {}
 
 // IndexExpr represents an index access arr[i]
 type IndexExpr struct {
-	Object Expression // the array being indexed
-	Index  Expression // the index expression
-	Line   int
-	Column int
+	Object   Expression // the array being indexed
+	Index    Expression // the index expression
+	Comments []string
+	Line     int
+	Column   int
 }
 
 func (i *IndexExpr) Pos() (int, int) { return i.Line, i.Column }
 func (i *IndexExpr) exprNode()       {}
 
-// ForInStmt represents a for-in loop: for <variable> in <iterable> { ... }
+// ForInStmt represents a for-in loop: for <variable> in <iterable> { ... },
+// or for <key>, <value> in <map> { ... }
 type ForInStmt struct {
-	Variable string     // loop variable name
-	Iterable Expression // array expression or RangeExpr
-	Body     *Block
-	Line     int
-	Column   int
+	Variable      string     // loop variable name; the key when iterating a map
+	ValueVariable string     // second loop variable, bound to the map value; "" if absent
+	Iterable      Expression // array or map expression, or RangeExpr
+	Body          *Block
+	Comments      Comments
+	Line          int
+	Column        int
 }
 
 func (f *ForInStmt) Pos() (int, int) { return f.Line, f.Column }
@@ -487,11 +581,13 @@ type RangeExpr struct {
 func (r *RangeExpr) Pos() (int, int) { return r.Line, r.Column }
 func (r *RangeExpr) exprNode()       {}
 
-// ForallExpr represents: forall <variable> in <range>: <body>
+// ForallExpr represents: forall <variable> in <range or map>: <body>
 type ForallExpr struct {
 	Variable string     // bound variable name (e.g., "i")
 	Domain   *RangeExpr // bounded range (e.g., 0..n)
+	Map      Expression // map whose keys the variable ranges over, when Domain is nil
 	Body     Expression // predicate (must be Bool)
+	Comments []string
 	Line     int
 	Column   int
 }
@@ -499,11 +595,13 @@ type ForallExpr struct {
 func (f *ForallExpr) Pos() (int, int) { return f.Line, f.Column }
 func (f *ForallExpr) exprNode()       {}
 
-// ExistsExpr represents: exists <variable> in <range>: <body>
+// ExistsExpr represents: exists <variable> in <range or map>: <body>
 type ExistsExpr struct {
 	Variable string     // bound variable name (e.g., "i")
 	Domain   *RangeExpr // bounded range (e.g., 0..n)
+	Map      Expression // map whose keys the variable ranges over, when Domain is nil
 	Body     Expression // predicate (must be Bool)
+	Comments []string
 	Line     int
 	Column   int
 }
@@ -513,31 +611,38 @@ func (e *ExistsExpr) exprNode()       {}
 
 // EnumDecl represents an enum declaration
 type EnumDecl struct {
-	Name     string
-	IsPublic bool
-	Variants []*EnumVariant
-	Line     int
-	Column   int
+	Name         string
+	IsPublic     bool
+	TypeParams   []*TypeParam
+	Variants     []*EnumVariant
+	Comments     Comments
+	BraceComment string   // comment after the opening brace, on the same line
+	EndComments  []string // comments before the closing brace
+	Line         int
+	Column       int
 }
 
 func (e *EnumDecl) Pos() (int, int) { return e.Line, e.Column }
 
 // EnumVariant represents a variant in an enum
 type EnumVariant struct {
-	Name   string
-	Fields []*FieldDecl // nil/empty for unit variants
-	Line   int
-	Column int
+	Name     string
+	Fields   []*FieldDecl // nil/empty for unit variants
+	Comments Comments
+	Line     int
+	Column   int
 }
 
 func (e *EnumVariant) Pos() (int, int) { return e.Line, e.Column }
 
 // MatchExpr represents a match expression
 type MatchExpr struct {
-	Scrutinee Expression
-	Arms      []*MatchArm
-	Line      int
-	Column    int
+	Scrutinee   Expression
+	Arms        []*MatchArm
+	Comments    []string
+	EndComments []string // comments before the closing brace
+	Line        int
+	Column      int
 }
 
 func (m *MatchExpr) Pos() (int, int) { return m.Line, m.Column }
@@ -545,10 +650,11 @@ func (m *MatchExpr) exprNode()       {}
 
 // MatchArm represents an arm in a match expression
 type MatchArm struct {
-	Pattern *MatchPattern
-	Body    Expression
-	Line    int
-	Column  int
+	Pattern  *MatchPattern
+	Body     Expression
+	Comments Comments
+	Line     int
+	Column   int
 }
 
 func (m *MatchArm) Pos() (int, int) { return m.Line, m.Column }
@@ -566,10 +672,86 @@ func (m *MatchPattern) Pos() (int, int) { return m.Line, m.Column }
 
 // TryExpr represents a try expression (expr?)
 type TryExpr struct {
-	Expr   Expression
-	Line   int
-	Column int
+	Expr     Expression
+	Comments []string
+	Line     int
+	Column   int
 }
 
 func (t *TryExpr) Pos() (int, int) { return t.Line, t.Column }
 func (t *TryExpr) exprNode()       {}
+
+// StatementComments returns the comments attached to a statement, or nil for
+// statements that carry none (blocks).
+func StatementComments(s Statement) *Comments {
+	switch stmt := s.(type) {
+	case *LetStmt:
+		return &stmt.Comments
+	case *AssignStmt:
+		return &stmt.Comments
+	case *ReturnStmt:
+		return &stmt.Comments
+	case *IfStmt:
+		return &stmt.Comments
+	case *WhileStmt:
+		return &stmt.Comments
+	case *ForInStmt:
+		return &stmt.Comments
+	case *BreakStmt:
+		return &stmt.Comments
+	case *ContinueStmt:
+		return &stmt.Comments
+	case *ExprStmt:
+		return &stmt.Comments
+	}
+	return nil
+}
+
+// ExpressionComments returns the comments in front of an expression that
+// starts an operand, argument or element of an enclosing expression, or nil
+// for expressions that carry none (ranges).
+func ExpressionComments(e Expression) *[]string {
+	switch expr := e.(type) {
+	case *BinaryExpr:
+		return &expr.Comments
+	case *UnaryExpr:
+		return &expr.Comments
+	case *CallExpr:
+		return &expr.Comments
+	case *MethodCallExpr:
+		return &expr.Comments
+	case *FieldAccessExpr:
+		return &expr.Comments
+	case *OldExpr:
+		return &expr.Comments
+	case *Identifier:
+		return &expr.Comments
+	case *SelfExpr:
+		return &expr.Comments
+	case *ResultExpr:
+		return &expr.Comments
+	case *IntLit:
+		return &expr.Comments
+	case *FloatLit:
+		return &expr.Comments
+	case *StringLit:
+		return &expr.Comments
+	case *StringInterp:
+		return &expr.Comments
+	case *BoolLit:
+		return &expr.Comments
+	case *ArrayLit:
+		return &expr.Comments
+	case *IndexExpr:
+		return &expr.Comments
+	case *ForallExpr:
+		return &expr.Comments
+	case *ExistsExpr:
+		return &expr.Comments
+	case *MatchExpr:
+		return &expr.Comments
+	case *TryExpr:
+		return &expr.Comments
+	}
+	return nil
+}
@@ -39,6 +39,9 @@ func printNode(sb *strings.Builder, node Node, indent int) {
 		for _, enum := range n.Enums {
 			printNode(sb, enum, indent+1)
 		}
+		for _, trait := range n.Traits {
+			printNode(sb, trait, indent+1)
+		}
 		for _, intent := range n.Intents {
 			printNode(sb, intent, indent+1)
 		}
@@ -60,7 +63,7 @@ func printNode(sb *strings.Builder, node Node, indent int) {
 		if modifiers != "" {
 			modifiers = " (" + strings.TrimSpace(modifiers) + ")"
 		}
-		sb.WriteString(fmt.Sprintf("%sFunction: %s%s\n", prefix, n.Name, modifiers))
+		sb.WriteString(fmt.Sprintf("%sFunction: %s%s%s\n", prefix, n.Name, typeParams(n.TypeParams), modifiers))
 
 		if len(n.Params) > 0 {
 			sb.WriteString(fmt.Sprintf("%s  Params:\n", prefix))
@@ -108,7 +111,15 @@ func printNode(sb *strings.Builder, node Node, indent int) {
 		if n.IsPublic {
 			visibility = " (public)"
 		}
-		sb.WriteString(fmt.Sprintf("%sEntity: %s%s\n", prefix, n.Name, visibility))
+		sb.WriteString(fmt.Sprintf("%sEntity: %s%s%s\n", prefix, n.Name, typeParams(n.TypeParams), visibility))
+
+		if len(n.Implements) > 0 {
+			names := make([]string, len(n.Implements))
+			for i, t := range n.Implements {
+				names[i] = t.Name
+			}
+			sb.WriteString(fmt.Sprintf("%s  Implements: %s\n", prefix, strings.Join(names, ", ")))
+		}
 
 		if len(n.Fields) > 0 {
 			sb.WriteString(fmt.Sprintf("%s  Fields:\n", prefix))
@@ -241,12 +252,25 @@ func printNode(sb *strings.Builder, node Node, indent int) {
 	case *VerifiedByRef:
 		sb.WriteString(fmt.Sprintf("%s%s\n", prefix, strings.Join(n.Parts, ".")))
 
+	case *TraitDecl:
+		visibility := ""
+		if n.IsPublic {
+			visibility = " (public)"
+		}
+		sb.WriteString(fmt.Sprintf("%sTrait: %s%s\n", prefix, n.Name, visibility))
+		if len(n.Methods) > 0 {
+			sb.WriteString(fmt.Sprintf("%s  Methods:\n", prefix))
+			for _, m := range n.Methods {
+				printNode(sb, m, indent+2)
+			}
+		}
+
 	case *EnumDecl:
 		visibility := ""
 		if n.IsPublic {
 			visibility = " (public)"
 		}
-		sb.WriteString(fmt.Sprintf("%sEnum: %s%s\n", prefix, n.Name, visibility))
+		sb.WriteString(fmt.Sprintf("%sEnum: %s%s%s\n", prefix, n.Name, typeParams(n.TypeParams), visibility))
 		if len(n.Variants) > 0 {
 			sb.WriteString(fmt.Sprintf("%s  Variants:\n", prefix))
 			for _, v := range n.Variants {
@@ -434,14 +458,22 @@ func printNode(sb *strings.Builder, node Node, indent int) {
 	case *ForallExpr:
 		sb.WriteString(fmt.Sprintf("%sForallExpr: %s\n", prefix, n.Variable))
 		sb.WriteString(fmt.Sprintf("%s  Domain:\n", prefix))
-		printNode(sb, n.Domain, indent+2)
+		if n.Map != nil {
+			printNode(sb, n.Map, indent+2)
+		} else {
+			printNode(sb, n.Domain, indent+2)
+		}
 		sb.WriteString(fmt.Sprintf("%s  Body:\n", prefix))
 		printNode(sb, n.Body, indent+2)
 
 	case *ExistsExpr:
 		sb.WriteString(fmt.Sprintf("%sExistsExpr: %s\n", prefix, n.Variable))
 		sb.WriteString(fmt.Sprintf("%s  Domain:\n", prefix))
-		printNode(sb, n.Domain, indent+2)
+		if n.Map != nil {
+			printNode(sb, n.Map, indent+2)
+		} else {
+			printNode(sb, n.Domain, indent+2)
+		}
 		sb.WriteString(fmt.Sprintf("%s  Body:\n", prefix))
 		printNode(sb, n.Body, indent+2)
 
@@ -454,6 +486,22 @@ func printNode(sb *strings.Builder, node Node, indent int) {
 	}
 }
 
+// typeParams renders a type parameter list, e.g. "<T: Ord, U>", or "" when
+// there are none
+func typeParams(params []*TypeParam) string {
+	if len(params) == 0 {
+		return ""
+	}
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.Name
+		if p.Bound != "" {
+			parts[i] += ": " + p.Bound
+		}
+	}
+	return "<" + strings.Join(parts, ", ") + ">"
+}
+
 func tokenTypeToString(tt lexer.TokenType) string {
 	switch tt {
 	case lexer.PLUS:
@@ -6,7 +6,9 @@ import (
 )
 
 // JSBackend wraps the jsbe as a Backend implementation.
-type JSBackend struct{}
+type JSBackend struct {
+	Options jsbe.Options
+}
 
 // Name returns the backend name.
 func (b *JSBackend) Name() string {
@@ -15,10 +17,10 @@ func (b *JSBackend) Name() string {
 
 // Generate produces JavaScript source code from a single IR module.
 func (b *JSBackend) Generate(mod *ir.Module) string {
-	return jsbe.Generate(mod)
+	return jsbe.GenerateWith(mod, b.Options)
 }
 
 // GenerateAll produces JavaScript source from a multi-module IR program.
 func (b *JSBackend) GenerateAll(prog *ir.Program) string {
-	return jsbe.GenerateAll(prog)
+	return jsbe.GenerateAllWith(prog, b.Options)
 }
@@ -6,7 +6,9 @@ import (
 )
 
 // RustBackend wraps the existing rustbe as a Backend implementation.
-type RustBackend struct{}
+type RustBackend struct {
+	Options rustbe.Options
+}
 
 // Name returns the backend name.
 func (b *RustBackend) Name() string {
@@ -15,10 +17,10 @@ func (b *RustBackend) Name() string {
 
 // Generate produces Rust source code from a single IR module.
 func (b *RustBackend) Generate(mod *ir.Module) string {
-	return rustbe.Generate(mod)
+	return rustbe.GenerateWith(mod, b.Options)
 }
 
 // GenerateAll produces Rust source from a multi-module IR program.
 func (b *RustBackend) GenerateAll(prog *ir.Program) string {
-	return rustbe.GenerateAll(prog)
+	return rustbe.GenerateAllWith(prog, b.Options)
 }
@@ -6,7 +6,9 @@ import (
 )
 
 // WasmBackend wraps the wasmbe as a BinaryBackend implementation.
-type WasmBackend struct{}
+type WasmBackend struct {
+	Options wasmbe.Options
+}
 
 // Name returns the backend name.
 func (b *WasmBackend) Name() string {
@@ -15,10 +17,10 @@ func (b *WasmBackend) Name() string {
 
 // GenerateBytes produces WASM binary from a single IR module.
 func (b *WasmBackend) GenerateBytes(mod *ir.Module) []byte {
-	return wasmbe.Generate(mod)
+	return wasmbe.GenerateWith(mod, b.Options)
 }
 
 // GenerateAllBytes produces WASM binary from a multi-module IR program.
 func (b *WasmBackend) GenerateAllBytes(prog *ir.Program) []byte {
-	return wasmbe.GenerateAll(prog)
+	return wasmbe.GenerateAllWith(prog, b.Options)
 }
@@ -24,6 +24,7 @@ type EntityContext struct {
 	Entity        *EntityInfo
 	InConstructor bool
 	InMethod      bool
+	Method        *MethodInfo // the method being checked, if InMethod
 }
 
 // ModuleSymbols holds the public symbols exported by a module
@@ -31,10 +32,12 @@ type ModuleSymbols struct {
 	Functions map[string]*FuncInfo
 	Entities  map[string]*EntityInfo
 	Enums     map[string]*EnumInfo
+	Traits    map[string]*TraitInfo
 	// Keep references to the AST declarations for codegen and contract checking
 	FunctionDecls map[string]*ast.FunctionDecl
 	EntityDecls   map[string]*ast.EntityDecl
 	EnumDecls     map[string]*ast.EnumDecl
+	TraitDecls    map[string]*ast.TraitDecl
 }
 
 // Checker performs semantic analysis on the AST
@@ -43,17 +46,22 @@ type Checker struct {
 	diag         *diagnostic.Diagnostics
 	entities     map[string]*EntityInfo
 	enums        map[string]*EnumInfo
+	traits       map[string]*TraitInfo
 	enumVariants map[string]*EnumVariantLookup
 	functions    map[string]*FuncInfo
 	scope        *Scope
 	exprTypes    map[ast.Expression]*Type
+	upcasts      map[ast.Expression]*Type // entity values used as trait values
 
 	// Context tracking
 	contractCtx     ContractContext
 	entityCtx       *EntityContext
+	inTrait         bool // checking trait contracts, which have no state for old() to capture
 	loopDepth       int
-	currentFunc     *FuncInfo // Track current function for Result/Option variant inference
-	letDeclaredType *Type     // Track type annotation from let statement for variant inference
+	currentFunc     *FuncInfo                  // Track current function for Result/Option variant inference
+	letDeclaredType *Type                      // Track type annotation from let statement for variant inference
+	typeParams      map[string]*Type           // type parameters of the generic declaration being checked
+	typeArgs        map[ast.Expression][]*Type // inferred type arguments of generic function calls
 
 	// Cross-file (multi-module) context
 	moduleImports map[string]*ModuleSymbols // module alias -> public symbols
@@ -69,6 +77,7 @@ type EnumVariantLookup struct {
 // FuncInfo holds information about a function
 type FuncInfo struct {
 	Name       string
+	TypeParams []*Type // empty unless the function is generic
 	Params     []ParamInfo
 	ReturnType *Type
 }
@@ -79,6 +88,13 @@ type CheckResult struct {
 	ExprTypes   map[ast.Expression]*Type
 	Entities    map[string]*EntityInfo
 	Enums       map[string]*EnumInfo
+	// TypeArgs holds the type arguments inferred for each call to a generic
+	// function, in the order of its type parameters.
+	TypeArgs map[ast.Expression][]*Type
+	Traits   map[string]*TraitInfo
+	// Upcasts holds the expressions of entity type used where a trait type
+	// is expected, with that trait type.
+	Upcasts map[ast.Expression]*Type
 }
 
 // CheckWithResult performs semantic analysis and returns results for downstream stages
@@ -88,18 +104,23 @@ func CheckWithResult(prog *ast.Program) *CheckResult {
 		diag:         diagnostic.New(),
 		entities:     make(map[string]*EntityInfo),
 		enums:        make(map[string]*EnumInfo),
+		traits:       make(map[string]*TraitInfo),
 		enumVariants: make(map[string]*EnumVariantLookup),
 		functions:    make(map[string]*FuncInfo),
 		scope:        NewScope(nil),
 		contractCtx:  CtxNormal,
 		entityCtx:    nil,
 		exprTypes:    make(map[ast.Expression]*Type),
+		upcasts:      make(map[ast.Expression]*Type),
+		typeArgs:     make(map[ast.Expression][]*Type),
 	}
 
 	c.registerEnums()
+	c.registerTraits()
 	c.registerEntities()
 	c.registerFunctions()
 	c.checkFunctions()
+	c.checkTraits()
 	c.checkEntities()
 	c.verifyIntents()
 
@@ -108,6 +129,9 @@ func CheckWithResult(prog *ast.Program) *CheckResult {
 		ExprTypes:   c.exprTypes,
 		Entities:    c.entities,
 		Enums:       c.enums,
+		TypeArgs:    c.typeArgs,
+		Traits:      c.traits,
+		Upcasts:     c.upcasts,
 	}
 }
 
@@ -122,6 +146,9 @@ type CheckAllResult struct {
 	ExprTypes   map[ast.Expression]*Type
 	Entities    map[string]*EntityInfo
 	Enums       map[string]*EnumInfo
+	TypeArgs    map[ast.Expression][]*Type
+	Traits      map[string]*TraitInfo
+	Upcasts     map[ast.Expression]*Type
 }
 
 // moduleNameFromPath derives a module name from a file path.
@@ -139,6 +166,9 @@ func CheckAll(registry map[string]*ast.Program, sortedPaths []string) *CheckAllR
 	allExprTypes := make(map[ast.Expression]*Type)
 	allEntities := make(map[string]*EntityInfo)
 	allEnums := make(map[string]*EnumInfo)
+	allTypeArgs := make(map[ast.Expression][]*Type)
+	allTraits := make(map[string]*TraitInfo)
+	allUpcasts := make(map[ast.Expression]*Type)
 
 	// Pass 1: Register public symbols from all files
 	publicSymbols := make(map[string]*ModuleSymbols) // moduleName -> symbols
@@ -154,9 +184,11 @@ func CheckAll(registry map[string]*ast.Program, sortedPaths []string) *CheckAllR
 			Functions:     make(map[string]*FuncInfo),
 			Entities:      make(map[string]*EntityInfo),
 			Enums:         make(map[string]*EnumInfo),
+			Traits:        make(map[string]*TraitInfo),
 			FunctionDecls: make(map[string]*ast.FunctionDecl),
 			EntityDecls:   make(map[string]*ast.EntityDecl),
 			EnumDecls:     make(map[string]*ast.EnumDecl),
+			TraitDecls:    make(map[string]*ast.TraitDecl),
 		}
 
 		// Create a temporary checker to register entities/enums/functions for type resolution
@@ -165,11 +197,13 @@ func CheckAll(registry map[string]*ast.Program, sortedPaths []string) *CheckAllR
 			diag:         diagnostic.New(),
 			entities:     make(map[string]*EntityInfo),
 			enums:        make(map[string]*EnumInfo),
+			traits:       make(map[string]*TraitInfo),
 			enumVariants: make(map[string]*EnumVariantLookup),
 			functions:    make(map[string]*FuncInfo),
 			scope:        NewScope(nil),
 			contractCtx:  CtxNormal,
 			exprTypes:    make(map[ast.Expression]*Type),
+			upcasts:      make(map[ast.Expression]*Type),
 		}
 
 		// Inject already-collected symbols from this module's imports so that
@@ -184,6 +218,11 @@ func CheckAll(registry map[string]*ast.Program, sortedPaths []string) *CheckAllR
 						tmpChecker.entities[name] = entityInfo
 					}
 				}
+				for name, traitInfo := range syms.Traits {
+					if _, exists := tmpChecker.traits[name]; !exists {
+						tmpChecker.traits[name] = traitInfo
+					}
+				}
 				for name, enumInfo := range syms.Enums {
 					if _, exists := tmpChecker.enums[name]; !exists {
 						tmpChecker.enums[name] = enumInfo
@@ -201,6 +240,7 @@ func CheckAll(registry map[string]*ast.Program, sortedPaths []string) *CheckAllR
 		}
 
 		tmpChecker.registerEnums()
+		tmpChecker.registerTraits()
 		tmpChecker.registerEntities()
 		tmpChecker.registerFunctions()
 
@@ -234,6 +274,16 @@ func CheckAll(registry map[string]*ast.Program, sortedPaths []string) *CheckAllR
 			}
 		}
 
+		// Collect public traits
+		for _, trait := range prog.Traits {
+			if trait.IsPublic {
+				if ti, ok := tmpChecker.traits[trait.Name]; ok {
+					modSyms.Traits[trait.Name] = ti
+					modSyms.TraitDecls[trait.Name] = trait
+				}
+			}
+		}
+
 		publicSymbols[modName] = modSyms
 		// Also register by declared module name (e.g., "attractor_validation" vs file "validation")
 		if prog.Module != nil && prog.Module.Name != "" && prog.Module.Name != modName {
@@ -278,11 +328,14 @@ func CheckAll(registry map[string]*ast.Program, sortedPaths []string) *CheckAllR
 			diag:          diagnostic.New(),
 			entities:      make(map[string]*EntityInfo),
 			enums:         make(map[string]*EnumInfo),
+			traits:        make(map[string]*TraitInfo),
 			enumVariants:  make(map[string]*EnumVariantLookup),
 			functions:     make(map[string]*FuncInfo),
 			scope:         NewScope(nil),
 			contractCtx:   CtxNormal,
 			exprTypes:     make(map[ast.Expression]*Type),
+			upcasts:       make(map[ast.Expression]*Type),
+			typeArgs:      make(map[ast.Expression][]*Type),
 			moduleImports: moduleImports,
 			moduleFile:    filePath,
 		}
@@ -297,7 +350,7 @@ func CheckAll(registry map[string]*ast.Program, sortedPaths []string) *CheckAllR
 					c.entities[name] = entityInfo
 					c.scope.Define(name, &Symbol{
 						Name: name,
-						Type: &Type{Name: name, IsEntity: true, Entity: entityInfo},
+						Type: EntityType(entityInfo),
 						Kind: SymEntity,
 					})
 				}
@@ -307,7 +360,7 @@ func CheckAll(registry map[string]*ast.Program, sortedPaths []string) *CheckAllR
 					c.enums[name] = enumInfo
 					c.scope.Define(name, &Symbol{
 						Name: name,
-						Type: &Type{Name: name, IsEnum: true, EnumInfo: enumInfo},
+						Type: EnumType(enumInfo),
 						Kind: SymEnum,
 					})
 					// Also register enum variants so bare variant names resolve
@@ -321,6 +374,16 @@ func CheckAll(registry map[string]*ast.Program, sortedPaths []string) *CheckAllR
 					}
 				}
 			}
+			for name, traitInfo := range modSyms.Traits {
+				if _, exists := c.traits[name]; !exists {
+					c.traits[name] = traitInfo
+					c.scope.Define(name, &Symbol{
+						Name: name,
+						Type: TraitType(traitInfo),
+						Kind: SymTrait,
+					})
+				}
+			}
 			// Also inject imported functions so cross-module function calls resolve
 			for name, funcInfo := range modSyms.Functions {
 				if _, exists := c.functions[name]; !exists {
@@ -330,10 +393,12 @@ func CheckAll(registry map[string]*ast.Program, sortedPaths []string) *CheckAllR
 		}
 
 		c.registerEnums()
+		c.registerTraits()
 		c.registerEntities()
 		c.registerFunctions()
 
 		c.checkFunctions()
+		c.checkTraits()
 		c.checkEntities()
 		c.verifyIntents()
 
@@ -354,6 +419,15 @@ func CheckAll(registry map[string]*ast.Program, sortedPaths []string) *CheckAllR
 		for name, info := range c.enums {
 			allEnums[name] = info
 		}
+		for expr, args := range c.typeArgs {
+			allTypeArgs[expr] = args
+		}
+		for name, info := range c.traits {
+			allTraits[name] = info
+		}
+		for expr, t := range c.upcasts {
+			allUpcasts[expr] = t
+		}
 	}
 
 	return &CheckAllResult{
@@ -361,6 +435,9 @@ func CheckAll(registry map[string]*ast.Program, sortedPaths []string) *CheckAllR
 		ExprTypes:   allExprTypes,
 		Entities:    allEntities,
 		Enums:       allEnums,
+		TypeArgs:    allTypeArgs,
+		Traits:      allTraits,
+		Upcasts:     allUpcasts,
 	}
 }
 
@@ -372,6 +449,11 @@ func (c *Checker) registerEntities() {
 			c.diag.Errorf(line, col, "entity '%s' already defined", entity.Name)
 			continue
 		}
+		if _, exists := c.traits[entity.Name]; exists {
+			line, col := entity.Pos()
+			c.diag.Errorf(line, col, "entity '%s' conflicts with existing trait", entity.Name)
+			continue
+		}
 
 		info := &EntityInfo{
 			Name:           entity.Name,
@@ -380,11 +462,12 @@ func (c *Checker) registerEntities() {
 			HasInvariant:   len(entity.Invariants) > 0,
 			Methods:        make(map[string]*MethodInfo),
 			HasConstructor: entity.Constructor != nil,
+			TypeParams:     c.declareTypeParams(entity.TypeParams),
 		}
 
 		// Register fields
 		for _, field := range entity.Fields {
-			fieldType := ResolveType(field.Type, c.entities, c.enums)
+			fieldType := c.resolveType(field.Type)
 			if fieldType == nil {
 				line, col := field.Pos()
 				c.diag.Errorf(line, col, "unknown type '%s'", field.Type.Name)
@@ -394,44 +477,24 @@ func (c *Checker) registerEntities() {
 			info.FieldOrder = append(info.FieldOrder, field.Name)
 		}
 
+		// Register constructor parameters
+		if entity.Constructor != nil {
+			info.ConstructorParams = c.registerParams(entity.Constructor.Params)
+		}
+
 		// Register methods
 		for _, method := range entity.Methods {
-			params := make([]ParamInfo, 0, len(method.Params))
-			for _, p := range method.Params {
-				pType := ResolveType(p.Type, c.entities, c.enums)
-				if pType == nil {
-					line, col := p.Pos()
-					c.diag.Errorf(line, col, "unknown type '%s'", p.Type.Name)
-					pType = TypeInt // fallback
-				}
-				params = append(params, ParamInfo{Name: p.Name, Type: pType})
-			}
-
-			returnType := TypeVoid
-			if method.ReturnType != nil {
-				returnType = ResolveType(method.ReturnType, c.entities, c.enums)
-				if returnType == nil {
-					line, col := method.Pos()
-					c.diag.Errorf(line, col, "unknown type '%s'", method.ReturnType.Name)
-					returnType = TypeVoid // fallback
-				}
-			}
-
-			info.Methods[method.Name] = &MethodInfo{
-				Name:        method.Name,
-				Params:      params,
-				ReturnType:  returnType,
-				HasRequires: len(method.Requires) > 0,
-				HasEnsures:  len(method.Ensures) > 0,
-			}
+			info.Methods[method.Name] = c.registerMethod(method)
 		}
+		c.checkImplements(entity, info)
 
+		c.typeParams = nil
 		c.entities[entity.Name] = info
 
 		// Register entity in global scope
 		c.scope.Define(entity.Name, &Symbol{
 			Name: entity.Name,
-			Type: &Type{Name: entity.Name, IsEntity: true, Entity: info},
+			Type: EntityType(info),
 			Kind: SymEntity,
 		})
 	}
@@ -453,8 +516,9 @@ func (c *Checker) registerEnums() {
 		}
 
 		info := &EnumInfo{
-			Name:     enum.Name,
-			Variants: make([]*EnumVariantInfo, 0, len(enum.Variants)),
+			Name:       enum.Name,
+			Variants:   make([]*EnumVariantInfo, 0, len(enum.Variants)),
+			TypeParams: c.declareTypeParams(enum.TypeParams),
 		}
 
 		// Track variant names for duplicate detection
@@ -472,7 +536,7 @@ func (c *Checker) registerEnums() {
 			// Resolve field types
 			fields := make([]ParamInfo, 0, len(variant.Fields))
 			for _, field := range variant.Fields {
-				fieldType := ResolveType(field.Type, c.entities, c.enums)
+				fieldType := c.resolveType(field.Type)
 				if fieldType == nil {
 					line, col := field.Pos()
 					c.diag.Errorf(line, col, "unknown type '%s'", field.Type.Name)
@@ -495,10 +559,11 @@ func (c *Checker) registerEnums() {
 			}
 		}
 
+		c.typeParams = nil
 		c.enums[enum.Name] = info
 
 		// Register enum in global scope
-		enumType := &Type{Name: enum.Name, IsEnum: true, EnumInfo: info}
+		enumType := EnumType(info)
 		c.scope.Define(enum.Name, &Symbol{
 			Name: enum.Name,
 			Type: enumType,
@@ -516,29 +581,23 @@ func (c *Checker) registerFunctions() {
 			continue
 		}
 
-		params := make([]ParamInfo, 0, len(fn.Params))
-		for _, p := range fn.Params {
-			pType := ResolveType(p.Type, c.entities, c.enums)
-			if pType == nil {
-				line, col := p.Pos()
-				c.diag.Errorf(line, col, "unknown type '%s'", p.Type.Name)
-				pType = TypeInt // fallback
-			}
-			params = append(params, ParamInfo{Name: p.Name, Type: pType})
-		}
+		typeParams := c.declareTypeParams(fn.TypeParams)
+		params := c.registerParams(fn.Params)
 
 		returnType := TypeVoid
 		if fn.ReturnType != nil {
-			returnType = ResolveType(fn.ReturnType, c.entities, c.enums)
+			returnType = c.resolveType(fn.ReturnType)
 			if returnType == nil {
 				line, col := fn.Pos()
 				c.diag.Errorf(line, col, "unknown type '%s'", fn.ReturnType.Name)
 				returnType = TypeVoid // fallback
 			}
 		}
+		c.typeParams = nil
 
 		c.functions[fn.Name] = &FuncInfo{
 			Name:       fn.Name,
+			TypeParams: typeParams,
 			Params:     params,
 			ReturnType: returnType,
 		}
@@ -551,6 +610,74 @@ func (c *Checker) registerFunctions() {
 	}
 }
 
+// registerParams resolves the types of a parameter list
+func (c *Checker) registerParams(params []*ast.Param) []ParamInfo {
+	infos := make([]ParamInfo, 0, len(params))
+	for _, p := range params {
+		pType := c.resolveType(p.Type)
+		if pType == nil {
+			line, col := p.Pos()
+			c.diag.Errorf(line, col, "unknown type '%s'", p.Type.Name)
+			pType = TypeInt // fallback
+		}
+		infos = append(infos, ParamInfo{Name: p.Name, Type: pType})
+	}
+	return infos
+}
+
+// declareTypeParams brings the type parameters of a generic declaration into
+// scope and returns their types in declaration order
+func (c *Checker) declareTypeParams(params []*ast.TypeParam) []*Type {
+	c.typeParams = TypeParamScope(params)
+	var types []*Type
+	seen := make(map[string]bool)
+	for _, p := range params {
+		if seen[p.Name] {
+			c.diag.Errorf(p.Line, p.Column, "duplicate type parameter '%s'", p.Name)
+			continue
+		}
+		seen[p.Name] = true
+		if p.Bound != "" && p.Bound != BoundEq && p.Bound != BoundOrd {
+			c.diag.Errorf(p.Line, p.Column, "unknown bound '%s' on type parameter '%s' (expected Eq or Ord)", p.Bound, p.Name)
+		}
+		types = append(types, c.typeParams[p.Name])
+	}
+	return types
+}
+
+// resolveType resolves a type reference with the type parameters of the
+// current declaration in scope, and reports type arguments that do not
+// satisfy the bounds of a generic entity or enum
+func (c *Checker) resolveType(ref *ast.TypeRef) *Type {
+	t := ResolveTypeIn(ref, c.entities, c.enums, c.traits, c.typeParams)
+	if t != nil {
+		c.checkTypeBounds(t, ref)
+	}
+	return t
+}
+
+// checkTypeBounds checks the type arguments of generic entities and enums
+// in t, and the key types of maps
+func (c *Checker) checkTypeBounds(t *Type, ref *ast.TypeRef) {
+	if IsMap(t) && !IsMapKey(t.TypeParams[0]) {
+		c.diag.Errorf(ref.Line, ref.Column, "Map key type must be Int, String or Bool, got %s", t.TypeParams[0].String())
+	}
+	var params []*Type
+	switch {
+	case t.IsEntity && t.Entity != nil && t.Entity.Generic != nil:
+		params = t.Entity.Generic.TypeParams
+	case t.IsEnum && t.EnumInfo != nil && t.EnumInfo.Generic != nil:
+		params = t.EnumInfo.Generic.TypeParams
+	}
+	for i, arg := range t.TypeParams {
+		if i < len(params) && !satisfiesBound(arg, params[i].Bound) {
+			c.diag.Errorf(ref.Line, ref.Column, "type %s does not satisfy bound %s of type parameter '%s' of '%s'",
+				arg.String(), params[i].Bound, params[i].Name, t.Name)
+		}
+		c.checkTypeBounds(arg, ref)
+	}
+}
+
 // checkFunctions checks all function bodies
 func (c *Checker) checkFunctions() {
 	for _, fn := range c.prog.Functions {
@@ -564,10 +691,11 @@ func (c *Checker) checkFunction(fn *ast.FunctionDecl) {
 
 	// Set current function context for Result/Option variant checking
 	c.currentFunc = c.functions[fn.Name]
+	c.typeParams = TypeParamScope(fn.TypeParams)
 
 	// Add parameters to function scope
 	for _, p := range fn.Params {
-		pType := ResolveType(p.Type, c.entities, c.enums)
+		pType := ResolveTypeIn(p.Type, c.entities, c.enums, c.traits, c.typeParams)
 		if pType != nil {
 			funcScope.Define(p.Name, &Symbol{
 				Name:    p.Name,
@@ -607,6 +735,7 @@ func (c *Checker) checkFunction(fn *ast.FunctionDecl) {
 
 	// Clear current function context
 	c.currentFunc = nil
+	c.typeParams = nil
 }
 
 // checkEntities checks all entity constructors and methods
@@ -618,6 +747,7 @@ func (c *Checker) checkEntities() {
 		c.entityCtx = &EntityContext{
 			Entity: info,
 		}
+		c.typeParams = TypeParamScope(entity.TypeParams)
 
 		// Check invariants
 		oldCtx := c.contractCtx
@@ -627,7 +757,7 @@ func (c *Checker) checkEntities() {
 			// Add 'self' to scope
 			entityScope.Define("self", &Symbol{
 				Name:    "self",
-				Type:    &Type{Name: entity.Name, IsEntity: true, Entity: info},
+				Type:    EntityType(info),
 				Mutable: false,
 				Kind:    SymVariable,
 			})
@@ -650,11 +780,14 @@ func (c *Checker) checkEntities() {
 		// Check methods
 		for _, method := range entity.Methods {
 			c.entityCtx.InMethod = true
+			c.entityCtx.Method = info.Methods[method.Name]
 			c.checkMethod(entity, method, info)
 			c.entityCtx.InMethod = false
+			c.entityCtx.Method = nil
 		}
 
 		c.entityCtx = nil
+		c.typeParams = nil
 	}
 }
 
@@ -665,14 +798,14 @@ func (c *Checker) checkConstructor(entity *ast.EntityDecl, ctor *ast.Constructor
 	// Add 'self' to constructor scope
 	ctorScope.Define("self", &Symbol{
 		Name:    "self",
-		Type:    &Type{Name: entity.Name, IsEntity: true, Entity: info},
+		Type:    EntityType(info),
 		Mutable: true,
 		Kind:    SymVariable,
 	})
 
 	// Add parameters to constructor scope
 	for _, p := range ctor.Params {
-		pType := ResolveType(p.Type, c.entities, c.enums)
+		pType := ResolveTypeIn(p.Type, c.entities, c.enums, c.traits, c.typeParams)
 		if pType != nil {
 			ctorScope.Define(p.Name, &Symbol{
 				Name:    p.Name,
@@ -718,14 +851,14 @@ func (c *Checker) checkMethod(entity *ast.EntityDecl, method *ast.MethodDecl, in
 	// Add 'self' to method scope
 	methodScope.Define("self", &Symbol{
 		Name:    "self",
-		Type:    &Type{Name: entity.Name, IsEntity: true, Entity: info},
+		Type:    EntityType(info),
 		Mutable: false,
 		Kind:    SymVariable,
 	})
 
 	// Add parameters to method scope
 	for _, p := range method.Params {
-		pType := ResolveType(p.Type, c.entities, c.enums)
+		pType := ResolveTypeIn(p.Type, c.entities, c.enums, c.traits, c.typeParams)
 		if pType != nil {
 			methodScope.Define(p.Name, &Symbol{
 				Name:    p.Name,
@@ -736,6 +869,11 @@ func (c *Checker) checkMethod(entity *ast.EntityDecl, method *ast.MethodDecl, in
 		}
 	}
 
+	// Give 'result' in ensures clauses the method's return type
+	if m := info.Methods[method.Name]; m != nil {
+		c.currentFunc = &FuncInfo{Name: method.Name, Params: m.Params, ReturnType: m.ReturnType}
+	}
+
 	// Check requires clauses
 	oldCtx := c.contractCtx
 	c.contractCtx = CtxRequires
@@ -757,6 +895,7 @@ func (c *Checker) checkMethod(entity *ast.EntityDecl, method *ast.MethodDecl, in
 		}
 	}
 	c.contractCtx = oldCtx
+	c.currentFunc = nil
 
 	// Check body
 	if method.Body != nil {
@@ -810,7 +949,7 @@ func (c *Checker) checkLetStmt(stmt *ast.LetStmt, scope *Scope) {
 	// Resolve declared type first
 	var declaredType *Type
 	if stmt.Type != nil {
-		declaredType = ResolveType(stmt.Type, c.entities, c.enums)
+		declaredType = c.resolveType(stmt.Type)
 		if declaredType == nil {
 			line, col := stmt.Pos()
 			c.diag.Errorf(line, col, "unknown type '%s'", stmt.Type.Name)
@@ -829,7 +968,7 @@ func (c *Checker) checkLetStmt(stmt *ast.LetStmt, scope *Scope) {
 
 	// Check type compatibility
 	if declaredType != nil && valueType != nil {
-		if !valueType.Equal(declaredType) {
+		if !c.assignable(stmt.Value, valueType, declaredType) {
 			line, col := stmt.Pos()
 			c.diag.Errorf(line, col, "type mismatch: cannot assign %s to %s", valueType.Name, declaredType.Name)
 		}
@@ -877,6 +1016,8 @@ func (c *Checker) checkAssignStmt(stmt *ast.AssignStmt, scope *Scope) {
 		}
 	}
 
+	c.checkFieldWrite(stmt.Target, "assign to")
+
 	// Set target type context for empty array literal inference
 	c.letDeclaredType = targetType
 
@@ -888,17 +1029,53 @@ func (c *Checker) checkAssignStmt(stmt *ast.AssignStmt, scope *Scope) {
 
 	// Check type compatibility
 	if targetType != nil && valueType != nil {
-		if !valueType.Equal(targetType) {
+		if !c.assignable(stmt.Value, valueType, targetType) {
 			line, col := stmt.Pos()
 			c.diag.Errorf(line, col, "type mismatch: cannot assign %s to %s", valueType.Name, targetType.Name)
 		}
 	}
 }
 
+// checkFieldWrite rejects writes through the fields of an entity other
+// than self. Invariant proofs assume that only an entity's own
+// constructor and methods change its fields, so assignments such as
+// a.balance = x from outside would let a proved invariant be broken.
+func (c *Checker) checkFieldWrite(target ast.Expression, action string) {
+	for {
+		switch t := target.(type) {
+		case *ast.IndexExpr:
+			target = t.Object
+		case *ast.FieldAccessExpr:
+			if _, ok := t.Object.(*ast.SelfExpr); ok {
+				return
+			}
+			owner := "entity"
+			if objType := c.exprTypes[t.Object]; objType != nil {
+				owner = objType.Name
+			}
+			line, col := t.Pos()
+			c.diag.Errorf(line, col, "cannot %s field '%s' of %s outside its constructor and methods", action, t.Field, owner)
+			return
+		default:
+			return
+		}
+	}
+}
+
 // checkReturnStmt checks a return statement
 func (c *Checker) checkReturnStmt(stmt *ast.ReturnStmt, scope *Scope) {
 	if stmt.Value != nil {
-		c.checkExpression(stmt.Value, scope)
+		var returnType *Type
+		switch {
+		case c.currentFunc != nil:
+			returnType = c.currentFunc.ReturnType
+		case c.entityCtx != nil && c.entityCtx.Method != nil:
+			returnType = c.entityCtx.Method.ReturnType
+		}
+		valueType := c.checkExpected(stmt.Value, returnType, scope)
+		if returnType != nil {
+			c.assignable(stmt.Value, valueType, returnType)
+		}
 	}
 }
 
@@ -964,7 +1141,7 @@ func (c *Checker) checkWhileStmt(stmt *ast.WhileStmt, scope *Scope) {
 func (c *Checker) checkForInStmt(stmt *ast.ForInStmt, scope *Scope) {
 	line, col := stmt.Pos()
 
-	var elemType *Type
+	var elemType, valueType *Type
 
 	// Check if iterable is a range expression
 	if rangeExpr, ok := stmt.Iterable.(*ast.RangeExpr); ok {
@@ -987,12 +1164,18 @@ func (c *Checker) checkForInStmt(stmt *ast.ForInStmt, scope *Scope) {
 			return
 		}
 
-		if iterType.Name != "Array" || !iterType.IsGeneric || len(iterType.TypeParams) != 1 {
-			c.diag.Errorf(line, col, "cannot iterate over type %s (expected Array or range)", iterType.String())
+		if IsMap(iterType) {
+			// Map iteration: the key, and optionally the value
+			elemType, valueType = iterType.TypeParams[0], iterType.TypeParams[1]
+		} else if iterType.Name != "Array" || !iterType.IsGeneric || len(iterType.TypeParams) != 1 {
+			c.diag.Errorf(line, col, "cannot iterate over type %s (expected Array, Map or range)", iterType.String())
 			return
+		} else {
+			elemType = iterType.TypeParams[0]
 		}
-
-		elemType = iterType.TypeParams[0]
+	}
+	if stmt.ValueVariable != "" && valueType == nil {
+		c.diag.Errorf(line, col, "for-in with two variables requires a Map")
 	}
 
 	// Create loop scope with loop variable
@@ -1005,6 +1188,14 @@ func (c *Checker) checkForInStmt(stmt *ast.ForInStmt, scope *Scope) {
 			Kind:    SymVariable,
 		})
 	}
+	if stmt.ValueVariable != "" && valueType != nil {
+		loopScope.Define(stmt.ValueVariable, &Symbol{
+			Name:    stmt.ValueVariable,
+			Type:    valueType,
+			Mutable: false,
+			Kind:    SymVariable,
+		})
+	}
 
 	// Track loop depth for break/continue validation
 	c.loopDepth++
@@ -1130,21 +1321,17 @@ func (c *Checker) checkBinaryExpr(expr *ast.BinaryExpr, scope *Scope) *Type {
 		return nil
 
 	case lexer.EQ, lexer.NEQ:
-		// Works on Int, Float, String, Bool (same types)
-		if leftType.Equal(rightType) {
-			if leftType.Equal(TypeInt) || leftType.Equal(TypeFloat) || leftType.Equal(TypeString) || leftType.Equal(TypeBool) {
-				return TypeBool
-			}
+		// Works on Int, Float, String, Bool and type parameters bounded by Eq (same types)
+		if leftType.Equal(rightType) && satisfiesBound(leftType, BoundEq) {
+			return TypeBool
 		}
 		c.diag.Errorf(line, col, "operator '%s' not defined for %s and %s", expr.Op, leftType.Name, rightType.Name)
 		return nil
 
 	case lexer.LT, lexer.GT, lexer.LEQ, lexer.GEQ:
-		// Works on Int, Float, String (same types)
-		if leftType.Equal(rightType) {
-			if leftType.Equal(TypeInt) || leftType.Equal(TypeFloat) || leftType.Equal(TypeString) {
-				return TypeBool
-			}
+		// Works on Int, Float, String and type parameters bounded by Ord (same types)
+		if leftType.Equal(rightType) && satisfiesBound(leftType, BoundOrd) {
+			return TypeBool
 		}
 		c.diag.Errorf(line, col, "operator '%s' not defined for %s and %s", expr.Op, leftType.Name, rightType.Name)
 		return nil
@@ -1221,13 +1408,18 @@ func (c *Checker) checkCallExpr(expr *ast.CallExpr, scope *Scope) *Type {
 		}
 		argType := c.checkExpression(expr.Args[0], scope)
 		if argType != nil {
-			if argType.Name != "Array" || !argType.IsGeneric {
-				c.diag.Errorf(line, col, "len() requires Array argument, got %s", argType.String())
+			if (argType.Name != "Array" || !argType.IsGeneric) && !IsMap(argType) {
+				c.diag.Errorf(line, col, "len() requires Array argument or Map argument, got %s", argType.String())
 			}
 		}
 		return TypeInt
 	}
 
+	// Handle Map() built-in, an empty map
+	if expr.Function == "Map" {
+		return c.checkMapConstructor(expr)
+	}
+
 	// Check if it's a built-in Result/Option variant constructor (Ok, Err, Some)
 	if expr.Function == "Ok" || expr.Function == "Err" || expr.Function == "Some" {
 		return c.checkBuiltinVariant(expr, scope)
@@ -1235,6 +1427,9 @@ func (c *Checker) checkCallExpr(expr *ast.CallExpr, scope *Scope) *Type {
 
 	// Check if it's a variant constructor (enum variant with data)
 	if lookup, exists := c.enumVariants[expr.Function]; exists {
+		if len(lookup.EnumInfo.TypeParams) > 0 {
+			return c.checkGenericVariant(expr, lookup, expr.Args, scope)
+		}
 		variant := lookup.VariantInfo
 		// Check argument count matches field count
 		if len(expr.Args) != len(variant.Fields) {
@@ -1244,7 +1439,7 @@ func (c *Checker) checkCallExpr(expr *ast.CallExpr, scope *Scope) *Type {
 		// Check argument types match field types
 		for i, arg := range expr.Args {
 			argType := c.checkExpression(arg, scope)
-			if i < len(variant.Fields) && argType != nil && !argType.Equal(variant.Fields[i].Type) {
+			if i < len(variant.Fields) && argType != nil && !c.assignable(arg, argType, variant.Fields[i].Type) {
 				argLine, argCol := arg.Pos()
 				c.diag.Errorf(argLine, argCol, "variant '%s' field '%s' expects %s, got %s",
 					expr.Function, variant.Fields[i].Name, variant.Fields[i].Type.String(), argType.String())
@@ -1255,14 +1450,15 @@ func (c *Checker) checkCallExpr(expr *ast.CallExpr, scope *Scope) *Type {
 
 	// Check if it's an entity constructor
 	if entity, exists := c.entities[expr.Function]; exists {
+		if len(entity.TypeParams) > 0 {
+			return c.checkGenericConstructor(expr, expr.Function, entity, expr.Args, scope)
+		}
 		if !entity.HasConstructor {
 			c.diag.Errorf(line, col, "entity '%s' has no constructor", expr.Function)
 			return nil
 		}
 
-		// For now, we don't track constructor parameter info separately
-		// In a full implementation, we'd check argument types here
-
+		c.checkConstructorArgs(expr.Function, entity, expr.Args, scope)
 		return &Type{Name: expr.Function, IsEntity: true, Entity: entity}
 	}
 
@@ -1272,6 +1468,9 @@ func (c *Checker) checkCallExpr(expr *ast.CallExpr, scope *Scope) *Type {
 		c.diag.Errorf(line, col, "unknown function '%s'", expr.Function)
 		return nil
 	}
+	if len(fn.TypeParams) > 0 {
+		return c.checkGenericCall(expr, expr.Function, fn, expr.Args, scope)
+	}
 
 	// Check argument count
 	if len(expr.Args) != len(fn.Params) {
@@ -1282,8 +1481,8 @@ func (c *Checker) checkCallExpr(expr *ast.CallExpr, scope *Scope) *Type {
 
 	// Check argument types
 	for i, arg := range expr.Args {
-		argType := c.checkExpression(arg, scope)
-		if argType != nil && !argType.Equal(fn.Params[i].Type) {
+		argType := c.checkExpected(arg, fn.Params[i].Type, scope)
+		if argType != nil && !c.assignable(arg, argType, fn.Params[i].Type) {
 			argLine, argCol := arg.Pos()
 			c.diag.Errorf(argLine, argCol, "argument %d to '%s': expected %s, got %s",
 				i+1, expr.Function, fn.Params[i].Type.Name, argType.Name)
@@ -1293,6 +1492,23 @@ func (c *Checker) checkCallExpr(expr *ast.CallExpr, scope *Scope) *Type {
 	return fn.ReturnType
 }
 
+// checkConstructorArgs checks the arguments to the constructor of a
+// non-generic entity
+func (c *Checker) checkConstructorArgs(name string, entity *EntityInfo, args []ast.Expression, scope *Scope) {
+	for i, arg := range args {
+		var want *Type
+		if i < len(entity.ConstructorParams) {
+			want = entity.ConstructorParams[i].Type
+		}
+		argType := c.checkExpected(arg, want, scope)
+		if want != nil && argType != nil && !c.assignable(arg, argType, want) {
+			argLine, argCol := arg.Pos()
+			c.diag.Errorf(argLine, argCol, "argument %d to constructor of '%s': expected %s, got %s",
+				i+1, name, want.String(), argType.String())
+		}
+	}
+}
+
 // checkBuiltinVariant checks built-in Result/Option variant constructors (Ok, Err, Some)
 func (c *Checker) checkBuiltinVariant(expr *ast.CallExpr, scope *Scope) *Type {
 	line, col := expr.Pos()
@@ -1330,7 +1546,7 @@ func (c *Checker) checkBuiltinVariant(expr *ast.CallExpr, scope *Scope) *Type {
 		// Check argument type matches T (first type param)
 		argType := c.checkExpression(expr.Args[0], scope)
 		if argType != nil && len(expectedType.TypeParams) >= 1 {
-			if !argType.Equal(expectedType.TypeParams[0]) {
+			if !c.assignable(expr.Args[0], argType, expectedType.TypeParams[0]) {
 				c.diag.Errorf(line, col, "Ok() argument type mismatch: expected %s, got %s",
 					expectedType.TypeParams[0].String(), argType.String())
 			}
@@ -1350,7 +1566,7 @@ func (c *Checker) checkBuiltinVariant(expr *ast.CallExpr, scope *Scope) *Type {
 		// Check argument type matches E (second type param)
 		argType := c.checkExpression(expr.Args[0], scope)
 		if argType != nil && len(expectedType.TypeParams) >= 2 {
-			if !argType.Equal(expectedType.TypeParams[1]) {
+			if !c.assignable(expr.Args[0], argType, expectedType.TypeParams[1]) {
 				c.diag.Errorf(line, col, "Err() argument type mismatch: expected %s, got %s",
 					expectedType.TypeParams[1].String(), argType.String())
 			}
@@ -1370,7 +1586,7 @@ func (c *Checker) checkBuiltinVariant(expr *ast.CallExpr, scope *Scope) *Type {
 		// Check argument type matches T (first type param)
 		argType := c.checkExpression(expr.Args[0], scope)
 		if argType != nil && len(expectedType.TypeParams) >= 1 {
-			if !argType.Equal(expectedType.TypeParams[0]) {
+			if !c.assignable(expr.Args[0], argType, expectedType.TypeParams[0]) {
 				c.diag.Errorf(line, col, "Some() argument type mismatch: expected %s, got %s",
 					expectedType.TypeParams[0].String(), argType.String())
 			}
@@ -1415,10 +1631,11 @@ func (c *Checker) checkMethodCallExpr(expr *ast.MethodCallExpr, scope *Scope) *T
 					c.diag.Errorf(line, col, "cannot call push() on immutable array '%s'", ident.Name)
 				}
 			}
+			c.checkFieldWrite(expr.Object, "call push() on")
 			// Check element type matches
 			argType := c.checkExpression(expr.Args[0], scope)
 			if argType != nil && len(objType.TypeParams) == 1 {
-				if !argType.Equal(objType.TypeParams[0]) {
+				if !c.assignable(expr.Args[0], argType, objType.TypeParams[0]) {
 					c.diag.Errorf(line, col, "push() argument type mismatch: expected %s, got %s",
 						objType.TypeParams[0].String(), argType.String())
 				}
@@ -1430,6 +1647,10 @@ func (c *Checker) checkMethodCallExpr(expr *ast.MethodCallExpr, scope *Scope) *T
 		}
 	}
 
+	if IsMap(objType) {
+		return c.checkMapMethod(expr, objType, scope)
+	}
+
 	// Handle Result predicate methods
 	if objType.IsEnum && objType.Name == "Result" {
 		switch expr.Method {
@@ -1452,15 +1673,21 @@ func (c *Checker) checkMethodCallExpr(expr *ast.MethodCallExpr, scope *Scope) *T
 		}
 	}
 
-	if !objType.IsEntity {
-		c.diag.Errorf(line, col, "cannot call method on non-entity type %s", objType.Name)
-		return nil
-	}
-
 	// Check if method exists
-	method, exists := objType.Entity.Methods[expr.Method]
-	if !exists {
-		c.diag.Errorf(line, col, "entity '%s' has no method '%s'", objType.Name, expr.Method)
+	var method *MethodInfo
+	switch {
+	case objType.IsTrait:
+		if method = objType.Trait.Methods[expr.Method]; method == nil {
+			c.diag.Errorf(line, col, "trait '%s' has no method '%s'", objType.Name, expr.Method)
+			return nil
+		}
+	case objType.IsEntity:
+		if method = objType.Entity.Methods[expr.Method]; method == nil {
+			c.diag.Errorf(line, col, "entity '%s' has no method '%s'", objType.Name, expr.Method)
+			return nil
+		}
+	default:
+		c.diag.Errorf(line, col, "cannot call method on non-entity type %s", objType.Name)
 		return nil
 	}
 
@@ -1473,8 +1700,8 @@ func (c *Checker) checkMethodCallExpr(expr *ast.MethodCallExpr, scope *Scope) *T
 
 	// Check argument types
 	for i, arg := range expr.Args {
-		argType := c.checkExpression(arg, scope)
-		if argType != nil && !argType.Equal(method.Params[i].Type) {
+		argType := c.checkExpected(arg, method.Params[i].Type, scope)
+		if argType != nil && !c.assignable(arg, argType, method.Params[i].Type) {
 			argLine, argCol := arg.Pos()
 			c.diag.Errorf(argLine, argCol, "argument %d to method '%s': expected %s, got %s",
 				i+1, expr.Method, method.Params[i].Type.Name, argType.Name)
@@ -1491,6 +1718,9 @@ func (c *Checker) checkModuleQualifiedCall(expr *ast.MethodCallExpr, modSyms *Mo
 
 	// Check if it's a function call
 	if fn, ok := modSyms.Functions[symbolName]; ok {
+		if len(fn.TypeParams) > 0 {
+			return c.checkGenericCall(expr, moduleName+"."+symbolName, fn, expr.Args, scope)
+		}
 		// Check argument count
 		if len(expr.Args) != len(fn.Params) {
 			c.diag.Errorf(line, col, "function '%s.%s' expects %d arguments, got %d",
@@ -1500,8 +1730,8 @@ func (c *Checker) checkModuleQualifiedCall(expr *ast.MethodCallExpr, modSyms *Mo
 
 		// Check argument types
 		for i, arg := range expr.Args {
-			argType := c.checkExpression(arg, scope)
-			if argType != nil && !argType.Equal(fn.Params[i].Type) {
+			argType := c.checkExpected(arg, fn.Params[i].Type, scope)
+			if argType != nil && !c.assignable(arg, argType, fn.Params[i].Type) {
 				argLine, argCol := arg.Pos()
 				c.diag.Errorf(argLine, argCol, "argument %d to '%s.%s': expected %s, got %s",
 					i+1, moduleName, symbolName, fn.Params[i].Type.Name, argType.Name)
@@ -1513,10 +1743,14 @@ func (c *Checker) checkModuleQualifiedCall(expr *ast.MethodCallExpr, modSyms *Mo
 
 	// Check if it's an entity constructor
 	if entity, ok := modSyms.Entities[symbolName]; ok {
+		if len(entity.TypeParams) > 0 {
+			return c.checkGenericConstructor(expr, moduleName+"."+symbolName, entity, expr.Args, scope)
+		}
 		if !entity.HasConstructor {
 			c.diag.Errorf(line, col, "entity '%s.%s' has no constructor", moduleName, symbolName)
 			return nil
 		}
+		c.checkConstructorArgs(moduleName+"."+symbolName, entity, expr.Args, scope)
 		return &Type{Name: symbolName, IsEntity: true, Entity: entity}
 	}
 
@@ -1569,6 +1803,8 @@ func (c *Checker) checkOldExpr(expr *ast.OldExpr, scope *Scope) *Type {
 	// old() is only valid in ensures clauses and loop invariants
 	if c.contractCtx != CtxEnsures && c.contractCtx != CtxInvariant {
 		c.diag.Errorf(line, col, "'old()' can only be used in ensures clauses and loop invariants")
+	} else if c.inTrait {
+		c.diag.Errorf(line, col, "'old()' cannot be used in trait contracts")
 	}
 
 	return c.checkExpression(expr.Expr, scope)
@@ -1598,6 +1834,9 @@ func (c *Checker) checkIdentifier(expr *ast.Identifier, scope *Scope) *Type {
 
 		// Check if it's a unit variant (enum variant with no fields)
 		if lookup, exists := c.enumVariants[expr.Name]; exists && len(lookup.VariantInfo.Fields) == 0 {
+			if len(lookup.EnumInfo.TypeParams) > 0 {
+				return c.checkGenericVariant(expr, lookup, nil, scope)
+			}
 			return &Type{Name: lookup.EnumInfo.Name, IsEnum: true, EnumInfo: lookup.EnumInfo}
 		}
 		c.diag.Errorf(line, col, "undeclared variable '%s'", expr.Name)
@@ -1617,11 +1856,7 @@ func (c *Checker) checkSelfExpr(expr *ast.SelfExpr, scope *Scope) *Type {
 		return nil
 	}
 
-	return &Type{
-		Name:     c.entityCtx.Entity.Name,
-		IsEntity: true,
-		Entity:   c.entityCtx.Entity,
-	}
+	return EntityType(c.entityCtx.Entity)
 }
 
 // checkResultExpr checks a result expression
@@ -1656,6 +1891,21 @@ func (c *Checker) checkArrayLit(lit *ast.ArrayLit, scope *Scope) *Type {
 		return nil
 	}
 
+	// An array of trait values takes its element type from the annotation
+	if declared := c.letDeclaredType; declared != nil && declared.Name == "Array" && len(declared.TypeParams) == 1 && declared.TypeParams[0].IsTrait {
+		c.letDeclaredType = nil
+		for _, elem := range lit.Elements {
+			elemType := c.checkExpression(elem, scope)
+			if elemType != nil && !c.assignable(elem, elemType, declared.TypeParams[0]) {
+				elemLine, elemCol := elem.Pos()
+				c.diag.Errorf(elemLine, elemCol,
+					"array element type mismatch: expected %s, got %s", declared.TypeParams[0].String(), elemType.String())
+			}
+		}
+		c.letDeclaredType = declared
+		return declared
+	}
+
 	// Infer element type from first element
 	firstType := c.checkExpression(lit.Elements[0], scope)
 	if firstType == nil {
@@ -1739,30 +1989,16 @@ func (c *Checker) checkForallExpr(expr *ast.ForallExpr, scope *Scope) *Type {
 		return TypeBool
 	}
 
-	// Validate domain is bounded range (RangeExpr)
-	if expr.Domain == nil {
-		c.diag.Errorf(line, col,
-			"forall requires bounded range domain")
+	varType := c.checkQuantifierDomain("forall", expr.Domain, expr.Map, line, col, scope)
+	if varType == nil {
 		return TypeBool
 	}
 
-	// Check range bounds are Int
-	startType := c.checkExpression(expr.Domain.Start, scope)
-	endType := c.checkExpression(expr.Domain.End, scope)
-	if startType != nil && !startType.Equal(TypeInt) {
-		c.diag.Errorf(line, col,
-			"quantifier range start must be Int, got %s", startType.String())
-	}
-	if endType != nil && !endType.Equal(TypeInt) {
-		c.diag.Errorf(line, col,
-			"quantifier range end must be Int, got %s", endType.String())
-	}
-
 	// Create scope with bound variable
 	quantScope := NewScope(scope)
 	quantScope.Define(expr.Variable, &Symbol{
 		Name:    expr.Variable,
-		Type:    TypeInt,
+		Type:    varType,
 		Mutable: false,
 		Kind:    SymVariable,
 	})
@@ -1777,27 +2013,32 @@ func (c *Checker) checkForallExpr(expr *ast.ForallExpr, scope *Scope) *Type {
 	return TypeBool
 }
 
-// checkExistsExpr checks an exists quantifier expression
-func (c *Checker) checkExistsExpr(expr *ast.ExistsExpr, scope *Scope) *Type {
-	line, col := expr.Pos()
-
-	// Quantifiers only valid in contract contexts
-	if c.contractCtx == CtxNormal {
-		c.diag.Errorf(line, col,
-			"exists quantifier only allowed in contract expressions (requires, ensures, invariant)")
-		return TypeBool
+// checkQuantifierDomain checks the domain of a quantifier, a bounded range
+// or the keys of a map, and returns the type of the bound variable
+func (c *Checker) checkQuantifierDomain(kind string, domain *ast.RangeExpr, mapExpr ast.Expression, line, col int, scope *Scope) *Type {
+	if mapExpr != nil {
+		mapType := c.checkExpression(mapExpr, scope)
+		if mapType == nil {
+			return nil
+		}
+		if !IsMap(mapType) {
+			c.diag.Errorf(line, col,
+				"%s requires bounded range domain or a Map, got %s", kind, mapType.String())
+			return nil
+		}
+		return mapType.TypeParams[0]
 	}
 
 	// Validate domain is bounded range (RangeExpr)
-	if expr.Domain == nil {
+	if domain == nil {
 		c.diag.Errorf(line, col,
-			"exists requires bounded range domain")
-		return TypeBool
+			"%s requires bounded range domain", kind)
+		return nil
 	}
 
 	// Check range bounds are Int
-	startType := c.checkExpression(expr.Domain.Start, scope)
-	endType := c.checkExpression(expr.Domain.End, scope)
+	startType := c.checkExpression(domain.Start, scope)
+	endType := c.checkExpression(domain.End, scope)
 	if startType != nil && !startType.Equal(TypeInt) {
 		c.diag.Errorf(line, col,
 			"quantifier range start must be Int, got %s", startType.String())
@@ -1806,12 +2047,30 @@ func (c *Checker) checkExistsExpr(expr *ast.ExistsExpr, scope *Scope) *Type {
 		c.diag.Errorf(line, col,
 			"quantifier range end must be Int, got %s", endType.String())
 	}
+	return TypeInt
+}
+
+// checkExistsExpr checks an exists quantifier expression
+func (c *Checker) checkExistsExpr(expr *ast.ExistsExpr, scope *Scope) *Type {
+	line, col := expr.Pos()
+
+	// Quantifiers only valid in contract contexts
+	if c.contractCtx == CtxNormal {
+		c.diag.Errorf(line, col,
+			"exists quantifier only allowed in contract expressions (requires, ensures, invariant)")
+		return TypeBool
+	}
+
+	varType := c.checkQuantifierDomain("exists", expr.Domain, expr.Map, line, col, scope)
+	if varType == nil {
+		return TypeBool
+	}
 
 	// Create scope with bound variable
 	quantScope := NewScope(scope)
 	quantScope.Define(expr.Variable, &Symbol{
 		Name:    expr.Variable,
-		Type:    TypeInt,
+		Type:    varType,
 		Mutable: false,
 		Kind:    SymVariable,
 	})
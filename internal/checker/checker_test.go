@@ -2744,3 +2744,489 @@ entry function main() returns Int {
 		t.Errorf("Expected no errors for single-file program, got:\n%s", diag.Format("test"))
 	}
 }
+
+const genericSource = `module test version "1.0.0";
+
+function max<T: Ord>(a: T, b: T) returns T
+    ensures result >= a and result >= b
+{
+    if a > b {
+        return a;
+    }
+    return b;
+}
+
+function first<T>(xs: Array<T>) returns Option<T> {
+    if len(xs) == 0 {
+        return None;
+    }
+    return Some(xs[0]);
+}
+
+entity Stack<T> {
+    field items: Array<T>;
+
+    constructor(x: T) {
+        self.items = [x];
+    }
+
+    method push(x: T) returns Void {
+        self.items.push(x);
+    }
+
+    method top() returns T {
+        return self.items[len(self.items) - 1];
+    }
+}
+
+enum Tree<T> {
+    Leaf(value: T),
+    Empty,
+}
+
+entry function main() returns Int {
+    let a: Int = max(3, 4);
+    let b: String = max("a", "b");
+    let c: Option<Float> = first([1.5, 2.5]);
+    let mutable s: Stack<Int> = Stack(1);
+    s.push(a);
+    let d: Int = s.top();
+    let e: Tree<String> = Leaf(b);
+    let f: Tree<Int> = Empty;
+    return d;
+}
+`
+
+func TestGenerics(t *testing.T) {
+	diag := parseAndCheck(t, genericSource)
+	if diag.HasErrors() {
+		t.Errorf("Expected no errors, got:\n%s", diag.Format("test"))
+	}
+}
+
+func TestGenericTypeArgsRecorded(t *testing.T) {
+	p := parser.New(genericSource)
+	prog := p.Parse()
+	result := CheckWithResult(prog)
+	if result.Diagnostics.HasErrors() {
+		t.Fatalf("Expected no errors, got:\n%s", result.Diagnostics.Format("test"))
+	}
+	var got []string
+	for _, args := range result.TypeArgs {
+		got = append(got, args[0].String())
+	}
+	want := map[string]bool{"Int": true, "String": true, "Float": true}
+	if len(got) != 3 {
+		t.Fatalf("Expected type args for 3 generic calls, got %v", got)
+	}
+	for _, g := range got {
+		if !want[g] {
+			t.Errorf("Unexpected type arg %s", g)
+		}
+	}
+}
+
+func TestGenericErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"bound", `function max<T: Ord>(a: T, b: T) returns T { return a; }
+entry function main() returns Int {
+    let x: Bool = max(true, false);
+    return 0;
+}`, "type Bool does not satisfy bound Ord of type parameter 'T' of function 'max'"},
+		{"mismatch", `function max<T: Ord>(a: T, b: T) returns T { return a; }
+entry function main() returns Int {
+    let x: Int = max(1, "b");
+    return 0;
+}`, "argument 2 to 'max': expected Int, got String"},
+		{"infer", `function make<T>() returns Array<T> { return []; }
+entry function main() returns Int {
+    print(len(make()));
+    return 0;
+}`, "cannot infer type parameter 'T' of function 'make'"},
+		{"unbounded comparison", `function less<T>(a: T, b: T) returns Bool { return a < b; }
+entry function main() returns Int { return 0; }`, "operator 'LT' not defined for T and T"},
+		{"duplicate", `function f<T, T>(a: T) returns T { return a; }
+entry function main() returns Int { return 0; }`, "duplicate type parameter 'T'"},
+		{"unknown bound", `function f<T: Hash>(a: T) returns T { return a; }
+entry function main() returns Int { return 0; }`, "unknown bound 'Hash' on type parameter 'T' (expected Eq or Ord)"},
+		{"missing type args", `entity Box<T> {
+    field v: T;
+}
+function f(b: Box) returns Int { return 0; }
+entry function main() returns Int { return 0; }`, "unknown type 'Box'"},
+		{"annotation bound", `entity Sorted<T: Ord> {
+    field items: Array<T>;
+}
+function f(s: Sorted<Bool>) returns Int { return 0; }
+entry function main() returns Int { return 0; }`, "type Bool does not satisfy bound Ord of type parameter 'T' of 'Sorted'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diag := parseAndCheck(t, "module test version \"1.0.0\";\n\n"+tt.body)
+			if got := diag.Format("test"); !strings.Contains(got, tt.want) {
+				t.Errorf("Expected %q, got:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+const traitSource = `module test version "1.0.0";
+
+trait Shape {
+    method area() returns Int
+        ensures result >= 0;
+
+    method scale(k: Int) returns Void
+        requires k > 0;
+}
+
+entity Square implements Shape {
+    field side: Int;
+
+    constructor(side: Int) {
+        self.side = side;
+    }
+
+    method area() returns Int {
+        return self.side * self.side;
+    }
+
+    method scale(k: Int) returns Void {
+        self.side = self.side * k;
+    }
+}
+
+function total(shapes: Array<Shape>) returns Int {
+    let mutable sum: Int = 0;
+    for s in shapes {
+        sum = sum + s.area();
+    }
+    return sum;
+}
+
+function pick(s: Square) returns Shape {
+    return s;
+}
+
+entry function main() returns Int {
+    let sq: Square = Square(2);
+    let shapes: Array<Shape> = [sq, Square(3)];
+    let mutable s: Shape = pick(sq);
+    s.scale(2);
+    return total(shapes) + total([sq]) + s.area();
+}
+`
+
+func TestTraits(t *testing.T) {
+	diag := parseAndCheck(t, traitSource)
+	if diag.HasErrors() {
+		t.Errorf("Expected no errors, got:\n%s", diag.Format("test"))
+	}
+}
+
+func TestTraitUpcastsRecorded(t *testing.T) {
+	p := parser.New(traitSource)
+	prog := p.Parse()
+	result := CheckWithResult(prog)
+	if result.Diagnostics.HasErrors() {
+		t.Fatalf("Expected no errors, got:\n%s", result.Diagnostics.Format("test"))
+	}
+	// The elements of both array literals and the return in pick
+	if len(result.Upcasts) != 4 {
+		t.Fatalf("Expected 4 upcasts, got %d", len(result.Upcasts))
+	}
+	for _, target := range result.Upcasts {
+		if !target.IsTrait || target.Name != "Shape" {
+			t.Errorf("Expected upcasts to Shape, got %s", target.String())
+		}
+	}
+	if _, ok := result.Traits["Shape"]; !ok {
+		t.Error("Expected trait Shape in the result")
+	}
+}
+
+func TestTraitErrors(t *testing.T) {
+	const shape = `trait Shape {
+    method area() returns Int;
+}
+`
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"unknown trait", `entity E implements Drawable {
+    field x: Int;
+}
+entry function main() returns Int { return 0; }`, "unknown trait 'Drawable'"},
+		{"missing method", shape + `entity E implements Shape {
+    field x: Int;
+}
+entry function main() returns Int { return 0; }`, "entity 'E' does not implement method 'area' of trait 'Shape'"},
+		{"signature mismatch", shape + `entity E implements Shape {
+    field x: Int;
+    method area() returns Float { return 1.0; }
+}
+entry function main() returns Int { return 0; }`, "method 'area' of entity 'E' does not match trait 'Shape': expected () returns Int, got () returns Float"},
+		{"twice", shape + `entity E implements Shape, Shape {
+    field x: Int;
+    method area() returns Int { return 1; }
+}
+entry function main() returns Int { return 0; }`, "entity 'E' implements trait 'Shape' more than once"},
+		{"not implemented", shape + `entity E {
+    field x: Int;
+    constructor() { self.x = 0; }
+    method area() returns Int { return 1; }
+}
+entry function main() returns Int {
+    let s: Shape = E();
+    return 0;
+}`, "type mismatch: cannot assign E to Shape"},
+		{"unknown method", shape + `function f(s: Shape) returns Int { return s.perimeter(); }
+entry function main() returns Int { return 0; }`, "trait 'Shape' has no method 'perimeter'"},
+		{"duplicate method", `trait Shape {
+    method area() returns Int;
+    method area() returns Int;
+}
+entry function main() returns Int { return 0; }`, "duplicate method 'area' in trait 'Shape'"},
+		{"conflict", `entity Shape {
+    field x: Int;
+}
+trait Shape {
+    method area() returns Int;
+}
+entry function main() returns Int { return 0; }`, "entity 'Shape' conflicts with existing trait"},
+		{"old in contract", `trait Counter {
+    method next(n: Int) returns Int
+        ensures result > old(n);
+}
+entry function main() returns Int { return 0; }`, "'old()' cannot be used in trait contracts"},
+		{"self in contract", `trait Counter {
+    method next() returns Int
+        ensures result > self.n;
+}
+entry function main() returns Int { return 0; }`, "'self'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diag := parseAndCheck(t, "module test version \"1.0.0\";\n\n"+tt.body)
+			if got := diag.Format("test"); !strings.Contains(got, tt.want) {
+				t.Errorf("Expected %q, got:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestTraitContractsLeftToVerifier checks that an implementation whose
+// contracts do not refine the trait's still type checks: the verifier's
+// subtype obligations reject it, not the checker.
+func TestTraitContractsLeftToVerifier(t *testing.T) {
+	const src = `module test version "1.0.0";
+
+trait Gauge {
+    method read(f: Int) returns Int
+        requires f > 0
+        ensures result > 0;
+}
+
+entity Strict implements Gauge {
+    method read(f: Int) returns Int
+        requires f > 10
+        ensures result >= 0
+    {
+        return f - 10;
+    }
+}
+
+entry function main() returns Int { return 0; }
+`
+	diag := parseAndCheck(t, src)
+	if diag.HasErrors() {
+		t.Errorf("Expected no errors, got:\n%s", diag.Format("test"))
+	}
+}
+
+const mapSource = `
+module test version "1.0.0";
+
+entity Registry {
+    field retries: Map<String, Int>;
+
+    invariant forall k in self.retries: self.retries.get(k).is_some();
+
+    constructor() {
+        self.retries = Map();
+    }
+
+    method bump(name: String) returns Void
+        ensures self.retries.contains(name)
+    {
+        let current: Option<Int> = self.retries.get(name);
+        let n: Int = match current {
+            Some(v) => v + 1,
+            None => 1
+        };
+        self.retries.set(name, n);
+    }
+}
+
+function total(m: Map<String, Int>) returns Int
+    requires forall k in m: m.contains(k)
+{
+    let mutable sum: Int = 0;
+    for k, v in m {
+        sum = sum + v;
+    }
+    return sum;
+}
+
+entry function main() returns Int {
+    let mutable m: Map<String, Int> = Map();
+    m.set("b", 2);
+    m.set("a", 1);
+    m.set("c", 3);
+    m.remove("c");
+    print(len(m));
+    for k in m {
+        print(k);
+    }
+    let ks: Array<String> = m.keys();
+    print(ks[0]);
+    print(total(m));
+    print(m.contains("a"));
+    print(m.contains("z"));
+    let r: Registry = Registry();
+    r.bump("x");
+    r.bump("x");
+    print(match r.retries.get("x") { Some(v) => v, None => 0 });
+    let mutable ids: Map<Int, Bool> = Map();
+    ids.set(10, true);
+    ids.set(-3, false);
+    for id, ok in ids {
+        print(id);
+        print(ok);
+    }
+    return 0;
+}
+`
+
+func TestOutsideFieldWrites(t *testing.T) {
+	const entities = `entity Box {
+    field n: Int;
+    field xs: Array<Int>;
+    field tags: Map<String, Int>;
+    constructor() {
+        self.n = 0;
+        self.xs = [];
+        self.tags = Map();
+        self.xs.push(1);
+    }
+}
+entity Shelf {
+    field box: Box;
+    constructor() { self.box = Box(); }
+    method empty() returns Void { self.box.n = 0; }
+}
+`
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"assign", `entry function main() returns Int {
+    let mutable b: Box = Box();
+    b.n = 0 - 1;
+    return 0;
+}`, "cannot assign to field 'n' of Box outside its constructor and methods"},
+		{"index", `entry function main() returns Int {
+    let mutable b: Box = Box();
+    b.xs[0] = 2;
+    return 0;
+}`, "cannot assign to field 'xs' of Box outside its constructor and methods"},
+		{"push", `entry function main() returns Int {
+    let mutable b: Box = Box();
+    b.xs.push(2);
+    return 0;
+}`, "cannot call push() on field 'xs' of Box outside its constructor and methods"},
+		{"map", `entry function main() returns Int {
+    let mutable b: Box = Box();
+    b.tags.set("a", 1);
+    return 0;
+}`, "cannot call set() on field 'tags' of Box outside its constructor and methods"},
+		{"nested", `entry function main() returns Int { return 0; }`,
+			"cannot assign to field 'n' of Box outside its constructor and methods"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diag := parseAndCheck(t, "module test version \"1.0.0\";\n\n"+entities+tt.body)
+			if got := diag.Format("test"); !strings.Contains(got, tt.want) {
+				t.Errorf("Expected %q, got:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMaps(t *testing.T) {
+	diag := parseAndCheck(t, mapSource)
+	if diag.HasErrors() {
+		t.Errorf("Expected no errors, got:\n%s", diag.Format("test"))
+	}
+}
+
+func TestMapErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"uninferred", `entry function main() returns Int {
+    return len(Map());
+}`, "Map() requires explicit Map<K, V> type annotation"},
+		{"key type", `function f(m: Map<Float, Int>) returns Int { return len(m); }
+entry function main() returns Int { return 0; }`, "Map key type must be Int, String or Bool, got Float"},
+		{"key argument", `function f(m: Map<String, Int>) returns Bool { return m.contains(1); }
+entry function main() returns Int { return 0; }`, "contains() argument 1 type mismatch: expected String, got Int"},
+		{"value argument", `entry function main() returns Int {
+    let mutable m: Map<String, Int> = Map();
+    m.set("a", true);
+    return 0;
+}`, "set() argument 2 type mismatch: expected Int, got Bool"},
+		{"immutable", `entry function main() returns Int {
+    let m: Map<String, Int> = Map();
+    m.set("a", 1);
+    return 0;
+}`, "cannot call set() on immutable map 'm'"},
+		{"unknown method", `function f(m: Map<String, Int>) returns Int { return m.size(); }
+entry function main() returns Int { return 0; }`, "Map has no method 'size'"},
+		{"get", `function f(m: Map<String, Int>) returns Int { let n: Int = m.get("a"); return n; }
+entry function main() returns Int { return 0; }`, "type mismatch: cannot assign Option to Int"},
+		{"two variables", `function f(xs: Array<Int>) returns Void {
+    for i, x in xs { print(x); }
+}
+entry function main() returns Int { return 0; }`, "for-in with two variables requires a Map"},
+		{"quantifier domain", `function f(xs: Array<Int>) returns Int
+    requires forall x in xs: x > 0
+{ return 0; }
+entry function main() returns Int { return 0; }`, "forall requires bounded range domain or a Map, got Array<Int>"},
+		{"quantifier key", `function f(m: Map<String, Int>) returns Int
+    requires exists k in m: k > 0
+{ return 0; }
+entry function main() returns Int { return 0; }`, "operator 'GT' not defined for String and Int"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diag := parseAndCheck(t, "module test version \"1.0.0\";\n\n"+tt.body)
+			if got := diag.Format("test"); !strings.Contains(got, tt.want) {
+				t.Errorf("Expected %q, got:\n%s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package checker
+
+import (
+	"fmt"
+
+	"github.com/lhaig/intent/internal/ast"
+)
+
+// Generic functions, entities and enums are checked once, with their type
+// parameters treated as opaque types that only support the operations their
+// bound allows. Each use infers the type arguments from the arguments it is
+// applied to, falling back to the type the context expects, much as Ok, Err
+// and None take their type from a let annotation or the return type.
+
+// checkGenericCall checks a call to a generic function and records the
+// inferred type arguments for the IR's monomorphization pass
+func (c *Checker) checkGenericCall(expr ast.Expression, name string, fn *FuncInfo, args []ast.Expression, scope *Scope) *Type {
+	line, col := expr.Pos()
+	argTypes := c.checkArgs(args, scope)
+	if len(args) != len(fn.Params) {
+		c.diag.Errorf(line, col, "function '%s' expects %d arguments, got %d", name, len(fn.Params), len(args))
+		return nil
+	}
+
+	typeArgs := c.inferTypeArgs(line, col, fmt.Sprintf("function '%s'", name), fn.TypeParams, paramTypes(fn.Params), argTypes, fn.ReturnType)
+	if typeArgs == nil {
+		return nil
+	}
+	subst := substitution(fn.TypeParams, typeArgs)
+	for i, arg := range args {
+		want := Substitute(fn.Params[i].Type, subst)
+		if argTypes[i] != nil && !argTypes[i].Equal(want) {
+			argLine, argCol := arg.Pos()
+			c.diag.Errorf(argLine, argCol, "argument %d to '%s': expected %s, got %s",
+				i+1, name, want.String(), argTypes[i].String())
+		}
+	}
+
+	if c.typeArgs != nil {
+		c.typeArgs[expr] = typeArgs
+	}
+	return Substitute(fn.ReturnType, subst)
+}
+
+// checkGenericConstructor checks the construction of a generic entity and
+// returns the type of the instance, e.g. Stack<Int>
+func (c *Checker) checkGenericConstructor(expr ast.Expression, name string, entity *EntityInfo, args []ast.Expression, scope *Scope) *Type {
+	line, col := expr.Pos()
+	if !entity.HasConstructor {
+		c.diag.Errorf(line, col, "entity '%s' has no constructor", name)
+		return nil
+	}
+	argTypes := c.checkArgs(args, scope)
+	if len(args) != len(entity.ConstructorParams) {
+		c.diag.Errorf(line, col, "constructor of '%s' expects %d arguments, got %d", name, len(entity.ConstructorParams), len(args))
+		return nil
+	}
+
+	typeArgs := c.inferTypeArgs(line, col, fmt.Sprintf("entity '%s'", name), entity.TypeParams, paramTypes(entity.ConstructorParams), argTypes, EntityType(entity))
+	if typeArgs == nil {
+		return nil
+	}
+	inst := instantiateEntity(entity, typeArgs)
+	for i, arg := range args {
+		want := inst.ConstructorParams[i].Type
+		if argTypes[i] != nil && !argTypes[i].Equal(want) {
+			argLine, argCol := arg.Pos()
+			c.diag.Errorf(argLine, argCol, "argument %d to constructor of '%s': expected %s, got %s",
+				i+1, name, want.String(), argTypes[i].String())
+		}
+	}
+	return EntityType(inst)
+}
+
+// checkGenericVariant checks a variant of a generic enum, with or without
+// data, and returns the type of the instance, e.g. Tree<Int>
+func (c *Checker) checkGenericVariant(expr ast.Expression, lookup *EnumVariantLookup, args []ast.Expression, scope *Scope) *Type {
+	line, col := expr.Pos()
+	enum, variant := lookup.EnumInfo, lookup.VariantInfo
+	argTypes := c.checkArgs(args, scope)
+	if len(args) != len(variant.Fields) {
+		c.diag.Errorf(line, col, "variant '%s' expects %d arguments, got %d", variant.Name, len(variant.Fields), len(args))
+		return nil
+	}
+
+	typeArgs := c.inferTypeArgs(line, col, fmt.Sprintf("enum '%s'", enum.Name), enum.TypeParams, paramTypes(variant.Fields), argTypes, EnumType(enum))
+	if typeArgs == nil {
+		return nil
+	}
+	inst := instantiateEnum(enum, typeArgs)
+	fields := c.findEnumVariant(inst, variant.Name).Fields
+	for i, arg := range args {
+		if argTypes[i] != nil && !argTypes[i].Equal(fields[i].Type) {
+			argLine, argCol := arg.Pos()
+			c.diag.Errorf(argLine, argCol, "variant '%s' field '%s' expects %s, got %s",
+				variant.Name, fields[i].Name, fields[i].Type.String(), argTypes[i].String())
+		}
+	}
+	return EnumType(inst)
+}
+
+// checkArgs checks each argument expression and returns their types
+func (c *Checker) checkArgs(args []ast.Expression, scope *Scope) []*Type {
+	types := make([]*Type, len(args))
+	for i, arg := range args {
+		types[i] = c.checkExpression(arg, scope)
+	}
+	return types
+}
+
+// inferTypeArgs infers the arguments for typeParams by matching the declared
+// parameter types against the argument types, then the generic result type
+// against the type the context expects. It reports type parameters that
+// cannot be inferred or whose argument does not satisfy their bound, and
+// returns nil if there are any.
+func (c *Checker) inferTypeArgs(line, col int, what string, typeParams, params, args []*Type, result *Type) []*Type {
+	vars := make(map[string]bool, len(typeParams))
+	for _, p := range typeParams {
+		vars[p.Name] = true
+	}
+	inferred := make(map[string]*Type)
+	for i := range params {
+		if i < len(args) {
+			unify(params[i], args[i], vars, inferred)
+		}
+	}
+	if expected := c.expectedType(); expected != nil {
+		unify(result, expected, vars, inferred)
+	}
+
+	typeArgs := make([]*Type, len(typeParams))
+	ok := true
+	for i, p := range typeParams {
+		arg := inferred[p.Name]
+		switch {
+		case arg == nil:
+			c.diag.Errorf(line, col, "cannot infer type parameter '%s' of %s", p.Name, what)
+			ok = false
+		case !satisfiesBound(arg, p.Bound):
+			c.diag.Errorf(line, col, "type %s does not satisfy bound %s of type parameter '%s' of %s",
+				arg.String(), p.Bound, p.Name, what)
+			ok = false
+		}
+		typeArgs[i] = arg
+	}
+	if !ok {
+		return nil
+	}
+	return typeArgs
+}
+
+// expectedType returns the type the context expects of the expression being
+// checked: the let annotation, or else the enclosing function's return type
+func (c *Checker) expectedType() *Type {
+	if c.letDeclaredType != nil {
+		return c.letDeclaredType
+	}
+	if c.currentFunc != nil {
+		return c.currentFunc.ReturnType
+	}
+	return nil
+}
+
+// unify binds the type parameters named in vars that occur in param to the
+// matching parts of arg. Parameters keep their first binding; conflicts
+// surface later as argument type mismatches.
+func unify(param, arg *Type, vars map[string]bool, inferred map[string]*Type) {
+	if param == nil || arg == nil {
+		return
+	}
+	if param.IsTypeParam && vars[param.Name] {
+		if inferred[param.Name] == nil {
+			inferred[param.Name] = arg
+		}
+		return
+	}
+	if param.IsGeneric && arg.IsGeneric && param.Name == arg.Name && len(param.TypeParams) == len(arg.TypeParams) {
+		for i := range param.TypeParams {
+			unify(param.TypeParams[i], arg.TypeParams[i], vars, inferred)
+		}
+	}
+}
+
+func paramTypes(params []ParamInfo) []*Type {
+	types := make([]*Type, len(params))
+	for i, p := range params {
+		types[i] = p.Type
+	}
+	return types
+}
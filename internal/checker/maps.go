@@ -0,0 +1,100 @@
+package checker
+
+import (
+	"github.com/lhaig/intent/internal/ast"
+)
+
+// Map<K, V> is a built-in type like Array<T>. Keys are Int, String or Bool,
+// which every backend can hash and order, and every backend iterates a map
+// in ascending key order so programs behave the same on each of them. An
+// empty map is created with Map(), which takes its type from the context
+// as [] does. Maps are shared by reference like arrays; set and remove need
+// a mutable binding, as push does, and are not allowed in contracts.
+
+// MapType returns the type Map<key, value>
+func MapType(key, value *Type) *Type {
+	return &Type{Name: "Map", IsGeneric: true, TypeParams: []*Type{key, value}}
+}
+
+// OptionType returns the type Option<t>
+func OptionType(t *Type) *Type {
+	return &Type{Name: "Option", IsEnum: true, IsGeneric: true, TypeParams: []*Type{t}, EnumInfo: instantiateOption(t)}
+}
+
+// IsMap reports whether t is a Map<K, V>
+func IsMap(t *Type) bool {
+	return t != nil && t.Name == "Map" && t.IsGeneric && len(t.TypeParams) == 2
+}
+
+// IsMapKey reports whether values of t can be map keys
+func IsMapKey(t *Type) bool {
+	return t.Equal(TypeInt) || t.Equal(TypeString) || t.Equal(TypeBool)
+}
+
+// checkMapConstructor checks Map(), which creates an empty map of the type
+// the context expects
+func (c *Checker) checkMapConstructor(expr *ast.CallExpr) *Type {
+	line, col := expr.Pos()
+	if len(expr.Args) != 0 {
+		c.diag.Errorf(line, col, "Map() expects 0 arguments, got %d", len(expr.Args))
+		return nil
+	}
+	if expected := c.expectedType(); IsMap(expected) {
+		return expected
+	}
+	c.diag.Errorf(line, col, "Map() requires explicit Map<K, V> type annotation (key and value types cannot be inferred)")
+	return nil
+}
+
+// checkMapMethod checks a call to one of the built-in methods of a map
+func (c *Checker) checkMapMethod(expr *ast.MethodCallExpr, mapType *Type, scope *Scope) *Type {
+	line, col := expr.Pos()
+	key, value := mapType.TypeParams[0], mapType.TypeParams[1]
+
+	var params []*Type
+	var result *Type
+	switch expr.Method {
+	case "get":
+		params, result = []*Type{key}, OptionType(value)
+	case "contains":
+		params, result = []*Type{key}, TypeBool
+	case "set":
+		params, result = []*Type{key, value}, TypeVoid
+	case "remove":
+		params, result = []*Type{key}, TypeVoid
+	case "keys":
+		result = &Type{Name: "Array", IsGeneric: true, TypeParams: []*Type{key}}
+	case "values":
+		result = &Type{Name: "Array", IsGeneric: true, TypeParams: []*Type{value}}
+	default:
+		c.diag.Errorf(line, col, "Map has no method '%s'", expr.Method)
+		return nil
+	}
+
+	if expr.Method == "set" || expr.Method == "remove" {
+		if c.contractCtx != CtxNormal {
+			c.diag.Errorf(line, col, "%s() modifies the map and cannot be used in a contract", expr.Method)
+		}
+		// The object must be a mutable variable
+		if ident, ok := expr.Object.(*ast.Identifier); ok {
+			sym := scope.Resolve(ident.Name)
+			if sym != nil && !sym.Mutable {
+				c.diag.Errorf(line, col, "cannot call %s() on immutable map '%s'", expr.Method, ident.Name)
+			}
+		}
+		c.checkFieldWrite(expr.Object, "call "+expr.Method+"() on")
+	}
+
+	if len(expr.Args) != len(params) {
+		c.diag.Errorf(line, col, "%s() requires exactly %d argument(s), got %d", expr.Method, len(params), len(expr.Args))
+		return result
+	}
+	for i, arg := range expr.Args {
+		argType := c.checkExpected(arg, params[i], scope)
+		if argType != nil && !c.assignable(arg, argType, params[i]) {
+			c.diag.Errorf(line, col, "%s() argument %d type mismatch: expected %s, got %s",
+				expr.Method, i+1, params[i].String(), argType.String())
+		}
+	}
+	return result
+}
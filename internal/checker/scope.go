@@ -13,6 +13,7 @@ const (
 	SymField
 	SymParam
 	SymEnum
+	SymTrait
 )
 
 // String returns the string representation of the symbol kind
@@ -32,6 +33,8 @@ func (sk SymbolKind) String() string {
 		return "parameter"
 	case SymEnum:
 		return "enum"
+	case SymTrait:
+		return "trait"
 	default:
 		return "unknown"
 	}
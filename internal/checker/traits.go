@@ -0,0 +1,213 @@
+package checker
+
+import (
+	"github.com/lhaig/intent/internal/ast"
+)
+
+// A trait lists method signatures, with contracts, that an entity declaring
+// `implements` must provide. Each implementation must take the same
+// parameters and return the same type; whether its contracts refine the
+// trait's (requires no stronger, ensures no weaker) is a proof obligation
+// for the verifier. An entity value is converted to a trait value wherever
+// one is expected, and the checker records those places as upcasts.
+
+// registerTraits registers all traits in the global scope. They are
+// registered before entities, whose methods can take and return them, so
+// registerEntities reports entities named like a trait.
+func (c *Checker) registerTraits() {
+	for _, trait := range c.prog.Traits {
+		line, col := trait.Pos()
+		if _, exists := c.enums[trait.Name]; exists {
+			c.diag.Errorf(line, col, "trait '%s' conflicts with existing enum", trait.Name)
+			continue
+		}
+		if _, exists := c.traits[trait.Name]; exists {
+			c.diag.Errorf(line, col, "trait '%s' already defined", trait.Name)
+			continue
+		}
+
+		info := &TraitInfo{
+			Name:    trait.Name,
+			Methods: make(map[string]*MethodInfo),
+		}
+		for _, method := range trait.Methods {
+			if _, exists := info.Methods[method.Name]; exists {
+				mLine, mCol := method.Pos()
+				c.diag.Errorf(mLine, mCol, "duplicate method '%s' in trait '%s'", method.Name, trait.Name)
+				continue
+			}
+			info.Methods[method.Name] = c.registerMethod(method)
+			info.MethodOrder = append(info.MethodOrder, method.Name)
+		}
+
+		c.traits[trait.Name] = info
+		c.scope.Define(trait.Name, &Symbol{
+			Name: trait.Name,
+			Type: TraitType(info),
+			Kind: SymTrait,
+		})
+	}
+}
+
+// registerMethod resolves the signature of an entity or trait method
+func (c *Checker) registerMethod(method *ast.MethodDecl) *MethodInfo {
+	params := c.registerParams(method.Params)
+
+	returnType := TypeVoid
+	if method.ReturnType != nil {
+		returnType = c.resolveType(method.ReturnType)
+		if returnType == nil {
+			line, col := method.Pos()
+			c.diag.Errorf(line, col, "unknown type '%s'", method.ReturnType.Name)
+			returnType = TypeVoid // fallback
+		}
+	}
+
+	return &MethodInfo{
+		Name:        method.Name,
+		Params:      params,
+		ReturnType:  returnType,
+		HasRequires: len(method.Requires) > 0,
+		HasEnsures:  len(method.Ensures) > 0,
+	}
+}
+
+// checkImplements resolves the traits an entity implements and checks that
+// it provides each of their methods with the same signature. It does not
+// compare contracts: an implementation that requires more or ensures less
+// than the trait method is accepted here and rejected by the verifier's
+// subtype_requires and subtype_ensures obligations.
+func (c *Checker) checkImplements(entity *ast.EntityDecl, info *EntityInfo) {
+	for _, ref := range entity.Implements {
+		trait, ok := c.traits[ref.Name]
+		if !ok || len(ref.TypeArgs) > 0 {
+			c.diag.Errorf(ref.Line, ref.Column, "unknown trait '%s'", ref.Name)
+			continue
+		}
+		if info.Implements(trait.Name) {
+			c.diag.Errorf(ref.Line, ref.Column, "entity '%s' implements trait '%s' more than once", entity.Name, trait.Name)
+			continue
+		}
+		info.Traits = append(info.Traits, trait)
+
+		line, col := entity.Pos()
+		for _, name := range trait.MethodOrder {
+			want := trait.Methods[name]
+			got, exists := info.Methods[name]
+			if !exists {
+				c.diag.Errorf(line, col, "entity '%s' does not implement method '%s' of trait '%s'", entity.Name, name, trait.Name)
+				continue
+			}
+			if !sameSignature(got, want) {
+				c.diag.Errorf(line, col, "method '%s' of entity '%s' does not match trait '%s': expected %s, got %s",
+					name, entity.Name, trait.Name, signature(want), signature(got))
+			}
+		}
+	}
+}
+
+// sameSignature reports whether two methods take parameters of the same
+// names and types and return the same type
+func sameSignature(a, b *MethodInfo) bool {
+	if len(a.Params) != len(b.Params) || !a.ReturnType.Equal(b.ReturnType) {
+		return false
+	}
+	for i := range a.Params {
+		if a.Params[i].Name != b.Params[i].Name || !a.Params[i].Type.Equal(b.Params[i].Type) {
+			return false
+		}
+	}
+	return true
+}
+
+// signature formats a method signature for diagnostics, e.g. (x: Int) returns Bool
+func signature(m *MethodInfo) string {
+	s := "("
+	for i, p := range m.Params {
+		if i > 0 {
+			s += ", "
+		}
+		s += p.Name + ": " + p.Type.String()
+	}
+	return s + ") returns " + m.ReturnType.String()
+}
+
+// checkTraits checks the contracts of every trait method. They can refer to
+// the method's parameters and, in ensures, its result, but not to self or
+// old(): a trait has no fields.
+func (c *Checker) checkTraits() {
+	for _, trait := range c.prog.Traits {
+		info := c.traits[trait.Name]
+		if info == nil {
+			continue
+		}
+		for _, method := range trait.Methods {
+			m := info.Methods[method.Name]
+			if m == nil {
+				continue
+			}
+			methodScope := NewScope(c.scope)
+			for _, p := range m.Params {
+				methodScope.Define(p.Name, &Symbol{
+					Name: p.Name,
+					Type: p.Type,
+					Kind: SymParam,
+				})
+			}
+
+			c.currentFunc = &FuncInfo{Name: method.Name, Params: m.Params, ReturnType: m.ReturnType}
+			c.inTrait = true
+			oldCtx := c.contractCtx
+			c.contractCtx = CtxRequires
+			for _, req := range method.Requires {
+				exprType := c.checkExpression(req.Expr, methodScope)
+				if exprType != nil && !exprType.Equal(TypeBool) {
+					line, col := req.Pos()
+					c.diag.Errorf(line, col, "requires clause must be boolean, got %s", exprType.Name)
+				}
+			}
+			c.contractCtx = CtxEnsures
+			for _, ens := range method.Ensures {
+				exprType := c.checkExpression(ens.Expr, methodScope)
+				if exprType != nil && !exprType.Equal(TypeBool) {
+					line, col := ens.Pos()
+					c.diag.Errorf(line, col, "ensures clause must be boolean, got %s", exprType.Name)
+				}
+			}
+			c.contractCtx = oldCtx
+			c.inTrait = false
+			c.currentFunc = nil
+		}
+	}
+}
+
+// checkExpected checks expr where a value of type want is expected, so an
+// array literal of trait values, or Map(), takes its type from want as it
+// does from a let annotation
+func (c *Checker) checkExpected(expr ast.Expression, want *Type, scope *Scope) *Type {
+	_, isArray := expr.(*ast.ArrayLit)
+	call, isCall := expr.(*ast.CallExpr)
+	if isArray && want != nil && want.Name == "Array" && len(want.TypeParams) == 1 && want.TypeParams[0].IsTrait ||
+		isCall && call.Function == "Map" && IsMap(want) {
+		saved := c.letDeclaredType
+		c.letDeclaredType = want
+		defer func() { c.letDeclaredType = saved }()
+	}
+	return c.checkExpression(expr, scope)
+}
+
+// assignable reports whether a value of type value can be used where target
+// is expected. An entity used where a trait it implements is expected is
+// recorded as an upcast of expr.
+func (c *Checker) assignable(expr ast.Expression, value, target *Type) bool {
+	if value.Equal(target) {
+		return true
+	}
+	if IsUpcast(value, target) {
+		if c.upcasts != nil {
+			c.upcasts[expr] = target
+		}
+		return true
+	}
+	return false
+}
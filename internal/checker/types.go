@@ -8,13 +8,18 @@ import (
 
 // Type represents a type in the Intent type system
 type Type struct {
-	Name       string // "Int", "Float", "String", "Bool", "Void", entity name, or enum name
+	Name       string // "Int", "Float", "String", "Bool", "Void", entity, enum or trait name
 	IsEntity   bool
 	Entity     *EntityInfo // non-nil if IsEntity
 	IsEnum     bool
 	EnumInfo   *EnumInfo // non-nil if IsEnum
-	IsGeneric  bool      // true if TypeParams is non-empty
-	TypeParams []*Type   // e.g., [TypeInt] for Array<Int>
+	IsTrait    bool
+	Trait      *TraitInfo // non-nil if IsTrait
+	IsGeneric  bool       // true if TypeParams is non-empty
+	TypeParams []*Type    // e.g., [TypeInt] for Array<Int>, [TypeString, TypeInt] for Map<String, Int>
+
+	IsTypeParam bool   // a type parameter of a generic declaration, e.g. the T in Stack<T>
+	Bound       string // for type parameters: "Eq", "Ord" or "" when unbounded
 }
 
 // EntityInfo holds information about an entity type
@@ -25,6 +30,35 @@ type EntityInfo struct {
 	HasInvariant   bool
 	Methods        map[string]*MethodInfo
 	HasConstructor bool
+
+	ConstructorParams []ParamInfo
+	Traits            []*TraitInfo // traits the entity implements
+
+	// TypeParams lists the type parameters of a generic entity. Instances
+	// such as Stack<Int> have the parameters substituted in their fields
+	// and methods, and record the entity they came from and its arguments.
+	TypeParams []*Type
+	Generic    *EntityInfo
+	TypeArgs   []*Type
+	instances  map[string]*EntityInfo
+}
+
+// TraitInfo holds information about a trait: the methods an implementing
+// entity must provide, in declaration order
+type TraitInfo struct {
+	Name        string
+	Methods     map[string]*MethodInfo
+	MethodOrder []string
+}
+
+// Implements reports whether entities of info implement the trait named name
+func (info *EntityInfo) Implements(name string) bool {
+	for _, t := range info.Traits {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 // MethodInfo holds information about a method
@@ -46,6 +80,13 @@ type ParamInfo struct {
 type EnumInfo struct {
 	Name     string
 	Variants []*EnumVariantInfo
+
+	// TypeParams, Generic and TypeArgs describe generic enums and their
+	// instances as they do for EntityInfo.
+	TypeParams []*Type
+	Generic    *EnumInfo
+	TypeArgs   []*Type
+	instances  map[string]*EnumInfo
 }
 
 // EnumVariantInfo holds information about an enum variant
@@ -63,11 +104,51 @@ var (
 	TypeVoid   = &Type{Name: "Void"}
 )
 
+// Type parameter bounds
+const (
+	BoundEq  = "Eq"  // values can be compared with == and !=
+	BoundOrd = "Ord" // values can also be ordered with <, >, <= and >=
+)
+
+// TypeParamScope returns the types of the type parameters declared by a
+// generic function, entity or enum, by name.
+func TypeParamScope(params []*ast.TypeParam) map[string]*Type {
+	if len(params) == 0 {
+		return nil
+	}
+	scope := make(map[string]*Type, len(params))
+	for _, p := range params {
+		scope[p.Name] = &Type{Name: p.Name, IsTypeParam: true, Bound: p.Bound}
+	}
+	return scope
+}
+
 // ResolveType resolves a type reference to a Type object
 func ResolveType(ref *ast.TypeRef, entities map[string]*EntityInfo, enums map[string]*EnumInfo) *Type {
+	return ResolveTypeIn(ref, entities, enums, nil, nil)
+}
+
+// TraitType returns the type of values of a trait: any entity implementing it
+func TraitType(info *TraitInfo) *Type {
+	return &Type{Name: info.Name, IsTrait: true, Trait: info}
+}
+
+// IsUpcast reports whether value is an entity type that implements the trait
+// type target, so that using it as target converts it to a trait value.
+func IsUpcast(value, target *Type) bool {
+	return value != nil && target != nil && target.IsTrait &&
+		value.IsEntity && value.Entity != nil && value.Entity.Implements(target.Name)
+}
+
+// ResolveTypeIn resolves a type reference inside a generic declaration,
+// where the names in typeParams refer to its type parameters.
+func ResolveTypeIn(ref *ast.TypeRef, entities map[string]*EntityInfo, enums map[string]*EnumInfo, traits map[string]*TraitInfo, typeParams map[string]*Type) *Type {
 	if ref == nil {
 		return nil
 	}
+	if t, ok := typeParams[ref.Name]; ok && len(ref.TypeArgs) == 0 {
+		return t
+	}
 	switch ref.Name {
 	case "Int":
 		return TypeInt
@@ -84,7 +165,7 @@ func ResolveType(ref *ast.TypeRef, entities map[string]*EntityInfo, enums map[st
 		if len(ref.TypeArgs) != 1 {
 			return nil // caller should emit error
 		}
-		elemType := ResolveType(ref.TypeArgs[0], entities, enums)
+		elemType := ResolveTypeIn(ref.TypeArgs[0], entities, enums, traits, typeParams)
 		if elemType == nil {
 			return nil
 		}
@@ -93,13 +174,24 @@ func ResolveType(ref *ast.TypeRef, entities map[string]*EntityInfo, enums map[st
 			IsGeneric:  true,
 			TypeParams: []*Type{elemType},
 		}
+	case "Map":
+		// Map requires exactly 2 type arguments (K, V)
+		if len(ref.TypeArgs) != 2 {
+			return nil // caller should emit error
+		}
+		keyType := ResolveTypeIn(ref.TypeArgs[0], entities, enums, traits, typeParams)
+		valueType := ResolveTypeIn(ref.TypeArgs[1], entities, enums, traits, typeParams)
+		if keyType == nil || valueType == nil {
+			return nil
+		}
+		return MapType(keyType, valueType)
 	case "Result":
 		// Result requires exactly 2 type arguments (T, E)
 		if len(ref.TypeArgs) != 2 {
 			return nil // caller should emit error
 		}
-		okType := ResolveType(ref.TypeArgs[0], entities, enums)
-		errType := ResolveType(ref.TypeArgs[1], entities, enums)
+		okType := ResolveTypeIn(ref.TypeArgs[0], entities, enums, traits, typeParams)
+		errType := ResolveTypeIn(ref.TypeArgs[1], entities, enums, traits, typeParams)
 		if okType == nil || errType == nil {
 			return nil
 		}
@@ -115,7 +207,7 @@ func ResolveType(ref *ast.TypeRef, entities map[string]*EntityInfo, enums map[st
 		if len(ref.TypeArgs) != 1 {
 			return nil // caller should emit error
 		}
-		someType := ResolveType(ref.TypeArgs[0], entities, enums)
+		someType := ResolveTypeIn(ref.TypeArgs[0], entities, enums, traits, typeParams)
 		if someType == nil {
 			return nil
 		}
@@ -129,6 +221,13 @@ func ResolveType(ref *ast.TypeRef, entities map[string]*EntityInfo, enums map[st
 	default:
 		// Check if it's an entity type
 		if entity, ok := entities[ref.Name]; ok {
+			if len(entity.TypeParams) > 0 {
+				args := resolveTypeArgs(ref, len(entity.TypeParams), entities, enums, traits, typeParams)
+				if args == nil {
+					return nil
+				}
+				return EntityType(instantiateEntity(entity, args))
+			}
 			return &Type{
 				Name:     ref.Name,
 				IsEntity: true,
@@ -137,16 +236,222 @@ func ResolveType(ref *ast.TypeRef, entities map[string]*EntityInfo, enums map[st
 		}
 		// Check if it's an enum type
 		if enumInfo, ok := enums[ref.Name]; ok {
+			if len(enumInfo.TypeParams) > 0 {
+				args := resolveTypeArgs(ref, len(enumInfo.TypeParams), entities, enums, traits, typeParams)
+				if args == nil {
+					return nil
+				}
+				return EnumType(instantiateEnum(enumInfo, args))
+			}
 			return &Type{
 				Name:     ref.Name,
 				IsEnum:   true,
 				EnumInfo: enumInfo,
 			}
 		}
+		// Check if it's a trait type
+		if trait, ok := traits[ref.Name]; ok && len(ref.TypeArgs) == 0 {
+			return TraitType(trait)
+		}
 		return nil // Unknown type
 	}
 }
 
+// resolveTypeArgs resolves the type arguments of a reference to a generic
+// entity or enum, or returns nil unless there are exactly n of them.
+func resolveTypeArgs(ref *ast.TypeRef, n int, entities map[string]*EntityInfo, enums map[string]*EnumInfo, traits map[string]*TraitInfo, typeParams map[string]*Type) []*Type {
+	if len(ref.TypeArgs) != n {
+		return nil
+	}
+	args := make([]*Type, n)
+	for i, arg := range ref.TypeArgs {
+		if args[i] = ResolveTypeIn(arg, entities, enums, traits, typeParams); args[i] == nil {
+			return nil
+		}
+	}
+	return args
+}
+
+// EntityType returns the type of values of an entity: Stack<T> for the
+// generic entity itself and Stack<Int> for an instance.
+func EntityType(info *EntityInfo) *Type {
+	t := &Type{Name: info.Name, IsEntity: true, Entity: info}
+	if info.Generic != nil {
+		t.TypeParams = info.TypeArgs
+	} else {
+		t.TypeParams = info.TypeParams
+	}
+	t.IsGeneric = len(t.TypeParams) > 0
+	return t
+}
+
+// EnumType returns the type of values of an enum, as EntityType does.
+func EnumType(info *EnumInfo) *Type {
+	t := &Type{Name: info.Name, IsEnum: true, EnumInfo: info}
+	if info.Generic != nil {
+		t.TypeParams = info.TypeArgs
+	} else {
+		t.TypeParams = info.TypeParams
+	}
+	t.IsGeneric = len(t.TypeParams) > 0
+	return t
+}
+
+// Substitute replaces the type parameters named in subst throughout t.
+func Substitute(t *Type, subst map[string]*Type) *Type {
+	if t == nil || len(subst) == 0 {
+		return t
+	}
+	if t.IsTypeParam {
+		if s, ok := subst[t.Name]; ok {
+			return s
+		}
+		return t
+	}
+	if !t.IsGeneric {
+		return t
+	}
+	args := make([]*Type, len(t.TypeParams))
+	for i, p := range t.TypeParams {
+		args[i] = Substitute(p, subst)
+	}
+	switch {
+	case t.IsEntity && t.Entity != nil:
+		return EntityType(instantiateEntity(genericEntity(t.Entity), args))
+	case t.IsEnum && t.Name == "Result" && len(args) == 2:
+		return &Type{Name: "Result", IsEnum: true, IsGeneric: true, TypeParams: args, EnumInfo: instantiateResult(args[0], args[1])}
+	case t.IsEnum && t.Name == "Option" && len(args) == 1:
+		return &Type{Name: "Option", IsEnum: true, IsGeneric: true, TypeParams: args, EnumInfo: instantiateOption(args[0])}
+	case t.IsEnum && t.EnumInfo != nil:
+		return EnumType(instantiateEnum(genericEnum(t.EnumInfo), args))
+	}
+	return &Type{Name: t.Name, IsGeneric: true, TypeParams: args}
+}
+
+// substitution maps the type parameters of a generic declaration to args.
+func substitution(params, args []*Type) map[string]*Type {
+	subst := make(map[string]*Type, len(params))
+	for i, p := range params {
+		if i < len(args) {
+			subst[p.Name] = args[i]
+		}
+	}
+	return subst
+}
+
+func substituteParams(params []ParamInfo, subst map[string]*Type) []ParamInfo {
+	out := make([]ParamInfo, len(params))
+	for i, p := range params {
+		out[i] = ParamInfo{Name: p.Name, Type: Substitute(p.Type, subst)}
+	}
+	return out
+}
+
+// typeArgsKey names a list of type arguments, e.g. "Int, Array<String>".
+func typeArgsKey(args []*Type) string {
+	names := make([]string, len(args))
+	for i, a := range args {
+		names[i] = a.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+func genericEntity(info *EntityInfo) *EntityInfo {
+	if info.Generic != nil {
+		return info.Generic
+	}
+	return info
+}
+
+func genericEnum(info *EnumInfo) *EnumInfo {
+	if info.Generic != nil {
+		return info.Generic
+	}
+	return info
+}
+
+// instantiateEntity returns the instance of a generic entity for args.
+// Instances are cached, so each set of arguments has a single EntityInfo.
+func instantiateEntity(info *EntityInfo, args []*Type) *EntityInfo {
+	if typeArgsKey(args) == typeArgsKey(info.TypeParams) {
+		return info
+	}
+	key := typeArgsKey(args)
+	if inst, ok := info.instances[key]; ok {
+		return inst
+	}
+	subst := substitution(info.TypeParams, args)
+	inst := &EntityInfo{
+		Name:              info.Name,
+		Fields:            make(map[string]*Type, len(info.Fields)),
+		FieldOrder:        info.FieldOrder,
+		HasInvariant:      info.HasInvariant,
+		Methods:           make(map[string]*MethodInfo, len(info.Methods)),
+		HasConstructor:    info.HasConstructor,
+		ConstructorParams: substituteParams(info.ConstructorParams, subst),
+		Traits:            info.Traits,
+		Generic:           info,
+		TypeArgs:          args,
+	}
+	if info.instances == nil {
+		info.instances = make(map[string]*EntityInfo)
+	}
+	info.instances[key] = inst
+	for name, t := range info.Fields {
+		inst.Fields[name] = Substitute(t, subst)
+	}
+	for name, m := range info.Methods {
+		inst.Methods[name] = &MethodInfo{
+			Name:        m.Name,
+			Params:      substituteParams(m.Params, subst),
+			ReturnType:  Substitute(m.ReturnType, subst),
+			HasRequires: m.HasRequires,
+			HasEnsures:  m.HasEnsures,
+		}
+	}
+	return inst
+}
+
+// instantiateEnum returns the instance of a generic enum for args.
+func instantiateEnum(info *EnumInfo, args []*Type) *EnumInfo {
+	if typeArgsKey(args) == typeArgsKey(info.TypeParams) {
+		return info
+	}
+	key := typeArgsKey(args)
+	if inst, ok := info.instances[key]; ok {
+		return inst
+	}
+	subst := substitution(info.TypeParams, args)
+	inst := &EnumInfo{Name: info.Name, Generic: info, TypeArgs: args}
+	if info.instances == nil {
+		info.instances = make(map[string]*EnumInfo)
+	}
+	info.instances[key] = inst
+	for _, v := range info.Variants {
+		inst.Variants = append(inst.Variants, &EnumVariantInfo{
+			Name:   v.Name,
+			Fields: substituteParams(v.Fields, subst),
+		})
+	}
+	return inst
+}
+
+// satisfiesBound reports whether values of t support the operations bound
+// promises. Type parameters satisfy the bound they were declared with, and
+// Ord implies Eq.
+func satisfiesBound(t *Type, bound string) bool {
+	if t.IsTypeParam {
+		return bound == "" || t.Bound == bound || t.Bound == BoundOrd
+	}
+	switch bound {
+	case BoundEq:
+		return t.Equal(TypeInt) || t.Equal(TypeFloat) || t.Equal(TypeString) || t.Equal(TypeBool)
+	case BoundOrd:
+		return t.Equal(TypeInt) || t.Equal(TypeFloat) || t.Equal(TypeString)
+	}
+	return true
+}
+
 // Equal checks if two types are equal
 func (t *Type) Equal(other *Type) bool {
 	if t == nil || other == nil {
@@ -1215,6 +1215,8 @@ func (g *generator) collectOldExprs(e ast.Expression) {
 		if expr.Domain != nil {
 			g.collectOldExprs(expr.Domain.Start)
 			g.collectOldExprs(expr.Domain.End)
+		} else {
+			g.collectOldExprs(expr.Map)
 		}
 		g.collectOldExprs(expr.Body)
 	case *ast.ExistsExpr:
@@ -1222,6 +1224,8 @@ func (g *generator) collectOldExprs(e ast.Expression) {
 		if expr.Domain != nil {
 			g.collectOldExprs(expr.Domain.Start)
 			g.collectOldExprs(expr.Domain.End)
+		} else {
+			g.collectOldExprs(expr.Map)
 		}
 		g.collectOldExprs(expr.Body)
 	case *ast.IndexExpr:
@@ -1439,38 +1443,45 @@ func (g *generator) defaultValue(t *ast.TypeRef) string {
 
 // generateForallExpr generates a runtime loop for forall quantifier
 func (g *generator) generateForallExpr(expr *ast.ForallExpr) string {
-	rangeStart := g.generateExpr(expr.Domain.Start)
-	rangeEnd := g.generateExpr(expr.Domain.End)
+	domain := g.generateQuantifierDomain(expr.Domain, expr.Map)
 	body := g.generateExpr(expr.Body)
 
 	return fmt.Sprintf("{\n"+
 		"    let mut __forall_holds = true;\n"+
-		"    for %s in (%s..%s) {\n"+
+		"    for %s in %s {\n"+
 		"        if !(%s) {\n"+
 		"            __forall_holds = false;\n"+
 		"            break;\n"+
 		"        }\n"+
 		"    }\n"+
 		"    __forall_holds\n"+
-		"}", expr.Variable, rangeStart, rangeEnd, body)
+		"}", expr.Variable, domain, body)
 }
 
 // generateExistsExpr generates a runtime loop for exists quantifier
 func (g *generator) generateExistsExpr(expr *ast.ExistsExpr) string {
-	rangeStart := g.generateExpr(expr.Domain.Start)
-	rangeEnd := g.generateExpr(expr.Domain.End)
+	domain := g.generateQuantifierDomain(expr.Domain, expr.Map)
 	body := g.generateExpr(expr.Body)
 
 	return fmt.Sprintf("{\n"+
 		"    let mut __exists_found = false;\n"+
-		"    for %s in (%s..%s) {\n"+
+		"    for %s in %s {\n"+
 		"        if %s {\n"+
 		"            __exists_found = true;\n"+
 		"            break;\n"+
 		"        }\n"+
 		"    }\n"+
 		"    __exists_found\n"+
-		"}", expr.Variable, rangeStart, rangeEnd, body)
+		"}", expr.Variable, domain, body)
+}
+
+// generateQuantifierDomain generates what a quantifier iterates over: a
+// range, or the keys of a map
+func (g *generator) generateQuantifierDomain(domain *ast.RangeExpr, m ast.Expression) string {
+	if domain == nil {
+		return fmt.Sprintf("%s.keys().cloned()", g.generateExpr(m))
+	}
+	return fmt.Sprintf("(%s..%s)", g.generateExpr(domain.Start), g.generateExpr(domain.End))
 }
 
 // generateMatchExpr generates a Rust match expression
@@ -20,11 +20,17 @@ type Result struct {
 	Diagnostics *diagnostic.Diagnostics
 	RustSource  string
 	BinaryPath  string
+	Release     *ReleaseSummary // checks elided by a release build; nil otherwise
 }
 
 // Compile runs the full pipeline: parse -> check -> lower -> rustbe
 // Returns the result without writing files or invoking cargo.
 func Compile(source string) *Result {
+	return CompileWith(source, Options{})
+}
+
+// CompileWith is Compile with the Rust generation options taken from opts.
+func CompileWith(source string, opts Options) *Result {
 	res := &Result{}
 
 	// Parse
@@ -46,7 +52,11 @@ func Compile(source string) *Result {
 
 	// Lower to IR, then generate Rust
 	mod := ir.Lower(prog, checkResult)
-	res.RustSource = rustbe.Generate(mod)
+	if opts.Release {
+		res.Release = releaseChecks([]*ir.Module{mod}, nil, opts.Verify)
+	}
+	applyContractMode([]*ir.Module{mod}, opts.Contracts)
+	res.RustSource = rustbe.GenerateWith(mod, rustOptions(opts))
 
 	return res
 }
@@ -76,11 +86,14 @@ func EmitRust(source, outPath string) error {
 // Build runs the full pipeline and produces a native binary.
 // It creates a temp Cargo project, writes generated Rust, runs cargo build,
 // and copies the binary to outPath.
-func Build(source, outPath string) error {
-	res := Compile(source)
+func Build(source, outPath string, opts Options) error {
+	res := CompileWith(source, opts)
 	if res.Diagnostics != nil && res.Diagnostics.HasErrors() {
 		return fmt.Errorf("compilation errors:\n%s", res.Diagnostics.Format("input"))
 	}
+	if res.Release != nil {
+		fmt.Print(res.Release.Format())
+	}
 
 	// Create temp directory for Cargo project
 	tmpDir, err := os.MkdirTemp("", "intent-build-*")
@@ -141,6 +154,11 @@ edition = "2021"
 	return nil
 }
 
+// rustOptions selects the rustbe options from opts.
+func rustOptions(opts Options) rustbe.Options {
+	return rustbe.Options{CheckedArith: opts.CheckedArith, DebugContracts: opts.Contracts == ContractsDebug}
+}
+
 // HasImports checks if a source file contains import declarations by parsing it.
 func HasImports(source string) bool {
 	p := parser.New(source)
@@ -151,6 +169,12 @@ func HasImports(source string) bool {
 // CompileProject runs the multi-file pipeline: discover -> sort -> check -> lower -> rustbe.
 // entryPath is the path to the entry file (e.g., "examples/multi_file/main.intent").
 func CompileProject(entryPath string) *Result {
+	return CompileProjectWith(entryPath, Options{})
+}
+
+// CompileProjectWith is CompileProject with the Rust generation options
+// taken from opts.
+func CompileProjectWith(entryPath string, opts Options) *Result {
 	res := &Result{}
 
 	// Create module registry
@@ -195,7 +219,11 @@ func CompileProject(entryPath string) *Result {
 
 	// Lower to IR, then generate Rust
 	prog := ir.LowerAll(allModules, sortedPaths, checkResult)
-	res.RustSource = rustbe.GenerateAll(prog)
+	if opts.Release {
+		res.Release = releaseChecks(prog.Modules, prog, opts.Verify)
+	}
+	applyContractMode(prog.Modules, opts.Contracts)
+	res.RustSource = rustbe.GenerateAllWith(prog, rustOptions(opts))
 
 	return res
 }
@@ -233,11 +261,14 @@ func CheckProject(entryPath string) *diagnostic.Diagnostics {
 }
 
 // BuildProject runs the full multi-file pipeline and produces a native binary.
-func BuildProject(entryPath, outPath string) error {
-	res := CompileProject(entryPath)
+func BuildProject(entryPath, outPath string, opts Options) error {
+	res := CompileProjectWith(entryPath, opts)
 	if res.Diagnostics != nil && res.Diagnostics.HasErrors() {
 		return fmt.Errorf("compilation errors:\n%s", res.Diagnostics.Format(entryPath))
 	}
+	if res.Release != nil {
+		fmt.Print(res.Release.Format())
+	}
 
 	// Create temp directory for Cargo project
 	tmpDir, err := os.MkdirTemp("", "intent-build-*")
@@ -412,7 +443,7 @@ type VerifyOutput struct {
 // Verify runs the full pipeline (parse -> check -> lower -> verify) for a single file
 // and returns the verification results.
 func Verify(source string) ([]*verify.VerifyResult, error) {
-	out, err := VerifyWithReport(source)
+	out, err := VerifyWithReport(source, verify.Options{})
 	if err != nil {
 		return nil, err
 	}
@@ -420,7 +451,7 @@ func Verify(source string) ([]*verify.VerifyResult, error) {
 }
 
 // VerifyWithReport runs the full pipeline and returns results with intent reports.
-func VerifyWithReport(source string) (*VerifyOutput, error) {
+func VerifyWithReport(source string, opts verify.Options) (*VerifyOutput, error) {
 	// Parse
 	p := parser.New(source)
 	prog := p.Parse()
@@ -439,7 +470,7 @@ func VerifyWithReport(source string) (*VerifyOutput, error) {
 	mod := ir.Lower(prog, checkResult)
 
 	// Verify
-	results := verify.Verify(mod)
+	results := verify.VerifyInProgramWith(mod, nil, opts)
 	reports := verify.BuildIntentReports(mod, results)
 
 	return &VerifyOutput{Results: results, IntentReports: reports}, nil
@@ -448,7 +479,7 @@ func VerifyWithReport(source string) (*VerifyOutput, error) {
 // VerifyProject runs the full pipeline (discover -> check -> lower -> verify)
 // for a multi-file project and returns the verification results.
 func VerifyProject(entryPath string) ([]*verify.VerifyResult, error) {
-	out, err := VerifyProjectWithReport(entryPath)
+	out, err := VerifyProjectWithReport(entryPath, verify.Options{})
 	if err != nil {
 		return nil, err
 	}
@@ -456,7 +487,7 @@ func VerifyProject(entryPath string) ([]*verify.VerifyResult, error) {
 }
 
 // VerifyProjectWithReport runs the multi-file pipeline and returns results with intent reports.
-func VerifyProjectWithReport(entryPath string) (*VerifyOutput, error) {
+func VerifyProjectWithReport(entryPath string, opts verify.Options) (*VerifyOutput, error) {
 	// Create module registry
 	registry, err := NewModuleRegistry(entryPath)
 	if err != nil {
@@ -492,7 +523,7 @@ func VerifyProjectWithReport(entryPath string) (*VerifyOutput, error) {
 	var results []*verify.VerifyResult
 	var reports []*verify.IntentReport
 	for _, mod := range prog.Modules {
-		modResults := verify.Verify(mod)
+		modResults := verify.VerifyInProgramWith(mod, prog, opts)
 		results = append(results, modResults...)
 		modReports := verify.BuildIntentReports(mod, modResults)
 		reports = append(reports, modReports...)
@@ -0,0 +1,108 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// ContractMode selects which contracts a build checks at runtime. It applies
+// the same way to every target.
+type ContractMode string
+
+const (
+	// ContractsAll checks every contract. This is the default.
+	ContractsAll ContractMode = "all"
+	// ContractsRequires checks only preconditions, where functions,
+	// constructors and methods are entered. Postconditions, entity
+	// invariants, loop invariants and decreases clauses are left out unless
+	// marked @always_check.
+	ContractsRequires ContractMode = "requires"
+	// ContractsNone leaves out every contract check, @always_check included.
+	ContractsNone ContractMode = "none"
+	// ContractsDebug checks every contract in a form that can be switched
+	// off: debug_assert! in Rust, and a global flag in JS and WASM that can
+	// be changed at runtime. @always_check clauses stay unconditional.
+	ContractsDebug ContractMode = "debug"
+)
+
+// ParseContractMode parses the value of --contracts.
+func ParseContractMode(s string) (ContractMode, error) {
+	switch ContractMode(s) {
+	case ContractsAll, ContractsRequires, ContractsNone, ContractsDebug:
+		return ContractMode(s), nil
+	}
+	return "", fmt.Errorf("unknown contract mode: %s (expected all, requires, none or debug)", s)
+}
+
+// applyContractMode removes from mods the checks that mode leaves out. The
+// debug mode is handled by the backends.
+func applyContractMode(mods []*ir.Module, mode ContractMode) {
+	if mode != ContractsRequires && mode != ContractsNone {
+		return
+	}
+	keep := func(clauses []*ir.Contract) []*ir.Contract {
+		var kept []*ir.Contract
+		for _, c := range clauses {
+			if c.AlwaysCheck && mode == ContractsRequires {
+				kept = append(kept, c)
+			}
+		}
+		return kept
+	}
+	requires := func(clauses []*ir.Contract) []*ir.Contract {
+		if mode == ContractsNone {
+			return nil
+		}
+		return clauses
+	}
+
+	for _, mod := range mods {
+		for _, fn := range mod.Functions {
+			fn.Requires = requires(fn.Requires)
+			fn.Ensures = keep(fn.Ensures)
+			stripLoopChecks(fn.Body, keep)
+		}
+		for _, ent := range mod.Entities {
+			ent.Invariants = keep(ent.Invariants)
+			if ctor := ent.Constructor; ctor != nil {
+				ctor.Requires = requires(ctor.Requires)
+				ctor.Ensures = keep(ctor.Ensures)
+				if len(ctor.Ensures) == 0 {
+					ctor.OldCaptures = nil
+				}
+				stripLoopChecks(ctor.Body, keep)
+			}
+			for _, m := range ent.Methods {
+				m.Requires = requires(m.Requires)
+				m.Ensures = keep(m.Ensures)
+				if len(m.Ensures) == 0 {
+					m.OldCaptures = nil
+				}
+				stripLoopChecks(m.Body, keep)
+			}
+		}
+	}
+}
+
+// stripLoopChecks filters the invariants of every while loop in stmts with
+// keep and drops their decreases clauses, which cannot be marked
+// @always_check.
+func stripLoopChecks(stmts []ir.Stmt, keep func([]*ir.Contract) []*ir.Contract) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ir.WhileStmt:
+			s.Invariants = keep(s.Invariants)
+			s.Decreases = nil
+			if len(s.Invariants) == 0 {
+				s.OldCaptures = nil
+			}
+			stripLoopChecks(s.Body, keep)
+		case *ir.IfStmt:
+			stripLoopChecks(s.Then, keep)
+			stripLoopChecks(s.Else, keep)
+		case *ir.ForInStmt:
+			stripLoopChecks(s.Body, keep)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const contractModeSource = `module test version "1.0.0";
+
+function sum(n: Int) returns Int
+    requires n >= 0
+    ensures result >= 0
+    @always_check ensures result >= n - n
+{
+    let mutable i: Int = 0;
+    let mutable s: Int = 0;
+    while i < n
+        invariant s >= 0
+        decreases n - i
+    {
+        s = s + i;
+        i = i + 1;
+    }
+    return s;
+}
+
+entity Counter {
+    field n: Int;
+    invariant self.n >= 0;
+
+    constructor() {
+        self.n = 0;
+    }
+
+    method bump() returns Void
+        requires self.n < 1000
+        ensures self.n == old(self.n) + 1
+    {
+        self.n = self.n + 1;
+    }
+}
+
+entry function main() returns Int {
+    return sum(4);
+}`
+
+func TestContractModes(t *testing.T) {
+	tests := []struct {
+		mode    ContractMode
+		want    []string
+		notWant []string
+	}{
+		{
+			mode: ContractsAll,
+			want: []string{
+				`assert!((n >= 0i64), "Precondition failed: n >= 0");`,
+				`"Postcondition failed: result >= 0"`,
+				`"Loop invariant failed after iteration: s >= 0"`,
+				`"Termination metric did not decrease: n - i"`,
+				"fn __check_invariants",
+				"let __old_self_n = self.n;",
+			},
+		},
+		{
+			mode: ContractsRequires,
+			want: []string{
+				`assert!((n >= 0i64), "Precondition failed: n >= 0");`,
+				`"Precondition failed: self . n < 1000"`,
+				`"Postcondition failed: result >= n - n"`,
+			},
+			notWant: []string{
+				`"Postcondition failed: result >= 0"`,
+				"Loop invariant failed",
+				"Termination metric",
+				"__check_invariants",
+				"__old_self_n",
+			},
+		},
+		{
+			mode:    ContractsNone,
+			notWant: []string{"assert!", "__check_invariants", "__decreases", "__old_self_n"},
+		},
+		{
+			mode: ContractsDebug,
+			want: []string{
+				`debug_assert!((n >= 0i64), "Precondition failed: n >= 0");`,
+				`debug_assert!((s >= 0i64), "Loop invariant failed after iteration: s >= 0");`,
+				`    assert!((__result >= (n - n)), "Postcondition failed: result >= n - n");`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			res := CompileWith(contractModeSource, Options{Contracts: tt.mode})
+			if res.Diagnostics != nil && res.Diagnostics.HasErrors() {
+				t.Fatalf("Expected no errors, got:\n%s", res.Diagnostics.Format("test"))
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(res.RustSource, want) {
+					t.Errorf("Expected %q, got:\n%s", want, res.RustSource)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(res.RustSource, notWant) {
+					t.Errorf("Expected no %q, got:\n%s", notWant, res.RustSource)
+				}
+			}
+		})
+	}
+}
+
+func TestContractModesApplyToEveryTarget(t *testing.T) {
+	for _, target := range []string{"js", "wasm"} {
+		full := emitTarget(t, target, ContractsAll)
+		none := emitTarget(t, target, ContractsNone)
+		for _, msg := range []string{"Postcondition failed: result >= 0", "Loop invariant failed", "Invariant failed"} {
+			if !strings.Contains(full, msg) {
+				t.Errorf("%s: expected %q by default", target, msg)
+			}
+			if strings.Contains(none, msg) {
+				t.Errorf("%s: expected no %q with --contracts=none", target, msg)
+			}
+		}
+	}
+	if js := emitTarget(t, "js", ContractsDebug); !strings.Contains(js, "if (globalThis.__intentContracts && ") {
+		t.Errorf("js: expected checks behind the contracts flag, got:\n%s", js)
+	}
+	if wasm := emitTarget(t, "wasm", ContractsDebug); !strings.Contains(wasm, "__intent_contracts") {
+		t.Error("wasm: expected the contracts global exported")
+	}
+}
+
+// emitTarget writes contractModeSource for target in mode and returns the
+// generated file.
+func emitTarget(t *testing.T, target string, mode ContractMode) string {
+	t.Helper()
+	base := filepath.Join(t.TempDir(), "out")
+	if err := EmitToTarget(contractModeSource, target, base, Options{Contracts: mode}); err != nil {
+		t.Fatalf("EmitToTarget failed: %v", err)
+	}
+	out, err := os.ReadFile(base + getFileExtension(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestParseContractMode(t *testing.T) {
+	for _, s := range []string{"all", "requires", "none", "debug"} {
+		if mode, err := ParseContractMode(s); err != nil || string(mode) != s {
+			t.Errorf("ParseContractMode(%q) = %q, %v", s, mode, err)
+		}
+	}
+	if _, err := ParseContractMode("ensures"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
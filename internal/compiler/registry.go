@@ -19,6 +19,7 @@ type ModuleRegistry struct {
 	dependencies map[string][]string     // absolute file path -> imported absolute file paths
 	entryPath    string                  // absolute path to the entry point file
 	projectRoot  string                  // directory containing the entry file
+	sources      map[string]string       // absolute file path -> source overriding the file on disk
 }
 
 // NewModuleRegistry creates a new registry rooted at the given entry file.
@@ -35,9 +36,28 @@ func NewModuleRegistry(entryPath string) (*ModuleRegistry, error) {
 		dependencies: make(map[string][]string),
 		entryPath:    absPath,
 		projectRoot:  filepath.Dir(absPath),
+		sources:      make(map[string]string),
 	}, nil
 }
 
+// SetSource makes the registry use source for the given file instead of
+// reading it from disk, e.g. for an unsaved editor buffer.
+func (r *ModuleRegistry) SetSource(path, source string) {
+	if absPath, err := filepath.Abs(path); err == nil {
+		path = absPath
+	}
+	r.sources[path] = source
+}
+
+// readSource returns the source of a file, preferring one set with SetSource.
+func (r *ModuleRegistry) readSource(path string) (string, error) {
+	if source, ok := r.sources[path]; ok {
+		return source, nil
+	}
+	data, err := os.ReadFile(path)
+	return string(data), err
+}
+
 // DiscoverDependencies performs BFS from the entry file, parsing each
 // discovered .intent file and collecting its imports. Returns diagnostics
 // for any parse errors (with file paths set) and an error for fatal issues
@@ -57,13 +77,13 @@ func (r *ModuleRegistry) DiscoverDependencies() (*diagnostic.Diagnostics, error)
 		visited[filePath] = true
 
 		// Read source from disk
-		source, err := os.ReadFile(filePath)
+		source, err := r.readSource(filePath)
 		if err != nil {
 			return diag, fmt.Errorf("imported file not found: %s", filePath)
 		}
 
 		// Parse
-		p := parser.New(string(source))
+		p := parser.New(source)
 		prog := p.Parse()
 
 		// Collect parse errors with file context
@@ -88,7 +108,8 @@ func (r *ModuleRegistry) DiscoverDependencies() (*diagnostic.Diagnostics, error)
 			}
 
 			// Validate file exists
-			if _, err := os.Stat(resolved); os.IsNotExist(err) {
+			_, inMemory := r.sources[resolved]
+			if _, err := os.Stat(resolved); os.IsNotExist(err) && !inMemory {
 				return diag, fmt.Errorf("imported file not found: %s (resolved from %q in %s)",
 					resolved, imp.Path, filePath)
 			}
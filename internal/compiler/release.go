@@ -0,0 +1,325 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lhaig/intent/internal/ir"
+	"github.com/lhaig/intent/internal/verify"
+)
+
+// Release builds run the verifier first and leave out the runtime checks of
+// contracts it proved. A check is only elided when the proof does not rest
+// on anything left unproved:
+//
+//   - requires are always checked, since the verifier only shows they are
+//     satisfiable, not that every caller meets them;
+//   - ensures and loop invariants need their own proof and a proof of every
+//     overflow, division and bounds check in the same function, because the
+//     solver reasons about mathematical integers;
+//   - the verifier assumes loop invariants where loops exit and at the start
+//     of each iteration, so those checks also need every loop invariant in
+//     the function proved to hold on entry and be preserved by the body;
+//   - entity invariants hold by induction, so they need the constructor and
+//     every method proved to preserve them, with the same safety and loop
+//     invariant conditions for the whole entity;
+//   - clauses with a term the verifier cannot translate, such as a call to
+//     a function or method, are never elided, and neither are clauses
+//     marked @always_check.
+
+// ReleaseCheck records what a release build did with one contract check.
+type ReleaseCheck struct {
+	Name         string // qualified contract name, e.g. "BankAccount.deposit.ensures"
+	Text         string // contract source text
+	File         string // module path; empty for single-file builds
+	Line, Column int
+	Elided       bool
+	Reason       string // why the check was kept; empty when elided
+}
+
+// ReleaseSummary lists the contract checks of a release build.
+type ReleaseSummary struct {
+	Checks []*ReleaseCheck
+	// Errors holds verifier errors, such as a missing solver, that kept
+	// checks from being proved.
+	Errors []string
+}
+
+// Elided returns how many checks were left out.
+func (s *ReleaseSummary) Elided() int {
+	n := 0
+	for _, c := range s.Checks {
+		if c.Elided {
+			n++
+		}
+	}
+	return n
+}
+
+// Format renders the summary, one line per check.
+func (s *ReleaseSummary) Format() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Release build: elided %d of %d contract checks\n", s.Elided(), len(s.Checks))
+	for _, msg := range s.Errors {
+		fmt.Fprintf(&sb, "  verifier error: %s\n", msg)
+	}
+	for _, c := range s.Checks {
+		text := c.Text
+		if c.Line > 0 {
+			text += fmt.Sprintf(" (line %d:%d)", c.Line, c.Column)
+		}
+		if c.Elided {
+			fmt.Fprintf(&sb, "  elided  %s: %s\n", c.Name, text)
+		} else {
+			fmt.Fprintf(&sb, "  kept    %s: %s [%s]\n", c.Name, text, c.Reason)
+		}
+	}
+	return sb.String()
+}
+
+// releaseChecks verifies mods and removes from them the runtime checks of
+// the contracts that were proved. prog is nil for single-file builds.
+func releaseChecks(mods []*ir.Module, prog *ir.Program, opts verify.Options) *ReleaseSummary {
+	e := &elider{
+		summary:   &ReleaseSummary{},
+		results:   make(map[resultKey]*verify.VerifyResult),
+		unsafe:    make(map[scopeKey]bool),
+		loopsOpen: make(map[scopeKey]bool),
+		preserved: make(map[string][]*verify.VerifyResult),
+		errors:    make(map[string]bool),
+	}
+	for _, mod := range mods {
+		results := verify.VerifyInProgramWith(mod, prog, opts)
+		e.index(mod, results)
+	}
+	for _, mod := range mods {
+		e.module(mod)
+	}
+	return e.summary
+}
+
+// resultKey locates the result for one clause.
+type resultKey struct {
+	file         string
+	kind         string
+	line, column int
+}
+
+// scopeKey names a function, or a constructor or method of an entity.
+// Entity invariants use the entity with an empty function.
+type scopeKey struct {
+	entity, function string
+}
+
+type elider struct {
+	summary   *ReleaseSummary
+	results   map[resultKey]*verify.VerifyResult // ensures and loop invariant results by clause
+	unsafe    map[scopeKey]bool
+	loopsOpen map[scopeKey]bool                 // scopes with a loop invariant not proved
+	preserved map[string][]*verify.VerifyResult // invariant_preserved results per entity
+	errors    map[string]bool                   // verifier errors already in the summary
+}
+
+// index records the results for mod.
+func (e *elider) index(mod *ir.Module, results []*verify.VerifyResult) {
+	for _, r := range results {
+		switch r.ContractKind {
+		case "ensures", "loop_invariant":
+			e.results[resultKey{mod.Path, r.ContractKind, r.Line, r.Column}] = r
+		case "invariant_preserved":
+			e.preserved[r.EntityName] = append(e.preserved[r.EntityName], r)
+		case "overflow", "div_by_zero", "bounds":
+			if r.Status != "verified" {
+				function, _, _ := strings.Cut(r.FunctionName, ".loop_")
+				e.unsafe[scopeKey{r.EntityName, function}] = true
+			}
+		}
+		if r.Status == "error" && !e.errors[r.Message] {
+			e.errors[r.Message] = true
+			e.summary.Errors = append(e.summary.Errors, r.Message)
+		}
+	}
+}
+
+func (e *elider) module(mod *ir.Module) {
+	for _, fn := range mod.Functions {
+		scope := scopeKey{"", fn.Name}
+		e.markUnprovedLoops(mod, scope, fn.Body)
+		e.requires(mod, fn.Name, fn.Requires)
+		fn.Ensures = e.clauses(mod, fn.Name+".ensures", "ensures", scope, fn.Ensures)
+		e.loops(mod, fn.Name, scope, fn.Body)
+	}
+	for _, ent := range mod.Entities {
+		e.entity(mod, ent)
+	}
+}
+
+func (e *elider) entity(mod *ir.Module, ent *ir.Entity) {
+	if ctor := ent.Constructor; ctor != nil {
+		name := ent.Name + ".constructor"
+		scope := scopeKey{ent.Name, "constructor"}
+		e.markUnprovedLoops(mod, scope, ctor.Body)
+		e.requires(mod, name, ctor.Requires)
+		ctor.Ensures = e.clauses(mod, name+".ensures", "ensures", scope, ctor.Ensures)
+		e.loops(mod, name, scope, ctor.Body)
+	}
+	for _, m := range ent.Methods {
+		name := ent.Name + "." + m.Name
+		scope := scopeKey{ent.Name, m.Name}
+		e.markUnprovedLoops(mod, scope, m.Body)
+		e.requires(mod, name, m.Requires)
+		m.Ensures = e.clauses(mod, name+".ensures", "ensures", scope, m.Ensures)
+		e.loops(mod, name, scope, m.Body)
+	}
+
+	if len(ent.Invariants) == 0 {
+		return
+	}
+	reason := e.invariantReason(ent)
+	var kept []*ir.Contract
+	for _, inv := range ent.Invariants {
+		check := e.check(mod, ent.Name+".invariant", inv)
+		switch {
+		case inv.AlwaysCheck:
+			check.Reason = "@always_check"
+		case !verify.Translatable(inv.Expr):
+			check.Reason = "untranslatable term"
+		case reason != "":
+			check.Reason = reason
+		default:
+			check.Elided = true
+		}
+		if !check.Elided {
+			kept = append(kept, inv)
+		}
+	}
+	ent.Invariants = kept
+}
+
+// invariantReason explains why the invariants of ent must stay checked, or
+// returns "" when every step of the induction is proved.
+func (e *elider) invariantReason(ent *ir.Entity) string {
+	scopes := []scopeKey{{ent.Name, ""}, {ent.Name, "constructor"}}
+	for _, m := range ent.Methods {
+		scopes = append(scopes, scopeKey{ent.Name, m.Name})
+	}
+	for _, scope := range scopes {
+		if e.unsafe[scope] {
+			return "unproved safety check in " + scopeName(scope)
+		}
+		if e.loopsOpen[scope] {
+			return "unproved loop invariant in " + scopeName(scope)
+		}
+	}
+	want := len(ent.Methods)
+	if ent.Constructor != nil {
+		want++
+	}
+	results := e.preserved[ent.Name]
+	if len(results) < want {
+		return "preservation not verified"
+	}
+	for _, r := range results {
+		if r.Status != "verified" {
+			return fmt.Sprintf("%s is %s", r.QualifiedName(), r.Status)
+		}
+	}
+	return ""
+}
+
+// requires records the preconditions, which are always checked.
+func (e *elider) requires(mod *ir.Module, name string, clauses []*ir.Contract) {
+	for _, c := range clauses {
+		e.check(mod, name+".requires", c).Reason = "precondition"
+	}
+}
+
+// clauses decides each ensures or loop invariant clause and returns the ones
+// whose checks are kept.
+func (e *elider) clauses(mod *ir.Module, name, kind string, scope scopeKey, clauses []*ir.Contract) []*ir.Contract {
+	var kept []*ir.Contract
+	for _, c := range clauses {
+		check := e.check(mod, name, c)
+		r := e.results[resultKey{mod.Path, kind, c.Line, c.Column}]
+		switch {
+		case c.AlwaysCheck:
+			check.Reason = "@always_check"
+		case !verify.Translatable(c.Expr):
+			check.Reason = "untranslatable term"
+		case r == nil || c.Line == 0:
+			check.Reason = "not verified"
+		case r.Status != "verified":
+			check.Reason = r.Status
+		case e.unsafe[scope]:
+			check.Reason = "unproved safety check in " + scopeName(scope)
+		case e.loopsOpen[scope]:
+			check.Reason = "unproved loop invariant in " + scopeName(scope)
+		default:
+			check.Elided = true
+		}
+		if !check.Elided {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// loops decides the invariants of the while loops in body, numbering them
+// as the verifier does.
+func (e *elider) loops(mod *ir.Module, name string, scope scopeKey, body []ir.Stmt) {
+	for i, loop := range whileLoops(body) {
+		loopName := fmt.Sprintf("%s.loop_%d.loop_invariant", name, i+1)
+		loop.Invariants = e.clauses(mod, loopName, "loop_invariant", scope, loop.Invariants)
+	}
+}
+
+// markUnprovedLoops records scope in loopsOpen unless every loop invariant in
+// body was proved. It runs before any of them are elided.
+func (e *elider) markUnprovedLoops(mod *ir.Module, scope scopeKey, body []ir.Stmt) {
+	for _, loop := range whileLoops(body) {
+		for _, inv := range loop.Invariants {
+			r := e.results[resultKey{mod.Path, "loop_invariant", inv.Line, inv.Column}]
+			if r == nil || inv.Line == 0 || r.Status != "verified" {
+				e.loopsOpen[scope] = true
+				return
+			}
+		}
+	}
+}
+
+func (e *elider) check(mod *ir.Module, name string, c *ir.Contract) *ReleaseCheck {
+	check := &ReleaseCheck{Name: name, Text: c.RawText, File: mod.Path, Line: c.Line, Column: c.Column}
+	e.summary.Checks = append(e.summary.Checks, check)
+	return check
+}
+
+func scopeName(s scopeKey) string {
+	switch {
+	case s.entity == "":
+		return s.function
+	case s.function == "":
+		return s.entity + ".invariant"
+	}
+	return s.entity + "." + s.function
+}
+
+// whileLoops lists the while loops with invariants in stmts, outer loops
+// first.
+func whileLoops(stmts []ir.Stmt) []*ir.WhileStmt {
+	var loops []*ir.WhileStmt
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ir.WhileStmt:
+			if len(s.Invariants) > 0 {
+				loops = append(loops, s)
+			}
+			loops = append(loops, whileLoops(s.Body)...)
+		case *ir.IfStmt:
+			loops = append(loops, whileLoops(s.Then)...)
+			loops = append(loops, whileLoops(s.Else)...)
+		case *ir.ForInStmt:
+			loops = append(loops, whileLoops(s.Body)...)
+		}
+	}
+	return loops
+}
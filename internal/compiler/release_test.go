@@ -0,0 +1,260 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lhaig/intent/internal/verify"
+)
+
+const releaseSource = `module test version "1.0.0";
+
+function double(x: Int) returns Int
+    requires x >= 0 and x < 1000
+    ensures result == x * 2
+    @always_check ensures result >= 0
+{
+    return x * 2;
+}
+
+entity Counter {
+    field n: Int;
+    invariant self.n >= 0;
+
+    constructor()
+        ensures self.n == 0
+    {
+        self.n = 0;
+    }
+
+    method bump() returns Void
+        requires self.n < 1000
+        ensures self.n == old(self.n) + 1
+    {
+        self.n = self.n + 1;
+    }
+}
+
+entry function main() returns Int {
+    return double(2);
+}`
+
+// proveAll answers like a solver that proves every contract: requires are
+// satisfiable and every other goal is refuted.
+func proveAll(query string) string {
+	if strings.Contains(query, "; Requires (checking satisfiability)") {
+		return "sat"
+	}
+	return "unsat"
+}
+
+func TestReleaseElidesProvedChecks(t *testing.T) {
+	solver := &verify.ScriptedSolver{Respond: proveAll}
+	res := CompileWith(releaseSource, Options{Release: true, Verify: verify.Options{Solver: solver}})
+	if res.Diagnostics != nil && res.Diagnostics.HasErrors() {
+		t.Fatalf("Expected no errors, got:\n%s", res.Diagnostics.Format("test"))
+	}
+
+	elided := make(map[string]bool)
+	for _, c := range res.Release.Checks {
+		elided[c.Name+": "+c.Text] = c.Elided
+	}
+	want := map[string]bool{
+		"double.requires: x >= 0 and x < 1000":                   false,
+		"double.ensures: result == x * 2":                        true,
+		"double.ensures: result >= 0":                            false,
+		"Counter.constructor.ensures: self . n == 0":             true,
+		"Counter.bump.requires: self . n < 1000":                 false,
+		"Counter.bump.ensures: self . n == old ( self . n ) + 1": true,
+		"Counter.invariant: self . n >= 0":                       true,
+	}
+	for name, w := range want {
+		got, ok := elided[name]
+		if !ok {
+			t.Errorf("Missing check %s in summary:\n%s", name, res.Release.Format())
+		} else if got != w {
+			t.Errorf("%s: expected elided=%v, got %v", name, w, got)
+		}
+	}
+
+	rust := res.RustSource
+	if strings.Contains(rust, "Postcondition failed: result == x * 2") || strings.Contains(rust, "__check_invariants") {
+		t.Errorf("Expected proved checks left out, got:\n%s", rust)
+	}
+	if !strings.Contains(rust, "Precondition failed: x >= 0 and x < 1000") || !strings.Contains(rust, "Postcondition failed: result >= 0") {
+		t.Errorf("Expected precondition and @always_check checks kept, got:\n%s", rust)
+	}
+}
+
+func TestReleaseKeepsChecksWithUnprovedSafety(t *testing.T) {
+	// Overflow in bump is not ruled out, so neither its ensures nor the
+	// invariant it must preserve can be trusted
+	solver := &verify.ScriptedSolver{Respond: func(query string) string {
+		if strings.Contains(query, "; Safety check in method: Counter.bump") {
+			return "sat"
+		}
+		return proveAll(query)
+	}}
+	res := CompileWith(releaseSource, Options{Release: true, Verify: verify.Options{Solver: solver}})
+	if res.Diagnostics != nil && res.Diagnostics.HasErrors() {
+		t.Fatalf("Expected no errors, got:\n%s", res.Diagnostics.Format("test"))
+	}
+
+	for _, c := range res.Release.Checks {
+		if (c.Name == "Counter.bump.ensures" || c.Name == "Counter.invariant") && c.Elided {
+			t.Errorf("Expected %s kept, got it elided", c.Name)
+		}
+		if c.Name == "double.ensures" && c.Text == "result == x * 2" && !c.Elided {
+			t.Errorf("Expected double.ensures elided, got kept: %s", c.Reason)
+		}
+	}
+	if !strings.Contains(res.Release.Format(), "[unproved safety check in Counter.bump]") {
+		t.Errorf("Expected the reason in the summary, got:\n%s", res.Release.Format())
+	}
+	if !strings.Contains(res.RustSource, "__check_invariants") {
+		t.Error("Expected the invariant check kept")
+	}
+}
+
+func TestReleaseWithoutSolverKeepsChecks(t *testing.T) {
+	solver := &verify.ScriptedSolver{Respond: func(string) string { return "unknown" }}
+	res := CompileWith(releaseSource, Options{Release: true, Verify: verify.Options{Solver: solver}})
+
+	if n := res.Release.Elided(); n != 0 {
+		t.Errorf("Expected no checks elided, got %d:\n%s", n, res.Release.Format())
+	}
+	if plain := CompileWith(releaseSource, Options{}); plain.RustSource != res.RustSource {
+		t.Error("Expected the same code as a build without --release")
+	}
+}
+
+const falseInvariantSource = `module test version "1.0.0";
+
+function count_to(n: Int) returns Int
+    requires n >= 0 and n < 1000
+    ensures result == 12345
+{
+    let mutable i: Int = 0;
+    while i < n invariant i == 12345 {
+        i = i + 1;
+    }
+    return i;
+}
+
+entry function main() returns Int {
+    return count_to(3);
+}`
+
+func TestReleaseKeepsChecksWithFalseLoopInvariant(t *testing.T) {
+	// The invariant fails on entry, where i is 0. The ensures only follows
+	// from assuming it when the loop exits, so it stays checked as well.
+	var invQuery string
+	solver := &verify.ScriptedSolver{Respond: func(query string) string {
+		if strings.Contains(query, "; Loop invariant verification for: count_to") {
+			invQuery = query
+			return "sat"
+		}
+		return proveAll(query)
+	}}
+	res := CompileWith(falseInvariantSource, Options{Release: true, Verify: verify.Options{Solver: solver}})
+	if res.Diagnostics != nil && res.Diagnostics.HasErrors() {
+		t.Fatalf("Expected no errors, got:\n%s", res.Diagnostics.Format("test"))
+	}
+
+	if !strings.Contains(invQuery, "(=> true (= 0 12345))") {
+		t.Errorf("Expected the invariant proved on entry, got query:\n%s", invQuery)
+	}
+	reasons := make(map[string]string)
+	for _, c := range res.Release.Checks {
+		if c.Elided {
+			t.Errorf("Expected %s kept, got it elided", c.Name)
+		}
+		reasons[c.Name] = c.Reason
+	}
+	if got := reasons["count_to.loop_1.loop_invariant"]; got != "unverified" {
+		t.Errorf("Expected the loop invariant kept as unverified, got %q", got)
+	}
+	if got := reasons["count_to.ensures"]; got != "unproved loop invariant in count_to" {
+		t.Errorf("Expected the ensures kept for the loop invariant, got %q", got)
+	}
+	if !strings.Contains(res.RustSource, "Loop invariant failed at entry: i == 12345") {
+		t.Errorf("Expected the loop invariant check kept, got:\n%s", res.RustSource)
+	}
+}
+
+const untranslatableSource = `module test version "1.0.0";
+
+function is_pos(x: Int) returns Bool {
+    return x > 0;
+}
+
+function neg() returns Int
+    ensures is_pos(result)
+{
+    return 0 - 5;
+}
+
+entry function main() returns Int {
+    return neg();
+}`
+
+func TestReleaseKeepsUntranslatableChecks(t *testing.T) {
+	// Even a solver that refutes every goal proves nothing about is_pos
+	solver := &verify.ScriptedSolver{Respond: proveAll}
+	res := CompileWith(untranslatableSource, Options{Release: true, Verify: verify.Options{Solver: solver}})
+	if res.Diagnostics != nil && res.Diagnostics.HasErrors() {
+		t.Fatalf("Expected no errors, got:\n%s", res.Diagnostics.Format("test"))
+	}
+
+	if n := res.Release.Elided(); n != 0 {
+		t.Errorf("Expected no checks elided, got %d:\n%s", n, res.Release.Format())
+	}
+	if !strings.Contains(res.Release.Format(), "kept    neg.ensures: is_pos ( result ) (line 8:5) [untranslatable term]") {
+		t.Errorf("Expected the reason in the summary, got:\n%s", res.Release.Format())
+	}
+	if !strings.Contains(res.RustSource, "Postcondition failed: is_pos ( result )") {
+		t.Errorf("Expected the ensures check kept, got:\n%s", res.RustSource)
+	}
+}
+
+const outsideWriteSource = `module test version "1.0.0";
+
+entity Acc {
+    field balance: Int;
+    invariant self.balance >= 0;
+
+    constructor()
+        ensures self.balance == 0
+    {
+        self.balance = 0;
+    }
+
+    method get() returns Int
+        ensures result >= 0
+    {
+        return self.balance;
+    }
+}
+
+entry function main() returns Int {
+    let mutable a: Acc = Acc();
+    a.balance = 0 - 50;
+    print(a.get());
+    return 0;
+}`
+
+func TestReleaseRejectsOutsideFieldWrites(t *testing.T) {
+	// The invariant proof assumes only Acc's own code writes its fields,
+	// so a write from main must not reach a build that trusts it
+	solver := &verify.ScriptedSolver{Respond: proveAll}
+	res := CompileWith(outsideWriteSource, Options{Release: true, Verify: verify.Options{Solver: solver}})
+	if res.Diagnostics == nil || !res.Diagnostics.HasErrors() {
+		t.Fatalf("Expected the outside write rejected, got:\n%s", res.RustSource)
+	}
+	if got := res.Diagnostics.Format("test"); !strings.Contains(got, "cannot assign to field 'balance' of Acc outside its constructor and methods") {
+		t.Errorf("Expected the outside write reported, got:\n%s", got)
+	}
+	if res.Release != nil && res.Release.Elided() != 0 {
+		t.Errorf("Expected no checks elided, got:\n%s", res.Release.Format())
+	}
+}
@@ -0,0 +1,82 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/interp"
+	"github.com/lhaig/intent/internal/ir"
+	"github.com/lhaig/intent/internal/parser"
+)
+
+// Lower runs parse -> check -> lower for a single file and returns the IR as
+// a one-module program. fileName is used in error messages.
+func Lower(source, fileName string) (*ir.Program, error) {
+	p := parser.New(source)
+	prog := p.Parse()
+	if p.Diagnostics().HasErrors() {
+		return nil, fmt.Errorf("%s", p.Diagnostics().Format(fileName))
+	}
+
+	checkResult := checker.CheckWithResult(prog)
+	if checkResult.Diagnostics.HasErrors() {
+		return nil, fmt.Errorf("%s", checkResult.Diagnostics.Format(fileName))
+	}
+
+	mod := ir.Lower(prog, checkResult)
+	return &ir.Program{Modules: []*ir.Module{mod}}, nil
+}
+
+// LowerProject runs discover -> sort -> check -> lower for a multi-file project.
+func LowerProject(entryPath string) (*ir.Program, error) {
+	registry, err := NewModuleRegistry(entryPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize module registry: %w", err)
+	}
+
+	diag, err := registry.DiscoverDependencies()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover dependencies: %w", err)
+	}
+	if diag.HasErrors() {
+		return nil, fmt.Errorf("%s", diag.Format(entryPath))
+	}
+
+	sortedPaths, err := registry.TopologicalSort()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sort dependencies: %w", err)
+	}
+
+	allModules := registry.AllModules()
+	checkResult := checker.CheckAll(allModules, sortedPaths)
+	if checkResult.Diagnostics.HasErrors() {
+		return nil, fmt.Errorf("%s", checkResult.Diagnostics.Format(entryPath))
+	}
+
+	return ir.LowerAll(allModules, sortedPaths, checkResult), nil
+}
+
+// LowerFile lowers a file, together with its imports when it has any.
+func LowerFile(filePath string) (*ir.Program, error) {
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	if HasImports(string(source)) {
+		return LowerProject(filePath)
+	}
+	return Lower(string(source), filePath)
+}
+
+// Run interprets a file without any external toolchain, writing print output
+// to out. It returns the entry function's result as the exit code; contract
+// violations are returned as *interp.ContractError.
+func Run(filePath string, out io.Writer) (int64, error) {
+	prog, err := LowerFile(filePath)
+	if err != nil {
+		return 1, err
+	}
+	return interp.New(prog, out).Run()
+}
@@ -0,0 +1,94 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lhaig/intent/internal/interp"
+)
+
+func TestRunSingleFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	source := `module hello version "1.0.0";
+
+entry function main() returns Int {
+    print("hello");
+    return 3;
+}
+`
+	if err := os.WriteFile(tmpDir+"/hello.intent", []byte(source), 0644); err != nil {
+		t.Fatalf("Failed to write hello.intent: %s", err)
+	}
+
+	var out bytes.Buffer
+	code, err := Run(tmpDir+"/hello.intent", &out)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if code != 3 {
+		t.Errorf("Expected exit code 3, got %d", code)
+	}
+	if out.String() != "hello\n" {
+		t.Errorf("Expected 'hello', got %q", out.String())
+	}
+}
+
+func TestRunMultiFile(t *testing.T) {
+	var out bytes.Buffer
+	code, err := Run("../../examples/multi_file/main.intent", &out)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if code != 0 || out.String() != "14\n" {
+		t.Errorf("Expected exit 0 and '14', got %d and %q", code, out.String())
+	}
+}
+
+func TestRunContractViolation(t *testing.T) {
+	tmpDir := t.TempDir()
+	source := `module bad version "1.0.0";
+
+function half(n: Int) returns Int
+    requires n % 2 == 0
+{
+    return n / 2;
+}
+
+entry function main() returns Int {
+    return half(3);
+}
+`
+	if err := os.WriteFile(tmpDir+"/bad.intent", []byte(source), 0644); err != nil {
+		t.Fatalf("Failed to write bad.intent: %s", err)
+	}
+
+	_, err := Run(tmpDir+"/bad.intent", &bytes.Buffer{})
+	var contractErr *interp.ContractError
+	if !errors.As(err, &contractErr) {
+		t.Fatalf("Expected a contract error, got %v", err)
+	}
+	if contractErr.Message != "Precondition failed: n % 2 == 0" {
+		t.Errorf("Unexpected message: %s", contractErr.Message)
+	}
+}
+
+func TestRunCheckError(t *testing.T) {
+	tmpDir := t.TempDir()
+	source := `module bad version "1.0.0";
+
+entry function main() returns Int {
+    return missing;
+}
+`
+	if err := os.WriteFile(tmpDir+"/bad.intent", []byte(source), 0644); err != nil {
+		t.Fatalf("Failed to write bad.intent: %s", err)
+	}
+
+	_, err := Run(tmpDir+"/bad.intent", &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Expected a check error mentioning 'missing', got %v", err)
+	}
+}
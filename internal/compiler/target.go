@@ -9,26 +9,47 @@ import (
 	"github.com/lhaig/intent/internal/backend"
 	"github.com/lhaig/intent/internal/checker"
 	"github.com/lhaig/intent/internal/ir"
+	"github.com/lhaig/intent/internal/jsbe"
 	"github.com/lhaig/intent/internal/parser"
+	"github.com/lhaig/intent/internal/verify"
+	"github.com/lhaig/intent/internal/wasmbe"
 )
 
+// Options configures code generation for the target functions. The zero
+// value selects every backend's defaults.
+type Options struct {
+	// IntMode selects how the JS target represents Int.
+	IntMode jsbe.IntMode
+	// CheckedArith makes the Rust target check Int arithmetic for overflow
+	// and division by zero instead of wrapping.
+	CheckedArith bool
+	// Release verifies the program before generating code and leaves out
+	// the runtime checks of the contracts that were proved.
+	Release bool
+	// Verify configures the verifier run by release builds.
+	Verify verify.Options
+	// Contracts selects which contracts are checked at runtime. The empty
+	// mode checks them all.
+	Contracts ContractMode
+}
+
 // getBackend returns the appropriate backend for the given target
-func getBackend(target string) (backend.Backend, error) {
+func getBackend(target string, opts Options) (backend.Backend, error) {
 	switch target {
 	case "rust":
-		return &backend.RustBackend{}, nil
+		return &backend.RustBackend{Options: rustOptions(opts)}, nil
 	case "js":
-		return &backend.JSBackend{}, nil
+		return &backend.JSBackend{Options: jsbe.Options{IntMode: opts.IntMode, DebugContracts: opts.Contracts == ContractsDebug}}, nil
 	default:
 		return nil, fmt.Errorf("unknown target: %s", target)
 	}
 }
 
 // getBinaryBackend returns a binary backend for targets that produce binary output
-func getBinaryBackend(target string) (backend.BinaryBackend, error) {
+func getBinaryBackend(target string, opts Options) (backend.BinaryBackend, error) {
 	switch target {
 	case "wasm":
-		return &backend.WasmBackend{}, nil
+		return &backend.WasmBackend{Options: wasmbe.Options{DebugContracts: opts.Contracts == ContractsDebug}}, nil
 	default:
 		return nil, fmt.Errorf("unknown binary target: %s", target)
 	}
@@ -49,7 +70,7 @@ func getFileExtension(target string) string {
 }
 
 // EmitToTarget compiles source to the given target and writes output file
-func EmitToTarget(source, target, baseName string) error {
+func EmitToTarget(source, target, baseName string, opts Options) error {
 	// Parse
 	p := parser.New(source)
 	prog := p.Parse()
@@ -65,10 +86,14 @@ func EmitToTarget(source, target, baseName string) error {
 
 	// Lower to IR
 	mod := ir.Lower(prog, checkResult)
+	if opts.Release {
+		fmt.Print(releaseChecks([]*ir.Module{mod}, nil, opts.Verify).Format())
+	}
+	applyContractMode([]*ir.Module{mod}, opts.Contracts)
 
 	// Handle binary targets (WASM)
 	if target == "wasm" {
-		bbe, err := getBinaryBackend(target)
+		bbe, err := getBinaryBackend(target, opts)
 		if err != nil {
 			return err
 		}
@@ -78,11 +103,11 @@ func EmitToTarget(source, target, baseName string) error {
 			return fmt.Errorf("failed to write output file: %w", err)
 		}
 		fmt.Printf("Wrote %s\n", outPath)
-		return nil
+		return writeWasmLoader(baseName, []*ir.Module{mod})
 	}
 
 	// Handle text targets (Rust, JS)
-	be, err := getBackend(target)
+	be, err := getBackend(target, opts)
 	if err != nil {
 		return err
 	}
@@ -99,7 +124,7 @@ func EmitToTarget(source, target, baseName string) error {
 }
 
 // EmitProjectToTarget compiles a multi-file project to the given target and writes output file
-func EmitProjectToTarget(entryPath, target, baseName string) error {
+func EmitProjectToTarget(entryPath, target, baseName string, opts Options) error {
 	// Create module registry
 	registry, err := NewModuleRegistry(entryPath)
 	if err != nil {
@@ -130,10 +155,14 @@ func EmitProjectToTarget(entryPath, target, baseName string) error {
 
 	// Lower to IR
 	prog := ir.LowerAll(allModules, sortedPaths, checkResult)
+	if opts.Release {
+		fmt.Print(releaseChecks(prog.Modules, prog, opts.Verify).Format())
+	}
+	applyContractMode(prog.Modules, opts.Contracts)
 
 	// Handle binary targets (WASM)
 	if target == "wasm" {
-		bbe, err := getBinaryBackend(target)
+		bbe, err := getBinaryBackend(target, opts)
 		if err != nil {
 			return err
 		}
@@ -143,11 +172,11 @@ func EmitProjectToTarget(entryPath, target, baseName string) error {
 			return fmt.Errorf("failed to write output file: %w", err)
 		}
 		fmt.Printf("Wrote %s (multi-file)\n", outPath)
-		return nil
+		return writeWasmLoader(baseName, prog.Modules)
 	}
 
 	// Handle text targets (Rust, JS)
-	be, err := getBackend(target)
+	be, err := getBackend(target, opts)
 	if err != nil {
 		return err
 	}
@@ -163,32 +192,45 @@ func EmitProjectToTarget(entryPath, target, baseName string) error {
 	return nil
 }
 
+// writeWasmLoader writes the JS loader stub that runs baseName.wasm with the
+// host imports it needs (print and contract violations).
+func writeWasmLoader(baseName string, mods []*ir.Module) error {
+	wasmFile := filepath.Base(baseName) + ".wasm"
+	outPath := baseName + ".loader.js"
+	loader := wasmbe.Loader(wasmFile, wasmbe.EntryName(mods))
+	if err := os.WriteFile(outPath, []byte(loader), 0644); err != nil {
+		return fmt.Errorf("failed to write loader: %w", err)
+	}
+	fmt.Printf("Wrote %s\n", outPath)
+	return nil
+}
+
 // BuildToTarget compiles source to the given target and produces a binary
-func BuildToTarget(source, target, baseName string) error {
+func BuildToTarget(source, target, baseName string, opts Options) error {
 	switch target {
 	case "rust":
-		return Build(source, baseName)
+		return Build(source, baseName, opts)
 	case "js":
 		// For JS, just emit the source (no binary build step)
-		return EmitToTarget(source, target, baseName)
+		return EmitToTarget(source, target, baseName, opts)
 	case "wasm":
 		// Direct WASM emission - no Rust toolchain required
-		return EmitToTarget(source, target, baseName)
+		return EmitToTarget(source, target, baseName, opts)
 	default:
 		return fmt.Errorf("unknown target: %s", target)
 	}
 }
 
 // BuildProjectToTarget compiles a multi-file project to the given target and produces a binary
-func BuildProjectToTarget(entryPath, target, baseName string) error {
+func BuildProjectToTarget(entryPath, target, baseName string, opts Options) error {
 	switch target {
 	case "rust":
-		return BuildProject(entryPath, baseName)
+		return BuildProject(entryPath, baseName, opts)
 	case "js":
-		return EmitProjectToTarget(entryPath, target, baseName)
+		return EmitProjectToTarget(entryPath, target, baseName, opts)
 	case "wasm":
 		// Direct WASM emission - no Rust toolchain required
-		return EmitProjectToTarget(entryPath, target, baseName)
+		return EmitProjectToTarget(entryPath, target, baseName, opts)
 	default:
 		return fmt.Errorf("unknown target: %s", target)
 	}
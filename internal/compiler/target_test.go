@@ -16,7 +16,7 @@ entry function main() returns Int {
 	baseName := "test_output_js"
 	defer os.Remove(baseName + ".js")
 
-	err := EmitToTarget(source, "js", baseName)
+	err := EmitToTarget(source, "js", baseName, Options{})
 	if err != nil {
 		t.Fatalf("EmitToTarget failed: %v", err)
 	}
@@ -49,7 +49,7 @@ entry function main() returns Int {
 	baseName := "test_output_rust"
 	defer os.Remove(baseName + ".rs")
 
-	err := EmitToTarget(source, "rust", baseName)
+	err := EmitToTarget(source, "rust", baseName, Options{})
 	if err != nil {
 		t.Fatalf("EmitToTarget failed: %v", err)
 	}
@@ -81,7 +81,7 @@ func TestGetBackend(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.target, func(t *testing.T) {
-			be, err := getBackend(tt.target)
+			be, err := getBackend(tt.target, Options{})
 			if tt.shouldError {
 				if err == nil {
 					t.Errorf("Expected error for target %s, got none", tt.target)
@@ -109,7 +109,7 @@ func TestGetBinaryBackend(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.target, func(t *testing.T) {
-			be, err := getBinaryBackend(tt.target)
+			be, err := getBinaryBackend(tt.target, Options{})
 			if tt.shouldError {
 				if err == nil {
 					t.Errorf("Expected error for target %s, got none", tt.target)
@@ -134,7 +134,7 @@ entry function main() returns Int {
 `
 	baseName := t.TempDir() + "/test_output_wasm"
 
-	err := EmitToTarget(source, "wasm", baseName)
+	err := EmitToTarget(source, "wasm", baseName, Options{})
 	if err != nil {
 		t.Fatalf("EmitToTarget wasm failed: %v", err)
 	}
@@ -0,0 +1,448 @@
+// Package conformance checks that the Rust, JavaScript and WebAssembly
+// backends agree on the observable behavior of a program: its stdout, its
+// exit code, and whether and how it aborted. Each available target is built
+// and run, and its outcome is compared with the interpreter's, which serves
+// as the oracle. Targets whose toolchain is missing are skipped, so a tree
+// with no toolchains at all still exercises the interpreter.
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lhaig/intent/internal/compiler"
+	"github.com/lhaig/intent/internal/interp"
+	"github.com/lhaig/intent/internal/ir"
+	"github.com/lhaig/intent/internal/jsbe"
+	"github.com/lhaig/intent/internal/parser"
+	"github.com/lhaig/intent/internal/rustbe"
+	"github.com/lhaig/intent/internal/wasmbe"
+)
+
+// Outcome is what running a program produced, normalized so outcomes from
+// different targets can be compared.
+type Outcome struct {
+	Stdout    string
+	ExitCode  int    // the entry result as the OS reports it (low 8 bits)
+	Violation string // the contract violation message that aborted the run
+	Trap      bool   // aborted by a runtime error that is not a contract
+	Detail    string // the trap message, for reports only
+}
+
+// Equal reports whether two outcomes are observably the same. Exit codes
+// only count for runs that completed, since each target exits differently
+// when it aborts; trap messages are not compared.
+func (o Outcome) Equal(other Outcome) bool {
+	if o.Stdout != other.Stdout || o.Violation != other.Violation || o.Trap != other.Trap {
+		return false
+	}
+	if o.Violation == "" && !o.Trap {
+		return o.ExitCode == other.ExitCode
+	}
+	return true
+}
+
+// Summary describes how the run ended, e.g. "exit 0" or "violation: ...".
+func (o Outcome) Summary() string {
+	switch {
+	case o.Violation != "":
+		return "violation: " + o.Violation
+	case o.Trap:
+		return "trap: " + o.Detail
+	}
+	return fmt.Sprintf("exit %d", o.ExitCode)
+}
+
+// contractPrefixes are the messages every backend aborts with on a contract
+// violation.
+var contractPrefixes = []string{
+	"Precondition failed: ",
+	"Postcondition failed: ",
+	"Invariant failed: ",
+	"Loop invariant failed at entry: ",
+	"Loop invariant failed after iteration: ",
+	"Decreases metric must be non-negative at entry: ",
+	"Termination metric did not decrease: ",
+	"Termination metric became negative: ",
+}
+
+// violation finds a contract violation message in a target's stderr. The
+// last match wins: Node echoes the throwing source line before the error.
+func violation(stderr string) string {
+	found := ""
+	for _, line := range strings.Split(stderr, "\n") {
+		for _, prefix := range contractPrefixes {
+			if i := strings.Index(line, prefix); i >= 0 {
+				found = strings.TrimSpace(line[i:])
+			}
+		}
+	}
+	return found
+}
+
+// Target builds and runs programs for one backend.
+type Target interface {
+	// Name returns the target name: "rust", "js" or "wasm".
+	Name() string
+	// Available reports whether the toolchain the target needs is installed.
+	Available() bool
+	// Run builds prog in dir and runs it. The error is for build and
+	// toolchain failures; anything the program does is in the Outcome.
+	Run(ctx context.Context, dir string, prog *ir.Program) (Outcome, error)
+}
+
+// TargetNames lists the supported targets.
+var TargetNames = []string{"rust", "js", "wasm"}
+
+// NewTarget returns the target with the given name.
+func NewTarget(name string) (Target, error) {
+	switch name {
+	case "rust":
+		return rustTarget{}, nil
+	case "js":
+		return jsTarget{}, nil
+	case "wasm":
+		return wasmTarget{}, nil
+	}
+	return nil, fmt.Errorf("unknown target: %s", name)
+}
+
+// Result is the outcome of one program on the oracle and on each target.
+type Result struct {
+	Name    string
+	Oracle  Outcome
+	Targets []TargetResult
+}
+
+// TargetResult is the outcome of one program on one target.
+type TargetResult struct {
+	Target  string
+	Outcome Outcome
+	Err     error // build or toolchain failure
+	Skipped bool  // the toolchain is not installed
+}
+
+// Diverged reports whether a target failed to build or disagreed with the
+// oracle.
+func (r *Result) Diverged() bool {
+	for _, t := range r.Targets {
+		if t.Diverged(r.Oracle) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diverged reports whether the target failed to build or disagreed with the
+// oracle.
+func (t TargetResult) Diverged(oracle Outcome) bool {
+	if t.Skipped {
+		return false
+	}
+	return t.Err != nil || !t.Outcome.Equal(oracle)
+}
+
+// Report writes a description of each divergence in r.
+func (r *Result) Report() string {
+	var sb strings.Builder
+	for _, t := range r.Targets {
+		if !t.Diverged(r.Oracle) {
+			continue
+		}
+		if t.Err != nil {
+			fmt.Fprintf(&sb, "  %s: build failed: %v\n", t.Target, t.Err)
+			continue
+		}
+		fmt.Fprintf(&sb, "  %s: %s (interpreter: %s)\n", t.Target, t.Outcome.Summary(), r.Oracle.Summary())
+		if t.Outcome.Stdout != r.Oracle.Stdout {
+			fmt.Fprintf(&sb, "    stdout differs at line %d\n", firstDiff(t.Outcome.Stdout, r.Oracle.Stdout))
+			fmt.Fprintf(&sb, "    %s: %q\n", t.Target, t.Outcome.Stdout)
+			fmt.Fprintf(&sb, "    interpreter: %q\n", r.Oracle.Stdout)
+		}
+	}
+	return sb.String()
+}
+
+// firstDiff returns the 1-based number of the first line where a and b differ.
+func firstDiff(a, b string) int {
+	al, bl := strings.Split(a, "\n"), strings.Split(b, "\n")
+	for i := 0; i < len(al) && i < len(bl); i++ {
+		if al[i] != bl[i] {
+			return i + 1
+		}
+	}
+	return min(len(al), len(bl)) + 1
+}
+
+// Runner compares targets against the interpreter.
+type Runner struct {
+	targets []Target
+	timeout time.Duration
+	dir     string
+}
+
+// NewRunner creates a runner for the named targets. Builds happen in a
+// temporary directory that Close removes.
+func NewRunner(names []string, timeout time.Duration) (*Runner, error) {
+	r := &Runner{timeout: timeout}
+	for _, name := range names {
+		t, err := NewTarget(name)
+		if err != nil {
+			return nil, err
+		}
+		r.targets = append(r.targets, t)
+	}
+	dir, err := os.MkdirTemp("", "intent-conformance-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work dir: %w", err)
+	}
+	r.dir = dir
+	return r, nil
+}
+
+// Unavailable returns the targets whose toolchain is not installed.
+func (r *Runner) Unavailable() []string {
+	var names []string
+	for _, t := range r.targets {
+		if !t.Available() {
+			names = append(names, t.Name())
+		}
+	}
+	return names
+}
+
+// Close removes the runner's work directory.
+func (r *Runner) Close() error {
+	return os.RemoveAll(r.dir)
+}
+
+// Check runs prog on the oracle and on every target.
+func (r *Runner) Check(name string, prog *ir.Program) *Result {
+	res := &Result{Name: name, Oracle: Interpret(prog)}
+	for _, t := range r.targets {
+		tr := TargetResult{Target: t.Name()}
+		if !t.Available() {
+			tr.Skipped = true
+			res.Targets = append(res.Targets, tr)
+			continue
+		}
+		dir := filepath.Join(r.dir, t.Name())
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		tr.Outcome, tr.Err = t.Run(ctx, dir, prog)
+		cancel()
+		res.Targets = append(res.Targets, tr)
+	}
+	return res
+}
+
+// CheckFile lowers a file, with its imports, and checks it.
+func (r *Runner) CheckFile(path string) (*Result, error) {
+	prog, err := compiler.LowerFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return r.Check(path, prog), nil
+}
+
+// CheckProgram lowers a generated program and checks it.
+func (r *Runner) CheckProgram(p Program) (*Result, error) {
+	prog, err := compiler.Lower(p.Source, p.Name)
+	if err != nil {
+		return nil, err
+	}
+	return r.Check(p.Name, prog), nil
+}
+
+// Discover expands paths into the .intent files under them that declare an
+// entry function; library modules are only reached through their importers.
+func Discover(paths []string) ([]string, error) {
+	var files []string
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Ext(path) != ".intent" {
+				return err
+			}
+			source, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			prog := parser.New(string(source)).Parse()
+			for _, fn := range prog.Functions {
+				if fn.IsEntry {
+					files = append(files, path)
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Interpret runs prog with the interpreter.
+func Interpret(prog *ir.Program) Outcome {
+	var out bytes.Buffer
+	code, err := interp.New(prog, &out).Run()
+	o := Outcome{Stdout: out.String(), ExitCode: int(code & 0xff)}
+	var ce *interp.ContractError
+	switch {
+	case errors.As(err, &ce):
+		o.Violation = ce.Message
+	case err != nil:
+		o.Trap = true
+		o.Detail = err.Error()
+	}
+	return o
+}
+
+// execute runs a built program and classifies how it ended.
+func execute(ctx context.Context, name string, args ...string) (Outcome, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return Outcome{}, fmt.Errorf("timed out")
+	}
+	o := Outcome{Stdout: stdout.String()}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		o.ExitCode = exitErr.ExitCode()
+	default:
+		return Outcome{}, err
+	}
+	if v := violation(stderr.String()); v != "" {
+		o.Violation = v
+	} else if strings.TrimSpace(stderr.String()) != "" {
+		o.Trap = true
+		o.Detail = trapMessage(stderr.String())
+	}
+	return o, nil
+}
+
+// trapMessage picks the line of stderr that says what went wrong: the line
+// after Rust's "panicked at", or a JS "...Error: ..." line.
+func trapMessage(stderr string) string {
+	lines := strings.Split(stderr, "\n")
+	for i, line := range lines {
+		if strings.Contains(line, "panicked at") && i+1 < len(lines) {
+			return strings.TrimSpace(lines[i+1])
+		}
+		if strings.Contains(line, "Error: ") {
+			return strings.TrimSpace(line)
+		}
+	}
+	return firstLine(stderr)
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// --- Targets ---
+
+type rustTarget struct{}
+
+func (rustTarget) Name() string { return "rust" }
+
+func (rustTarget) Available() bool {
+	_, err := exec.LookPath("cargo")
+	return err == nil
+}
+
+// Run builds with cargo in a project that is reused between programs, so
+// only main.rs is recompiled each time.
+func (rustTarget) Run(ctx context.Context, dir string, prog *ir.Program) (Outcome, error) {
+	srcDir := filepath.Join(dir, "src")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		return Outcome{}, err
+	}
+	cargoToml := `[package]
+name = "intent_output"
+version = "0.1.0"
+edition = "2021"
+`
+	if err := os.WriteFile(filepath.Join(dir, "Cargo.toml"), []byte(cargoToml), 0644); err != nil {
+		return Outcome{}, err
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "main.rs"), []byte(rustbe.GenerateAll(prog)), 0644); err != nil {
+		return Outcome{}, err
+	}
+	cmd := exec.CommandContext(ctx, "cargo", "build", "--release", "--quiet")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return Outcome{}, fmt.Errorf("cargo build failed: %s", firstError(string(out)))
+	}
+	return execute(ctx, filepath.Join(dir, "target", "release", "intent_output"))
+}
+
+// firstError returns the first rustc error line of a failed build.
+func firstError(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "error") {
+			return line
+		}
+	}
+	return firstLine(out)
+}
+
+type jsTarget struct{}
+
+func (jsTarget) Name() string { return "js" }
+
+func (jsTarget) Available() bool {
+	_, err := exec.LookPath("node")
+	return err == nil
+}
+
+func (jsTarget) Run(ctx context.Context, dir string, prog *ir.Program) (Outcome, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Outcome{}, err
+	}
+	path := filepath.Join(dir, "main.js")
+	if err := os.WriteFile(path, []byte(jsbe.GenerateAll(prog)), 0644); err != nil {
+		return Outcome{}, err
+	}
+	return execute(ctx, "node", path)
+}
+
+type wasmTarget struct{}
+
+func (wasmTarget) Name() string { return "wasm" }
+
+func (wasmTarget) Available() bool {
+	_, err := exec.LookPath("node")
+	return err == nil
+}
+
+func (wasmTarget) Run(ctx context.Context, dir string, prog *ir.Program) (Outcome, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Outcome{}, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.wasm"), wasmbe.GenerateAll(prog), 0644); err != nil {
+		return Outcome{}, err
+	}
+	loader := filepath.Join(dir, "main.loader.js")
+	if err := os.WriteFile(loader, []byte(wasmbe.Loader("main.wasm", wasmbe.EntryName(prog.Modules))), 0644); err != nil {
+		return Outcome{}, err
+	}
+	return execute(ctx, "node", loader)
+}
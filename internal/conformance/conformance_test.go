@@ -0,0 +1,233 @@
+package conformance
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lhaig/intent/internal/compiler"
+)
+
+// knownDivergences lists the examples and targets that currently disagree
+// with the interpreter. Each entry gives the reason and a link to the issue
+// tracking it. A fixed entry fails the test until it is removed here.
+var knownDivergences = map[string]map[string]string{}
+
+// newRunner returns a runner for every target, or for none in -short mode so
+// only the interpreter runs.
+func newRunner(t *testing.T) *Runner {
+	t.Helper()
+	targets := TargetNames
+	if testing.Short() {
+		targets = nil
+	}
+	r, err := NewRunner(targets, 2*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestExamples(t *testing.T) {
+	root := filepath.Join("..", "..", "examples")
+	files, err := Discover([]string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no examples found")
+	}
+
+	r := newRunner(t)
+	for _, file := range files {
+		rel, _ := filepath.Rel(root, file)
+		rel = filepath.ToSlash(rel)
+		t.Run(rel, func(t *testing.T) {
+			res, err := r.CheckFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			known := knownDivergences[rel]
+			for _, tr := range res.Targets {
+				diverged := tr.Diverged(res.Oracle)
+				switch reason, ok := known[tr.Target]; {
+				case ok && !diverged && !tr.Skipped:
+					t.Errorf("%s now conforms (was: %s); remove it from knownDivergences", tr.Target, reason)
+				case !ok && diverged:
+					t.Errorf("%s diverges from the interpreter:\n%s", tr.Target, res.Report())
+				}
+			}
+		})
+	}
+}
+
+func TestCorpus(t *testing.T) {
+	r := newRunner(t)
+	for _, p := range Corpus(1, 20) {
+		t.Run(p.Name, func(t *testing.T) {
+			res, err := r.CheckProgram(p)
+			if err != nil {
+				t.Fatalf("generated program does not compile: %v\n%s", err, p.Source)
+			}
+			if res.Diverged() {
+				t.Errorf("targets diverge:\n%s\n%s", res.Report(), p.Source)
+			}
+		})
+	}
+}
+
+func TestIntegerEdges(t *testing.T) {
+	// Int is i64 everywhere: +, -, * and negation wrap at the boundaries.
+	// The bound passes through a call so rustc cannot reject the overflow
+	// at compile time.
+	src := `module edges version "1.0";
+function id(n: Int) returns Int {
+    return n;
+}
+entry function main() returns Int {
+    let max: Int = id(9223372036854775807);
+    let min: Int = -max - 1;
+    print(max + 1);
+    print(min - 1);
+    print(max * 2);
+    print(-min);
+    print(min * -1);
+    return 0;
+}
+`
+	r := newRunner(t)
+	res, err := r.CheckProgram(Program{Name: "edges", Source: src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-9223372036854775808\n9223372036854775807\n-2\n-9223372036854775808\n-9223372036854775808\n"; res.Oracle.Stdout != want {
+		t.Errorf("interpreter printed %q, want %q", res.Oracle.Stdout, want)
+	}
+	if res.Diverged() {
+		t.Errorf("targets diverge:\n%s", res.Report())
+	}
+}
+
+func TestGenerics(t *testing.T) {
+	// Every instantiation of max checks its postcondition, which refers to
+	// the parameters after the body has returned one of them.
+	src := `module generics version "1.0";
+function max<T: Ord>(a: T, b: T) returns T
+    ensures result >= a and result >= b
+{
+    if a > b { return a; }
+    return b;
+}
+entry function main() returns Int {
+    print(max(3, 7));
+    print(max(2.5, 1.5));
+    print(max("apple", "pear"));
+    return 0;
+}
+`
+	r := newRunner(t)
+	res, err := r.CheckProgram(Program{Name: "generics", Source: src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "7\n2.5\npear\n"; res.Oracle.Stdout != want {
+		t.Errorf("interpreter printed %q, want %q", res.Oracle.Stdout, want)
+	}
+	if res.Diverged() {
+		t.Errorf("targets diverge:\n%s", res.Report())
+	}
+}
+
+func TestCorpusIsDeterministic(t *testing.T) {
+	a, b := Corpus(7, 3), Corpus(7, 3)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("program %d differs between runs with the same seed", i)
+		}
+	}
+	if Corpus(8, 1)[0].Source == a[0].Source {
+		t.Error("different seeds produced the same program")
+	}
+}
+
+func TestCorpusOutcomesVary(t *testing.T) {
+	// The corpus should exercise both normal exits and contract aborts.
+	var exits, violations int
+	for _, p := range Corpus(1, 20) {
+		prog, err := compiler.Lower(p.Source, p.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if Interpret(prog).Violation != "" {
+			violations++
+		} else {
+			exits++
+		}
+	}
+	if exits == 0 || violations == 0 {
+		t.Errorf("expected a mix of outcomes, got %d exits and %d violations", exits, violations)
+	}
+}
+
+func TestOutcomeEqual(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Outcome
+		want bool
+	}{
+		{"same", Outcome{Stdout: "1\n"}, Outcome{Stdout: "1\n"}, true},
+		{"stdout", Outcome{Stdout: "1\n"}, Outcome{Stdout: "2\n"}, false},
+		{"exit code", Outcome{ExitCode: 1}, Outcome{ExitCode: 2}, false},
+		{"violation ignores exit code", Outcome{Violation: "Precondition failed: x", ExitCode: 101}, Outcome{Violation: "Precondition failed: x", ExitCode: 1}, true},
+		{"violation message", Outcome{Violation: "Precondition failed: x"}, Outcome{Violation: "Postcondition failed: x"}, false},
+		{"trap ignores message", Outcome{Trap: true, Detail: "a"}, Outcome{Trap: true, Detail: "b"}, true},
+		{"trap vs exit", Outcome{Trap: true}, Outcome{}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Equal(tt.b); got != tt.want {
+			t.Errorf("%s: Equal = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestViolationParsing(t *testing.T) {
+	tests := []struct {
+		name, stderr, want string
+	}{
+		{"rust", "thread 'main' panicked at src/main.rs:4:9:\nPrecondition failed: x > 0\nnote: run with `RUST_BACKTRACE=1`\n", "Precondition failed: x > 0"},
+		{"node", "/tmp/main.js:3\n  if (!((x > 0))) throw new Error(\"Precondition failed: x > 0\");\n  ^\n\nError: Precondition failed: x > 0\n    at f (/tmp/main.js:3:25)\n", "Precondition failed: x > 0"},
+		{"wasm loader", "Invariant failed: self . n >= 0\n", "Invariant failed: self . n >= 0"},
+		{"trap", "thread 'main' panicked at src/main.rs:4:9:\nattempt to divide by zero\n", ""},
+	}
+	for _, tt := range tests {
+		if got := violation(tt.stderr); got != tt.want {
+			t.Errorf("%s: violation = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := trapMessage("thread 'main' panicked at src/main.rs:4:9:\nattempt to divide by zero\n"); got != "attempt to divide by zero" {
+		t.Errorf("trapMessage = %q", got)
+	}
+}
+
+func TestReport(t *testing.T) {
+	res := &Result{
+		Oracle: Outcome{Stdout: "1\n2\n"},
+		Targets: []TargetResult{
+			{Target: "rust", Outcome: Outcome{Stdout: "1\n2\n"}},
+			{Target: "js", Outcome: Outcome{Stdout: "1\n3\n"}},
+			{Target: "wasm", Skipped: true},
+		},
+	}
+	if !res.Diverged() {
+		t.Fatal("expected a divergence")
+	}
+	report := res.Report()
+	if !strings.Contains(report, "js: exit 0") || !strings.Contains(report, "line 2") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+	if strings.Contains(report, "rust") || strings.Contains(report, "wasm") {
+		t.Errorf("report should only list diverging targets:\n%s", report)
+	}
+}
@@ -0,0 +1,212 @@
+package conformance
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Program is a named Intent source file.
+type Program struct {
+	Name   string
+	Source string
+}
+
+// Corpus generates n programs from seed. The same seed always yields the
+// same programs. They mix arithmetic, loops with invariants and decreases,
+// entities with invariants and old(), arrays, enums, Option and string
+// interpolation; some are generated to violate a contract partway through so
+// that abort behavior is compared as well as output.
+func Corpus(seed int64, n int) []Program {
+	r := rand.New(rand.NewSource(seed))
+	progs := make([]Program, n)
+	for i := range progs {
+		g := &gen{r: r}
+		name := fmt.Sprintf("gen_%d_%d", seed, i)
+		progs[i] = Program{Name: name, Source: g.program(name)}
+	}
+	return progs
+}
+
+// gen writes one random program.
+type gen struct {
+	r  *rand.Rand
+	sb strings.Builder
+}
+
+func (g *gen) line(format string, args ...any) {
+	fmt.Fprintf(&g.sb, format, args...)
+	g.sb.WriteString("\n")
+}
+
+// intOps are the integer operators the generator uses. Values stay small
+// enough that no target overflows.
+var intOps = []string{"+", "-", "*", "/", "%"}
+
+// expr returns an Int expression over vars with the given nesting depth.
+// Divisors are kept positive and non-zero.
+func (g *gen) expr(vars []string, depth int) string {
+	if depth == 0 || g.r.Intn(3) == 0 {
+		if len(vars) > 0 && g.r.Intn(3) > 0 {
+			return vars[g.r.Intn(len(vars))]
+		}
+		return fmt.Sprint(g.r.Intn(10))
+	}
+	op := intOps[g.r.Intn(len(intOps))]
+	left := g.expr(vars, depth-1)
+	right := g.expr(vars, depth-1)
+	if op == "/" || op == "%" {
+		right = fmt.Sprintf("(%s * %s + %d)", right, right, 1+g.r.Intn(5))
+	}
+	return fmt.Sprintf("(%s %s %s)", left, op, right)
+}
+
+// cond returns a Bool expression over vars.
+func (g *gen) cond(vars []string) string {
+	cmps := []string{"<", "<=", ">", ">=", "==", "!="}
+	c := fmt.Sprintf("%s %s %s", g.expr(vars, 1), cmps[g.r.Intn(len(cmps))], g.expr(vars, 1))
+	switch g.r.Intn(4) {
+	case 0:
+		return fmt.Sprintf("%s and %s", c, g.cond(vars[:1]))
+	case 1:
+		return "not (" + c + ")"
+	}
+	return c
+}
+
+func (g *gen) program(name string) string {
+	g.line("module %s version \"0.1.0\";", name)
+	g.line("")
+
+	g.line("enum Shape {")
+	g.line("    Square(side: Int),")
+	g.line("    Rect(w: Int, h: Int),")
+	g.line("    Dot,")
+	g.line("}")
+	g.line("")
+
+	g.line("entity Tally {")
+	g.line("    field total: Int;")
+	g.line("    field count: Int;")
+	g.line("")
+	g.line("    invariant self.count >= 0;")
+	g.line("")
+	g.line("    constructor(start: Int)")
+	g.line("        requires start >= 0")
+	g.line("    {")
+	g.line("        self.total = start;")
+	g.line("        self.count = 0;")
+	g.line("    }")
+	g.line("")
+	g.line("    method add(n: Int) returns Int")
+	g.line("        requires n >= %d", -g.r.Intn(12))
+	g.line("        ensures self.total == old(self.total) + n")
+	g.line("        ensures self.count == old(self.count) + 1")
+	g.line("    {")
+	g.line("        self.total = self.total + n;")
+	g.line("        self.count = self.count + 1;")
+	g.line("        return self.total;")
+	g.line("    }")
+	g.line("}")
+	g.line("")
+
+	nfuncs := 1 + g.r.Intn(3)
+	for i := 0; i < nfuncs; i++ {
+		g.function(i)
+	}
+
+	g.line("function area(s: Shape) returns Int {")
+	g.line("    return match s {")
+	g.line("        Square(x) => x * x,")
+	g.line("        Rect(w, h) => w * h,")
+	g.line("        Dot => 0,")
+	g.line("    };")
+	g.line("}")
+	g.line("")
+
+	g.line("function first_over(xs: Array<Int>, limit: Int) returns Option<Int> {")
+	g.line("    for i in 0..len(xs) {")
+	g.line("        if xs[i] > limit {")
+	g.line("            return Some(xs[i]);")
+	g.line("        }")
+	g.line("    }")
+	g.line("    return None;")
+	g.line("}")
+	g.line("")
+
+	g.main(nfuncs)
+	return g.sb.String()
+}
+
+// function writes f<i>(a, b), a loop with a contract-checked accumulator.
+func (g *gen) function(i int) {
+	vars := []string{"a", "b"}
+	bound := 1 + g.r.Intn(8)
+	g.line("function f%d(a: Int, b: Int) returns Int", i)
+	g.line("    requires a >= 0 and b >= 0")
+	if g.r.Intn(4) == 0 {
+		// Sometimes false, so some programs end in a postcondition failure.
+		g.line("    ensures result %s %d", []string{">=", "<=", "!="}[g.r.Intn(3)], g.r.Intn(50))
+	}
+	g.line("{")
+	g.line("    let mutable acc: Int = %s;", g.expr(vars, 2))
+	g.line("    let mutable i: Int = 0;")
+	g.line("    while i < %d", bound)
+	g.line("        invariant i >= 0 and i <= %d", bound)
+	g.line("        decreases %d - i", bound)
+	g.line("    {")
+	g.line("        if %s {", g.cond([]string{"i", "acc", "a"}))
+	g.line("            acc = acc + %s;", g.expr([]string{"i", "a", "b"}, 2))
+	g.line("        } else {")
+	g.line("            acc = acc - %s;", g.expr([]string{"i", "b"}, 1))
+	g.line("        }")
+	g.line("        i = i + 1;")
+	g.line("    }")
+	if g.r.Intn(2) == 0 {
+		g.line("    if acc < 0 {")
+		g.line("        return 0 - acc;")
+		g.line("    }")
+	}
+	g.line("    return acc;")
+	g.line("}")
+	g.line("")
+}
+
+// main prints a mix of values and returns a small exit code.
+func (g *gen) main(nfuncs int) {
+	g.line("entry function main() returns Int {")
+	g.line("    let mutable xs: Array<Int> = [%d, %d];", g.r.Intn(10), g.r.Intn(10))
+	for i := 0; i < nfuncs; i++ {
+		a, b := g.r.Intn(10), g.r.Intn(10)
+		g.line("    let r%d: Int = f%d(%d, %d);", i, i, a, b)
+		g.line("    print(r%d);", i)
+		g.line("    xs.push(r%d);", i)
+	}
+
+	g.line("    let t: Tally = Tally(%d);", g.r.Intn(5))
+	g.line("    for x in xs {")
+	g.line("        t.add(x %% 10);")
+	g.line("    }")
+	g.line("    print(\"total {t.total} over {t.count}\");")
+	g.line("    print(len(xs));")
+	g.line("    print(%s);", g.cond([]string{"t.total", "len(xs)"}))
+
+	g.line("    let sq: Shape = Square(%d);", g.r.Intn(9))
+	g.line("    let sum: Int = area(sq) + area(Rect(%d, %d)) + area(Dot);", g.r.Intn(9), g.r.Intn(9))
+	g.line("    print(sum);")
+
+	g.line("    let found: Option<Int> = first_over(xs, %d);", g.r.Intn(20))
+	g.line("    let shown: Int = match found {")
+	g.line("        Some(v) => v,")
+	g.line("        None => -1,")
+	g.line("    };")
+	g.line("    print(shown);")
+	g.line("    print(%d.5 * 2.0);", g.r.Intn(10))
+
+	if g.r.Intn(5) == 0 {
+		// A negative argument violates f0's precondition.
+		g.line("    print(f0(-1, 0));")
+	}
+	g.line("    return sum %% %d;", 2+g.r.Intn(50))
+	g.line("}")
+}
@@ -1,6 +1,7 @@
 package formatter
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 
@@ -9,14 +10,26 @@ import (
 )
 
 // Format takes an AST Program and returns canonical Intent source code.
+// Comments attached to the AST are re-emitted above or after the node they
+// belong to.
 func Format(prog *ast.Program) string {
 	f := &formatter{}
 	f.formatProgram(prog)
 	return f.sb.String()
 }
 
+// FormatExpr returns the canonical source text of a single expression.
+func FormatExpr(e ast.Expression) string {
+	return (&formatter{}).formatExpr(e)
+}
+
+// FormatType returns the canonical source text of a type reference.
+func FormatType(t *ast.TypeRef) string {
+	return (&formatter{}).formatTypeRef(t)
+}
+
 type formatter struct {
-	sb     strings.Builder
+	sb     bytes.Buffer
 	indent int
 }
 
@@ -57,36 +70,132 @@ func (f *formatter) blankLine() {
 	f.sb.WriteString("\n")
 }
 
+// --- comments ---
+
+// leading emits comments on their own lines at the current indentation.
+func (f *formatter) leading(comments []string) {
+	for _, c := range comments {
+		f.emitComment(c)
+	}
+}
+
+// emitComment emits one comment on its own lines.
+func (f *formatter) emitComment(text string) {
+	for _, line := range commentLines(text) {
+		f.emitLine(line)
+	}
+}
+
+// commentLines splits a comment into lines. Continuation lines of a block
+// comment lose the indentation they share and keep the rest. When they all
+// start with '*', the stars are aligned under the opening "/*".
+func commentLines(text string) []string {
+	lines := strings.Split(text, "\n")
+	rest := lines[1:]
+	prefix := ""
+	first := true
+	stars := true
+	for _, line := range rest {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		indent := line[:len(line)-len(trimmed)]
+		if first {
+			prefix, first = indent, false
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+		if !strings.HasPrefix(trimmed, "*") {
+			stars = false
+		}
+	}
+	for i, line := range rest {
+		line = strings.TrimRight(strings.TrimPrefix(line, prefix), " \t")
+		if stars && line != "" {
+			line = " " + strings.TrimLeft(line, " \t")
+		}
+		rest[i] = line
+	}
+	return lines
+}
+
+// inlineComment reports whether a comment can share a line with the code
+// after it: a block comment on one line.
+func inlineComment(text string) bool {
+	return strings.HasPrefix(text, "/*") && !strings.Contains(text, "\n")
+}
+
+// leadingString renders comments on their own lines at the current
+// indentation, for output that is built up as a string.
+func (f *formatter) leadingString(comments []string) string {
+	var buf strings.Builder
+	for _, c := range comments {
+		for _, line := range commentLines(c) {
+			buf.WriteString(f.indentStr() + line + "\n")
+		}
+	}
+	return buf.String()
+}
+
+// trailing appends a comment to the end of the line just written.
+func (f *formatter) trailing(comment string) {
+	if comment == "" {
+		return
+	}
+	if n := f.sb.Len(); n > 0 && f.sb.Bytes()[n-1] == '\n' {
+		f.sb.Truncate(n - 1)
+	}
+	f.sb.WriteString(" " + comment + "\n")
+}
+
+// comments wraps a node's output in its leading and trailing comments.
+func (f *formatter) comments(c ast.Comments, format func()) {
+	f.leading(c.Leading)
+	format()
+	f.trailing(c.Trailing)
+}
+
 // --- program-level ---
 
 func (f *formatter) formatProgram(prog *ast.Program) {
 	if prog.Module != nil {
-		f.formatModuleDecl(prog.Module)
+		f.comments(prog.Module.Comments, func() { f.formatModuleDecl(prog.Module) })
 	}
 
 	if len(prog.Imports) > 0 {
 		f.blankLine()
 		for _, imp := range prog.Imports {
-			f.formatImportDecl(imp)
+			f.comments(imp.Comments, func() { f.formatImportDecl(imp) })
 		}
 	}
 
-	// Emit declarations in canonical order: enums, entities, functions, intents
+	// Emit declarations in canonical order: enums, traits, entities, functions, intents
 	for _, e := range prog.Enums {
 		f.blankLine()
-		f.formatEnumDecl(e)
+		f.comments(e.Comments, func() { f.formatEnumDecl(e) })
+	}
+	for _, t := range prog.Traits {
+		f.blankLine()
+		f.comments(t.Comments, func() { f.formatTraitDecl(t) })
 	}
 	for _, e := range prog.Entities {
 		f.blankLine()
-		f.formatEntityDecl(e)
+		f.comments(e.Comments, func() { f.formatEntityDecl(e) })
 	}
 	for _, fn := range prog.Functions {
 		f.blankLine()
-		f.formatFunctionDecl(fn)
+		f.comments(fn.Comments, func() { f.formatFunctionDecl(fn) })
 	}
 	for _, i := range prog.Intents {
 		f.blankLine()
-		f.formatIntentDecl(i)
+		f.comments(i.Comments, func() { f.formatIntentDecl(i) })
+	}
+
+	if len(prog.EndComments) > 0 {
+		f.blankLine()
+		f.leading(prog.EndComments)
 	}
 
 	// Trailing newline
@@ -109,9 +218,11 @@ func (f *formatter) formatEnumDecl(e *ast.EnumDecl) {
 	} else {
 		f.emit(f.indentStr())
 	}
-	f.emitf("enum %s {\n", e.Name)
+	f.emitf("enum %s%s {\n", e.Name, formatTypeParams(e.TypeParams))
+	f.trailing(e.BraceComment)
 	f.incIndent()
 	for _, v := range e.Variants {
+		f.leading(v.Comments.Leading)
 		if len(v.Fields) == 0 {
 			f.emitLinef("%s,", v.Name)
 		} else {
@@ -125,23 +236,86 @@ func (f *formatter) formatEnumDecl(e *ast.EnumDecl) {
 			}
 			f.emit("),\n")
 		}
+		f.trailing(v.Comments.Trailing)
 	}
+	f.leading(e.EndComments)
 	f.decIndent()
 	f.emitLine("}")
 }
 
+func (f *formatter) formatTraitDecl(t *ast.TraitDecl) {
+	if t.IsPublic {
+		f.emit(f.indentStr() + "public ")
+	} else {
+		f.emit(f.indentStr())
+	}
+	f.emitf("trait %s {\n", t.Name)
+	f.trailing(t.BraceComment)
+	f.incIndent()
+	for i, m := range t.Methods {
+		if i > 0 {
+			f.blankLine()
+		}
+		f.comments(m.Comments, func() { f.formatMethodSignature(m) })
+	}
+	if len(t.EndComments) > 0 {
+		f.blankLine()
+		f.leading(t.EndComments)
+	}
+	f.decIndent()
+	f.emitLine("}")
+}
+
+// formatMethodSignature emits a trait method: its signature and contracts,
+// terminated by a semicolon
+func (f *formatter) formatMethodSignature(m *ast.MethodDecl) {
+	f.emit(f.indentStr())
+	f.emitf("method %s", m.Name)
+	f.formatParams(m.Params)
+	f.emitf(" returns %s", f.formatTypeRef(m.ReturnType))
+
+	clauses := append(append([]*ast.ContractClause{}, m.Requires...), m.Ensures...)
+	if len(clauses) == 0 {
+		f.emit(";\n")
+		return
+	}
+	f.emit("\n")
+	f.incIndent()
+	f.formatContracts("requires", m.Requires)
+	f.formatContracts("ensures", m.Ensures)
+	if clauses[len(clauses)-1].Comments.Trailing != "" {
+		f.emitLine(";")
+	} else {
+		f.sb.Truncate(f.sb.Len() - 1)
+		f.emit(";\n")
+	}
+	f.decIndent()
+}
+
 func (f *formatter) formatEntityDecl(e *ast.EntityDecl) {
 	if e.IsPublic {
 		f.emit(f.indentStr() + "public ")
 	} else {
 		f.emit(f.indentStr())
 	}
-	f.emitf("entity %s {\n", e.Name)
+	f.emitf("entity %s%s", e.Name, formatTypeParams(e.TypeParams))
+	for i, t := range e.Implements {
+		if i == 0 {
+			f.emit(" implements ")
+		} else {
+			f.emit(", ")
+		}
+		f.emit(t.Name)
+	}
+	f.emit(" {\n")
+	f.trailing(e.BraceComment)
 	f.incIndent()
 
 	// Fields
 	for _, field := range e.Fields {
-		f.emitLinef("field %s: %s;", field.Name, f.formatTypeRef(field.Type))
+		f.comments(field.Comments, func() {
+			f.emitLinef("field %s: %s;", field.Name, f.formatTypeRef(field.Type))
+		})
 	}
 
 	// Invariants (blank line before if there were fields)
@@ -149,19 +323,26 @@ func (f *formatter) formatEntityDecl(e *ast.EntityDecl) {
 		f.blankLine()
 	}
 	for _, inv := range e.Invariants {
-		f.emitLinef("invariant %s;", f.formatExpr(inv.Expr))
+		f.comments(inv.Comments, func() {
+			f.emitLinef("%sinvariant %s;", annotations(inv.AlwaysCheck), f.formatExpr(inv.Expr))
+		})
 	}
 
 	// Constructor (blank line before)
 	if e.Constructor != nil {
 		f.blankLine()
-		f.formatConstructorDecl(e.Constructor)
+		f.comments(e.Constructor.Comments, func() { f.formatConstructorDecl(e.Constructor) })
 	}
 
 	// Methods (blank line before each)
 	for _, m := range e.Methods {
 		f.blankLine()
-		f.formatMethodDecl(m)
+		f.comments(m.Comments, func() { f.formatMethodDecl(m) })
+	}
+
+	if len(e.EndComments) > 0 {
+		f.blankLine()
+		f.leading(e.EndComments)
 	}
 
 	f.decIndent()
@@ -170,25 +351,15 @@ func (f *formatter) formatEntityDecl(e *ast.EntityDecl) {
 
 func (f *formatter) formatConstructorDecl(c *ast.ConstructorDecl) {
 	f.emit(f.indentStr())
-	f.emit("constructor(")
-	for i, p := range c.Params {
-		if i > 0 {
-			f.emit(", ")
-		}
-		f.emitf("%s: %s", p.Name, f.formatTypeRef(p.Type))
-	}
-	f.emit(")")
+	f.emit("constructor")
+	f.formatParams(c.Params)
 
 	hasContracts := len(c.Requires) > 0 || len(c.Ensures) > 0
 	if hasContracts {
 		f.emit("\n")
 		f.incIndent()
-		for _, req := range c.Requires {
-			f.emitLinef("requires %s", f.formatExpr(req.Expr))
-		}
-		for _, ens := range c.Ensures {
-			f.emitLinef("ensures %s", f.formatExpr(ens.Expr))
-		}
+		f.formatContracts("requires", c.Requires)
+		f.formatContracts("ensures", c.Ensures)
 		f.decIndent()
 		f.emitLine("{")
 	} else {
@@ -202,25 +373,16 @@ func (f *formatter) formatConstructorDecl(c *ast.ConstructorDecl) {
 
 func (f *formatter) formatMethodDecl(m *ast.MethodDecl) {
 	f.emit(f.indentStr())
-	f.emitf("method %s(", m.Name)
-	for i, p := range m.Params {
-		if i > 0 {
-			f.emit(", ")
-		}
-		f.emitf("%s: %s", p.Name, f.formatTypeRef(p.Type))
-	}
-	f.emitf(") returns %s", f.formatTypeRef(m.ReturnType))
+	f.emitf("method %s", m.Name)
+	f.formatParams(m.Params)
+	f.emitf(" returns %s", f.formatTypeRef(m.ReturnType))
 
 	hasContracts := len(m.Requires) > 0 || len(m.Ensures) > 0
 	if hasContracts {
 		f.emit("\n")
 		f.incIndent()
-		for _, req := range m.Requires {
-			f.emitLinef("requires %s", f.formatExpr(req.Expr))
-		}
-		for _, ens := range m.Ensures {
-			f.emitLinef("ensures %s", f.formatExpr(ens.Expr))
-		}
+		f.formatContracts("requires", m.Requires)
+		f.formatContracts("ensures", m.Ensures)
 		f.decIndent()
 		f.emitLine("{")
 	} else {
@@ -240,25 +402,16 @@ func (f *formatter) formatFunctionDecl(fn *ast.FunctionDecl) {
 	if fn.IsEntry {
 		f.emit("entry ")
 	}
-	f.emitf("function %s(", fn.Name)
-	for i, p := range fn.Params {
-		if i > 0 {
-			f.emit(", ")
-		}
-		f.emitf("%s: %s", p.Name, f.formatTypeRef(p.Type))
-	}
-	f.emitf(") returns %s", f.formatTypeRef(fn.ReturnType))
+	f.emitf("function %s%s", fn.Name, formatTypeParams(fn.TypeParams))
+	f.formatParams(fn.Params)
+	f.emitf(" returns %s", f.formatTypeRef(fn.ReturnType))
 
 	hasContracts := len(fn.Requires) > 0 || len(fn.Ensures) > 0
 	if hasContracts {
 		f.emit("\n")
 		f.incIndent()
-		for _, req := range fn.Requires {
-			f.emitLinef("requires %s", f.formatExpr(req.Expr))
-		}
-		for _, ens := range fn.Ensures {
-			f.emitLinef("ensures %s", f.formatExpr(ens.Expr))
-		}
+		f.formatContracts("requires", fn.Requires)
+		f.formatContracts("ensures", fn.Ensures)
 		f.decIndent()
 	}
 
@@ -275,8 +428,71 @@ func (f *formatter) formatFunctionDecl(fn *ast.FunctionDecl) {
 	}
 }
 
+// formatParams emits a parenthesized parameter list. One-line block comments
+// in front of a parameter stay inline; with any other comment, parameters are
+// laid out one per line so that each keeps its comments.
+func (f *formatter) formatParams(params []*ast.Param) {
+	commented := false
+	for _, p := range params {
+		for _, c := range p.Comments.Leading {
+			if !inlineComment(c) {
+				commented = true
+			}
+		}
+		if p.Comments.Trailing != "" {
+			commented = true
+		}
+	}
+	if !commented {
+		f.emit("(")
+		for i, p := range params {
+			if i > 0 {
+				f.emit(", ")
+			}
+			for _, c := range p.Comments.Leading {
+				f.emit(c + " ")
+			}
+			f.emitf("%s: %s", p.Name, f.formatTypeRef(p.Type))
+		}
+		f.emit(")")
+		return
+	}
+
+	f.emit("(\n")
+	f.incIndent()
+	for i, p := range params {
+		f.comments(p.Comments, func() {
+			sep := ","
+			if i == len(params)-1 {
+				sep = ""
+			}
+			f.emitLinef("%s: %s%s", p.Name, f.formatTypeRef(p.Type), sep)
+		})
+	}
+	f.decIndent()
+	f.emit(f.indentStr() + ")")
+}
+
+// formatContracts emits one line per requires/ensures/invariant clause.
+func (f *formatter) formatContracts(keyword string, clauses []*ast.ContractClause) {
+	for _, c := range clauses {
+		f.comments(c.Comments, func() {
+			f.emitLinef("%s%s %s", annotations(c.AlwaysCheck), keyword, f.formatExpr(c.Expr))
+		})
+	}
+}
+
+// annotations returns the annotations that prefix a contract clause.
+func annotations(alwaysCheck bool) string {
+	if alwaysCheck {
+		return "@always_check "
+	}
+	return ""
+}
+
 func (f *formatter) formatIntentDecl(i *ast.IntentDecl) {
 	f.emitLinef("intent \"%s\" {", i.Description)
+	f.trailing(i.BraceComment)
 	f.incIndent()
 	for _, g := range i.Goals {
 		f.emitLinef("goal: \"%s\";", g)
@@ -294,6 +510,7 @@ func (f *formatter) formatIntentDecl(i *ast.IntentDecl) {
 		}
 		f.emitLinef("verified_by: [%s];", strings.Join(refs, ", "))
 	}
+	f.leading(i.EndComments)
 	f.decIndent()
 	f.emitLine("}")
 }
@@ -304,12 +521,22 @@ func (f *formatter) formatBlock(b *ast.Block) {
 	if b == nil {
 		return
 	}
+	f.trailing(b.BraceComment)
 	for _, stmt := range b.Statements {
 		f.formatStmt(stmt)
 	}
+	f.leading(b.EndComments)
 }
 
 func (f *formatter) formatStmt(s ast.Statement) {
+	if c := ast.StatementComments(s); c != nil {
+		f.comments(*c, func() { f.formatStmtKind(s) })
+		return
+	}
+	f.formatStmtKind(s)
+}
+
+func (f *formatter) formatStmtKind(s ast.Statement) {
 	switch stmt := s.(type) {
 	case *ast.LetStmt:
 		f.emit(f.indentStr())
@@ -336,7 +563,11 @@ func (f *formatter) formatStmt(s ast.Statement) {
 		f.formatWhileStmt(stmt)
 
 	case *ast.ForInStmt:
-		f.emitLinef("for %s in %s {", stmt.Variable, f.formatExpr(stmt.Iterable))
+		vars := stmt.Variable
+		if stmt.ValueVariable != "" {
+			vars += ", " + stmt.ValueVariable
+		}
+		f.emitLinef("for %s in %s {", vars, f.formatExpr(stmt.Iterable))
 		f.incIndent()
 		f.formatBlock(stmt.Body)
 		f.decIndent()
@@ -387,11 +618,11 @@ func (f *formatter) formatWhileStmt(stmt *ast.WhileStmt) {
 	if hasContracts {
 		f.emitLinef("while %s", f.formatExpr(stmt.Condition))
 		f.incIndent()
-		for _, inv := range stmt.Invariants {
-			f.emitLinef("invariant %s", f.formatExpr(inv.Expr))
-		}
-		if stmt.Decreases != nil {
-			f.emitLinef("decreases %s", f.formatExpr(stmt.Decreases.Expr))
+		f.formatContracts("invariant", stmt.Invariants)
+		if d := stmt.Decreases; d != nil {
+			f.comments(d.Comments, func() {
+				f.emitLinef("decreases %s", f.formatExpr(d.Expr))
+			})
 		}
 		f.decIndent()
 		f.emitLine("{")
@@ -410,8 +641,29 @@ func (f *formatter) formatExpr(e ast.Expression) string {
 	return f.formatExprPrec(e, 0)
 }
 
-// formatExprPrec formats an expression, wrapping in parens if needed based on parent precedence.
+// formatExprPrec formats an expression along with the comments in front of
+// it. A one-line block comment stays on the expression's line; any other
+// comment ends its line and the expression continues on the next.
 func (f *formatter) formatExprPrec(e ast.Expression, parentPrec int) string {
+	s := f.formatExprKind(e, parentPrec)
+	c := ast.ExpressionComments(e)
+	if c == nil || len(*c) == 0 {
+		return s
+	}
+	cont := "\n" + f.indentStr() + "    "
+	var buf strings.Builder
+	for _, comment := range *c {
+		if inlineComment(comment) {
+			buf.WriteString(comment + " ")
+			continue
+		}
+		buf.WriteString(strings.Join(commentLines(comment), cont) + cont)
+	}
+	return buf.String() + s
+}
+
+// formatExprKind formats an expression, wrapping in parens if needed based on parent precedence.
+func (f *formatter) formatExprKind(e ast.Expression, parentPrec int) string {
 	switch expr := e.(type) {
 	case *ast.BinaryExpr:
 		prec := precedence(expr.Op)
@@ -511,12 +763,12 @@ func (f *formatter) formatExprPrec(e ast.Expression, parentPrec int) string {
 		return fmt.Sprintf("%s..%s", f.formatExprPrec(expr.Start, 10), f.formatExprPrec(expr.End, 10))
 
 	case *ast.ForallExpr:
-		domain := fmt.Sprintf("%s..%s", f.formatExpr(expr.Domain.Start), f.formatExpr(expr.Domain.End))
+		domain := f.formatDomain(expr.Domain, expr.Map)
 		body := f.formatExpr(expr.Body)
 		return fmt.Sprintf("forall %s in %s: %s", expr.Variable, domain, body)
 
 	case *ast.ExistsExpr:
-		domain := fmt.Sprintf("%s..%s", f.formatExpr(expr.Domain.Start), f.formatExpr(expr.Domain.End))
+		domain := f.formatDomain(expr.Domain, expr.Map)
 		body := f.formatExpr(expr.Body)
 		return fmt.Sprintf("exists %s in %s: %s", expr.Variable, domain, body)
 
@@ -536,6 +788,14 @@ func (f *formatter) formatExprPrec(e ast.Expression, parentPrec int) string {
 	}
 }
 
+// formatDomain formats the domain of a quantifier: a range or a map
+func (f *formatter) formatDomain(domain *ast.RangeExpr, m ast.Expression) string {
+	if m != nil {
+		return f.formatExpr(m)
+	}
+	return fmt.Sprintf("%s..%s", f.formatExpr(domain.Start), f.formatExpr(domain.End))
+}
+
 func (f *formatter) formatMatchExpr(expr *ast.MatchExpr) string {
 	var buf strings.Builder
 	buf.WriteString("match ")
@@ -544,12 +804,18 @@ func (f *formatter) formatMatchExpr(expr *ast.MatchExpr) string {
 
 	f.incIndent()
 	for _, arm := range expr.Arms {
+		buf.WriteString(f.leadingString(arm.Comments.Leading))
 		buf.WriteString(f.indentStr())
 		buf.WriteString(f.formatMatchPattern(arm.Pattern))
 		buf.WriteString(" => ")
 		buf.WriteString(f.formatExpr(arm.Body))
-		buf.WriteString(",\n")
+		buf.WriteString(",")
+		if arm.Comments.Trailing != "" {
+			buf.WriteString(" " + arm.Comments.Trailing)
+		}
+		buf.WriteString("\n")
 	}
+	buf.WriteString(f.leadingString(expr.EndComments))
 	f.decIndent()
 
 	buf.WriteString(f.indentStr())
@@ -583,6 +849,22 @@ func (f *formatter) formatTypeRef(t *ast.TypeRef) string {
 	return fmt.Sprintf("%s<%s>", t.Name, strings.Join(args, ", "))
 }
 
+// formatTypeParams renders the type parameters of a generic declaration,
+// e.g. "<T: Ord>", or "" when there are none.
+func formatTypeParams(params []*ast.TypeParam) string {
+	if len(params) == 0 {
+		return ""
+	}
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.Name
+		if p.Bound != "" {
+			parts[i] += ": " + p.Bound
+		}
+	}
+	return "<" + strings.Join(parts, ", ") + ">"
+}
+
 // --- operator precedence ---
 
 // Precedence levels (higher binds tighter):
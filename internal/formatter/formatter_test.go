@@ -476,6 +476,181 @@ entry function main() returns Int {
 	}
 }
 
+func TestFormatPreservesComments(t *testing.T) {
+	src := `// header
+module test version "1.0";
+enum Color {
+  Red, // warm
+  // cool
+  Blue,
+}
+entry function main() returns Int
+  // positive
+  requires true
+{
+  let x: Int = 1; // one
+  while x < 3
+    invariant x >= 1 // inv
+  {
+    x = x + 1;
+  }
+  return x;
+  // unreachable
+}
+// trailer
+`
+	want := `// header
+module test version "1.0";
+
+enum Color {
+    Red, // warm
+    // cool
+    Blue,
+}
+
+entry function main() returns Int
+    // positive
+    requires true
+{
+    let x: Int = 1; // one
+    while x < 3
+        invariant x >= 1 // inv
+    {
+        x = x + 1;
+    }
+    return x;
+    // unreachable
+}
+
+// trailer
+
+`
+	if got := formatSource(t, src); got != want {
+		t.Errorf("comments not preserved:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatBlockCommentReindented(t *testing.T) {
+	src := `module test version "1.0";
+entry function main() returns Int {
+        /* first
+              * second
+              */
+    return 0;
+}
+`
+	got := formatSource(t, src)
+	want := "    /* first\n     * second\n     */\n    return 0;"
+	if !strings.Contains(got, want) {
+		t.Errorf("expected re-indented block comment, got:\n%s", got)
+	}
+}
+
+func TestFormatBlockCommentKeepsIndentation(t *testing.T) {
+	src := `module test version "1.0";
+entry function main() returns Int {
+        /* steps:
+             1. load
+                  a. parse
+             2. run
+         */
+    return 0;
+}
+`
+	got := formatSource(t, src)
+	want := "    /* steps:\n        1. load\n             a. parse\n        2. run\n    */\n    return 0;"
+	if !strings.Contains(got, want) {
+		t.Errorf("expected relative indentation kept, got:\n%s", got)
+	}
+	if second := formatSource(t, got); second != got {
+		t.Errorf("format is not idempotent:\nfirst:\n%s\nsecond:\n%s", got, second)
+	}
+}
+
+func TestFormatKeepsNestedComments(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"params", `module test version "1.0";
+function pick(a: Int, // first
+  // second
+  b: Int) returns Int {
+  return a;
+}
+`, `function pick(
+    a: Int, // first
+    // second
+    b: Int
+) returns Int {
+    return a;
+}
+`},
+		{"param_block_comment", `module test version "1.0";
+function pick(a: Int, /* c */ b: Int) returns Int {
+  return a;
+}
+`, `function pick(a: Int, /* c */ b: Int) returns Int {
+    return a;
+}
+`},
+		{"signature", `module test version "1.0";
+function pick(a: Int) returns Int // after sig
+{
+  return a;
+}
+`, `function pick(a: Int) returns Int { // after sig
+    return a;
+}
+`},
+		{"expressions", `module test version "1.0";
+function sum(a: Int, b: Int) returns Int
+  requires a > 0 and /* small */ a < 10
+{
+  return max(a + // partial
+    b, b);
+}
+`, `function sum(a: Int, b: Int) returns Int
+    requires a > 0 and /* small */ a < 10
+{
+    return max(a + // partial
+        b, b);
+}
+`},
+		{"match_arms", `module test version "1.0";
+function get(o: Option<Int>) returns Int {
+  let v: Int = match o {
+    // present
+    Some(x) => x, // use it
+    None => 0
+    // no more
+  };
+  return v;
+}
+`, `    let v: Int = match o {
+        // present
+        Some(x) => x, // use it
+        None => 0,
+        // no more
+    };
+    return v;
+`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			first := formatSource(t, tc.src)
+			if !strings.Contains(first, tc.want) {
+				t.Errorf("comments moved:\ngot:\n%s\nwant:\n%s", first, tc.want)
+			}
+			if second := formatSource(t, first); second != first {
+				t.Errorf("format is not idempotent:\nfirst:\n%s\nsecond:\n%s", first, second)
+			}
+		})
+	}
+}
+
 // --- Idempotency tests ---
 
 func TestIdempotency(t *testing.T) {
@@ -521,6 +696,23 @@ entry function main() returns Int {
     };
     return code;
 }
+`},
+		{"comments", `// header
+module test version "1.0";
+/* Foo holds
+   a value */
+entity Foo { // brace
+    field x: Int; // trailing
+    // end of entity
+}
+entry function main() returns Int {
+    // leading
+    if true { // then
+        return 1;
+    }
+    return 0; /* done */
+}
+// trailer
 `},
 	}
 
@@ -759,3 +951,133 @@ entry function main() returns Int {
 		t.Errorf("expected expr stmt, got:\n%s", got)
 	}
 }
+
+// --- Single expressions and types ---
+
+func TestFormatExprAndType(t *testing.T) {
+	src := `module test version "1.0";
+function f(xs: Array<Int>) returns Int
+    ensures result == (len(xs)+1)*2
+{
+    return 0;
+}
+`
+	p := parser.New(src)
+	prog := p.Parse()
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("parse errors: %s", p.Diagnostics().Format("test"))
+	}
+	fn := prog.Functions[0]
+	if got := FormatExpr(fn.Ensures[0].Expr); got != "result == (len(xs) + 1) * 2" {
+		t.Errorf("FormatExpr = %q", got)
+	}
+	if got := FormatType(fn.Params[0].Type); got != "Array<Int>" {
+		t.Errorf("FormatType = %q", got)
+	}
+}
+
+func TestFormatAlwaysCheck(t *testing.T) {
+	src := `module test version "1.0";
+entity Counter {
+    field n: Int;
+    @always_check   invariant self.n >= 0;
+    method bump() returns Void
+        @always_check ensures self.n == old(self.n) + 1
+    {
+        self.n = self.n + 1;
+    }
+}
+entry function main() returns Int { return 0; }
+`
+	got := formatSource(t, src)
+	if !strings.Contains(got, "    @always_check invariant self.n >= 0;\n") {
+		t.Errorf("expected annotated invariant, got:\n%s", got)
+	}
+	if !strings.Contains(got, "        @always_check ensures self.n == old(self.n) + 1\n") {
+		t.Errorf("expected annotated ensures, got:\n%s", got)
+	}
+	if again := formatSource(t, got); again != got {
+		t.Errorf("formatting is not idempotent:\n%s", again)
+	}
+}
+
+func TestFormatTypeParams(t *testing.T) {
+	src := `module test version "1.0";
+function max<T:Ord>(a: T, b: T) returns T { if a > b { return a; } return b; }
+entity Box<T> {
+    field value: T;
+    constructor(v: T) { self.value = v; }
+}
+enum Pair<A, B:Eq> {
+    Both(a: A, b: B),
+}
+entry function main() returns Int { return 0; }
+`
+	got := formatSource(t, src)
+	for _, want := range []string{
+		"function max<T: Ord>(a: T, b: T) returns T {",
+		"entity Box<T> {",
+		"enum Pair<A, B: Eq> {",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q, got:\n%s", want, got)
+		}
+	}
+	if again := formatSource(t, got); again != got {
+		t.Errorf("formatting is not idempotent:\n%s", again)
+	}
+}
+
+func TestFormatTraits(t *testing.T) {
+	src := `module test version "1.0";
+entity Square implements Shape,Named {
+    field side: Int;
+    method area() returns Int { return self.side * self.side; }
+}
+public trait Shape {
+    // Never negative
+    method area() returns Int ensures result >= 0;
+    method scale(k: Int) returns Void requires k > 0;
+}
+entry function main() returns Int { return 0; }
+`
+	got := formatSource(t, src)
+	for _, want := range []string{
+		"public trait Shape {\n    // Never negative\n    method area() returns Int\n        ensures result >= 0;\n\n    method scale(k: Int) returns Void\n        requires k > 0;\n}",
+		"entity Square implements Shape, Named {",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, "trait Shape") > strings.Index(got, "entity Square") {
+		t.Errorf("expected traits before entities, got:\n%s", got)
+	}
+	if again := formatSource(t, got); again != got {
+		t.Errorf("formatting is not idempotent:\n%s", again)
+	}
+}
+
+func TestFormatMaps(t *testing.T) {
+	src := `module test version "1.0";
+function total(m: Map<String,Int>) returns Int requires forall k in m: m.contains(k) {
+    let mutable sum: Int = 0;
+    for k,v in m { sum = sum + v; }
+    return sum;
+}
+entry function main() returns Int { let m: Map<String, Int> = Map(); return total(m); }
+`
+	got := formatSource(t, src)
+	for _, want := range []string{
+		"function total(m: Map<String, Int>) returns Int\n    requires forall k in m: m.contains(k)\n{",
+		"    for k, v in m {\n",
+		"let m: Map<String, Int> = Map();",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q, got:\n%s", want, got)
+		}
+	}
+	if again := formatSource(t, got); again != got {
+		t.Errorf("formatting is not idempotent:\n%s", again)
+	}
+}
@@ -0,0 +1,478 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lhaig/intent/internal/ir"
+	"github.com/lhaig/intent/internal/lexer"
+)
+
+// eval evaluates an expression.
+func (in *Interpreter) eval(fr *frame, sc *env, e ir.Expr) Value {
+	switch expr := e.(type) {
+	case nil:
+		return nil
+
+	case *ir.IntLit:
+		return expr.Value
+	case *ir.FloatLit:
+		f, _ := strconv.ParseFloat(expr.Value, 64)
+		return f
+	case *ir.StringLit:
+		return unquote(expr.Value)
+	case *ir.BoolLit:
+		return expr.Value
+
+	case *ir.VarRef:
+		v, ok := sc.lookup(expr.Name)
+		if !ok {
+			fail("undefined variable '%s'", expr.Name)
+		}
+		return v
+	case *ir.OldRef:
+		v, _ := sc.lookup(expr.Name)
+		return v
+	case *ir.SelfRef:
+		return fr.self
+	case *ir.ResultRef:
+		return fr.result
+
+	case *ir.BinaryExpr:
+		return in.evalBinary(fr, sc, expr)
+	case *ir.UnaryExpr:
+		v := in.eval(fr, sc, expr.Operand)
+		if expr.Op == lexer.NOT {
+			b, _ := v.(bool)
+			return !b
+		}
+		if f, ok := v.(float64); ok {
+			return -f
+		}
+		i, _ := v.(int64)
+		return -i // -MIN wraps to MIN, as in the Rust release build
+
+	case *ir.StringConcat:
+		return Format(in.eval(fr, sc, expr.Left)) + Format(in.eval(fr, sc, expr.Right))
+	case *ir.StringInterp:
+		var sb strings.Builder
+		for _, part := range expr.Parts {
+			if part.IsExpr {
+				sb.WriteString(Format(in.eval(fr, sc, part.Expr)))
+			} else {
+				sb.WriteString(unescape(part.Static))
+			}
+		}
+		return sb.String()
+
+	case *ir.UpcastExpr:
+		// A trait value is the object itself; methods dispatch on its entity
+		return in.eval(fr, sc, expr.Value)
+
+	case *ir.CallExpr:
+		return in.evalCall(fr, sc, expr)
+	case *ir.MethodCallExpr:
+		return in.evalMethodCall(fr, sc, expr)
+
+	case *ir.FieldAccessExpr:
+		obj, ok := in.eval(fr, sc, expr.Object).(*Object)
+		if !ok {
+			fail("field access '%s' on a non-entity value", expr.Field)
+		}
+		return obj.Fields[expr.Field]
+
+	case *ir.ArrayLit:
+		arr := &Array{Elems: make([]Value, len(expr.Elements))}
+		for i, el := range expr.Elements {
+			arr.Elems[i] = in.eval(fr, sc, el)
+		}
+		return arr
+	case *ir.IndexExpr:
+		arr, _ := in.eval(fr, sc, expr.Object).(*Array)
+		return arr.Elems[in.index(arr, in.eval(fr, sc, expr.Index))]
+
+	case *ir.RangeExpr:
+		start, end := in.intRange(fr, sc, expr)
+		arr := &Array{}
+		for i := start; i < end; i++ {
+			arr.Elems = append(arr.Elems, i)
+		}
+		return arr
+
+	case *ir.ForallExpr:
+		return in.quantify(fr, sc, expr.Variable, expr.Domain, expr.Map, expr.Body, true)
+	case *ir.ExistsExpr:
+		return in.quantify(fr, sc, expr.Variable, expr.Domain, expr.Map, expr.Body, false)
+
+	case *ir.MatchExpr:
+		return in.evalMatch(fr, sc, expr)
+
+	case *ir.TryExpr:
+		v, ok := in.eval(fr, sc, expr.Expr).(*Variant)
+		if !ok {
+			fail("'?' applied to a value that is not a Result or Option")
+		}
+		if v.Name == "Err" || v.Name == "None" {
+			panic(&tryReturn{value: v})
+		}
+		if len(v.Values) > 0 {
+			return v.Values[0]
+		}
+		return nil
+	}
+	fail("cannot evaluate %T", e)
+	return nil
+}
+
+func (in *Interpreter) cond(fr *frame, sc *env, e ir.Expr) bool {
+	b, _ := in.eval(fr, sc, e).(bool)
+	return b
+}
+
+// index checks an array index and returns it as an int.
+func (in *Interpreter) index(arr *Array, v Value) int {
+	i, _ := v.(int64)
+	if arr == nil || i < 0 || i >= int64(len(arr.Elems)) {
+		n := 0
+		if arr != nil {
+			n = len(arr.Elems)
+		}
+		fail("index out of bounds: the len is %d but the index is %d", n, i)
+	}
+	return int(i)
+}
+
+func (in *Interpreter) intRange(fr *frame, sc *env, r *ir.RangeExpr) (int64, int64) {
+	start, _ := in.eval(fr, sc, r.Start).(int64)
+	end, _ := in.eval(fr, sc, r.End).(int64)
+	return start, end
+}
+
+// quantify evaluates forall (all=true) or exists over an integer range or,
+// when m is set, the keys of a map.
+func (in *Interpreter) quantify(fr *frame, sc *env, variable string, domain *ir.RangeExpr, m ir.Expr, body ir.Expr, all bool) Value {
+	inner := newEnv(sc)
+	if m != nil {
+		mv, _ := in.eval(fr, sc, m).(*Map)
+		if mv == nil {
+			return all
+		}
+		for _, k := range mv.Keys() {
+			inner.vars[variable] = k
+			if in.cond(fr, inner, body) != all {
+				return !all
+			}
+		}
+		return all
+	}
+	start, end := in.intRange(fr, sc, domain)
+	for i := start; i < end; i++ {
+		inner.vars[variable] = i
+		if in.cond(fr, inner, body) != all {
+			return !all
+		}
+	}
+	return all
+}
+
+// --- Operators ---
+
+func (in *Interpreter) evalBinary(fr *frame, sc *env, e *ir.BinaryExpr) Value {
+	// Logical operators short-circuit
+	switch e.Op {
+	case lexer.AND:
+		return in.cond(fr, sc, e.Left) && in.cond(fr, sc, e.Right)
+	case lexer.OR:
+		return in.cond(fr, sc, e.Left) || in.cond(fr, sc, e.Right)
+	case lexer.IMPLIES:
+		return !in.cond(fr, sc, e.Left) || in.cond(fr, sc, e.Right)
+	}
+
+	left := in.eval(fr, sc, e.Left)
+	right := in.eval(fr, sc, e.Right)
+
+	switch e.Op {
+	case lexer.EQ:
+		return equal(left, right)
+	case lexer.NEQ:
+		return !equal(left, right)
+	}
+
+	switch l := left.(type) {
+	case int64:
+		r, _ := right.(int64)
+		return intOp(e.Op, l, r)
+	case float64:
+		r, _ := right.(float64)
+		return floatOp(e.Op, l, r)
+	case string:
+		r, _ := right.(string)
+		switch e.Op {
+		case lexer.PLUS:
+			return l + r
+		case lexer.LT:
+			return l < r
+		case lexer.GT:
+			return l > r
+		case lexer.LEQ:
+			return l <= r
+		case lexer.GEQ:
+			return l >= r
+		}
+	}
+	fail("unsupported operands for %s: %s and %s", e.Op, Format(left), Format(right))
+	return nil
+}
+
+// intOp implements i64 arithmetic as the Rust backend's release build does:
+// addition, subtraction and multiplication wrap; division and remainder by
+// zero, and MIN / -1, fail.
+func intOp(op lexer.TokenType, l, r int64) Value {
+	switch op {
+	case lexer.PLUS:
+		return l + r
+	case lexer.MINUS:
+		return l - r
+	case lexer.STAR:
+		return l * r
+	case lexer.SLASH:
+		if r == 0 {
+			fail("attempt to divide by zero")
+		}
+		if l == math.MinInt64 && r == -1 {
+			fail("attempt to divide with overflow")
+		}
+		return l / r
+	case lexer.PERCENT:
+		if r == 0 {
+			fail("attempt to calculate the remainder with a divisor of zero")
+		}
+		if l == math.MinInt64 && r == -1 {
+			fail("attempt to calculate the remainder with overflow")
+		}
+		return l % r
+	case lexer.LT:
+		return l < r
+	case lexer.GT:
+		return l > r
+	case lexer.LEQ:
+		return l <= r
+	case lexer.GEQ:
+		return l >= r
+	}
+	fail("unsupported Int operator %s", op)
+	return nil
+}
+
+func floatOp(op lexer.TokenType, l, r float64) Value {
+	switch op {
+	case lexer.PLUS:
+		return l + r
+	case lexer.MINUS:
+		return l - r
+	case lexer.STAR:
+		return l * r
+	case lexer.SLASH:
+		return l / r
+	case lexer.PERCENT:
+		return math.Mod(l, r)
+	case lexer.LT:
+		return l < r
+	case lexer.GT:
+		return l > r
+	case lexer.LEQ:
+		return l <= r
+	case lexer.GEQ:
+		return l >= r
+	}
+	fail("unsupported Float operator %s", op)
+	return nil
+}
+
+// --- Calls ---
+
+func (in *Interpreter) args(fr *frame, sc *env, exprs []ir.Expr) []Value {
+	vals := make([]Value, len(exprs))
+	for i, a := range exprs {
+		vals[i] = in.eval(fr, sc, a)
+	}
+	return vals
+}
+
+func (in *Interpreter) evalCall(fr *frame, sc *env, e *ir.CallExpr) Value {
+	args := in.args(fr, sc, e.Args)
+
+	switch e.Kind {
+	case ir.CallBuiltin:
+		return in.builtin(e.Function, args)
+
+	case ir.CallVariant:
+		return in.variant(fr.mod, e.EnumName, e.Function, args)
+
+	case ir.CallConstructor:
+		ent := fr.mod.entities[e.Function]
+		if ent == nil {
+			ent = in.entities[e.Function]
+		}
+		if ent == nil {
+			fail("undefined entity '%s'", e.Function)
+		}
+		return in.construct(ent, args)
+	}
+
+	fn := fr.mod.functions[e.Function]
+	if fn == nil {
+		fail("undefined function '%s'", e.Function)
+	}
+	return in.callFunction(fr.mod, fn, args)
+}
+
+func (in *Interpreter) builtin(name string, args []Value) Value {
+	switch name {
+	case "print":
+		if len(args) > 0 {
+			fmt.Fprintln(in.out, Format(args[0]))
+		}
+		return nil
+	case "len":
+		switch v := args[0].(type) {
+		case *Array:
+			return int64(len(v.Elems))
+		case *Map:
+			return int64(len(v.Entries))
+		case string:
+			return int64(len(v))
+		}
+		return int64(0)
+	case "Map":
+		return &Map{Entries: make(map[Value]Value)}
+	case "Ok", "Err", "Some":
+		enum := "Result"
+		if name == "Some" {
+			enum = "Option"
+		}
+		return &Variant{Enum: enum, Name: name, Values: args}
+	case "None":
+		return &Variant{Enum: "Option", Name: "None"}
+	}
+	fail("undefined builtin '%s'", name)
+	return nil
+}
+
+func (in *Interpreter) variant(mod *module, enumName, name string, args []Value) Value {
+	v := &Variant{Enum: enumName, Name: name, Values: args}
+	enum := mod.enums[enumName]
+	if enum == nil {
+		enum = in.enums[enumName]
+	}
+	if enum != nil {
+		for _, ev := range enum.Variants {
+			if ev.Name == name {
+				for _, f := range ev.Fields {
+					v.Fields = append(v.Fields, f.Name)
+				}
+			}
+		}
+	}
+	return v
+}
+
+func (in *Interpreter) evalMethodCall(fr *frame, sc *env, e *ir.MethodCallExpr) Value {
+	if e.IsModuleCall {
+		mod := in.modules[e.ModuleName]
+		if mod == nil {
+			fail("undefined module '%s'", e.ModuleName)
+		}
+		args := in.args(fr, sc, e.Args)
+		if e.CallKind == ir.CallConstructor {
+			ent := mod.entities[e.Method]
+			if ent == nil {
+				fail("undefined entity '%s.%s'", e.ModuleName, e.Method)
+			}
+			return in.construct(ent, args)
+		}
+		fn := mod.functions[e.Method]
+		if fn == nil {
+			fail("undefined function '%s.%s'", e.ModuleName, e.Method)
+		}
+		return in.callFunction(mod, fn, args)
+	}
+
+	recv := in.eval(fr, sc, e.Object)
+	args := in.args(fr, sc, e.Args)
+
+	switch obj := recv.(type) {
+	case *Array:
+		if e.Method == "push" {
+			obj.Elems = append(obj.Elems, args[0])
+			return nil
+		}
+	case *Map:
+		switch e.Method {
+		case "get":
+			if v, ok := obj.Entries[args[0]]; ok {
+				return &Variant{Enum: "Option", Name: "Some", Values: []Value{v}}
+			}
+			return &Variant{Enum: "Option", Name: "None"}
+		case "contains":
+			_, ok := obj.Entries[args[0]]
+			return ok
+		case "set":
+			obj.Entries[args[0]] = args[1]
+			return nil
+		case "remove":
+			delete(obj.Entries, args[0])
+			return nil
+		case "keys":
+			return &Array{Elems: obj.Keys()}
+		case "values":
+			arr := &Array{}
+			for _, k := range obj.Keys() {
+				arr.Elems = append(arr.Elems, obj.Entries[k])
+			}
+			return arr
+		}
+	case *Variant:
+		switch e.Method {
+		case "is_ok":
+			return obj.Name == "Ok"
+		case "is_err":
+			return obj.Name == "Err"
+		case "is_some":
+			return obj.Name == "Some"
+		case "is_none":
+			return obj.Name == "None"
+		}
+	case *Object:
+		for _, m := range obj.Entity.Methods {
+			if m.Name == e.Method {
+				return in.callMethod(obj, m, args)
+			}
+		}
+	}
+	fail("undefined method '%s'", e.Method)
+	return nil
+}
+
+func (in *Interpreter) evalMatch(fr *frame, sc *env, e *ir.MatchExpr) Value {
+	v, _ := in.eval(fr, sc, e.Scrutinee).(*Variant)
+	for _, arm := range e.Arms {
+		p := arm.Pattern
+		if !p.IsWildcard && (v == nil || p.VariantName != v.Name) {
+			continue
+		}
+		armEnv := newEnv(sc)
+		if v != nil && !p.IsWildcard {
+			for i, name := range p.Bindings {
+				if i < len(v.Values) {
+					armEnv.vars[name] = v.Values[i]
+				}
+			}
+		}
+		return in.eval(fr, armEnv, arm.Body)
+	}
+	fail("no match arm for %s", Format(v))
+	return nil
+}
@@ -0,0 +1,522 @@
+// Package interp is a tree-walking interpreter over the IR. It runs a
+// program without any external toolchain, checks every contract at runtime
+// (requires, ensures with old() captures, entity invariants, loop invariants
+// and decreases), and serves as the reference semantics for the backends.
+package interp
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// ContractError is a contract that failed at runtime. Message uses the same
+// wording as the generated code, e.g. "Precondition failed: amount > 0".
+type ContractError struct {
+	Kind    string // "requires", "ensures", "invariant", "loop_invariant" or "decreases"
+	Message string
+}
+
+func (e *ContractError) Error() string { return e.Message }
+
+// RuntimeError is a failure that is not a contract, such as an index out of
+// bounds or a division by zero.
+type RuntimeError struct {
+	Message string
+}
+
+func (e *RuntimeError) Error() string { return e.Message }
+
+// maxDepth bounds recursion so runaway programs fail with an error instead of
+// exhausting the Go stack.
+const maxDepth = 10000
+
+// Interpreter executes an IR program.
+type Interpreter struct {
+	out      io.Writer
+	entry    *module
+	modules  map[string]*module // by module name
+	entities map[string]*ir.Entity
+	enums    map[string]*ir.Enum
+	owners   map[*ir.Entity]*module
+	depth    int
+}
+
+// module indexes one IR module's declarations.
+type module struct {
+	mod       *ir.Module
+	functions map[string]*ir.Function
+	entities  map[string]*ir.Entity
+	enums     map[string]*ir.Enum
+}
+
+// New creates an interpreter for prog that writes print output to out.
+func New(prog *ir.Program, out io.Writer) *Interpreter {
+	in := &Interpreter{
+		out:      out,
+		modules:  make(map[string]*module),
+		entities: make(map[string]*ir.Entity),
+		enums:    make(map[string]*ir.Enum),
+		owners:   make(map[*ir.Entity]*module),
+	}
+	for _, mod := range prog.Modules {
+		m := &module{
+			mod:       mod,
+			functions: make(map[string]*ir.Function),
+			entities:  make(map[string]*ir.Entity),
+			enums:     make(map[string]*ir.Enum),
+		}
+		for _, f := range mod.Functions {
+			m.functions[f.Name] = f
+		}
+		for _, e := range mod.Entities {
+			m.entities[e.Name] = e
+			in.entities[e.Name] = e
+			in.owners[e] = m
+		}
+		for _, e := range mod.Enums {
+			m.enums[e.Name] = e
+			in.enums[e.Name] = e
+		}
+		in.modules[mod.Name] = m
+		if mod.DeclName != "" {
+			in.modules[mod.DeclName] = m
+		}
+		if mod.IsEntry {
+			in.entry = m
+		}
+	}
+	if in.entry == nil && len(prog.Modules) > 0 {
+		in.entry = in.modules[prog.Modules[len(prog.Modules)-1].Name]
+	}
+	return in
+}
+
+// Run calls the entry function and returns its result as the exit code.
+func (in *Interpreter) Run() (int64, error) {
+	if in.entry != nil {
+		for _, f := range in.entry.mod.Functions {
+			if f.IsEntry {
+				v, err := in.Call(f.Name)
+				if code, ok := v.(int64); ok {
+					return code, err
+				}
+				return 0, err
+			}
+		}
+	}
+	return 0, fmt.Errorf("no entry function")
+}
+
+// Call calls a function of the entry module with the given arguments.
+// Failures are returned as *ContractError or *RuntimeError.
+func (in *Interpreter) Call(name string, args ...Value) (Value, error) {
+	return in.invoke(name, args, nil)
+}
+
+// Exec calls a function of the entry module like Call and also returns the
+// variables left in its body's outermost scope. The REPL uses it to carry
+// let bindings from one input to the next.
+func (in *Interpreter) Exec(name string, args ...Value) (Value, map[string]Value, error) {
+	body := newEnv(nil)
+	v, err := in.invoke(name, args, body)
+	return v, body.vars, err
+}
+
+func (in *Interpreter) invoke(name string, args []Value, body *env) (result Value, err error) {
+	if in.entry == nil {
+		return nil, fmt.Errorf("undefined function '%s'", name)
+	}
+	fn := in.entry.functions[name]
+	if fn == nil {
+		return nil, fmt.Errorf("undefined function '%s'", name)
+	}
+	if len(args) != len(fn.Params) {
+		return nil, fmt.Errorf("function '%s' expects %d arguments, got %d", name, len(fn.Params), len(args))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			switch e := r.(type) {
+			case *ContractError:
+				err = e
+			case *RuntimeError:
+				err = e
+			default:
+				panic(r)
+			}
+		}
+	}()
+	return in.callFunctionIn(in.entry, fn, args, body), nil
+}
+
+// Rebind points the entity instances reachable from v at this interpreter's
+// entities of the same name, so values created under an earlier program keep
+// working after the program is rebuilt.
+func (in *Interpreter) Rebind(v Value) {
+	in.rebind(v, make(map[*Object]bool))
+}
+
+func (in *Interpreter) rebind(v Value, seen map[*Object]bool) {
+	switch val := v.(type) {
+	case *Array:
+		for _, el := range val.Elems {
+			in.rebind(el, seen)
+		}
+	case *Variant:
+		for _, fv := range val.Values {
+			in.rebind(fv, seen)
+		}
+	case *Object:
+		if seen[val] {
+			return
+		}
+		seen[val] = true
+		if ent := in.entities[val.Entity.Name]; ent != nil {
+			val.Entity = ent
+		}
+		for _, f := range val.Fields {
+			in.rebind(f, seen)
+		}
+	}
+}
+
+// fail aborts execution with a runtime error.
+func fail(format string, args ...any) {
+	panic(&RuntimeError{Message: fmt.Sprintf(format, args...)})
+}
+
+// --- Scopes and frames ---
+
+// env is a lexical scope.
+type env struct {
+	vars   map[string]Value
+	parent *env
+}
+
+func newEnv(parent *env) *env {
+	return &env{vars: make(map[string]Value), parent: parent}
+}
+
+func (e *env) lookup(name string) (Value, bool) {
+	for s := e; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (e *env) assign(name string, v Value) {
+	for s := e; s != nil; s = s.parent {
+		if _, ok := s.vars[name]; ok {
+			s.vars[name] = v
+			return
+		}
+	}
+	e.vars[name] = v
+}
+
+// frame is one function, method or constructor activation.
+type frame struct {
+	mod    *module
+	self   *Object
+	result Value // the value `result` refers to in ensures clauses
+	ret    Value // the value of the executed return statement
+}
+
+// tryReturn unwinds a `?` that met an Err or None out to the enclosing call.
+type tryReturn struct {
+	value Value
+}
+
+// control is how a statement list finished.
+type control int
+
+const (
+	ctrlNormal control = iota
+	ctrlBreak
+	ctrlContinue
+	ctrlReturn
+)
+
+// --- Calls ---
+
+func (in *Interpreter) enter() {
+	in.depth++
+	if in.depth > maxDepth {
+		fail("stack overflow: call depth exceeded %d", maxDepth)
+	}
+}
+
+// runBody executes a body and returns the returned value, treating a `?`
+// early exit as a return.
+func (in *Interpreter) runBody(fr *frame, sc *env, body []ir.Stmt) (ret Value) {
+	defer func() {
+		if r := recover(); r != nil {
+			if t, ok := r.(*tryReturn); ok {
+				ret = t.value
+				return
+			}
+			panic(r)
+		}
+	}()
+	in.execStmts(fr, sc, body)
+	return fr.ret
+}
+
+func (in *Interpreter) callFunction(mod *module, fn *ir.Function, args []Value) Value {
+	return in.callFunctionIn(mod, fn, args, nil)
+}
+
+// callFunctionIn runs fn with body as the scope of its body statements; a nil
+// body gets a fresh scope.
+func (in *Interpreter) callFunctionIn(mod *module, fn *ir.Function, args []Value, body *env) Value {
+	in.enter()
+	defer func() { in.depth-- }()
+
+	fr := &frame{mod: mod}
+	sc := newEnv(nil)
+	for i, p := range fn.Params {
+		sc.vars[p.Name] = args[i]
+	}
+	in.checkAll(fr, sc, "requires", "Precondition failed: ", fn.Requires)
+	if body == nil {
+		body = newEnv(nil)
+	}
+	body.parent = sc
+	fr.result = in.runBody(fr, body, fn.Body)
+	in.checkAll(fr, sc, "ensures", "Postcondition failed: ", fn.Ensures)
+	return fr.result
+}
+
+func (in *Interpreter) construct(ent *ir.Entity, args []Value) *Object {
+	in.enter()
+	defer func() { in.depth-- }()
+
+	obj := &Object{Entity: ent, Fields: make(map[string]Value)}
+	for _, f := range ent.Fields {
+		obj.Fields[f.Name] = zero(f.Type.Name)
+	}
+	fr := &frame{mod: in.owners[ent], self: obj}
+	sc := newEnv(nil)
+
+	ctor := ent.Constructor
+	if ctor == nil {
+		// Without a constructor, arguments initialize fields in order
+		for i, v := range args {
+			if i < len(ent.Fields) {
+				obj.Fields[ent.Fields[i].Name] = v
+			}
+		}
+	} else {
+		for i, p := range ctor.Params {
+			sc.vars[p.Name] = args[i]
+		}
+		in.checkAll(fr, sc, "requires", "Precondition failed: ", ctor.Requires)
+		in.capture(fr, sc, ctor.OldCaptures)
+		in.runBody(fr, newEnv(sc), ctor.Body)
+		in.checkAll(fr, sc, "ensures", "Postcondition failed: ", ctor.Ensures)
+	}
+	in.checkAll(fr, sc, "invariant", "Invariant failed: ", ent.Invariants)
+	return obj
+}
+
+func (in *Interpreter) callMethod(obj *Object, m *ir.Method, args []Value) Value {
+	in.enter()
+	defer func() { in.depth-- }()
+
+	fr := &frame{mod: in.owners[obj.Entity], self: obj}
+	sc := newEnv(nil)
+	for i, p := range m.Params {
+		sc.vars[p.Name] = args[i]
+	}
+	in.capture(fr, sc, m.OldCaptures)
+	in.checkAll(fr, sc, "requires", "Precondition failed: ", m.Requires)
+	fr.result = in.runBody(fr, newEnv(sc), m.Body)
+	in.checkAll(fr, sc, "ensures", "Postcondition failed: ", m.Ensures)
+	in.checkAll(fr, sc, "invariant", "Invariant failed: ", obj.Entity.Invariants)
+	return fr.result
+}
+
+// capture evaluates old() expressions before the body runs. Captured arrays
+// and entities are copied so later mutation does not change them.
+func (in *Interpreter) capture(fr *frame, sc *env, caps []*ir.OldCapture) {
+	for _, c := range caps {
+		sc.vars[c.Name] = snapshot(in.eval(fr, sc, c.Expr))
+	}
+}
+
+func snapshot(v Value) Value {
+	switch val := v.(type) {
+	case *Array:
+		elems := make([]Value, len(val.Elems))
+		for i, el := range val.Elems {
+			elems[i] = snapshot(el)
+		}
+		return &Array{Elems: elems}
+	case *Object:
+		fields := make(map[string]Value, len(val.Fields))
+		for k, f := range val.Fields {
+			fields[k] = snapshot(f)
+		}
+		return &Object{Entity: val.Entity, Fields: fields}
+	}
+	return v
+}
+
+func (in *Interpreter) checkAll(fr *frame, sc *env, kind, prefix string, contracts []*ir.Contract) {
+	for _, c := range contracts {
+		in.check(fr, sc, kind, prefix, c)
+	}
+}
+
+func (in *Interpreter) check(fr *frame, sc *env, kind, prefix string, c *ir.Contract) {
+	if ok, _ := in.eval(fr, sc, c.Expr).(bool); !ok {
+		panic(&ContractError{Kind: kind, Message: prefix + c.RawText})
+	}
+}
+
+// --- Statements ---
+
+func (in *Interpreter) execStmts(fr *frame, sc *env, stmts []ir.Stmt) control {
+	for _, s := range stmts {
+		if ctrl := in.exec(fr, sc, s); ctrl != ctrlNormal {
+			return ctrl
+		}
+	}
+	return ctrlNormal
+}
+
+func (in *Interpreter) exec(fr *frame, sc *env, s ir.Stmt) control {
+	switch stmt := s.(type) {
+	case *ir.LetStmt:
+		sc.vars[stmt.Name] = in.eval(fr, sc, stmt.Value)
+
+	case *ir.AssignStmt:
+		in.assign(fr, sc, stmt.Target, in.eval(fr, sc, stmt.Value))
+
+	case *ir.ReturnStmt:
+		fr.ret = nil
+		if stmt.Value != nil {
+			fr.ret = in.eval(fr, sc, stmt.Value)
+		}
+		return ctrlReturn
+
+	case *ir.IfStmt:
+		if in.cond(fr, sc, stmt.Condition) {
+			return in.execStmts(fr, newEnv(sc), stmt.Then)
+		}
+		return in.execStmts(fr, newEnv(sc), stmt.Else)
+
+	case *ir.WhileStmt:
+		return in.execWhile(fr, sc, stmt)
+
+	case *ir.ForInStmt:
+		return in.execForIn(fr, sc, stmt)
+
+	case *ir.BreakStmt:
+		return ctrlBreak
+
+	case *ir.ContinueStmt:
+		return ctrlContinue
+
+	case *ir.ExprStmt:
+		in.eval(fr, sc, stmt.Expr)
+	}
+	return ctrlNormal
+}
+
+func (in *Interpreter) execWhile(fr *frame, sc *env, stmt *ir.WhileStmt) control {
+	loop := newEnv(sc)
+	in.capture(fr, loop, stmt.OldCaptures)
+	in.checkAll(fr, loop, "loop_invariant", "Loop invariant failed at entry: ", stmt.Invariants)
+
+	var prev int64
+	if d := stmt.Decreases; d != nil {
+		prev = in.decreases(fr, loop, d)
+		if prev < 0 {
+			panic(&ContractError{Kind: "decreases", Message: "Decreases metric must be non-negative at entry: " + d.RawText})
+		}
+	}
+
+	for in.cond(fr, loop, stmt.Condition) {
+		ctrl := in.execStmts(fr, newEnv(loop), stmt.Body)
+		if ctrl == ctrlReturn {
+			return ctrl
+		}
+		if ctrl == ctrlBreak {
+			break
+		}
+
+		in.checkAll(fr, loop, "loop_invariant", "Loop invariant failed after iteration: ", stmt.Invariants)
+		if d := stmt.Decreases; d != nil {
+			next := in.decreases(fr, loop, d)
+			if next >= prev {
+				panic(&ContractError{Kind: "decreases", Message: "Termination metric did not decrease: " + d.RawText})
+			}
+			if next < 0 {
+				panic(&ContractError{Kind: "decreases", Message: "Termination metric became negative: " + d.RawText})
+			}
+			prev = next
+		}
+	}
+	return ctrlNormal
+}
+
+func (in *Interpreter) decreases(fr *frame, sc *env, d *ir.DecreasesClause) int64 {
+	v, _ := in.eval(fr, sc, d.Expr).(int64)
+	return v
+}
+
+func (in *Interpreter) execForIn(fr *frame, sc *env, stmt *ir.ForInStmt) control {
+	var items, values []Value
+	if r, ok := stmt.Iterable.(*ir.RangeExpr); ok {
+		start, end := in.intRange(fr, sc, r)
+		for i := start; i < end; i++ {
+			items = append(items, i)
+		}
+	} else {
+		switch v := in.eval(fr, sc, stmt.Iterable).(type) {
+		case *Array:
+			items = append(items, v.Elems...)
+		case *Map:
+			items = v.Keys()
+			for _, k := range items {
+				values = append(values, v.Entries[k])
+			}
+		}
+	}
+
+	for i, item := range items {
+		body := newEnv(sc)
+		body.vars[stmt.Variable] = item
+		if stmt.ValueVariable != "" {
+			body.vars[stmt.ValueVariable] = values[i]
+		}
+		ctrl := in.execStmts(fr, body, stmt.Body)
+		if ctrl == ctrlReturn {
+			return ctrl
+		}
+		if ctrl == ctrlBreak {
+			break
+		}
+	}
+	return ctrlNormal
+}
+
+// assign stores a value into a variable, field or array element.
+func (in *Interpreter) assign(fr *frame, sc *env, target ir.Expr, v Value) {
+	switch t := target.(type) {
+	case *ir.VarRef:
+		sc.assign(t.Name, v)
+	case *ir.FieldAccessExpr:
+		if obj, ok := in.eval(fr, sc, t.Object).(*Object); ok {
+			obj.Fields[t.Field] = v
+		}
+	case *ir.IndexExpr:
+		arr, _ := in.eval(fr, sc, t.Object).(*Array)
+		i := in.index(arr, in.eval(fr, sc, t.Index))
+		arr.Elems[i] = v
+	}
+}
@@ -0,0 +1,567 @@
+package interp
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+	"github.com/lhaig/intent/internal/parser"
+)
+
+// run lowers source and interprets its entry function.
+func run(t *testing.T, source string) (string, int64, error) {
+	t.Helper()
+	p := parser.New(source)
+	prog := p.Parse()
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("parse errors: %s", p.Diagnostics().Format("test"))
+	}
+	result := checker.CheckWithResult(prog)
+	if result.Diagnostics.HasErrors() {
+		t.Fatalf("check errors: %s", result.Diagnostics.Format("test"))
+	}
+	mod := ir.Lower(prog, result)
+
+	var out bytes.Buffer
+	code, err := New(&ir.Program{Modules: []*ir.Module{mod}}, &out).Run()
+	return out.String(), code, err
+}
+
+// expectOutput runs source and compares its printed output.
+func expectOutput(t *testing.T, source, want string) {
+	t.Helper()
+	out, _, err := run(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != want {
+		t.Errorf("output mismatch\nwant:\n%s\ngot:\n%s", want, out)
+	}
+}
+
+// expectContract runs source and expects a contract violation message.
+func expectContract(t *testing.T, source, kind, message string) {
+	t.Helper()
+	_, _, err := run(t, source)
+	var ce *ContractError
+	if !errors.As(err, &ce) {
+		t.Fatalf("expected a contract error, got %v", err)
+	}
+	if ce.Kind != kind || ce.Message != message {
+		t.Errorf("expected %s %q, got %s %q", kind, message, ce.Kind, ce.Message)
+	}
+}
+
+func TestArithmeticAndPrint(t *testing.T) {
+	expectOutput(t, `module test version "1.0.0";
+entry function main() returns Int {
+    print(7 / 2);
+    print(-7 % 3);
+    print(2.5 * 2.0);
+    print(1.0 / 4.0);
+    print(3 > 2 and not false);
+    print("a" + "b");
+    let name: String = "world";
+    print("hello {name}, {1 + 2}");
+    return 0;
+}
+`, "3\n-1\n5\n0.25\ntrue\nab\nhello world, 3\n")
+}
+
+func TestExitCode(t *testing.T) {
+	_, code, err := run(t, `module test version "1.0.0";
+entry function main() returns Int {
+    return 42;
+}
+`)
+	if err != nil || code != 42 {
+		t.Errorf("expected exit code 42, got %d (%v)", code, err)
+	}
+}
+
+func TestControlFlow(t *testing.T) {
+	expectOutput(t, `module test version "1.0.0";
+function fib(n: Int) returns Int {
+    if n < 2 {
+        return n;
+    }
+    return fib(n - 1) + fib(n - 2);
+}
+entry function main() returns Int {
+    let mutable i: Int = 0;
+    let mutable total: Int = 0;
+    while true {
+        i = i + 1;
+        if i % 2 == 0 {
+            continue;
+        }
+        if i > 7 {
+            break;
+        }
+        total = total + i;
+    }
+    print(total);
+    for k in 0..3 {
+        print(k);
+    }
+    print(fib(15));
+    return 0;
+}
+`, "16\n0\n1\n2\n610\n")
+}
+
+func TestArrays(t *testing.T) {
+	expectOutput(t, `module test version "1.0.0";
+function sum(xs: Array<Int>) returns Int
+    requires forall i in 0..len(xs): xs[i] > 0
+    ensures exists i in 0..len(xs): xs[i] <= result
+{
+    let mutable total: Int = 0;
+    for x in xs {
+        total = total + x;
+    }
+    return total;
+}
+entry function main() returns Int {
+    let mutable xs: Array<Int> = [1, 2, 3];
+    xs.push(4);
+    xs[0] = 10;
+    print(len(xs));
+    print(xs[0]);
+    print(sum(xs));
+    return 0;
+}
+`, "4\n10\n19\n")
+}
+
+func TestEntities(t *testing.T) {
+	expectOutput(t, `module test version "1.0.0";
+entity Account {
+    field balance: Int;
+
+    invariant self.balance >= 0;
+
+    constructor(initial: Int)
+        requires initial >= 0
+    {
+        self.balance = initial;
+    }
+
+    method deposit(amount: Int) returns Int
+        requires amount > 0
+        ensures self.balance == old(self.balance) + amount
+    {
+        self.balance = self.balance + amount;
+        return self.balance;
+    }
+}
+entry function main() returns Int {
+    let acct: Account = Account(10);
+    print(acct.deposit(5));
+    print(acct.balance);
+    return 0;
+}
+`, "15\n15\n")
+}
+
+func TestEnumsAndMatch(t *testing.T) {
+	expectOutput(t, `module test version "1.0.0";
+enum Shape {
+    Circle(radius: Float),
+    Square(side: Float),
+    Empty,
+}
+function area(s: Shape) returns Float {
+    return match s {
+        Circle(r) => 3.0 * r * r,
+        Square(x) => x * x,
+        _ => 0.0,
+    };
+}
+entry function main() returns Int {
+    print(area(Circle(1.0)));
+    print(area(Square(2.5)));
+    print(area(Empty));
+    return 0;
+}
+`, "3\n6.25\n0\n")
+}
+
+func TestResultOptionAndTry(t *testing.T) {
+	expectOutput(t, `module test version "1.0.0";
+function divide(a: Int, b: Int) returns Result<Int, String> {
+    if b == 0 {
+        return Err("division by zero");
+    }
+    return Ok(a / b);
+}
+function compute(a: Int, b: Int) returns Result<Int, String> {
+    let q: Int = divide(a, b)?;
+    return Ok(q + 1);
+}
+function first(xs: Array<Int>) returns Option<Int> {
+    if len(xs) == 0 {
+        return None;
+    }
+    return Some(xs[0]);
+}
+entry function main() returns Int {
+    let good: Result<Int, String> = compute(10, 2);
+    let bad: Result<Int, String> = compute(1, 0);
+    print(good.is_ok());
+    print(bad.is_err());
+    let msg: String = match bad {
+        Ok(v) => "ok",
+        Err(e) => e,
+    };
+    print(msg);
+    let v: Int = match good {
+        Ok(v) => v,
+        Err(e) => 0,
+    };
+    print(v);
+    let empty: Array<Int> = [];
+    print(first(empty).is_none());
+    return 0;
+}
+`, "true\ntrue\ndivision by zero\n6\ntrue\n")
+}
+
+func TestQuantifierContract(t *testing.T) {
+	expectContract(t, `module test version "1.0.0";
+function sum(xs: Array<Int>) returns Int
+    requires forall i in 0..len(xs): xs[i] > 0
+{
+    return 0;
+}
+entry function main() returns Int {
+    let xs: Array<Int> = [1, 0];
+    return sum(xs);
+}
+`, "requires", "Precondition failed: forall i in 0 .. len ( xs ) : xs [ i ] > 0")
+}
+
+func TestPrecondition(t *testing.T) {
+	expectContract(t, `module test version "1.0.0";
+function f(x: Int) returns Int
+    requires x > 0
+{
+    return x;
+}
+entry function main() returns Int {
+    return f(0);
+}
+`, "requires", "Precondition failed: x > 0")
+}
+
+func TestPostcondition(t *testing.T) {
+	expectContract(t, `module test version "1.0.0";
+function f(x: Int) returns Int
+    ensures result > x
+{
+    return x;
+}
+entry function main() returns Int {
+    return f(1);
+}
+`, "ensures", "Postcondition failed: result > x")
+}
+
+func TestOldCapture(t *testing.T) {
+	expectContract(t, `module test version "1.0.0";
+entity Counter {
+    field n: Int;
+    constructor() {
+        self.n = 0;
+    }
+    method bump() returns Void
+        ensures self.n == old(self.n) + 1
+    {
+        self.n = self.n + 2;
+    }
+}
+entry function main() returns Int {
+    let c: Counter = Counter();
+    c.bump();
+    return 0;
+}
+`, "ensures", "Postcondition failed: self . n == old ( self . n ) + 1")
+}
+
+func TestInvariant(t *testing.T) {
+	expectContract(t, `module test version "1.0.0";
+entity Counter {
+    field n: Int;
+    invariant self.n >= 0;
+    constructor() {
+        self.n = 0;
+    }
+    method dec() returns Void {
+        self.n = self.n - 1;
+    }
+}
+entry function main() returns Int {
+    let c: Counter = Counter();
+    c.dec();
+    return 0;
+}
+`, "invariant", "Invariant failed: self . n >= 0")
+}
+
+func TestLoopContracts(t *testing.T) {
+	expectContract(t, `module test version "1.0.0";
+entry function main() returns Int {
+    let mutable i: Int = 0;
+    while i < 5
+        invariant i <= 3
+    {
+        i = i + 1;
+    }
+    return 0;
+}
+`, "loop_invariant", "Loop invariant failed after iteration: i <= 3")
+
+	expectContract(t, `module test version "1.0.0";
+entry function main() returns Int {
+    let mutable i: Int = 0;
+    while i < 5
+        decreases 5 - i
+    {
+        i = i + 0;
+    }
+    return 0;
+}
+`, "decreases", "Termination metric did not decrease: 5 - i")
+}
+
+func TestGenerics(t *testing.T) {
+	expectOutput(t, `module test version "1.0.0";
+function max<T: Ord>(a: T, b: T) returns T
+    ensures result >= a and result >= b
+{
+    if a > b { return a; }
+    return b;
+}
+entity Stack<T> {
+    field items: Array<T>;
+    constructor() { self.items = []; }
+    method push(x: T) returns Void { self.items.push(x); }
+    method size() returns Int { return len(self.items); }
+}
+enum Tree<T> {
+    Leaf(value: T),
+    Empty,
+}
+function value_or<T>(t: Tree<T>, d: T) returns T {
+    return match t {
+        Leaf(v) => v,
+        Empty => d,
+    };
+}
+entry function main() returns Int {
+    print(max(3, 7));
+    print(max("apple", "pear"));
+    let mutable s: Stack<String> = Stack();
+    s.push("a");
+    s.push("b");
+    print(s.size());
+    let t: Tree<Float> = Empty;
+    print(value_or(t, 0.5));
+    print(value_or(Leaf(5), 0));
+    return 0;
+}
+`, "7\npear\n2\n0.5\n5\n")
+}
+
+func TestMaps(t *testing.T) {
+	expectOutput(t, `module test version "1.0.0";
+entity Registry {
+    field retries: Map<String, Int>;
+    invariant forall k in self.retries: self.retries.get(k).is_some();
+    constructor() { self.retries = Map(); }
+    method bump(name: String) returns Void
+        ensures self.retries.contains(name)
+    {
+        let n: Int = match self.retries.get(name) { Some(v) => v + 1, None => 1 };
+        self.retries.set(name, n);
+    }
+}
+function total(m: Map<String, Int>) returns Int
+    requires forall k in m: m.contains(k)
+{
+    let mutable sum: Int = 0;
+    for k, v in m {
+        sum = sum + v;
+    }
+    return sum;
+}
+entry function main() returns Int {
+    let mutable m: Map<String, Int> = Map();
+    m.set("b", 2);
+    m.set("a", 1);
+    m.set("c", 3);
+    m.remove("c");
+    m.remove("z");
+    print(len(m));
+    for k in m {
+        print(k);
+    }
+    print(total(m));
+    print(m.contains("c"));
+    let r: Registry = Registry();
+    r.bump("x");
+    r.bump("x");
+    print(match r.retries.get("x") { Some(v) => v, None => 0 });
+    let mutable ids: Map<Int, Bool> = Map();
+    ids.set(10, true);
+    ids.set(-3, false);
+    print(ids.keys()[0]);
+    print(ids.values()[0]);
+    return 0;
+}
+`, "2\na\nb\n3\nfalse\n2\n-3\nfalse\n")
+}
+
+func TestTraits(t *testing.T) {
+	expectOutput(t, `module test version "1.0.0";
+trait Shape {
+    method area() returns Int ensures result >= 0;
+    method scale(k: Int) returns Void requires k > 0;
+}
+entity Square implements Shape {
+    field side: Int;
+    constructor(side: Int) { self.side = side; }
+    method area() returns Int { return self.side * self.side; }
+    method scale(k: Int) returns Void { self.side = self.side * k; }
+}
+entity Rect implements Shape {
+    field w: Int;
+    field h: Int;
+    constructor(w: Int, h: Int) { self.w = w; self.h = h; }
+    method area() returns Int { return self.w * self.h; }
+    method scale(k: Int) returns Void { self.w = self.w * k; self.h = self.h * k; }
+}
+function total(shapes: Array<Shape>) returns Int {
+    let mutable sum: Int = 0;
+    for s in shapes {
+        sum = sum + s.area();
+    }
+    return sum;
+}
+entry function main() returns Int {
+    let mutable shapes: Array<Shape> = [Square(3), Rect(2, 5)];
+    print(total(shapes));
+    let mutable s: Shape = Rect(1, 2);
+    s.scale(3);
+    print(s.area());
+    return 0;
+}
+`, "19\n18\n")
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		substr string
+	}{
+		{"divide by zero", "let z: Int = 0;\n    return 1 / z;", "divide by zero"},
+		{"index out of bounds", "let xs: Array<Int> = [1];\n    return xs[3];", "index out of bounds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := run(t, "module test version \"1.0.0\";\nentry function main() returns Int {\n    "+tt.body+"\n}\n")
+			var re *RuntimeError
+			if !errors.As(err, &re) || !strings.Contains(re.Message, tt.substr) {
+				t.Errorf("expected runtime error containing %q, got %v", tt.substr, err)
+			}
+		})
+	}
+}
+
+func TestRecursionLimit(t *testing.T) {
+	_, _, err := run(t, `module test version "1.0.0";
+function loop(n: Int) returns Int {
+    return loop(n + 1);
+}
+entry function main() returns Int {
+    return loop(0);
+}
+`)
+	var re *RuntimeError
+	if !errors.As(err, &re) || !strings.Contains(re.Message, "stack overflow") {
+		t.Errorf("expected a stack overflow error, got %v", err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	p := parser.New(`module test version "1.0.0";
+function double(x: Int) returns Int
+    requires x >= 0
+{
+    return x * 2;
+}
+`)
+	prog := p.Parse()
+	result := checker.CheckWithResult(prog)
+	in := New(&ir.Program{Modules: []*ir.Module{ir.Lower(prog, result)}}, &bytes.Buffer{})
+
+	v, err := in.Call("double", int64(21))
+	if err != nil || v != int64(42) {
+		t.Errorf("expected 42, got %v (%v)", v, err)
+	}
+	if _, err := in.Call("double", int64(-1)); err == nil {
+		t.Error("expected a precondition failure")
+	}
+	if _, err := in.Call("missing"); err == nil {
+		t.Error("expected an undefined function error")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		v    Value
+		want string
+	}{
+		{int64(-3), "-3"},
+		{3.0, "3"},
+		{0.1, "0.1"},
+		{"s", "s"},
+		{&Array{Elems: []Value{int64(1), "a"}}, `[1, "a"]`},
+		{&Variant{Name: "Some", Values: []Value{2.0}}, "Some(2.0)"},
+		{&Variant{Name: "Circle", Fields: []string{"radius"}, Values: []Value{1.5}}, "Circle { radius: 1.5 }"},
+		{&Variant{Name: "Empty"}, "Empty"},
+	}
+	for _, tt := range tests {
+		if got := Format(tt.v); got != tt.want {
+			t.Errorf("Format(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	p := parser.New(`module test version "1.0.0";
+function step(start: Int) returns Void {
+    let mutable n: Int = start;
+    n = n + 1;
+    let doubled: Int = n * 2;
+}
+`)
+	prog := p.Parse()
+	result := checker.CheckWithResult(prog)
+	in := New(&ir.Program{Modules: []*ir.Module{ir.Lower(prog, result)}}, &bytes.Buffer{})
+
+	_, vars, err := in.Exec("step", int64(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["n"] != int64(5) || vars["doubled"] != int64(10) {
+		t.Errorf("unexpected body scope: %v", vars)
+	}
+	if _, ok := vars["start"]; ok {
+		t.Error("parameters should not be part of the body scope")
+	}
+}
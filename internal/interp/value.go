@@ -0,0 +1,255 @@
+package interp
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// Value is a runtime value. Int is int64, Float is float64, String is
+// string, Bool is bool and Void is nil; arrays, maps, entities and enum
+// values use the pointer types below and are shared by reference, as in the JS and WASM
+// backends.
+type Value any
+
+// Array is an Array<T> value.
+type Array struct {
+	Elems []Value
+}
+
+// Map is a Map<K, V> value. Its keys are int64, string or bool.
+type Map struct {
+	Entries map[Value]Value
+}
+
+// Keys returns the keys of m in ascending order, the order every backend
+// iterates a map in.
+func (m *Map) Keys() []Value {
+	keys := make([]Value, 0, len(m.Entries))
+	for k := range m.Entries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	return keys
+}
+
+// less orders map keys: numerically, bytewise, and false before true.
+func less(a, b Value) bool {
+	switch x := a.(type) {
+	case int64:
+		return x < b.(int64)
+	case string:
+		return x < b.(string)
+	case bool:
+		return !x && b.(bool)
+	}
+	return false
+}
+
+// Object is an entity instance.
+type Object struct {
+	Entity *ir.Entity
+	Fields map[string]Value
+}
+
+// Variant is an enum value, including the built-in Result and Option.
+type Variant struct {
+	Enum   string
+	Name   string
+	Fields []string // declared field names, when known
+	Values []Value
+}
+
+// Format renders a value the way print shows it: primitives as Rust's
+// Display would, compound values in Rust's Debug form.
+func Format(v Value) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return formatFloat(val)
+	}
+	return debug(v)
+}
+
+// Debug renders a value in Rust's Debug form, quoting strings.
+func Debug(v Value) string {
+	return debug(v)
+}
+
+func debug(v Value) string {
+	switch val := v.(type) {
+	case nil:
+		return "()"
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		if val == math.Trunc(val) && !math.IsInf(val, 0) {
+			return formatFloat(val) + ".0"
+		}
+		return formatFloat(val)
+	case string:
+		return strconv.Quote(val)
+	case bool:
+		return strconv.FormatBool(val)
+	case *Array:
+		parts := make([]string, len(val.Elems))
+		for i, el := range val.Elems {
+			parts[i] = debug(el)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case *Map:
+		keys := val.Keys()
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = debug(k) + ": " + debug(val.Entries[k])
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case *Object:
+		parts := make([]string, len(val.Entity.Fields))
+		for i, f := range val.Entity.Fields {
+			parts[i] = f.Name + ": " + debug(val.Fields[f.Name])
+		}
+		return val.Entity.Name + " { " + strings.Join(parts, ", ") + " }"
+	case *Variant:
+		if len(val.Values) == 0 {
+			return val.Name
+		}
+		parts := make([]string, len(val.Values))
+		for i, fv := range val.Values {
+			parts[i] = debug(fv)
+			if i < len(val.Fields) {
+				parts[i] = val.Fields[i] + ": " + parts[i]
+			}
+		}
+		if len(val.Fields) == 0 {
+			return val.Name + "(" + strings.Join(parts, ", ") + ")"
+		}
+		return val.Name + " { " + strings.Join(parts, ", ") + " }"
+	}
+	return "?"
+}
+
+// formatFloat matches Rust's Display for f64: no exponent, no trailing ".0".
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// equal compares values structurally.
+func equal(a, b Value) bool {
+	switch x := a.(type) {
+	case *Array:
+		y, ok := b.(*Array)
+		if !ok || len(x.Elems) != len(y.Elems) {
+			return false
+		}
+		for i := range x.Elems {
+			if !equal(x.Elems[i], y.Elems[i]) {
+				return false
+			}
+		}
+		return true
+	case *Map:
+		y, ok := b.(*Map)
+		if !ok || len(x.Entries) != len(y.Entries) {
+			return false
+		}
+		for k, v := range x.Entries {
+			w, found := y.Entries[k]
+			if !found || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case *Object:
+		y, ok := b.(*Object)
+		if !ok || x.Entity != y.Entity {
+			return false
+		}
+		for _, f := range x.Entity.Fields {
+			if !equal(x.Fields[f.Name], y.Fields[f.Name]) {
+				return false
+			}
+		}
+		return true
+	case *Variant:
+		y, ok := b.(*Variant)
+		if !ok || x.Enum != y.Enum || x.Name != y.Name || len(x.Values) != len(y.Values) {
+			return false
+		}
+		for i := range x.Values {
+			if !equal(x.Values[i], y.Values[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// zero returns the default value of a field before the constructor runs.
+func zero(name string) Value {
+	switch name {
+	case "Int":
+		return int64(0)
+	case "Float":
+		return float64(0)
+	case "String":
+		return ""
+	case "Bool":
+		return false
+	case "Array":
+		return &Array{}
+	case "Map":
+		return &Map{Entries: make(map[Value]Value)}
+	}
+	return nil
+}
+
+// unquote decodes a string literal as the lexer keeps it: quoted, with
+// escape sequences.
+func unquote(lit string) string {
+	if len(lit) >= 2 && lit[0] == '"' && lit[len(lit)-1] == '"' {
+		lit = lit[1 : len(lit)-1]
+	}
+	return unescape(lit)
+}
+
+// unescape decodes backslash escapes.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case '0':
+			sb.WriteByte(0)
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
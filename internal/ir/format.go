@@ -0,0 +1,113 @@
+package ir
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lhaig/intent/internal/lexer"
+)
+
+// FormatExpr renders e in Intent source syntax for diagnostics and runtime
+// check messages. Nested binary operations are parenthesized, and old()
+// references render as the captured name.
+func FormatExpr(e Expr) string {
+	switch x := e.(type) {
+	case *BinaryExpr:
+		return formatOperand(x.Left) + " " + operatorText(x.Op) + " " + formatOperand(x.Right)
+	case *UnaryExpr:
+		if x.Op == lexer.NOT {
+			return "not " + formatOperand(x.Operand)
+		}
+		return "-" + formatOperand(x.Operand)
+	case *StringConcat:
+		return formatOperand(x.Left) + " + " + formatOperand(x.Right)
+	case *VarRef:
+		return x.Name
+	case *OldRef:
+		return x.Name
+	case *SelfRef:
+		return "self"
+	case *ResultRef:
+		return "result"
+	case *FieldAccessExpr:
+		return FormatExpr(x.Object) + "." + x.Field
+	case *IndexExpr:
+		return FormatExpr(x.Object) + "[" + FormatExpr(x.Index) + "]"
+	case *IntLit:
+		return fmt.Sprintf("%d", x.Value)
+	case *FloatLit:
+		return x.Value
+	case *StringLit:
+		return x.Value
+	case *BoolLit:
+		if x.Value {
+			return "true"
+		}
+		return "false"
+	case *CallExpr:
+		return x.Function + "(" + formatArgs(x.Args) + ")"
+	case *MethodCallExpr:
+		if x.IsModuleCall {
+			return x.ModuleName + "." + x.Method + "(" + formatArgs(x.Args) + ")"
+		}
+		return FormatExpr(x.Object) + "." + x.Method + "(" + formatArgs(x.Args) + ")"
+	case *TryExpr:
+		return FormatExpr(x.Expr) + "?"
+	case *UpcastExpr:
+		return FormatExpr(x.Value)
+	default:
+		return "..."
+	}
+}
+
+func formatOperand(e Expr) string {
+	switch e.(type) {
+	case *BinaryExpr, *StringConcat:
+		return "(" + FormatExpr(e) + ")"
+	}
+	return FormatExpr(e)
+}
+
+func formatArgs(args []Expr) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = FormatExpr(a)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// operatorText returns the source spelling of a binary operator.
+func operatorText(op lexer.TokenType) string {
+	switch op {
+	case lexer.PLUS:
+		return "+"
+	case lexer.MINUS:
+		return "-"
+	case lexer.STAR:
+		return "*"
+	case lexer.SLASH:
+		return "/"
+	case lexer.PERCENT:
+		return "%"
+	case lexer.EQ:
+		return "=="
+	case lexer.NEQ:
+		return "!="
+	case lexer.LT:
+		return "<"
+	case lexer.GT:
+		return ">"
+	case lexer.LEQ:
+		return "<="
+	case lexer.GEQ:
+		return ">="
+	case lexer.AND:
+		return "and"
+	case lexer.OR:
+		return "or"
+	case lexer.IMPLIES:
+		return "implies"
+	default:
+		return op.String()
+	}
+}
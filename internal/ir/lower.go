@@ -15,6 +15,15 @@ type lowerer struct {
 	exprTypes map[ast.Expression]*checker.Type
 	entities  map[string]*checker.EntityInfo
 	enums     map[string]*checker.EnumInfo
+	typeArgs  map[ast.Expression][]*checker.Type
+	traits    map[string]*checker.TraitInfo
+	upcasts   map[ast.Expression]*checker.Type
+
+	// file-based module names, keyed by the names qualified calls may use
+	moduleNames map[string]string
+
+	// type parameters of the generic declaration being lowered
+	typeParams map[string]*checker.Type
 
 	// old() capture state for current method/constructor/while
 	oldCounter  int
@@ -28,6 +37,9 @@ func Lower(prog *ast.Program, result *checker.CheckResult) *Module {
 		exprTypes: result.ExprTypes,
 		entities:  result.Entities,
 		enums:     result.Enums,
+		typeArgs:  result.TypeArgs,
+		traits:    result.Traits,
+		upcasts:   result.Upcasts,
 	}
 
 	modName := ""
@@ -36,8 +48,9 @@ func Lower(prog *ast.Program, result *checker.CheckResult) *Module {
 	}
 
 	mod := &Module{
-		Name:    modName,
-		IsEntry: true,
+		Name:     modName,
+		DeclName: modName,
+		IsEntry:  true,
 	}
 
 	for _, e := range prog.Entities {
@@ -46,6 +59,9 @@ func Lower(prog *ast.Program, result *checker.CheckResult) *Module {
 	for _, e := range prog.Enums {
 		mod.Enums = append(mod.Enums, l.lowerEnum(e))
 	}
+	for _, t := range prog.Traits {
+		mod.Traits = append(mod.Traits, l.lowerTrait(t))
+	}
 	for _, f := range prog.Functions {
 		mod.Functions = append(mod.Functions, l.lowerFunction(f))
 	}
@@ -53,6 +69,7 @@ func Lower(prog *ast.Program, result *checker.CheckResult) *Module {
 		mod.Intents = append(mod.Intents, l.lowerIntent(i))
 	}
 
+	monomorphize([]*Module{mod})
 	return mod
 }
 
@@ -68,6 +85,20 @@ func LowerAll(registry map[string]*ast.Program, sortedPaths []string, result *ch
 		exprTypes: result.ExprTypes,
 		entities:  result.Entities,
 		enums:     result.Enums,
+		typeArgs:  result.TypeArgs,
+		traits:    result.Traits,
+		upcasts:   result.Upcasts,
+	}
+
+	// Qualified calls may name a module by its declaration or its file;
+	// the IR always uses the file name, as Module.Name does
+	l.moduleNames = make(map[string]string)
+	for _, filePath := range sortedPaths {
+		modName := strings.TrimSuffix(filepath.Base(filePath), ".intent")
+		l.moduleNames[modName] = modName
+		if p := registry[filePath]; p != nil && p.Module != nil {
+			l.moduleNames[p.Module.Name] = modName
+		}
 	}
 
 	prog := &Program{}
@@ -86,6 +117,9 @@ func LowerAll(registry map[string]*ast.Program, sortedPaths []string, result *ch
 			IsEntry: isEntry,
 			Path:    filePath,
 		}
+		if p.Module != nil {
+			mod.DeclName = p.Module.Name
+		}
 
 		for _, e := range p.Entities {
 			mod.Entities = append(mod.Entities, l.lowerEntity(e))
@@ -93,6 +127,9 @@ func LowerAll(registry map[string]*ast.Program, sortedPaths []string, result *ch
 		for _, e := range p.Enums {
 			mod.Enums = append(mod.Enums, l.lowerEnum(e))
 		}
+		for _, t := range p.Traits {
+			mod.Traits = append(mod.Traits, l.lowerTrait(t))
+		}
 		for _, f := range p.Functions {
 			mod.Functions = append(mod.Functions, l.lowerFunction(f))
 		}
@@ -103,16 +140,21 @@ func LowerAll(registry map[string]*ast.Program, sortedPaths []string, result *ch
 		prog.Modules = append(prog.Modules, mod)
 	}
 
+	monomorphize(prog.Modules)
 	return prog
 }
 
 // --- Top-level lowering ---
 
 func (l *lowerer) lowerFunction(f *ast.FunctionDecl) *Function {
+	l.typeParams = checker.TypeParamScope(f.TypeParams)
+	defer func() { l.typeParams = nil }()
+
 	fn := &Function{
 		Name:       f.Name,
 		IsEntry:    f.IsEntry,
 		IsPublic:   f.IsPublic,
+		TypeParams: typeParamNames(f.TypeParams),
 		ReturnType: l.resolveTypeRef(f.ReturnType),
 	}
 
@@ -136,9 +178,16 @@ func (l *lowerer) lowerFunction(f *ast.FunctionDecl) *Function {
 }
 
 func (l *lowerer) lowerEntity(e *ast.EntityDecl) *Entity {
+	l.typeParams = checker.TypeParamScope(e.TypeParams)
+	defer func() { l.typeParams = nil }()
+
 	ent := &Entity{
-		Name:     e.Name,
-		IsPublic: e.IsPublic,
+		Name:       e.Name,
+		IsPublic:   e.IsPublic,
+		TypeParams: typeParamNames(e.TypeParams),
+	}
+	for _, ref := range e.Implements {
+		ent.Implements = append(ent.Implements, ref.Name)
 	}
 
 	for _, f := range e.Fields {
@@ -150,8 +199,13 @@ func (l *lowerer) lowerEntity(e *ast.EntityDecl) *Entity {
 
 	for _, inv := range e.Invariants {
 		ent.Invariants = append(ent.Invariants, &Contract{
-			Expr:    l.lowerExpr(inv.Expr),
-			RawText: inv.RawText,
+			Expr:        l.lowerExpr(inv.Expr),
+			RawText:     inv.RawText,
+			AlwaysCheck: inv.AlwaysCheck,
+			Line:        inv.Line,
+			Column:      inv.Column,
+			EndLine:     inv.EndLine,
+			EndColumn:   inv.EndColumn,
 		})
 	}
 
@@ -232,9 +286,13 @@ func (l *lowerer) lowerMethod(m *ast.MethodDecl) *Method {
 }
 
 func (l *lowerer) lowerEnum(e *ast.EnumDecl) *Enum {
+	l.typeParams = checker.TypeParamScope(e.TypeParams)
+	defer func() { l.typeParams = nil }()
+
 	en := &Enum{
-		Name:     e.Name,
-		IsPublic: e.IsPublic,
+		Name:       e.Name,
+		IsPublic:   e.IsPublic,
+		TypeParams: typeParamNames(e.TypeParams),
 	}
 	for _, v := range e.Variants {
 		variant := &EnumVariant{Name: v.Name}
@@ -249,6 +307,14 @@ func (l *lowerer) lowerEnum(e *ast.EnumDecl) *Enum {
 	return en
 }
 
+func (l *lowerer) lowerTrait(t *ast.TraitDecl) *Trait {
+	trait := &Trait{Name: t.Name, IsPublic: t.IsPublic}
+	for _, m := range t.Methods {
+		trait.Methods = append(trait.Methods, l.lowerMethod(m))
+	}
+	return trait
+}
+
 func (l *lowerer) lowerIntent(i *ast.IntentDecl) *Intent {
 	intent := &Intent{
 		Description: i.Description,
@@ -264,16 +330,26 @@ func (l *lowerer) lowerIntent(i *ast.IntentDecl) *Intent {
 
 func (l *lowerer) lowerContract(c *ast.ContractClause) *Contract {
 	return &Contract{
-		Expr:    l.lowerExpr(c.Expr),
-		RawText: c.RawText,
+		Expr:        l.lowerExpr(c.Expr),
+		RawText:     c.RawText,
+		AlwaysCheck: c.AlwaysCheck,
+		Line:        c.Line,
+		Column:      c.Column,
+		EndLine:     c.EndLine,
+		EndColumn:   c.EndColumn,
 	}
 }
 
 // lowerContractWithOld lowers a contract clause, replacing OldExpr with OldRef.
 func (l *lowerer) lowerContractWithOld(c *ast.ContractClause) *Contract {
 	return &Contract{
-		Expr:    l.lowerExprWithOld(c.Expr),
-		RawText: c.RawText,
+		Expr:        l.lowerExprWithOld(c.Expr),
+		RawText:     c.RawText,
+		AlwaysCheck: c.AlwaysCheck,
+		Line:        c.Line,
+		Column:      c.Column,
+		EndLine:     c.EndLine,
+		EndColumn:   c.EndColumn,
 	}
 }
 
@@ -320,12 +396,14 @@ func (l *lowerer) scanOldExprs(e ast.Expression) {
 			l.scanOldExprs(expr.Domain.Start)
 			l.scanOldExprs(expr.Domain.End)
 		}
+		l.scanOldExprs(expr.Map)
 		l.scanOldExprs(expr.Body)
 	case *ast.ExistsExpr:
 		if expr.Domain != nil {
 			l.scanOldExprs(expr.Domain.Start)
 			l.scanOldExprs(expr.Domain.End)
 		}
+		l.scanOldExprs(expr.Map)
 		l.scanOldExprs(expr.Body)
 	case *ast.IndexExpr:
 		l.scanOldExprs(expr.Object)
@@ -372,9 +450,9 @@ func (l *lowerer) lowerExprWithOld(e ast.Expression) Expr {
 		if expr.Op == lexer.PLUS && l.isStringType(expr.Left) && l.isStringType(expr.Right) {
 			return &StringConcat{Left: left, Right: right, Type: t}
 		}
-		return &BinaryExpr{Left: left, Op: expr.Op, Right: right, Type: t}
+		return &BinaryExpr{Left: left, Op: expr.Op, Right: right, Type: t, Line: expr.Line, Column: expr.Column}
 	case *ast.UnaryExpr:
-		return &UnaryExpr{Op: expr.Op, Operand: l.lowerExprWithOld(expr.Operand), Type: l.typeOf(e)}
+		return &UnaryExpr{Op: expr.Op, Operand: l.lowerExprWithOld(expr.Operand), Type: l.typeOf(e), Line: expr.Line, Column: expr.Column}
 	case *ast.CallExpr:
 		return l.lowerCallExprWithOldArgs(expr, e)
 	case *ast.MethodCallExpr:
@@ -383,12 +461,20 @@ func (l *lowerer) lowerExprWithOld(e ast.Expression) Expr {
 		return &FieldAccessExpr{Object: l.lowerExprWithOld(expr.Object), Field: expr.Field, Type: l.typeOf(e)}
 	case *ast.ForallExpr:
 		domain := l.lowerRangeExprWithOld(expr.Domain)
-		return &ForallExpr{Variable: expr.Variable, Domain: domain, Body: l.lowerExprWithOld(expr.Body), Type: l.typeOf(e)}
+		var m Expr
+		if expr.Map != nil {
+			m = l.lowerExprWithOld(expr.Map)
+		}
+		return &ForallExpr{Variable: expr.Variable, Domain: domain, Map: m, Body: l.lowerExprWithOld(expr.Body), Type: l.typeOf(e)}
 	case *ast.ExistsExpr:
 		domain := l.lowerRangeExprWithOld(expr.Domain)
-		return &ExistsExpr{Variable: expr.Variable, Domain: domain, Body: l.lowerExprWithOld(expr.Body), Type: l.typeOf(e)}
+		var m Expr
+		if expr.Map != nil {
+			m = l.lowerExprWithOld(expr.Map)
+		}
+		return &ExistsExpr{Variable: expr.Variable, Domain: domain, Map: m, Body: l.lowerExprWithOld(expr.Body), Type: l.typeOf(e)}
 	case *ast.IndexExpr:
-		return &IndexExpr{Object: l.lowerExprWithOld(expr.Object), Index: l.lowerExprWithOld(expr.Index), Type: l.typeOf(e)}
+		return &IndexExpr{Object: l.lowerExprWithOld(expr.Object), Index: l.lowerExprWithOld(expr.Index), Type: l.typeOf(e), Line: expr.Line, Column: expr.Column}
 	default:
 		return l.lowerExpr(e)
 	}
@@ -412,11 +498,16 @@ func (l *lowerer) lowerCallExprWithOldArgs(expr *ast.CallExpr, orig ast.Expressi
 	}
 	kind, enumName := l.resolveCallKind(expr)
 	return &CallExpr{
-		Function: expr.Function,
-		Args:     args,
-		Kind:     kind,
-		EnumName: enumName,
-		Type:     l.typeOf(orig),
+		Function:  expr.Function,
+		Args:      args,
+		Kind:      kind,
+		EnumName:  enumName,
+		TypeArgs:  l.typeArgs[orig],
+		Type:      l.typeOf(orig),
+		Line:      expr.Line,
+		Column:    expr.Column,
+		EndLine:   expr.EndLine,
+		EndColumn: expr.EndColumn,
 	}
 }
 
@@ -427,10 +518,14 @@ func (l *lowerer) lowerMethodCallExprWithOld(expr *ast.MethodCallExpr, orig ast.
 	}
 	obj := l.lowerExprWithOld(expr.Object)
 	return &MethodCallExpr{
-		Object: obj,
-		Method: expr.Method,
-		Args:   args,
-		Type:   l.typeOf(orig),
+		Object:    obj,
+		Method:    expr.Method,
+		Args:      args,
+		Type:      l.typeOf(orig),
+		Line:      expr.Line,
+		Column:    expr.Column,
+		EndLine:   expr.EndLine,
+		EndColumn: expr.EndColumn,
 	}
 }
 
@@ -473,9 +568,10 @@ func (l *lowerer) lowerStmt(s ast.Statement) Stmt {
 		return l.lowerWhileStmt(stmt)
 	case *ast.ForInStmt:
 		return &ForInStmt{
-			Variable: stmt.Variable,
-			Iterable: l.lowerExpr(stmt.Iterable),
-			Body:     l.lowerBlock(stmt.Body),
+			Variable:      stmt.Variable,
+			ValueVariable: stmt.ValueVariable,
+			Iterable:      l.lowerExpr(stmt.Iterable),
+			Body:          l.lowerBlock(stmt.Body),
 		}
 	case *ast.BreakStmt:
 		return &BreakStmt{}
@@ -564,6 +660,15 @@ func (l *lowerer) lowerWhileStmt(stmt *ast.WhileStmt) *WhileStmt {
 // --- Expression lowering ---
 
 func (l *lowerer) lowerExpr(e ast.Expression) Expr {
+	if t, ok := l.upcasts[e]; ok {
+		return &UpcastExpr{Value: l.lowerValue(e), Type: t}
+	}
+	return l.lowerValue(e)
+}
+
+// lowerValue lowers e without the conversion to a trait value the checker
+// may have recorded for it
+func (l *lowerer) lowerValue(e ast.Expression) Expr {
 	if e == nil {
 		return nil
 	}
@@ -576,13 +681,15 @@ func (l *lowerer) lowerExpr(e ast.Expression) Expr {
 		if expr.Op == lexer.PLUS && l.isStringType(expr.Left) && l.isStringType(expr.Right) {
 			return &StringConcat{Left: left, Right: right, Type: t}
 		}
-		return &BinaryExpr{Left: left, Op: expr.Op, Right: right, Type: t}
+		return &BinaryExpr{Left: left, Op: expr.Op, Right: right, Type: t, Line: expr.Line, Column: expr.Column}
 
 	case *ast.UnaryExpr:
 		return &UnaryExpr{
 			Op:      expr.Op,
 			Operand: l.lowerExpr(expr.Operand),
 			Type:    l.typeOf(e),
+			Line:    expr.Line,
+			Column:  expr.Column,
 		}
 
 	case *ast.CallExpr:
@@ -592,11 +699,16 @@ func (l *lowerer) lowerExpr(e ast.Expression) Expr {
 		}
 		kind, enumName := l.resolveCallKind(expr)
 		return &CallExpr{
-			Function: expr.Function,
-			Args:     args,
-			Kind:     kind,
-			EnumName: enumName,
-			Type:     l.typeOf(e),
+			Function:  expr.Function,
+			Args:      args,
+			Kind:      kind,
+			EnumName:  enumName,
+			TypeArgs:  l.typeArgs[e],
+			Type:      l.typeOf(e),
+			Line:      expr.Line,
+			Column:    expr.Column,
+			EndLine:   expr.EndLine,
+			EndColumn: expr.EndColumn,
 		}
 
 	case *ast.MethodCallExpr:
@@ -685,6 +797,8 @@ func (l *lowerer) lowerExpr(e ast.Expression) Expr {
 			Object: l.lowerExpr(expr.Object),
 			Index:  l.lowerExpr(expr.Index),
 			Type:   l.typeOf(e),
+			Line:   expr.Line,
+			Column: expr.Column,
 		}
 
 	case *ast.RangeExpr:
@@ -703,9 +817,14 @@ func (l *lowerer) lowerExpr(e ast.Expression) Expr {
 				Type:  l.typeOf(expr.Domain),
 			}
 		}
+		var m Expr
+		if expr.Map != nil {
+			m = l.lowerExpr(expr.Map)
+		}
 		return &ForallExpr{
 			Variable: expr.Variable,
 			Domain:   domain,
+			Map:      m,
 			Body:     l.lowerExpr(expr.Body),
 			Type:     l.typeOf(e),
 		}
@@ -719,9 +838,14 @@ func (l *lowerer) lowerExpr(e ast.Expression) Expr {
 				Type:  l.typeOf(expr.Domain),
 			}
 		}
+		var m Expr
+		if expr.Map != nil {
+			m = l.lowerExpr(expr.Map)
+		}
 		return &ExistsExpr{
 			Variable: expr.Variable,
 			Domain:   domain,
+			Map:      m,
 			Body:     l.lowerExpr(expr.Body),
 			Type:     l.typeOf(e),
 		}
@@ -757,6 +881,9 @@ func (l *lowerer) lowerMethodCallExpr(expr *ast.MethodCallExpr, orig ast.Express
 			// Object has no type - likely a module name
 			isModuleCall = true
 			moduleName = ident.Name
+			if name, ok := l.moduleNames[moduleName]; ok {
+				moduleName = name
+			}
 		}
 	}
 
@@ -768,7 +895,12 @@ func (l *lowerer) lowerMethodCallExpr(expr *ast.MethodCallExpr, orig ast.Express
 		Args:         args,
 		IsModuleCall: isModuleCall,
 		ModuleName:   moduleName,
+		TypeArgs:     l.typeArgs[orig],
 		Type:         l.typeOf(orig),
+		Line:         expr.Line,
+		Column:       expr.Column,
+		EndLine:      expr.EndLine,
+		EndColumn:    expr.EndColumn,
 	}
 
 	if isModuleCall {
@@ -846,14 +978,22 @@ func (l *lowerer) resolveTypeRef(ref *ast.TypeRef) *checker.Type {
 	if ref == nil {
 		return checker.TypeVoid
 	}
-	return checker.ResolveType(ref, l.entities, l.enums)
+	return checker.ResolveTypeIn(ref, l.entities, l.enums, l.traits, l.typeParams)
+}
+
+func typeParamNames(params []*ast.TypeParam) []string {
+	var names []string
+	for _, p := range params {
+		names = append(names, p.Name)
+	}
+	return names
 }
 
 // resolveCallKind determines the CallKind for a CallExpr.
 func (l *lowerer) resolveCallKind(expr *ast.CallExpr) (CallKind, string) {
 	// Builtins
 	switch expr.Function {
-	case "print", "len":
+	case "print", "len", "Map":
 		return CallBuiltin, ""
 	case "Ok", "Err", "Some":
 		return CallBuiltin, ""
@@ -1,6 +1,7 @@
 package ir
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/lhaig/intent/internal/checker"
@@ -306,3 +307,233 @@ entry function main() returns Int {
 		t.Error("expected Bool type on bool literal")
 	}
 }
+
+func TestLowerOperatorPositions(t *testing.T) {
+	src := `module test version "1.0";
+function f(a: Int, b: Int) returns Int
+    requires b != 0
+{
+    return -a + a / b;
+}
+`
+	mod := parseAndLower(t, src)
+	ret := mod.Functions[0].Body[0].(*ReturnStmt)
+	sum, ok := ret.Value.(*BinaryExpr)
+	if !ok {
+		t.Fatalf("expected BinaryExpr, got %T", ret.Value)
+	}
+	if sum.Line != 5 || sum.Column != 15 {
+		t.Errorf("expected + at 5:15, got %d:%d", sum.Line, sum.Column)
+	}
+	if neg := sum.Left.(*UnaryExpr); neg.Line != 5 || neg.Column != 12 {
+		t.Errorf("expected unary - at 5:12, got %d:%d", neg.Line, neg.Column)
+	}
+	if got := FormatExpr(sum); got != "-a + (a / b)" {
+		t.Errorf("expected source text %q, got %q", "-a + (a / b)", got)
+	}
+	if got := FormatExpr(mod.Functions[0].Requires[0].Expr); got != "b != 0" {
+		t.Errorf("expected %q, got %q", "b != 0", got)
+	}
+}
+
+func TestLowerCallPositions(t *testing.T) {
+	src := `module test version "1.0";
+function inc(x: Int) returns Int
+    ensures result > x
+{
+    return x + 1;
+}
+entry function main() returns Int {
+    let xs: Array<Int> = [1];
+    return inc(len(xs));
+}
+`
+	mod := parseAndLower(t, src)
+	ret := mod.Functions[1].Body[1].(*ReturnStmt)
+	call, ok := ret.Value.(*CallExpr)
+	if !ok {
+		t.Fatalf("expected CallExpr, got %T", ret.Value)
+	}
+	if call.Line != 9 || call.Column != 12 || call.EndLine != 9 || call.EndColumn != 24 {
+		t.Errorf("expected inc call at 9:12-9:24, got %d:%d-%d:%d", call.Line, call.Column, call.EndLine, call.EndColumn)
+	}
+	if arg := call.Args[0].(*CallExpr); arg.Line != 9 || arg.Column != 16 || arg.EndColumn != 23 {
+		t.Errorf("expected len call at 9:16-9:23, got %d:%d-%d:%d", arg.Line, arg.Column, arg.EndLine, arg.EndColumn)
+	}
+	if ens := mod.Functions[0].Ensures[0]; ens.Line != 3 || ens.Column != 5 || ens.EndLine != 3 || ens.EndColumn != 23 {
+		t.Errorf("expected ensures at 3:5-3:23, got %d:%d-%d:%d", ens.Line, ens.Column, ens.EndLine, ens.EndColumn)
+	}
+}
+
+func TestMonomorphize(t *testing.T) {
+	src := `module test version "1.0";
+function max<T: Ord>(a: T, b: T) returns T
+    ensures result >= a
+{
+    if a > b { return a; }
+    return b;
+}
+entity Box<T> {
+    field value: T;
+    constructor(v: T) { self.value = v; }
+    method get() returns T { return self.value; }
+}
+enum Tree<T> {
+    Leaf(value: T),
+    Empty,
+}
+function unwrap<T>(t: Tree<T>, d: T) returns T {
+    return match t {
+        Leaf(v) => v,
+        Empty => d,
+    };
+}
+entry function main() returns Int {
+    let b: Box<Int> = Box(max(1, 2));
+    let s: String = max("a", "b");
+    let t: Tree<Int> = Leaf(b.get());
+    return unwrap(t, 0);
+}
+`
+	mod := parseAndLower(t, src)
+
+	var funcs []string
+	for _, fn := range mod.Functions {
+		if len(fn.TypeParams) > 0 {
+			t.Errorf("expected generic function %s left out", fn.Name)
+		}
+		funcs = append(funcs, fn.Name)
+	}
+	want := []string{"main", "max__Int", "max__String", "unwrap__Int"}
+	if strings.Join(funcs, ",") != strings.Join(want, ",") {
+		t.Errorf("expected functions %v, got %v", want, funcs)
+	}
+	if len(mod.Entities) != 1 || mod.Entities[0].Name != "Box__Int" {
+		t.Fatalf("expected only Box__Int, got %d entities", len(mod.Entities))
+	}
+	if got := mod.Entities[0].Fields[0].Type.Name; got != "Int" {
+		t.Errorf("expected Box__Int.value of type Int, got %s", got)
+	}
+	if len(mod.Enums) != 1 || mod.Enums[0].Name != "Tree__Int" {
+		t.Fatalf("expected only Tree__Int, got %d enums", len(mod.Enums))
+	}
+
+	main := mod.Functions[0]
+	let := main.Body[0].(*LetStmt)
+	ctor, ok := let.Value.(*CallExpr)
+	if !ok || ctor.Function != "Box__Int" || ctor.Kind != CallConstructor {
+		t.Fatalf("expected a Box__Int constructor call, got %s", FormatExpr(let.Value))
+	}
+	if call := ctor.Args[0].(*CallExpr); call.Function != "max__Int" {
+		t.Errorf("expected a call to max__Int, got %s", call.Function)
+	}
+	if let.Type.Name != "Box__Int" {
+		t.Errorf("expected let of type Box__Int, got %s", let.Type.Name)
+	}
+	if errs := Validate(mod); len(errs) > 0 {
+		t.Errorf("validation errors: %v", errs)
+	}
+}
+
+func TestLowerTraits(t *testing.T) {
+	src := `module test version "1.0";
+trait Shape {
+    method area() returns Int
+        ensures result >= 0;
+}
+entity Square implements Shape {
+    field side: Int;
+    constructor(side: Int) { self.side = side; }
+    method area() returns Int { return self.side * self.side; }
+}
+entity Box<T> implements Shape {
+    field value: T;
+    constructor(v: T) { self.value = v; }
+    method area() returns Int { return 0; }
+}
+function pick(s: Square) returns Shape {
+    return s;
+}
+entry function main() returns Int {
+    let shapes: Array<Shape> = [Square(1), Box(true)];
+    return pick(Square(2)).area();
+}
+`
+	mod := parseAndLower(t, src)
+
+	if len(mod.Traits) != 1 || mod.Traits[0].Name != "Shape" {
+		t.Fatalf("expected trait Shape, got %d traits", len(mod.Traits))
+	}
+	area := mod.Traits[0].Methods[0]
+	if area.Body != nil || len(area.Ensures) != 1 || area.ReturnType.Name != "Int" {
+		t.Errorf("unexpected trait method: %+v", area)
+	}
+	for _, ent := range mod.Entities {
+		if len(ent.Implements) != 1 || ent.Implements[0] != "Shape" {
+			t.Errorf("expected %s to implement Shape, got %v", ent.Name, ent.Implements)
+		}
+	}
+
+	pick := mod.Functions[0]
+	ret := pick.Body[0].(*ReturnStmt)
+	up, ok := ret.Value.(*UpcastExpr)
+	if !ok || up.Type.Name != "Shape" || up.Value.ExprType().Name != "Square" {
+		t.Fatalf("expected Square upcast to Shape, got %s", FormatExpr(ret.Value))
+	}
+
+	main := mod.Functions[1]
+	lit := main.Body[0].(*LetStmt).Value.(*ArrayLit)
+	for _, el := range lit.Elements {
+		if _, ok := el.(*UpcastExpr); !ok {
+			t.Errorf("expected element upcast to Shape, got %s", FormatExpr(el))
+		}
+	}
+	if got := lit.Elements[1].(*UpcastExpr).Value.ExprType().Name; got != "Box__Bool" {
+		t.Errorf("expected Box__Bool upcast, got %s", got)
+	}
+	if errs := Validate(mod); len(errs) > 0 {
+		t.Errorf("validation errors: %v", errs)
+	}
+}
+
+func TestLowerMaps(t *testing.T) {
+	src := `module test version "1.0";
+function count<T>(m: Map<String, T>) returns Int
+    requires forall k in m: m.contains(k)
+{
+    let mutable n: Int = 0;
+    for k, v in m {
+        n = n + 1;
+    }
+    return n;
+}
+entry function main() returns Int {
+    let mutable m: Map<String, Bool> = Map();
+    m.set("a", true);
+    return count(m);
+}
+`
+	mod := parseAndLower(t, src)
+
+	count := mod.Functions[1]
+	if count.Name != "count__Bool" {
+		t.Fatalf("expected count__Bool, got %s", count.Name)
+	}
+	forall := count.Requires[0].Expr.(*ForallExpr)
+	if forall.Domain != nil || forall.Map == nil || forall.Map.ExprType().String() != "Map<String, Bool>" {
+		t.Errorf("expected forall over the keys of a Map<String, Bool>, got %s", FormatExpr(forall))
+	}
+	loop := count.Body[1].(*ForInStmt)
+	if loop.Variable != "k" || loop.ValueVariable != "v" {
+		t.Errorf("expected for k, v, got for %s, %s", loop.Variable, loop.ValueVariable)
+	}
+
+	main := mod.Functions[0]
+	call := main.Body[0].(*LetStmt).Value.(*CallExpr)
+	if call.Function != "Map" || call.Kind != CallBuiltin || call.Type.String() != "Map<String, Bool>" {
+		t.Errorf("expected builtin Map() call, got %s (%v)", FormatExpr(call), call.Kind)
+	}
+	if errs := Validate(mod); len(errs) > 0 {
+		t.Errorf("validation errors: %v", errs)
+	}
+}
@@ -0,0 +1,530 @@
+package ir
+
+import (
+	"strings"
+
+	"github.com/lhaig/intent/internal/checker"
+)
+
+// Monomorphization replaces each generic function, entity and enum with one
+// copy per list of type arguments it is used with. Copies are named after
+// their arguments, so max<T> used with Int and String becomes max__Int and
+// max__String, and Stack<Int> becomes the entity Stack__Int. Every type,
+// call and match in the program is rewritten to match, so the backends and
+// the verifier only ever see concrete types. Instances are added to the
+// module that declares the generic, after its other declarations, and
+// generics that are never used are dropped.
+
+// generic is a generic declaration and the module that declares it.
+type generic struct {
+	mod    *Module
+	params []string
+	fn     *Function
+	ent    *Entity
+	enum   *Enum
+}
+
+// instance is a requested copy of a generic declaration.
+type instance struct {
+	generic *generic
+	name    string
+	subst   map[string]*checker.Type
+}
+
+type monomorphizer struct {
+	funcs map[string]*generic // generic functions by name
+	types map[string]*generic // generic entities and enums by name
+	seen  map[string]bool     // instances already queued, by name
+	queue []*instance
+	enums map[string]*checker.EnumInfo // EnumInfo of each enum instance
+}
+
+// monomorphize rewrites mods in place. Modules without generic declarations
+// are left untouched.
+func monomorphize(mods []*Module) {
+	m := &monomorphizer{
+		funcs: make(map[string]*generic),
+		types: make(map[string]*generic),
+		seen:  make(map[string]bool),
+		enums: make(map[string]*checker.EnumInfo),
+	}
+	for _, mod := range mods {
+		for _, fn := range mod.Functions {
+			if len(fn.TypeParams) > 0 {
+				m.funcs[fn.Name] = &generic{mod: mod, params: fn.TypeParams, fn: fn}
+			}
+		}
+		for _, ent := range mod.Entities {
+			if len(ent.TypeParams) > 0 {
+				m.types[ent.Name] = &generic{mod: mod, params: ent.TypeParams, ent: ent}
+			}
+		}
+		for _, en := range mod.Enums {
+			if len(en.TypeParams) > 0 {
+				m.types[en.Name] = &generic{mod: mod, params: en.TypeParams, enum: en}
+			}
+		}
+	}
+	if len(m.funcs) == 0 && len(m.types) == 0 {
+		return
+	}
+
+	// Rewrite the concrete declarations, queueing the instances they use
+	c := &cloner{m: m}
+	for _, mod := range mods {
+		var fns []*Function
+		for _, fn := range mod.Functions {
+			if len(fn.TypeParams) == 0 {
+				fns = append(fns, c.function(fn, fn.Name))
+			}
+		}
+		var ents []*Entity
+		for _, ent := range mod.Entities {
+			if len(ent.TypeParams) == 0 {
+				ents = append(ents, c.entity(ent, ent.Name))
+			}
+		}
+		var enums []*Enum
+		for _, en := range mod.Enums {
+			if len(en.TypeParams) == 0 {
+				enums = append(enums, c.enum(en, en.Name))
+			}
+		}
+		var traits []*Trait
+		for _, t := range mod.Traits {
+			traits = append(traits, c.trait(t))
+		}
+		mod.Functions, mod.Entities, mod.Enums, mod.Traits = fns, ents, enums, traits
+	}
+
+	// Instances may use further instances, which join the queue
+	for len(m.queue) > 0 {
+		inst := m.queue[0]
+		m.queue = m.queue[1:]
+		c := &cloner{m: m, subst: inst.subst}
+		g := inst.generic
+		switch {
+		case g.fn != nil:
+			fn := c.function(g.fn, inst.name)
+			fn.IsEntry = false
+			g.mod.Functions = append(g.mod.Functions, fn)
+		case g.ent != nil:
+			g.mod.Entities = append(g.mod.Entities, c.entity(g.ent, inst.name))
+		case g.enum != nil:
+			g.mod.Enums = append(g.mod.Enums, c.enum(g.enum, inst.name))
+		}
+	}
+}
+
+// instance returns the name of the instance of g for args, which must not
+// contain type parameters, and queues it the first time it is requested.
+func (m *monomorphizer) instance(g *generic, name string, args []*checker.Type) string {
+	parts := []string{name}
+	for _, arg := range args {
+		parts = append(parts, mangleType(m.concrete(arg)))
+	}
+	mangled := parts[0] + "__" + strings.Join(parts[1:], "_")
+	if !m.seen[mangled] {
+		m.seen[mangled] = true
+		subst := make(map[string]*checker.Type, len(g.params))
+		for i, p := range g.params {
+			if i < len(args) {
+				subst[p] = args[i]
+			}
+		}
+		m.queue = append(m.queue, &instance{generic: g, name: mangled, subst: subst})
+	}
+	return mangled
+}
+
+// mangleType names a concrete type inside an instance name, e.g. Int or
+// Array_String.
+func mangleType(t *checker.Type) string {
+	name := t.Name
+	for _, p := range t.TypeParams {
+		name += "_" + mangleType(p)
+	}
+	return name
+}
+
+// concrete replaces the uses of generic entities and enums in t, whose type
+// parameters have already been substituted, with their instances.
+func (m *monomorphizer) concrete(t *checker.Type) *checker.Type {
+	if !m.usesGeneric(t) {
+		return t
+	}
+	if g := m.types[t.Name]; g != nil {
+		name := m.instance(g, t.Name, t.TypeParams)
+		if g.ent != nil {
+			return &checker.Type{Name: name, IsEntity: true, Entity: t.Entity}
+		}
+		return &checker.Type{Name: name, IsEnum: true, EnumInfo: m.enumInfo(name, t.EnumInfo)}
+	}
+
+	// Array, Result or Option of an instance
+	args := make([]*checker.Type, len(t.TypeParams))
+	for i, p := range t.TypeParams {
+		args[i] = m.concrete(p)
+	}
+	out := &checker.Type{Name: t.Name, IsEnum: t.IsEnum, IsGeneric: true, TypeParams: args}
+	if t.EnumInfo != nil {
+		out.EnumInfo = m.enumInfo(t.EnumInfo.Name, t.EnumInfo)
+	}
+	return out
+}
+
+// usesGeneric reports whether t refers to a generic entity or enum.
+func (m *monomorphizer) usesGeneric(t *checker.Type) bool {
+	if t == nil || !t.IsGeneric {
+		return false
+	}
+	if m.types[t.Name] != nil {
+		return true
+	}
+	for _, p := range t.TypeParams {
+		if m.usesGeneric(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// enumInfo copies info under name with concrete variant field types.
+func (m *monomorphizer) enumInfo(name string, info *checker.EnumInfo) *checker.EnumInfo {
+	if info == nil {
+		return nil
+	}
+	if cached, ok := m.enums[name]; ok {
+		return cached
+	}
+	out := &checker.EnumInfo{Name: name}
+	if m.types[info.Name] != nil {
+		// Only instances are cached: Result and Option differ per use
+		m.enums[name] = out
+	}
+	for _, v := range info.Variants {
+		variant := &checker.EnumVariantInfo{Name: v.Name}
+		for _, f := range v.Fields {
+			variant.Fields = append(variant.Fields, checker.ParamInfo{Name: f.Name, Type: m.concrete(f.Type)})
+		}
+		out.Variants = append(out.Variants, variant)
+	}
+	return out
+}
+
+// cloner copies declarations with the type parameters in subst replaced by
+// their arguments and every generic use replaced by its instance.
+type cloner struct {
+	m     *monomorphizer
+	subst map[string]*checker.Type
+}
+
+func (c *cloner) typ(t *checker.Type) *checker.Type {
+	return c.m.concrete(checker.Substitute(t, c.subst))
+}
+
+func (c *cloner) function(fn *Function, name string) *Function {
+	return &Function{
+		Name:       name,
+		IsEntry:    fn.IsEntry,
+		IsPublic:   fn.IsPublic,
+		Params:     c.params(fn.Params),
+		ReturnType: c.typ(fn.ReturnType),
+		Requires:   c.contracts(fn.Requires),
+		Ensures:    c.contracts(fn.Ensures),
+		Body:       c.stmts(fn.Body),
+	}
+}
+
+func (c *cloner) entity(ent *Entity, name string) *Entity {
+	out := &Entity{
+		Name:       name,
+		IsPublic:   ent.IsPublic,
+		Implements: ent.Implements,
+		Invariants: c.contracts(ent.Invariants),
+	}
+	for _, f := range ent.Fields {
+		out.Fields = append(out.Fields, &Field{Name: f.Name, Type: c.typ(f.Type)})
+	}
+	if ctor := ent.Constructor; ctor != nil {
+		out.Constructor = &Constructor{
+			Params:      c.params(ctor.Params),
+			Requires:    c.contracts(ctor.Requires),
+			Ensures:     c.contracts(ctor.Ensures),
+			OldCaptures: c.oldCaptures(ctor.OldCaptures),
+			Body:        c.stmts(ctor.Body),
+		}
+	}
+	for _, m := range ent.Methods {
+		out.Methods = append(out.Methods, c.method(m))
+	}
+	return out
+}
+
+func (c *cloner) method(m *Method) *Method {
+	return &Method{
+		Name:        m.Name,
+		Params:      c.params(m.Params),
+		ReturnType:  c.typ(m.ReturnType),
+		Requires:    c.contracts(m.Requires),
+		Ensures:     c.contracts(m.Ensures),
+		OldCaptures: c.oldCaptures(m.OldCaptures),
+		Body:        c.stmts(m.Body),
+	}
+}
+
+func (c *cloner) trait(t *Trait) *Trait {
+	out := &Trait{Name: t.Name, IsPublic: t.IsPublic}
+	for _, m := range t.Methods {
+		out.Methods = append(out.Methods, c.method(m))
+	}
+	return out
+}
+
+func (c *cloner) enum(en *Enum, name string) *Enum {
+	out := &Enum{Name: name, IsPublic: en.IsPublic}
+	for _, v := range en.Variants {
+		variant := &EnumVariant{Name: v.Name}
+		for _, f := range v.Fields {
+			variant.Fields = append(variant.Fields, &Field{Name: f.Name, Type: c.typ(f.Type)})
+		}
+		out.Variants = append(out.Variants, variant)
+	}
+	return out
+}
+
+func (c *cloner) params(params []*Param) []*Param {
+	var out []*Param
+	for _, p := range params {
+		out = append(out, &Param{Name: p.Name, Type: c.typ(p.Type)})
+	}
+	return out
+}
+
+func (c *cloner) contracts(clauses []*Contract) []*Contract {
+	var out []*Contract
+	for _, cl := range clauses {
+		out = append(out, &Contract{
+			Expr:        c.expr(cl.Expr),
+			RawText:     cl.RawText,
+			AlwaysCheck: cl.AlwaysCheck,
+			Line:        cl.Line,
+			Column:      cl.Column,
+			EndLine:     cl.EndLine,
+			EndColumn:   cl.EndColumn,
+		})
+	}
+	return out
+}
+
+func (c *cloner) oldCaptures(captures []*OldCapture) []*OldCapture {
+	var out []*OldCapture
+	for _, oc := range captures {
+		out = append(out, &OldCapture{Name: oc.Name, Expr: c.expr(oc.Expr)})
+	}
+	return out
+}
+
+func (c *cloner) stmts(stmts []Stmt) []Stmt {
+	if stmts == nil {
+		return nil
+	}
+	out := make([]Stmt, len(stmts))
+	for i, s := range stmts {
+		out[i] = c.stmt(s)
+	}
+	return out
+}
+
+func (c *cloner) stmt(s Stmt) Stmt {
+	switch s := s.(type) {
+	case *LetStmt:
+		return &LetStmt{Name: s.Name, Mutable: s.Mutable, Type: c.typ(s.Type), Value: c.expr(s.Value)}
+	case *AssignStmt:
+		return &AssignStmt{Target: c.expr(s.Target), Value: c.expr(s.Value)}
+	case *ReturnStmt:
+		return &ReturnStmt{Value: c.expr(s.Value)}
+	case *IfStmt:
+		return &IfStmt{Condition: c.expr(s.Condition), Then: c.stmts(s.Then), Else: c.stmts(s.Else)}
+	case *WhileStmt:
+		w := &WhileStmt{
+			Condition:   c.expr(s.Condition),
+			Invariants:  c.contracts(s.Invariants),
+			OldCaptures: c.oldCaptures(s.OldCaptures),
+			Body:        c.stmts(s.Body),
+		}
+		if s.Decreases != nil {
+			w.Decreases = &DecreasesClause{Expr: c.expr(s.Decreases.Expr), RawText: s.Decreases.RawText}
+		}
+		return w
+	case *ForInStmt:
+		return &ForInStmt{Variable: s.Variable, ValueVariable: s.ValueVariable, Iterable: c.expr(s.Iterable), Body: c.stmts(s.Body)}
+	case *ExprStmt:
+		return &ExprStmt{Expr: c.expr(s.Expr)}
+	}
+	// BreakStmt and ContinueStmt carry nothing to rewrite
+	return s
+}
+
+func (c *cloner) exprs(exprs []Expr) []Expr {
+	if exprs == nil {
+		return nil
+	}
+	out := make([]Expr, len(exprs))
+	for i, e := range exprs {
+		out[i] = c.expr(e)
+	}
+	return out
+}
+
+func (c *cloner) expr(e Expr) Expr {
+	switch e := e.(type) {
+	case nil:
+		return nil
+	case *BinaryExpr:
+		return &BinaryExpr{Left: c.expr(e.Left), Op: e.Op, Right: c.expr(e.Right), Type: c.typ(e.Type), Line: e.Line, Column: e.Column}
+	case *UnaryExpr:
+		return &UnaryExpr{Op: e.Op, Operand: c.expr(e.Operand), Type: c.typ(e.Type), Line: e.Line, Column: e.Column}
+	case *CallExpr:
+		return c.call(e)
+	case *MethodCallExpr:
+		return c.methodCall(e)
+	case *FieldAccessExpr:
+		return &FieldAccessExpr{Object: c.expr(e.Object), Field: e.Field, Type: c.typ(e.Type)}
+	case *IndexExpr:
+		return &IndexExpr{Object: c.expr(e.Object), Index: c.expr(e.Index), Type: c.typ(e.Type), Line: e.Line, Column: e.Column}
+	case *OldRef:
+		return &OldRef{Name: e.Name, Type: c.typ(e.Type)}
+	case *VarRef:
+		return &VarRef{Name: e.Name, Type: c.typ(e.Type)}
+	case *SelfRef:
+		return &SelfRef{Type: c.typ(e.Type)}
+	case *ResultRef:
+		return &ResultRef{Type: c.typ(e.Type)}
+	case *IntLit:
+		return &IntLit{Value: e.Value, Type: c.typ(e.Type)}
+	case *FloatLit:
+		return &FloatLit{Value: e.Value, Type: c.typ(e.Type)}
+	case *StringLit:
+		return &StringLit{Value: e.Value, Type: c.typ(e.Type)}
+	case *BoolLit:
+		return &BoolLit{Value: e.Value, Type: c.typ(e.Type)}
+	case *ArrayLit:
+		return &ArrayLit{Elements: c.exprs(e.Elements), Type: c.typ(e.Type)}
+	case *RangeExpr:
+		return c.rangeExpr(e)
+	case *ForallExpr:
+		return &ForallExpr{Variable: e.Variable, Domain: c.rangeExpr(e.Domain), Map: c.expr(e.Map), Body: c.expr(e.Body), Type: c.typ(e.Type)}
+	case *ExistsExpr:
+		return &ExistsExpr{Variable: e.Variable, Domain: c.rangeExpr(e.Domain), Map: c.expr(e.Map), Body: c.expr(e.Body), Type: c.typ(e.Type)}
+	case *MatchExpr:
+		return c.match(e)
+	case *TryExpr:
+		return &TryExpr{Expr: c.expr(e.Expr), Type: c.typ(e.Type)}
+	case *StringInterp:
+		out := &StringInterp{Type: c.typ(e.Type)}
+		for _, part := range e.Parts {
+			out.Parts = append(out.Parts, StringInterpPart{IsExpr: part.IsExpr, Static: part.Static, Expr: c.expr(part.Expr)})
+		}
+		return out
+	case *StringConcat:
+		return &StringConcat{Left: c.expr(e.Left), Right: c.expr(e.Right), Type: c.typ(e.Type)}
+	case *UpcastExpr:
+		return &UpcastExpr{Value: c.expr(e.Value), Type: e.Type}
+	}
+	return e
+}
+
+func (c *cloner) rangeExpr(r *RangeExpr) *RangeExpr {
+	if r == nil {
+		return nil
+	}
+	return &RangeExpr{Start: c.expr(r.Start), End: c.expr(r.End), Type: c.typ(r.Type)}
+}
+
+// call points calls to generic functions, constructors of generic entities
+// and variants of generic enums at their instances.
+func (c *cloner) call(e *CallExpr) *CallExpr {
+	out := &CallExpr{
+		Function:  e.Function,
+		Args:      c.exprs(e.Args),
+		Kind:      e.Kind,
+		EnumName:  e.EnumName,
+		Type:      c.typ(e.Type),
+		Line:      e.Line,
+		Column:    e.Column,
+		EndLine:   e.EndLine,
+		EndColumn: e.EndColumn,
+	}
+	switch e.Kind {
+	case CallFunction:
+		if g := c.m.funcs[e.Function]; g != nil {
+			out.Function = c.m.instance(g, e.Function, c.typeArgs(e.TypeArgs))
+		}
+	case CallConstructor:
+		if c.m.types[e.Function] != nil && out.Type != nil {
+			out.Function = out.Type.Name
+		}
+	case CallVariant:
+		if c.m.types[e.EnumName] != nil && out.Type != nil {
+			out.EnumName = out.Type.Name
+		}
+	}
+	return out
+}
+
+func (c *cloner) methodCall(e *MethodCallExpr) *MethodCallExpr {
+	out := &MethodCallExpr{
+		Object:       c.expr(e.Object),
+		Method:       e.Method,
+		Args:         c.exprs(e.Args),
+		IsModuleCall: e.IsModuleCall,
+		ModuleName:   e.ModuleName,
+		CallKind:     e.CallKind,
+		EnumName:     e.EnumName,
+		Type:         c.typ(e.Type),
+		Line:         e.Line,
+		Column:       e.Column,
+		EndLine:      e.EndLine,
+		EndColumn:    e.EndColumn,
+	}
+	if e.IsModuleCall {
+		switch e.CallKind {
+		case CallFunction:
+			if g := c.m.funcs[e.Method]; g != nil {
+				out.Method = c.m.instance(g, e.Method, c.typeArgs(e.TypeArgs))
+			}
+		case CallConstructor:
+			if c.m.types[e.Method] != nil && out.Type != nil {
+				out.Method = out.Type.Name
+			}
+		}
+	}
+	return out
+}
+
+// typeArgs substitutes the enclosing instance's arguments into the type
+// arguments of a call made from generic code.
+func (c *cloner) typeArgs(args []*checker.Type) []*checker.Type {
+	out := make([]*checker.Type, len(args))
+	for i, a := range args {
+		out[i] = checker.Substitute(a, c.subst)
+	}
+	return out
+}
+
+func (c *cloner) match(e *MatchExpr) *MatchExpr {
+	out := &MatchExpr{Scrutinee: c.expr(e.Scrutinee), Type: c.typ(e.Type)}
+	enumName := ""
+	if t := out.Scrutinee.ExprType(); t != nil {
+		enumName = t.Name
+	}
+	for _, arm := range e.Arms {
+		p := *arm.Pattern
+		if c.m.types[p.EnumName] != nil {
+			p.EnumName = enumName
+		}
+		out.Arms = append(out.Arms, &MatchArm{Pattern: &p, Body: c.expr(arm.Body)})
+	}
+	return out
+}
@@ -13,11 +13,13 @@ type Program struct {
 // Module represents a single Intent source file after lowering.
 type Module struct {
 	Name      string
+	DeclName  string // name from the module declaration; qualified calls may use either
 	IsEntry   bool
 	Path      string // original file path
 	Functions []*Function
 	Entities  []*Entity
 	Enums     []*Enum
+	Traits    []*Trait
 	Intents   []*Intent
 }
 
@@ -26,6 +28,7 @@ type Function struct {
 	Name       string
 	IsEntry    bool
 	IsPublic   bool
+	TypeParams []string // type parameter names; empty once monomorphized
 	Params     []*Param
 	ReturnType *checker.Type
 	Requires   []*Contract
@@ -43,6 +46,8 @@ type Param struct {
 type Entity struct {
 	Name        string
 	IsPublic    bool
+	TypeParams  []string // type parameter names; empty once monomorphized
+	Implements  []string // names of the traits the entity implements
 	Fields      []*Field
 	Invariants  []*Contract
 	Constructor *Constructor
@@ -64,7 +69,16 @@ type Constructor struct {
 	Body        []Stmt
 }
 
-// Method represents an entity method.
+// Trait represents a trait declaration. Its methods have contracts but no
+// body.
+type Trait struct {
+	Name     string
+	IsPublic bool
+	Methods  []*Method
+}
+
+// Method represents an entity method, or a trait method signature when
+// Body is nil.
 type Method struct {
 	Name        string
 	Params      []*Param
@@ -84,8 +98,11 @@ type OldCapture struct {
 
 // Contract represents a requires/ensures/invariant clause.
 type Contract struct {
-	Expr    Expr
-	RawText string // original source text for error messages
+	Expr               Expr
+	RawText            string // original source text for error messages
+	AlwaysCheck        bool   // @always_check: kept as a runtime check even when proved
+	Line, Column       int    // position of the clause keyword; zero when synthesized
+	EndLine, EndColumn int    // position just past the clause expression; zero when synthesized
 }
 
 // DecreasesClause represents a termination metric.
@@ -96,9 +113,10 @@ type DecreasesClause struct {
 
 // Enum represents an enum declaration.
 type Enum struct {
-	Name     string
-	IsPublic bool
-	Variants []*EnumVariant
+	Name       string
+	IsPublic   bool
+	TypeParams []string // type parameter names; empty once monomorphized
+	Variants   []*EnumVariant
 }
 
 // EnumVariant represents a variant in an enum.
@@ -168,11 +186,13 @@ type WhileStmt struct {
 
 func (*WhileStmt) stmtNode() {}
 
-// ForInStmt represents a for-in loop.
+// ForInStmt represents a for-in loop. Over a map, Variable is bound to each
+// key in ascending order and ValueVariable, if set, to its value.
 type ForInStmt struct {
-	Variable string
-	Iterable Expr // could be RangeExpr or array expression
-	Body     []Stmt
+	Variable      string
+	ValueVariable string
+	Iterable      Expr // could be RangeExpr, array or map expression
+	Body          []Stmt
 }
 
 func (*ForInStmt) stmtNode() {}
@@ -208,6 +228,8 @@ type BinaryExpr struct {
 	Op    lexer.TokenType
 	Right Expr
 	Type  *checker.Type
+
+	Line, Column int // position of the operator; zero when synthesized
 }
 
 func (e *BinaryExpr) ExprType() *checker.Type { return e.Type }
@@ -218,6 +240,8 @@ type UnaryExpr struct {
 	Op      lexer.TokenType
 	Operand Expr
 	Type    *checker.Type
+
+	Line, Column int // position of the operator; zero when synthesized
 }
 
 func (e *UnaryExpr) ExprType() *checker.Type { return e.Type }
@@ -230,7 +254,7 @@ const (
 	CallFunction    CallKind = iota // regular function call
 	CallConstructor                 // entity constructor (Entity::new)
 	CallVariant                     // enum variant constructor
-	CallBuiltin                     // print, len, Ok, Err, Some
+	CallBuiltin                     // print, len, Ok, Err, Some, Map
 	CallMethod                      // reserved for future use
 )
 
@@ -239,8 +263,12 @@ type CallExpr struct {
 	Function string
 	Args     []Expr
 	Kind     CallKind
-	EnumName string // for CallVariant: the parent enum name
+	EnumName string          // for CallVariant: the parent enum name
+	TypeArgs []*checker.Type // for calls to generic functions, until monomorphized
 	Type     *checker.Type
+
+	Line, Column       int // position of the call; zero when synthesized
+	EndLine, EndColumn int // position just past the closing parenthesis
 }
 
 func (e *CallExpr) ExprType() *checker.Type { return e.Type }
@@ -255,7 +283,11 @@ type MethodCallExpr struct {
 	ModuleName   string   // set when IsModuleCall is true
 	CallKind     CallKind // for module calls: function vs constructor
 	EnumName     string   // for module entity constructor, the mangled name
+	TypeArgs     []*checker.Type
 	Type         *checker.Type
+
+	Line, Column       int // position of the call; zero when synthesized
+	EndLine, EndColumn int // position just past the closing parenthesis
 }
 
 func (e *MethodCallExpr) ExprType() *checker.Type { return e.Type }
@@ -276,6 +308,8 @@ type IndexExpr struct {
 	Object Expr
 	Index  Expr
 	Type   *checker.Type
+
+	Line, Column int // position of the opening bracket; zero when synthesized
 }
 
 func (e *IndexExpr) ExprType() *checker.Type { return e.Type }
@@ -374,6 +408,7 @@ func (*RangeExpr) exprNode()                 {}
 type ForallExpr struct {
 	Variable string
 	Domain   *RangeExpr
+	Map      Expr // when set, the variable ranges over the map's keys and Domain is nil
 	Body     Expr
 	Type     *checker.Type
 }
@@ -385,6 +420,7 @@ func (*ForallExpr) exprNode()                 {}
 type ExistsExpr struct {
 	Variable string
 	Domain   *RangeExpr
+	Map      Expr // when set, the variable ranges over the map's keys and Domain is nil
 	Body     Expr
 	Type     *checker.Type
 }
@@ -452,3 +488,13 @@ type StringConcat struct {
 
 func (e *StringConcat) ExprType() *checker.Type { return e.Type }
 func (*StringConcat) exprNode()                 {}
+
+// UpcastExpr converts an entity value to a value of a trait it implements.
+// Type is the trait type.
+type UpcastExpr struct {
+	Value Expr
+	Type  *checker.Type
+}
+
+func (e *UpcastExpr) ExprType() *checker.Type { return e.Type }
+func (*UpcastExpr) exprNode()                 {}
@@ -58,6 +58,20 @@ func Validate(mod *Module) []string {
 		}
 	}
 
+	// Validate traits
+	for _, trait := range mod.Traits {
+		for _, method := range trait.Methods {
+			if method.ReturnType == nil {
+				errors = append(errors, fmt.Sprintf("trait %s method %s has nil ReturnType", trait.Name, method.Name))
+			}
+			if method.Body != nil {
+				errors = append(errors, fmt.Sprintf("trait %s method %s has a body", trait.Name, method.Name))
+			}
+			errors = append(errors, validateContracts(method.Requires, fmt.Sprintf("trait %s method %s requires", trait.Name, method.Name))...)
+			errors = append(errors, validateContracts(method.Ensures, fmt.Sprintf("trait %s method %s ensures", trait.Name, method.Name))...)
+		}
+	}
+
 	return errors
 }
 
@@ -273,9 +287,12 @@ func validateExpr(expr Expr, context string) []string {
 		}
 
 	case *ForallExpr:
-		if e.Domain == nil {
+		switch {
+		case e.Map != nil:
+			errors = append(errors, validateExpr(e.Map, context)...)
+		case e.Domain == nil:
 			errors = append(errors, fmt.Sprintf("%s: ForallExpr has nil Domain", context))
-		} else {
+		default:
 			errors = append(errors, validateExpr(e.Domain, context)...)
 		}
 		if e.Body == nil {
@@ -285,9 +302,12 @@ func validateExpr(expr Expr, context string) []string {
 		}
 
 	case *ExistsExpr:
-		if e.Domain == nil {
+		switch {
+		case e.Map != nil:
+			errors = append(errors, validateExpr(e.Map, context)...)
+		case e.Domain == nil:
 			errors = append(errors, fmt.Sprintf("%s: ExistsExpr has nil Domain", context))
-		} else {
+		default:
 			errors = append(errors, validateExpr(e.Domain, context)...)
 		}
 		if e.Body == nil {
@@ -329,6 +349,13 @@ func validateExpr(expr Expr, context string) []string {
 			errors = append(errors, validateExpr(e.Right, context)...)
 		}
 
+	case *UpcastExpr:
+		if e.Value == nil {
+			errors = append(errors, fmt.Sprintf("%s: UpcastExpr has nil Value", context))
+		} else {
+			errors = append(errors, validateExpr(e.Value, context)...)
+		}
+
 	case *StringInterp:
 		for _, part := range e.Parts {
 			if part.IsExpr && part.Expr != nil {
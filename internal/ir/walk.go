@@ -0,0 +1,109 @@
+package ir
+
+// WalkStmts calls fn for every statement in stmts, recursing into nested
+// blocks.
+func WalkStmts(stmts []Stmt, fn func(Stmt)) {
+	for _, s := range stmts {
+		fn(s)
+		switch st := s.(type) {
+		case *IfStmt:
+			WalkStmts(st.Then, fn)
+			WalkStmts(st.Else, fn)
+		case *WhileStmt:
+			WalkStmts(st.Body, fn)
+		case *ForInStmt:
+			WalkStmts(st.Body, fn)
+		}
+	}
+}
+
+// WalkStmtExprs calls fn for every top-level expression held by stmts.
+func WalkStmtExprs(stmts []Stmt, fn func(Expr)) {
+	WalkStmts(stmts, func(s Stmt) {
+		switch st := s.(type) {
+		case *LetStmt:
+			fn(st.Value)
+		case *AssignStmt:
+			fn(st.Target)
+			fn(st.Value)
+		case *ReturnStmt:
+			if st.Value != nil {
+				fn(st.Value)
+			}
+		case *IfStmt:
+			fn(st.Condition)
+		case *WhileStmt:
+			fn(st.Condition)
+		case *ForInStmt:
+			fn(st.Iterable)
+		case *ExprStmt:
+			fn(st.Expr)
+		}
+	})
+}
+
+// WalkExpr calls fn for e and every sub-expression of e.
+func WalkExpr(e Expr, fn func(Expr)) {
+	if e == nil {
+		return
+	}
+	fn(e)
+	switch x := e.(type) {
+	case *BinaryExpr:
+		WalkExpr(x.Left, fn)
+		WalkExpr(x.Right, fn)
+	case *UnaryExpr:
+		WalkExpr(x.Operand, fn)
+	case *CallExpr:
+		for _, a := range x.Args {
+			WalkExpr(a, fn)
+		}
+	case *MethodCallExpr:
+		WalkExpr(x.Object, fn)
+		for _, a := range x.Args {
+			WalkExpr(a, fn)
+		}
+	case *FieldAccessExpr:
+		WalkExpr(x.Object, fn)
+	case *IndexExpr:
+		WalkExpr(x.Object, fn)
+		WalkExpr(x.Index, fn)
+	case *ArrayLit:
+		for _, el := range x.Elements {
+			WalkExpr(el, fn)
+		}
+	case *RangeExpr:
+		WalkExpr(x.Start, fn)
+		WalkExpr(x.End, fn)
+	case *ForallExpr:
+		if x.Domain != nil {
+			WalkExpr(x.Domain, fn)
+		}
+		WalkExpr(x.Map, fn)
+		WalkExpr(x.Body, fn)
+	case *ExistsExpr:
+		if x.Domain != nil {
+			WalkExpr(x.Domain, fn)
+		}
+		WalkExpr(x.Map, fn)
+		WalkExpr(x.Body, fn)
+	case *MatchExpr:
+		WalkExpr(x.Scrutinee, fn)
+		for _, arm := range x.Arms {
+			WalkExpr(arm.Body, fn)
+		}
+	case *TryExpr:
+		WalkExpr(x.Expr, fn)
+	case *UpcastExpr:
+		WalkExpr(x.Value, fn)
+	case *StringInterp:
+		for _, p := range x.Parts {
+			if p.IsExpr {
+				WalkExpr(p.Expr, fn)
+			}
+		}
+	case *StringConcat:
+		WalkExpr(x.Left, fn)
+		WalkExpr(x.Right, fn)
+	}
+}
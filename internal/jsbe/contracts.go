@@ -0,0 +1,30 @@
+package jsbe
+
+import "github.com/lhaig/intent/internal/ir"
+
+// contractsFlag names the global that switches contract checks on and off
+// in debug contract mode. It is also the helpers key for its declaration.
+const contractsFlag = "__intentContracts"
+
+// contractsFlagSource declares the flag. Setting globalThis.__intentContracts
+// changes it at any time; INTENT_CONTRACTS=off starts a Node process with the
+// checks disabled.
+const contractsFlagSource = `// Contract checks run while globalThis.__intentContracts is true
+globalThis.__intentContracts ??= typeof process === "undefined" || process.env.INTENT_CONTRACTS !== "off";`
+
+// violated returns the condition under which contract c, compiled to expr,
+// fails at runtime.
+func (g *generator) violated(c *ir.Contract, expr string) string {
+	return g.guarded(c, "!("+expr+")")
+}
+
+// guarded puts a failure condition behind the contracts flag in debug
+// contract mode, unless c is marked @always_check. A nil c is a decreases
+// clause, which cannot be marked.
+func (g *generator) guarded(c *ir.Contract, failure string) string {
+	if !g.debugContracts || (c != nil && c.AlwaysCheck) {
+		return failure
+	}
+	g.helpers[contractsFlag] = true
+	return "globalThis." + contractsFlag + " && " + failure
+}
@@ -0,0 +1,158 @@
+package jsbe
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lhaig/intent/internal/ir"
+	"github.com/lhaig/intent/internal/lexer"
+)
+
+// IntMode selects how Intent's Int is represented in generated JavaScript.
+type IntMode string
+
+const (
+	// IntBigInt represents Int as BigInt with i64 semantics: addition,
+	// subtraction, multiplication and negation wrap at 64 bits, and
+	// division or remainder by zero and MIN / -1 throw. This is the default.
+	IntBigInt IntMode = "bigint"
+	// IntNumber represents Int as a JS number. Division truncates toward
+	// zero and any result outside the safe integer range throws rather than
+	// silently losing precision.
+	IntNumber IntMode = "number"
+)
+
+// ParseIntMode parses the value of --int-mode.
+func ParseIntMode(s string) (IntMode, error) {
+	switch IntMode(s) {
+	case IntBigInt, IntNumber:
+		return IntMode(s), nil
+	}
+	return "", fmt.Errorf("unknown int mode: %s (expected bigint or number)", s)
+}
+
+// isInt reports whether e has type Int.
+func isInt(e ir.Expr) bool {
+	t := e.ExprType()
+	return t != nil && t.Name == "Int"
+}
+
+func (g *generator) intLit(v int64) string {
+	if g.bigint {
+		return fmt.Sprintf("%dn", v)
+	}
+	return fmt.Sprintf("%d", v)
+}
+
+// intArith generates Int arithmetic. Comparisons are left to the caller
+// and report false.
+func (g *generator) intArith(op lexer.TokenType, left, right string) (string, bool) {
+	switch op {
+	case lexer.PLUS, lexer.MINUS, lexer.STAR:
+		if g.bigint {
+			return fmt.Sprintf("BigInt.asIntN(64, %s %s %s)", left, g.mapOperator(op), right), true
+		}
+		return g.callHelper("__intent_int", fmt.Sprintf("%s %s %s", left, g.mapOperator(op), right)), true
+	case lexer.SLASH:
+		return g.callHelper("__intent_div", left, right), true
+	case lexer.PERCENT:
+		return g.callHelper("__intent_rem", left, right), true
+	}
+	return "", false
+}
+
+// intNeg generates Int negation of operand.
+func (g *generator) intNeg(operand string) string {
+	if g.bigint {
+		return fmt.Sprintf("BigInt.asIntN(64, -%s)", operand)
+	}
+	return g.callHelper("__intent_int", "-"+operand)
+}
+
+// callHelper records that the runtime helper name is needed and returns a
+// call to it.
+func (g *generator) callHelper(name string, args ...string) string {
+	g.helpers[name] = true
+	return fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+}
+
+// entryCall is the statement that runs the entry function. process.exit
+// rejects a BigInt, so the exit code is converted first.
+func entryCall(bigint bool) string {
+	if bigint {
+		return "const __exitCode = Number(__intent_main());"
+	}
+	return "const __exitCode = __intent_main();"
+}
+
+// intHelpers are the runtime helpers for Int arithmetic, in emission order.
+// The trap messages match the interpreter and the Rust backend.
+var intHelpers = []struct {
+	name   string
+	bigint string
+	number string
+}{
+	{
+		name: "__intent_int",
+		number: `function __intent_int(n) {
+  if (!Number.isSafeInteger(n)) throw new Error("attempt to compute an integer outside the safe range");
+  return n + 0; // normalize -0
+}`,
+	},
+	{
+		name: "__intent_div",
+		bigint: `function __intent_div(a, b) {
+  if (b === 0n) throw new Error("attempt to divide by zero");
+  if (b === -1n && a === -9223372036854775808n) throw new Error("attempt to divide with overflow");
+  return a / b;
+}`,
+		number: `function __intent_div(a, b) {
+  if (b === 0) throw new Error("attempt to divide by zero");
+  return __intent_int(Math.trunc(a / b));
+}`,
+	},
+	{
+		name: "__intent_rem",
+		bigint: `function __intent_rem(a, b) {
+  if (b === 0n) throw new Error("attempt to calculate the remainder with a divisor of zero");
+  if (b === -1n && a === -9223372036854775808n) throw new Error("attempt to calculate the remainder with overflow");
+  return a % b;
+}`,
+		number: `function __intent_rem(a, b) {
+  if (b === 0) throw new Error("attempt to calculate the remainder with a divisor of zero");
+  return __intent_int(a % b);
+}`,
+	},
+}
+
+// prelude returns the source of the helpers that were used, or "" if none
+// were.
+func prelude(helpers map[string]bool, bigint bool) string {
+	// The number-mode division and remainder helpers call __intent_int
+	if !bigint && (helpers["__intent_div"] || helpers["__intent_rem"]) {
+		helpers["__intent_int"] = true
+	}
+
+	var sb strings.Builder
+	if helpers[contractsFlag] {
+		sb.WriteString(contractsFlagSource)
+		sb.WriteString("\n\n")
+	}
+	for _, h := range intHelpers {
+		if !helpers[h.name] {
+			continue
+		}
+		src := h.number
+		if bigint {
+			src = h.bigint
+		}
+		sb.WriteString(src)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString(mapPrelude(helpers))
+	if helpers[tryHelper] {
+		sb.WriteString(tryHelperSource)
+		sb.WriteString("\n\n")
+	}
+	return sb.String()
+}
@@ -10,12 +10,29 @@ import (
 	"github.com/lhaig/intent/internal/lexer"
 )
 
+// Options configures code generation. The zero value selects the defaults.
+type Options struct {
+	IntMode IntMode
+	// DebugContracts puts contract checks behind a global flag so they can
+	// be switched off at runtime. Clauses marked @always_check always run.
+	DebugContracts bool
+}
+
 // Generate produces JavaScript source code from a single IR Module.
 func Generate(mod *ir.Module) string {
+	return GenerateWith(mod, Options{})
+}
+
+// GenerateWith produces JavaScript source code from a single IR Module using
+// the given options.
+func GenerateWith(mod *ir.Module, opts Options) string {
 	g := &generator{
-		entities:  make(map[string]*ir.Entity),
-		enums:     make(map[string]*ir.Enum),
-		functions: make(map[string]*ir.Function),
+		entities:       make(map[string]*ir.Entity),
+		enums:          make(map[string]*ir.Enum),
+		functions:      make(map[string]*ir.Function),
+		bigint:         opts.IntMode != IntNumber,
+		debugContracts: opts.DebugContracts,
+		helpers:        make(map[string]bool),
 	}
 
 	for _, e := range mod.Entities {
@@ -28,13 +45,14 @@ func Generate(mod *ir.Module) string {
 		g.functions[f.Name] = f
 	}
 
-	g.emitLine("// Generated JavaScript code from Intent")
-	g.emitLine("")
-
 	for _, e := range mod.Enums {
 		g.generateEnumDecl(e)
 		g.emitLine("")
 	}
+	for _, t := range mod.Traits {
+		g.generateTrait(t)
+		g.emitLine("")
+	}
 	for _, e := range mod.Entities {
 		g.generateEntity(e)
 		g.emitLine("")
@@ -49,17 +67,27 @@ func Generate(mod *ir.Module) string {
 		for _, f := range mod.Functions {
 			if f.IsEntry {
 				g.emitLine("// Entry point invocation")
-				g.emitLine("const __exitCode = __intent_main();")
+				g.emitLine(entryCall(g.bigint))
 				g.emitLine("process.exit(__exitCode);")
 			}
 		}
 	}
 
-	return g.sb.String()
+	var sb strings.Builder
+	sb.WriteString("// Generated JavaScript code from Intent\n\n")
+	sb.WriteString(prelude(g.helpers, g.bigint))
+	sb.WriteString(g.sb.String())
+	return sb.String()
 }
 
 // GenerateAll produces JavaScript from a multi-file IR Program.
 func GenerateAll(prog *ir.Program) string {
+	return GenerateAllWith(prog, Options{})
+}
+
+// GenerateAllWith produces JavaScript from a multi-file IR Program using the
+// given options.
+func GenerateAllWith(prog *ir.Program, opts Options) string {
 	if len(prog.Modules) == 0 {
 		return ""
 	}
@@ -72,29 +100,49 @@ func GenerateAll(prog *ir.Program) string {
 		}
 	}
 
-	var sb strings.Builder
-	sb.WriteString("// Generated JavaScript code from Intent (multi-file)\n\n")
+	// Entities and enums are visible from the modules that import them, so
+	// every module sees every type under its mangled name. The checker keeps
+	// type names unique across a program.
+	entities := make(map[string]*ir.Entity)
+	enums := make(map[string]*ir.Enum)
+	typeNames := make(map[string]string)
+	for _, mod := range prog.Modules {
+		prefix := ""
+		if !mod.IsEntry {
+			prefix = strings.ToUpper(mod.Name[:1]) + mod.Name[1:]
+		}
+		for _, e := range mod.Entities {
+			entities[e.Name] = e
+			typeNames[e.Name] = prefix + e.Name
+		}
+		for _, e := range mod.Enums {
+			enums[e.Name] = e
+			typeNames[e.Name] = prefix + e.Name
+		}
+	}
 
+	// Runtime helpers are shared by every module and emitted once up front
+	helpers := make(map[string]bool)
+	bigint := opts.IntMode != IntNumber
+
+	var body strings.Builder
 	for _, mod := range prog.Modules {
 		g := &generator{
-			entities:        make(map[string]*ir.Entity),
-			enums:           make(map[string]*ir.Enum),
+			entities:        entities,
+			enums:           enums,
 			functions:       make(map[string]*ir.Function),
+			typeNames:       typeNames,
 			isEntryFile:     mod.IsEntry,
 			moduleManglings: moduleManglings,
+			bigint:          bigint,
+			debugContracts:  opts.DebugContracts,
+			helpers:         helpers,
 		}
 
 		if !mod.IsEntry {
 			g.namePrefix = mod.Name + "_"
-			g.classPrefix = strings.ToUpper(mod.Name[:1]) + mod.Name[1:]
 		}
 
-		for _, e := range mod.Entities {
-			g.entities[e.Name] = e
-		}
-		for _, e := range mod.Enums {
-			g.enums[e.Name] = e
-		}
 		for _, f := range mod.Functions {
 			g.functions[f.Name] = f
 		}
@@ -103,6 +151,10 @@ func GenerateAll(prog *ir.Program) string {
 			g.generateEnumDecl(e)
 			g.emitLine("")
 		}
+		for _, t := range mod.Traits {
+			g.generateTrait(t)
+			g.emitLine("")
+		}
 		for _, e := range mod.Entities {
 			g.generateEntity(e)
 			g.emitLine("")
@@ -112,7 +164,7 @@ func GenerateAll(prog *ir.Program) string {
 			g.emitLine("")
 		}
 
-		sb.WriteString(g.sb.String())
+		body.WriteString(g.sb.String())
 	}
 
 	// Call entry function if present
@@ -120,14 +172,18 @@ func GenerateAll(prog *ir.Program) string {
 		if mod.IsEntry {
 			for _, f := range mod.Functions {
 				if f.IsEntry {
-					sb.WriteString("\n// Entry point invocation\n")
-					sb.WriteString("const __exitCode = __intent_main();\n")
-					sb.WriteString("process.exit(__exitCode);\n")
+					body.WriteString("\n// Entry point invocation\n")
+					body.WriteString(entryCall(bigint) + "\n")
+					body.WriteString("process.exit(__exitCode);\n")
 				}
 			}
 		}
 	}
 
+	var sb strings.Builder
+	sb.WriteString("// Generated JavaScript code from Intent (multi-file)\n\n")
+	sb.WriteString(prelude(helpers, bigint))
+	sb.WriteString(body.String())
 	return sb.String()
 }
 
@@ -137,12 +193,19 @@ type generator struct {
 	entities       map[string]*ir.Entity
 	enums          map[string]*ir.Enum
 	functions      map[string]*ir.Function
+	typeNames      map[string]string // mangled name of each entity and enum
 	inConstructor  bool
 	ensuresContext bool
 
+	// bigint selects IntBigInt; helpers records the runtime helpers the
+	// generated code calls so that only those are emitted.
+	bigint  bool
+	helpers map[string]bool
+	// debugContracts guards contract checks with the contracts flag.
+	debugContracts bool
+
 	// Multi-file fields
 	namePrefix      string
-	classPrefix     string
 	isEntryFile     bool
 	moduleManglings map[string]string
 }
@@ -185,6 +248,9 @@ func (g *generator) mapType(t *checker.Type) string {
 	}
 	switch t.Name {
 	case "Int":
+		if g.bigint {
+			return "bigint"
+		}
 		return "number"
 	case "Float":
 		return "number"
@@ -199,6 +265,11 @@ func (g *generator) mapType(t *checker.Type) string {
 			return "Array<" + g.mapType(t.TypeParams[0]) + ">"
 		}
 		return "Array<any>"
+	case "Map":
+		if checker.IsMap(t) {
+			return "Map<" + g.mapType(t.TypeParams[0]) + ", " + g.mapType(t.TypeParams[1]) + ">"
+		}
+		return "Map<any, any>"
 	case "Result":
 		if t.IsGeneric && len(t.TypeParams) == 2 {
 			return "Result<" + g.mapType(t.TypeParams[0]) + ", " + g.mapType(t.TypeParams[1]) + ">"
@@ -219,7 +290,9 @@ func (g *generator) defaultValue(t *checker.Type) string {
 		return "undefined"
 	}
 	switch t.Name {
-	case "Int", "Float":
+	case "Int":
+		return g.intLit(0)
+	case "Float":
 		return "0"
 	case "String":
 		return "\"\""
@@ -227,21 +300,28 @@ func (g *generator) defaultValue(t *checker.Type) string {
 		return "false"
 	case "Array":
 		return "[]"
+	case "Map":
+		return "new Map()"
 	default:
 		return "null"
 	}
 }
 
-func (g *generator) mangledEntityName(name string) string {
-	if g.classPrefix != "" {
-		return g.classPrefix + name
+// typeName returns the name an entity or enum is declared under in the
+// generated code. In multi-file builds that carries the prefix of its module,
+// wherever it is referred to from.
+func (g *generator) typeName(name string) string {
+	if mangled, ok := g.typeNames[name]; ok {
+		return mangled
 	}
 	return name
 }
 
-func (g *generator) mangledEnumName(name string) string {
-	if g.classPrefix != "" {
-		return g.classPrefix + name
+// funcName returns the name a function of the current module is declared
+// under in the generated code.
+func (g *generator) funcName(name string) string {
+	if _, ok := g.functions[name]; ok {
+		return g.namePrefix + name
 	}
 	return name
 }
@@ -260,10 +340,7 @@ func (g *generator) generateFunction(f *ir.Function) {
 		g.decIndent()
 		g.emitLine("}")
 	} else {
-		fnName := f.Name
-		if g.namePrefix != "" {
-			fnName = g.namePrefix + f.Name
-		}
+		fnName := g.funcName(f.Name)
 
 		g.emitLine("/**")
 		for _, p := range f.Params {
@@ -283,39 +360,26 @@ func (g *generator) generateFunction(f *ir.Function) {
 
 		// Requires
 		for _, req := range f.Requires {
-			g.emitLinef("if (!(%s)) throw new Error(\"Precondition failed: %s\");\n",
-				g.generateExpr(req.Expr), escapeJSString(req.RawText))
+			g.emitLinef("if (%s) throw new Error(\"Precondition failed: %s\");\n",
+				g.violated(req, g.generateExpr(req.Expr)), escapeJSString(req.RawText))
 		}
 
-		// Ensures with result capture
-		needsResultCapture := len(f.Ensures) > 0 && f.ReturnType != nil && f.ReturnType.Name != "Void"
-
-		if needsResultCapture {
-			g.emitLine("let __result;")
-			g.emitLine("{")
-			g.incIndent()
-			g.generateStmts(f.Body)
-			g.decIndent()
-			g.emitLine("}")
+		// Ensures: run the body in a closure so every return reaches the checks
+		if len(f.Ensures) > 0 {
+			returnsValue := f.ReturnType != nil && f.ReturnType.Name != "Void"
+			g.generateCapturedBody(f.Body, returnsValue)
 
 			g.ensuresContext = true
 			for _, ens := range f.Ensures {
-				g.emitLinef("if (!(%s)) throw new Error(\"Postcondition failed: %s\");\n",
-					g.generateExpr(ens.Expr), escapeJSString(ens.RawText))
+				g.emitLinef("if (%s) throw new Error(\"Postcondition failed: %s\");\n",
+					g.violated(ens, g.generateExpr(ens.Expr)), escapeJSString(ens.RawText))
 			}
 			g.ensuresContext = false
-			g.emitLine("return __result;")
-		} else {
-			g.generateStmts(f.Body)
-
-			if len(f.Ensures) > 0 {
-				g.ensuresContext = true
-				for _, ens := range f.Ensures {
-					g.emitLinef("if (!(%s)) throw new Error(\"Postcondition failed: %s\");\n",
-						g.generateExpr(ens.Expr), escapeJSString(ens.RawText))
-				}
-				g.ensuresContext = false
+			if returnsValue {
+				g.emitLine("return __result;")
 			}
+		} else {
+			g.generateBody(f.Body)
 		}
 
 		g.decIndent()
@@ -323,13 +387,49 @@ func (g *generator) generateFunction(f *ir.Function) {
 	}
 }
 
+// generateCapturedBody emits body inside an arrow function, binding its
+// return value to __result when returnsValue is set. Returns in the body
+// leave the arrow function rather than the enclosing function, so the
+// postcondition and invariant checks emitted after it always run; arrow
+// functions keep `this`, so methods work unchanged.
+func (g *generator) generateCapturedBody(body []ir.Stmt, returnsValue bool) {
+	if returnsValue {
+		g.emitLine("const __result = (() => {")
+	} else {
+		g.emitLine("(() => {")
+	}
+	g.incIndent()
+	g.generateBody(body)
+	g.decIndent()
+	g.emitLine("})();")
+}
+
 // --- Entity generation ---
 
+// generateTrait documents a trait. JavaScript dispatches on the methods an
+// object has, so a trait value is the entity itself and needs no code.
+func (g *generator) generateTrait(t *ir.Trait) {
+	g.emitLine("/**")
+	g.emitLinef(" * Trait: %s\n", t.Name)
+	g.emitLine(" * @interface")
+	for _, m := range t.Methods {
+		var params []string
+		for _, p := range m.Params {
+			params = append(params, p.Name)
+		}
+		g.emitLinef(" * %s(%s)\n", m.Name, strings.Join(params, ", "))
+	}
+	g.emitLine(" */")
+}
+
 func (g *generator) generateEntity(e *ir.Entity) {
-	mangledName := g.mangledEntityName(e.Name)
+	mangledName := g.typeName(e.Name)
 
 	g.emitLine("/**")
 	g.emitLinef(" * Entity: %s\n", e.Name)
+	for _, t := range e.Implements {
+		g.emitLinef(" * @implements {%s}\n", t)
+	}
 	g.emitLine(" */")
 	g.emitLinef("class %s {\n", mangledName)
 	g.incIndent()
@@ -348,8 +448,8 @@ func (g *generator) generateEntity(e *ir.Entity) {
 		g.emitLine("__checkInvariants() {")
 		g.incIndent()
 		for _, inv := range e.Invariants {
-			g.emitLinef("if (!(%s)) throw new Error(\"Invariant failed: %s\");\n",
-				g.generateExpr(inv.Expr), escapeJSString(inv.RawText))
+			g.emitLinef("if (%s) throw new Error(\"Invariant failed: %s\");\n",
+				g.violated(inv, g.generateExpr(inv.Expr)), escapeJSString(inv.RawText))
 		}
 		g.decIndent()
 		g.emitLine("}")
@@ -387,8 +487,8 @@ func (g *generator) generateConstructor(e *ir.Entity) {
 
 	// Requires
 	for _, req := range ctor.Requires {
-		g.emitLinef("if (!(%s)) throw new Error(\"Precondition failed: %s\");\n",
-			g.generateExpr(req.Expr), escapeJSString(req.RawText))
+		g.emitLinef("if (%s) throw new Error(\"Precondition failed: %s\");\n",
+			g.violated(req, g.generateExpr(req.Expr)), escapeJSString(req.RawText))
 	}
 
 	// Initialize fields with defaults
@@ -403,8 +503,8 @@ func (g *generator) generateConstructor(e *ir.Entity) {
 	// Ensures
 	g.ensuresContext = true
 	for _, ens := range ctor.Ensures {
-		g.emitLinef("if (!(%s)) throw new Error(\"Postcondition failed: %s\");\n",
-			g.generateExpr(ens.Expr), escapeJSString(ens.RawText))
+		g.emitLinef("if (%s) throw new Error(\"Postcondition failed: %s\");\n",
+			g.violated(ens, g.generateExpr(ens.Expr)), escapeJSString(ens.RawText))
 	}
 	g.ensuresContext = false
 	g.inConstructor = false
@@ -443,49 +543,31 @@ func (g *generator) generateMethod(e *ir.Entity, m *ir.Method) {
 
 	// Requires
 	for _, req := range m.Requires {
-		g.emitLinef("if (!(%s)) throw new Error(\"Precondition failed: %s\");\n",
-			g.generateExpr(req.Expr), escapeJSString(req.RawText))
+		g.emitLinef("if (%s) throw new Error(\"Precondition failed: %s\");\n",
+			g.violated(req, g.generateExpr(req.Expr)), escapeJSString(req.RawText))
 	}
 
-	// Body with result capture if needed
+	// Body in a closure when checks follow it, so every return reaches them
 	hasInvariants := len(e.Invariants) > 0
-	needsResultCapture := (m.ReturnType != nil && m.ReturnType.Name != "Void") && (len(m.Ensures) > 0 || hasInvariants)
-
-	if needsResultCapture {
-		g.emitLine("let __result;")
-		g.emitLine("{")
-		g.incIndent()
-		g.generateStmts(m.Body)
-		g.decIndent()
-		g.emitLine("}")
+	if len(m.Ensures) > 0 || hasInvariants {
+		returnsValue := m.ReturnType != nil && m.ReturnType.Name != "Void"
+		g.generateCapturedBody(m.Body, returnsValue)
 
 		g.ensuresContext = true
 		for _, ens := range m.Ensures {
-			g.emitLinef("if (!(%s)) throw new Error(\"Postcondition failed: %s\");\n",
-				g.generateExpr(ens.Expr), escapeJSString(ens.RawText))
+			g.emitLinef("if (%s) throw new Error(\"Postcondition failed: %s\");\n",
+				g.violated(ens, g.generateExpr(ens.Expr)), escapeJSString(ens.RawText))
 		}
 		g.ensuresContext = false
 
 		if hasInvariants {
 			g.emitLine("this.__checkInvariants();")
 		}
-
-		g.emitLine("return __result;")
-	} else {
-		g.generateStmts(m.Body)
-
-		if len(m.Ensures) > 0 {
-			g.ensuresContext = true
-			for _, ens := range m.Ensures {
-				g.emitLinef("if (!(%s)) throw new Error(\"Postcondition failed: %s\");\n",
-					g.generateExpr(ens.Expr), escapeJSString(ens.RawText))
-			}
-			g.ensuresContext = false
-		}
-
-		if hasInvariants {
-			g.emitLine("this.__checkInvariants();")
+		if returnsValue {
+			g.emitLine("return __result;")
 		}
+	} else {
+		g.generateBody(m.Body)
 	}
 
 	g.decIndent()
@@ -495,7 +577,7 @@ func (g *generator) generateMethod(e *ir.Entity, m *ir.Method) {
 // --- Enum generation ---
 
 func (g *generator) generateEnumDecl(e *ir.Enum) {
-	mangledName := g.mangledEnumName(e.Name)
+	mangledName := g.typeName(e.Name)
 
 	g.emitLine("/**")
 	g.emitLinef(" * Enum: %s\n", e.Name)
@@ -636,8 +718,8 @@ func (g *generator) generateWhileStmt(stmt *ir.WhileStmt) {
 		savedEnsures := g.ensuresContext
 		g.ensuresContext = true
 		for _, inv := range stmt.Invariants {
-			g.emitLinef("if (!(%s)) throw new Error(\"Loop invariant failed at entry: %s\");\n",
-				g.generateExpr(inv.Expr), escapeJSString(inv.RawText))
+			g.emitLinef("if (%s) throw new Error(\"Loop invariant failed at entry: %s\");\n",
+				g.violated(inv, g.generateExpr(inv.Expr)), escapeJSString(inv.RawText))
 		}
 		g.ensuresContext = savedEnsures
 
@@ -645,8 +727,8 @@ func (g *generator) generateWhileStmt(stmt *ir.WhileStmt) {
 		if stmt.Decreases != nil {
 			metricExpr := g.generateExpr(stmt.Decreases.Expr)
 			g.emitLinef("let __decreasesPrev = %s;\n", metricExpr)
-			g.emitLinef("if (__decreasesPrev < 0) throw new Error(\"Decreases metric must be non-negative at entry: %s\");\n",
-				escapeJSString(stmt.Decreases.RawText))
+			g.emitLinef("if (%s) throw new Error(\"Decreases metric must be non-negative at entry: %s\");\n",
+				g.guarded(nil, "__decreasesPrev < 0"), escapeJSString(stmt.Decreases.RawText))
 		}
 
 		g.emitLinef("while (%s) {\n", g.generateExpr(stmt.Condition))
@@ -657,8 +739,8 @@ func (g *generator) generateWhileStmt(stmt *ir.WhileStmt) {
 		// Check invariants after iteration
 		g.ensuresContext = true
 		for _, inv := range stmt.Invariants {
-			g.emitLinef("if (!(%s)) throw new Error(\"Loop invariant failed after iteration: %s\");\n",
-				g.generateExpr(inv.Expr), escapeJSString(inv.RawText))
+			g.emitLinef("if (%s) throw new Error(\"Loop invariant failed after iteration: %s\");\n",
+				g.violated(inv, g.generateExpr(inv.Expr)), escapeJSString(inv.RawText))
 		}
 		g.ensuresContext = savedEnsures
 
@@ -666,10 +748,10 @@ func (g *generator) generateWhileStmt(stmt *ir.WhileStmt) {
 		if stmt.Decreases != nil {
 			metricExpr := g.generateExpr(stmt.Decreases.Expr)
 			g.emitLinef("const __decreasesNext = %s;\n", metricExpr)
-			g.emitLinef("if (__decreasesNext >= __decreasesPrev) throw new Error(\"Termination metric did not decrease: %s\");\n",
-				escapeJSString(stmt.Decreases.RawText))
-			g.emitLinef("if (__decreasesNext < 0) throw new Error(\"Termination metric became negative: %s\");\n",
-				escapeJSString(stmt.Decreases.RawText))
+			g.emitLinef("if (%s) throw new Error(\"Termination metric did not decrease: %s\");\n",
+				g.guarded(nil, "__decreasesNext >= __decreasesPrev"), escapeJSString(stmt.Decreases.RawText))
+			g.emitLinef("if (%s) throw new Error(\"Termination metric became negative: %s\");\n",
+				g.guarded(nil, "__decreasesNext < 0"), escapeJSString(stmt.Decreases.RawText))
 			g.emitLine("__decreasesPrev = __decreasesNext;")
 		}
 
@@ -689,14 +771,28 @@ func (g *generator) generateWhileStmt(stmt *ir.WhileStmt) {
 
 func (g *generator) generateForInStmt(stmt *ir.ForInStmt) {
 	g.emit(g.indentStr())
-	g.emitf("for (const %s of ", stmt.Variable)
-
-	if rangeExpr, ok := stmt.Iterable.(*ir.RangeExpr); ok {
-		// Generate range helper
-		g.emitf("Array.from({ length: (%s) - (%s) }, (_, i) => (%s) + i)",
-			g.generateExpr(rangeExpr.End),
-			g.generateExpr(rangeExpr.Start),
-			g.generateExpr(rangeExpr.Start))
+	if stmt.ValueVariable != "" {
+		g.emitf("for (const [%s, %s] of ", stmt.Variable, stmt.ValueVariable)
+	} else {
+		g.emitf("for (const %s of ", stmt.Variable)
+	}
+
+	if isMap(stmt.Iterable) {
+		helper := "__intent_map_keys"
+		if stmt.ValueVariable != "" {
+			helper = "__intent_map_entries"
+		}
+		g.emit(g.callHelper(helper, g.generateExpr(stmt.Iterable)))
+	} else if rangeExpr, ok := stmt.Iterable.(*ir.RangeExpr); ok {
+		start := g.generateExpr(rangeExpr.Start)
+		end := g.generateExpr(rangeExpr.End)
+		if g.bigint {
+			// Array.from counts in numbers, so convert the length and indices
+			g.emitf("Array.from({ length: Number((%s) - (%s)) }, (_, i) => (%s) + BigInt(i))", end, start, start)
+		} else {
+			// Generate range helper
+			g.emitf("Array.from({ length: (%s) - (%s) }, (_, i) => (%s) + i)", end, start, start)
+		}
 	} else {
 		g.emitf("%s", g.generateExpr(stmt.Iterable))
 	}
@@ -723,6 +819,11 @@ func (g *generator) generateExpr(e ir.Expr) string {
 		if expr.Op == lexer.IMPLIES {
 			return fmt.Sprintf("(!%s || %s)", left, right)
 		}
+		if isInt(expr.Left) {
+			if arith, ok := g.intArith(expr.Op, left, right); ok {
+				return arith
+			}
+		}
 
 		return fmt.Sprintf("(%s %s %s)", left, op, right)
 
@@ -731,11 +832,20 @@ func (g *generator) generateExpr(e ir.Expr) string {
 		right := g.generateExpr(expr.Right)
 		return fmt.Sprintf("(%s + %s)", left, right)
 
+	case *ir.UpcastExpr:
+		return g.generateExpr(expr.Value)
+
 	case *ir.UnaryExpr:
 		operand := g.generateExpr(expr.Operand)
 		if expr.Op == lexer.NOT {
 			return fmt.Sprintf("!%s", operand)
 		}
+		if lit, ok := expr.Operand.(*ir.IntLit); ok {
+			return g.intLit(-lit.Value)
+		}
+		if isInt(expr.Operand) {
+			return g.intNeg(operand)
+		}
 		return fmt.Sprintf("-%s", operand)
 
 	case *ir.CallExpr:
@@ -761,7 +871,7 @@ func (g *generator) generateExpr(e ir.Expr) string {
 		return "__result"
 
 	case *ir.IntLit:
-		return fmt.Sprintf("%d", expr.Value)
+		return g.intLit(expr.Value)
 
 	case *ir.FloatLit:
 		return expr.Value
@@ -809,8 +919,7 @@ func (g *generator) generateExpr(e ir.Expr) string {
 		return g.generateMatchExpr(expr)
 
 	case *ir.TryExpr:
-		// For JavaScript, try expressions can be a simple wrapper
-		return g.generateExpr(expr.Expr)
+		return g.callHelper(tryHelper, g.generateExpr(expr.Expr))
 
 	default:
 		return "undefined"
@@ -830,14 +939,14 @@ func (g *generator) generateCallExpr(expr *ir.CallExpr) string {
 		for i, arg := range expr.Args {
 			args[i] = g.generateExpr(arg)
 		}
-		return fmt.Sprintf("new %s(%s)", expr.Function, strings.Join(args, ", "))
+		return fmt.Sprintf("new %s(%s)", g.typeName(expr.Function), strings.Join(args, ", "))
 
 	default: // CallFunction
 		args := make([]string, len(expr.Args))
 		for i, arg := range expr.Args {
 			args[i] = g.generateExpr(arg)
 		}
-		return fmt.Sprintf("%s(%s)", expr.Function, strings.Join(args, ", "))
+		return fmt.Sprintf("%s(%s)", g.funcName(expr.Function), strings.Join(args, ", "))
 	}
 }
 
@@ -846,13 +955,26 @@ func (g *generator) generateBuiltinCall(expr *ir.CallExpr) string {
 	case "print":
 		if len(expr.Args) == 1 {
 			arg := g.generateExpr(expr.Args[0])
+			if g.bigint && isInt(expr.Args[0]) {
+				// console.log shows a BigInt with an n suffix
+				return fmt.Sprintf("console.log(String(%s))", arg)
+			}
 			return fmt.Sprintf("console.log(%s)", arg)
 		}
 	case "len":
 		if len(expr.Args) == 1 {
 			arg := g.generateExpr(expr.Args[0])
-			return fmt.Sprintf("(%s.length)", arg)
+			size := "length"
+			if isMap(expr.Args[0]) {
+				size = "size"
+			}
+			if g.bigint {
+				return fmt.Sprintf("BigInt(%s.%s)", arg, size)
+			}
+			return fmt.Sprintf("(%s.%s)", arg, size)
 		}
+	case "Map":
+		return "new Map()"
 	case "Ok", "Err", "Some":
 		if len(expr.Args) == 1 {
 			arg := g.generateExpr(expr.Args[0])
@@ -885,7 +1007,7 @@ func (g *generator) generateVariantConstructor(expr *ir.CallExpr) string {
 
 	// Unit variant
 	if variant == nil || len(variant.Fields) == 0 {
-		return fmt.Sprintf("%s.%s()", enumName, expr.Function)
+		return fmt.Sprintf("%s.%s()", g.typeName(enumName), expr.Function)
 	}
 
 	// Data variant
@@ -893,7 +1015,7 @@ func (g *generator) generateVariantConstructor(expr *ir.CallExpr) string {
 	for i, arg := range expr.Args {
 		args[i] = g.generateExpr(arg)
 	}
-	return fmt.Sprintf("%s.%s(%s)", enumName, expr.Function, strings.Join(args, ", "))
+	return fmt.Sprintf("%s.%s(%s)", g.typeName(enumName), expr.Function, strings.Join(args, ", "))
 }
 
 func (g *generator) generateMethodCallExpr(expr *ir.MethodCallExpr) string {
@@ -905,9 +1027,7 @@ func (g *generator) generateMethodCallExpr(expr *ir.MethodCallExpr) string {
 		}
 
 		if expr.CallKind == ir.CallConstructor {
-			modPrefix := strings.ToUpper(expr.ModuleName[:1]) + expr.ModuleName[1:]
-			mangledClassName := modPrefix + expr.Method
-			return fmt.Sprintf("new %s(%s)", mangledClassName, strings.Join(args, ", "))
+			return fmt.Sprintf("new %s(%s)", g.typeName(expr.Method), strings.Join(args, ", "))
 		}
 
 		mangledFnName := expr.ModuleName + "_" + expr.Method
@@ -915,6 +1035,9 @@ func (g *generator) generateMethodCallExpr(expr *ir.MethodCallExpr) string {
 	}
 
 	obj := g.generateExpr(expr.Object)
+	if isMap(expr.Object) {
+		return g.generateMapMethod(obj, expr)
+	}
 
 	// Result/Option predicate methods
 	if expr.Method == "is_ok" {
@@ -938,9 +1061,22 @@ func (g *generator) generateMethodCallExpr(expr *ir.MethodCallExpr) string {
 }
 
 func (g *generator) generateForallExpr(expr *ir.ForallExpr) string {
+	body := g.generateExpr(expr.Body)
+	if expr.Map != nil {
+		keys := g.callHelper("__intent_map_keys", g.generateExpr(expr.Map))
+		return fmt.Sprintf("(() => {\n"+
+			"  let __forallHolds = true;\n"+
+			"  for (const %s of %s) {\n"+
+			"    if (!(%s)) {\n"+
+			"      __forallHolds = false;\n"+
+			"      break;\n"+
+			"    }\n"+
+			"  }\n"+
+			"  return __forallHolds;\n"+
+			"})()", expr.Variable, keys, body)
+	}
 	rangeStart := g.generateExpr(expr.Domain.Start)
 	rangeEnd := g.generateExpr(expr.Domain.End)
-	body := g.generateExpr(expr.Body)
 
 	return fmt.Sprintf("(() => {\n"+
 		"  let __forallHolds = true;\n"+
@@ -955,9 +1091,22 @@ func (g *generator) generateForallExpr(expr *ir.ForallExpr) string {
 }
 
 func (g *generator) generateExistsExpr(expr *ir.ExistsExpr) string {
+	body := g.generateExpr(expr.Body)
+	if expr.Map != nil {
+		keys := g.callHelper("__intent_map_keys", g.generateExpr(expr.Map))
+		return fmt.Sprintf("(() => {\n"+
+			"  let __existsFound = false;\n"+
+			"  for (const %s of %s) {\n"+
+			"    if (%s) {\n"+
+			"      __existsFound = true;\n"+
+			"      break;\n"+
+			"    }\n"+
+			"  }\n"+
+			"  return __existsFound;\n"+
+			"})()", expr.Variable, keys, body)
+	}
 	rangeStart := g.generateExpr(expr.Domain.Start)
 	rangeEnd := g.generateExpr(expr.Domain.End)
-	body := g.generateExpr(expr.Body)
 
 	return fmt.Sprintf("(() => {\n"+
 		"  let __existsFound = false;\n"+
@@ -91,17 +91,17 @@ func TestGenerateFunction(t *testing.T) {
 	if !strings.Contains(result, "function add(a, b)") {
 		t.Errorf("Expected function add(a, b), got:\n%s", result)
 	}
-	if !strings.Contains(result, "@param {number} a") {
+	if !strings.Contains(result, "@param {bigint} a") {
 		t.Errorf("Expected JSDoc @param for a, got:\n%s", result)
 	}
-	if !strings.Contains(result, "@param {number} b") {
+	if !strings.Contains(result, "@param {bigint} b") {
 		t.Errorf("Expected JSDoc @param for b, got:\n%s", result)
 	}
-	if !strings.Contains(result, "@returns {number}") {
+	if !strings.Contains(result, "@returns {bigint}") {
 		t.Errorf("Expected JSDoc @returns, got:\n%s", result)
 	}
-	if !strings.Contains(result, "return (a + b)") {
-		t.Errorf("Expected return (a + b), got:\n%s", result)
+	if !strings.Contains(result, "return BigInt.asIntN(64, a + b)") {
+		t.Errorf("Expected wrapping addition, got:\n%s", result)
 	}
 }
 
@@ -181,6 +181,137 @@ func TestGenerateEntity(t *testing.T) {
 	}
 }
 
+func TestGenerateTrait(t *testing.T) {
+	intT := &checker.Type{Name: "Int"}
+	shapeT := &checker.Type{Name: "Shape", IsTrait: true}
+	squareT := &checker.Type{Name: "Square", IsEntity: true}
+	mod := &ir.Module{
+		Name: "test",
+		Traits: []*ir.Trait{{
+			Name: "Shape",
+			Methods: []*ir.Method{
+				{Name: "area", ReturnType: intT},
+				{Name: "scale", Params: []*ir.Param{{Name: "k", Type: intT}}, ReturnType: checker.TypeVoid},
+			},
+		}},
+		Entities: []*ir.Entity{{
+			Name:       "Square",
+			Implements: []string{"Shape"},
+			Fields:     []*ir.Field{{Name: "side", Type: intT}},
+			Methods: []*ir.Method{{
+				Name:       "area",
+				ReturnType: intT,
+				Body: []ir.Stmt{&ir.ReturnStmt{Value: &ir.FieldAccessExpr{
+					Object: &ir.SelfRef{Type: squareT}, Field: "side", Type: intT,
+				}}},
+			}},
+		}},
+		Functions: []*ir.Function{{
+			Name:       "wrap",
+			ReturnType: shapeT,
+			Body: []ir.Stmt{&ir.ReturnStmt{Value: &ir.UpcastExpr{Type: shapeT, Value: &ir.CallExpr{
+				Function: "Square", Kind: ir.CallConstructor, Type: squareT,
+			}}}},
+		}},
+	}
+
+	result := Generate(mod)
+
+	for _, want := range []string{
+		" * Trait: Shape\n * @interface\n * area()\n * scale(k)\n */",
+		" * Entity: Square\n * @implements {Shape}\n */",
+		"return new Square();",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+	if strings.Index(result, "Trait: Shape") > strings.Index(result, "class Square") {
+		t.Errorf("Expected the trait before the entities, got:\n%s", result)
+	}
+}
+
+func TestGenerateMap(t *testing.T) {
+	intT := &checker.Type{Name: "Int"}
+	strT := &checker.Type{Name: "String"}
+	mapT := checker.MapType(strT, intT)
+	m := &ir.VarRef{Name: "m", Type: mapT}
+	k := &ir.VarRef{Name: "k", Type: strT}
+	mod := &ir.Module{
+		Name: "test",
+		Functions: []*ir.Function{{
+			Name:       "total",
+			Params:     []*ir.Param{{Name: "m", Type: mapT}},
+			ReturnType: intT,
+			Requires: []*ir.Contract{{
+				Expr: &ir.ForallExpr{
+					Variable: "k",
+					Map:      m,
+					Body:     &ir.MethodCallExpr{Object: m, Method: "contains", Args: []ir.Expr{k}, Type: checker.TypeBool},
+					Type:     checker.TypeBool,
+				},
+				RawText: "forall k in m: m.contains(k)",
+			}},
+			Body: []ir.Stmt{
+				&ir.ExprStmt{Expr: &ir.MethodCallExpr{Object: m, Method: "set", Args: []ir.Expr{&ir.StringLit{Value: "\"a\"", Type: strT}, &ir.IntLit{Value: 1, Type: intT}}, Type: checker.TypeVoid}},
+				&ir.ForInStmt{Variable: "k", ValueVariable: "v", Iterable: m, Body: []ir.Stmt{
+					&ir.ExprStmt{Expr: &ir.CallExpr{Function: "print", Kind: ir.CallBuiltin, Args: []ir.Expr{&ir.VarRef{Name: "v", Type: intT}}, Type: checker.TypeVoid}},
+				}},
+				&ir.ReturnStmt{Value: &ir.CallExpr{Function: "len", Kind: ir.CallBuiltin, Args: []ir.Expr{m}, Type: intT}},
+			},
+		}},
+	}
+
+	result := Generate(mod)
+
+	for _, want := range []string{
+		"function __intent_map_keys(m) {",
+		"function __intent_map_entries(m) {",
+		" * @param {Map<string, bigint>} m",
+		"for (const k of __intent_map_keys(m)) {\n    if (!(m.has(k))) {",
+		"m.set(\"a\", 1n);",
+		"for (const [k, v] of __intent_map_entries(m)) {",
+		"return BigInt(m.size);",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+	if strings.Contains(result, "__intent_map_get") {
+		t.Errorf("Expected only the map helpers used, got:\n%s", result)
+	}
+}
+
+func TestGenerateTry(t *testing.T) {
+	intT := &checker.Type{Name: "Int"}
+	optT := checker.OptionType(intT)
+	mod := &ir.Module{
+		Name: "test",
+		Functions: []*ir.Function{{
+			Name:       "first",
+			Params:     []*ir.Param{{Name: "o", Type: optT}},
+			ReturnType: optT,
+			Body: []ir.Stmt{
+				&ir.LetStmt{Name: "x", Type: intT, Value: &ir.TryExpr{Expr: &ir.VarRef{Name: "o", Type: optT}, Type: intT}},
+				&ir.ReturnStmt{Value: &ir.VarRef{Name: "o", Type: optT}},
+			},
+		}},
+	}
+
+	result := Generate(mod)
+
+	for _, want := range []string{
+		"class __IntentTry {",
+		"if (v._tag === \"Err\" || v._tag === \"None\") throw new __IntentTry(v);",
+		"  try {\n    let x = __intent_try(o);",
+		"  } catch (e) {\n    if (e instanceof __IntentTry) return e.value;\n    throw e;\n  }",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+}
+
 func TestGenerateEnum(t *testing.T) {
 	mod := &ir.Module{
 		Name:    "test",
@@ -270,12 +401,16 @@ func TestGenerateContracts(t *testing.T) {
 
 	result := Generate(mod)
 
-	if !strings.Contains(result, "if (!((b !== 0))) throw new Error(\"Precondition failed: b != 0\")") {
+	if !strings.Contains(result, "if (!((b !== 0n))) throw new Error(\"Precondition failed: b != 0\")") {
 		t.Errorf("Expected precondition check, got:\n%s", result)
 	}
 	if !strings.Contains(result, "if (!((__result < a))) throw new Error(\"Postcondition failed: result < a\")") {
 		t.Errorf("Expected postcondition check, got:\n%s", result)
 	}
+	// The body's return must not bypass the postcondition
+	if !strings.Contains(result, "const __result = (() => {\n    return __intent_div(a, b);\n  })();") {
+		t.Errorf("Expected the body wrapped in a closure, got:\n%s", result)
+	}
 }
 
 func TestGenerateAll(t *testing.T) {
@@ -336,6 +471,86 @@ func TestGenerateAll(t *testing.T) {
 	}
 }
 
+func TestGenerateAllImportedTypes(t *testing.T) {
+	intT := &checker.Type{Name: "Int"}
+	pointT := &checker.Type{Name: "Point", IsEntity: true}
+	colorT := &checker.Type{Name: "Color", IsEnum: true}
+	prog := &ir.Program{
+		Modules: []*ir.Module{
+			{
+				Name: "geo",
+				Entities: []*ir.Entity{
+					{
+						Name:   "Point",
+						Fields: []*ir.Field{{Name: "x", Type: intT}},
+						Constructor: &ir.Constructor{
+							Params: []*ir.Param{{Name: "x", Type: intT}},
+						},
+					},
+				},
+				Enums: []*ir.Enum{
+					{Name: "Color", Variants: []*ir.EnumVariant{{Name: "Red"}}},
+				},
+				Functions: []*ir.Function{
+					{
+						Name:       "origin",
+						ReturnType: pointT,
+						Body: []ir.Stmt{
+							&ir.ReturnStmt{Value: &ir.CallExpr{
+								Function: "Point", Kind: ir.CallConstructor, Type: pointT,
+								Args: []ir.Expr{&ir.IntLit{Value: 0, Type: intT}},
+							}},
+						},
+					},
+					{
+						Name:       "start",
+						ReturnType: pointT,
+						Body: []ir.Stmt{
+							&ir.ReturnStmt{Value: &ir.CallExpr{Function: "origin", Kind: ir.CallFunction, Type: pointT}},
+						},
+					},
+				},
+			},
+			{
+				Name:    "main",
+				IsEntry: true,
+				Functions: []*ir.Function{
+					{
+						Name:       "__intent_main",
+						IsEntry:    true,
+						ReturnType: intT,
+						Body: []ir.Stmt{
+							&ir.LetStmt{Name: "p", Type: pointT, Value: &ir.CallExpr{
+								Function: "Point", Kind: ir.CallConstructor, Type: pointT,
+								Args: []ir.Expr{&ir.IntLit{Value: 1, Type: intT}},
+							}},
+							&ir.LetStmt{Name: "c", Type: colorT, Value: &ir.CallExpr{
+								Function: "Red", EnumName: "Color", Kind: ir.CallVariant, Type: colorT,
+							}},
+							&ir.ReturnStmt{Value: &ir.IntLit{Value: 0, Type: intT}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result := GenerateAll(prog)
+
+	for _, want := range []string{
+		"class GeoPoint {",
+		"const GeoColor = {",
+		"return new GeoPoint(0n);",
+		"return geo_origin();",
+		"let p = new GeoPoint(1n);",
+		"let c = GeoColor.Red();",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q in output:\n%s", want, result)
+		}
+	}
+}
+
 func TestGenerateStringInterp(t *testing.T) {
 	mod := &ir.Module{
 		Name:    "test",
@@ -376,3 +591,126 @@ func TestGenerateStringInterp(t *testing.T) {
 		t.Errorf("Expected backtick template literal, got:\n%s", result)
 	}
 }
+
+func TestGenerateIntModes(t *testing.T) {
+	intT := &checker.Type{Name: "Int"}
+	xs := &ir.VarRef{Name: "xs", Type: &checker.Type{Name: "Array", IsGeneric: true, TypeParams: []*checker.Type{intT}}}
+	mod := &ir.Module{
+		Name:    "test",
+		IsEntry: true,
+		Functions: []*ir.Function{
+			{
+				Name:       "__intent_main",
+				IsEntry:    true,
+				ReturnType: intT,
+				Body: []ir.Stmt{
+					&ir.LetStmt{Name: "xs", Type: xs.Type, Value: &ir.ArrayLit{
+						Elements: []ir.Expr{&ir.IntLit{Value: 7, Type: intT}},
+						Type:     xs.Type,
+					}},
+					&ir.ExprStmt{Expr: &ir.CallExpr{
+						Function: "print",
+						Kind:     ir.CallBuiltin,
+						Args: []ir.Expr{&ir.BinaryExpr{
+							Left:  &ir.IndexExpr{Object: xs, Index: &ir.IntLit{Value: 0, Type: intT}, Type: intT},
+							Op:    lexer.SLASH,
+							Right: &ir.CallExpr{Function: "len", Kind: ir.CallBuiltin, Args: []ir.Expr{xs}, Type: intT},
+							Type:  intT,
+						}},
+						Type: &checker.Type{Name: "Void"},
+					}},
+					&ir.ReturnStmt{Value: &ir.UnaryExpr{
+						Op:      lexer.MINUS,
+						Operand: &ir.VarRef{Name: "n", Type: intT},
+						Type:    intT,
+					}},
+				},
+			},
+		},
+	}
+
+	bigint := Generate(mod)
+	for _, want := range []string{
+		"let xs = [7n];",
+		"console.log(String(__intent_div(xs[0n], BigInt(xs.length))));",
+		"return BigInt.asIntN(64, -n);",
+		"if (b === -1n && a === -9223372036854775808n) throw new Error(\"attempt to divide with overflow\");",
+		"const __exitCode = Number(__intent_main());",
+	} {
+		if !strings.Contains(bigint, want) {
+			t.Errorf("bigint: expected %q, got:\n%s", want, bigint)
+		}
+	}
+	if strings.Contains(bigint, "function __intent_rem") {
+		t.Errorf("bigint: unused helper emitted:\n%s", bigint)
+	}
+
+	number := GenerateWith(mod, Options{IntMode: IntNumber})
+	for _, want := range []string{
+		"let xs = [7];",
+		"console.log(__intent_div(xs[0], (xs.length)));",
+		"return __intent_int(-n);",
+		"return __intent_int(Math.trunc(a / b));",
+		"if (!Number.isSafeInteger(n)) throw",
+		"const __exitCode = __intent_main();",
+	} {
+		if !strings.Contains(number, want) {
+			t.Errorf("number: expected %q, got:\n%s", want, number)
+		}
+	}
+	if strings.Count(number, "function __intent_int") != 1 {
+		t.Errorf("number: expected __intent_int exactly once, got:\n%s", number)
+	}
+}
+
+func TestParseIntMode(t *testing.T) {
+	for _, s := range []string{"bigint", "number"} {
+		if mode, err := ParseIntMode(s); err != nil || string(mode) != s {
+			t.Errorf("ParseIntMode(%q) = %q, %v", s, mode, err)
+		}
+	}
+	if _, err := ParseIntMode("float"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestGenerateDebugContracts(t *testing.T) {
+	intT := &checker.Type{Name: "Int"}
+	boolT := &checker.Type{Name: "Bool"}
+	positive := func(e ir.Expr, raw string, always bool) *ir.Contract {
+		return &ir.Contract{
+			Expr:        &ir.BinaryExpr{Left: e, Op: lexer.GT, Right: &ir.IntLit{Value: 0, Type: intT}, Type: boolT},
+			RawText:     raw,
+			AlwaysCheck: always,
+		}
+	}
+	mod := &ir.Module{
+		Name: "test",
+		Functions: []*ir.Function{
+			{
+				Name:       "id",
+				Params:     []*ir.Param{{Name: "n", Type: intT}},
+				ReturnType: intT,
+				Requires:   []*ir.Contract{positive(&ir.VarRef{Name: "n", Type: intT}, "n > 0", false)},
+				Ensures:    []*ir.Contract{positive(&ir.ResultRef{Type: intT}, "result > 0", true)},
+				Body:       []ir.Stmt{&ir.ReturnStmt{Value: &ir.VarRef{Name: "n", Type: intT}}},
+			},
+		},
+	}
+
+	if plain := Generate(mod); strings.Contains(plain, "__intentContracts") {
+		t.Errorf("Expected no contracts flag by default, got:\n%s", plain)
+	}
+
+	result := GenerateWith(mod, Options{DebugContracts: true})
+	for _, want := range []string{
+		`globalThis.__intentContracts ??= typeof process === "undefined" || process.env.INTENT_CONTRACTS !== "off";`,
+		`if (globalThis.__intentContracts && !((n > 0n))) throw new Error("Precondition failed: n > 0");`,
+		// @always_check clauses ignore the flag
+		`if (!((__result > 0n))) throw new Error("Postcondition failed: result > 0");`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package jsbe
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// A Map<K, V> is a JS Map. Int keys are BigInts or numbers, both of which
+// Map compares by value. Iteration goes through the helpers below, which
+// sort the keys so maps are iterated in ascending key order as in the
+// other backends.
+
+// mapHelpers are the runtime helpers for Map<K, V>, in emission order.
+var mapHelpers = []struct {
+	name   string
+	source string
+}{
+	{
+		name: "__intent_map_keys",
+		source: `function __intent_map_keys(m) {
+  return [...m.keys()].sort((a, b) => (a < b ? -1 : a > b ? 1 : 0));
+}`,
+	},
+	{
+		name: "__intent_map_values",
+		source: `function __intent_map_values(m) {
+  return __intent_map_keys(m).map((k) => m.get(k));
+}`,
+	},
+	{
+		name: "__intent_map_entries",
+		source: `function __intent_map_entries(m) {
+  return __intent_map_keys(m).map((k) => [k, m.get(k)]);
+}`,
+	},
+	{
+		name: "__intent_map_get",
+		source: `function __intent_map_get(m, k) {
+  return m.has(k) ? { _tag: "Some", value: m.get(k) } : { _tag: "None" };
+}`,
+	},
+}
+
+// mapPrelude returns the source of the map helpers that were used.
+func mapPrelude(helpers map[string]bool) string {
+	if helpers["__intent_map_values"] || helpers["__intent_map_entries"] {
+		helpers["__intent_map_keys"] = true
+	}
+	var sb strings.Builder
+	for _, h := range mapHelpers {
+		if helpers[h.name] {
+			sb.WriteString(h.source)
+			sb.WriteString("\n\n")
+		}
+	}
+	return sb.String()
+}
+
+func isMap(e ir.Expr) bool {
+	return checker.IsMap(e.ExprType())
+}
+
+// generateMapMethod generates a call to a built-in method of a map.
+func (g *generator) generateMapMethod(obj string, expr *ir.MethodCallExpr) string {
+	args := make([]string, len(expr.Args))
+	for i, arg := range expr.Args {
+		args[i] = g.generateExpr(arg)
+	}
+	switch expr.Method {
+	case "get":
+		return g.callHelper("__intent_map_get", obj, args[0])
+	case "contains":
+		return fmt.Sprintf("%s.has(%s)", obj, args[0])
+	case "set":
+		return fmt.Sprintf("%s.set(%s, %s)", obj, args[0], args[1])
+	case "remove":
+		return fmt.Sprintf("%s.delete(%s)", obj, args[0])
+	case "keys":
+		return g.callHelper("__intent_map_keys", obj)
+	case "values":
+		return g.callHelper("__intent_map_values", obj)
+	}
+	return fmt.Sprintf("%s.%s(%s)", obj, expr.Method, strings.Join(args, ", "))
+}
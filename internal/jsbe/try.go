@@ -0,0 +1,53 @@
+package jsbe
+
+import "github.com/lhaig/intent/internal/ir"
+
+// The ? operator unwraps an Ok or Some through __intent_try, which throws an
+// Err or None as an __IntentTry. Bodies that use ? catch it and return the
+// value, so the early exit still reaches the checks emitted after the body,
+// as it does in the interpreter.
+
+const tryHelper = "__intent_try"
+
+const tryHelperSource = `class __IntentTry {
+  constructor(value) {
+    this.value = value;
+  }
+}
+
+function __intent_try(v) {
+  if (v._tag === "Err" || v._tag === "None") throw new __IntentTry(v);
+  return v.value;
+}`
+
+// usesTry reports whether body contains a ? expression.
+func usesTry(body []ir.Stmt) bool {
+	found := false
+	ir.WalkStmtExprs(body, func(e ir.Expr) {
+		ir.WalkExpr(e, func(x ir.Expr) {
+			if _, ok := x.(*ir.TryExpr); ok {
+				found = true
+			}
+		})
+	})
+	return found
+}
+
+// generateBody emits the statements of a function or method body, catching
+// the early exit of a ? when the body uses one.
+func (g *generator) generateBody(body []ir.Stmt) {
+	if !usesTry(body) {
+		g.generateStmts(body)
+		return
+	}
+	g.emitLine("try {")
+	g.incIndent()
+	g.generateStmts(body)
+	g.decIndent()
+	g.emitLine("} catch (e) {")
+	g.incIndent()
+	g.emitLine("if (e instanceof __IntentTry) return e.value;")
+	g.emitLine("throw e;")
+	g.decIndent()
+	g.emitLine("}")
+}
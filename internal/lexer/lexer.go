@@ -1,13 +1,16 @@
 package lexer
 
+import "strings"
+
 // Lexer scans Intent source code and produces tokens
 type Lexer struct {
 	input        string
-	position     int  // current position in input (points to current char)
-	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
-	line         int  // current line number
-	column       int  // current column number
+	position     int       // current position in input (points to current char)
+	readPosition int       // current reading position in input (after current char)
+	ch           byte      // current char under examination
+	line         int       // current line number
+	column       int       // current column number
+	comments     []Comment // comments read since the last token
 }
 
 // New creates a new Lexer instance
@@ -52,15 +55,26 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-// skipSingleLineComment skips a single-line comment (//)
-func (l *Lexer) skipSingleLineComment() {
-	// Skip until end of line or end of file
+// readSingleLineComment reads a single-line comment (//) up to the end of the line
+func (l *Lexer) readSingleLineComment() string {
+	position := l.position
+	// Read until end of line or end of file
 	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	return strings.TrimRight(l.input[position:l.position], " \t\r")
+}
+
+// readMultiLineComment reads a multi-line comment (/* */), starting at the '/'
+func (l *Lexer) readMultiLineComment() string {
+	position := l.position
+	l.readChar() // consume '/'
+	l.readChar() // consume '*'
+	l.skipMultiLineComment()
+	return l.input[position:l.position]
 }
 
-// skipMultiLineComment skips a multi-line comment (/* */)
+// skipMultiLineComment skips the rest of a multi-line comment (/* */)
 func (l *Lexer) skipMultiLineComment() {
 	// Already read '/*', now skip until '*/'
 	for {
@@ -151,8 +165,16 @@ func (l *Lexer) readString() (string, bool, bool) {
 	return literal, hasInterp, true
 }
 
-// NextToken returns the next token from the input
+// NextToken returns the next token from the input. Comments are not tokens;
+// they are attached to the token that follows them as Leading trivia.
 func (l *Lexer) NextToken() Token {
+	tok := l.nextToken()
+	tok.Leading = l.comments
+	l.comments = nil
+	return tok
+}
+
+func (l *Lexer) nextToken() Token {
 	var tok Token
 
 	l.skipWhitespace()
@@ -206,13 +228,13 @@ func (l *Lexer) NextToken() Token {
 		tok = Token{Type: STAR, Literal: string(l.ch), Line: tok.Line, Column: tok.Column}
 	case '/':
 		if l.peekChar() == '/' {
-			l.skipSingleLineComment()
-			return l.NextToken() // Recursively get next token
+			text := l.readSingleLineComment()
+			l.comments = append(l.comments, Comment{Text: text, Line: tok.Line, Column: tok.Column})
+			return l.nextToken() // Recursively get next token
 		} else if l.peekChar() == '*' {
-			l.readChar() // consume '/'
-			l.readChar() // consume '*'
-			l.skipMultiLineComment()
-			return l.NextToken() // Recursively get next token
+			text := l.readMultiLineComment()
+			l.comments = append(l.comments, Comment{Text: text, Line: tok.Line, Column: tok.Column})
+			return l.nextToken() // Recursively get next token
 		} else {
 			tok = Token{Type: SLASH, Literal: string(l.ch), Line: tok.Line, Column: tok.Column}
 		}
@@ -246,6 +268,8 @@ func (l *Lexer) NextToken() Token {
 		}
 	case '?':
 		tok = Token{Type: QUESTION, Literal: string(l.ch), Line: tok.Line, Column: tok.Column}
+	case '@':
+		tok = Token{Type: AT, Literal: string(l.ch), Line: tok.Line, Column: tok.Column}
 	case '"':
 		str, hasInterp, ok := l.readString()
 		if !ok {
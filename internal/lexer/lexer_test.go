@@ -42,10 +42,10 @@ func TestNextToken_Operators(t *testing.T) {
 }
 
 func TestNextToken_Delimiters(t *testing.T) {
-	input := "( ) { } [ ] , : ; ."
+	input := "( ) { } [ ] , : ; . @"
 	expected := []TokenType{
 		LPAREN, RPAREN, LBRACE, RBRACE, LBRACKET, RBRACKET,
-		COMMA, COLON, SEMICOLON, DOT, EOF,
+		COMMA, COLON, SEMICOLON, DOT, AT, EOF,
 	}
 
 	l := New(input)
@@ -401,6 +401,30 @@ multi-line comment */ y`
 	}
 }
 
+func TestNextToken_CommentsAttachToNextToken(t *testing.T) {
+	input := `x // first
+/* second */ y`
+
+	l := New(input)
+	x := l.NextToken()
+	if len(x.Leading) != 0 {
+		t.Errorf("expected no comments before x, got %v", x.Leading)
+	}
+	y := l.NextToken()
+	if len(y.Leading) != 2 {
+		t.Fatalf("expected 2 comments before y, got %v", y.Leading)
+	}
+	if y.Leading[0].Text != "// first" || y.Leading[0].Line != 1 || y.Leading[0].Column != 3 {
+		t.Errorf("unexpected first comment: %+v", y.Leading[0])
+	}
+	if y.Leading[1].Text != "/* second */" || y.Leading[1].Line != 2 {
+		t.Errorf("unexpected second comment: %+v", y.Leading[1])
+	}
+	if eof := l.NextToken(); eof.Type != EOF || len(eof.Leading) != 0 {
+		t.Errorf("expected bare EOF, got %+v", eof)
+	}
+}
+
 func TestNextToken_CompleteMiniProgram(t *testing.T) {
 	input := `module MyModule
 version "1.0.0"
@@ -506,7 +530,6 @@ func TestNextToken_IllegalCharacters(t *testing.T) {
 		input    string
 		expected byte
 	}{
-		{"@", '@'},
 		{"#", '#'},
 		{"$", '$'},
 		{"&", '&'},
@@ -625,3 +648,16 @@ func TestNextToken_ImportAndPublicKeywords(t *testing.T) {
 		})
 	}
 }
+
+func TestNextToken_TraitKeywords(t *testing.T) {
+	input := "public trait Shape entity Circle implements Shape, Named"
+	expected := []TokenType{PUBLIC, TRAIT, IDENT, ENTITY, IDENT, IMPLEMENTS, IDENT, COMMA, IDENT, EOF}
+
+	l := New(input)
+	for i, expectedType := range expected {
+		tok := l.NextToken()
+		if tok.Type != expectedType {
+			t.Errorf("token[%d] - wrong type. expected=%q, got=%q", i, expectedType, tok.Type)
+		}
+	}
+}
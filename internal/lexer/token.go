@@ -62,6 +62,8 @@ const (
 	ARROW
 	IMPORT
 	PUBLIC
+	TRAIT
+	IMPLEMENTS
 
 	// Type keywords
 	INT_TYPE
@@ -97,6 +99,7 @@ const (
 	DOT       // .
 	DOTDOT    // ..
 	QUESTION  // ?
+	AT        // @
 )
 
 // Token represents a lexical token
@@ -105,6 +108,19 @@ type Token struct {
 	Literal string
 	Line    int
 	Column  int
+	Leading []Comment // comments between the previous token and this one
+}
+
+// End returns the position just past the token. Tokens never span lines.
+func (t Token) End() (int, int) {
+	return t.Line, t.Column + len(t.Literal)
+}
+
+// Comment is a // or /* */ comment kept as trivia on the following token
+type Comment struct {
+	Text   string // full comment text, including the comment markers
+	Line   int
+	Column int
 }
 
 // String returns a string representation of the token type
@@ -212,6 +228,10 @@ func (t TokenType) String() string {
 		return "IMPORT"
 	case PUBLIC:
 		return "PUBLIC"
+	case TRAIT:
+		return "TRAIT"
+	case IMPLEMENTS:
+		return "IMPLEMENTS"
 	case INT_TYPE:
 		return "INT_TYPE"
 	case FLOAT_TYPE:
@@ -270,6 +290,8 @@ func (t TokenType) String() string {
 		return "DOTDOT"
 	case QUESTION:
 		return "QUESTION"
+	case AT:
+		return "AT"
 	default:
 		return fmt.Sprintf("TokenType(%d)", t)
 	}
@@ -320,6 +342,8 @@ var keywords = map[string]TokenType{
 	"match":       MATCH,
 	"import":      IMPORT,
 	"public":      PUBLIC,
+	"trait":       TRAIT,
+	"implements":  IMPLEMENTS,
 	"Int":         INT_TYPE,
 	"Float":       FLOAT_TYPE,
 	"String":      STRING_TYPE,
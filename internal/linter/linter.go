@@ -354,6 +354,9 @@ func (l *Linter) collectUsedNamesFromExpr(expr ast.Expression, used map[string]b
 			l.collectUsedNamesFromExpr(e.Domain.Start, used)
 			l.collectUsedNamesFromExpr(e.Domain.End, used)
 		}
+		if e.Map != nil {
+			l.collectUsedNamesFromExpr(e.Map, used)
+		}
 		l.collectUsedNamesFromExpr(e.Body, used)
 		// Note: e.Variable is NOT an external used name - it's defined by the quantifier
 	case *ast.ExistsExpr:
@@ -362,6 +365,9 @@ func (l *Linter) collectUsedNamesFromExpr(expr ast.Expression, used map[string]b
 			l.collectUsedNamesFromExpr(e.Domain.Start, used)
 			l.collectUsedNamesFromExpr(e.Domain.End, used)
 		}
+		if e.Map != nil {
+			l.collectUsedNamesFromExpr(e.Map, used)
+		}
 		l.collectUsedNamesFromExpr(e.Body, used)
 		// Note: e.Variable is NOT an external used name - it's defined by the quantifier
 	case *ast.MatchExpr:
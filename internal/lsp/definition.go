@@ -0,0 +1,529 @@
+package lsp
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lhaig/intent/internal/ast"
+	"github.com/lhaig/intent/internal/formatter"
+)
+
+// symbol is a declaration a name resolves to.
+type symbol struct {
+	path   string   // file declaring it; "" for the document itself
+	node   ast.Node // the declaration; nil for a whole module
+	name   string   // declared name, used to place the range on the name
+	entity string   // enclosing entity or enum for members and variants
+	ctor   bool     // the name is a constructor call
+}
+
+// definition returns the location of the declaration under pos.
+func (doc *document) definition(pos Position) *Location {
+	sym := doc.resolve(pos)
+	if sym == nil {
+		return nil
+	}
+	if sym.path == "" {
+		return &Location{URI: doc.uri, Range: declRange(doc.text, sym)}
+	}
+	return &Location{URI: pathToURI(sym.path), Range: declRange(moduleText(sym.path), sym)}
+}
+
+// hover describes the declaration under pos, or the type of the expression
+// under pos when it is not a reference to a declaration.
+func (doc *document) hover(pos Position) *Hover {
+	word, line, col, ok := doc.wordAt(pos)
+	if !ok {
+		return nil
+	}
+	r := doc.wordRange(line, col)
+
+	var text string
+	if sym := doc.resolve(pos); sym != nil {
+		text = describe(sym)
+	} else if expr := doc.exprAt(line, col); expr != nil {
+		if t := doc.types[expr]; t != nil {
+			text = fmt.Sprintf("%s: %s", word, t)
+		}
+	}
+	if text == "" {
+		return nil
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```intent\n" + text + "\n```"},
+		Range:    &r,
+	}
+}
+
+// resolve finds the declaration the identifier under pos refers to.
+func (doc *document) resolve(pos Position) *symbol {
+	word, line, col, ok := doc.wordAt(pos)
+	if !ok || doc.prog == nil {
+		return nil
+	}
+
+	switch e := doc.exprAt(line, col).(type) {
+	case *ast.MethodCallExpr:
+		if mod := doc.moduleRef(e.Object); mod != nil {
+			return lookupName(mod.prog, mod.path, e.Method)
+		}
+		if ent, path := doc.entityOf(e.Object); ent != nil {
+			for _, m := range ent.Methods {
+				if m.Name == e.Method {
+					return &symbol{path: path, node: m, name: m.Name, entity: ent.Name}
+				}
+			}
+		}
+		if trait, path := doc.traitOf(e.Object); trait != nil {
+			for _, m := range trait.Methods {
+				if m.Name == e.Method {
+					return &symbol{path: path, node: m, name: m.Name, entity: trait.Name}
+				}
+			}
+		}
+		return nil
+	case *ast.FieldAccessExpr:
+		if ent, path := doc.entityOf(e.Object); ent != nil {
+			for _, f := range ent.Fields {
+				if f.Name == e.Field {
+					return &symbol{path: path, node: f, name: f.Name, entity: ent.Name}
+				}
+			}
+		}
+		return nil
+	case *ast.Identifier:
+		if mod := doc.moduleRef(e); mod != nil {
+			return &symbol{path: mod.path}
+		}
+	case *ast.CallExpr:
+		if sym := doc.lookup(word); sym != nil {
+			if _, isEntity := sym.node.(*ast.EntityDecl); isEntity {
+				sym.ctor = true
+			}
+			return sym
+		}
+		return nil
+	}
+
+	// Import paths resolve to the imported file
+	for _, imp := range doc.prog.Imports {
+		if imp.Line == line {
+			if mod := doc.modules[strings.TrimSuffix(imp.Path, ".intent")]; mod != nil {
+				return &symbol{path: mod.path}
+			}
+		}
+	}
+
+	if sym := doc.lookup(word); sym != nil {
+		return sym
+	}
+	// Entity members, when hovering or jumping from their own declaration
+	return memberOnLine(doc.prog, line, word)
+}
+
+// lookup resolves a top-level name in the document, then in imported modules.
+func (doc *document) lookup(name string) *symbol {
+	if sym := lookupName(doc.prog, "", name); sym != nil {
+		return sym
+	}
+	for _, mod := range doc.modules {
+		if sym := lookupName(mod.prog, mod.path, name); sym != nil {
+			return sym
+		}
+	}
+	return nil
+}
+
+// lookupName finds a function, entity, enum, trait or enum variant declared
+// in prog.
+func lookupName(prog *ast.Program, path, name string) *symbol {
+	for _, fn := range prog.Functions {
+		if fn.Name == name {
+			return &symbol{path: path, node: fn, name: name}
+		}
+	}
+	for _, ent := range prog.Entities {
+		if ent.Name == name {
+			return &symbol{path: path, node: ent, name: name}
+		}
+	}
+	for _, en := range prog.Enums {
+		if en.Name == name {
+			return &symbol{path: path, node: en, name: name}
+		}
+	}
+	for _, tr := range prog.Traits {
+		if tr.Name == name {
+			return &symbol{path: path, node: tr, name: name}
+		}
+	}
+	for _, en := range prog.Enums {
+		for _, v := range en.Variants {
+			if v.Name == name {
+				return &symbol{path: path, node: v, name: name, entity: en.Name}
+			}
+		}
+	}
+	return nil
+}
+
+// memberOnLine finds a field or method named name declared on a line.
+func memberOnLine(prog *ast.Program, line int, name string) *symbol {
+	for _, ent := range prog.Entities {
+		for _, f := range ent.Fields {
+			if f.Line == line && f.Name == name {
+				return &symbol{node: f, name: name, entity: ent.Name}
+			}
+		}
+		for _, m := range ent.Methods {
+			if m.Line == line && m.Name == name {
+				return &symbol{node: m, name: name, entity: ent.Name}
+			}
+		}
+	}
+	for _, tr := range prog.Traits {
+		for _, m := range tr.Methods {
+			if m.Line == line && m.Name == name {
+				return &symbol{node: m, name: name, entity: tr.Name}
+			}
+		}
+	}
+	return nil
+}
+
+// moduleRef returns the imported module an expression names, if it is an
+// identifier that is not a typed value.
+func (doc *document) moduleRef(expr ast.Expression) *module {
+	ident, ok := expr.(*ast.Identifier)
+	if !ok || doc.types[ident] != nil {
+		return nil
+	}
+	return doc.modules[ident.Name]
+}
+
+// entityOf returns the declaration of the entity an expression evaluates to,
+// and the file declaring it ("" for this document).
+func (doc *document) entityOf(expr ast.Expression) (*ast.EntityDecl, string) {
+	var name string
+	if _, isSelf := expr.(*ast.SelfExpr); isSelf {
+		line, _ := expr.Pos()
+		name = enclosingEntity(doc.prog, line)
+	} else if t := doc.types[expr]; t != nil {
+		name = t.Name
+	}
+	sym := doc.lookup(name)
+	if sym == nil {
+		return nil, ""
+	}
+	ent, _ := sym.node.(*ast.EntityDecl)
+	return ent, sym.path
+}
+
+// traitOf returns the declaration of the trait an expression's value has.
+func (doc *document) traitOf(expr ast.Expression) (*ast.TraitDecl, string) {
+	t := doc.types[expr]
+	if t == nil || !t.IsTrait {
+		return nil, ""
+	}
+	sym := doc.lookup(t.Name)
+	if sym == nil {
+		return nil, ""
+	}
+	trait, _ := sym.node.(*ast.TraitDecl)
+	return trait, sym.path
+}
+
+// enclosingEntity returns the name of the last entity declared at or before
+// line, which is the entity whose body contains it.
+func enclosingEntity(prog *ast.Program, line int) string {
+	name, start := "", 0
+	for _, ent := range prog.Entities {
+		if ent.Line <= line && ent.Line > start {
+			name, start = ent.Name, ent.Line
+		}
+	}
+	return name
+}
+
+// moduleText returns the source of an imported file, for placing ranges.
+func moduleText(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// declRange places a declaration's range on its name when the name appears
+// on the declaration line, and on the start of the declaration otherwise.
+func declRange(text string, sym *symbol) Range {
+	if sym.node == nil {
+		return Range{}
+	}
+	line, col := sym.node.Pos()
+	src := lineOf(text, line)
+	if col >= 1 && col-1 <= len(src) {
+		for i := col - 1; i+len(sym.name) <= len(src); i++ {
+			j := i + len(sym.name)
+			if src[i:j] == sym.name && (i == 0 || !isIdentByte(src[i-1])) && (j == len(src) || !isIdentByte(src[j])) {
+				return Range{Start: position(text, line, i+1), End: position(text, line, j+1)}
+			}
+		}
+	}
+	start := position(text, line, col)
+	return Range{Start: start, End: start}
+}
+
+// --- finding expressions ---
+
+// exprAt returns the identifier-like expression (identifier, call, method
+// call or field access) whose name starts at a 1-based line and byte column.
+func (doc *document) exprAt(line, col int) ast.Expression {
+	var found ast.Expression
+	walkProgram(doc.prog, func(e ast.Expression) {
+		if found != nil {
+			return
+		}
+		switch e.(type) {
+		case *ast.Identifier, *ast.CallExpr, *ast.MethodCallExpr, *ast.FieldAccessExpr:
+			if l, c := e.Pos(); l == line && c == col {
+				found = e
+			}
+		}
+	})
+	return found
+}
+
+// walkProgram calls visit for every expression in prog, including contracts.
+func walkProgram(prog *ast.Program, visit func(ast.Expression)) {
+	contracts := func(clauses []*ast.ContractClause) {
+		for _, c := range clauses {
+			walkExpr(c.Expr, visit)
+		}
+	}
+	for _, fn := range prog.Functions {
+		contracts(fn.Requires)
+		contracts(fn.Ensures)
+		walkBlock(fn.Body, visit)
+	}
+	for _, ent := range prog.Entities {
+		for _, inv := range ent.Invariants {
+			walkExpr(inv.Expr, visit)
+		}
+		if c := ent.Constructor; c != nil {
+			contracts(c.Requires)
+			contracts(c.Ensures)
+			walkBlock(c.Body, visit)
+		}
+		for _, m := range ent.Methods {
+			contracts(m.Requires)
+			contracts(m.Ensures)
+			walkBlock(m.Body, visit)
+		}
+	}
+}
+
+func walkBlock(b *ast.Block, visit func(ast.Expression)) {
+	if b == nil {
+		return
+	}
+	for _, s := range b.Statements {
+		walkStmt(s, visit)
+	}
+}
+
+func walkStmt(s ast.Statement, visit func(ast.Expression)) {
+	switch stmt := s.(type) {
+	case *ast.LetStmt:
+		walkExpr(stmt.Value, visit)
+	case *ast.AssignStmt:
+		walkExpr(stmt.Target, visit)
+		walkExpr(stmt.Value, visit)
+	case *ast.ReturnStmt:
+		walkExpr(stmt.Value, visit)
+	case *ast.ExprStmt:
+		walkExpr(stmt.Expr, visit)
+	case *ast.IfStmt:
+		walkExpr(stmt.Condition, visit)
+		walkBlock(stmt.Then, visit)
+		walkStmt(stmt.Else, visit)
+	case *ast.WhileStmt:
+		walkExpr(stmt.Condition, visit)
+		for _, inv := range stmt.Invariants {
+			walkExpr(inv.Expr, visit)
+		}
+		if stmt.Decreases != nil {
+			walkExpr(stmt.Decreases.Expr, visit)
+		}
+		walkBlock(stmt.Body, visit)
+	case *ast.ForInStmt:
+		walkExpr(stmt.Iterable, visit)
+		walkBlock(stmt.Body, visit)
+	case *ast.Block:
+		walkBlock(stmt, visit)
+	}
+}
+
+func walkExpr(e ast.Expression, visit func(ast.Expression)) {
+	if e == nil {
+		return
+	}
+	visit(e)
+	switch expr := e.(type) {
+	case *ast.BinaryExpr:
+		walkExpr(expr.Left, visit)
+		walkExpr(expr.Right, visit)
+	case *ast.UnaryExpr:
+		walkExpr(expr.Operand, visit)
+	case *ast.CallExpr:
+		for _, arg := range expr.Args {
+			walkExpr(arg, visit)
+		}
+	case *ast.MethodCallExpr:
+		walkExpr(expr.Object, visit)
+		for _, arg := range expr.Args {
+			walkExpr(arg, visit)
+		}
+	case *ast.FieldAccessExpr:
+		walkExpr(expr.Object, visit)
+	case *ast.IndexExpr:
+		walkExpr(expr.Object, visit)
+		walkExpr(expr.Index, visit)
+	case *ast.OldExpr:
+		walkExpr(expr.Expr, visit)
+	case *ast.ArrayLit:
+		for _, el := range expr.Elements {
+			walkExpr(el, visit)
+		}
+	case *ast.RangeExpr:
+		walkExpr(expr.Start, visit)
+		walkExpr(expr.End, visit)
+	case *ast.ForallExpr:
+		if expr.Domain != nil {
+			walkExpr(expr.Domain, visit)
+		}
+		walkExpr(expr.Map, visit)
+		walkExpr(expr.Body, visit)
+	case *ast.ExistsExpr:
+		if expr.Domain != nil {
+			walkExpr(expr.Domain, visit)
+		}
+		walkExpr(expr.Map, visit)
+		walkExpr(expr.Body, visit)
+	case *ast.MatchExpr:
+		walkExpr(expr.Scrutinee, visit)
+		for _, arm := range expr.Arms {
+			walkExpr(arm.Body, visit)
+		}
+	case *ast.TryExpr:
+		walkExpr(expr.Expr, visit)
+	case *ast.StringInterp:
+		for _, part := range expr.Parts {
+			if part.IsExpr {
+				walkExpr(part.Expr, visit)
+			}
+		}
+	}
+}
+
+// --- hover text ---
+
+// describe renders a declaration the way it is written, with its contracts.
+func describe(sym *symbol) string {
+	switch n := sym.node.(type) {
+	case nil:
+		return "module " + strings.TrimSuffix(baseName(sym.path), ".intent")
+	case *ast.FunctionDecl:
+		var sb strings.Builder
+		if n.IsPublic {
+			sb.WriteString("public ")
+		}
+		if n.IsEntry {
+			sb.WriteString("entry ")
+		}
+		fmt.Fprintf(&sb, "function %s(%s) returns %s", n.Name, params(n.Params), formatter.FormatType(n.ReturnType))
+		writeContracts(&sb, "requires", n.Requires)
+		writeContracts(&sb, "ensures", n.Ensures)
+		return sb.String()
+	case *ast.MethodDecl:
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "method %s.%s(%s) returns %s", sym.entity, n.Name, params(n.Params), formatter.FormatType(n.ReturnType))
+		writeContracts(&sb, "requires", n.Requires)
+		writeContracts(&sb, "ensures", n.Ensures)
+		return sb.String()
+	case *ast.FieldDecl:
+		return fmt.Sprintf("field %s.%s: %s", sym.entity, n.Name, formatter.FormatType(n.Type))
+	case *ast.EntityDecl:
+		var sb strings.Builder
+		if sym.ctor && n.Constructor != nil {
+			fmt.Fprintf(&sb, "%s(%s)", n.Name, params(n.Constructor.Params))
+			writeContracts(&sb, "requires", n.Constructor.Requires)
+			writeContracts(&sb, "ensures", n.Constructor.Ensures)
+			return sb.String()
+		}
+		fmt.Fprintf(&sb, "entity %s", n.Name)
+		if len(n.Implements) > 0 {
+			names := make([]string, len(n.Implements))
+			for i, ref := range n.Implements {
+				names[i] = formatter.FormatType(ref)
+			}
+			fmt.Fprintf(&sb, " implements %s", strings.Join(names, ", "))
+		}
+		for _, f := range n.Fields {
+			fmt.Fprintf(&sb, "\n    field %s: %s", f.Name, formatter.FormatType(f.Type))
+		}
+		for _, inv := range n.Invariants {
+			fmt.Fprintf(&sb, "\n    invariant %s", formatter.FormatExpr(inv.Expr))
+		}
+		return sb.String()
+	case *ast.EnumDecl:
+		names := make([]string, len(n.Variants))
+		for i, v := range n.Variants {
+			names[i] = variant(v)
+		}
+		return fmt.Sprintf("enum %s { %s }", n.Name, strings.Join(names, ", "))
+	case *ast.TraitDecl:
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "trait %s", n.Name)
+		for _, m := range n.Methods {
+			fmt.Fprintf(&sb, "\n    method %s(%s) returns %s", m.Name, params(m.Params), formatter.FormatType(m.ReturnType))
+		}
+		return sb.String()
+	case *ast.EnumVariant:
+		return sym.entity + "." + variant(n)
+	}
+	return ""
+}
+
+func writeContracts(sb *strings.Builder, keyword string, clauses []*ast.ContractClause) {
+	for _, c := range clauses {
+		fmt.Fprintf(sb, "\n    %s %s", keyword, formatter.FormatExpr(c.Expr))
+	}
+}
+
+func params(ps []*ast.Param) string {
+	parts := make([]string, len(ps))
+	for i, p := range ps {
+		parts[i] = p.Name + ": " + formatter.FormatType(p.Type)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func variant(v *ast.EnumVariant) string {
+	if len(v.Fields) == 0 {
+		return v.Name
+	}
+	fields := make([]string, len(v.Fields))
+	for i, f := range v.Fields {
+		fields[i] = f.Name + ": " + formatter.FormatType(f.Type)
+	}
+	return fmt.Sprintf("%s(%s)", v.Name, strings.Join(fields, ", "))
+}
+
+func baseName(path string) string {
+	if i := strings.LastIndexAny(path, `/\`); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
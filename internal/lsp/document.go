@@ -0,0 +1,268 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/lhaig/intent/internal/ast"
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/compiler"
+	"github.com/lhaig/intent/internal/diagnostic"
+	"github.com/lhaig/intent/internal/linter"
+	"github.com/lhaig/intent/internal/parser"
+)
+
+// document is an open file with the results of analyzing it.
+type document struct {
+	uri  string
+	path string // file path, "" for non-file URIs
+	text string
+
+	prog        *ast.Program
+	types       map[ast.Expression]*checker.Type
+	modules     map[string]*module // imported module name -> module
+	diagnostics []Diagnostic
+}
+
+// module is an imported file, addressable by its file name or declared name.
+type module struct {
+	path string
+	prog *ast.Program
+}
+
+// analyze parses, checks and lints a document. Files with imports are
+// checked together with their dependencies through the module registry,
+// using open buffers in place of files on disk.
+func analyze(uri, text string, openSources map[string]string) *document {
+	doc := &document{
+		uri:         uri,
+		text:        text,
+		modules:     make(map[string]*module),
+		diagnostics: []Diagnostic{},
+	}
+	doc.path, _ = uriToPath(uri)
+
+	p := parser.New(text)
+	doc.prog = p.Parse()
+	if p.Diagnostics().HasErrors() {
+		doc.addDiagnostics(p.Diagnostics().All(), "parser")
+		return doc
+	}
+
+	if len(doc.prog.Imports) > 0 && doc.path != "" {
+		doc.checkProject(openSources)
+	} else {
+		result := checker.CheckWithResult(doc.prog)
+		doc.types = result.ExprTypes
+		doc.addDiagnostics(result.Diagnostics.All(), "checker")
+	}
+	doc.addDiagnostics(linter.Lint(doc.prog).All(), "linter")
+	return doc
+}
+
+// checkProject type-checks the document together with the modules it imports.
+func (doc *document) checkProject(openSources map[string]string) {
+	registry, err := compiler.NewModuleRegistry(doc.path)
+	if err != nil {
+		doc.addError(err.Error())
+		return
+	}
+	for path, source := range openSources {
+		registry.SetSource(path, source)
+	}
+	registry.SetSource(doc.path, doc.text)
+
+	diag, err := registry.DiscoverDependencies()
+	if err != nil {
+		doc.addError(err.Error())
+		return
+	}
+	self, _ := filepath.Abs(doc.path)
+	if diag.HasErrors() {
+		doc.addDiagnostics(forFile(diag.All(), self), "parser")
+		return
+	}
+	sorted, err := registry.TopologicalSort()
+	if err != nil {
+		doc.addError(err.Error())
+		return
+	}
+
+	all := registry.AllModules()
+	result := checker.CheckAll(all, sorted)
+	doc.types = result.ExprTypes
+	doc.addDiagnostics(forFile(result.Diagnostics.All(), self), "checker")
+
+	// The registry parsed its own copy of this file; use it so positions
+	// and expressions line up with the checker's types.
+	if prog := all[self]; prog != nil {
+		doc.prog = prog
+	}
+	for path, prog := range all {
+		if path == self {
+			continue
+		}
+		m := &module{path: path, prog: prog}
+		doc.modules[strings.TrimSuffix(filepath.Base(path), ".intent")] = m
+		if prog.Module != nil {
+			doc.modules[prog.Module.Name] = m
+		}
+	}
+}
+
+// forFile keeps the diagnostics that belong to path (or to no file).
+func forFile(items []diagnostic.Diagnostic, path string) []diagnostic.Diagnostic {
+	var kept []diagnostic.Diagnostic
+	for _, d := range items {
+		if d.File == "" || d.File == path {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+func (doc *document) addDiagnostics(items []diagnostic.Diagnostic, source string) {
+	for _, d := range items {
+		severity := severityError
+		switch d.Severity {
+		case diagnostic.Warning:
+			severity = severityWarning
+		case diagnostic.Info:
+			severity = severityInformation
+		}
+		message := d.Message
+		if d.Hint != "" {
+			message += "\nhint: " + d.Hint
+		}
+		doc.diagnostics = append(doc.diagnostics, Diagnostic{
+			Range:    doc.wordRange(d.Line, d.Column),
+			Severity: severity,
+			Source:   "intentc " + source,
+			Message:  message,
+		})
+	}
+}
+
+// addError reports a project-level problem (missing import, cycle) at the
+// top of the file.
+func (doc *document) addError(message string) {
+	doc.diagnostics = append(doc.diagnostics, Diagnostic{
+		Range:    doc.wordRange(1, 1),
+		Severity: severityError,
+		Source:   "intentc",
+		Message:  message,
+	})
+}
+
+// --- positions ---
+//
+// The lexer reports 1-based lines and 1-based byte columns; LSP uses 0-based
+// lines and UTF-16 character offsets.
+
+// lineOf returns the text of a 1-based line, or "" when out of range.
+func lineOf(text string, line int) string {
+	lines := strings.Split(text, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSuffix(lines[line-1], "\r")
+}
+
+// position converts a 1-based line and byte column to an LSP position.
+func position(text string, line, col int) Position {
+	if line < 1 {
+		return Position{}
+	}
+	src := lineOf(text, line)
+	col--
+	if col < 0 {
+		col = 0
+	}
+	if col > len(src) {
+		col = len(src)
+	}
+	return Position{Line: line - 1, Character: utf16Len(src[:col])}
+}
+
+// wordRange returns the range of the identifier starting at a 1-based line
+// and byte column, or a one-character range when there is none.
+func (doc *document) wordRange(line, col int) Range {
+	start := position(doc.text, line, col)
+	src := lineOf(doc.text, line)
+	end := col - 1
+	if end < 0 {
+		end = 0
+	}
+	for end < len(src) && isIdentByte(src[end]) {
+		end++
+	}
+	endPos := position(doc.text, line, end+1)
+	if endPos == start {
+		endPos.Character++
+	}
+	return Range{Start: start, End: endPos}
+}
+
+// wordAt returns the identifier under an LSP position and its 1-based line
+// and byte column, or ok=false when the position is not on an identifier.
+func (doc *document) wordAt(pos Position) (word string, line, col int, ok bool) {
+	src := lineOf(doc.text, pos.Line+1)
+	offset := byteOffset(src, pos.Character)
+	start, end := offset, offset
+	for start > 0 && isIdentByte(src[start-1]) {
+		start--
+	}
+	for end < len(src) && isIdentByte(src[end]) {
+		end++
+	}
+	if start == end {
+		return "", 0, 0, false
+	}
+	return src[start:end], pos.Line + 1, start + 1, true
+}
+
+// byteOffset converts a UTF-16 offset within a line to a byte offset.
+func byteOffset(src string, character int) int {
+	units := 0
+	for i, r := range src {
+		if units >= character {
+			return i
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len(src)
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		n += len(utf16.Encode([]rune{r}))
+		s = s[size:]
+	}
+	return n
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// uriToPath converts a file:// URI to a file path.
+func uriToPath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return filepath.FromSlash(u.Path), true
+}
+
+// pathToURI converts a file path to a file:// URI.
+func pathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
@@ -0,0 +1,453 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// session runs a server over a scripted list of messages and returns
+// everything it wrote, decoded.
+func session(t *testing.T, messages ...any) []map[string]any {
+	t.Helper()
+	var in bytes.Buffer
+	for _, msg := range messages {
+		body, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	var out bytes.Buffer
+	if err := NewServer(&in, &out, "test").Serve(); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+
+	var replies []map[string]any
+	r := bufio.NewReader(&out)
+	for {
+		var length int
+		if _, err := fmt.Fscanf(r, "Content-Length: %d\r\n\r\n", &length); err != nil {
+			break
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			t.Fatal(err)
+		}
+		var msg map[string]any
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, msg)
+	}
+	return replies
+}
+
+func call(id int, method string, params any) map[string]any {
+	return map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+}
+
+func notify(method string, params any) map[string]any {
+	return map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+}
+
+func open(uri, text string) map[string]any {
+	return notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "intent", "version": 1, "text": text},
+	})
+}
+
+func at(id int, method, uri string, line, character int) map[string]any {
+	return call(id, method, map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	})
+}
+
+// result returns the result of the reply to request id.
+func result(t *testing.T, replies []map[string]any, id int) any {
+	t.Helper()
+	for _, msg := range replies {
+		if msgID, ok := msg["id"].(float64); ok && int(msgID) == id {
+			if e, ok := msg["error"]; ok {
+				t.Fatalf("request %d failed: %v", id, e)
+			}
+			return msg["result"]
+		}
+	}
+	t.Fatalf("no reply to request %d", id)
+	return nil
+}
+
+// diagnostics returns the last diagnostics published for uri.
+func diagnostics(replies []map[string]any, uri string) []any {
+	var diags []any
+	for _, msg := range replies {
+		if msg["method"] != "textDocument/publishDiagnostics" {
+			continue
+		}
+		params := msg["params"].(map[string]any)
+		if params["uri"] == uri {
+			diags = params["diagnostics"].([]any)
+		}
+	}
+	return diags
+}
+
+// errorsIn keeps the error-severity diagnostics.
+func errorsIn(diags []any) []any {
+	var errs []any
+	for _, d := range diags {
+		if d.(map[string]any)["severity"] == float64(severityError) {
+			errs = append(errs, d)
+		}
+	}
+	return errs
+}
+
+func rangeStart(t *testing.T, loc any) (float64, float64) {
+	t.Helper()
+	m, ok := loc.(map[string]any)
+	if !ok {
+		t.Fatalf("expected a location, got %v", loc)
+	}
+	start := m["range"].(map[string]any)["start"].(map[string]any)
+	return start["line"].(float64), start["character"].(float64)
+}
+
+const uri = "file:///tmp/test.intent"
+
+const source = `module test version "1.0.0";
+
+enum Color {
+    Red,
+    Green,
+}
+
+entity Counter {
+    field count: Int;
+
+    invariant self.count >= 0;
+
+    constructor(start: Int)
+        requires start >= 0
+    {
+        self.count = start;
+    }
+
+    method increment() returns Void
+        ensures self.count == old(self.count) + 1
+    {
+        self.count = self.count + 1;
+    }
+}
+
+function double(x: Int) returns Int
+    requires x >= 0
+    ensures result == x * 2
+{
+    return x * 2;
+}
+
+entry function main() returns Int
+    ensures result >= 0
+{
+    let c: Counter = Counter(1);
+    c.increment();
+    let n: Int = double(c.count);
+    let color: Color = Red;
+    return n;
+}
+
+`
+
+func TestInitialize(t *testing.T) {
+	replies := session(t,
+		call(1, "initialize", map[string]any{}),
+		call(2, "shutdown", nil),
+		notify("exit", nil),
+	)
+	caps := result(t, replies, 1).(map[string]any)["capabilities"].(map[string]any)
+	for _, name := range []string{"definitionProvider", "hoverProvider", "documentFormattingProvider"} {
+		if caps[name] != true {
+			t.Errorf("expected %s, got %v", name, caps[name])
+		}
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	var in bytes.Buffer
+	fmt.Fprintf(&in, "Content-Length: 33\r\n\r\n{\"jsonrpc\":\"2.0\",\"method\":\"exit\"}")
+	if err := NewServer(&in, io.Discard, "test").Serve(); err != ErrNoShutdown {
+		t.Errorf("expected ErrNoShutdown, got %v", err)
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	replies := session(t, call(1, "workspace/symbol", map[string]any{}))
+	if len(replies) != 1 || replies[0]["error"] == nil {
+		t.Errorf("expected an error reply, got %v", replies)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+		line   float64
+	}{
+		{"parser", "module test version \"1.0.0\";\nfunction f( returns Int { return 1; }\n", "expected", 1},
+		{"checker", "module test version \"1.0.0\";\nfunction f() returns Int {\n    return y;\n}\n", "undeclared", 2},
+		{"linter", "module test version \"1.0.0\";\nfunction f() returns Void {\n}\n", "empty", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d map[string]any
+			for _, diag := range diagnostics(session(t, open(uri, tt.source)), uri) {
+				if m := diag.(map[string]any); m["source"] == "intentc "+tt.name {
+					d = m
+					break
+				}
+			}
+			if d == nil {
+				t.Fatalf("expected a %s diagnostic", tt.name)
+			}
+			if !strings.Contains(strings.ToLower(d["message"].(string)), tt.want) {
+				t.Errorf("expected message containing %q, got %q", tt.want, d["message"])
+			}
+			if line, _ := rangeStart(t, d); line != tt.line {
+				t.Errorf("expected line %v, got %v", tt.line, line)
+			}
+		})
+	}
+}
+
+func TestDiagnosticsClearedOnFix(t *testing.T) {
+	replies := session(t,
+		open(uri, "module test version \"1.0.0\";\nfunction f() returns Int ensures result == 1 { return y; }\n"),
+		notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri},
+			"contentChanges": []any{map[string]any{"text": "module test version \"1.0.0\";\nfunction f() returns Int ensures result == 1 { return 1; }\n"}},
+		}),
+	)
+	if diags := diagnostics(replies, uri); len(diags) != 0 {
+		t.Errorf("expected no diagnostics after the fix, got %v", diags)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	tests := []struct {
+		name      string
+		line, col int     // cursor
+		wantLine  float64 // declaration name
+		wantChar  float64
+	}{
+		{"function", 37, 18, 25, 9},    // double(c.count)
+		{"entity", 35, 22, 7, 7},       // Counter(1)
+		{"method", 36, 7, 18, 11},      // c.increment()
+		{"field", 37, 26, 8, 10},       // c.count
+		{"self field", 21, 13, 8, 10},  // self.count
+		{"enum variant", 38, 23, 3, 4}, // Red
+		{"type", 35, 11, 7, 7},         // c: Counter
+	}
+	messages := []any{open(uri, source)}
+	for i, tt := range tests {
+		messages = append(messages, at(i+1, "textDocument/definition", uri, tt.line, tt.col))
+	}
+	replies := session(t, messages...)
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := result(t, replies, i+1)
+			line, char := rangeStart(t, loc)
+			if line != tt.wantLine || char != tt.wantChar {
+				t.Errorf("expected %v:%v, got %v:%v", tt.wantLine, tt.wantChar, line, char)
+			}
+		})
+	}
+}
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		name      string
+		line, col int
+		want      []string
+	}{
+		{"function", 37, 18, []string{"function double(x: Int) returns Int", "requires x >= 0", "ensures result == x * 2"}},
+		{"constructor", 35, 22, []string{"Counter(start: Int)", "requires start >= 0"}},
+		{"method", 36, 7, []string{"method Counter.increment() returns Void", "ensures self.count == old(self.count) + 1"}},
+		{"field", 37, 26, []string{"field Counter.count: Int"}},
+		{"entity", 35, 11, []string{"entity Counter", "invariant self.count >= 0"}},
+		{"variable", 39, 11, []string{"n: Int"}},
+	}
+	messages := []any{open(uri, source)}
+	for i, tt := range tests {
+		messages = append(messages, at(i+1, "textDocument/hover", uri, tt.line, tt.col))
+	}
+	replies := session(t, messages...)
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, ok := result(t, replies, i+1).(map[string]any)
+			if !ok {
+				t.Fatal("expected a hover")
+			}
+			value := h["contents"].(map[string]any)["value"].(string)
+			for _, want := range tt.want {
+				if !strings.Contains(value, want) {
+					t.Errorf("expected hover containing %q, got:\n%s", want, value)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	messy := "module test version \"1.0.0\";\nfunction f()   returns Int {\nreturn 1;\n}\n"
+	replies := session(t,
+		open(uri, messy),
+		call(1, "textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}}),
+	)
+	edits := result(t, replies, 1).([]any)
+	if len(edits) != 1 {
+		t.Fatalf("expected one edit, got %v", edits)
+	}
+	text := edits[0].(map[string]any)["newText"].(string)
+	if !strings.Contains(text, "function f() returns Int {\n    return 1;\n}") {
+		t.Errorf("unexpected formatted text:\n%s", text)
+	}
+}
+
+func TestFormattingAlreadyFormatted(t *testing.T) {
+	replies := session(t,
+		open(uri, source),
+		call(1, "textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}}),
+	)
+	if edits := result(t, replies, 1).([]any); len(edits) != 0 {
+		t.Errorf("expected no edits, got %v", edits)
+	}
+}
+
+func TestMultiFileDefinition(t *testing.T) {
+	dir := t.TempDir()
+	math := "module math version \"0.1.0\";\n\npublic function add(a: Int, b: Int) returns Int\n    ensures result == a + b\n{\n    return a + b;\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "math.intent"), []byte(math), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mainPath := filepath.Join(dir, "main.intent")
+	mainSrc := "module main version \"0.1.0\";\n\nimport \"math.intent\";\n\nentry function main() returns Int {\n    let sum: Int = math.add(3, 4);\n    return sum;\n}\n"
+	if err := os.WriteFile(mainPath, []byte(mainSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mainURI := pathToURI(mainPath)
+
+	replies := session(t,
+		open(mainURI, mainSrc),
+		at(1, "textDocument/definition", mainURI, 5, 24), // add
+		at(2, "textDocument/definition", mainURI, 5, 19), // math
+		at(3, "textDocument/definition", mainURI, 2, 9),  // import "math.intent"
+		at(4, "textDocument/hover", mainURI, 5, 24),
+	)
+	if errs := errorsIn(diagnostics(replies, mainURI)); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	mathURI := pathToURI(filepath.Join(dir, "math.intent"))
+
+	loc := result(t, replies, 1).(map[string]any)
+	if loc["uri"] != mathURI {
+		t.Errorf("expected %s, got %v", mathURI, loc["uri"])
+	}
+	if line, char := rangeStart(t, loc); line != 2 || char != 16 {
+		t.Errorf("expected 2:16, got %v:%v", line, char)
+	}
+	for _, id := range []int{2, 3} {
+		if loc := result(t, replies, id).(map[string]any); loc["uri"] != mathURI {
+			t.Errorf("request %d: expected %s, got %v", id, mathURI, loc["uri"])
+		}
+	}
+	value := result(t, replies, 4).(map[string]any)["contents"].(map[string]any)["value"].(string)
+	if !strings.Contains(value, "ensures result == a + b") {
+		t.Errorf("expected hover with ensures, got:\n%s", value)
+	}
+}
+
+func TestMultiFileUsesOpenBuffers(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "main.intent")
+	mathPath := filepath.Join(dir, "math.intent")
+	mainSrc := "module main version \"0.1.0\";\n\nimport \"math.intent\";\n\nentry function main() returns Int {\n    return math.add(3, 4);\n}\n"
+	if err := os.WriteFile(mainPath, []byte(mainSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// math.intent exists only as an unsaved buffer
+	replies := session(t,
+		open(pathToURI(mathPath), "module math version \"0.1.0\";\n\npublic function add(a: Int, b: Int) returns Int {\n    return a + b;\n}\n"),
+		open(pathToURI(mainPath), mainSrc),
+	)
+	if errs := errorsIn(diagnostics(replies, pathToURI(mainPath))); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
+
+const traitSource = `module test version "1.0.0";
+
+trait Shape {
+    method area() returns Int
+        ensures result >= 0;
+}
+
+entity Square implements Shape {
+    field side: Int;
+
+    method area() returns Int {
+        return self.side * self.side;
+    }
+}
+
+function measure(s: Shape) returns Int {
+    return s.area();
+}
+`
+
+func TestTraitDefinitionAndHover(t *testing.T) {
+	replies := session(t,
+		open(uri, traitSource),
+		at(1, "textDocument/definition", uri, 15, 20), // s: Shape
+		at(2, "textDocument/definition", uri, 16, 14), // s.area()
+		at(3, "textDocument/hover", uri, 15, 20),
+		at(4, "textDocument/hover", uri, 16, 14),
+		at(5, "textDocument/hover", uri, 7, 8), // entity Square
+	)
+
+	if line, char := rangeStart(t, result(t, replies, 1)); line != 2 || char != 6 {
+		t.Errorf("expected trait Shape at 2:6, got %v:%v", line, char)
+	}
+	if line, char := rangeStart(t, result(t, replies, 2)); line != 3 || char != 11 {
+		t.Errorf("expected method Shape.area at 3:11, got %v:%v", line, char)
+	}
+
+	hovers := map[int][]string{
+		3: {"trait Shape", "method area() returns Int"},
+		4: {"method Shape.area() returns Int", "ensures result >= 0"},
+		5: {"entity Square implements Shape"},
+	}
+	for id, wants := range hovers {
+		h, ok := result(t, replies, id).(map[string]any)
+		if !ok {
+			t.Errorf("expected a hover for request %d", id)
+			continue
+		}
+		value := h["contents"].(map[string]any)["value"].(string)
+		for _, want := range wants {
+			if !strings.Contains(value, want) {
+				t.Errorf("expected hover containing %q, got:\n%s", want, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// Package lsp implements a Language Server Protocol server for Intent over
+// stdio. It publishes parser, checker and linter diagnostics and provides
+// go-to-definition, hover and document formatting.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/lhaig/intent/internal/formatter"
+	"github.com/lhaig/intent/internal/parser"
+)
+
+// Server holds the open documents of one client session.
+type Server struct {
+	in       *bufio.Reader
+	out      io.Writer
+	version  string
+	docs     map[string]*document // URI -> analyzed document
+	shutdown bool
+}
+
+// NewServer creates a server that reads requests from in and writes
+// responses and notifications to out.
+func NewServer(in io.Reader, out io.Writer, version string) *Server {
+	return &Server{
+		in:      bufio.NewReader(in),
+		out:     out,
+		version: version,
+		docs:    make(map[string]*document),
+	}
+}
+
+// ErrNoShutdown is returned by Serve when the client sent exit without
+// shutdown first (the process should exit with status 1).
+var ErrNoShutdown = errors.New("exit received before shutdown")
+
+// Serve processes messages until the client sends exit or closes the input.
+func (s *Server) Serve() error {
+	for {
+		body, err := s.readMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.replyError(nil, codeParseError, err.Error())
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return ErrNoShutdown
+			}
+			return nil
+		}
+		s.handle(&req)
+	}
+}
+
+// readMessage reads one message framed by a Content-Length header.
+func (s *Server) readMessage() ([]byte, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length header: %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// write sends one message framed by a Content-Length header.
+func (s *Server) write(msg any) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(body))
+	s.out.Write(body)
+}
+
+func (s *Server) reply(id *json.RawMessage, result any) {
+	s.write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, message string) {
+	s.write(errorResponse{JSONRPC: "2.0", ID: id, Error: responseError{Code: code, Message: message}})
+}
+
+func (s *Server) notify(method string, params any) {
+	s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handle dispatches a request or notification. Unknown notifications are
+// ignored; unknown requests get a MethodNotFound error.
+func (s *Server) handle(req *request) {
+	switch req.Method {
+	case "initialize":
+		s.reply(req.ID, initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:           textDocumentSyncOptions{OpenClose: true, Change: textDocumentSyncFull, Save: true},
+				DefinitionProvider:         true,
+				HoverProvider:              true,
+				DocumentFormattingProvider: true,
+			},
+			ServerInfo: serverInfo{Name: "intentc", Version: s.version},
+		})
+	case "initialized", "$/cancelRequest", "$/setTrace":
+	case "shutdown":
+		s.shutdown = true
+		s.reply(req.ID, nil)
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if s.decode(req, &params) {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if s.decode(req, &params) && len(params.ContentChanges) > 0 {
+			// Full sync: the last change holds the whole document
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didSave":
+		var params didSaveParams
+		if s.decode(req, &params) {
+			if params.Text != nil {
+				s.update(params.TextDocument.URI, *params.Text)
+			} else if doc := s.docs[params.TextDocument.URI]; doc != nil {
+				s.update(doc.uri, doc.text)
+			}
+		}
+	case "textDocument/didClose":
+		var params didCloseParams
+		if s.decode(req, &params) {
+			delete(s.docs, params.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		}
+
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if s.decode(req, &params) {
+			if doc := s.docs[params.TextDocument.URI]; doc != nil {
+				if loc := doc.definition(params.Position); loc != nil {
+					s.reply(req.ID, loc)
+					return
+				}
+			}
+			s.reply(req.ID, nil)
+		}
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if s.decode(req, &params) {
+			if doc := s.docs[params.TextDocument.URI]; doc != nil {
+				if h := doc.hover(params.Position); h != nil {
+					s.reply(req.ID, h)
+					return
+				}
+			}
+			s.reply(req.ID, nil)
+		}
+	case "textDocument/formatting":
+		var params documentFormattingParams
+		if s.decode(req, &params) {
+			s.reply(req.ID, s.format(params.TextDocument.URI))
+		}
+
+	default:
+		if req.ID != nil {
+			s.replyError(req.ID, codeMethodNotFound, "method not supported: "+req.Method)
+		}
+	}
+}
+
+// decode unmarshals request params, replying with an error on failure.
+func (s *Server) decode(req *request, params any) bool {
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		if req.ID != nil {
+			s.replyError(req.ID, codeInvalidParams, err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+// update re-analyzes a document and publishes its diagnostics.
+func (s *Server) update(uri, text string) {
+	doc := analyze(uri, text, s.openSources())
+	s.docs[uri] = doc
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: doc.diagnostics})
+}
+
+// openSources returns the text of every open document by file path, so
+// imports resolve against unsaved buffers.
+func (s *Server) openSources() map[string]string {
+	sources := make(map[string]string)
+	for uri, doc := range s.docs {
+		if path, ok := uriToPath(uri); ok {
+			sources[path] = doc.text
+		}
+	}
+	return sources
+}
+
+// format returns a single edit replacing the document with its formatted
+// text, or no edits when it does not parse or is already formatted.
+func (s *Server) format(uri string) []TextEdit {
+	doc := s.docs[uri]
+	if doc == nil {
+		return []TextEdit{}
+	}
+	p := parser.New(doc.text)
+	prog := p.Parse()
+	if p.Diagnostics().HasErrors() {
+		return []TextEdit{}
+	}
+	formatted := formatter.Format(prog)
+	if formatted == doc.text {
+		return []TextEdit{}
+	}
+	lines := strings.Split(doc.text, "\n")
+	end := Position{Line: len(lines) - 1, Character: utf16Len(lines[len(lines)-1])}
+	return []TextEdit{{Range: Range{End: end}, NewText: formatted}}
+}
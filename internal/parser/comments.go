@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/lhaig/intent/internal/ast"
+	"github.com/lhaig/intent/internal/lexer"
+)
+
+// Comments arrive from the lexer as Leading trivia on the token after them.
+// A comment that ends the line of the previous token trails the node that
+// ended there; every other comment leads the next node that claims it, so a
+// comment in the middle of a line stays with the token after it. Comments in
+// front of an opening brace stay on the brace's line. Inside an expression,
+// comments lead the operand, argument or element that follows them. Comments
+// in places that hold none (intent bodies) move to the next node, so the
+// formatter never drops them.
+
+// leadingComments claims the unclaimed comments up to the current token.
+func (p *Parser) leadingComments() []string {
+	var texts []string
+	end := p.pos
+	if end >= len(p.tokens) {
+		end = len(p.tokens) - 1
+	}
+	for ; p.commentPos <= end; p.commentPos++ {
+		for _, c := range p.tokens[p.commentPos].Leading {
+			texts = append(texts, c.Text)
+		}
+	}
+	return texts
+}
+
+// trailingComment claims the comments on the same line as the token just
+// consumed, joined with a space, or returns "" when there are none. A comment
+// that the current token follows on the same line is left to lead it.
+func (p *Parser) trailingComment() string {
+	if p.pos == 0 || p.pos >= len(p.tokens) || p.commentPos > p.pos {
+		return ""
+	}
+	line := p.tokens[p.pos-1].Line
+	tok := &p.tokens[p.pos]
+	var texts []string
+	for len(tok.Leading) > 0 && tok.Leading[0].Line == line && !endsOnLine(tok.Leading[0], tok.Line) {
+		texts = append(texts, tok.Leading[0].Text)
+		tok.Leading = tok.Leading[1:]
+	}
+	return strings.Join(texts, " ")
+}
+
+// braceComments claims the one-line comments in front of the opening brace
+// at the current token, so that they stay on the brace's line.
+func (p *Parser) braceComments() []string {
+	if p.pos >= len(p.tokens) || p.commentPos > p.pos {
+		return nil
+	}
+	tok := &p.tokens[p.pos]
+	var texts []string
+	for len(tok.Leading) > 0 && !strings.Contains(tok.Leading[0].Text, "\n") {
+		texts = append(texts, tok.Leading[0].Text)
+		tok.Leading = tok.Leading[1:]
+	}
+	return texts
+}
+
+// endsOnLine reports whether comment c ends on the given line.
+func endsOnLine(c lexer.Comment, line int) bool {
+	return c.Line+strings.Count(c.Text, "\n") == line
+}
+
+// attachComments sets the leading comments of a node and claims its trailing comment.
+func (p *Parser) attachComments(c *ast.Comments, leading []string) {
+	c.Leading = leading
+	c.Trailing = p.trailingComment()
+}
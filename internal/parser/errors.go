@@ -10,6 +10,7 @@ var syncTokens = map[lexer.TokenType]bool{
 	lexer.FUNCTION:    true,
 	lexer.ENTRY:       true,
 	lexer.ENTITY:      true,
+	lexer.TRAIT:       true,
 	lexer.INTENT:      true,
 	lexer.LET:         true,
 	lexer.RETURN:      true,
@@ -25,10 +26,11 @@ var syncTokens = map[lexer.TokenType]bool{
 
 // Parser holds the parser state
 type Parser struct {
-	tokens []lexer.Token
-	pos    int
-	diags  *diagnostic.Diagnostics
-	source string // raw source for extracting contract text
+	tokens     []lexer.Token
+	pos        int
+	commentPos int // first token whose leading comments are unclaimed
+	diags      *diagnostic.Diagnostics
+	source     string // raw source for extracting contract text
 }
 
 // current returns the current token
@@ -56,6 +58,14 @@ func (p *Parser) advance() lexer.Token {
 	return tok
 }
 
+// previousEnd returns the position just past the last consumed token
+func (p *Parser) previousEnd() (int, int) {
+	if p.pos == 0 || p.pos > len(p.tokens) {
+		return 0, 0
+	}
+	return p.tokens[p.pos-1].End()
+}
+
 // expect consumes the current token if it matches the expected type,
 // otherwise reports an error
 func (p *Parser) expect(tt lexer.TokenType) lexer.Token {
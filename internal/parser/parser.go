@@ -28,15 +28,22 @@ func (p *Parser) Diagnostics() *diagnostic.Diagnostics {
 // Parse parses the token stream into a Program AST
 func (p *Parser) Parse() *ast.Program {
 	prog := &ast.Program{}
+	leading := p.leadingComments()
 	prog.Module = p.parseModuleDecl()
+	p.attachComments(&prog.Module.Comments, leading)
 
 	// Parse import declarations
 	for p.check(lexer.IMPORT) {
-		prog.Imports = append(prog.Imports, p.parseImportDecl())
+		leading := p.leadingComments()
+		imp := p.parseImportDecl()
+		p.attachComments(&imp.Comments, leading)
+		prog.Imports = append(prog.Imports, imp)
 	}
 
 	// Parse top-level declarations
 	for !p.check(lexer.EOF) {
+		leading := p.leadingComments()
+
 		// Check for public keyword
 		isPublic := false
 		if p.check(lexer.PUBLIC) {
@@ -48,29 +55,40 @@ func (p *Parser) Parse() *ast.Program {
 		case lexer.ENTRY:
 			fn := p.parseFunctionDecl()
 			fn.IsPublic = isPublic
+			p.attachComments(&fn.Comments, leading)
 			prog.Functions = append(prog.Functions, fn)
 		case lexer.FUNCTION:
 			fn := p.parseFunctionDecl()
 			fn.IsPublic = isPublic
+			p.attachComments(&fn.Comments, leading)
 			prog.Functions = append(prog.Functions, fn)
 		case lexer.ENTITY:
 			ent := p.parseEntityDecl()
 			ent.IsPublic = isPublic
+			p.attachComments(&ent.Comments, leading)
 			prog.Entities = append(prog.Entities, ent)
 		case lexer.ENUM:
 			enum := p.parseEnumDecl()
 			enum.IsPublic = isPublic
+			p.attachComments(&enum.Comments, leading)
 			prog.Enums = append(prog.Enums, enum)
+		case lexer.TRAIT:
+			trait := p.parseTraitDecl()
+			trait.IsPublic = isPublic
+			p.attachComments(&trait.Comments, leading)
+			prog.Traits = append(prog.Traits, trait)
 		case lexer.INTENT:
 			if isPublic {
 				p.diags.Errorf(p.current().Line, p.current().Column,
 					"'public' cannot be applied to intent declarations")
 			}
-			prog.Intents = append(prog.Intents, p.parseIntentDecl())
+			intent := p.parseIntentDecl()
+			p.attachComments(&intent.Comments, leading)
+			prog.Intents = append(prog.Intents, intent)
 		default:
 			if isPublic {
 				p.diags.Errorf(p.current().Line, p.current().Column,
-					"expected function, entity, or enum after 'public'")
+					"expected function, entity, enum, or trait after 'public'")
 			} else {
 				p.diags.Errorf(p.current().Line, p.current().Column,
 					"unexpected token %s at top level", p.current().Type)
@@ -82,6 +100,7 @@ func (p *Parser) Parse() *ast.Program {
 			}
 		}
 	}
+	prog.EndComments = p.leadingComments()
 	return prog
 }
 
@@ -127,7 +146,7 @@ func (p *Parser) parseImportDecl() *ast.ImportDecl {
 	}
 }
 
-// parseFunctionDecl parses: [entry] function <name>(<params>) returns <type> [requires ...] [ensures ...] { ... }
+// parseFunctionDecl parses: [entry] function <name>[<type params>](<params>) returns <type> [requires ...] [ensures ...] { ... }
 func (p *Parser) parseFunctionDecl() *ast.FunctionDecl {
 	isEntry := false
 	tok := p.current()
@@ -138,6 +157,7 @@ func (p *Parser) parseFunctionDecl() *ast.FunctionDecl {
 
 	p.expect(lexer.FUNCTION)
 	name := p.expect(lexer.IDENT)
+	typeParams := p.parseTypeParams()
 	p.expect(lexer.LPAREN)
 	params := p.parseParamList()
 	p.expect(lexer.RPAREN)
@@ -150,6 +170,7 @@ func (p *Parser) parseFunctionDecl() *ast.FunctionDecl {
 	return &ast.FunctionDecl{
 		Name:       name.Literal,
 		IsEntry:    isEntry,
+		TypeParams: typeParams,
 		Params:     params,
 		ReturnType: retType,
 		Requires:   requires,
@@ -160,34 +181,63 @@ func (p *Parser) parseFunctionDecl() *ast.FunctionDecl {
 	}
 }
 
-// parseEntityDecl parses: entity <name> { ... }
+// parseEntityDecl parses: entity <name>[<type params>] [implements <trait>, ...] { ... }
 func (p *Parser) parseEntityDecl() *ast.EntityDecl {
 	tok := p.expect(lexer.ENTITY)
 	name := p.expect(lexer.IDENT)
+	typeParams := p.parseTypeParams()
+	var implements []*ast.TypeRef
+	if p.match(lexer.IMPLEMENTS) {
+		for {
+			trait := p.expect(lexer.IDENT)
+			implements = append(implements, &ast.TypeRef{Name: trait.Literal, Line: trait.Line, Column: trait.Column})
+			if !p.match(lexer.COMMA) {
+				break
+			}
+		}
+	}
 	p.expect(lexer.LBRACE)
 
 	entity := &ast.EntityDecl{
-		Name:   name.Literal,
-		Line:   tok.Line,
-		Column: tok.Column,
+		Name:         name.Literal,
+		TypeParams:   typeParams,
+		Implements:   implements,
+		BraceComment: p.trailingComment(),
+		Line:         tok.Line,
+		Column:       tok.Column,
 	}
 
 	for !p.check(lexer.RBRACE) && !p.check(lexer.EOF) {
+		leading := p.leadingComments()
 		switch p.current().Type {
 		case lexer.FIELD:
-			entity.Fields = append(entity.Fields, p.parseFieldDecl())
-		case lexer.INVARIANT:
-			entity.Invariants = append(entity.Invariants, p.parseInvariantDecl())
+			field := p.parseFieldDecl()
+			p.attachComments(&field.Comments, leading)
+			entity.Fields = append(entity.Fields, field)
+		case lexer.INVARIANT, lexer.AT:
+			if !p.check(lexer.INVARIANT) && !p.annotates(lexer.INVARIANT) {
+				p.diags.Errorf(p.current().Line, p.current().Column,
+					"annotations apply only to requires, ensures and invariant clauses")
+				p.parseAnnotations()
+				continue
+			}
+			inv := p.parseInvariantDecl()
+			p.attachComments(&inv.Comments, leading)
+			entity.Invariants = append(entity.Invariants, inv)
 		case lexer.CONSTRUCTOR:
 			entity.Constructor = p.parseConstructorDecl()
+			p.attachComments(&entity.Constructor.Comments, leading)
 		case lexer.METHOD:
-			entity.Methods = append(entity.Methods, p.parseMethodDecl())
+			method := p.parseMethodDecl()
+			p.attachComments(&method.Comments, leading)
+			entity.Methods = append(entity.Methods, method)
 		default:
 			p.diags.Errorf(p.current().Line, p.current().Column,
 				"unexpected token %s in entity body", p.current().Type)
 			p.synchronize()
 		}
 	}
+	entity.EndComments = p.leadingComments()
 	p.expect(lexer.RBRACE)
 	return entity
 }
@@ -208,19 +258,24 @@ func (p *Parser) parseFieldDecl() *ast.FieldDecl {
 	}
 }
 
-// parseInvariantDecl parses: invariant <expr>;
+// parseInvariantDecl parses: [@always_check] invariant <expr>;
 func (p *Parser) parseInvariantDecl() *ast.InvariantDecl {
+	alwaysCheck := p.parseAnnotations()
 	tok := p.expect(lexer.INVARIANT)
 	startPos := p.pos
 	expr := p.parseExpression()
 	rawText := p.extractRawText(startPos)
+	endLine, endCol := p.previousEnd()
 	p.expect(lexer.SEMICOLON)
 
 	return &ast.InvariantDecl{
-		Expr:    expr,
-		RawText: rawText,
-		Line:    tok.Line,
-		Column:  tok.Column,
+		Expr:        expr,
+		RawText:     rawText,
+		AlwaysCheck: alwaysCheck,
+		Line:        tok.Line,
+		Column:      tok.Column,
+		EndLine:     endLine,
+		EndColumn:   endCol,
 	}
 }
 
@@ -246,6 +301,13 @@ func (p *Parser) parseConstructorDecl() *ast.ConstructorDecl {
 
 // parseMethodDecl parses: method <name>(<params>) returns <type> [requires ...] [ensures ...] { ... }
 func (p *Parser) parseMethodDecl() *ast.MethodDecl {
+	method := p.parseMethodSignature()
+	method.Body = p.parseBlock()
+	return method
+}
+
+// parseMethodSignature parses a method up to its body: method <name>(<params>) returns <type> [requires ...] [ensures ...]
+func (p *Parser) parseMethodSignature() *ast.MethodDecl {
 	tok := p.expect(lexer.METHOD)
 	name := p.expect(lexer.IDENT)
 	p.expect(lexer.LPAREN)
@@ -255,7 +317,6 @@ func (p *Parser) parseMethodDecl() *ast.MethodDecl {
 	retType := p.parseTypeRef()
 	requires := p.parseContractClauses(lexer.REQUIRES)
 	ensures := p.parseContractClauses(lexer.ENSURES)
-	body := p.parseBlock()
 
 	return &ast.MethodDecl{
 		Name:       name.Literal,
@@ -263,25 +324,63 @@ func (p *Parser) parseMethodDecl() *ast.MethodDecl {
 		ReturnType: retType,
 		Requires:   requires,
 		Ensures:    ensures,
-		Body:       body,
 		Line:       tok.Line,
 		Column:     tok.Column,
 	}
 }
 
-// parseEnumDecl parses: enum <name> { Variant1, Variant2(field: Type), ... }
+// parseTraitDecl parses: trait <name> { method <name>(<params>) returns <type> [requires ...] [ensures ...]; ... }
+func (p *Parser) parseTraitDecl() *ast.TraitDecl {
+	tok := p.expect(lexer.TRAIT)
+	name := p.expect(lexer.IDENT)
+	p.expect(lexer.LBRACE)
+
+	trait := &ast.TraitDecl{
+		Name:         name.Literal,
+		BraceComment: p.trailingComment(),
+		Line:         tok.Line,
+		Column:       tok.Column,
+	}
+
+	for !p.check(lexer.RBRACE) && !p.check(lexer.EOF) {
+		leading := p.leadingComments()
+		if !p.check(lexer.METHOD) {
+			p.diags.Errorf(p.current().Line, p.current().Column,
+				"unexpected token %s in trait body", p.current().Type)
+			startPos := p.pos
+			p.synchronize()
+			if p.pos == startPos {
+				p.advance()
+			}
+			continue
+		}
+		method := p.parseMethodSignature()
+		p.expect(lexer.SEMICOLON)
+		p.attachComments(&method.Comments, leading)
+		trait.Methods = append(trait.Methods, method)
+	}
+	trait.EndComments = p.leadingComments()
+	p.expect(lexer.RBRACE)
+	return trait
+}
+
+// parseEnumDecl parses: enum <name>[<type params>] { Variant1, Variant2(field: Type), ... }
 func (p *Parser) parseEnumDecl() *ast.EnumDecl {
 	tok := p.expect(lexer.ENUM)
 	name := p.expect(lexer.IDENT)
+	typeParams := p.parseTypeParams()
 	p.expect(lexer.LBRACE)
 
 	enum := &ast.EnumDecl{
-		Name:   name.Literal,
-		Line:   tok.Line,
-		Column: tok.Column,
+		Name:         name.Literal,
+		TypeParams:   typeParams,
+		BraceComment: p.trailingComment(),
+		Line:         tok.Line,
+		Column:       tok.Column,
 	}
 
 	for !p.check(lexer.RBRACE) && !p.check(lexer.EOF) {
+		leading := p.leadingComments()
 		variantTok := p.expect(lexer.IDENT)
 		variant := &ast.EnumVariant{
 			Name:   variantTok.Literal,
@@ -301,8 +400,10 @@ func (p *Parser) parseEnumDecl() *ast.EnumDecl {
 		if !p.check(lexer.RBRACE) {
 			p.expect(lexer.COMMA)
 		}
+		p.attachComments(&variant.Comments, leading)
 	}
 
+	enum.EndComments = p.leadingComments()
 	p.expect(lexer.RBRACE)
 	return enum
 }
@@ -342,9 +443,10 @@ func (p *Parser) parseIntentDecl() *ast.IntentDecl {
 	p.expect(lexer.LBRACE)
 
 	intent := &ast.IntentDecl{
-		Description: stripQuotes(desc.Literal),
-		Line:        tok.Line,
-		Column:      tok.Column,
+		Description:  stripQuotes(desc.Literal),
+		BraceComment: p.trailingComment(),
+		Line:         tok.Line,
+		Column:       tok.Column,
 	}
 
 	for !p.check(lexer.RBRACE) && !p.check(lexer.EOF) {
@@ -402,6 +504,7 @@ func (p *Parser) parseIntentDecl() *ast.IntentDecl {
 			}
 		}
 	}
+	intent.EndComments = p.leadingComments()
 	p.expect(lexer.RBRACE)
 	return intent
 }
@@ -442,11 +545,16 @@ func (p *Parser) parseParamList() []*ast.Param {
 		return params
 	}
 
-	params = append(params, p.parseParam())
-	for p.match(lexer.COMMA) {
-		params = append(params, p.parseParam())
+	for {
+		leading := p.leadingComments()
+		param := p.parseParam()
+		more := p.match(lexer.COMMA)
+		p.attachComments(&param.Comments, leading)
+		params = append(params, param)
+		if !more {
+			return params
+		}
 	}
-	return params
 }
 
 // parseParam parses: <name>: <type>
@@ -462,6 +570,27 @@ func (p *Parser) parseParam() *ast.Param {
 	}
 }
 
+// parseTypeParams parses an optional type parameter list: <T, U: Ord>
+func (p *Parser) parseTypeParams() []*ast.TypeParam {
+	if !p.match(lexer.LT) {
+		return nil
+	}
+	var params []*ast.TypeParam
+	for {
+		tok := p.expect(lexer.IDENT)
+		param := &ast.TypeParam{Name: tok.Literal, Line: tok.Line, Column: tok.Column}
+		if p.match(lexer.COLON) {
+			param.Bound = p.expect(lexer.IDENT).Literal
+		}
+		params = append(params, param)
+		if !p.match(lexer.COMMA) {
+			break
+		}
+	}
+	p.expect(lexer.GT)
+	return params
+}
+
 // parseTypeRef parses a type reference
 func (p *Parser) parseTypeRef() *ast.TypeRef {
 	tok := p.current()
@@ -515,27 +644,69 @@ func (p *Parser) parseTypeRef() *ast.TypeRef {
 // parseContractClauses parses zero or more requires/ensures clauses
 func (p *Parser) parseContractClauses(keyword lexer.TokenType) []*ast.ContractClause {
 	var clauses []*ast.ContractClause
-	for p.check(keyword) {
+	for p.check(keyword) || p.annotates(keyword) {
+		leading := p.leadingComments()
+		alwaysCheck := p.parseAnnotations()
 		tok := p.advance()
 		startPos := p.pos
 		expr := p.parseExpression()
 		rawText := p.extractRawText(startPos)
-		clauses = append(clauses, &ast.ContractClause{
-			Expr:    expr,
-			RawText: rawText,
-			Line:    tok.Line,
-			Column:  tok.Column,
-		})
+		endLine, endCol := p.previousEnd()
+		clause := &ast.ContractClause{
+			Expr:        expr,
+			RawText:     rawText,
+			AlwaysCheck: alwaysCheck,
+			Line:        tok.Line,
+			Column:      tok.Column,
+			EndLine:     endLine,
+			EndColumn:   endCol,
+		}
+		p.attachComments(&clause.Comments, leading)
+		clauses = append(clauses, clause)
 	}
 	return clauses
 }
 
+// annotates reports whether the current token starts annotations, such as
+// @always_check, on a clause introduced by keyword.
+func (p *Parser) annotates(keyword lexer.TokenType) bool {
+	i := p.pos
+	for i+1 < len(p.tokens) && p.tokens[i].Type == lexer.AT && p.tokens[i+1].Type == lexer.IDENT {
+		i += 2
+	}
+	return i > p.pos && i < len(p.tokens) && p.tokens[i].Type == keyword
+}
+
+// parseAnnotations parses the annotations before a contract clause and
+// reports whether they include @always_check.
+func (p *Parser) parseAnnotations() bool {
+	alwaysCheck := false
+	for p.match(lexer.AT) {
+		name := p.expect(lexer.IDENT)
+		if name.Type != lexer.IDENT {
+			break
+		}
+		switch name.Literal {
+		case "always_check":
+			alwaysCheck = true
+		default:
+			p.diags.Errorf(name.Line, name.Column, "unknown annotation @%s", name.Literal)
+		}
+	}
+	return alwaysCheck
+}
+
 // parseBlock parses: { statement* }
 func (p *Parser) parseBlock() *ast.Block {
+	comments := p.braceComments()
 	tok := p.expect(lexer.LBRACE)
+	if c := p.trailingComment(); c != "" {
+		comments = append(comments, c)
+	}
 	block := &ast.Block{
-		Line:   tok.Line,
-		Column: tok.Column,
+		BraceComment: strings.Join(comments, " "),
+		Line:         tok.Line,
+		Column:       tok.Column,
 	}
 	for !p.check(lexer.RBRACE) && !p.check(lexer.EOF) {
 		stmt := p.parseStatement()
@@ -543,12 +714,23 @@ func (p *Parser) parseBlock() *ast.Block {
 			block.Statements = append(block.Statements, stmt)
 		}
 	}
+	block.EndComments = p.leadingComments()
 	p.expect(lexer.RBRACE)
 	return block
 }
 
-// parseStatement parses a statement
+// parseStatement parses a statement along with its comments
 func (p *Parser) parseStatement() ast.Statement {
+	leading := p.leadingComments()
+	stmt := p.parseStatementKind()
+	if c := ast.StatementComments(stmt); c != nil {
+		p.attachComments(c, leading)
+	}
+	return stmt
+}
+
+// parseStatementKind dispatches on the statement keyword
+func (p *Parser) parseStatementKind() ast.Statement {
 	switch p.current().Type {
 	case lexer.LET:
 		return p.parseLetStmt()
@@ -641,6 +823,7 @@ func (p *Parser) parseWhileStmt() *ast.WhileStmt {
 	// Parse optional decreases clause (at most one)
 	var decreases *ast.DecreaseClause
 	if p.check(lexer.DECREASES) {
+		leading := p.leadingComments()
 		decTok := p.advance()
 		startPos := p.pos
 		expr := p.parseExpression()
@@ -651,6 +834,7 @@ func (p *Parser) parseWhileStmt() *ast.WhileStmt {
 			Line:    decTok.Line,
 			Column:  decTok.Column,
 		}
+		p.attachComments(&decreases.Comments, leading)
 	}
 
 	body := p.parseBlock()
@@ -666,9 +850,15 @@ func (p *Parser) parseWhileStmt() *ast.WhileStmt {
 }
 
 // parseForStmt parses: for <variable> in <iterable> { ... }
+// or, over the entries of a map: for <key>, <value> in <map> { ... }
 func (p *Parser) parseForStmt() *ast.ForInStmt {
 	tok := p.expect(lexer.FOR)
 	varName := p.expect(lexer.IDENT)
+	valueName := ""
+	if p.check(lexer.COMMA) {
+		p.advance() // consume ','
+		valueName = p.expect(lexer.IDENT).Literal
+	}
 	p.expect(lexer.IN)
 
 	// Parse iterable -- could be array expression or range (start..end)
@@ -677,11 +867,12 @@ func (p *Parser) parseForStmt() *ast.ForInStmt {
 	body := p.parseBlock()
 
 	return &ast.ForInStmt{
-		Variable: varName.Literal,
-		Iterable: iterable,
-		Body:     body,
-		Line:     tok.Line,
-		Column:   tok.Column,
+		Variable:      varName.Literal,
+		ValueVariable: valueName,
+		Iterable:      iterable,
+		Body:          body,
+		Line:          tok.Line,
+		Column:        tok.Column,
 	}
 }
 
@@ -827,7 +1018,17 @@ func (p *Parser) parsePrecedence(minPrec int) ast.Expression {
 	return left
 }
 
+// parseUnary parses an operand along with the comments in front of it
 func (p *Parser) parseUnary() ast.Expression {
+	leading := p.leadingComments()
+	expr := p.parseUnaryKind()
+	if c := ast.ExpressionComments(expr); c != nil && len(leading) > 0 {
+		*c = append(leading, *c...)
+	}
+	return expr
+}
+
+func (p *Parser) parseUnaryKind() ast.Expression {
 	if p.check(lexer.MINUS) {
 		op := p.advance()
 		operand := p.parseUnary()
@@ -875,12 +1076,15 @@ func (p *Parser) parsePostfix() ast.Expression {
 				p.advance()
 				args := p.parseArgList()
 				p.expect(lexer.RPAREN)
+				endLine, endCol := p.previousEnd()
 				expr = &ast.MethodCallExpr{
-					Object: expr,
-					Method: name.Literal,
-					Args:   args,
-					Line:   name.Line,
-					Column: name.Column,
+					Object:    expr,
+					Method:    name.Literal,
+					Args:      args,
+					Line:      name.Line,
+					Column:    name.Column,
+					EndLine:   endLine,
+					EndColumn: endCol,
 				}
 			} else {
 				// field access
@@ -897,11 +1101,14 @@ func (p *Parser) parsePostfix() ast.Expression {
 				p.advance()
 				args := p.parseArgList()
 				p.expect(lexer.RPAREN)
+				endLine, endCol := p.previousEnd()
 				expr = &ast.CallExpr{
-					Function: ident.Name,
-					Args:     args,
-					Line:     ident.Line,
-					Column:   ident.Column,
+					Function:  ident.Name,
+					Args:      args,
+					Line:      ident.Line,
+					Column:    ident.Column,
+					EndLine:   endLine,
+					EndColumn: endCol,
 				}
 			} else {
 				break
@@ -1040,17 +1247,18 @@ func stripQuotes(s string) string {
 }
 
 // parseForallExpr parses: forall <var> in <start>..<end>: <expr>
+// or, over the keys of a map: forall <var> in <map>: <expr>
 func (p *Parser) parseForallExpr() *ast.ForallExpr {
 	tok := p.expect(lexer.FORALL)
 	varName := p.expect(lexer.IDENT).Literal
 	p.expect(lexer.IN)
 
-	// Parse range domain -- must be a range expression (start..end)
+	// Parse the domain -- a range expression (start..end) or a map
 	startExpr := p.parseExpression()
 	if !p.check(lexer.DOTDOT) {
-		p.diags.Errorf(tok.Line, tok.Column,
-			"forall requires bounded range domain (e.g., 0..n)")
-		return &ast.ForallExpr{Variable: varName, Line: tok.Line, Column: tok.Column}
+		p.expect(lexer.COLON)
+		body := p.parseExpression()
+		return &ast.ForallExpr{Variable: varName, Map: startExpr, Body: body, Line: tok.Line, Column: tok.Column}
 	}
 	p.advance() // consume DOTDOT
 	endExpr := p.parseExpression()
@@ -1069,17 +1277,18 @@ func (p *Parser) parseForallExpr() *ast.ForallExpr {
 }
 
 // parseExistsExpr parses: exists <var> in <start>..<end>: <expr>
+// or, over the keys of a map: exists <var> in <map>: <expr>
 func (p *Parser) parseExistsExpr() *ast.ExistsExpr {
 	tok := p.expect(lexer.EXISTS)
 	varName := p.expect(lexer.IDENT).Literal
 	p.expect(lexer.IN)
 
-	// Parse range domain -- must be a range expression (start..end)
+	// Parse the domain -- a range expression (start..end) or a map
 	startExpr := p.parseExpression()
 	if !p.check(lexer.DOTDOT) {
-		p.diags.Errorf(tok.Line, tok.Column,
-			"exists requires bounded range domain (e.g., 0..n)")
-		return &ast.ExistsExpr{Variable: varName, Line: tok.Line, Column: tok.Column}
+		p.expect(lexer.COLON)
+		body := p.parseExpression()
+		return &ast.ExistsExpr{Variable: varName, Map: startExpr, Body: body, Line: tok.Line, Column: tok.Column}
 	}
 	p.advance() // consume DOTDOT
 	endExpr := p.parseExpression()
@@ -1105,19 +1314,24 @@ func (p *Parser) parseMatchExpr() *ast.MatchExpr {
 
 	var arms []*ast.MatchArm
 	for !p.check(lexer.RBRACE) && !p.check(lexer.EOF) {
-		arms = append(arms, p.parseMatchArm())
+		leading := p.leadingComments()
+		arm := p.parseMatchArm()
 		// Allow optional comma between arms (and optional trailing comma)
 		if p.check(lexer.COMMA) {
 			p.advance()
 		}
+		p.attachComments(&arm.Comments, leading)
+		arms = append(arms, arm)
 	}
+	endComments := p.leadingComments()
 	p.expect(lexer.RBRACE)
 
 	return &ast.MatchExpr{
-		Scrutinee: scrutinee,
-		Arms:      arms,
-		Line:      tok.Line,
-		Column:    tok.Column,
+		Scrutinee:   scrutinee,
+		Arms:        arms,
+		EndComments: endComments,
+		Line:        tok.Line,
+		Column:      tok.Column,
 	}
 }
 
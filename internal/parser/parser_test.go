@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/lhaig/intent/internal/ast"
@@ -2109,3 +2110,403 @@ public entry function main() returns Int {
 		t.Errorf("expected function name 'main', got %q", fn.Name)
 	}
 }
+
+func TestParseComments(t *testing.T) {
+	input := `// header
+module test version "1.0.0";
+
+entity Box { // a box
+    // the size
+    field size: Int; // in cm
+    // nothing else
+}
+
+entry function main() returns Int
+    requires true // always
+{
+    // start
+    let x: Int = 1; // one
+    return x;
+    // unreachable
+}
+// trailer`
+	p := New(input)
+	prog := p.Parse()
+
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("unexpected errors: %s", p.Diagnostics().Format("test"))
+	}
+
+	if got := prog.Module.Comments.Leading; len(got) != 1 || got[0] != "// header" {
+		t.Errorf("expected module leading comment, got %v", got)
+	}
+
+	box := prog.Entities[0]
+	if box.BraceComment != "// a box" {
+		t.Errorf("expected brace comment, got %q", box.BraceComment)
+	}
+	field := box.Fields[0]
+	if len(field.Comments.Leading) != 1 || field.Comments.Leading[0] != "// the size" {
+		t.Errorf("expected field leading comment, got %v", field.Comments.Leading)
+	}
+	if field.Comments.Trailing != "// in cm" {
+		t.Errorf("expected field trailing comment, got %q", field.Comments.Trailing)
+	}
+	if len(box.EndComments) != 1 || box.EndComments[0] != "// nothing else" {
+		t.Errorf("expected entity end comment, got %v", box.EndComments)
+	}
+
+	fn := prog.Functions[0]
+	if fn.Requires[0].Comments.Trailing != "// always" {
+		t.Errorf("expected requires trailing comment, got %q", fn.Requires[0].Comments.Trailing)
+	}
+	let := fn.Body.Statements[0].(*ast.LetStmt)
+	if len(let.Comments.Leading) != 1 || let.Comments.Leading[0] != "// start" || let.Comments.Trailing != "// one" {
+		t.Errorf("unexpected let comments: %+v", let.Comments)
+	}
+	if len(fn.Body.EndComments) != 1 || fn.Body.EndComments[0] != "// unreachable" {
+		t.Errorf("expected block end comment, got %v", fn.Body.EndComments)
+	}
+	if len(prog.EndComments) != 1 || prog.EndComments[0] != "// trailer" {
+		t.Errorf("expected end of file comment, got %v", prog.EndComments)
+	}
+}
+
+func TestParseNestedComments(t *testing.T) {
+	input := `module test version "1.0.0";
+
+function pick(a: Int, // first
+    // second
+    b: Option<Int>) returns Int {
+    return match b {
+        // present
+        Some(x) => x + // partial
+            a, // use it
+        None => a
+        // no more
+    };
+}`
+	p := New(input)
+	prog := p.Parse()
+
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("unexpected errors: %s", p.Diagnostics().Format("test"))
+	}
+
+	fn := prog.Functions[0]
+	if c := fn.Params[0].Comments; len(c.Leading) != 0 || c.Trailing != "// first" {
+		t.Errorf("unexpected first param comments: %+v", c)
+	}
+	if c := fn.Params[1].Comments; len(c.Leading) != 1 || c.Leading[0] != "// second" || c.Trailing != "" {
+		t.Errorf("unexpected second param comments: %+v", c)
+	}
+
+	ret := fn.Body.Statements[0].(*ast.ReturnStmt)
+	if len(ret.Comments.Leading) != 0 || ret.Comments.Trailing != "" {
+		t.Errorf("expected no return comments, got %+v", ret.Comments)
+	}
+	match := ret.Value.(*ast.MatchExpr)
+	some := match.Arms[0]
+	if len(some.Comments.Leading) != 1 || some.Comments.Leading[0] != "// present" || some.Comments.Trailing != "// use it" {
+		t.Errorf("unexpected arm comments: %+v", some.Comments)
+	}
+	sum := some.Body.(*ast.BinaryExpr)
+	if got := *ast.ExpressionComments(sum.Right); len(got) != 1 || got[0] != "// partial" {
+		t.Errorf("expected operand comment, got %v", got)
+	}
+	if len(match.EndComments) != 1 || match.EndComments[0] != "// no more" {
+		t.Errorf("expected match end comment, got %v", match.EndComments)
+	}
+}
+
+// TestParseCommentAnchors checks that a comment stays with the token after
+// it when the two share a line, or when that token opens a block.
+func TestParseCommentAnchors(t *testing.T) {
+	input := `module test version "1.0.0";
+
+function pick(a: Int, /* c */ b: Int) returns Int // after sig
+{
+    return a;
+}`
+	p := New(input)
+	prog := p.Parse()
+
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("unexpected errors: %s", p.Diagnostics().Format("test"))
+	}
+
+	fn := prog.Functions[0]
+	if c := fn.Params[0].Comments; len(c.Leading) != 0 || c.Trailing != "" {
+		t.Errorf("expected no comments on a, got %+v", c)
+	}
+	if c := fn.Params[1].Comments; len(c.Leading) != 1 || c.Leading[0] != "/* c */" || c.Trailing != "" {
+		t.Errorf("expected /* c */ to lead b, got %+v", c)
+	}
+	if fn.Body.BraceComment != "// after sig" {
+		t.Errorf("expected the signature comment on the body's brace, got %q", fn.Body.BraceComment)
+	}
+	if ret := fn.Body.Statements[0].(*ast.ReturnStmt); len(ret.Comments.Leading) != 0 {
+		t.Errorf("expected no comments on the return, got %v", ret.Comments.Leading)
+	}
+}
+
+func TestParseAlwaysCheck(t *testing.T) {
+	input := `module test version "1.0.0";
+
+entity Counter {
+    field n: Int;
+    @always_check invariant self.n >= 0;
+    invariant self.n < 100;
+
+    method bump() returns Void
+        requires self.n < 99
+        @always_check ensures self.n == old(self.n) + 1
+    {
+        self.n = self.n + 1;
+    }
+}
+
+function count(n: Int) returns Int {
+    let mutable i: Int = 0;
+    while i < n
+        @always_check invariant i >= 0
+    {
+        i = i + 1;
+    }
+    return i;
+}`
+	p := New(input)
+	prog := p.Parse()
+
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("unexpected errors: %s", p.Diagnostics().Format("test"))
+	}
+
+	ent := prog.Entities[0]
+	if !ent.Invariants[0].AlwaysCheck || ent.Invariants[1].AlwaysCheck {
+		t.Error("expected only the first invariant to be @always_check")
+	}
+	m := ent.Methods[0]
+	if m.Requires[0].AlwaysCheck || !m.Ensures[0].AlwaysCheck {
+		t.Error("expected only the ensures to be @always_check")
+	}
+	if strings.Contains(m.Ensures[0].RawText, "always_check") {
+		t.Errorf("expected annotation left out of the contract text, got %q", m.Ensures[0].RawText)
+	}
+	loop := prog.Functions[0].Body.Statements[1].(*ast.WhileStmt)
+	if len(loop.Invariants) != 1 || !loop.Invariants[0].AlwaysCheck {
+		t.Error("expected an @always_check loop invariant")
+	}
+}
+
+func TestParseAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"unknown", `module test version "1.0.0";
+function f() returns Int
+    @sometimes ensures result == 0
+{ return 0; }`, "unknown annotation @sometimes"},
+		{"method", `module test version "1.0.0";
+entity E {
+    field n: Int;
+    @always_check method m() returns Void { }
+}`, "annotations apply only to requires, ensures and invariant clauses"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.input)
+			_ = p.Parse()
+			if got := p.Diagnostics().Format("test"); !strings.Contains(got, tt.want) {
+				t.Errorf("expected %q, got:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseTypeParams(t *testing.T) {
+	input := `module test version "1.0.0";
+
+function max<T: Ord>(a: T, b: T) returns T {
+    if a > b { return a; }
+    return b;
+}
+
+entity Pair<A, B: Eq> {
+    field first: A;
+    field second: B;
+}
+
+enum Tree<T> {
+    Leaf(value: T),
+    Empty,
+}`
+	p := New(input)
+	prog := p.Parse()
+
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("unexpected errors: %s", p.Diagnostics().Format("test"))
+	}
+
+	fn := prog.Functions[0]
+	if len(fn.TypeParams) != 1 || fn.TypeParams[0].Name != "T" || fn.TypeParams[0].Bound != "Ord" {
+		t.Errorf("expected <T: Ord> on max, got %v", fn.TypeParams)
+	}
+	if fn.Params[0].Type.Name != "T" {
+		t.Errorf("expected param of type T, got %q", fn.Params[0].Type.Name)
+	}
+
+	ent := prog.Entities[0]
+	if len(ent.TypeParams) != 2 {
+		t.Fatalf("expected 2 type params on Pair, got %d", len(ent.TypeParams))
+	}
+	if ent.TypeParams[0].Name != "A" || ent.TypeParams[0].Bound != "" {
+		t.Errorf("expected unbounded A, got %s: %s", ent.TypeParams[0].Name, ent.TypeParams[0].Bound)
+	}
+	if ent.TypeParams[1].Name != "B" || ent.TypeParams[1].Bound != "Eq" {
+		t.Errorf("expected B: Eq, got %s: %s", ent.TypeParams[1].Name, ent.TypeParams[1].Bound)
+	}
+
+	enum := prog.Enums[0]
+	if len(enum.TypeParams) != 1 || enum.TypeParams[0].Name != "T" {
+		t.Errorf("expected <T> on Tree, got %v", enum.TypeParams)
+	}
+}
+
+func TestParseTypeParamsErrors(t *testing.T) {
+	input := `module test version "1.0.0";
+function f<T,>(x: T) returns T { return x; }`
+	p := New(input)
+	_ = p.Parse()
+	if !p.Diagnostics().HasErrors() {
+		t.Fatal("expected an error for a trailing comma in type parameters")
+	}
+}
+
+func TestParseTraitDecl(t *testing.T) {
+	input := `module test version "1.0.0";
+
+public trait Shape {
+    method area() returns Int
+        ensures result >= 0;
+    method scale(k: Int) returns Void
+        requires k > 0;
+}
+
+entity Square implements Shape, Named {
+    field side: Int;
+}`
+	p := New(input)
+	prog := p.Parse()
+
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("unexpected errors: %s", p.Diagnostics().Format("test"))
+	}
+	if len(prog.Traits) != 1 {
+		t.Fatalf("expected 1 trait, got %d", len(prog.Traits))
+	}
+
+	trait := prog.Traits[0]
+	if trait.Name != "Shape" || !trait.IsPublic {
+		t.Errorf("expected public trait Shape, got %q (public %v)", trait.Name, trait.IsPublic)
+	}
+	if len(trait.Methods) != 2 {
+		t.Fatalf("expected 2 methods, got %d", len(trait.Methods))
+	}
+	area := trait.Methods[0]
+	if area.Name != "area" || area.ReturnType.Name != "Int" || len(area.Ensures) != 1 || area.Body != nil {
+		t.Errorf("unexpected area signature: %+v", area)
+	}
+	scale := trait.Methods[1]
+	if len(scale.Params) != 1 || scale.Params[0].Name != "k" || len(scale.Requires) != 1 {
+		t.Errorf("unexpected scale signature: %+v", scale)
+	}
+
+	ent := prog.Entities[0]
+	if len(ent.Implements) != 2 || ent.Implements[0].Name != "Shape" || ent.Implements[1].Name != "Named" {
+		t.Errorf("expected Square to implement Shape, Named, got %v", ent.Implements)
+	}
+}
+
+func TestParseTraitErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"method body", `module test version "1.0.0";
+trait T {
+    method f() returns Int { return 1; }
+}`},
+		{"field", `module test version "1.0.0";
+trait T {
+    field x: Int;
+}`},
+		{"missing trait name", `module test version "1.0.0";
+entity E implements {
+    field x: Int;
+}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.input)
+			_ = p.Parse()
+			if !p.Diagnostics().HasErrors() {
+				t.Fatal("expected a parse error")
+			}
+		})
+	}
+}
+
+func TestParseMapLoopsAndQuantifiers(t *testing.T) {
+	input := `module test version "1.0.0";
+
+function total(m: Map<String, Int>) returns Int
+    requires forall k in m: m.contains(k)
+    ensures exists k in self.counts: k == "a"
+{
+    for k, v in m {
+        print(v);
+    }
+    return 0;
+}`
+	p := New(input)
+	prog := p.Parse()
+
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("unexpected errors: %s", p.Diagnostics().Format("test"))
+	}
+	fn := prog.Functions[0]
+	param := fn.Params[0].Type
+	if param.Name != "Map" || len(param.TypeArgs) != 2 || param.TypeArgs[0].Name != "String" || param.TypeArgs[1].Name != "Int" {
+		t.Errorf("expected Map<String, Int>, got %+v", param)
+	}
+
+	forall, ok := fn.Requires[0].Expr.(*ast.ForallExpr)
+	if !ok {
+		t.Fatalf("expected ForallExpr, got %T", fn.Requires[0].Expr)
+	}
+	if forall.Domain != nil {
+		t.Errorf("expected no range domain, got %v", forall.Domain)
+	}
+	if m, ok := forall.Map.(*ast.Identifier); !ok || m.Name != "m" {
+		t.Errorf("expected map domain m, got %v", forall.Map)
+	}
+	exists, ok := fn.Ensures[0].Expr.(*ast.ExistsExpr)
+	if !ok {
+		t.Fatalf("expected ExistsExpr, got %T", fn.Ensures[0].Expr)
+	}
+	if _, ok := exists.Map.(*ast.FieldAccessExpr); !ok {
+		t.Errorf("expected field access map domain, got %T", exists.Map)
+	}
+
+	loop, ok := fn.Body.Statements[0].(*ast.ForInStmt)
+	if !ok {
+		t.Fatalf("expected ForInStmt, got %T", fn.Body.Statements[0])
+	}
+	if loop.Variable != "k" || loop.ValueVariable != "v" {
+		t.Errorf("expected for k, v, got for %s, %s", loop.Variable, loop.ValueVariable)
+	}
+}
@@ -0,0 +1,456 @@
+// Package repl implements `intentc repl`, an interactive shell that
+// accumulates declarations, keeps let bindings between inputs and evaluates
+// statements and expressions with the interpreter. Every input is
+// type-checked against the accumulated program before it runs, and calls
+// check their contracts live.
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lhaig/intent/internal/ast"
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/diagnostic"
+	"github.com/lhaig/intent/internal/formatter"
+	"github.com/lhaig/intent/internal/interp"
+	"github.com/lhaig/intent/internal/ir"
+	"github.com/lhaig/intent/internal/parser"
+)
+
+const (
+	header    = "module repl version \"0.0.0\";\n"
+	evalName  = "__repl"
+	argPrefix = "__repl_"
+)
+
+const help = `Enter declarations (function, entity, enum, intent), statements or
+expressions. Expressions print their value and type; let bindings persist.
+
+Commands:
+  :type <expr>   Show the type of an expression without evaluating it
+  :decls         Show the accumulated declarations
+  :vars          Show the current bindings
+  :reset         Forget all declarations and bindings
+  :help          Show this help
+  :quit          Exit
+`
+
+// Session is the state of one REPL: the declarations entered so far and the
+// bindings left by earlier inputs.
+type Session struct {
+	out   io.Writer
+	decls []decl
+	vars  []*binding
+}
+
+// decl is one top-level declaration, kept as source text.
+type decl struct {
+	name string
+	text string
+}
+
+// binding is a let binding that outlives the input that created it.
+type binding struct {
+	name    string
+	mutable bool
+	typ     string
+	value   interp.Value
+}
+
+// New creates an empty session that writes results and print output to out.
+func New(out io.Writer) *Session {
+	return &Session{out: out}
+}
+
+// Run reads inputs from in until EOF or :quit, writing prompts and results
+// to out. Inputs may span several lines; a line that leaves brackets open,
+// or a declaration that has not reached its closing brace, continues on the
+// next one.
+func Run(in io.Reader, out io.Writer) error {
+	s := New(out)
+	scanner := bufio.NewScanner(in)
+	fmt.Fprintln(out, "Intent REPL. Type :help for commands, :quit to exit.")
+
+	var buf strings.Builder
+	for {
+		if buf.Len() == 0 {
+			fmt.Fprint(out, "intent> ")
+		} else {
+			fmt.Fprint(out, "   ...> ")
+		}
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		buf.WriteString(scanner.Text())
+		buf.WriteString("\n")
+
+		input := strings.TrimSpace(buf.String())
+		if input != "" && !complete(input) {
+			continue
+		}
+		buf.Reset()
+		if input == ":quit" || input == ":q" {
+			return nil
+		}
+		if err := s.Eval(input); err != nil {
+			fmt.Fprintf(out, "error: %s\n", err)
+		}
+	}
+}
+
+// complete reports whether input can be evaluated as it stands.
+func complete(input string) bool {
+	if strings.HasPrefix(input, ":") {
+		return true
+	}
+	depth := 0
+	inString := false
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case inString:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == '/' && i+1 < len(input) && input[i+1] == '/':
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+		}
+	}
+	if depth > 0 || inString {
+		return false
+	}
+	if isDeclaration(input) {
+		return strings.HasSuffix(input, "}")
+	}
+	return true
+}
+
+// isDeclaration reports whether input starts with a declaration keyword.
+func isDeclaration(input string) bool {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "function", "entry", "entity", "enum", "trait", "intent", "public":
+		return true
+	}
+	return false
+}
+
+// Eval evaluates one complete input: a command, a declaration, or a sequence
+// of statements optionally ending in an expression.
+func (s *Session) Eval(input string) error {
+	input = strings.TrimSpace(input)
+	switch {
+	case input == "":
+		return nil
+	case strings.HasPrefix(input, ":"):
+		return s.command(input)
+	case isDeclaration(input):
+		return s.declare(input)
+	}
+	return s.run(input, false)
+}
+
+func (s *Session) command(input string) error {
+	name, arg, _ := strings.Cut(input, " ")
+	switch name {
+	case ":help", ":h":
+		fmt.Fprint(s.out, help)
+	case ":type", ":t":
+		if strings.TrimSpace(arg) == "" {
+			return fmt.Errorf(":type needs an expression")
+		}
+		return s.run(arg, true)
+	case ":decls":
+		for _, d := range s.decls {
+			fmt.Fprintln(s.out, d.text)
+		}
+	case ":vars":
+		for _, b := range s.vars {
+			fmt.Fprintf(s.out, "%s: %s = %s\n", b.name, b.typ, interp.Debug(b.value))
+		}
+	case ":reset":
+		s.decls = nil
+		s.vars = nil
+	default:
+		return fmt.Errorf("unknown command %s (try :help)", name)
+	}
+	return nil
+}
+
+// declare adds or replaces declarations, keeping them only if the program
+// still checks.
+func (s *Session) declare(input string) error {
+	p := parser.New(header + input)
+	prog := p.Parse()
+	if p.Diagnostics().HasErrors() {
+		return diagnosticsError(p.Diagnostics())
+	}
+	if len(prog.Imports) > 0 {
+		return fmt.Errorf("imports are not supported in the REPL")
+	}
+
+	var added []decl
+	var kinds []string
+	for _, fn := range prog.Functions {
+		added = append(added, decl{name: fn.Name})
+		kinds = append(kinds, "function")
+	}
+	for _, ent := range prog.Entities {
+		added = append(added, decl{name: ent.Name})
+		kinds = append(kinds, "entity")
+	}
+	for _, enum := range prog.Enums {
+		added = append(added, decl{name: enum.Name})
+		kinds = append(kinds, "enum")
+	}
+	for _, trait := range prog.Traits {
+		added = append(added, decl{name: trait.Name})
+		kinds = append(kinds, "trait")
+	}
+	for _, intent := range prog.Intents {
+		added = append(added, decl{name: "intent " + intent.Description})
+		kinds = append(kinds, "intent")
+	}
+	if len(added) == 0 {
+		return fmt.Errorf("expected a declaration")
+	}
+
+	// Keep the declaration as one text block, stored under its first name;
+	// redeclaring a name replaces the earlier definition.
+	decls := make([]decl, 0, len(s.decls)+1)
+	for _, d := range s.decls {
+		replaced := false
+		for _, a := range added {
+			if a.name == d.name {
+				replaced = true
+			}
+		}
+		if !replaced {
+			decls = append(decls, d)
+		}
+	}
+	decls = append(decls, decl{name: added[0].name, text: input})
+
+	source := header + joinDecls(decls)
+	p = parser.New(source)
+	full := p.Parse()
+	if p.Diagnostics().HasErrors() {
+		return diagnosticsError(p.Diagnostics())
+	}
+	if result := checker.CheckWithResult(full); result.Diagnostics.HasErrors() {
+		return diagnosticsError(result.Diagnostics)
+	}
+
+	s.decls = decls
+	for i, a := range added {
+		if kinds[i] == "intent" {
+			fmt.Fprintln(s.out, "defined intent")
+			continue
+		}
+		fmt.Fprintf(s.out, "defined %s %s\n", kinds[i], a.name)
+	}
+	return nil
+}
+
+// run evaluates statements in a synthesized function that receives the
+// current bindings as parameters and rebinds them as locals. A trailing
+// expression becomes the function's return value. With typeOnly the input
+// is checked but not executed.
+func (s *Session) run(input string, typeOnly bool) error {
+	// Parse the input on its own first to learn which names it redeclares.
+	// A trailing expression may omit its semicolon; one ending in a brace,
+	// such as a match, is only known to need it once a plain parse fails.
+	prog, err := parseStmts(input)
+	if err != nil && !strings.HasSuffix(input, ";") {
+		if p, retryErr := parseStmts(input + ";"); retryErr == nil {
+			input, prog, err = input+";", p, nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	redeclared := make(map[string]bool)
+	for _, stmt := range prog.Functions[0].Body.Statements {
+		if let, ok := stmt.(*ast.LetStmt); ok {
+			redeclared[let.Name] = true
+		}
+	}
+
+	var carried []*binding
+	var params, prelude strings.Builder
+	for _, b := range s.vars {
+		if redeclared[b.name] {
+			continue
+		}
+		if len(carried) > 0 {
+			params.WriteString(", ")
+		}
+		fmt.Fprintf(&params, "%s%s: %s", argPrefix, b.name, b.typ)
+		mut := ""
+		if b.mutable {
+			mut = "mutable "
+		}
+		fmt.Fprintf(&prelude, "    let %s%s: %s = %s%s;\n", mut, b.name, b.typ, argPrefix, b.name)
+		carried = append(carried, b)
+	}
+
+	source := header + joinDecls(s.decls) +
+		"function " + evalName + "(" + params.String() + ") returns Void {\n" +
+		prelude.String() + input + "\n}\n"
+	p := parser.New(source)
+	prog = p.Parse()
+	if p.Diagnostics().HasErrors() {
+		return diagnosticsError(p.Diagnostics())
+	}
+
+	fn := prog.Functions[len(prog.Functions)-1]
+	body := fn.Body.Statements
+	var value ast.Expression
+	if len(body) > 0 {
+		if es, ok := body[len(body)-1].(*ast.ExprStmt); ok {
+			value = es.Expr
+			line, col := es.Pos()
+			body[len(body)-1] = &ast.ReturnStmt{Value: value, Line: line, Column: col}
+		}
+	}
+
+	result := checker.CheckWithResult(prog)
+	if result.Diagnostics.HasErrors() {
+		return diagnosticsError(result.Diagnostics)
+	}
+
+	if typeOnly {
+		if value == nil {
+			return fmt.Errorf(":type needs an expression")
+		}
+		fmt.Fprintln(s.out, result.ExprTypes[value].String())
+		return nil
+	}
+
+	in := interp.New(&ir.Program{Modules: []*ir.Module{ir.Lower(prog, result)}}, s.out)
+	// Run on copies so a failing input leaves the bindings as they were.
+	copies := make(map[any]interp.Value)
+	args := make([]interp.Value, len(carried))
+	for i, b := range carried {
+		args[i] = clone(b.value, copies)
+		in.Rebind(args[i])
+	}
+	v, vars, err := in.Exec(evalName, args...)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range carried {
+		b.value = vars[b.name]
+	}
+	for _, stmt := range body {
+		let, ok := stmt.(*ast.LetStmt)
+		if !ok || !redeclared[let.Name] {
+			continue
+		}
+		b := &binding{
+			name:    let.Name,
+			mutable: let.Mutable,
+			typ:     formatter.FormatType(let.Type),
+			value:   vars[let.Name],
+		}
+		s.bind(b)
+		fmt.Fprintf(s.out, "%s: %s = %s\n", b.name, b.typ, interp.Debug(b.value))
+	}
+
+	if value != nil {
+		if t := result.ExprTypes[value]; t != nil && t.Name != "Void" {
+			fmt.Fprintf(s.out, "%s : %s\n", interp.Debug(v), t)
+		}
+	}
+	return nil
+}
+
+// parseStmts parses input as the body of a function.
+func parseStmts(input string) (*ast.Program, error) {
+	p := parser.New(header + "function " + evalName + "() returns Void {\n" + input + "\n}\n")
+	prog := p.Parse()
+	if p.Diagnostics().HasErrors() {
+		return nil, diagnosticsError(p.Diagnostics())
+	}
+	return prog, nil
+}
+
+// bind adds b, replacing an earlier binding of the same name.
+func (s *Session) bind(b *binding) {
+	for i, old := range s.vars {
+		if old.name == b.name {
+			s.vars[i] = b
+			return
+		}
+	}
+	s.vars = append(s.vars, b)
+}
+
+// clone deep-copies v. copies maps originals to their copies so values that
+// share an array or entity still share it afterwards.
+func clone(v interp.Value, copies map[any]interp.Value) interp.Value {
+	if c, ok := copies[v]; ok {
+		return c
+	}
+	switch val := v.(type) {
+	case *interp.Array:
+		c := &interp.Array{Elems: make([]interp.Value, len(val.Elems))}
+		copies[v] = c
+		for i, el := range val.Elems {
+			c.Elems[i] = clone(el, copies)
+		}
+		return c
+	case *interp.Object:
+		c := &interp.Object{Entity: val.Entity, Fields: make(map[string]interp.Value, len(val.Fields))}
+		copies[v] = c
+		for k, f := range val.Fields {
+			c.Fields[k] = clone(f, copies)
+		}
+		return c
+	case *interp.Variant:
+		c := &interp.Variant{Enum: val.Enum, Name: val.Name, Fields: val.Fields, Values: make([]interp.Value, len(val.Values))}
+		copies[v] = c
+		for i, fv := range val.Values {
+			c.Values[i] = clone(fv, copies)
+		}
+		return c
+	}
+	return v
+}
+
+func joinDecls(decls []decl) string {
+	var sb strings.Builder
+	for _, d := range decls {
+		sb.WriteString(d.text)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// diagnosticsError reports the error messages of diags without positions,
+// which refer to the synthesized program rather than to what was typed.
+func diagnosticsError(diags *diagnostic.Diagnostics) error {
+	var msgs []string
+	for _, d := range diags.Errors() {
+		msgs = append(msgs, d.Message)
+	}
+	return fmt.Errorf("%s", strings.Join(msgs, "\nerror: "))
+}
@@ -0,0 +1,199 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// session feeds inputs to a fresh session and returns everything written,
+// with errors rendered the way Run shows them.
+func session(t *testing.T, inputs ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	s := New(&out)
+	for _, input := range inputs {
+		if err := s.Eval(input); err != nil {
+			out.WriteString("error: " + err.Error() + "\n")
+		}
+	}
+	return out.String()
+}
+
+func expectSession(t *testing.T, want string, inputs ...string) {
+	t.Helper()
+	if got := session(t, inputs...); got != want {
+		t.Errorf("output mismatch\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+const double = `function double(x: Int) returns Int
+    requires x >= 0
+    ensures result == x * 2
+{
+    return x * 2;
+}`
+
+func TestExpressions(t *testing.T) {
+	expectSession(t, "3 : Int\n2.5 : Float\n\"ab\" : String\ntrue : Bool\n",
+		"1 + 2",
+		"5.0 / 2.0",
+		`"a" + "b"`,
+		"not false;",
+	)
+}
+
+func TestDeclarationsAndContracts(t *testing.T) {
+	expectSession(t, "defined function double\n42 : Int\nerror: Precondition failed: x >= 0\n",
+		double,
+		"double(21)",
+		"double(-1)",
+	)
+}
+
+func TestBindingsPersist(t *testing.T) {
+	expectSession(t, "n: Int = 3\n9 : Int\nn is 9\nxs: Array<Int> = [1]\n[1, 9] : Array<Int>\n",
+		"let mutable n: Int = 3;",
+		"n = n * 3;",
+		"n",
+		`print("n is {n}");`,
+		"let mutable xs: Array<Int> = [1];",
+		"xs.push(n);",
+		"xs",
+	)
+}
+
+func TestRebinding(t *testing.T) {
+	expectSession(t, "x: Int = 1\nx: String = \"one\"\n\"one\" : String\n",
+		"let x: Int = 1;",
+		`let x: String = "one";`,
+		"x",
+	)
+}
+
+func TestTypeCommand(t *testing.T) {
+	expectSession(t, "defined function double\nInt\nBool\n",
+		double,
+		":type double(1)",
+		":type 1 < 2",
+	)
+}
+
+func TestCheckErrors(t *testing.T) {
+	out := session(t, "let a: Int = 1;", "a = 2;", "b + 1", "let c: Int = true;")
+	for _, want := range []string{
+		"cannot assign to immutable variable 'a'",
+		"undeclared variable 'b'",
+		"type mismatch: cannot assign Bool to Int",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestInvalidDeclarationIsDiscarded(t *testing.T) {
+	expectSession(t, "error: undeclared variable 'y'\nerror: unknown function 'broken'\n",
+		"function broken() returns Int { return y; }",
+		"broken()",
+	)
+}
+
+func TestRedeclareFunction(t *testing.T) {
+	expectSession(t, "defined function f\n1 : Int\ndefined function f\n2 : Int\n",
+		"function f() returns Int { return 1; }",
+		"f()",
+		"function f() returns Int { return 2; }",
+		"f()",
+	)
+}
+
+func TestEntitiesAndFailedInputRollsBack(t *testing.T) {
+	expectSession(t, "defined entity Counter\n"+
+		"k: Counter = Counter { c: 0 }\n"+
+		"error: Invariant failed: self . c >= 0\n"+
+		"0 : Int\n"+
+		"1 : Int\n",
+		`entity Counter {
+    field c: Int;
+    invariant self.c >= 0;
+    constructor() { self.c = 0; }
+    method add(n: Int) returns Void { self.c = self.c + n; }
+}`,
+		"let k: Counter = Counter();",
+		"k.add(-1);",
+		"k.c",
+		"k.add(1); k.c",
+	)
+}
+
+func TestEnumsAndMatch(t *testing.T) {
+	expectSession(t, "defined enum Color\nc: Color = Green\n\"g\" : String\n",
+		"enum Color { Red, Green }",
+		"let c: Color = Green;",
+		`match c { Red => "r", Green => "g" }`,
+	)
+}
+
+func TestCommands(t *testing.T) {
+	out := session(t, "let a: Int = 1;", double, ":vars", ":decls", ":reset", ":vars", "a", ":nope")
+	for _, want := range []string{
+		"a: Int = 1\n",
+		"function double(x: Int) returns Int\n",
+		"undeclared variable 'a'",
+		"unknown command :nope",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestRunMultiLine(t *testing.T) {
+	in := strings.NewReader("function sq(x: Int) returns Int\n    requires x < 100\n{\n    return x * x;\n}\nsq(\n  7)\n:quit\nsq(1)\n")
+	var out bytes.Buffer
+	if err := Run(in, &out); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	if !strings.Contains(got, "defined function sq\n") || !strings.Contains(got, "49 : Int\n") {
+		t.Errorf("unexpected output:\n%s", got)
+	}
+	if strings.Contains(got, "1 : Int") {
+		t.Errorf("input after :quit was evaluated:\n%s", got)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"1 + 2", true},
+		{"f(1,", false},
+		{`"a(" + "b"`, true},
+		{"function f() returns Int", false},
+		{"function f() returns Int {\n return 1;", false},
+		{"function f() returns Int {\n return 1;\n}", true},
+		{"while i < 3 {", false},
+		{":help", true},
+	}
+	for _, tt := range tests {
+		if got := complete(tt.input); got != tt.want {
+			t.Errorf("complete(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestTraits(t *testing.T) {
+	expectSession(t, "defined trait Shape\ndefined entity Square\ns: Shape = Square { side: 2 }\n4 : Int\n",
+		"trait Shape { method area() returns Int; }",
+		`entity Square implements Shape {
+    field side: Int;
+    constructor(side: Int) { self.side = side; }
+    method area() returns Int { return self.side * self.side; }
+}`,
+		"let s: Shape = Square(2);",
+		"s.area()",
+	)
+}
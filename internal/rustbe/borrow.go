@@ -0,0 +1,261 @@
+package rustbe
+
+import (
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// Arrays and maps are passed to functions by reference. A function that
+// changes such a parameter, directly or by passing it on, takes it as &mut
+// so that the caller sees the change, as it does in the interpreter and the
+// other backends. Method calls on entity elements count as changes, since
+// methods take &mut self.
+
+// mutRefParams finds the reference parameters of the functions of mods that
+// are taken as &mut.
+func mutRefParams(mods []*ir.Module) map[*ir.Function]map[string]bool {
+	modules := make(map[string]map[string]*ir.Function)
+	for _, mod := range mods {
+		functions := make(map[string]*ir.Function)
+		for _, f := range mod.Functions {
+			functions[f.Name] = f
+		}
+		modules[mod.Name] = functions
+	}
+
+	mut := make(map[*ir.Function]map[string]bool)
+	mark := func(f *ir.Function, name string) bool {
+		if mut[f][name] {
+			return false
+		}
+		if mut[f] == nil {
+			mut[f] = make(map[string]bool)
+		}
+		mut[f][name] = true
+		return true
+	}
+
+	// Passing a parameter on to one taken as &mut changes it, so repeat
+	// until no more are found
+	for changed := true; changed; {
+		changed = false
+		for _, mod := range mods {
+			for _, f := range mod.Functions {
+				refs := make(map[string]bool)
+				for _, p := range f.Params {
+					if isRefParam(p.Type) {
+						refs[p.Name] = true
+					}
+				}
+				if len(refs) == 0 {
+					continue
+				}
+				for _, name := range mutatedVars(f.Body, modules[mod.Name], modules, mut) {
+					if refs[name] && mark(f, name) {
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return mut
+}
+
+// mutatedVars returns the variables that body changes through an element,
+// a field or a method call, or passes to a parameter taken as &mut.
+// functions are those of the current module.
+func mutatedVars(body []ir.Stmt, functions map[string]*ir.Function, modules map[string]map[string]*ir.Function, mut map[*ir.Function]map[string]bool) []string {
+	var names []string
+	passed := func(callee *ir.Function, args []ir.Expr) {
+		if callee == nil {
+			return
+		}
+		for i, arg := range args {
+			if v, ok := arg.(*ir.VarRef); ok && i < len(callee.Params) && mut[callee][callee.Params[i].Name] {
+				names = append(names, v.Name)
+			}
+		}
+	}
+
+	ir.WalkStmts(body, func(s ir.Stmt) {
+		if a, ok := s.(*ir.AssignStmt); ok {
+			if _, isVar := a.Target.(*ir.VarRef); !isVar {
+				if name, ok := rootVar(a.Target); ok {
+					names = append(names, name)
+				}
+			}
+		}
+	})
+	ir.WalkStmtExprs(body, func(e ir.Expr) {
+		ir.WalkExpr(e, func(x ir.Expr) {
+			switch x := x.(type) {
+			case *ir.CallExpr:
+				if x.Kind == ir.CallFunction {
+					passed(functions[x.Function], x.Args)
+				}
+			case *ir.MethodCallExpr:
+				if x.IsModuleCall {
+					passed(modules[x.ModuleName][x.Method], x.Args)
+				} else if mutatingMethod(x) {
+					if name, ok := rootVar(x.Object); ok {
+						names = append(names, name)
+					}
+				}
+			}
+		})
+	})
+	return names
+}
+
+// mutatingMethod reports whether m needs its receiver to be mutable.
+func mutatingMethod(m *ir.MethodCallExpr) bool {
+	t := m.Object.ExprType()
+	switch {
+	case t == nil:
+		return false
+	case t.IsEntity || t.IsTrait:
+		return true
+	case t.Name == "Array":
+		return m.Method == "push"
+	case isMap(m.Object):
+		return m.Method == "set" || m.Method == "remove"
+	}
+	return false
+}
+
+// rootVar returns the variable that a place expression such as xs[i].f
+// refers into.
+func rootVar(e ir.Expr) (string, bool) {
+	for {
+		switch x := e.(type) {
+		case *ir.VarRef:
+			return x.Name, true
+		case *ir.IndexExpr:
+			e = x.Object
+		case *ir.FieldAccessExpr:
+			e = x.Object
+		default:
+			return "", false
+		}
+	}
+}
+
+// refArg generates an argument for a reference parameter: a borrow of the
+// value, or the reference itself when it is a reference parameter of the
+// current function.
+func (g *generator) refArg(arg ir.Expr, argStr string, mutable bool, arrayRefParams map[string]bool) string {
+	if v, ok := arg.(*ir.VarRef); ok && arrayRefParams[v.Name] {
+		return argStr
+	}
+	if mutable {
+		return "&mut " + argStr
+	}
+	return "&" + argStr
+}
+
+// mutatedLocals returns the variables of body that must be bound mutably.
+func (g *generator) mutatedLocals(body []ir.Stmt) map[string]bool {
+	locals := make(map[string]bool)
+	for _, name := range mutatedVars(body, g.functions, g.modules, g.mutParams) {
+		locals[name] = true
+	}
+	return locals
+}
+
+// owned generates a value that is passed or bound by value. Intent values
+// stay usable after they are passed on, so a field or element whose type is
+// not Copy is cloned rather than moved out of, as is a variable that is
+// used again.
+func (g *generator) owned(e ir.Expr, s string) string {
+	if !place(e) || isCopy(e.ExprType()) {
+		return s
+	}
+	if v, ok := e.(*ir.VarRef); ok && !g.reused[v.Name] {
+		return s
+	}
+	return s + ".clone()"
+}
+
+// returned generates a value returned from a body whose postconditions
+// are checked afterwards. A variable that they refer to is still needed
+// by the check, so one whose type is not Copy is cloned rather than moved
+// into the result.
+func (g *generator) returned(e ir.Expr, s string) string {
+	if v, ok := e.(*ir.VarRef); ok && g.ensured[v.Name] && !isCopy(v.Type) {
+		return s + ".clone()"
+	}
+	return s
+}
+
+// contractVars returns the variables that contracts refer to.
+func contractVars(contracts []*ir.Contract) map[string]bool {
+	vars := make(map[string]bool)
+	for _, c := range contracts {
+		ir.WalkExpr(c.Expr, func(x ir.Expr) {
+			if v, ok := x.(*ir.VarRef); ok {
+				vars[v.Name] = true
+			}
+		})
+	}
+	return vars
+}
+
+// isCopy reports whether Rust copies values of type t implicitly.
+func isCopy(t *checker.Type) bool {
+	if t == nil {
+		return true
+	}
+	switch t.Name {
+	case "Int", "Float", "Bool", "Void":
+		return true
+	}
+	return false
+}
+
+// valueArg generates an argument passed by value.
+func (g *generator) valueArg(arg ir.Expr, arrayRefParams map[string]bool) string {
+	return g.owned(arg, g.generateExpr(arg, arrayRefParams))
+}
+
+// reusedVars returns the variables that a body and its contracts refer to
+// more than once, or inside a loop.
+func reusedVars(body []ir.Stmt, contracts ...[]*ir.Contract) map[string]bool {
+	count := make(map[string]int)
+	visit := func(e ir.Expr) {
+		ir.WalkExpr(e, func(x ir.Expr) {
+			if v, ok := x.(*ir.VarRef); ok {
+				count[v.Name]++
+			}
+		})
+	}
+	ir.WalkStmtExprs(body, visit)
+	for _, cs := range contracts {
+		for _, c := range cs {
+			visit(c.Expr)
+		}
+	}
+
+	reused := make(map[string]bool)
+	for name, n := range count {
+		if n > 1 {
+			reused[name] = true
+		}
+	}
+	ir.WalkStmts(body, func(s ir.Stmt) {
+		var loop []ir.Stmt
+		switch st := s.(type) {
+		case *ir.WhileStmt:
+			loop = st.Body
+		case *ir.ForInStmt:
+			loop = st.Body
+		}
+		ir.WalkStmtExprs(loop, func(e ir.Expr) {
+			ir.WalkExpr(e, func(x ir.Expr) {
+				if v, ok := x.(*ir.VarRef); ok {
+					reused[v.Name] = true
+				}
+			})
+		})
+	})
+	return reused
+}
@@ -0,0 +1,49 @@
+package rustbe
+
+import (
+	"fmt"
+
+	"github.com/lhaig/intent/internal/ir"
+	"github.com/lhaig/intent/internal/lexer"
+)
+
+// isInt reports whether e has type Int.
+func isInt(e ir.Expr) bool {
+	t := e.ExprType()
+	return t != nil && t.Name == "Int"
+}
+
+// checkedBinary generates Int arithmetic with checked_* operations for
+// Options.CheckedArith. Division and remainder test the divisor first so
+// that division by zero and overflow (MIN / -1) are reported separately.
+// The messages hold source text, so panic! takes them as an argument rather
+// than as its format string.
+func checkedBinary(e *ir.BinaryExpr, left, right string) (string, bool) {
+	overflow := arithMessage("Overflow", e, e.Line, e.Column)
+	switch e.Op {
+	case lexer.PLUS:
+		return fmt.Sprintf("(%s).checked_add(%s).expect(\"%s\")", left, right, overflow), true
+	case lexer.MINUS:
+		return fmt.Sprintf("(%s).checked_sub(%s).expect(\"%s\")", left, right, overflow), true
+	case lexer.STAR:
+		return fmt.Sprintf("(%s).checked_mul(%s).expect(\"%s\")", left, right, overflow), true
+	case lexer.SLASH, lexer.PERCENT:
+		method := "checked_div"
+		if e.Op == lexer.PERCENT {
+			method = "checked_rem"
+		}
+		return fmt.Sprintf("{ let (__l, __r): (i64, i64) = (%s, %s); if __r == 0 { panic!(\"{}\", \"%s\"); } __l.%s(__r).expect(\"%s\") }",
+			left, right, arithMessage("Division by zero", e, e.Line, e.Column), method, overflow), true
+	}
+	return "", false
+}
+
+// arithMessage is the failure message of a checked operation, e.g.
+// "Overflow check failed: a + b (line 3:14)".
+func arithMessage(kind string, e ir.Expr, line, col int) string {
+	msg := kind + " check failed: " + ir.FormatExpr(e)
+	if line > 0 {
+		msg += fmt.Sprintf(" (line %d:%d)", line, col)
+	}
+	return escapeRustString(msg)
+}
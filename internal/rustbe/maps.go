@@ -0,0 +1,83 @@
+package rustbe
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// A Map<K, V> is a std::collections::BTreeMap, which iterates in ascending
+// key order as the other backends do. Like arrays, maps are passed to
+// functions by reference. Loops iterate over a copy of the keys or entries,
+// so the body owns its loop variables and can modify the map.
+
+const btreeMap = "std::collections::BTreeMap"
+
+// isRefParam reports whether function parameters of type t are passed by
+// reference.
+func isRefParam(t *checker.Type) bool {
+	return t != nil && (t.Name == "Array" || checker.IsMap(t))
+}
+
+func isMap(e ir.Expr) bool {
+	return checker.IsMap(e.ExprType())
+}
+
+// place reports whether e names a variable, field or element, which is
+// cloned when it is passed or bound by value.
+func place(e ir.Expr) bool {
+	switch e.(type) {
+	case *ir.VarRef, *ir.FieldAccessExpr, *ir.IndexExpr:
+		return true
+	}
+	return false
+}
+
+// generateMapMethod generates a call to a built-in method of a map.
+func (g *generator) generateMapMethod(obj string, expr *ir.MethodCallExpr, arrayRefParams map[string]bool) string {
+	args := make([]string, len(expr.Args))
+	for i, arg := range expr.Args {
+		args[i] = g.generateExpr(arg, arrayRefParams)
+	}
+	switch expr.Method {
+	case "get":
+		return fmt.Sprintf("%s.get(&%s).cloned()", obj, args[0])
+	case "contains":
+		return fmt.Sprintf("%s.contains_key(&%s)", obj, args[0])
+	case "set":
+		return fmt.Sprintf("%s.insert(%s, %s)", obj, g.owned(expr.Args[0], args[0]), g.owned(expr.Args[1], args[1]))
+	case "remove":
+		return fmt.Sprintf("%s.remove(&%s)", obj, args[0])
+	case "keys":
+		return fmt.Sprintf("%s.keys().cloned().collect::<Vec<_>>()", obj)
+	case "values":
+		return fmt.Sprintf("%s.values().cloned().collect::<Vec<_>>()", obj)
+	}
+	return fmt.Sprintf("%s.%s(%s)", obj, expr.Method, strings.Join(args, ", "))
+}
+
+// generateMapForIn generates a for-in loop over the keys, or the keys and
+// values, of a map.
+func (g *generator) generateMapForIn(stmt *ir.ForInStmt, arrayRefParams map[string]bool) {
+	m := g.generateExpr(stmt.Iterable, arrayRefParams)
+	if stmt.ValueVariable != "" {
+		g.emitLinef("for (%s, %s) in %s.clone() {\n", stmt.Variable, stmt.ValueVariable, m)
+	} else {
+		g.emitLinef("for %s in %s.keys().cloned().collect::<Vec<_>>() {\n", stmt.Variable, m)
+	}
+	g.incIndent()
+	g.generateStmtsWithArrayRef(stmt.Body, arrayRefParams)
+	g.decIndent()
+	g.emitLine("}")
+}
+
+// quantifierDomain generates what a quantifier iterates over: a range, or
+// the keys of a map.
+func (g *generator) quantifierDomain(r *ir.RangeExpr, m ir.Expr, arrayRefParams map[string]bool) string {
+	if m != nil {
+		return fmt.Sprintf("%s.keys().cloned()", g.generateExpr(m, arrayRefParams))
+	}
+	return fmt.Sprintf("(%s..%s)", g.generateExpr(r.Start, arrayRefParams), g.generateExpr(r.End, arrayRefParams))
+}
@@ -10,17 +10,43 @@ import (
 	"github.com/lhaig/intent/internal/lexer"
 )
 
+// Options configures code generation. The zero value selects the defaults.
+type Options struct {
+	// CheckedArith makes Int arithmetic use checked_* operations, so that
+	// overflow and division by zero abort with a check failure naming the
+	// operation instead of wrapping silently.
+	CheckedArith bool
+	// DebugContracts emits contract checks with debug_assert!, so that they
+	// run in debug builds and compile away under --release. Clauses marked
+	// @always_check keep assert!.
+	DebugContracts bool
+}
+
 // Generate produces Rust source code from a single IR Module.
 func Generate(mod *ir.Module) string {
+	return GenerateWith(mod, Options{})
+}
+
+// GenerateWith produces Rust source code from a single IR Module using the
+// given options.
+func GenerateWith(mod *ir.Module, opts Options) string {
 	g := &generator{
-		entities:  make(map[string]*ir.Entity),
-		enums:     make(map[string]*ir.Enum),
-		functions: make(map[string]*ir.Function),
+		entities:       make(map[string]*ir.Entity),
+		enums:          make(map[string]*ir.Enum),
+		functions:      make(map[string]*ir.Function),
+		traits:         make(map[string]*ir.Trait),
+		typeNames:      make(map[string]string),
+		checkedArith:   opts.CheckedArith,
+		debugContracts: opts.DebugContracts,
+		mutParams:      mutRefParams([]*ir.Module{mod}),
 	}
 
 	for _, e := range mod.Entities {
 		g.entities[e.Name] = e
 	}
+	for _, t := range mod.Traits {
+		g.traits[t.Name] = t
+	}
 	for _, e := range mod.Enums {
 		g.enums[e.Name] = e
 	}
@@ -32,6 +58,10 @@ func Generate(mod *ir.Module) string {
 	g.emitLine("#![allow(unused_parens, unused_variables, dead_code)]")
 	g.emitLine("")
 
+	for _, t := range mod.Traits {
+		g.generateTrait(t)
+		g.emitLine("")
+	}
 	for _, e := range mod.Entities {
 		g.generateEntity(e)
 		g.emitLine("")
@@ -54,6 +84,12 @@ func Generate(mod *ir.Module) string {
 
 // GenerateAll produces Rust source from a multi-file IR Program.
 func GenerateAll(prog *ir.Program) string {
+	return GenerateAllWith(prog, Options{})
+}
+
+// GenerateAllWith produces Rust source from a multi-file IR Program using
+// the given options.
+func GenerateAllWith(prog *ir.Program, opts Options) string {
 	if len(prog.Modules) == 0 {
 		return ""
 	}
@@ -66,34 +102,67 @@ func GenerateAll(prog *ir.Program) string {
 		}
 	}
 
+	// Entities, enums and traits are visible from the modules that import
+	// them, so every module sees every type under its mangled name. The
+	// checker keeps type names unique across a program.
+	entities := make(map[string]*ir.Entity)
+	enums := make(map[string]*ir.Enum)
+	traits := make(map[string]*ir.Trait)
+	typeNames := make(map[string]string)
+	modules := make(map[string]map[string]*ir.Function)
+	for _, mod := range prog.Modules {
+		prefix := ""
+		if !mod.IsEntry {
+			prefix = strings.ToUpper(mod.Name[:1]) + mod.Name[1:]
+		}
+		for _, e := range mod.Entities {
+			entities[e.Name] = e
+			typeNames[e.Name] = prefix + e.Name
+		}
+		for _, e := range mod.Enums {
+			enums[e.Name] = e
+			typeNames[e.Name] = prefix + e.Name
+		}
+		for _, t := range mod.Traits {
+			traits[t.Name] = t
+			typeNames[t.Name] = prefix + t.Name
+		}
+		functions := make(map[string]*ir.Function)
+		for _, f := range mod.Functions {
+			functions[f.Name] = f
+		}
+		modules[mod.Name] = functions
+	}
+
+	mutParams := mutRefParams(prog.Modules)
+
 	var sb strings.Builder
 	sb.WriteString("// Generated Rust code from Intent (multi-file)\n")
 	sb.WriteString("#![allow(unused_parens, unused_variables, dead_code)]\n\n")
 
 	for _, mod := range prog.Modules {
 		g := &generator{
-			entities:        make(map[string]*ir.Entity),
-			enums:           make(map[string]*ir.Enum),
-			functions:       make(map[string]*ir.Function),
+			entities:        entities,
+			enums:           enums,
+			functions:       modules[mod.Name],
+			traits:          traits,
+			typeNames:       typeNames,
+			modules:         modules,
+			mutParams:       mutParams,
 			isEntryFile:     mod.IsEntry,
 			moduleManglings: moduleManglings,
+			checkedArith:    opts.CheckedArith,
+			debugContracts:  opts.DebugContracts,
 		}
 
 		if !mod.IsEntry {
 			g.namePrefix = mod.Name + "_"
-			g.structPrefix = strings.ToUpper(mod.Name[:1]) + mod.Name[1:]
 		}
 
-		for _, e := range mod.Entities {
-			g.entities[e.Name] = e
-		}
-		for _, e := range mod.Enums {
-			g.enums[e.Name] = e
-		}
-		for _, f := range mod.Functions {
-			g.functions[f.Name] = f
+		for _, t := range mod.Traits {
+			g.generateTrait(t)
+			g.emitLine("")
 		}
-
 		for _, e := range mod.Entities {
 			g.generateEntity(e)
 			g.emitLine("")
@@ -119,15 +188,24 @@ type generator struct {
 	entities       map[string]*ir.Entity
 	enums          map[string]*ir.Enum
 	functions      map[string]*ir.Function
+	traits         map[string]*ir.Trait
+	typeNames      map[string]string // mangled name of each entity, enum and trait
 	inConstructor  bool
 	inLabeledBlock bool
 	ensuresContext bool
+	checkedArith   bool
+	debugContracts bool
 
 	// Multi-file fields
 	namePrefix      string
-	structPrefix    string
 	isEntryFile     bool
 	moduleManglings map[string]string
+	modules         map[string]map[string]*ir.Function // functions of each module
+
+	mutParams map[*ir.Function]map[string]bool // reference parameters taken as &mut
+	mutLocals map[string]bool                  // variables of the current body bound mutably
+	reused    map[string]bool                  // variables of the current body used more than once
+	ensured   map[string]bool                  // variables the current postconditions refer to
 }
 
 func (g *generator) emit(s string) {
@@ -166,6 +244,9 @@ func (g *generator) mapType(t *checker.Type) string {
 	if t == nil {
 		return "()"
 	}
+	if t.IsTrait {
+		return "Box<dyn " + g.typeName(t.Name) + ">"
+	}
 	switch t.Name {
 	case "Int":
 		return "i64"
@@ -182,6 +263,11 @@ func (g *generator) mapType(t *checker.Type) string {
 			return "Vec<" + g.mapType(t.TypeParams[0]) + ">"
 		}
 		return "Vec<_>"
+	case "Map":
+		if checker.IsMap(t) {
+			return btreeMap + "<" + g.mapType(t.TypeParams[0]) + ", " + g.mapType(t.TypeParams[1]) + ">"
+		}
+		return btreeMap + "<_, _>"
 	case "Result":
 		if t.IsGeneric && len(t.TypeParams) == 2 {
 			return "Result<" + g.mapType(t.TypeParams[0]) + ", " + g.mapType(t.TypeParams[1]) + ">"
@@ -193,7 +279,7 @@ func (g *generator) mapType(t *checker.Type) string {
 		}
 		return "Option<_>"
 	default:
-		return t.Name
+		return g.typeName(t.Name)
 	}
 }
 
@@ -212,32 +298,46 @@ func (g *generator) defaultValue(t *checker.Type) string {
 		return "false"
 	case "Array":
 		return "Vec::new()"
+	case "Map":
+		return btreeMap + "::new()"
 	default:
 		if t.IsEnum && t.EnumInfo != nil {
 			// Use the first unit variant as default
 			for _, v := range t.EnumInfo.Variants {
 				if len(v.Fields) == 0 {
-					return fmt.Sprintf("%s::%s", g.mangledEnumName(t.Name), v.Name)
+					return fmt.Sprintf("%s::%s", g.typeName(t.Name), v.Name)
 				}
 			}
 		}
 		if t.IsEntity {
-			return fmt.Sprintf("%s { /* default fields */ }", g.mangledEntityName(t.Name))
+			return fmt.Sprintf("%s { /* default fields */ }", g.typeName(t.Name))
 		}
 		return fmt.Sprintf("%s { /* default fields */ }", t.Name)
 	}
 }
 
-func (g *generator) mangledEntityName(name string) string {
-	if g.structPrefix != "" {
-		return g.structPrefix + name
+// isInstance reports whether name is a monomorphized instance of a generic
+// declaration, such as max__Int or Stack__String, which Rust's naming lints
+// would otherwise warn about
+func isInstance(name string) bool {
+	return strings.Contains(name, "__")
+}
+
+// typeName returns the name an entity, enum or trait is declared under in
+// the generated code. In multi-file builds that carries the prefix of its
+// module, wherever it is referred to from.
+func (g *generator) typeName(name string) string {
+	if mangled, ok := g.typeNames[name]; ok {
+		return mangled
 	}
 	return name
 }
 
-func (g *generator) mangledEnumName(name string) string {
-	if g.structPrefix != "" {
-		return g.structPrefix + name
+// funcName returns the name a function of the current module is declared
+// under in the generated code.
+func (g *generator) funcName(name string) string {
+	if _, ok := g.functions[name]; ok {
+		return g.namePrefix + name
 	}
 	return name
 }
@@ -245,6 +345,9 @@ func (g *generator) mangledEnumName(name string) string {
 // --- Function generation ---
 
 func (g *generator) generateFunction(f *ir.Function) {
+	g.mutLocals = g.mutatedLocals(f.Body)
+	g.reused = reusedVars(f.Body, f.Requires, f.Ensures)
+	g.ensured = contractVars(f.Ensures)
 	if f.IsEntry {
 		g.emitLine("fn __intent_main() -> i64 {")
 		g.incIndent()
@@ -262,7 +365,7 @@ func (g *generator) generateFunction(f *ir.Function) {
 		// Track array params for reference passing
 		arrayRefParams := make(map[string]bool)
 		for _, p := range f.Params {
-			if p.Type != nil && p.Type.Name == "Array" {
+			if isRefParam(p.Type) {
 				arrayRefParams[p.Name] = true
 			}
 		}
@@ -272,24 +375,32 @@ func (g *generator) generateFunction(f *ir.Function) {
 			fnName = g.namePrefix + f.Name
 		}
 
+		if isInstance(f.Name) {
+			g.emitLine("#[allow(non_snake_case)]")
+		}
+		if hasTraitParam(f.Params) {
+			g.emitLine("#[allow(unused_mut)]")
+		}
 		g.emitLinef("fn %s(", fnName)
 		for i, p := range f.Params {
 			if i > 0 {
 				g.emit(", ")
 			}
 			paramType := g.mapType(p.Type)
-			if p.Type != nil && p.Type.Name == "Array" {
+			if g.mutParams[f][p.Name] {
+				paramType = "&mut " + paramType
+			} else if isRefParam(p.Type) {
 				paramType = "&" + paramType
 			}
-			g.emitf("%s: %s", p.Name, paramType)
+			g.emitf("%s%s: %s", paramMut(p), p.Name, paramType)
 		}
 		g.emitf(") -> %s {\n", g.mapType(f.ReturnType))
 		g.incIndent()
 
 		// Requires
 		for _, req := range f.Requires {
-			g.emitLinef("assert!(%s, \"Precondition failed: %s\");\n",
-				g.generateExpr(req.Expr, arrayRefParams), escapeRustString(req.RawText))
+			g.emitLinef("%s!(%s, \"Precondition failed: %s\");\n",
+				g.assertMacro(req), g.generateExpr(req.Expr, arrayRefParams), escapeRustFormat(req.RawText))
 		}
 
 		// Ensures with labeled block
@@ -306,8 +417,8 @@ func (g *generator) generateFunction(f *ir.Function) {
 
 			g.ensuresContext = true
 			for _, ens := range f.Ensures {
-				g.emitLinef("assert!(%s, \"Postcondition failed: %s\");\n",
-					g.generateExpr(ens.Expr, arrayRefParams), escapeRustString(ens.RawText))
+				g.emitLinef("%s!(%s, \"Postcondition failed: %s\");\n",
+					g.assertMacro(ens), g.generateExpr(ens.Expr, arrayRefParams), escapeRustFormat(ens.RawText))
 			}
 			g.ensuresContext = false
 			g.emitLine("__result")
@@ -317,8 +428,8 @@ func (g *generator) generateFunction(f *ir.Function) {
 			if len(f.Ensures) > 0 {
 				g.ensuresContext = true
 				for _, ens := range f.Ensures {
-					g.emitLinef("assert!(%s, \"Postcondition failed: %s\");\n",
-						g.generateExpr(ens.Expr, arrayRefParams), escapeRustString(ens.RawText))
+					g.emitLinef("%s!(%s, \"Postcondition failed: %s\");\n",
+						g.assertMacro(ens), g.generateExpr(ens.Expr, arrayRefParams), escapeRustFormat(ens.RawText))
 				}
 				g.ensuresContext = false
 			}
@@ -332,8 +443,11 @@ func (g *generator) generateFunction(f *ir.Function) {
 // --- Entity generation ---
 
 func (g *generator) generateEntity(e *ir.Entity) {
-	mangledName := g.mangledEntityName(e.Name)
+	mangledName := g.typeName(e.Name)
 
+	if isInstance(e.Name) {
+		g.emitLine("#[allow(non_camel_case_types)]")
+	}
 	g.emitLine("#[derive(Clone, Debug)]")
 	g.emitLinef("struct %s {\n", mangledName)
 	g.incIndent()
@@ -351,8 +465,8 @@ func (g *generator) generateEntity(e *ir.Entity) {
 		g.emitLine("fn __check_invariants(&self) {")
 		g.incIndent()
 		for _, inv := range e.Invariants {
-			g.emitLinef("assert!(%s, \"Invariant failed: %s\");\n",
-				g.generateExpr(inv.Expr, nil), escapeRustString(inv.RawText))
+			g.emitLinef("%s!(%s, \"Invariant failed: %s\");\n",
+				g.assertMacro(inv), g.generateExpr(inv.Expr, nil), escapeRustFormat(inv.RawText))
 		}
 		g.decIndent()
 		g.emitLine("}")
@@ -371,10 +485,113 @@ func (g *generator) generateEntity(e *ir.Entity) {
 
 	g.decIndent()
 	g.emitLine("}")
+
+	for _, name := range e.Implements {
+		g.emitLine("")
+		g.generateTraitImpl(e, name)
+	}
+}
+
+// generateTrait emits a trait as a Rust trait used through Box<dyn Trait>.
+// Methods take &mut self like entity methods. __clone_box lets trait values
+// be cloned, as entities are, so they can be stored in arrays and fields.
+func (g *generator) generateTrait(t *ir.Trait) {
+	name := g.typeName(t.Name)
+	g.emitLinef("trait %s: std::fmt::Debug {\n", name)
+	g.incIndent()
+	for _, m := range t.Methods {
+		g.emitLinef("%s;\n", g.methodSignature(m))
+	}
+	g.emitLinef("fn __clone_box(&self) -> Box<dyn %s>;\n", name)
+	g.decIndent()
+	g.emitLine("}")
+	g.emitLine("")
+	g.emitLinef("impl Clone for Box<dyn %s> {\n", name)
+	g.incIndent()
+	g.emitLine("fn clone(&self) -> Self {")
+	g.incIndent()
+	g.emitLine("self.__clone_box()")
+	g.decIndent()
+	g.emitLine("}")
+	g.decIndent()
+	g.emitLine("}")
+}
+
+// generateTraitImpl implements a trait for an entity by forwarding each
+// trait method to the entity's own method, which checks its contracts.
+func (g *generator) generateTraitImpl(e *ir.Entity, trait string) {
+	mangledName := g.typeName(e.Name)
+	name := g.typeName(trait)
+	g.emitLinef("impl %s for %s {\n", name, mangledName)
+	g.incIndent()
+	for _, m := range e.Methods {
+		if !g.traitHasMethod(trait, m.Name) {
+			continue
+		}
+		args := []string{"self"}
+		for _, p := range m.Params {
+			args = append(args, p.Name)
+		}
+		g.emitLinef("%s {\n", g.methodSignature(m))
+		g.incIndent()
+		g.emitLinef("%s::%s(%s)\n", mangledName, m.Name, strings.Join(args, ", "))
+		g.decIndent()
+		g.emitLine("}")
+	}
+	g.emitLinef("fn __clone_box(&self) -> Box<dyn %s> {\n", name)
+	g.incIndent()
+	g.emitLine("Box::new(self.clone())")
+	g.decIndent()
+	g.emitLine("}")
+	g.decIndent()
+	g.emitLine("}")
+}
+
+// methodSignature renders the signature of a method, without its body
+func (g *generator) methodSignature(m *ir.Method) string {
+	sig := "fn " + m.Name + "(&mut self"
+	for _, p := range m.Params {
+		sig += fmt.Sprintf(", %s: %s", p.Name, g.mapType(p.Type))
+	}
+	sig += ")"
+	if m.ReturnType != nil && m.ReturnType.Name != "Void" {
+		sig += " -> " + g.mapType(m.ReturnType)
+	}
+	return sig
+}
+
+// traitHasMethod reports whether the trait declares a method called name
+func (g *generator) traitHasMethod(trait, name string) bool {
+	if t, ok := g.traits[trait]; ok {
+		for _, m := range t.Methods {
+			if m.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasTraitParam reports whether any parameter is a trait value. Those are
+// bound mutably so that their methods, which take &mut self, can be called.
+func hasTraitParam(params []*ir.Param) bool {
+	for _, p := range params {
+		if p.Type != nil && p.Type.IsTrait {
+			return true
+		}
+	}
+	return false
+}
+
+func paramMut(p *ir.Param) string {
+	if p.Type != nil && p.Type.IsTrait {
+		return "mut "
+	}
+	return ""
 }
 
 func (g *generator) generateConstructor(e *ir.Entity) {
-	mangledName := g.mangledEntityName(e.Name)
+	mangledName := g.typeName(e.Name)
 	ctor := e.Constructor
 
 	g.emitLinef("fn new(")
@@ -389,8 +606,8 @@ func (g *generator) generateConstructor(e *ir.Entity) {
 
 	// Requires
 	for _, req := range ctor.Requires {
-		g.emitLinef("assert!(%s, \"Precondition failed: %s\");\n",
-			g.generateExpr(req.Expr, nil), escapeRustString(req.RawText))
+		g.emitLinef("%s!(%s, \"Precondition failed: %s\");\n",
+			g.assertMacro(req), g.generateExpr(req.Expr, nil), escapeRustFormat(req.RawText))
 	}
 
 	// Initialize with defaults
@@ -404,13 +621,15 @@ func (g *generator) generateConstructor(e *ir.Entity) {
 
 	// Body
 	g.inConstructor = true
+	g.mutLocals = g.mutatedLocals(ctor.Body)
+	g.reused = reusedVars(ctor.Body, ctor.Requires, ctor.Ensures)
 	g.generateStmts(ctor.Body)
 
 	// Ensures
 	g.ensuresContext = true
 	for _, ens := range ctor.Ensures {
-		g.emitLinef("assert!(%s, \"Postcondition failed: %s\");\n",
-			g.generateExpr(ens.Expr, nil), escapeRustString(ens.RawText))
+		g.emitLinef("%s!(%s, \"Postcondition failed: %s\");\n",
+			g.assertMacro(ens), g.generateExpr(ens.Expr, nil), escapeRustFormat(ens.RawText))
 	}
 	g.ensuresContext = false
 	g.inConstructor = false
@@ -426,15 +645,21 @@ func (g *generator) generateConstructor(e *ir.Entity) {
 }
 
 func (g *generator) generateMethod(e *ir.Entity, m *ir.Method) {
+	if hasTraitParam(m.Params) {
+		g.emitLine("#[allow(unused_mut)]")
+	}
 	g.emitLinef("fn %s(&mut self", m.Name)
 	for _, p := range m.Params {
-		g.emitf(", %s: %s", p.Name, g.mapType(p.Type))
+		g.emitf(", %s%s: %s", paramMut(p), p.Name, g.mapType(p.Type))
 	}
 	if m.ReturnType == nil || m.ReturnType.Name == "Void" {
 		g.emit(") {\n")
 	} else {
 		g.emitf(") -> %s {\n", g.mapType(m.ReturnType))
 	}
+	g.mutLocals = g.mutatedLocals(m.Body)
+	g.reused = reusedVars(m.Body, m.Requires, m.Ensures)
+	g.ensured = contractVars(m.Ensures)
 	g.incIndent()
 
 	// Old captures
@@ -444,8 +669,8 @@ func (g *generator) generateMethod(e *ir.Entity, m *ir.Method) {
 
 	// Requires
 	for _, req := range m.Requires {
-		g.emitLinef("assert!(%s, \"Precondition failed: %s\");\n",
-			g.generateExpr(req.Expr, nil), escapeRustString(req.RawText))
+		g.emitLinef("%s!(%s, \"Precondition failed: %s\");\n",
+			g.assertMacro(req), g.generateExpr(req.Expr, nil), escapeRustFormat(req.RawText))
 	}
 
 	// Labeled block for non-Void methods with ensures/invariants
@@ -463,8 +688,8 @@ func (g *generator) generateMethod(e *ir.Entity, m *ir.Method) {
 
 		g.ensuresContext = true
 		for _, ens := range m.Ensures {
-			g.emitLinef("assert!(%s, \"Postcondition failed: %s\");\n",
-				g.generateExpr(ens.Expr, nil), escapeRustString(ens.RawText))
+			g.emitLinef("%s!(%s, \"Postcondition failed: %s\");\n",
+				g.assertMacro(ens), g.generateExpr(ens.Expr, nil), escapeRustFormat(ens.RawText))
 		}
 		g.ensuresContext = false
 
@@ -479,8 +704,8 @@ func (g *generator) generateMethod(e *ir.Entity, m *ir.Method) {
 		if len(m.Ensures) > 0 {
 			g.ensuresContext = true
 			for _, ens := range m.Ensures {
-				g.emitLinef("assert!(%s, \"Postcondition failed: %s\");\n",
-					g.generateExpr(ens.Expr, nil), escapeRustString(ens.RawText))
+				g.emitLinef("%s!(%s, \"Postcondition failed: %s\");\n",
+					g.assertMacro(ens), g.generateExpr(ens.Expr, nil), escapeRustFormat(ens.RawText))
 			}
 			g.ensuresContext = false
 		}
@@ -497,8 +722,11 @@ func (g *generator) generateMethod(e *ir.Entity, m *ir.Method) {
 // --- Enum generation ---
 
 func (g *generator) generateEnumDecl(e *ir.Enum) {
-	mangledName := g.mangledEnumName(e.Name)
+	mangledName := g.typeName(e.Name)
 
+	if isInstance(e.Name) {
+		g.emitLine("#[allow(non_camel_case_types)]")
+	}
 	g.emitLine("#[derive(Clone, Debug)]")
 	g.emitLinef("enum %s {\n", mangledName)
 	g.incIndent()
@@ -562,17 +790,8 @@ func (g *generator) generateStmtsWithArrayRef(stmts []ir.Stmt, arrayRefParams ma
 func (g *generator) generateStmt(s ir.Stmt, arrayRefParams map[string]bool) {
 	switch stmt := s.(type) {
 	case *ir.LetStmt:
-		isMut := stmt.Mutable || g.isEntityType(stmt.Type)
-		valueExpr := g.generateExpr(stmt.Value, arrayRefParams)
-
-		// Clone array ref params when binding
-		if stmt.Type != nil && stmt.Type.Name == "Array" {
-			if vr, ok := stmt.Value.(*ir.VarRef); ok {
-				if arrayRefParams != nil && arrayRefParams[vr.Name] {
-					valueExpr = valueExpr + ".clone()"
-				}
-			}
-		}
+		isMut := stmt.Mutable || g.mutLocals[stmt.Name] || g.isEntityType(stmt.Type) || (stmt.Type != nil && stmt.Type.IsTrait)
+		valueExpr := g.valueArg(stmt.Value, arrayRefParams)
 
 		if isMut {
 			g.emitLinef("let mut %s: %s = %s;\n",
@@ -585,12 +804,12 @@ func (g *generator) generateStmt(s ir.Stmt, arrayRefParams map[string]bool) {
 	case *ir.AssignStmt:
 		g.emitLinef("%s = %s;\n",
 			g.generateExpr(stmt.Target, arrayRefParams),
-			g.generateExpr(stmt.Value, arrayRefParams))
+			g.valueArg(stmt.Value, arrayRefParams))
 
 	case *ir.ReturnStmt:
 		if g.inLabeledBlock {
 			if stmt.Value != nil {
-				g.emitLinef("break 'body %s;\n", g.generateExpr(stmt.Value, arrayRefParams))
+				g.emitLinef("break 'body %s;\n", g.returned(stmt.Value, g.generateExpr(stmt.Value, arrayRefParams)))
 			} else {
 				g.emitLine("break 'body;")
 			}
@@ -676,8 +895,8 @@ func (g *generator) generateWhileStmt(stmt *ir.WhileStmt, arrayRefParams map[str
 		savedEnsures := g.ensuresContext
 		g.ensuresContext = true
 		for _, inv := range stmt.Invariants {
-			g.emitLinef("assert!(%s, \"Loop invariant failed at entry: %s\");\n",
-				g.generateExpr(inv.Expr, arrayRefParams), escapeRustString(inv.RawText))
+			g.emitLinef("%s!(%s, \"Loop invariant failed at entry: %s\");\n",
+				g.assertMacro(inv), g.generateExpr(inv.Expr, arrayRefParams), escapeRustFormat(inv.RawText))
 		}
 		g.ensuresContext = savedEnsures
 
@@ -685,8 +904,8 @@ func (g *generator) generateWhileStmt(stmt *ir.WhileStmt, arrayRefParams map[str
 		if stmt.Decreases != nil {
 			metricExpr := g.generateExpr(stmt.Decreases.Expr, arrayRefParams)
 			g.emitLinef("let mut __decreases_prev: i64 = %s;\n", metricExpr)
-			g.emitLinef("assert!(__decreases_prev >= 0, \"Decreases metric must be non-negative at entry: %s\");\n",
-				escapeRustString(stmt.Decreases.RawText))
+			g.emitLinef("%s!(__decreases_prev >= 0, \"Decreases metric must be non-negative at entry: %s\");\n",
+				g.assertMacro(nil), escapeRustFormat(stmt.Decreases.RawText))
 		}
 
 		g.emitLinef("while %s {\n", g.generateExpr(stmt.Condition, arrayRefParams))
@@ -697,8 +916,8 @@ func (g *generator) generateWhileStmt(stmt *ir.WhileStmt, arrayRefParams map[str
 		// Check invariants after iteration
 		g.ensuresContext = true
 		for _, inv := range stmt.Invariants {
-			g.emitLinef("assert!(%s, \"Loop invariant failed after iteration: %s\");\n",
-				g.generateExpr(inv.Expr, arrayRefParams), escapeRustString(inv.RawText))
+			g.emitLinef("%s!(%s, \"Loop invariant failed after iteration: %s\");\n",
+				g.assertMacro(inv), g.generateExpr(inv.Expr, arrayRefParams), escapeRustFormat(inv.RawText))
 		}
 		g.ensuresContext = savedEnsures
 
@@ -706,10 +925,10 @@ func (g *generator) generateWhileStmt(stmt *ir.WhileStmt, arrayRefParams map[str
 		if stmt.Decreases != nil {
 			metricExpr := g.generateExpr(stmt.Decreases.Expr, arrayRefParams)
 			g.emitLinef("let __decreases_next: i64 = %s;\n", metricExpr)
-			g.emitLinef("assert!(__decreases_next < __decreases_prev, \"Termination metric did not decrease: %s\");\n",
-				escapeRustString(stmt.Decreases.RawText))
-			g.emitLinef("assert!(__decreases_next >= 0, \"Termination metric became negative: %s\");\n",
-				escapeRustString(stmt.Decreases.RawText))
+			g.emitLinef("%s!(__decreases_next < __decreases_prev, \"Termination metric did not decrease: %s\");\n",
+				g.assertMacro(nil), escapeRustFormat(stmt.Decreases.RawText))
+			g.emitLinef("%s!(__decreases_next >= 0, \"Termination metric became negative: %s\");\n",
+				g.assertMacro(nil), escapeRustFormat(stmt.Decreases.RawText))
 			g.emitLine("__decreases_prev = __decreases_next;")
 		}
 
@@ -728,6 +947,22 @@ func (g *generator) generateWhileStmt(stmt *ir.WhileStmt, arrayRefParams map[str
 }
 
 func (g *generator) generateForInStmt(stmt *ir.ForInStmt, arrayRefParams map[string]bool) {
+	// Trait values are iterated by value so that their methods can be called
+	if t := stmt.Iterable.ExprType(); t != nil && t.Name == "Array" && len(t.TypeParams) == 1 && t.TypeParams[0].IsTrait {
+		g.emitLine("#[allow(unused_mut)]")
+		g.emitLinef("for mut %s in %s.clone() {\n", stmt.Variable, g.generateExpr(stmt.Iterable, arrayRefParams))
+		g.incIndent()
+		g.generateStmtsWithArrayRef(stmt.Body, arrayRefParams)
+		g.decIndent()
+		g.emitLine("}")
+		return
+	}
+
+	if isMap(stmt.Iterable) {
+		g.generateMapForIn(stmt, arrayRefParams)
+		return
+	}
+
 	g.emit(g.indentStr())
 	g.emitf("for %s in ", stmt.Variable)
 
@@ -772,6 +1007,12 @@ func (g *generator) generateExpr(e ir.Expr, arrayRefParams map[string]bool) stri
 			return fmt.Sprintf("(!%s || %s)", left, right)
 		}
 
+		if g.checkedArith && isInt(expr.Left) {
+			if checked, ok := checkedBinary(expr, left, right); ok {
+				return checked
+			}
+		}
+
 		return fmt.Sprintf("(%s %s %s)", left, op, right)
 
 	case *ir.StringConcat:
@@ -784,6 +1025,9 @@ func (g *generator) generateExpr(e ir.Expr, arrayRefParams map[string]bool) stri
 		if expr.Op == lexer.NOT {
 			return fmt.Sprintf("!%s", operand)
 		}
+		if _, isLit := expr.Operand.(*ir.IntLit); g.checkedArith && !isLit && isInt(expr.Operand) {
+			return fmt.Sprintf("(%s).checked_neg().expect(\"%s\")", operand, arithMessage("Overflow", expr, expr.Line, expr.Column))
+		}
 		return fmt.Sprintf("-%s", operand)
 
 	case *ir.CallExpr:
@@ -796,6 +1040,9 @@ func (g *generator) generateExpr(e ir.Expr, arrayRefParams map[string]bool) stri
 		obj := g.generateExpr(expr.Object, arrayRefParams)
 		return fmt.Sprintf("%s.%s", obj, expr.Field)
 
+	case *ir.UpcastExpr:
+		return fmt.Sprintf("(Box::new(%s) as %s)", g.generateExpr(expr.Value, arrayRefParams), g.mapType(expr.Type))
+
 	case *ir.OldRef:
 		return expr.Name
 
@@ -835,7 +1082,7 @@ func (g *generator) generateExpr(e ir.Expr, arrayRefParams map[string]bool) stri
 		}
 		elems := make([]string, len(expr.Elements))
 		for i, el := range expr.Elements {
-			elems[i] = g.generateExpr(el, arrayRefParams)
+			elems[i] = g.valueArg(el, arrayRefParams)
 		}
 		return fmt.Sprintf("vec![%s]", strings.Join(elems, ", "))
 
@@ -877,26 +1124,23 @@ func (g *generator) generateCallExpr(expr *ir.CallExpr, arrayRefParams map[strin
 	case ir.CallConstructor:
 		args := make([]string, len(expr.Args))
 		for i, arg := range expr.Args {
-			args[i] = g.generateExpr(arg, arrayRefParams)
+			args[i] = g.valueArg(arg, arrayRefParams)
 		}
-		return fmt.Sprintf("%s::new(%s)", expr.Function, strings.Join(args, ", "))
+		return fmt.Sprintf("%s::new(%s)", g.typeName(expr.Function), strings.Join(args, ", "))
 
 	default: // CallFunction
 		args := make([]string, len(expr.Args))
 		funcDef := g.functions[expr.Function]
 		for i, arg := range expr.Args {
-			argStr := g.generateExpr(arg, arrayRefParams)
-			// Pass arrays by reference
-			if funcDef != nil && i < len(funcDef.Params) {
-				if funcDef.Params[i].Type != nil && funcDef.Params[i].Type.Name == "Array" {
-					if _, ok := arg.(*ir.VarRef); ok {
-						argStr = "&" + argStr
-					}
-				}
+			// Pass arrays and maps by reference
+			if funcDef != nil && i < len(funcDef.Params) && isRefParam(funcDef.Params[i].Type) {
+				p := funcDef.Params[i]
+				args[i] = g.refArg(arg, g.generateExpr(arg, arrayRefParams), g.mutParams[funcDef][p.Name], arrayRefParams)
+			} else {
+				args[i] = g.valueArg(arg, arrayRefParams)
 			}
-			args[i] = argStr
 		}
-		return fmt.Sprintf("%s(%s)", expr.Function, strings.Join(args, ", "))
+		return fmt.Sprintf("%s(%s)", g.funcName(expr.Function), strings.Join(args, ", "))
 	}
 }
 
@@ -914,11 +1158,13 @@ func (g *generator) generateBuiltinCall(expr *ir.CallExpr, arrayRefParams map[st
 		}
 	case "Ok", "Err", "Some":
 		if len(expr.Args) == 1 {
-			arg := g.generateExpr(expr.Args[0], arrayRefParams)
+			arg := g.valueArg(expr.Args[0], arrayRefParams)
 			return fmt.Sprintf("%s(%s)", expr.Function, arg)
 		}
 	case "None":
 		return "None"
+	case "Map":
+		return btreeMap + "::new()"
 	}
 	// Fallback
 	args := make([]string, len(expr.Args))
@@ -944,12 +1190,12 @@ func (g *generator) generateVariantConstructor(expr *ir.CallExpr, arrayRefParams
 
 	// Unit variant
 	if variant == nil || len(variant.Fields) == 0 {
-		return fmt.Sprintf("%s::%s", enumName, expr.Function)
+		return fmt.Sprintf("%s::%s", g.typeName(enumName), expr.Function)
 	}
 
 	// Data variant
 	var sb strings.Builder
-	sb.WriteString(enumName)
+	sb.WriteString(g.typeName(enumName))
 	sb.WriteString("::")
 	sb.WriteString(expr.Function)
 	sb.WriteString(" { ")
@@ -959,7 +1205,7 @@ func (g *generator) generateVariantConstructor(expr *ir.CallExpr, arrayRefParams
 		}
 		sb.WriteString(f.Name)
 		sb.WriteString(": ")
-		sb.WriteString(g.generateExpr(expr.Args[i], arrayRefParams))
+		sb.WriteString(g.valueArg(expr.Args[i], arrayRefParams))
 	}
 	sb.WriteString(" }")
 	return sb.String()
@@ -969,23 +1215,18 @@ func (g *generator) generateMethodCallExpr(expr *ir.MethodCallExpr, arrayRefPara
 	// Module-qualified calls
 	if expr.IsModuleCall && g.moduleManglings != nil {
 		args := make([]string, len(expr.Args))
-		funcDecl := g.functions[expr.Method]
+		funcDecl := g.modules[expr.ModuleName][expr.Method]
 		for i, arg := range expr.Args {
-			argStr := g.generateExpr(arg, arrayRefParams)
-			if funcDecl != nil && i < len(funcDecl.Params) {
-				if funcDecl.Params[i].Type != nil && funcDecl.Params[i].Type.Name == "Array" {
-					if _, ok := arg.(*ir.VarRef); ok {
-						argStr = "&" + argStr
-					}
-				}
+			if funcDecl != nil && i < len(funcDecl.Params) && isRefParam(funcDecl.Params[i].Type) {
+				p := funcDecl.Params[i]
+				args[i] = g.refArg(arg, g.generateExpr(arg, arrayRefParams), g.mutParams[funcDecl][p.Name], arrayRefParams)
+			} else {
+				args[i] = g.valueArg(arg, arrayRefParams)
 			}
-			args[i] = argStr
 		}
 
 		if expr.CallKind == ir.CallConstructor {
-			modPrefix := strings.ToUpper(expr.ModuleName[:1]) + expr.ModuleName[1:]
-			mangledStructName := modPrefix + expr.Method
-			return fmt.Sprintf("%s::new(%s)", mangledStructName, strings.Join(args, ", "))
+			return fmt.Sprintf("%s::new(%s)", g.typeName(expr.Method), strings.Join(args, ", "))
 		}
 
 		mangledFnName := expr.ModuleName + "_" + expr.Method
@@ -993,6 +1234,9 @@ func (g *generator) generateMethodCallExpr(expr *ir.MethodCallExpr, arrayRefPara
 	}
 
 	obj := g.generateExpr(expr.Object, arrayRefParams)
+	if isMap(expr.Object) {
+		return g.generateMapMethod(obj, expr, arrayRefParams)
+	}
 
 	// Result/Option predicate methods
 	if expr.Method == "is_ok" || expr.Method == "is_err" || expr.Method == "is_some" || expr.Method == "is_none" {
@@ -1001,43 +1245,41 @@ func (g *generator) generateMethodCallExpr(expr *ir.MethodCallExpr, arrayRefPara
 
 	args := make([]string, len(expr.Args))
 	for i, arg := range expr.Args {
-		args[i] = g.generateExpr(arg, arrayRefParams)
+		args[i] = g.valueArg(arg, arrayRefParams)
 	}
 	return fmt.Sprintf("%s.%s(%s)", obj, expr.Method, strings.Join(args, ", "))
 }
 
 func (g *generator) generateForallExpr(expr *ir.ForallExpr, arrayRefParams map[string]bool) string {
-	rangeStart := g.generateExpr(expr.Domain.Start, arrayRefParams)
-	rangeEnd := g.generateExpr(expr.Domain.End, arrayRefParams)
+	domain := g.quantifierDomain(expr.Domain, expr.Map, arrayRefParams)
 	body := g.generateExpr(expr.Body, arrayRefParams)
 
 	return fmt.Sprintf("{\n"+
 		"    let mut __forall_holds = true;\n"+
-		"    for %s in (%s..%s) {\n"+
+		"    for %s in %s {\n"+
 		"        if !(%s) {\n"+
 		"            __forall_holds = false;\n"+
 		"            break;\n"+
 		"        }\n"+
 		"    }\n"+
 		"    __forall_holds\n"+
-		"}", expr.Variable, rangeStart, rangeEnd, body)
+		"}", expr.Variable, domain, body)
 }
 
 func (g *generator) generateExistsExpr(expr *ir.ExistsExpr, arrayRefParams map[string]bool) string {
-	rangeStart := g.generateExpr(expr.Domain.Start, arrayRefParams)
-	rangeEnd := g.generateExpr(expr.Domain.End, arrayRefParams)
+	domain := g.quantifierDomain(expr.Domain, expr.Map, arrayRefParams)
 	body := g.generateExpr(expr.Body, arrayRefParams)
 
 	return fmt.Sprintf("{\n"+
 		"    let mut __exists_found = false;\n"+
-		"    for %s in (%s..%s) {\n"+
+		"    for %s in %s {\n"+
 		"        if %s {\n"+
 		"            __exists_found = true;\n"+
 		"            break;\n"+
 		"        }\n"+
 		"    }\n"+
 		"    __exists_found\n"+
-		"}", expr.Variable, rangeStart, rangeEnd, body)
+		"}", expr.Variable, domain, body)
 }
 
 func (g *generator) generateMatchExpr(expr *ir.MatchExpr, arrayRefParams map[string]bool) string {
@@ -1077,7 +1319,7 @@ func (g *generator) generateMatchPattern(pattern *ir.MatchPattern) string {
 		return pattern.VariantName
 	}
 
-	enumName := pattern.EnumName
+	enumName := g.typeName(pattern.EnumName)
 
 	// Unit variant
 	if len(pattern.Bindings) == 0 {
@@ -1160,6 +1402,25 @@ func escapeRustString(s string) string {
 	return s
 }
 
+// assertMacro returns the macro that checks c: debug_assert in debug
+// contract mode, unless c is marked @always_check. A nil c is a decreases
+// clause, which cannot be marked.
+func (g *generator) assertMacro(c *ir.Contract) string {
+	if g.debugContracts && (c == nil || !c.AlwaysCheck) {
+		return "debug_assert"
+	}
+	return "assert"
+}
+
+// escapeRustFormat escapes contract text for an assert! message, which is a
+// format string: braces from match expressions must be doubled.
+func escapeRustFormat(s string) string {
+	s = escapeRustString(s)
+	s = strings.ReplaceAll(s, "{", "{{")
+	s = strings.ReplaceAll(s, "}", "}}")
+	return s
+}
+
 // generateStringInterp generates Rust format!() for string interpolation.
 // "hello {expr} world" -> format!("hello {} world", expr)
 func (g *generator) generateStringInterp(interp *ir.StringInterp) string {
@@ -152,3 +152,275 @@ func findExample(t *testing.T, name string) string {
 		dir = parent
 	}
 }
+
+func TestGenerateCheckedArith(t *testing.T) {
+	src := `module test version "1.0";
+function calc(a: Int, b: Int) returns Int {
+    let s: Int = a * b + 1;
+    return -(s / b) % 3;
+}
+entry function main() returns Int {
+    return calc(2, 3);
+}
+`
+	p := parser.New(src)
+	prog := p.Parse()
+	result := checker.CheckWithResult(prog)
+	if result.Diagnostics.HasErrors() {
+		t.Fatalf("check errors: %s", result.Diagnostics.Format("test"))
+	}
+	mod := ir.Lower(prog, result)
+
+	plain := Generate(mod)
+	if strings.Contains(plain, "checked_") {
+		t.Errorf("Expected plain arithmetic by default, got:\n%s", plain)
+	}
+
+	out := GenerateWith(mod, Options{CheckedArith: true})
+	for _, want := range []string{
+		`((a).checked_mul(b).expect("Overflow check failed: a * b (line 3:20)")).checked_add(1i64).expect("Overflow check failed: (a * b) + 1 (line 3:24)")`,
+		`if __r == 0 { panic!("{}", "Division by zero check failed: s / b (line 4:16)"); } __l.checked_div(__r)`,
+		`.checked_neg().expect("Overflow check failed: -(s / b) (line 4:12)")`,
+		`__l.checked_rem(__r).expect("Overflow check failed: -(s / b) % 3 (line 4:21)")`,
+		`calc(2i64, 3i64)`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in checked output:\n%s", want, out)
+		}
+	}
+}
+
+func TestGenerateCheckedArithBraces(t *testing.T) {
+	src := `module test version "1.0";
+function width(s: String) returns Int {
+    return 2;
+}
+function halve(n: Int) returns Int {
+    return n / width("}");
+}
+entry function main() returns Int {
+    return halve(4);
+}
+`
+	p := parser.New(src)
+	prog := p.Parse()
+	result := checker.CheckWithResult(prog)
+	if result.Diagnostics.HasErrors() {
+		t.Fatalf("check errors: %s", result.Diagnostics.Format("test"))
+	}
+	out := GenerateWith(ir.Lower(prog, result), Options{CheckedArith: true})
+	if !strings.Contains(out, `panic!("{}", "Division by zero check failed: n / width(\"}\") (line 6:14)")`) {
+		t.Errorf("Expected the message as a panic! argument, got:\n%s", out)
+	}
+	if strings.Contains(out, `panic!("Division`) {
+		t.Errorf("Expected no source text in a panic! format string, got:\n%s", out)
+	}
+}
+
+func TestGenerateMatchContractMessage(t *testing.T) {
+	src := `module test version "1.0";
+enum Light { Red, Green }
+function go_green(l: Light) returns Light
+    ensures match result { Green => true, _ => false }
+{
+    return Green;
+}
+entry function main() returns Int {
+    let l: Light = go_green(Red);
+    return 0;
+}
+`
+	p := parser.New(src)
+	prog := p.Parse()
+	result := checker.CheckWithResult(prog)
+	if result.Diagnostics.HasErrors() {
+		t.Fatalf("check errors: %s", result.Diagnostics.Format("test"))
+	}
+	out := Generate(ir.Lower(prog, result))
+	want := `"Postcondition failed: match result {{ Green => true , _ => false }}"`
+	if !strings.Contains(out, want) {
+		t.Errorf("Expected braces escaped in assert message %q:\n%s", want, out)
+	}
+}
+
+func TestGenerateDebugContracts(t *testing.T) {
+	src := `module test version "1.0";
+function count(n: Int) returns Int
+    requires n >= 0
+    @always_check ensures result == n
+{
+    let mutable i: Int = 0;
+    while i < n
+        invariant i <= n
+        decreases n - i
+    {
+        i = i + 1;
+    }
+    return i;
+}
+entry function main() returns Int {
+    return count(3);
+}
+`
+	p := parser.New(src)
+	prog := p.Parse()
+	result := checker.CheckWithResult(prog)
+	if result.Diagnostics.HasErrors() {
+		t.Fatalf("check errors: %s", result.Diagnostics.Format("test"))
+	}
+	mod := ir.Lower(prog, result)
+
+	if plain := Generate(mod); strings.Contains(plain, "debug_assert!") {
+		t.Errorf("Expected assert! by default, got:\n%s", plain)
+	}
+
+	out := GenerateWith(mod, Options{DebugContracts: true})
+	for _, want := range []string{
+		`debug_assert!((n >= 0i64), "Precondition failed: n >= 0");`,
+		`debug_assert!((i <= n), "Loop invariant failed after iteration: i <= n");`,
+		`debug_assert!(__decreases_next < __decreases_prev, "Termination metric did not decrease: n - i");`,
+		`    assert!((__result == n), "Postcondition failed: result == n");`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in debug output:\n%s", want, out)
+		}
+	}
+}
+
+func TestGenerateTraits(t *testing.T) {
+	src := `module test version "1.0";
+trait Shape {
+    method area() returns Int;
+    method scale(k: Int) returns Void;
+}
+entity Square implements Shape {
+    field side: Int;
+    constructor(side: Int) { self.side = side; }
+    method area() returns Int { return self.side * self.side; }
+    method scale(k: Int) returns Void { self.side = self.side * k; }
+}
+function grow(s: Shape) returns Int {
+    s.scale(2);
+    return s.area();
+}
+entry function main() returns Int {
+    return grow(Square(3));
+}
+`
+	p := parser.New(src)
+	prog := p.Parse()
+	result := checker.CheckWithResult(prog)
+	if result.Diagnostics.HasErrors() {
+		t.Fatalf("check errors: %s", result.Diagnostics.Format("test"))
+	}
+	out := Generate(ir.Lower(prog, result))
+	for _, want := range []string{
+		"trait Shape: std::fmt::Debug {\n    fn area(&mut self) -> i64;\n    fn scale(&mut self, k: i64);\n    fn __clone_box(&self) -> Box<dyn Shape>;\n}",
+		"impl Clone for Box<dyn Shape> {",
+		"impl Shape for Square {\n    fn area(&mut self) -> i64 {\n        Square::area(self)\n    }",
+		"fn grow(mut s: Box<dyn Shape>) -> i64 {",
+		"grow((Box::new(Square::new(3i64)) as Box<dyn Shape>))",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestGenerateMaps(t *testing.T) {
+	src := `module test version "1.0";
+function total(m: Map<String, Int>) returns Int
+    requires forall k in m: m.contains(k)
+{
+    let mutable sum: Int = 0;
+    for k, v in m {
+        sum = sum + v;
+    }
+    return sum;
+}
+entry function main() returns Int {
+    let mutable m: Map<String, Int> = Map();
+    let key: String = "a";
+    m.set(key, 1);
+    print(key);
+    m.remove("b");
+    for k in m {
+        print(k);
+    }
+    let first: Option<Int> = m.get("a");
+    return total(m) + len(m);
+}
+`
+	p := parser.New(src)
+	prog := p.Parse()
+	result := checker.CheckWithResult(prog)
+	if result.Diagnostics.HasErrors() {
+		t.Fatalf("check errors: %s", result.Diagnostics.Format("test"))
+	}
+	out := Generate(ir.Lower(prog, result))
+	for _, want := range []string{
+		"fn total(m: &std::collections::BTreeMap<String, i64>) -> i64 {",
+		"for k in m.keys().cloned() {\n        if !(m.contains_key(&k)) {",
+		"for (k, v) in m.clone() {",
+		"let mut m: std::collections::BTreeMap<String, i64> = std::collections::BTreeMap::new();",
+		"m.insert(key.clone(), 1i64);",
+		`m.remove(&"b".to_string());`,
+		"for k in m.keys().cloned().collect::<Vec<_>>() {",
+		`let first: Option<i64> = m.get(&"a".to_string()).cloned();`,
+		"return (total(&m) + (m.len() as i64));",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestGenerateMutableArrayParams(t *testing.T) {
+	src := `module test version "1.0";
+entity Counter {
+    field n: Int;
+    constructor(n: Int) ensures self.n == n { self.n = n; }
+    method bump() returns Void { self.n = self.n + 1; }
+}
+function bump_all(cs: Array<Counter>) returns Void {
+    for i in 0..len(cs) {
+        cs[i].bump();
+    }
+}
+function pass_on(cs: Array<Counter>) returns Void {
+    bump_all(cs);
+}
+function sum(xs: Array<Int>) returns Int {
+    return xs[0];
+}
+entry function main() returns Int {
+    let cs: Array<Counter> = [Counter(1)];
+    pass_on(cs);
+    let xs: Array<Int> = [0];
+    let name: String = "a";
+    let names: Array<String> = [name, name];
+    return sum(xs);
+}
+`
+	p := parser.New(src)
+	prog := p.Parse()
+	result := checker.CheckWithResult(prog)
+	if result.Diagnostics.HasErrors() {
+		t.Fatalf("check errors: %s", result.Diagnostics.Format("test"))
+	}
+	out := Generate(ir.Lower(prog, result))
+	for _, want := range []string{
+		"fn bump_all(cs: &mut Vec<Counter>) -> () {",
+		"fn pass_on(cs: &mut Vec<Counter>) -> () {",
+		"bump_all(cs);",
+		"fn sum(xs: &Vec<i64>) -> i64 {",
+		"let mut cs: Vec<Counter> =",
+		"pass_on(&mut cs);",
+		"return sum(&xs);",
+		"vec![name.clone(), name.clone()]",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// Arrays are modeled as SMT arrays from Int indexes to elements, paired with
+// a length constant named <array>@len. Every array term the body encoder
+// produces is a declared constant, so its length can be found by name:
+// literals, element assignments and push introduce a fresh constant defined
+// by assumptions over the previous one.
+
+func isArrayType(t *checker.Type) bool {
+	return t != nil && t.Name == "Array"
+}
+
+func isArraySort(sort string) bool {
+	return strings.HasPrefix(sort, "(Array ")
+}
+
+// arrayLen returns the length constant paired with an array term, or "" when
+// the term is not a declared constant.
+func arrayLen(term string) string {
+	if term == "" || strings.ContainsAny(term, " ()") {
+		return ""
+	}
+	return term + "@len"
+}
+
+// declareConst declares an SMT constant. Arrays also get their length
+// constant, which is never negative.
+func declareConst(sb *strings.Builder, name, sort string) {
+	fmt.Fprintf(sb, "(declare-const %s %s)\n", name, sort)
+	if isArraySort(sort) {
+		fmt.Fprintf(sb, "(declare-const %s@len Int)\n", name)
+		fmt.Fprintf(sb, "(assert (>= %s@len 0))\n", name)
+	}
+}
+
+// lenArg returns the array or map argument of a len() call.
+func lenArg(e *ir.CallExpr) (ir.Expr, bool) {
+	if e.Function != "len" || len(e.Args) != 1 || !hasLen(e.Args[0].ExprType()) {
+		return nil, false
+	}
+	return e.Args[0], true
+}
+
+// isPush reports whether m appends to an array in place.
+func isPush(m *ir.MethodCallExpr) bool {
+	return !m.IsModuleCall && m.Method == "push" && len(m.Args) == 1 && isArrayType(m.Object.ExprType())
+}
+
+// mutatedArray returns the array or map a statement updates in place: the
+// target of an element assignment or the receiver of push, set or remove.
+func mutatedArray(s ir.Stmt) (ir.Expr, bool) {
+	switch st := s.(type) {
+	case *ir.AssignStmt:
+		if ix, ok := st.Target.(*ir.IndexExpr); ok {
+			return ix.Object, true
+		}
+	case *ir.ExprStmt:
+		if m, ok := st.Expr.(*ir.MethodCallExpr); ok && (isPush(m) || isMapUpdate(m)) {
+			return m.Object, true
+		}
+	}
+	return nil, false
+}
+
+// placeKey returns the environment key of a variable or self field.
+func placeKey(e ir.Expr) (string, bool) {
+	switch x := e.(type) {
+	case *ir.VarRef:
+		return x.Name, true
+	case *ir.FieldAccessExpr:
+		if _, ok := x.Object.(*ir.SelfRef); ok {
+			return "self_" + x.Field, true
+		}
+	}
+	return "", false
+}
+
+// lenOf returns the length of an array term. Arrays that are not constants,
+// such as an ite over match arms, get an unconstrained length.
+func (b *bodyEncoder) lenOf(arr string) string {
+	if n := arrayLen(arr); n != "" {
+		return n
+	}
+	return b.freshConst("len", checker.TypeInt)
+}
+
+// arrayLit encodes an array literal as a fresh constant whose length and
+// elements are assumed.
+func (b *bodyEncoder) arrayLit(x *ir.ArrayLit, env map[string]string) string {
+	elems := make([]string, len(x.Elements))
+	for i, e := range x.Elements {
+		elems[i] = b.expr(e, env)
+	}
+	arr := b.freshConst("arr", x.Type)
+	b.assumptions = append(b.assumptions, fmt.Sprintf("(= %s %d)", arrayLen(arr), len(elems)))
+	for i, e := range elems {
+		b.assumptions = append(b.assumptions, fmt.Sprintf("(= (select %s %d) %s)", arr, i, e))
+	}
+	return arr
+}
+
+// index encodes arr[idx] and records its bounds check.
+func (b *bodyEncoder) index(x *ir.IndexExpr, env map[string]string) string {
+	arr := b.expr(x.Object, env)
+	idx := b.expr(x.Index, env)
+	if !isArrayType(x.Object.ExprType()) {
+		return b.freshConst("v", x.Type)
+	}
+	b.checkBounds(x, arr, idx)
+	return fmt.Sprintf("(select %s %s)", arr, idx)
+}
+
+// assignIndex executes place[index] = value on path st.
+func (b *bodyEncoder) assignIndex(target *ir.IndexExpr, value string, st *symState) {
+	arr := b.eval(target.Object, st)
+	idx := b.eval(target.Index, st)
+	b.pc = st.pc
+	b.checkBounds(target, arr, idx)
+	b.updateArray(target.Object, st, arr, idx, value, b.lenOf(arr))
+}
+
+// push executes place.push(value) on path st.
+func (b *bodyEncoder) push(m *ir.MethodCallExpr, st *symState) {
+	arr := b.eval(m.Object, st)
+	value := b.eval(m.Args[0], st)
+	n := b.lenOf(arr)
+	b.updateArray(m.Object, st, arr, n, value, "(+ "+n+" 1)")
+}
+
+// updateArray rebinds the array at place to a fresh constant equal to old
+// with element idx set to value, and with the given length.
+func (b *bodyEncoder) updateArray(place ir.Expr, st *symState, old, idx, value, length string) {
+	key, ok := placeKey(place)
+	if !ok {
+		return
+	}
+	arr := b.freshConst(key, place.ExprType())
+	st.pc = append(st.pc,
+		fmt.Sprintf("(= %s (store %s %s %s))", arr, old, idx, value),
+		fmt.Sprintf("(= %s %s)", arrayLen(arr), length))
+	st.env[key] = arr
+}
@@ -0,0 +1,757 @@
+package verify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+	"github.com/lhaig/intent/internal/lexer"
+)
+
+// bodyEncoder symbolically executes IR statement lists so that verification
+// conditions can reason about what a body actually computes.
+//
+// Variables are tracked as SMT terms in an environment: let and assign simply
+// rebind a name to the term of its new value, and if/else forks the current
+// path. Loops are summarized rather than unrolled: every variable the loop
+// assigns is replaced by a fresh constant, and the loop invariants plus the
+// negated loop condition are assumed on exit. That assumption is discharged
+// by loop obligations: each invariant must hold on entry, and one arbitrary
+// iteration, executed from the havocked state with the invariants and the
+// condition assumed, must leave it true. The same iteration produces the
+// call-site obligations of the calls inside the loop.
+//
+// Calls to functions and constructors with known contracts are encoded
+// modularly: the callee's requires becomes a call obligation at the current
+// path condition, and its ensures is assumed about a fresh result constant.
+// Other expressions the encoder cannot model (strings, non-self field access,
+// unknown calls) become fresh unconstrained constants, which keeps the
+// encoding sound but incomplete.
+type bodyEncoder struct {
+	fields     []*ir.Field   // entity fields (tracked as self_<name>), nil for functions
+	resultType *checker.Type // return type, used when a summarized loop returns
+	callees    ContractTable // contracts of callable functions/constructors
+	decls      []smtDecl     // fresh constants introduced while encoding
+
+	pc          []string          // path condition of the expression being encoded
+	assumptions []string          // callee ensures gathered while encoding an expression
+	obligations []*callObligation // callee requires to prove at each call site
+	loops       []*loopObligation // loop invariants to prove on entry and after an iteration
+	safety      []*safetySite     // overflow, division and bounds checks at each operation
+	bound       []boundVar        // quantifiers enclosing the expression being encoded
+	fresh       int
+}
+
+// callObligation is a callee precondition that must hold at a call site.
+type callObligation struct {
+	callee   string
+	contract *ir.Contract
+	pc       []string // path condition reaching the call
+	goal     string   // callee requires with arguments substituted
+	callSpan
+}
+
+// callSpan is the source span of a call; zero when unknown.
+type callSpan struct {
+	line, column       int
+	endLine, endColumn int
+}
+
+// loopObligation is a loop invariant that must hold on one path: where the
+// loop is entered, or at the end of an iteration.
+type loopObligation struct {
+	loop     *ir.WhileStmt
+	contract *ir.Contract
+	pc       []string // path condition reaching that point
+	goal     string   // the invariant over the state there
+}
+
+// smtDecl is a constant the encoder needs declared before its assertions.
+type smtDecl struct {
+	Name string
+	Sort string
+}
+
+// symState is one symbolic execution path through a body.
+type symState struct {
+	env      map[string]string // variable / self_<field> / old capture -> SMT term
+	pc       []string          // path condition conjuncts
+	returned bool
+	result   string // SMT term of the returned value ("" for bare return)
+	jump     string // "break" or "continue" when returned ends a loop iteration
+}
+
+func newBodyEncoder(fields []*ir.Field, resultType *checker.Type, callees ContractTable) *bodyEncoder {
+	return &bodyEncoder{fields: fields, resultType: resultType, callees: callees}
+}
+
+// initialState returns the entry state: every parameter and field maps to
+// its own declared constant.
+func (b *bodyEncoder) initialState(params []*ir.Param) *symState {
+	st := &symState{env: make(map[string]string)}
+	for _, p := range params {
+		st.env[p.Name] = p.Name
+	}
+	for _, f := range b.fields {
+		st.env["self_"+f.Name] = "self_" + f.Name
+	}
+	return st
+}
+
+func (s *symState) clone() *symState {
+	env := make(map[string]string, len(s.env))
+	for k, v := range s.env {
+		env[k] = v
+	}
+	pc := make([]string, len(s.pc))
+	copy(pc, s.pc)
+	return &symState{env: env, pc: pc, returned: s.returned, result: s.result, jump: s.jump}
+}
+
+// freshConst declares a new unconstrained constant of the given type.
+func (b *bodyEncoder) freshConst(hint string, t *checker.Type) string {
+	b.fresh++
+	name := fmt.Sprintf("%s@%d", hint, b.fresh)
+	b.decls = append(b.decls, smtDecl{Name: name, Sort: typeToSMTSort(t)})
+	return name
+}
+
+// execBody runs stmts from the given state and returns every resulting path.
+func (b *bodyEncoder) execBody(stmts []ir.Stmt, st *symState) []*symState {
+	return b.execBlock(stmts, []*symState{st})
+}
+
+func (b *bodyEncoder) execBlock(stmts []ir.Stmt, states []*symState) []*symState {
+	for _, stmt := range stmts {
+		var next []*symState
+		for _, st := range states {
+			if st.returned {
+				next = append(next, st)
+				continue
+			}
+			next = append(next, b.execStmt(stmt, st)...)
+		}
+		states = next
+	}
+	return states
+}
+
+// eval translates a statement-level expression on path st. Assumptions
+// produced by calls inside it are added to the path condition.
+func (b *bodyEncoder) eval(e ir.Expr, st *symState) string {
+	b.pc = st.pc
+	term := b.expr(e, st.env)
+	st.pc = append(st.pc, b.assumptions...)
+	b.assumptions = nil
+	b.havocSelfIfCalled(e, st)
+	return term
+}
+
+func (b *bodyEncoder) execStmt(stmt ir.Stmt, st *symState) []*symState {
+	switch s := stmt.(type) {
+	case *ir.LetStmt:
+		st.env[s.Name] = b.eval(s.Value, st)
+		return []*symState{st}
+
+	case *ir.AssignStmt:
+		value := b.eval(s.Value, st)
+		switch target := s.Target.(type) {
+		case *ir.VarRef:
+			st.env[target.Name] = value
+		case *ir.FieldAccessExpr:
+			if _, ok := target.Object.(*ir.SelfRef); ok {
+				st.env["self_"+target.Field] = value
+			}
+		case *ir.IndexExpr:
+			b.assignIndex(target, value, st)
+		}
+		return []*symState{st}
+
+	case *ir.ReturnStmt:
+		st.returned = true
+		if s.Value != nil {
+			st.result = b.eval(s.Value, st)
+		}
+		return []*symState{st}
+
+	case *ir.IfStmt:
+		cond := b.eval(s.Condition, st)
+		thenSt := st.clone()
+		thenSt.pc = append(thenSt.pc, cond)
+		elseSt := st
+		elseSt.pc = append(elseSt.pc, "(not "+cond+")")
+		out := b.execBody(s.Then, thenSt)
+		return append(out, b.execBody(s.Else, elseSt)...)
+
+	case *ir.WhileStmt:
+		return b.execWhile(s, st)
+
+	case *ir.ForInStmt:
+		return b.execForIn(s, st)
+
+	case *ir.ExprStmt:
+		if m, ok := s.Expr.(*ir.MethodCallExpr); ok && isPush(m) {
+			b.push(m, st)
+			return []*symState{st}
+		}
+		if m, ok := s.Expr.(*ir.MethodCallExpr); ok && isMapUpdate(m) {
+			b.updateMap(m, st)
+			return []*symState{st}
+		}
+		b.eval(s.Expr, st)
+		return []*symState{st}
+
+	case *ir.BreakStmt:
+		// Only reachable while executing a single loop iteration; the rest
+		// of that iteration is skipped.
+		st.returned = true
+		st.jump = "break"
+		return []*symState{st}
+
+	case *ir.ContinueStmt:
+		st.returned = true
+		st.jump = "continue"
+		return []*symState{st}
+
+	default:
+		return []*symState{st}
+	}
+}
+
+// execWhile summarizes a while loop using its invariants. Each invariant
+// becomes a loop obligation on entry and at the end of every path through
+// the iteration that goes on looping. A loop that can break is left with
+// nothing assumed on exit, since the invariants are not checked there and
+// the condition may still hold.
+func (b *bodyEncoder) execWhile(w *ir.WhileStmt, st *symState) []*symState {
+	// old() inside loop invariants refers to the values at loop entry
+	for _, oc := range w.OldCaptures {
+		st.env[oc.Name] = b.eval(oc.Expr, st)
+	}
+	b.requireInvariants(w, []*symState{st})
+	out := b.summarizeLoop(w.Body, st, func(iter *symState) {
+		for _, inv := range w.Invariants {
+			iter.pc = append(iter.pc, b.eval(inv.Expr, iter))
+		}
+		iter.pc = append(iter.pc, b.eval(w.Condition, iter))
+		if w.Decreases != nil {
+			b.eval(w.Decreases.Expr, iter)
+		}
+	}, func(ends []*symState) {
+		var looping []*symState
+		for _, end := range ends {
+			if !end.returned || end.jump == "continue" {
+				looping = append(looping, end)
+			}
+		}
+		b.requireInvariants(w, looping)
+	})
+	exit := out[len(out)-1]
+	if !breaksOut(w.Body) {
+		for _, inv := range w.Invariants {
+			exit.pc = append(exit.pc, b.eval(inv.Expr, exit))
+		}
+		exit.pc = append(exit.pc, "(not "+b.eval(w.Condition, exit)+")")
+	}
+	// The metric is also evaluated after the last iteration
+	if w.Decreases != nil {
+		b.eval(w.Decreases.Expr, exit)
+	}
+	return out
+}
+
+// requireInvariants records the invariants of w as loop obligations on each
+// of states.
+func (b *bodyEncoder) requireInvariants(w *ir.WhileStmt, states []*symState) {
+	for _, st := range states {
+		for _, inv := range w.Invariants {
+			goal := b.eval(inv.Expr, st)
+			b.loops = append(b.loops, &loopObligation{
+				loop:     w,
+				contract: inv,
+				pc:       append([]string(nil), st.pc...),
+				goal:     goal,
+			})
+		}
+	}
+}
+
+// execForIn summarizes a for-in loop. The range bounds (or the array or
+// map) are evaluated once at entry, and one arbitrary iteration binds the
+// loop variable to a value within them.
+func (b *bodyEncoder) execForIn(f *ir.ForInStmt, st *symState) []*symState {
+	if r, ok := f.Iterable.(*ir.RangeExpr); ok {
+		start := b.eval(r.Start, st)
+		end := b.eval(r.End, st)
+		return b.summarizeLoop(f.Body, st, func(iter *symState) {
+			v := b.freshConst(f.Variable, checker.TypeInt)
+			iter.env[f.Variable] = v
+			iter.pc = append(iter.pc, fmt.Sprintf("(<= %s %s)", start, v), fmt.Sprintf("(< %s %s)", v, end))
+		}, nil)
+	}
+	arr := b.eval(f.Iterable, st)
+	return b.summarizeLoop(f.Body, st, func(iter *symState) {
+		if t := f.Iterable.ExprType(); isMapType(t) {
+			k := b.freshConst(f.Variable, t.TypeParams[0])
+			iter.env[f.Variable] = k
+			iter.pc = append(iter.pc, fmt.Sprintf("(select %s %s)", arr, k))
+			if f.ValueVariable != "" {
+				iter.env[f.ValueVariable] = b.freshConst(f.ValueVariable, t.TypeParams[1])
+			}
+			return
+		}
+		if !isArrayType(f.Iterable.ExprType()) {
+			iter.env[f.Variable] = b.freshConst(f.Variable, nil)
+			return
+		}
+		k := b.freshConst("k", checker.TypeInt)
+		iter.env[f.Variable] = fmt.Sprintf("(select %s %s)", arr, k)
+		iter.pc = append(iter.pc, fmt.Sprintf("(<= 0 %s)", k), fmt.Sprintf("(< %s %s)", k, b.lenOf(arr)))
+	}, nil)
+}
+
+// summarizeLoop havocs everything the loop body may assign. If the body can
+// return, an extra returned path with an unknown result is produced first.
+// The last state in the returned slice is always the loop-exit state.
+// One arbitrary iteration is executed from the havocked state, after enter
+// adds the loop's entry assumptions, to collect obligations; leave, if not
+// nil, is given the paths that iteration ends in.
+func (b *bodyEncoder) summarizeLoop(body []ir.Stmt, st *symState, enter func(iter *symState), leave func(ends []*symState)) []*symState {
+	assigned := make(map[string]bool)
+	collectAssigned(body, assigned)
+	if b.callsSelfMethod(body) {
+		for _, f := range b.fields {
+			assigned["self_"+f.Name] = true
+		}
+	}
+	for _, name := range sortedKeys(assigned) {
+		if _, tracked := st.env[name]; tracked {
+			st.env[name] = b.freshConst(name, b.typeOfTracked(name, body))
+		}
+	}
+
+	iter := st.clone()
+	enter(iter)
+	ends := b.execBody(body, iter)
+	if leave != nil {
+		leave(ends)
+	}
+
+	var out []*symState
+	if containsReturn(body) {
+		ret := st.clone()
+		ret.returned = true
+		ret.result = b.freshConst("result", b.resultType)
+		out = append(out, ret)
+	}
+	return append(out, st)
+}
+
+// havocSelfIfCalled forgets every self field when e calls a method on self,
+// since the callee may update any of them.
+func (b *bodyEncoder) havocSelfIfCalled(e ir.Expr, st *symState) {
+	if len(b.fields) == 0 || !exprCallsSelf(e) {
+		return
+	}
+	for _, f := range b.fields {
+		st.env["self_"+f.Name] = b.freshConst("self_"+f.Name, f.Type)
+	}
+}
+
+func (b *bodyEncoder) callsSelfMethod(stmts []ir.Stmt) bool {
+	if len(b.fields) == 0 {
+		return false
+	}
+	found := false
+	ir.WalkStmtExprs(stmts, func(e ir.Expr) {
+		if exprCallsSelf(e) {
+			found = true
+		}
+	})
+	return found
+}
+
+// typeOfTracked finds the declared type of a tracked name for havocking.
+func (b *bodyEncoder) typeOfTracked(name string, body []ir.Stmt) *checker.Type {
+	if strings.HasPrefix(name, "self_") {
+		for _, f := range b.fields {
+			if "self_"+f.Name == name {
+				return f.Type
+			}
+		}
+	}
+	var t *checker.Type
+	ir.WalkStmts(body, func(s ir.Stmt) {
+		if place, ok := mutatedArray(s); ok && t == nil {
+			if key, ok := placeKey(place); ok && key == name {
+				t = place.ExprType()
+			}
+			return
+		}
+		if a, ok := s.(*ir.AssignStmt); ok && t == nil {
+			if v, ok := a.Target.(*ir.VarRef); ok && v.Name == name {
+				t = v.Type
+			}
+		}
+	})
+	return t
+}
+
+// expr translates an expression under the given environment.
+func (b *bodyEncoder) expr(e ir.Expr, env map[string]string) string {
+	switch x := e.(type) {
+	case *ir.VarRef:
+		if v, ok := env[x.Name]; ok {
+			return v
+		}
+		return x.Name
+	case *ir.OldRef:
+		if v, ok := env[x.Name]; ok {
+			return v
+		}
+		return x.Name
+	case *ir.FieldAccessExpr:
+		if _, ok := x.Object.(*ir.SelfRef); ok {
+			if v, ok := env["self_"+x.Field]; ok {
+				return v
+			}
+			return "self_" + x.Field
+		}
+		return b.freshConst("field", x.Type)
+	case *ir.ResultRef:
+		if v, ok := env["result"]; ok {
+			return v
+		}
+		return "result"
+	case *ir.IntLit:
+		return fmt.Sprintf("%d", x.Value)
+	case *ir.FloatLit:
+		return floatLit(x.Value)
+	case *ir.BoolLit:
+		if x.Value {
+			return "true"
+		}
+		return "false"
+	case *ir.BinaryExpr:
+		left := b.expr(x.Left, env)
+		// The right operand of and/or/implies is only evaluated when the
+		// left one allows it, which matters for call obligations inside it
+		switch x.Op {
+		case lexer.AND, lexer.IMPLIES:
+			return binaryOpToSMT(x.Op, left, b.guarded(left, x.Right, env))
+		case lexer.OR:
+			return binaryOpToSMT(x.Op, left, b.guarded("(not "+left+")", x.Right, env))
+		}
+		right := b.expr(x.Right, env)
+		b.checkArith(x, left, right)
+		return binaryTerm(x, left, right)
+	case *ir.UnaryExpr:
+		operand := b.expr(x.Operand, env)
+		b.checkNeg(x, operand)
+		return unaryTerm(x, operand)
+	case *ir.ForallExpr:
+		return b.quantifier("forall", x.Variable, x.Domain, x.Map, x.Body, env)
+	case *ir.ExistsExpr:
+		return b.quantifier("exists", x.Variable, x.Domain, x.Map, x.Body, env)
+	case *ir.MatchExpr:
+		return b.match(x, env)
+	case *ir.IndexExpr:
+		return b.index(x, env)
+	case *ir.ArrayLit:
+		return b.arrayLit(x, env)
+	case *ir.CallExpr:
+		if arr, ok := lenArg(x); ok {
+			return b.lenOf(b.expr(arr, env))
+		}
+		if isVariantCall(x) {
+			args := make([]string, len(x.Args))
+			for i, a := range x.Args {
+				args[i] = b.expr(a, env)
+			}
+			if term, ok := variantTerm(x.Function, x.Type, args); ok {
+				return term
+			}
+		}
+		if x.Kind == ir.CallFunction || x.Kind == ir.CallConstructor {
+			return b.call(x.Function, x.Args, x.Type, callSpan{x.Line, x.Column, x.EndLine, x.EndColumn}, env)
+		}
+		return b.freshConst("call", x.Type)
+	case *ir.MethodCallExpr:
+		if x.IsModuleCall {
+			return b.call(x.ModuleName+"."+x.Method, x.Args, x.Type, callSpan{x.Line, x.Column, x.EndLine, x.EndColumn}, env)
+		}
+		obj := b.expr(x.Object, env)
+		args := make([]string, len(x.Args))
+		for i, a := range x.Args {
+			args[i] = b.expr(a, env)
+		}
+		if isContains(x) {
+			return fmt.Sprintf("(select %s %s)", obj, args[0])
+		}
+		return b.freshConst("call", x.Type)
+	default:
+		return b.freshConst("v", e.ExprType())
+	}
+}
+
+// guarded translates e with cond added to the current path condition.
+func (b *bodyEncoder) guarded(cond string, e ir.Expr, env map[string]string) string {
+	saved := b.pc
+	b.pc = append(append([]string{}, saved...), cond)
+	out := b.expr(e, env)
+	b.pc = saved
+	return out
+}
+
+// call encodes a call to name modularly. Each callee requires becomes an
+// obligation at the call site; the callee ensures is assumed about a fresh
+// result, guarded by the requires so an unmet precondition cannot make the
+// path vacuous. Calls without a known contract yield a fresh constant.
+// site locates the call for its obligations.
+func (b *bodyEncoder) call(name string, args []ir.Expr, t *checker.Type, site callSpan, env map[string]string) string {
+	argTerms := make([]string, len(args))
+	for i, a := range args {
+		argTerms[i] = b.expr(a, env)
+	}
+
+	callee, ok := b.callees[name]
+	if !ok || len(callee.Params) != len(args) {
+		return b.freshConst("call", t)
+	}
+
+	result := b.freshConst(strings.ReplaceAll(name, ".", "_")+"_result", t)
+	calleeEnv := map[string]string{"result": result}
+	for i, p := range callee.Params {
+		calleeEnv[p.Name] = argTerms[i]
+	}
+
+	// Contract expressions are encoded without recording further obligations;
+	// arithmetic in them is checked where the callee is verified
+	saved := b.pc
+	savedObligations := b.obligations
+	savedSafety := b.safety
+	var reqs []string
+	for _, req := range callee.Requires {
+		goal := b.expr(req.Expr, calleeEnv)
+		reqs = append(reqs, goal)
+		savedObligations = append(savedObligations, &callObligation{
+			callee:   name,
+			contract: req,
+			pc:       append(append([]string{}, saved...), b.assumptions...),
+			goal:     goal,
+			callSpan: site,
+		})
+	}
+	var ens []string
+	for _, e := range callee.Ensures {
+		ens = append(ens, b.expr(e.Expr, calleeEnv))
+	}
+	b.obligations = savedObligations
+	b.safety = savedSafety
+	b.pc = saved
+
+	if len(ens) > 0 {
+		if len(reqs) > 0 {
+			b.assumptions = append(b.assumptions, fmt.Sprintf("(=> %s %s)", smtAnd(reqs), smtAnd(ens)))
+		} else {
+			b.assumptions = append(b.assumptions, smtAnd(ens))
+		}
+	}
+	return result
+}
+
+func (b *bodyEncoder) quantifier(kind, variable string, domain *ir.RangeExpr, m ir.Expr, body ir.Expr, env map[string]string) string {
+	var start, end, keys, keySort string
+	if domain != nil {
+		start = b.expr(domain.Start, env)
+		end = b.expr(domain.End, env)
+	}
+	if m != nil {
+		keys = b.expr(m, env)
+		keySort = mapKeySort(m.ExprType())
+	}
+	inner := make(map[string]string, len(env))
+	for k, v := range env {
+		inner[k] = v
+	}
+	delete(inner, variable)
+	b.bound = append(b.bound, boundVar{name: variable, start: start, end: end, keys: keys, sort: keySort, pcLen: len(b.pc)})
+	bodySMT := b.expr(body, inner)
+	b.bound = b.bound[:len(b.bound)-1]
+	if m != nil {
+		return mapQuantifierTerm(kind, variable, keySort, keys, bodySMT)
+	}
+	if kind == "forall" {
+		return fmt.Sprintf("(forall ((%s Int)) (=> (and (>= %s %s) (< %s %s)) %s))",
+			variable, variable, start, variable, end, bodySMT)
+	}
+	return fmt.Sprintf("(exists ((%s Int)) (and (>= %s %s) (< %s %s) %s))",
+		variable, variable, start, variable, end, bodySMT)
+}
+
+// match encodes a match expression as a chain of ite terms over datatype
+// testers, with payload bindings read through the variant's selectors.
+func (b *bodyEncoder) match(m *ir.MatchExpr, env map[string]string) string {
+	scrut := b.expr(m.Scrutinee, env)
+	scrutType := m.Scrutinee.ExprType()
+
+	var arms []string
+	var guards []string
+	var prior []string // negated guards of earlier arms
+	for _, arm := range m.Arms {
+		armEnv := make(map[string]string, len(env))
+		for k, v := range env {
+			armEnv[k] = v
+		}
+		var guard string
+		if arm.Pattern.IsWildcard {
+			guard = "true"
+		} else if variant, ok := enumVariant(scrutType, arm.Pattern.VariantName); ok {
+			ctor := variantCtor(scrutType, variant.Name)
+			guard = testerTerm(ctor, scrut)
+			for i, name := range arm.Pattern.Bindings {
+				if i < len(variant.Fields) {
+					armEnv[name] = fmt.Sprintf("(%s %s)", selectorName(ctor, variant.Fields[i].Name), scrut)
+				}
+			}
+		} else {
+			guard = b.freshConst("arm", checker.TypeBool)
+			for _, name := range arm.Pattern.Bindings {
+				armEnv[name] = b.freshConst(name, nil)
+			}
+		}
+		guards = append(guards, guard)
+		arms = append(arms, b.guarded(smtAnd(append(append([]string{}, prior...), guard)), arm.Body, armEnv))
+		prior = append(prior, "(not "+guard+")")
+	}
+	if len(arms) == 0 {
+		return b.freshConst("match", m.Type)
+	}
+
+	// The last arm is the fallback; match exhaustiveness is enforced by the checker
+	out := arms[len(arms)-1]
+	for i := len(arms) - 2; i >= 0; i-- {
+		out = fmt.Sprintf("(ite %s %s %s)", guards[i], arms[i], out)
+	}
+	return out
+}
+
+// pathsConstraint builds the disjunction over all returned paths, binding
+// result to the value returned on that path. An array result also binds
+// its length.
+func pathsConstraint(states []*symState, resultType *checker.Type) string {
+	var disjuncts []string
+	for _, st := range states {
+		if !st.returned || st.result == "" {
+			continue
+		}
+		binding := []string{fmt.Sprintf("(= result %s)", st.result)}
+		if n := arrayLen(st.result); n != "" && hasLen(resultType) {
+			binding = append(binding, fmt.Sprintf("(= result@len %s)", n))
+		}
+		disjuncts = append(disjuncts, smtAnd(append(append([]string{}, st.pc...), binding...)))
+	}
+	switch len(disjuncts) {
+	case 0:
+		return ""
+	case 1:
+		return disjuncts[0]
+	default:
+		return "(or " + strings.Join(disjuncts, " ") + ")"
+	}
+}
+
+// smtAnd conjoins terms, collapsing the empty and singleton cases.
+func smtAnd(terms []string) string {
+	switch len(terms) {
+	case 0:
+		return "true"
+	case 1:
+		return terms[0]
+	default:
+		return "(and " + strings.Join(terms, " ") + ")"
+	}
+}
+
+func writeDecls(sb *strings.Builder, decls []smtDecl) {
+	for _, d := range decls {
+		declareConst(sb, d.Name, d.Sort)
+	}
+}
+
+// --- IR walking helpers ---
+
+// collectAssigned records every variable (by name) and self field (as
+// self_<name>) assigned anywhere in stmts.
+func collectAssigned(stmts []ir.Stmt, out map[string]bool) {
+	ir.WalkStmts(stmts, func(s ir.Stmt) {
+		if place, ok := mutatedArray(s); ok {
+			if key, ok := placeKey(place); ok {
+				out[key] = true
+			}
+			return
+		}
+		a, ok := s.(*ir.AssignStmt)
+		if !ok {
+			return
+		}
+		switch target := a.Target.(type) {
+		case *ir.VarRef:
+			out[target.Name] = true
+		case *ir.FieldAccessExpr:
+			if _, ok := target.Object.(*ir.SelfRef); ok {
+				out["self_"+target.Field] = true
+			}
+		}
+	})
+}
+
+func containsReturn(stmts []ir.Stmt) bool {
+	found := false
+	ir.WalkStmts(stmts, func(s ir.Stmt) {
+		if _, ok := s.(*ir.ReturnStmt); ok {
+			found = true
+		}
+	})
+	return found
+}
+
+// breaksOut reports whether stmts can break out of the loop they are the
+// body of. Breaks inside nested loops end those loops instead.
+func breaksOut(stmts []ir.Stmt) bool {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ir.BreakStmt:
+			return true
+		case *ir.IfStmt:
+			if breaksOut(s.Then) || breaksOut(s.Else) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exprCallsSelf reports whether e contains a method call whose receiver is self.
+func exprCallsSelf(e ir.Expr) bool {
+	found := false
+	ir.WalkExpr(e, func(x ir.Expr) {
+		if mc, ok := x.(*ir.MethodCallExpr); ok {
+			if _, isSelf := mc.Object.(*ir.SelfRef); isSelf {
+				found = true
+			}
+		}
+	})
+	return found
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,102 @@
+package verify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// queryCache stores solver answers on disk so that unchanged contracts are
+// not proved again. Entries are keyed by a hash of the solver, its version and
+// the full query, so any change to a contract, a body it depends on, or the
+// solver itself misses the cache. Only definitive answers are stored;
+// timeouts and errors are always retried.
+type queryCache struct {
+	dir     string
+	version string
+}
+
+// cacheEntry is the stored form of a solver answer.
+type cacheEntry struct {
+	Status  string            `json:"status"`
+	Message string            `json:"message"`
+	Model   map[string]string `json:"model,omitempty"`
+}
+
+// DefaultCacheDir returns the per-user directory for the verification cache.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "intent", "verify"), nil
+}
+
+// openCache returns a cache in dir for solver, or nil when the solver
+// version is unknown or dir cannot be created.
+func openCache(dir string, solver Solver) *queryCache {
+	version := solver.Version()
+	if version == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil
+	}
+	return &queryCache{dir: dir, version: solver.Name() + " " + version}
+}
+
+func (c *queryCache) path(input string, isEnsures bool) string {
+	h := sha256.New()
+	h.Write([]byte(c.version))
+	h.Write([]byte{0})
+	if isEnsures {
+		h.Write([]byte("ensures\x00"))
+	} else {
+		h.Write([]byte("requires\x00"))
+	}
+	h.Write([]byte(input))
+	return filepath.Join(c.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// load returns the cached answer to a query. A nil cache never hits.
+func (c *queryCache) load(input string, isEnsures bool) (*VerifyResult, bool) {
+	if c == nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(input, isEnsures))
+	if err != nil {
+		return nil, false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || (e.Status != "verified" && e.Status != "unverified") {
+		return nil, false
+	}
+	return &VerifyResult{Status: e.Status, Message: e.Message, Cached: true, model: e.Model}, true
+}
+
+// store records a definitive answer. The entry is written to a temporary
+// file and renamed so that concurrent runs never read a partial entry.
+func (c *queryCache) store(input string, isEnsures bool, r *VerifyResult) {
+	if c == nil || (r.Status != "verified" && r.Status != "unverified") {
+		return
+	}
+	data, err := json.Marshal(cacheEntry{Status: r.Status, Message: r.Message, Model: r.model})
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(c.dir, "entry-*")
+	if err != nil {
+		return
+	}
+	_, werr := tmp.Write(data)
+	cerr := tmp.Close()
+	if werr != nil || cerr != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), c.path(input, isEnsures)); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,173 @@
+package verify
+
+import (
+	"strings"
+
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// CalleeContract is the part of a callable's declaration needed to reason
+// about calls to it without looking at its body.
+type CalleeContract struct {
+	Params     []*ir.Param
+	ReturnType *checker.Type
+	Requires   []*ir.Contract
+	Ensures    []*ir.Contract // nil for constructors (they describe self, not a result)
+}
+
+// ContractTable maps callable names to their contracts. Functions and
+// constructors of the module being verified are keyed by their plain name;
+// those of other modules are keyed as "module.name".
+type ContractTable map[string]*CalleeContract
+
+// NewContractTable collects the function and constructor contracts visible
+// from mod. prog may be nil for single-file programs.
+func NewContractTable(mod *ir.Module, prog *ir.Program) ContractTable {
+	table := make(ContractTable)
+	add := func(m *ir.Module, prefix string) {
+		for _, fn := range m.Functions {
+			table[prefix+fn.Name] = &CalleeContract{
+				Params:     fn.Params,
+				ReturnType: fn.ReturnType,
+				Requires:   fn.Requires,
+				Ensures:    fn.Ensures,
+			}
+		}
+		for _, ent := range m.Entities {
+			if ent.Constructor == nil {
+				continue
+			}
+			table[prefix+ent.Name] = &CalleeContract{
+				Params:   ent.Constructor.Params,
+				Requires: ent.Constructor.Requires,
+			}
+		}
+	}
+	if prog != nil {
+		for _, m := range prog.Modules {
+			if m != mod {
+				add(m, m.Name+".")
+			}
+		}
+	}
+	add(mod, "")
+	return table
+}
+
+// CallObligation is a callee precondition that must hold at one call site,
+// together with the SMT-LIB query that proves it.
+type CallObligation struct {
+	Callee   string
+	Contract *ir.Contract
+	Scope    string // method name, "constructor", or "" for functions
+	SMT      string
+
+	Line, Column       int // position of the call; zero when unknown
+	EndLine, EndColumn int // position just past the closing parenthesis
+}
+
+// TranslateCallRequires generates one verification condition per callee
+// requires clause at every call site in fn's body. Each query assumes fn's
+// own requires and the path leading to the call, then negates the callee's
+// requires with the call arguments substituted for its parameters.
+func TranslateCallRequires(fn *ir.Function, callees ContractTable) []*CallObligation {
+	enc := newBodyEncoder(nil, fn.ReturnType, callees)
+	enc.execBody(fn.Body, enc.initialState(fn.Params))
+	return enc.callObligations("function: "+fn.Name, "", nil, fn.Params, fn.Requires)
+}
+
+// TranslateEntityCallRequires generates the call-site queries of an entity's
+// constructor and methods, as TranslateCallRequires does for a function.
+// Method bodies assume the invariants on entry.
+func TranslateEntityCallRequires(ent *ir.Entity, callees ContractTable) []*CallObligation {
+	var obligations []*CallObligation
+	if ctor := ent.Constructor; ctor != nil {
+		enc := newBodyEncoder(ent.Fields, nil, callees)
+		enc.execBody(ctor.Body, enc.entryState(ctor.Params, nil, ctor.Requires))
+		obligations = append(obligations, enc.callObligations("constructor: "+ent.Name, "constructor", ent.Fields, ctor.Params, nil)...)
+	}
+	for _, m := range ent.Methods {
+		enc := newBodyEncoder(ent.Fields, m.ReturnType, callees)
+		enc.execBody(m.Body, enc.entryState(m.Params, ent.Invariants, m.Requires))
+		obligations = append(obligations, enc.callObligations("method: "+ent.Name+"."+m.Name, m.Name, ent.Fields, m.Params, nil)...)
+	}
+	return obligations
+}
+
+// entryState returns the initial state of a constructor or method with
+// the invariants and requires assumed. Calls inside those contracts are
+// not call sites of the body, so they record no obligations.
+func (b *bodyEncoder) entryState(params []*ir.Param, invariants, requires []*ir.Contract) *symState {
+	st := b.initialState(params)
+	for _, c := range append(append([]*ir.Contract{}, invariants...), requires...) {
+		st.pc = append(st.pc, b.eval(c.Expr, st))
+	}
+	b.obligations = nil
+	return st
+}
+
+// callObligations builds one query per call obligation recorded while
+// encoding a body. requires are assumed about the entry state of a function;
+// entities assume theirs in the path condition instead.
+func (b *bodyEncoder) callObligations(header, scope string, fields []*ir.Field, params []*ir.Param, requires []*ir.Contract) []*CallObligation {
+	var obligations []*CallObligation
+	for _, ob := range b.obligations {
+		var sb strings.Builder
+
+		sb.WriteString("; Call-site precondition in ")
+		sb.WriteString(header)
+		sb.WriteString("\n; Callee: ")
+		sb.WriteString(ob.callee)
+		sb.WriteString("\n; Contract: ")
+		sb.WriteString(ob.contract.RawText)
+		sb.WriteString("\n\n")
+
+		// Declare entity fields and parameters
+		for _, f := range fields {
+			declareConst(&sb, "self_"+f.Name, typeToSMTSort(f.Type))
+		}
+		for _, param := range params {
+			declareConst(&sb, param.Name, typeToSMTSort(param.Type))
+		}
+		writeDecls(&sb, b.decls)
+		sb.WriteString("\n")
+
+		if len(requires) > 0 {
+			sb.WriteString("; Requires (assumptions)\n")
+			for _, req := range requires {
+				writeAssumption(&sb, exprToSMT(req.Expr))
+			}
+			sb.WriteString("\n")
+		}
+
+		if len(ob.pc) > 0 {
+			sb.WriteString("; Path to call site\n")
+			for _, cond := range ob.pc {
+				sb.WriteString("(assert ")
+				sb.WriteString(cond)
+				sb.WriteString(")\n")
+			}
+			sb.WriteString("\n")
+		}
+
+		sb.WriteString("; Callee requires (negated for validity check)\n")
+		sb.WriteString("(assert (not ")
+		sb.WriteString(ob.goal)
+		sb.WriteString("))\n")
+
+		sb.WriteString("\n(check-sat)\n")
+
+		obligations = append(obligations, &CallObligation{
+			Callee:    ob.callee,
+			Contract:  ob.contract,
+			Scope:     scope,
+			SMT:       sb.String(),
+			Line:      ob.line,
+			Column:    ob.column,
+			EndLine:   ob.endLine,
+			EndColumn: ob.endColumn,
+		})
+	}
+	return obligations
+}
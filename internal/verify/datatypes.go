@@ -0,0 +1,169 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// Enums are modeled as SMT algebraic datatypes. Each variant is a
+// constructor qualified by its enum, so Light.Off and Door.Off stay
+// distinct, and each payload field a selector named <Enum>.<Variant>.<field>.
+// Option and Result are parametric datatypes shared by every instantiation,
+// so Option<Int> is the sort (Option Int), and keep their bare constructors.
+
+// builtinDatatypes declares Option<T> and Result<T, E>.
+const builtinDatatypes = `(declare-datatypes ((Option 1)) ((par (T) ((None) (Some (Some.value T))))))
+(declare-datatypes ((Result 2)) ((par (T E) ((Ok (Ok.value T)) (Err (Err.error E))))))
+`
+
+// TranslateDatatypes returns the declare-datatypes commands for Option,
+// Result and every enum visible from mod. prog may be nil for single-file
+// programs. The user enums are declared together so that they may refer to
+// one another. Enums are told apart by module and name; mod's own enums
+// take their bare names, and an enum of another module whose name is
+// already taken is declared under <Module>.<Enum>.
+func TranslateDatatypes(mod *ir.Module, prog *ir.Program) string {
+	type datatype struct {
+		sort string
+		enum *ir.Enum
+	}
+	var enums []datatype
+	seen := make(map[string]bool)
+	sorts := make(map[string]bool)
+	add := func(m *ir.Module) {
+		for _, e := range m.Enums {
+			key := m.Name + "." + e.Name
+			if seen[key] || len(e.Variants) == 0 {
+				continue
+			}
+			seen[key] = true
+			sort := e.Name
+			if sorts[sort] {
+				sort = key
+			}
+			sorts[sort] = true
+			enums = append(enums, datatype{sort, e})
+		}
+	}
+	add(mod)
+	if prog != nil {
+		for _, m := range prog.Modules {
+			add(m)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(builtinDatatypes)
+	if len(enums) == 0 {
+		return sb.String()
+	}
+	sb.WriteString("(declare-datatypes (")
+	for i, d := range enums {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		fmt.Fprintf(&sb, "(%s 0)", d.sort)
+	}
+	sb.WriteString(") (")
+	for i, d := range enums {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString("(")
+		for j, v := range d.enum.Variants {
+			if j > 0 {
+				sb.WriteString(" ")
+			}
+			ctor := d.sort + "." + v.Name
+			sb.WriteString("(")
+			sb.WriteString(ctor)
+			for _, f := range v.Fields {
+				fmt.Fprintf(&sb, " (%s %s)", selectorName(ctor, f.Name), typeToSMTSort(f.Type))
+			}
+			sb.WriteString(")")
+		}
+		sb.WriteString(")")
+	}
+	sb.WriteString("))\n")
+	return sb.String()
+}
+
+// datatypeSort returns the SMT sort of an enum type.
+func datatypeSort(t *checker.Type) string {
+	param := func(i int) string {
+		if i < len(t.TypeParams) {
+			return typeToSMTSort(t.TypeParams[i])
+		}
+		return "Int"
+	}
+	switch t.Name {
+	case "Option":
+		return "(Option " + param(0) + ")"
+	case "Result":
+		return "(Result " + param(0) + " " + param(1) + ")"
+	}
+	return t.Name
+}
+
+func isBuiltinEnum(t *checker.Type) bool {
+	return t.Name == "Option" || t.Name == "Result"
+}
+
+// variantCtor returns the constructor name of variant name of enum type t.
+func variantCtor(t *checker.Type, name string) string {
+	if isBuiltinEnum(t) {
+		return name
+	}
+	return datatypeSort(t) + "." + name
+}
+
+func selectorName(ctor, field string) string {
+	return ctor + "." + field
+}
+
+// enumVariant finds a variant of an enum type by name.
+func enumVariant(t *checker.Type, name string) (*checker.EnumVariantInfo, bool) {
+	if t == nil || t.EnumInfo == nil {
+		return nil, false
+	}
+	for _, v := range t.EnumInfo.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// isVariantCall reports whether e constructs an enum value.
+func isVariantCall(e *ir.CallExpr) bool {
+	switch e.Function {
+	case "Some", "None", "Ok", "Err":
+		return true
+	}
+	return e.Kind == ir.CallVariant
+}
+
+// variantTerm applies the constructor of variant name of enum type t to
+// already-translated arguments. Constructors of the parametric builtins are
+// qualified with their sort, since Ok(1) alone does not determine E.
+func variantTerm(name string, t *checker.Type, args []string) (string, bool) {
+	if _, ok := enumVariant(t, name); !ok {
+		return "", false
+	}
+	ctor := variantCtor(t, name)
+	if isBuiltinEnum(t) {
+		ctor = fmt.Sprintf("(as %s %s)", name, datatypeSort(t))
+	}
+	if len(args) == 0 {
+		return ctor, true
+	}
+	return "(" + ctor + " " + strings.Join(args, " ") + ")", true
+}
+
+// testerTerm holds when term was built by the given constructor.
+func testerTerm(ctor, term string) string {
+	return fmt.Sprintf("((_ is %s) %s)", ctor, term)
+}
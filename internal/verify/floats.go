@@ -0,0 +1,202 @@
+package verify
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lhaig/intent/internal/ir"
+	"github.com/lhaig/intent/internal/lexer"
+)
+
+// FloatModel selects how the verifier reasons about Float.
+type FloatModel string
+
+const (
+	// FloatReal treats Float as the mathematical reals: no rounding, NaN or
+	// infinity. Proofs are fast but may not hold for f64. This is the default.
+	FloatReal FloatModel = "real"
+	// FloatIEEE treats Float as IEEE-754 binary64 with round-to-nearest-even,
+	// matching f64 in every target.
+	FloatIEEE FloatModel = "ieee"
+)
+
+// ParseFloatModel parses the value of --float-model.
+func ParseFloatModel(s string) (FloatModel, error) {
+	switch FloatModel(s) {
+	case FloatReal, FloatIEEE:
+		return FloatModel(s), nil
+	}
+	return "", fmt.Errorf("unknown float model: %s (expected real or ieee)", s)
+}
+
+// Float terms are written against the sort Float and the float.* functions
+// below, whatever the model. The preamble of each model defines them, so a
+// query is translated once and the model only changes its declarations.
+
+const realFloatPreamble = `(define-sort Float () Real)
+(define-fun float.lit ((r Real)) Float r)
+(define-fun float.add ((a Float) (b Float)) Float (+ a b))
+(define-fun float.sub ((a Float) (b Float)) Float (- a b))
+(define-fun float.mul ((a Float) (b Float)) Float (* a b))
+(define-fun float.div ((a Float) (b Float)) Float (/ a b))
+(define-fun float.rem ((a Float) (b Float)) Float (let ((q (/ a b))) (- a (* b (ite (>= q 0.0) (to_real (to_int q)) (- (to_real (to_int (- q)))))))))
+(define-fun float.neg ((a Float)) Float (- a))
+(define-fun float.eq ((a Float) (b Float)) Bool (= a b))
+(define-fun float.lt ((a Float) (b Float)) Bool (< a b))
+(define-fun float.leq ((a Float) (b Float)) Bool (<= a b))
+`
+
+// ieeeFloatPreamble follows f64: == is IEEE equality, so NaN is unequal to
+// itself and -0.0 equals 0.0, and % truncates like fmod rather than
+// rounding like fp.rem.
+const ieeeFloatPreamble = `(define-sort Float () (_ FloatingPoint 11 53))
+(define-fun float.lit ((r Real)) Float ((_ to_fp 11 53) RNE r))
+(define-fun float.add ((a Float) (b Float)) Float (fp.add RNE a b))
+(define-fun float.sub ((a Float) (b Float)) Float (fp.sub RNE a b))
+(define-fun float.mul ((a Float) (b Float)) Float (fp.mul RNE a b))
+(define-fun float.div ((a Float) (b Float)) Float (fp.div RNE a b))
+(define-fun float.rem ((a Float) (b Float)) Float (let ((r (fp.rem a b))) (ite (and (fp.isPositive a) (fp.isNegative r) (not (fp.isZero r))) (fp.add RNE r (fp.abs b)) (ite (and (fp.isNegative a) (fp.isPositive r) (not (fp.isZero r))) (fp.sub RNE r (fp.abs b)) r))))
+(define-fun float.neg ((a Float)) Float (fp.neg a))
+(define-fun float.eq ((a Float) (b Float)) Bool (fp.eq a b))
+(define-fun float.lt ((a Float) (b Float)) Bool (fp.lt a b))
+(define-fun float.leq ((a Float) (b Float)) Bool (fp.leq a b))
+`
+
+// floatPreamble returns the definitions of Float for a model.
+func floatPreamble(m FloatModel) string {
+	if m == FloatIEEE {
+		return ieeeFloatPreamble
+	}
+	return realFloatPreamble
+}
+
+// usesFloat reports whether a query reasons about Float values.
+func usesFloat(smtLib string) bool {
+	return strings.Contains(smtLib, " Float") || strings.Contains(smtLib, "(float.")
+}
+
+// isFloatExpr reports whether e has type Float.
+func isFloatExpr(e ir.Expr) bool {
+	t := e.ExprType()
+	return t != nil && t.Name == "Float"
+}
+
+func floatLit(value string) string {
+	return "(float.lit " + value + ")"
+}
+
+// binaryTerm applies the operator of e to already-translated operands,
+// using the float.* functions when they are Float.
+func binaryTerm(e *ir.BinaryExpr, left, right string) string {
+	if isFloatExpr(e.Left) {
+		return floatOpToSMT(e.Op, left, right)
+	}
+	return binaryOpToSMT(e.Op, left, right)
+}
+
+// unaryTerm applies the operator of e to an already-translated operand.
+func unaryTerm(e *ir.UnaryExpr, operand string) string {
+	if e.Op == lexer.MINUS && isFloatExpr(e.Operand) {
+		return "(float.neg " + operand + ")"
+	}
+	return unaryOpToSMT(e.Op, operand)
+}
+
+// floatOpToSMT applies a binary operator to already-translated Float
+// operands. Comparisons are built from float.lt and float.leq, which are
+// false when either side is NaN, just as in f64.
+func floatOpToSMT(op lexer.TokenType, left, right string) string {
+	switch op {
+	case lexer.PLUS:
+		return fmt.Sprintf("(float.add %s %s)", left, right)
+	case lexer.MINUS:
+		return fmt.Sprintf("(float.sub %s %s)", left, right)
+	case lexer.STAR:
+		return fmt.Sprintf("(float.mul %s %s)", left, right)
+	case lexer.SLASH:
+		return fmt.Sprintf("(float.div %s %s)", left, right)
+	case lexer.PERCENT:
+		return fmt.Sprintf("(float.rem %s %s)", left, right)
+	case lexer.EQ:
+		return fmt.Sprintf("(float.eq %s %s)", left, right)
+	case lexer.NEQ:
+		return fmt.Sprintf("(not (float.eq %s %s))", left, right)
+	case lexer.LT:
+		return fmt.Sprintf("(float.lt %s %s)", left, right)
+	case lexer.LEQ:
+		return fmt.Sprintf("(float.leq %s %s)", left, right)
+	case lexer.GT:
+		return fmt.Sprintf("(float.lt %s %s)", right, left)
+	case lexer.GEQ:
+		return fmt.Sprintf("(float.leq %s %s)", right, left)
+	default:
+		return binaryOpToSMT(op, left, right)
+	}
+}
+
+// renderFloatValue turns an IEEE model value such as
+// (fp #b0 #b01111111111 #x8000000000000) or (_ NaN 11 53) into decimal text.
+func renderFloatValue(e *sexpr) (string, bool) {
+	if len(e.list) == 4 && e.list[0].atom == "_" && e.list[2].atom == "11" && e.list[3].atom == "53" {
+		switch e.list[1].atom {
+		case "NaN":
+			return "NaN", true
+		case "+oo":
+			return "+Inf", true
+		case "-oo":
+			return "-Inf", true
+		case "+zero":
+			return "0.0", true
+		case "-zero":
+			return "-0.0", true
+		}
+		return "", false
+	}
+	if len(e.list) != 4 || e.list[0].atom != "fp" {
+		return "", false
+	}
+	var bits uint64
+	width := 0
+	for _, part := range e.list[1:] {
+		v, n, ok := parseBitvector(part.atom)
+		if !ok {
+			return "", false
+		}
+		bits = bits<<uint(n) | v
+		width += n
+	}
+	if width != 64 {
+		return "", false
+	}
+	f := math.Float64frombits(bits)
+	text := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(text, ".eIN") {
+		text += ".0"
+	}
+	return text, true
+}
+
+// parseBitvector reads an SMT-LIB #b or #x literal, returning its value and
+// width in bits.
+func parseBitvector(atom string) (uint64, int, bool) {
+	var digits string
+	var base, bitsPerDigit int
+	switch {
+	case strings.HasPrefix(atom, "#b"):
+		digits, base, bitsPerDigit = atom[2:], 2, 1
+	case strings.HasPrefix(atom, "#x"):
+		digits, base, bitsPerDigit = atom[2:], 16, 4
+	default:
+		return 0, 0, false
+	}
+	if digits == "" {
+		return 0, 0, false
+	}
+	v, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return v, len(digits) * bitsPerDigit, true
+}
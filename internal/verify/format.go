@@ -0,0 +1,274 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+)
+
+// Machine-readable forms of a verification run. FormatJSON keeps every
+// result for tools that track contracts over time; FormatSARIF reports only
+// the failures, in the form code scanning services annotate inline.
+
+// jsonReport is the document written by FormatJSON.
+type jsonReport struct {
+	Results []jsonResult `json:"results"`
+	Intents []jsonIntent `json:"intents"`
+	Summary jsonSummary  `json:"summary"`
+}
+
+type jsonResult struct {
+	Name           string       `json:"name"`
+	Entity         string       `json:"entity,omitempty"`
+	Function       string       `json:"function,omitempty"`
+	Kind           string       `json:"kind"`
+	Contract       string       `json:"contract"`
+	Status         string       `json:"status"`
+	Message        string       `json:"message,omitempty"`
+	File           string       `json:"file,omitempty"`
+	Line           int          `json:"line,omitempty"`
+	Column         int          `json:"column,omitempty"`
+	EndLine        int          `json:"end_line,omitempty"`
+	EndColumn      int          `json:"end_column,omitempty"`
+	Counterexample []ModelValue `json:"counterexample,omitempty"`
+	FloatModel     FloatModel   `json:"float_model,omitempty"`
+	Solver         string       `json:"solver,omitempty"`
+	SolverVersion  string       `json:"solver_version,omitempty"`
+	Cached         bool         `json:"cached"`
+}
+
+type jsonIntent struct {
+	Description string       `json:"description"`
+	Verified    bool         `json:"verified"`
+	Refs        []*RefStatus `json:"refs"`
+}
+
+type jsonSummary struct {
+	Verified   int `json:"verified"`
+	Unverified int `json:"unverified"`
+	Timeouts   int `json:"timeouts"`
+	Errors     int `json:"errors"`
+	Cached     int `json:"cached"`
+}
+
+// FormatJSON renders results and the intent rollup built from them as an
+// indented JSON document.
+func FormatJSON(results []*VerifyResult, reports []*IntentReport) ([]byte, error) {
+	doc := jsonReport{Results: []jsonResult{}, Intents: []jsonIntent{}}
+	for _, r := range results {
+		doc.Results = append(doc.Results, jsonResult{
+			Name:           r.QualifiedName(),
+			Entity:         r.EntityName,
+			Function:       r.FunctionName,
+			Kind:           r.ContractKind,
+			Contract:       r.ContractText,
+			Status:         r.Status,
+			Message:        r.Message,
+			File:           filepath.ToSlash(r.File),
+			Line:           r.Line,
+			Column:         r.Column,
+			EndLine:        r.EndLine,
+			EndColumn:      r.EndColumn,
+			Counterexample: r.Counterexample,
+			FloatModel:     r.FloatModel,
+			Solver:         r.Solver,
+			SolverVersion:  r.SolverVersion,
+			Cached:         r.Cached,
+		})
+		switch r.Status {
+		case "verified":
+			doc.Summary.Verified++
+		case "unverified":
+			doc.Summary.Unverified++
+		case "timeout":
+			doc.Summary.Timeouts++
+		case "error":
+			doc.Summary.Errors++
+		}
+		if r.Cached {
+			doc.Summary.Cached++
+		}
+	}
+	for _, rep := range reports {
+		refs := rep.Refs
+		if refs == nil {
+			refs = []*RefStatus{}
+		}
+		doc.Intents = append(doc.Intents, jsonIntent{
+			Description: rep.Description,
+			Verified:    rep.AllVerified(),
+			Refs:        refs,
+		})
+	}
+	return marshalIndent(doc)
+}
+
+// sarifRules describes each contract kind as a SARIF rule.
+var sarifRules = []struct{ id, description string }{
+	{"requires", "Precondition is satisfiable"},
+	{"ensures", "Postcondition holds on every path"},
+	{"invariant", "Entity invariant is consistent"},
+	{"invariant_preserved", "Constructor and methods preserve the entity invariant"},
+	{"loop_invariant", "Loop invariant holds on entry and is preserved"},
+	{"call_requires", "Callee precondition holds at the call site"},
+	{"subtype_requires", "Implementation requires no more than the trait method"},
+	{"subtype_ensures", "Implementation guarantees the trait method's ensures"},
+	{"overflow", "Int arithmetic does not overflow"},
+	{"div_by_zero", "Divisor is never zero"},
+	{"bounds", "Array index is in bounds"},
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// FormatSARIF renders results as a SARIF 2.1.0 log. Unverified contracts
+// are errors and timeouts warnings, each located at its clause, call or
+// operation; verified contracts are omitted. Solver errors are reported as
+// tool notifications rather than findings, since they say nothing about
+// the code.
+func FormatSARIF(results []*VerifyResult) ([]byte, error) {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "intentc",
+			InformationURI: "https://github.com/lhaig/intent",
+		}},
+		Results: []sarifResult{},
+	}
+	for _, rule := range sarifRules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               rule.id,
+			ShortDescription: sarifMessage{Text: rule.description},
+		})
+	}
+
+	invocation := sarifInvocation{ExecutionSuccessful: true}
+	for _, r := range results {
+		switch r.Status {
+		case "unverified", "timeout":
+			level := "error"
+			if r.Status == "timeout" {
+				level = "warning"
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    r.ContractKind,
+				Level:     level,
+				Message:   sarifMessage{Text: fmt.Sprintf("%s: %s: %s", r.QualifiedName(), r.ContractText, r.Message)},
+				Locations: sarifLocations(r),
+			})
+		case "error":
+			invocation.ExecutionSuccessful = false
+			invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, sarifNotification{
+				Level:     "error",
+				Message:   sarifMessage{Text: r.Message},
+				Locations: sarifLocations(r),
+			})
+		}
+	}
+	run.Invocations = []sarifInvocation{invocation}
+
+	return marshalIndent(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+// sarifLocations locates a result at its clause, call or operation, or at
+// its file alone when the position is unknown.
+func sarifLocations(r *VerifyResult) []sarifLocation {
+	if r.File == "" {
+		return nil
+	}
+	loc := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(r.File)},
+	}}
+	if r.Line > 0 {
+		loc.PhysicalLocation.Region = &sarifRegion{
+			StartLine:   r.Line,
+			StartColumn: r.Column,
+			EndLine:     r.EndLine,
+			EndColumn:   r.EndColumn,
+		}
+	}
+	return []sarifLocation{loc}
+}
+
+// marshalIndent encodes v as indented JSON, leaving the comparison
+// operators in contract text unescaped.
+func marshalIndent(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,81 @@
+package verify
+
+import (
+	"fmt"
+
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// Maps are modeled by their key sets: an SMT array from keys to Bool that
+// holds for the keys present, paired with a <map>@len constant as arrays
+// are. That is enough for contains, len and quantifiers over the keys.
+// Values are not modeled, so get yields an unconstrained option and the
+// loop variable for a value is unconstrained. set and remove, like push,
+// rebind the map to a fresh constant defined over the previous one.
+
+func isMapType(t *checker.Type) bool {
+	return checker.IsMap(t)
+}
+
+// hasLen reports whether values of type t are paired with a length constant.
+func hasLen(t *checker.Type) bool {
+	return isArrayType(t) || isMapType(t)
+}
+
+// mapKeySort returns the sort of the keys of a map type.
+func mapKeySort(t *checker.Type) string {
+	if isMapType(t) {
+		return typeToSMTSort(t.TypeParams[0])
+	}
+	return "Int"
+}
+
+// isContains reports whether m tests a map for a key.
+func isContains(m *ir.MethodCallExpr) bool {
+	return !m.IsModuleCall && m.Method == "contains" && len(m.Args) == 1 && isMapType(m.Object.ExprType())
+}
+
+// isMapUpdate reports whether m adds or removes a key of a map in place.
+func isMapUpdate(m *ir.MethodCallExpr) bool {
+	if m.IsModuleCall || !isMapType(m.Object.ExprType()) {
+		return false
+	}
+	return m.Method == "set" && len(m.Args) == 2 || m.Method == "remove" && len(m.Args) == 1
+}
+
+// mapQuantifierTerm quantifies body over the keys present in the map term m.
+func mapQuantifierTerm(kind, variable, keySort, m, body string) string {
+	if kind == "forall" {
+		return fmt.Sprintf("(forall ((%s %s)) (=> (select %s %s) %s))", variable, keySort, m, variable, body)
+	}
+	return fmt.Sprintf("(exists ((%s %s)) (and (select %s %s) %s))", variable, keySort, m, variable, body)
+}
+
+// updateMap executes place.set(key, value) or place.remove(key) on path st.
+// The value of set is evaluated for its obligations only.
+func (b *bodyEncoder) updateMap(m *ir.MethodCallExpr, st *symState) {
+	old := b.eval(m.Object, st)
+	key := b.eval(m.Args[0], st)
+	if m.Method == "set" {
+		b.eval(m.Args[1], st)
+	}
+	place, ok := placeKey(m.Object)
+	if !ok {
+		return
+	}
+
+	n := b.lenOf(old)
+	present := fmt.Sprintf("(select %s %s)", old, key)
+	updated := b.freshConst(place, m.Object.ExprType())
+	if m.Method == "set" {
+		st.pc = append(st.pc,
+			fmt.Sprintf("(= %s (store %s %s true))", updated, old, key),
+			fmt.Sprintf("(= %s (ite %s %s (+ %s 1)))", arrayLen(updated), present, n, n))
+	} else {
+		st.pc = append(st.pc,
+			fmt.Sprintf("(= %s (store %s %s false))", updated, old, key),
+			fmt.Sprintf("(= %s (ite %s (- %s 1) %s))", arrayLen(updated), present, n, n))
+	}
+	st.env[place] = updated
+}
@@ -0,0 +1,238 @@
+package verify
+
+import (
+	"strings"
+
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// ModelValue is a single assignment taken from a solver counterexample.
+type ModelValue struct {
+	Name  string `json:"name"`  // source-level name, e.g. "amount", "self.balance", "old(self.balance)", "result"
+	Value string `json:"value"` // rendered value, e.g. "-1", "true", "3/2"
+}
+
+// modelName pairs an SMT constant with the name shown to the user.
+type modelName struct {
+	smt     string
+	display string
+}
+
+// FormatCounterexample renders the counterexample as "a = 1, self.b = 0".
+// It returns "" when no counterexample is available.
+func (r *VerifyResult) FormatCounterexample() string {
+	parts := make([]string, len(r.Counterexample))
+	for i, v := range r.Counterexample {
+		parts[i] = v.Name + " = " + v.Value
+	}
+	return strings.Join(parts, ", ")
+}
+
+// attachCounterexample converts the raw model captured by the solver run into
+// user-facing values, keeping only the named constants in declaration order.
+// Fresh constants introduced by body encoding are intentionally dropped.
+func attachCounterexample(r *VerifyResult, names []modelName) {
+	if len(r.model) == 0 {
+		return
+	}
+	for _, n := range names {
+		if v, ok := r.model[n.smt]; ok {
+			r.Counterexample = append(r.Counterexample, ModelValue{Name: n.display, Value: v})
+		}
+	}
+	if len(r.Counterexample) > 0 {
+		r.Message = "counterexample found: fails when " + r.FormatCounterexample()
+	}
+}
+
+// functionModelNames lists the constants declared for a function VC.
+func functionModelNames(fn *ir.Function) []modelName {
+	var names []modelName
+	for _, p := range fn.Params {
+		names = append(names, paramModelNames(p.Name, p.Name, p.Type)...)
+	}
+	if fn.ReturnType != nil && fn.ReturnType.Name != "Void" {
+		names = append(names, modelName{smt: "result", display: "result"})
+	}
+	return names
+}
+
+// entityModelNames lists the constants declared for an entity VC: params,
+// self fields, old() captures and result.
+func entityModelNames(fields []*ir.Field, params []*ir.Param, oldCaptures []*ir.OldCapture, returnType bool) []modelName {
+	var names []modelName
+	for _, p := range params {
+		names = append(names, paramModelNames(p.Name, p.Name, p.Type)...)
+	}
+	for _, f := range fields {
+		names = append(names, paramModelNames("self_"+f.Name, "self."+f.Name, f.Type)...)
+	}
+	for _, oc := range oldCaptures {
+		names = append(names, modelName{smt: oc.Name, display: "old(" + exprText(oc.Expr) + ")"})
+	}
+	if returnType {
+		names = append(names, modelName{smt: "result", display: "result"})
+	}
+	return names
+}
+
+// paramModelNames lists the constants behind one parameter or field: the
+// value itself and, for arrays and maps, its length.
+func paramModelNames(smt, display string, t *checker.Type) []modelName {
+	names := []modelName{{smt: smt, display: display}}
+	if hasLen(t) {
+		names = append(names, modelName{smt: smt + "@len", display: "len(" + display + ")"})
+	}
+	return names
+}
+
+// exprText renders simple place expressions back to source form.
+func exprText(e ir.Expr) string {
+	switch x := e.(type) {
+	case *ir.VarRef:
+		return x.Name
+	case *ir.SelfRef:
+		return "self"
+	case *ir.FieldAccessExpr:
+		return exprText(x.Object) + "." + x.Field
+	default:
+		return "..."
+	}
+}
+
+// --- SMT-LIB model parsing ---
+
+// sexpr is a parsed S-expression: either an atom or a list.
+type sexpr struct {
+	atom string
+	list []*sexpr
+}
+
+func (s *sexpr) isAtom() bool { return s.list == nil }
+
+func (s *sexpr) String() string {
+	if s.isAtom() {
+		return s.atom
+	}
+	parts := make([]string, len(s.list))
+	for i, c := range s.list {
+		parts[i] = c.String()
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// parseModel extracts nullary define-fun entries from a (get-model) response.
+// Both the bare "( (define-fun ...) )" form and the older "(model ...)" form
+// are accepted.
+func parseModel(text string) map[string]string {
+	toks := tokenizeSExpr(text)
+	values := make(map[string]string)
+	pos := 0
+	for pos < len(toks) {
+		expr, next := parseSExpr(toks, pos)
+		if next <= pos {
+			break
+		}
+		pos = next
+		collectDefineFuns(expr, values)
+	}
+	return values
+}
+
+func collectDefineFuns(e *sexpr, values map[string]string) {
+	if e == nil || e.isAtom() {
+		return
+	}
+	if len(e.list) == 5 && e.list[0].atom == "define-fun" && e.list[2].list != nil && len(e.list[2].list) == 0 {
+		values[unquoteSymbol(e.list[1].atom)] = renderValue(e.list[4])
+		return
+	}
+	for _, c := range e.list {
+		collectDefineFuns(c, values)
+	}
+}
+
+// renderValue turns model values such as (- 1), (/ 1.0 2.0) or IEEE
+// floating-point literals into readable text.
+func renderValue(e *sexpr) string {
+	if e.isAtom() {
+		return e.atom
+	}
+	if f, ok := renderFloatValue(e); ok {
+		return f
+	}
+	if len(e.list) == 2 && e.list[0].atom == "-" {
+		return "-" + renderValue(e.list[1])
+	}
+	if len(e.list) == 3 && e.list[0].atom == "/" {
+		return renderValue(e.list[1]) + "/" + renderValue(e.list[2])
+	}
+	return e.String()
+}
+
+func unquoteSymbol(s string) string {
+	if len(s) >= 2 && s[0] == '|' && s[len(s)-1] == '|' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func tokenizeSExpr(text string) []string {
+	var toks []string
+	i := 0
+	for i < len(text) {
+		c := text[i]
+		switch {
+		case c == '(' || c == ')':
+			toks = append(toks, string(c))
+			i++
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == ';':
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case c == '|' || c == '"':
+			j := i + 1
+			for j < len(text) && text[j] != c {
+				j++
+			}
+			if j < len(text) {
+				j++
+			}
+			toks = append(toks, text[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(text) && !strings.ContainsRune("() \t\n\r;", rune(text[j])) {
+				j++
+			}
+			toks = append(toks, text[i:j])
+			i = j
+		}
+	}
+	return toks
+}
+
+// parseSExpr parses one S-expression starting at toks[pos] and returns it
+// together with the index of the next unconsumed token.
+func parseSExpr(toks []string, pos int) (*sexpr, int) {
+	if pos >= len(toks) {
+		return nil, pos
+	}
+	if toks[pos] == ")" {
+		return nil, pos + 1
+	}
+	if toks[pos] != "(" {
+		return &sexpr{atom: toks[pos]}, pos + 1
+	}
+	node := &sexpr{list: []*sexpr{}}
+	pos++
+	for pos < len(toks) && toks[pos] != ")" {
+		child, next := parseSExpr(toks, pos)
+		node.list = append(node.list, child)
+		pos = next
+	}
+	return node, pos + 1
+}
@@ -9,9 +9,9 @@ import (
 
 // RefStatus holds the verification status of a single verified_by reference.
 type RefStatus struct {
-	Ref     string // e.g., "BankAccount.invariant"
-	Status  string // "verified", "unverified", "error", "timeout", "not_found"
-	Message string
+	Ref     string `json:"ref"`    // e.g., "BankAccount.invariant"
+	Status  string `json:"status"` // "verified", "unverified", "error", "timeout", "not_found"
+	Message string `json:"message,omitempty"`
 }
 
 // IntentReport holds the verification report for a single intent block.
@@ -56,6 +56,15 @@ func BuildIntentReports(mod *ir.Module, results []*VerifyResult) []*IntentReport
 			refStr := strings.Join(parts, ".")
 			matched := resultsByQualified[refStr]
 
+			// An entity invariant is established inductively: it holds when the
+			// constructor establishes it and every method preserves it. Those
+			// proofs stand in for the isolated invariant check when present.
+			if len(parts) == 2 && parts[1] == "invariant" {
+				if preserved := preservationResults(results, parts[0]); len(preserved) > 0 {
+					matched = preserved
+				}
+			}
+
 			if len(matched) == 0 {
 				report.Refs = append(report.Refs, &RefStatus{
 					Ref:     refStr,
@@ -90,6 +99,17 @@ func BuildIntentReports(mod *ir.Module, results []*VerifyResult) []*IntentReport
 	return reports
 }
 
+// preservationResults returns the invariant_preserved results for an entity.
+func preservationResults(results []*VerifyResult, entityName string) []*VerifyResult {
+	var matched []*VerifyResult
+	for _, r := range results {
+		if r.EntityName == entityName && r.ContractKind == "invariant_preserved" {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
 // statusWorse returns true if a is worse than b in the ordering:
 // verified < timeout < unverified < error < not_found
 func statusWorse(a, b string) bool {
@@ -0,0 +1,280 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+	"github.com/lhaig/intent/internal/lexer"
+)
+
+// Runtime safety checks. Intent's Int is a 64-bit signed integer at
+// runtime, while the SMT encoding uses unbounded integers, so every Int
+// operation carries a side condition: + - * and unary minus must produce a
+// value in range, / and % must not divide by zero, and MIN / -1 (or
+// MIN % -1) must not occur. Every array index must also be within bounds.
+const (
+	i64Min = "(- 9223372036854775808)"
+	i64Max = "9223372036854775807"
+)
+
+// safetySite is one operation whose side condition can fail.
+type safetySite struct {
+	kind      string  // "overflow", "div_by_zero" or "bounds"
+	node      ir.Expr // *ir.BinaryExpr, *ir.UnaryExpr or *ir.IndexExpr
+	violation string  // holds when the operation traps on the path reaching it
+}
+
+// boundVar is a quantifier variable in scope while encoding its body.
+type boundVar struct {
+	name       string
+	start, end string // range bounds, or empty
+	keys, sort string // map whose keys the variable ranges over and their sort, or empty
+	pcLen      int    // length of the path condition when the quantifier began
+}
+
+// SafetyObligation is the side condition of one operation, together with
+// the SMT-LIB query that proves it. A query covers every path that reaches
+// the operation.
+type SafetyObligation struct {
+	Kind   string // "overflow", "div_by_zero" or "bounds"
+	Scope  string // method name, "constructor", or "" for entity invariants and functions
+	Expr   ir.Expr
+	Line   int
+	Column int
+	// EndLine and EndColumn are just past the operator, or the opening
+	// bracket of an index
+	EndLine   int
+	EndColumn int
+	SMT       string
+}
+
+// inI64 returns the constraint that term is a valid Int value.
+func inI64(term string) string {
+	return fmt.Sprintf("(and (<= %s %s) (<= %s %s))", i64Min, term, term, i64Max)
+}
+
+func isIntExpr(e ir.Expr) bool {
+	t := e.ExprType()
+	return t != nil && t.Name == "Int"
+}
+
+// checkArith records the side conditions of an Int binary operation.
+func (b *bodyEncoder) checkArith(x *ir.BinaryExpr, left, right string) {
+	if !isIntExpr(x.Left) {
+		return
+	}
+	switch x.Op {
+	case lexer.PLUS, lexer.MINUS, lexer.STAR:
+		b.addSafetySite("overflow", x, inI64(binaryOpToSMT(x.Op, left, right)))
+	case lexer.SLASH, lexer.PERCENT:
+		b.addSafetySite("div_by_zero", x, fmt.Sprintf("(not (= %s 0))", right))
+		b.addSafetySite("overflow", x, fmt.Sprintf("(not (and (= %s %s) (= %s (- 1))))", left, i64Min, right))
+	}
+}
+
+// checkNeg records the side condition of Int negation. Negated literals are
+// always in range.
+func (b *bodyEncoder) checkNeg(x *ir.UnaryExpr, operand string) {
+	if x.Op != lexer.MINUS || !isIntExpr(x.Operand) {
+		return
+	}
+	if _, ok := x.Operand.(*ir.IntLit); ok {
+		return
+	}
+	b.addSafetySite("overflow", x, fmt.Sprintf("(not (= %s %s))", operand, i64Min))
+}
+
+// checkBounds records that idx must be a valid index into arr.
+func (b *bodyEncoder) checkBounds(x *ir.IndexExpr, arr, idx string) {
+	b.addSafetySite("bounds", x, fmt.Sprintf("(and (<= 0 %s) (< %s %s))", idx, idx, b.lenOf(arr)))
+}
+
+// addSafetySite records that goal must hold at the current path condition.
+// Inside a quantifier the violation is existentially closed over the bound
+// variable, with the conditions gathered inside the quantifier body.
+func (b *bodyEncoder) addSafetySite(kind string, node ir.Expr, goal string) {
+	pc := append(append([]string{}, b.pc...), b.assumptions...)
+	violation := "(not " + goal + ")"
+	for i := len(b.bound) - 1; i >= 0; i-- {
+		q := b.bound[i]
+		var inner []string
+		sort := "Int"
+		if q.start != "" {
+			inner = append(inner, fmt.Sprintf("(>= %s %s)", q.name, q.start), fmt.Sprintf("(< %s %s)", q.name, q.end))
+		}
+		if q.keys != "" {
+			inner = append(inner, fmt.Sprintf("(select %s %s)", q.keys, q.name))
+			sort = q.sort
+		}
+		inner = append(append(inner, pc[q.pcLen:]...), violation)
+		violation = fmt.Sprintf("(exists ((%s %s)) %s)", q.name, sort, smtAnd(inner))
+		pc = pc[:q.pcLen]
+	}
+	b.safety = append(b.safety, &safetySite{kind: kind, node: node, violation: smtAnd(append(pc, violation))})
+}
+
+// TranslateSafetyChecks generates one query per side condition of every Int
+// operation and array index in fn's contracts and body. Each requires is checked under the
+// ones before it, the body under all of them, and each ensures on every path
+// that returns.
+func TranslateSafetyChecks(fn *ir.Function, callees ContractTable) []*SafetyObligation {
+	enc := newBodyEncoder(nil, fn.ReturnType, callees)
+	enc.encodeCallable(fn.Params, fn.ReturnType, nil, fn.Requires, fn.Ensures, nil, fn.Body)
+	return enc.safetyObligations("function: "+fn.Name, "", nil, fn.Params)
+}
+
+// TranslateEntitySafetyChecks generates the side conditions of every Int
+// operation and array index in an entity: its invariants, its constructor and its methods.
+// Method bodies assume the invariants on entry.
+func TranslateEntitySafetyChecks(ent *ir.Entity, callees ContractTable) []*SafetyObligation {
+	var obligations []*SafetyObligation
+
+	enc := newBodyEncoder(ent.Fields, nil, callees)
+	st := enc.initialState(nil)
+	for _, inv := range ent.Invariants {
+		st.pc = append(st.pc, enc.eval(inv.Expr, st))
+	}
+	obligations = append(obligations, enc.safetyObligations("entity: "+ent.Name, "", ent.Fields, nil)...)
+
+	if ctor := ent.Constructor; ctor != nil {
+		enc := newBodyEncoder(ent.Fields, nil, callees)
+		enc.encodeCallable(ctor.Params, nil, nil, ctor.Requires, ctor.Ensures, ctor.OldCaptures, ctor.Body)
+		obligations = append(obligations, enc.safetyObligations("constructor: "+ent.Name, "constructor", ent.Fields, ctor.Params)...)
+	}
+	for _, m := range ent.Methods {
+		enc := newBodyEncoder(ent.Fields, m.ReturnType, callees)
+		enc.encodeCallable(m.Params, m.ReturnType, ent.Invariants, m.Requires, m.Ensures, m.OldCaptures, m.Body)
+		obligations = append(obligations, enc.safetyObligations("method: "+ent.Name+"."+m.Name, m.Name, ent.Fields, m.Params)...)
+	}
+	return obligations
+}
+
+// encodeCallable symbolically executes a callable in the order its checks
+// run, recording the safety sites of its contracts and body. Operations
+// in the assumed invariants are checked with the invariants themselves.
+func (b *bodyEncoder) encodeCallable(params []*ir.Param, returnType *checker.Type, invariants, requires, ensures []*ir.Contract, oldCaptures []*ir.OldCapture, body []ir.Stmt) {
+	st := b.initialState(params)
+	for _, inv := range invariants {
+		st.pc = append(st.pc, b.eval(inv.Expr, st))
+	}
+	b.safety = nil
+	for _, req := range requires {
+		st.pc = append(st.pc, b.eval(req.Expr, st))
+	}
+	for _, oc := range oldCaptures {
+		st.env[oc.Name] = b.eval(oc.Expr, st)
+	}
+
+	paths := b.execBody(body, st)
+	hasResult := returnType != nil && returnType.Name != "Void"
+	for _, ens := range ensures {
+		for _, p := range paths {
+			if hasResult && p.result == "" {
+				continue
+			}
+			post := p.clone()
+			if hasResult {
+				post.env["result"] = p.result
+			}
+			b.eval(ens.Expr, post)
+		}
+	}
+}
+
+// safetyObligations builds one query per (operation, kind), covering every
+// path on which the operation was reached.
+func (b *bodyEncoder) safetyObligations(header, scope string, fields []*ir.Field, params []*ir.Param) []*SafetyObligation {
+	type key struct {
+		node ir.Expr
+		kind string
+	}
+	var order []key
+	violations := make(map[key][]string)
+	for _, s := range b.safety {
+		k := key{s.node, s.kind}
+		if _, seen := violations[k]; !seen {
+			order = append(order, k)
+		}
+		violations[k] = append(violations[k], s.violation)
+	}
+
+	var obligations []*SafetyObligation
+	for _, k := range order {
+		line, col := exprPosition(k.node)
+		text := ir.FormatExpr(k.node)
+
+		var sb strings.Builder
+		sb.WriteString("; Safety check in ")
+		sb.WriteString(header)
+		fmt.Fprintf(&sb, "\n; Check: %s of %s (line %d:%d)\n\n", k.kind, text, line, col)
+
+		consts := make([]smtDecl, 0, len(params)+len(fields)+len(b.decls))
+		for _, param := range params {
+			consts = append(consts, smtDecl{Name: param.Name, Sort: typeToSMTSort(param.Type)})
+		}
+		for _, f := range fields {
+			consts = append(consts, smtDecl{Name: "self_" + f.Name, Sort: typeToSMTSort(f.Type)})
+		}
+		consts = append(consts, b.decls...)
+		writeDecls(&sb, consts)
+		sb.WriteString("\n")
+
+		var ranges []string
+		for _, c := range consts {
+			switch c.Sort {
+			case "Int":
+				ranges = append(ranges, inI64(c.Name))
+			case "(Array Int Int)":
+				ranges = append(ranges, fmt.Sprintf("(forall ((k Int)) %s)", inI64("(select "+c.Name+" k)")))
+			}
+		}
+		if len(ranges) > 0 {
+			sb.WriteString("; Int values are 64-bit\n")
+			for _, r := range ranges {
+				sb.WriteString("(assert ")
+				sb.WriteString(r)
+				sb.WriteString(")\n")
+			}
+			sb.WriteString("\n")
+		}
+
+		sb.WriteString("; Operation fails on some path reaching it\n")
+		sb.WriteString("(assert ")
+		if vs := violations[k]; len(vs) == 1 {
+			sb.WriteString(vs[0])
+		} else {
+			sb.WriteString("(or " + strings.Join(vs, " ") + ")")
+		}
+		sb.WriteString(")\n")
+		sb.WriteString("\n(check-sat)\n")
+
+		ob := &SafetyObligation{
+			Kind:   k.kind,
+			Scope:  scope,
+			Expr:   k.node,
+			Line:   line,
+			Column: col,
+			SMT:    sb.String(),
+		}
+		if line > 0 {
+			// Arithmetic operators and brackets are one character wide
+			ob.EndLine, ob.EndColumn = line, col+1
+		}
+		obligations = append(obligations, ob)
+	}
+	return obligations
+}
+
+func exprPosition(e ir.Expr) (int, int) {
+	switch x := e.(type) {
+	case *ir.BinaryExpr:
+		return x.Line, x.Column
+	case *ir.UnaryExpr:
+		return x.Line, x.Column
+	case *ir.IndexExpr:
+		return x.Line, x.Column
+	}
+	return 0, 0
+}
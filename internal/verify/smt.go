@@ -10,8 +10,16 @@ import (
 )
 
 // TranslateContract converts a contract to SMT-LIB 2 format.
-// If isEnsures is true, the contract is negated for validity checking.
+// If isEnsures is true, the contract is negated for validity checking and the
+// function body is encoded so that result is constrained to the values the
+// body can actually return.
 func TranslateContract(fn *ir.Function, contract *ir.Contract, isEnsures bool) string {
+	return TranslateContractWithCallees(fn, contract, isEnsures, nil)
+}
+
+// TranslateContractWithCallees is TranslateContract with calls in the body
+// encoded through the callee contracts in callees.
+func TranslateContractWithCallees(fn *ir.Function, contract *ir.Contract, isEnsures bool, callees ContractTable) string {
 	var sb strings.Builder
 
 	sb.WriteString("; Verification condition for function: ")
@@ -23,53 +31,101 @@ func TranslateContract(fn *ir.Function, contract *ir.Contract, isEnsures bool) s
 
 	// Declare function parameters
 	for _, param := range fn.Params {
-		sb.WriteString("(declare-const ")
-		sb.WriteString(param.Name)
-		sb.WriteString(" ")
-		sb.WriteString(typeToSMTSort(param.Type))
-		sb.WriteString(")\n")
+		declareConst(&sb, param.Name, typeToSMTSort(param.Type))
 	}
 
 	// Declare result variable for ensures clauses
-	if isEnsures && fn.ReturnType != nil && fn.ReturnType.Name != "Void" {
-		sb.WriteString("(declare-const result ")
-		sb.WriteString(typeToSMTSort(fn.ReturnType))
+	hasResult := isEnsures && fn.ReturnType != nil && fn.ReturnType.Name != "Void"
+	if hasResult {
+		declareConst(&sb, "result", typeToSMTSort(fn.ReturnType))
+	}
+
+	if !isEnsures {
+		// For requires: check satisfiability
+		sb.WriteString("\n; Requires (checking satisfiability)\n")
+		sb.WriteString("(assert ")
+		sb.WriteString(exprToSMT(contract.Expr))
 		sb.WriteString(")\n")
+		sb.WriteString("\n(check-sat)\n")
+		return sb.String()
+	}
+
+	// Symbolically execute the body so result is tied to what it returns
+	enc := newBodyEncoder(nil, fn.ReturnType, callees)
+	var bodyConstraint string
+	if hasResult && len(fn.Body) > 0 {
+		paths := enc.execBody(fn.Body, enc.initialState(fn.Params))
+		bodyConstraint = pathsConstraint(paths, fn.ReturnType)
 	}
 
+	// The requires and the ensures are encoded like the body, so calls in
+	// them go through the callee contracts. Parameters are immutable, so the
+	// final environment is the entry one with result bound.
+	st := enc.initialState(fn.Params)
+	var requires []string
+	for _, req := range fn.Requires {
+		requires = append(requires, enc.eval(req.Expr, st))
+	}
+	goal := enc.eval(contract.Expr, st)
+	assumptions := append(requires, st.pc...)
+	writeDecls(&sb, enc.decls)
 	sb.WriteString("\n")
 
-	// Add requires as assumptions
-	if isEnsures && len(fn.Requires) > 0 {
+	// Add requires, and what calls in the contracts ensure, as assumptions
+	if len(assumptions) > 0 {
 		sb.WriteString("; Requires (assumptions)\n")
-		for _, req := range fn.Requires {
+		for _, term := range assumptions {
 			sb.WriteString("(assert ")
-			sb.WriteString(exprToSMT(req.Expr))
+			sb.WriteString(term)
 			sb.WriteString(")\n")
 		}
 		sb.WriteString("\n")
 	}
 
-	// Add the main contract assertion
-	if isEnsures {
-		// For ensures: negate to check validity (prove by contradiction)
-		sb.WriteString("; Ensures (negated for validity check)\n")
-		sb.WriteString("(assert (not ")
-		sb.WriteString(exprToSMT(contract.Expr))
-		sb.WriteString("))\n")
-	} else {
-		// For requires: check satisfiability
-		sb.WriteString("; Requires (checking satisfiability)\n")
+	// Add the body's return paths as assumptions
+	if bodyConstraint != "" {
+		sb.WriteString("; Body (one disjunct per return path)\n")
 		sb.WriteString("(assert ")
-		sb.WriteString(exprToSMT(contract.Expr))
-		sb.WriteString(")\n")
+		sb.WriteString(bodyConstraint)
+		sb.WriteString(")\n\n")
 	}
 
+	// For ensures: negate to check validity (prove by contradiction)
+	sb.WriteString("; Ensures (negated for validity check)\n")
+	sb.WriteString("(assert (not ")
+	sb.WriteString(goal)
+	sb.WriteString("))\n")
+
 	sb.WriteString("\n(check-sat)\n")
 
 	return sb.String()
 }
 
+// unsupported stands in for a term that exprToSMT and entityExprToSMT
+// cannot translate, such as a call without a contract or a string method.
+// It never reaches the solver: an assumption containing it is left out,
+// which only weakens the query, and a query whose goal contains it is
+// reported unverified without being run.
+const unsupported = "<unsupported>"
+
+// writeAssumption asserts term, or leaves it out when part of it could not
+// be translated.
+func writeAssumption(sb *strings.Builder, term string) {
+	if strings.Contains(term, unsupported) {
+		sb.WriteString("; (assumption left out: not translatable)\n")
+		return
+	}
+	sb.WriteString("(assert ")
+	sb.WriteString(term)
+	sb.WriteString(")\n")
+}
+
+// Translatable reports whether every term of e has an SMT translation, so
+// that a proof about e says something about its runtime value.
+func Translatable(e ir.Expr) bool {
+	return !strings.Contains(entityExprToSMT(e), unsupported)
+}
+
 // typeToSMTSort maps Intent types to SMT-LIB sorts
 func typeToSMTSort(t *checker.Type) string {
 	if t == nil {
@@ -81,8 +137,22 @@ func typeToSMTSort(t *checker.Type) string {
 	case "Bool":
 		return "Bool"
 	case "Float":
-		return "Real"
+		// Defined by the float model preamble, see floatPreamble
+		return "Float"
+	case "Array":
+		// Paired with a <name>@len constant, see declareConst
+		elem := "Int"
+		if len(t.TypeParams) == 1 {
+			elem = typeToSMTSort(t.TypeParams[0])
+		}
+		return "(Array Int " + elem + ")"
+	case "Map":
+		// The key set, paired with a <name>@len constant, see maps.go
+		return "(Array " + mapKeySort(t) + " Bool)"
 	default:
+		if t.IsEnum {
+			return datatypeSort(t)
+		}
 		// For unsupported types, use Int as fallback
 		return "Int"
 	}
@@ -105,36 +175,22 @@ func TranslateMethodContract(entityName, methodName string, fields []*ir.Field,
 
 	// Declare entity fields as self_<name> constants
 	for _, f := range fields {
-		sb.WriteString("(declare-const self_")
-		sb.WriteString(f.Name)
-		sb.WriteString(" ")
-		sb.WriteString(typeToSMTSort(f.Type))
-		sb.WriteString(")\n")
+		declareConst(&sb, "self_"+f.Name, typeToSMTSort(f.Type))
 	}
 
 	// Declare method parameters
 	for _, param := range params {
-		sb.WriteString("(declare-const ")
-		sb.WriteString(param.Name)
-		sb.WriteString(" ")
-		sb.WriteString(typeToSMTSort(param.Type))
-		sb.WriteString(")\n")
+		declareConst(&sb, param.Name, typeToSMTSort(param.Type))
 	}
 
 	// Declare result variable for ensures clauses
 	if isEnsures && returnType != nil && returnType.Name != "Void" {
-		sb.WriteString("(declare-const result ")
-		sb.WriteString(typeToSMTSort(returnType))
-		sb.WriteString(")\n")
+		declareConst(&sb, "result", typeToSMTSort(returnType))
 	}
 
 	// Declare old_ constants for old() captures
 	for _, oc := range oldCaptures {
-		sb.WriteString("(declare-const ")
-		sb.WriteString(oc.Name)
-		sb.WriteString(" ")
-		sb.WriteString(typeToSMTSort(oc.Expr.ExprType()))
-		sb.WriteString(")\n")
+		declareConst(&sb, oc.Name, typeToSMTSort(oc.Expr.ExprType()))
 	}
 
 	sb.WriteString("\n")
@@ -144,9 +200,7 @@ func TranslateMethodContract(entityName, methodName string, fields []*ir.Field,
 		if len(requires) > 0 {
 			sb.WriteString("; Requires (assumptions)\n")
 			for _, req := range requires {
-				sb.WriteString("(assert ")
-				sb.WriteString(entityExprToSMT(req.Expr))
-				sb.WriteString(")\n")
+				writeAssumption(&sb, entityExprToSMT(req.Expr))
 			}
 			sb.WriteString("\n")
 		}
@@ -155,9 +209,7 @@ func TranslateMethodContract(entityName, methodName string, fields []*ir.Field,
 		if len(invariants) > 0 {
 			sb.WriteString("; Invariants (assumptions)\n")
 			for _, inv := range invariants {
-				sb.WriteString("(assert ")
-				sb.WriteString(entityExprToSMT(inv.Expr))
-				sb.WriteString(")\n")
+				writeAssumption(&sb, entityExprToSMT(inv.Expr))
 			}
 			sb.WriteString("\n")
 		}
@@ -193,11 +245,7 @@ func TranslateInvariant(entityName string, fields []*ir.Field, contract *ir.Cont
 
 	// Declare entity fields as self_<name> constants
 	for _, f := range fields {
-		sb.WriteString("(declare-const self_")
-		sb.WriteString(f.Name)
-		sb.WriteString(" ")
-		sb.WriteString(typeToSMTSort(f.Type))
-		sb.WriteString(")\n")
+		declareConst(&sb, "self_"+f.Name, typeToSMTSort(f.Type))
 	}
 
 	sb.WriteString("\n")
@@ -213,6 +261,145 @@ func TranslateInvariant(entityName string, fields []*ir.Field, contract *ir.Cont
 	return sb.String()
 }
 
+// TranslateInvariantPreservation generates SMT-LIB proving that a method or
+// constructor body leaves every entity invariant true.
+// The pre-state assumes the requires and, when assumeInvariants is set (methods),
+// the invariants themselves; constructors start from unconstrained fields.
+// The body is symbolically executed and the invariants are negated over the
+// post-state of every path, so unsat means the invariants are preserved.
+func TranslateInvariantPreservation(entityName, methodName string, fields []*ir.Field, params []*ir.Param, returnType *checker.Type, requires []*ir.Contract, invariants []*ir.Contract, body []ir.Stmt, assumeInvariants bool, callees ContractTable) string {
+	var sb strings.Builder
+
+	sb.WriteString("; Invariant preservation for: ")
+	sb.WriteString(entityName)
+	sb.WriteString(".")
+	sb.WriteString(methodName)
+	sb.WriteString("\n")
+	for _, inv := range invariants {
+		sb.WriteString("; Invariant: ")
+		sb.WriteString(inv.RawText)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+
+	enc := newBodyEncoder(fields, returnType, callees)
+	paths := enc.execBody(body, enc.initialState(params))
+
+	// Post-state obligation: on every path, the invariants hold over the
+	// field values that path leaves behind
+	var post []string
+	for _, st := range paths {
+		var holds []string
+		for _, inv := range invariants {
+			holds = append(holds, enc.expr(inv.Expr, st.env))
+		}
+		post = append(post, fmt.Sprintf("(=> %s %s)", smtAnd(st.pc), smtAnd(holds)))
+	}
+
+	// Declare entity fields (pre-state) as self_<name> constants
+	for _, f := range fields {
+		declareConst(&sb, "self_"+f.Name, typeToSMTSort(f.Type))
+	}
+
+	// Declare parameters
+	for _, param := range params {
+		declareConst(&sb, param.Name, typeToSMTSort(param.Type))
+	}
+	writeDecls(&sb, enc.decls)
+	sb.WriteString("\n")
+
+	if assumeInvariants {
+		sb.WriteString("; Invariants (assumptions, pre-state)\n")
+		for _, inv := range invariants {
+			writeAssumption(&sb, entityExprToSMT(inv.Expr))
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(requires) > 0 {
+		sb.WriteString("; Requires (assumptions)\n")
+		for _, req := range requires {
+			writeAssumption(&sb, entityExprToSMT(req.Expr))
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("; Invariants in post-state of every path (negated for validity check)\n")
+	sb.WriteString("(assert (not ")
+	sb.WriteString(smtAnd(post))
+	sb.WriteString("))\n")
+
+	sb.WriteString("\n(check-sat)\n")
+
+	return sb.String()
+}
+
+// TranslateMethodContractWithBody generates SMT-LIB proving a method or
+// constructor ensures from what its body does. The requires and, when
+// assumeInvariants is set (methods), the invariants are assumed about the
+// pre-state and old() captures are taken from it. The ensures is negated
+// over the post-state of every path that completes, so unsat means the
+// postcondition holds.
+func TranslateMethodContractWithBody(entityName, methodName string, fields []*ir.Field, params []*ir.Param, returnType *checker.Type, requires []*ir.Contract, invariants []*ir.Contract, contract *ir.Contract, oldCaptures []*ir.OldCapture, body []ir.Stmt, assumeInvariants bool, callees ContractTable) string {
+	var sb strings.Builder
+
+	sb.WriteString("; Verification condition for: ")
+	sb.WriteString(entityName)
+	sb.WriteString(".")
+	sb.WriteString(methodName)
+	sb.WriteString("\n; Contract: ")
+	sb.WriteString(contract.RawText)
+	sb.WriteString("\n\n")
+
+	enc := newBodyEncoder(fields, returnType, callees)
+	st := enc.initialState(params)
+	if assumeInvariants {
+		for _, inv := range invariants {
+			st.pc = append(st.pc, enc.eval(inv.Expr, st))
+		}
+	}
+	for _, req := range requires {
+		st.pc = append(st.pc, enc.eval(req.Expr, st))
+	}
+	for _, oc := range oldCaptures {
+		st.env[oc.Name] = enc.eval(oc.Expr, st)
+	}
+	paths := enc.execBody(body, st)
+
+	hasResult := returnType != nil && returnType.Name != "Void"
+	var post []string
+	for _, p := range paths {
+		if hasResult && p.result == "" {
+			continue
+		}
+		end := p.clone()
+		if hasResult {
+			end.env["result"] = p.result
+		}
+		holds := enc.eval(contract.Expr, end)
+		post = append(post, fmt.Sprintf("(=> %s %s)", smtAnd(end.pc), holds))
+	}
+
+	// Declare entity fields (pre-state) and parameters
+	for _, f := range fields {
+		declareConst(&sb, "self_"+f.Name, typeToSMTSort(f.Type))
+	}
+	for _, param := range params {
+		declareConst(&sb, param.Name, typeToSMTSort(param.Type))
+	}
+	writeDecls(&sb, enc.decls)
+	sb.WriteString("\n")
+
+	sb.WriteString("; Ensures in post-state of every path (negated for validity check)\n")
+	sb.WriteString("(assert (not ")
+	sb.WriteString(smtAnd(post))
+	sb.WriteString("))\n")
+
+	sb.WriteString("\n(check-sat)\n")
+
+	return sb.String()
+}
+
 // entityExprToSMT converts an IR expression to SMT-LIB format with entity support.
 // It maps self.field -> self_field and handles OldRef.
 func entityExprToSMT(expr ir.Expr) string {
@@ -222,8 +409,7 @@ func entityExprToSMT(expr ir.Expr) string {
 		if _, ok := e.Object.(*ir.SelfRef); ok {
 			return "self_" + e.Field
 		}
-		// Fallback: treat as regular expression
-		return entityExprToSMT(e.Object) + "_" + e.Field
+		return unsupported
 	case *ir.SelfRef:
 		return "self"
 	case *ir.OldRef:
@@ -239,7 +425,7 @@ func entityExprToSMT(expr ir.Expr) string {
 	case *ir.IntLit:
 		return fmt.Sprintf("%d", e.Value)
 	case *ir.FloatLit:
-		return e.Value
+		return floatLit(e.Value)
 	case *ir.BoolLit:
 		if e.Value {
 			return "true"
@@ -249,62 +435,46 @@ func entityExprToSMT(expr ir.Expr) string {
 		return entityForallExprToSMT(e)
 	case *ir.ExistsExpr:
 		return entityExistsExprToSMT(e)
+	case *ir.IndexExpr:
+		return fmt.Sprintf("(select %s %s)", entityExprToSMT(e.Object), entityExprToSMT(e.Index))
+	case *ir.MethodCallExpr:
+		if isContains(e) {
+			return fmt.Sprintf("(select %s %s)", entityExprToSMT(e.Object), entityExprToSMT(e.Args[0]))
+		}
+		return unsupported
+	case *ir.CallExpr:
+		if arr, ok := lenArg(e); ok {
+			if n := arrayLen(entityExprToSMT(arr)); n != "" {
+				return n
+			}
+		}
+		if isVariantCall(e) {
+			args := make([]string, len(e.Args))
+			for i, a := range e.Args {
+				args[i] = entityExprToSMT(a)
+			}
+			if term, ok := variantTerm(e.Function, e.Type, args); ok {
+				return term
+			}
+		}
+		return unsupported
 	default:
-		return "true"
+		return unsupported
 	}
 }
 
 func entityBinaryExprToSMT(e *ir.BinaryExpr) string {
-	left := entityExprToSMT(e.Left)
-	right := entityExprToSMT(e.Right)
-
-	switch e.Op {
-	case lexer.PLUS:
-		return fmt.Sprintf("(+ %s %s)", left, right)
-	case lexer.MINUS:
-		return fmt.Sprintf("(- %s %s)", left, right)
-	case lexer.STAR:
-		return fmt.Sprintf("(* %s %s)", left, right)
-	case lexer.SLASH:
-		return fmt.Sprintf("(div %s %s)", left, right)
-	case lexer.PERCENT:
-		return fmt.Sprintf("(mod %s %s)", left, right)
-	case lexer.EQ:
-		return fmt.Sprintf("(= %s %s)", left, right)
-	case lexer.NEQ:
-		return fmt.Sprintf("(not (= %s %s))", left, right)
-	case lexer.LT:
-		return fmt.Sprintf("(< %s %s)", left, right)
-	case lexer.LEQ:
-		return fmt.Sprintf("(<= %s %s)", left, right)
-	case lexer.GT:
-		return fmt.Sprintf("(> %s %s)", left, right)
-	case lexer.GEQ:
-		return fmt.Sprintf("(>= %s %s)", left, right)
-	case lexer.AND:
-		return fmt.Sprintf("(and %s %s)", left, right)
-	case lexer.OR:
-		return fmt.Sprintf("(or %s %s)", left, right)
-	case lexer.IMPLIES:
-		return fmt.Sprintf("(=> %s %s)", left, right)
-	default:
-		return "true"
-	}
+	return binaryTerm(e, entityExprToSMT(e.Left), entityExprToSMT(e.Right))
 }
 
 func entityUnaryExprToSMT(e *ir.UnaryExpr) string {
-	operand := entityExprToSMT(e.Operand)
-	switch e.Op {
-	case lexer.NOT:
-		return fmt.Sprintf("(not %s)", operand)
-	case lexer.MINUS:
-		return fmt.Sprintf("(- %s)", operand)
-	default:
-		return operand
-	}
+	return unaryTerm(e, entityExprToSMT(e.Operand))
 }
 
 func entityForallExprToSMT(e *ir.ForallExpr) string {
+	if e.Map != nil {
+		return mapQuantifierTerm("forall", e.Variable, mapKeySort(e.Map.ExprType()), entityExprToSMT(e.Map), entityExprToSMT(e.Body))
+	}
 	var start, end string
 	if e.Domain != nil {
 		start = entityExprToSMT(e.Domain.Start)
@@ -316,6 +486,9 @@ func entityForallExprToSMT(e *ir.ForallExpr) string {
 }
 
 func entityExistsExprToSMT(e *ir.ExistsExpr) string {
+	if e.Map != nil {
+		return mapQuantifierTerm("exists", e.Variable, mapKeySort(e.Map.ExprType()), entityExprToSMT(e.Map), entityExprToSMT(e.Body))
+	}
 	var start, end string
 	if e.Domain != nil {
 		start = entityExprToSMT(e.Domain.Start)
@@ -327,72 +500,54 @@ func entityExistsExprToSMT(e *ir.ExistsExpr) string {
 }
 
 // TranslateLoopInvariant generates SMT-LIB for a loop invariant in a free function.
-// Uses inductive verification: assumes invariant + loop condition, proves invariant still holds.
+// It is TranslateLoopInvariantWithCallees without callee contracts.
 func TranslateLoopInvariant(fn *ir.Function, loop *ir.WhileStmt, inv *ir.Contract) string {
+	return TranslateLoopInvariantWithCallees(fn, loop, inv, nil)
+}
+
+// TranslateLoopInvariantWithCallees generates SMT-LIB proving a loop
+// invariant inductively. The body is symbolically executed from fn's
+// requires: the invariant must hold where the loop is entered, and after one
+// arbitrary iteration that starts from a state where it and the loop
+// condition hold. Both are negated together, so unsat means the invariant
+// may be assumed when the loop exits.
+func TranslateLoopInvariantWithCallees(fn *ir.Function, loop *ir.WhileStmt, inv *ir.Contract, callees ContractTable) string {
 	var sb strings.Builder
 
 	sb.WriteString("; Loop invariant verification for: ")
 	sb.WriteString(fn.Name)
 	sb.WriteString("\n; Invariant: ")
 	sb.WriteString(inv.RawText)
-	sb.WriteString("\n; Strategy: inductive step (assume inv + condition, prove inv holds)\n\n")
+	sb.WriteString("\n; Strategy: induction (holds on entry, preserved by an iteration)\n\n")
+
+	enc := newBodyEncoder(nil, fn.ReturnType, callees)
+	enc.execBody(fn.Body, enc.initialState(fn.Params))
 
 	// Declare function parameters
 	for _, param := range fn.Params {
-		sb.WriteString("(declare-const ")
-		sb.WriteString(param.Name)
-		sb.WriteString(" ")
-		sb.WriteString(typeToSMTSort(param.Type))
-		sb.WriteString(")\n")
+		declareConst(&sb, param.Name, typeToSMTSort(param.Type))
 	}
-
-	// Declare old captures
-	for _, oc := range loop.OldCaptures {
-		sb.WriteString("(declare-const ")
-		sb.WriteString(oc.Name)
-		sb.WriteString(" ")
-		sb.WriteString(typeToSMTSort(oc.Expr.ExprType()))
-		sb.WriteString(")\n")
-	}
-
+	writeDecls(&sb, enc.decls)
 	sb.WriteString("\n")
 
 	// Assume function preconditions
 	if len(fn.Requires) > 0 {
 		sb.WriteString("; Function preconditions\n")
 		for _, req := range fn.Requires {
-			sb.WriteString("(assert ")
-			sb.WriteString(exprToSMT(req.Expr))
-			sb.WriteString(")\n")
+			writeAssumption(&sb, exprToSMT(req.Expr))
 		}
 		sb.WriteString("\n")
 	}
 
-	// Assume the invariant holds (inductive hypothesis)
-	sb.WriteString("; Inductive hypothesis: invariant holds\n")
-	sb.WriteString("(assert ")
-	sb.WriteString(exprToSMT(inv.Expr))
-	sb.WriteString(")\n\n")
-
-	// Assume the loop condition holds (we're still in the loop)
-	sb.WriteString("; Loop condition holds\n")
-	sb.WriteString("(assert ")
-	sb.WriteString(exprToSMT(loop.Condition))
-	sb.WriteString(")\n\n")
-
-	// Assert negated invariant (prove it still holds after abstract step)
-	sb.WriteString("; Prove invariant is preserved (negated for contradiction)\n")
-	sb.WriteString("(assert (not ")
-	sb.WriteString(exprToSMT(inv.Expr))
-	sb.WriteString("))\n")
-
-	sb.WriteString("\n(check-sat)\n")
-
+	writeLoopObligations(&sb, enc, loop, inv)
 	return sb.String()
 }
 
-// TranslateLoopInvariantForMethod generates SMT-LIB for a loop invariant in an entity method.
-func TranslateLoopInvariantForMethod(entityName, methodName string, fields []*ir.Field, params []*ir.Param, loop *ir.WhileStmt, inv *ir.Contract) string {
+// TranslateLoopInvariantForMethod generates SMT-LIB for a loop invariant in
+// an entity method or constructor, proved as TranslateLoopInvariantWithCallees
+// does. The pre-state assumes the requires and, when assumeInvariants is set
+// (methods), the entity invariants.
+func TranslateLoopInvariantForMethod(entityName, methodName string, fields []*ir.Field, params []*ir.Param, returnType *checker.Type, requires []*ir.Contract, invariants []*ir.Contract, body []ir.Stmt, assumeInvariants bool, loop *ir.WhileStmt, inv *ir.Contract, callees ContractTable) string {
 	var sb strings.Builder
 
 	sb.WriteString("; Loop invariant verification for: ")
@@ -401,58 +556,50 @@ func TranslateLoopInvariantForMethod(entityName, methodName string, fields []*ir
 	sb.WriteString(methodName)
 	sb.WriteString("\n; Invariant: ")
 	sb.WriteString(inv.RawText)
-	sb.WriteString("\n; Strategy: inductive step (assume inv + condition, prove inv holds)\n\n")
+	sb.WriteString("\n; Strategy: induction (holds on entry, preserved by an iteration)\n\n")
 
-	// Declare entity fields
-	for _, f := range fields {
-		sb.WriteString("(declare-const self_")
-		sb.WriteString(f.Name)
-		sb.WriteString(" ")
-		sb.WriteString(typeToSMTSort(f.Type))
-		sb.WriteString(")\n")
+	enc := newBodyEncoder(fields, returnType, callees)
+	st := enc.initialState(params)
+	if assumeInvariants {
+		for _, c := range invariants {
+			st.pc = append(st.pc, enc.eval(c.Expr, st))
+		}
 	}
-
-	// Declare method parameters
-	for _, param := range params {
-		sb.WriteString("(declare-const ")
-		sb.WriteString(param.Name)
-		sb.WriteString(" ")
-		sb.WriteString(typeToSMTSort(param.Type))
-		sb.WriteString(")\n")
+	for _, req := range requires {
+		st.pc = append(st.pc, enc.eval(req.Expr, st))
 	}
+	enc.execBody(body, st)
 
-	// Declare old captures
-	for _, oc := range loop.OldCaptures {
-		sb.WriteString("(declare-const ")
-		sb.WriteString(oc.Name)
-		sb.WriteString(" ")
-		sb.WriteString(typeToSMTSort(oc.Expr.ExprType()))
-		sb.WriteString(")\n")
+	// Declare entity fields (pre-state) and parameters
+	for _, f := range fields {
+		declareConst(&sb, "self_"+f.Name, typeToSMTSort(f.Type))
 	}
-
+	for _, param := range params {
+		declareConst(&sb, param.Name, typeToSMTSort(param.Type))
+	}
+	writeDecls(&sb, enc.decls)
 	sb.WriteString("\n")
 
-	// Assume the invariant holds (inductive hypothesis)
-	sb.WriteString("; Inductive hypothesis: invariant holds\n")
-	sb.WriteString("(assert ")
-	sb.WriteString(entityExprToSMT(inv.Expr))
-	sb.WriteString(")\n\n")
+	writeLoopObligations(&sb, enc, loop, inv)
+	return sb.String()
+}
 
-	// Assume the loop condition holds
-	sb.WriteString("; Loop condition holds\n")
-	sb.WriteString("(assert ")
-	sb.WriteString(entityExprToSMT(loop.Condition))
-	sb.WriteString(")\n\n")
+// writeLoopObligations negates, in one assertion, every obligation enc
+// recorded for inv of loop.
+func writeLoopObligations(sb *strings.Builder, enc *bodyEncoder, loop *ir.WhileStmt, inv *ir.Contract) {
+	var holds []string
+	for _, ob := range enc.loops {
+		if ob.loop == loop && ob.contract == inv {
+			holds = append(holds, fmt.Sprintf("(=> %s %s)", smtAnd(ob.pc), ob.goal))
+		}
+	}
 
-	// Assert negated invariant
-	sb.WriteString("; Prove invariant is preserved (negated for contradiction)\n")
+	sb.WriteString("; Invariant on entry and after an iteration (negated for validity check)\n")
 	sb.WriteString("(assert (not ")
-	sb.WriteString(entityExprToSMT(inv.Expr))
+	sb.WriteString(smtAnd(holds))
 	sb.WriteString("))\n")
 
 	sb.WriteString("\n(check-sat)\n")
-
-	return sb.String()
 }
 
 // exprToSMT converts an IR expression to SMT-LIB format
@@ -471,7 +618,7 @@ func exprToSMT(expr ir.Expr) string {
 	case *ir.IntLit:
 		return fmt.Sprintf("%d", e.Value)
 	case *ir.FloatLit:
-		return e.Value
+		return floatLit(e.Value)
 	case *ir.BoolLit:
 		if e.Value {
 			return "true"
@@ -481,18 +628,47 @@ func exprToSMT(expr ir.Expr) string {
 		return forallExprToSMT(e)
 	case *ir.ExistsExpr:
 		return existsExprToSMT(e)
+	case *ir.IndexExpr:
+		return fmt.Sprintf("(select %s %s)", exprToSMT(e.Object), exprToSMT(e.Index))
+	case *ir.MethodCallExpr:
+		if isContains(e) {
+			return fmt.Sprintf("(select %s %s)", exprToSMT(e.Object), exprToSMT(e.Args[0]))
+		}
+		return unsupported
+	case *ir.CallExpr:
+		if arr, ok := lenArg(e); ok {
+			if n := arrayLen(exprToSMT(arr)); n != "" {
+				return n
+			}
+		}
+		if isVariantCall(e) {
+			args := make([]string, len(e.Args))
+			for i, a := range e.Args {
+				args[i] = exprToSMT(a)
+			}
+			if term, ok := variantTerm(e.Function, e.Type, args); ok {
+				return term
+			}
+		}
+		return unsupported
 	default:
-		// Unsupported expression type
-		return "true"
+		return unsupported
 	}
 }
 
 // binaryExprToSMT converts a binary expression to SMT-LIB format
 func binaryExprToSMT(e *ir.BinaryExpr) string {
-	left := exprToSMT(e.Left)
-	right := exprToSMT(e.Right)
+	return binaryTerm(e, exprToSMT(e.Left), exprToSMT(e.Right))
+}
 
-	switch e.Op {
+// unaryExprToSMT converts a unary expression to SMT-LIB format
+func unaryExprToSMT(e *ir.UnaryExpr) string {
+	return unaryTerm(e, exprToSMT(e.Operand))
+}
+
+// binaryOpToSMT applies a binary operator to already-translated operands.
+func binaryOpToSMT(op lexer.TokenType, left, right string) string {
+	switch op {
 	case lexer.PLUS:
 		return fmt.Sprintf("(+ %s %s)", left, right)
 	case lexer.MINUS:
@@ -522,15 +698,13 @@ func binaryExprToSMT(e *ir.BinaryExpr) string {
 	case lexer.IMPLIES:
 		return fmt.Sprintf("(=> %s %s)", left, right)
 	default:
-		return "true"
+		return unsupported
 	}
 }
 
-// unaryExprToSMT converts a unary expression to SMT-LIB format
-func unaryExprToSMT(e *ir.UnaryExpr) string {
-	operand := exprToSMT(e.Operand)
-
-	switch e.Op {
+// unaryOpToSMT applies a unary operator to an already-translated operand.
+func unaryOpToSMT(op lexer.TokenType, operand string) string {
+	switch op {
 	case lexer.NOT:
 		return fmt.Sprintf("(not %s)", operand)
 	case lexer.MINUS:
@@ -542,6 +716,10 @@ func unaryExprToSMT(e *ir.UnaryExpr) string {
 
 // forallExprToSMT converts a forall expression to SMT-LIB format
 func forallExprToSMT(e *ir.ForallExpr) string {
+	if e.Map != nil {
+		return mapQuantifierTerm("forall", e.Variable, mapKeySort(e.Map.ExprType()), exprToSMT(e.Map), exprToSMT(e.Body))
+	}
+
 	// Extract range bounds
 	var start, end string
 	if e.Domain != nil {
@@ -560,6 +738,10 @@ func forallExprToSMT(e *ir.ForallExpr) string {
 
 // existsExprToSMT converts an exists expression to SMT-LIB format
 func existsExprToSMT(e *ir.ExistsExpr) string {
+	if e.Map != nil {
+		return mapQuantifierTerm("exists", e.Variable, mapKeySort(e.Map.ExprType()), exprToSMT(e.Map), exprToSMT(e.Body))
+	}
+
 	// Extract range bounds
 	var start, end string
 	if e.Domain != nil {
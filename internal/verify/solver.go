@@ -0,0 +1,165 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Solver answers SMT-LIB 2 queries. Check is given a complete script ending
+// in (check-sat), optionally followed by (get-model), and returns what the
+// solver printed: the check-sat answer on the first line and the model, if
+// any, after it. Check must be safe to call from several goroutines.
+type Solver interface {
+	// Name identifies the solver in results and messages, e.g. "z3".
+	Name() string
+	// Version is the solver's version string, or "" when it is unknown.
+	// Cached answers are only reused for the same name and version.
+	Version() string
+	// Check runs one query. It returns ErrSolverTimeout when the query
+	// takes longer than timeout.
+	Check(query string, timeout time.Duration) (string, error)
+}
+
+// ErrSolverTimeout is returned by Solver.Check when a query runs out of time.
+var ErrSolverTimeout = errors.New("solver timed out")
+
+// NewSolver returns the solver named by spec: "z3" or "cvc5" look the
+// binary up on PATH, and any other value is taken as the name or path of an
+// SMT-LIB 2 solver that reads its query from stdin. An empty spec means z3.
+func NewSolver(spec string) (Solver, error) {
+	if spec == "" {
+		spec = "z3"
+	}
+	path, err := exec.LookPath(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found on PATH", spec)
+	}
+	switch filepath.Base(spec) {
+	case "z3":
+		return NewZ3(path), nil
+	case "cvc5":
+		return NewCVC5(path), nil
+	}
+	return NewGenericSolver(path), nil
+}
+
+// NewZ3 returns a Solver that runs the z3 binary at path.
+func NewZ3(path string) Solver {
+	return newProcessSolver("z3", path, func(timeout time.Duration) []string {
+		return []string{"-in", fmt.Sprintf("-T:%d", int(math.Ceil(timeout.Seconds())))}
+	})
+}
+
+// NewCVC5 returns a Solver that runs the cvc5 binary at path.
+func NewCVC5(path string) Solver {
+	return newProcessSolver("cvc5", path, func(timeout time.Duration) []string {
+		return []string{"--lang=smt2", fmt.Sprintf("--tlimit-per=%d", timeout.Milliseconds())}
+	})
+}
+
+// NewGenericSolver returns a Solver that pipes each query to the binary at
+// path with no arguments. Its time limit is enforced by stopping the process.
+func NewGenericSolver(path string) Solver {
+	return newProcessSolver(filepath.Base(path), path, nil)
+}
+
+// processSolver runs one solver process per query.
+type processSolver struct {
+	name string
+	path string
+	args func(timeout time.Duration) []string
+
+	versionOnce sync.Once
+	version     string
+}
+
+func newProcessSolver(name, path string, args func(time.Duration) []string) *processSolver {
+	return &processSolver{name: name, path: path, args: args}
+}
+
+func (s *processSolver) Name() string { return s.name }
+
+// Version asks the binary for --version once.
+func (s *processSolver) Version() string {
+	s.versionOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, s.path, "--version").Output()
+		if err != nil {
+			return
+		}
+		first, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		s.version = versionNumber(first)
+	})
+	return s.version
+}
+
+// versionNumber picks the version out of a --version banner such as
+// "Z3 version 4.13.0 - 64 bit" or "This is cvc5 version 1.1.2 [git ...]",
+// falling back to the whole line.
+func versionNumber(banner string) string {
+	for _, word := range strings.Fields(banner) {
+		if word[0] >= '0' && word[0] <= '9' && strings.Contains(word, ".") {
+			return word
+		}
+	}
+	return strings.TrimSpace(banner)
+}
+
+func (s *processSolver) Check(query string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var args []string
+	if s.args != nil {
+		args = s.args(timeout)
+	}
+	cmd := exec.CommandContext(ctx, s.path, args...)
+	cmd.Stdin = strings.NewReader(query)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", ErrSolverTimeout
+	}
+	if err != nil && stderr.Len() > 0 {
+		err = fmt.Errorf("%w\n%s", err, stderr.String())
+	}
+	return stdout.String(), err
+}
+
+// ScriptedSolver is an in-process Solver for tests. Respond receives each
+// query and returns what a solver would print, such as "unsat" or
+// "sat\n((define-fun x () Int 3))". Every query is recorded in Queries,
+// which may be read once verification has finished.
+type ScriptedSolver struct {
+	Respond func(query string) string
+	Queries []string
+
+	mu sync.Mutex
+}
+
+// Name implements Solver.
+func (s *ScriptedSolver) Name() string { return "scripted" }
+
+// Version implements Solver.
+func (s *ScriptedSolver) Version() string { return "1" }
+
+// Check implements Solver.
+func (s *ScriptedSolver) Check(query string, timeout time.Duration) (string, error) {
+	s.mu.Lock()
+	s.Queries = append(s.Queries, query)
+	s.mu.Unlock()
+	return s.Respond(query), nil
+}
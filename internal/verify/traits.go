@@ -0,0 +1,199 @@
+package verify
+
+import (
+	"strings"
+
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// An entity method implementing a trait method can be called through the
+// trait, by a caller who only knows the trait's contracts. It must accept
+// every call the trait allows and promise everything the trait promises:
+//
+//	subtype_requires: invariants && trait requires  =>  impl requires
+//	subtype_ensures:  invariants && trait requires && impl ensures  =>  trait ensures
+//
+// The implementation's own ensures are proved from its body separately, and
+// so are the invariants of its post-state, so both are assumed here. Trait
+// contracts cannot use old(), but the implementation's ensures can; its old
+// captures are left unconstrained.
+
+// traitTable maps the name of every trait in the program to its declaration.
+func traitTable(mod *ir.Module, prog *ir.Program) map[string]*ir.Trait {
+	table := make(map[string]*ir.Trait)
+	if prog != nil {
+		for _, m := range prog.Modules {
+			for _, t := range m.Traits {
+				table[t.Name] = t
+			}
+		}
+	}
+	for _, t := range mod.Traits {
+		table[t.Name] = t
+	}
+	return table
+}
+
+// TranslateSubtypeRequires generates SMT-LIB proving that impl's requires
+// hold whenever the trait method's requires do.
+func TranslateSubtypeRequires(ent *ir.Entity, trait string, want, impl *ir.Method) string {
+	var sb strings.Builder
+	writeSubtypeHeader(&sb, "Subtype requires", ent.Name, trait, impl.Name, impl.Requires)
+
+	for _, f := range ent.Fields {
+		declareConst(&sb, "self_"+f.Name, typeToSMTSort(f.Type))
+	}
+	for _, param := range impl.Params {
+		declareConst(&sb, param.Name, typeToSMTSort(param.Type))
+	}
+	sb.WriteString("\n")
+
+	writeAssumptions(&sb, "Invariants", ent.Invariants)
+	writeAssumptions(&sb, "Trait requires", want.Requires)
+
+	var holds []string
+	for _, req := range impl.Requires {
+		holds = append(holds, entityExprToSMT(req.Expr))
+	}
+	sb.WriteString("; Implementation requires (negated for validity check)\n")
+	sb.WriteString("(assert (not ")
+	sb.WriteString(smtAnd(holds))
+	sb.WriteString("))\n")
+
+	sb.WriteString("\n(check-sat)\n")
+
+	return sb.String()
+}
+
+// TranslateSubtypeEnsures generates SMT-LIB proving that one ensures clause
+// of the trait method follows from impl's ensures.
+func TranslateSubtypeEnsures(ent *ir.Entity, trait string, want, impl *ir.Method, contract *ir.Contract) string {
+	var sb strings.Builder
+	writeSubtypeHeader(&sb, "Subtype ensures", ent.Name, trait, impl.Name, []*ir.Contract{contract})
+
+	for _, f := range ent.Fields {
+		declareConst(&sb, "self_"+f.Name, typeToSMTSort(f.Type))
+	}
+	for _, param := range impl.Params {
+		declareConst(&sb, param.Name, typeToSMTSort(param.Type))
+	}
+	if hasResult(impl.ReturnType) {
+		declareConst(&sb, "result", typeToSMTSort(impl.ReturnType))
+	}
+	for _, oc := range impl.OldCaptures {
+		declareConst(&sb, oc.Name, typeToSMTSort(oc.Expr.ExprType()))
+	}
+	sb.WriteString("\n")
+
+	writeAssumptions(&sb, "Invariants (post-state)", ent.Invariants)
+	writeAssumptions(&sb, "Trait requires", want.Requires)
+	writeAssumptions(&sb, "Implementation ensures", impl.Ensures)
+
+	sb.WriteString("; Trait ensures (negated for validity check)\n")
+	sb.WriteString("(assert (not ")
+	sb.WriteString(entityExprToSMT(contract.Expr))
+	sb.WriteString("))\n")
+
+	sb.WriteString("\n(check-sat)\n")
+
+	return sb.String()
+}
+
+func writeSubtypeHeader(sb *strings.Builder, what, entityName, trait, methodName string, contracts []*ir.Contract) {
+	sb.WriteString("; ")
+	sb.WriteString(what)
+	sb.WriteString(" for: ")
+	sb.WriteString(entityName + "." + methodName)
+	sb.WriteString(" implementing ")
+	sb.WriteString(trait + "." + methodName)
+	sb.WriteString("\n")
+	for _, c := range contracts {
+		sb.WriteString("; Contract: ")
+		sb.WriteString(c.RawText)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+}
+
+func writeAssumptions(sb *strings.Builder, label string, contracts []*ir.Contract) {
+	if len(contracts) == 0 {
+		return
+	}
+	sb.WriteString("; ")
+	sb.WriteString(label)
+	sb.WriteString(" (assumptions)\n")
+	for _, c := range contracts {
+		writeAssumption(sb, entityExprToSMT(c.Expr))
+	}
+	sb.WriteString("\n")
+}
+
+func hasResult(t *checker.Type) bool {
+	return t != nil && t.Name != "Void"
+}
+
+// subtypeTasks lists the queries proving that ent's methods refine the
+// contracts of the trait methods they implement.
+func subtypeTasks(ent *ir.Entity, sc *solverContext) []verifyTask {
+	var tasks []verifyTask
+	for _, name := range ent.Implements {
+		trait := sc.traits[name]
+		if trait == nil {
+			continue
+		}
+		for _, want := range trait.Methods {
+			impl := findMethod(ent, want.Name)
+			if impl == nil {
+				continue
+			}
+			if len(impl.Requires) > 0 {
+				tasks = append(tasks, func() *VerifyResult {
+					smtLib := TranslateSubtypeRequires(ent, trait.Name, want, impl)
+					texts := make([]string, len(impl.Requires))
+					for i, req := range impl.Requires {
+						texts[i] = req.RawText
+					}
+					result := sc.run(smtLib, true)
+					result.EntityName = ent.Name
+					result.FunctionName = impl.Name
+					result.ContractKind = "subtype_requires"
+					result.ContractText = trait.Name + "." + want.Name + ": " + strings.Join(texts, "; ")
+					result.locate(impl.Requires[0])
+					result.IsEnsures = true
+					attachCounterexample(result, entityModelNames(ent.Fields, impl.Params, nil, false))
+					return result
+				})
+			}
+			for _, ens := range want.Ensures {
+				tasks = append(tasks, func() *VerifyResult {
+					smtLib := TranslateSubtypeEnsures(ent, trait.Name, want, impl, ens)
+					result := sc.run(smtLib, true)
+					result.EntityName = ent.Name
+					result.FunctionName = impl.Name
+					result.ContractKind = "subtype_ensures"
+					result.ContractText = trait.Name + "." + want.Name + ": " + ens.RawText
+					// Locate it at the implementation's ensures, which is
+					// in this module's file even when the trait is not
+					result.locate(ens)
+					if len(impl.Ensures) > 0 {
+						result.locate(impl.Ensures[0])
+					}
+					result.IsEnsures = true
+					attachCounterexample(result, entityModelNames(ent.Fields, impl.Params, impl.OldCaptures, hasResult(impl.ReturnType)))
+					return result
+				})
+			}
+		}
+	}
+	return tasks
+}
+
+func findMethod(ent *ir.Entity, name string) *ir.Method {
+	for _, m := range ent.Methods {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
@@ -1,11 +1,11 @@
 package verify
 
 import (
-	"bytes"
-	"context"
+	"errors"
 	"fmt"
-	"os/exec"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lhaig/intent/internal/ir"
@@ -15,12 +15,34 @@ import (
 type VerifyResult struct {
 	FunctionName string
 	EntityName   string // non-empty for entity contracts (methods, constructors, invariants)
-	ContractKind string // "requires", "ensures", "invariant"
+	ContractKind string // "requires", "ensures", "invariant", "loop_invariant", "call_requires", "invariant_preserved", "subtype_requires", "subtype_ensures", "overflow", "div_by_zero", "bounds"
 	ContractText string
+	File         string // source file of the module; empty for single-file input
+	Line, Column int    // source position of the clause or checked operation; zero when unknown
+	EndLine      int    // position just past the clause or operation; zero when unknown
+	EndColumn    int
 	IsEnsures    bool
 	Status       string // "verified", "unverified", "error", "timeout"
 	Message      string
-	SMTOutput    string // raw SMT-LIB for debugging
+	SMTOutput    string     // raw SMT-LIB for debugging
+	FloatModel   FloatModel // model the query used for Float; empty when it has no Float terms
+	Cached       bool       // answered from the verification cache without running the solver
+
+	// Solver and SolverVersion identify what answered the query.
+	Solver        string
+	SolverVersion string
+
+	// Counterexample holds concrete values for params, fields, old()
+	// captures and result when the solver refutes an ensures/invariant.
+	Counterexample []ModelValue
+
+	model map[string]string // raw solver model, keyed by SMT constant
+}
+
+// locate places r at the source span of clause c.
+func (r *VerifyResult) locate(c *ir.Contract) {
+	r.Line, r.Column = c.Line, c.Column
+	r.EndLine, r.EndColumn = c.EndLine, c.EndColumn
 }
 
 // QualifiedName returns the fully qualified contract name (e.g., "BankAccount.withdraw.requires")
@@ -37,140 +59,310 @@ func (r *VerifyResult) QualifiedName() string {
 	return r.ContractKind
 }
 
+// DefaultTimeout is how long the solver may spend on one query.
+const DefaultTimeout = 5 * time.Second
+
+// Options configures verification. The zero value selects the defaults.
+type Options struct {
+	// Solver answers the queries; nil means z3 from PATH.
+	Solver Solver
+	// FloatModel selects how Float is reasoned about; empty means FloatReal.
+	FloatModel FloatModel
+	// Jobs bounds how many solver processes run at once; zero means one
+	// per CPU.
+	Jobs int
+	// Timeout limits each query; zero means DefaultTimeout.
+	Timeout time.Duration
+	// CacheDir is where solver answers are cached between runs; empty
+	// disables the cache.
+	CacheDir string
+}
+
 // Verify verifies all contracts in a module
 func Verify(mod *ir.Module) []*VerifyResult {
-	var results []*VerifyResult
+	return VerifyInProgram(mod, nil)
+}
 
-	// Check if z3 is available
-	z3Path, err := exec.LookPath("z3")
-	if err != nil {
-		return []*VerifyResult{{
-			FunctionName: "",
-			ContractText: "",
-			Status:       "error",
-			Message:      "z3 not found on PATH",
-		}}
+// VerifyInProgram verifies all contracts in mod, resolving module-qualified
+// calls against the contracts of the other modules in prog.
+func VerifyInProgram(mod *ir.Module, prog *ir.Program) []*VerifyResult {
+	return VerifyInProgramWith(mod, prog, Options{})
+}
+
+// VerifyInProgramWith is VerifyInProgram using the given options.
+func VerifyInProgramWith(mod *ir.Module, prog *ir.Program, opts Options) []*VerifyResult {
+	solver := opts.Solver
+	if solver == nil {
+		var err error
+		if solver, err = NewSolver("z3"); err != nil {
+			return []*VerifyResult{{
+				FunctionName: "",
+				ContractText: "",
+				Status:       "error",
+				Message:      err.Error(),
+			}}
+		}
 	}
 
-	// Verify contracts for each function
-	for _, fn := range mod.Functions {
-		fnResults := verifyFunctionWithZ3(fn, z3Path)
-		results = append(results, fnResults...)
+	sc := &solverContext{
+		solver:    solver,
+		callees:   NewContractTable(mod, prog),
+		traits:    traitTable(mod, prog),
+		datatypes: TranslateDatatypes(mod, prog),
+		floats:    opts.FloatModel,
+		jobs:      opts.Jobs,
+		timeout:   opts.Timeout,
+	}
+	if opts.CacheDir != "" {
+		sc.cache = openCache(opts.CacheDir, solver)
 	}
 
-	// Verify contracts for each entity
+	// Queries for every function, then every entity, in source order
+	var tasks []verifyTask
+	for _, fn := range mod.Functions {
+		tasks = append(tasks, functionTasks(fn, sc)...)
+	}
 	for _, ent := range mod.Entities {
-		entResults := verifyEntityWithZ3(ent, z3Path)
-		results = append(results, entResults...)
+		tasks = append(tasks, entityTasks(ent, sc)...)
 	}
 
+	results := sc.runAll(tasks)
+	for _, r := range results {
+		r.File = mod.Path
+	}
 	return results
 }
 
 // VerifyFunction verifies contracts for a single function
 func VerifyFunction(fn *ir.Function) []*VerifyResult {
-	// Check if z3 is available
-	z3Path, err := exec.LookPath("z3")
+	solver, err := NewSolver("z3")
 	if err != nil {
 		return []*VerifyResult{{
 			FunctionName: fn.Name,
 			ContractText: "",
 			Status:       "error",
-			Message:      "z3 not found on PATH",
+			Message:      err.Error(),
 		}}
 	}
 
-	return verifyFunctionWithZ3(fn, z3Path)
+	return verifyFunctionWithZ3(fn, &solverContext{solver: solver, datatypes: builtinDatatypes})
+}
+
+// solverContext is what every query for one module shares: the solver, the
+// contracts of callable functions, the datatypes for the enums in scope, the
+// float model and how queries are run.
+type solverContext struct {
+	solver    Solver
+	callees   ContractTable
+	traits    map[string]*ir.Trait
+	datatypes string
+	floats    FloatModel
+	jobs      int
+	timeout   time.Duration
+	cache     *queryCache // nil when caching is off
+}
+
+// verifyTask translates and runs one query and labels its result.
+type verifyTask func() *VerifyResult
+
+// runAll runs tasks on at most sc.jobs workers and returns their results in
+// task order.
+func (sc *solverContext) runAll(tasks []verifyTask) []*VerifyResult {
+	results := make([]*VerifyResult, len(tasks))
+	jobs := sc.jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(jobs, len(tasks)) {
+		wg.Go(func() {
+			for i := range next {
+				results[i] = tasks[i]()
+			}
+		})
+	}
+	for i := range tasks {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// run checks smtLib with the Float definitions and datatype declarations
+// prepended, answering from the cache when the same query was proved before.
+// A query whose goal could not be translated is not run.
+func (sc *solverContext) run(smtLib string, isEnsures bool) *VerifyResult {
+	if strings.Contains(smtLib, unsupported) {
+		return &VerifyResult{
+			Status:        "unverified",
+			Message:       "contract uses an expression the verifier cannot translate",
+			Solver:        sc.solver.Name(),
+			SolverVersion: sc.solver.Version(),
+		}
+	}
+	input := floatPreamble(sc.floats) + sc.datatypes + smtLib
+	result, ok := sc.cache.load(input, isEnsures)
+	if !ok {
+		result = runSolver(sc.solver, input, isEnsures, sc.queryTimeout())
+		sc.cache.store(input, isEnsures, result)
+	}
+	result.Solver = sc.solver.Name()
+	result.SolverVersion = sc.solver.Version()
+	if usesFloat(smtLib) {
+		result.FloatModel = sc.floatModel()
+	}
+	return result
+}
+
+func (sc *solverContext) queryTimeout() time.Duration {
+	if sc.timeout <= 0 {
+		return DefaultTimeout
+	}
+	return sc.timeout
 }
 
-// verifyFunctionWithZ3 verifies all contracts for a function using z3
-func verifyFunctionWithZ3(fn *ir.Function, z3Path string) []*VerifyResult {
-	var results []*VerifyResult
+func (sc *solverContext) floatModel() FloatModel {
+	if sc.floats == "" {
+		return FloatReal
+	}
+	return sc.floats
+}
+
+// verifyFunctionWithZ3 verifies all contracts for a function using z3.
+// Calls in the body are reasoned about through the contracts in sc.callees.
+func verifyFunctionWithZ3(fn *ir.Function, sc *solverContext) []*VerifyResult {
+	return sc.runAll(functionTasks(fn, sc))
+}
+
+// functionTasks lists the queries that verify a function.
+func functionTasks(fn *ir.Function, sc *solverContext) []verifyTask {
+	var tasks []verifyTask
 
 	// Verify requires clauses (satisfiability check)
 	for _, req := range fn.Requires {
-		smtLib := TranslateContract(fn, req, false)
-		result := runZ3(z3Path, smtLib, false)
-		result.FunctionName = fn.Name
-		result.ContractKind = "requires"
-		result.ContractText = req.RawText
-		result.IsEnsures = false
-		result.SMTOutput = smtLib
-		results = append(results, result)
+		tasks = append(tasks, func() *VerifyResult {
+			smtLib := TranslateContract(fn, req, false)
+			result := sc.run(smtLib, false)
+			result.FunctionName = fn.Name
+			result.ContractKind = "requires"
+			result.ContractText = req.RawText
+			result.locate(req)
+			result.IsEnsures = false
+			return result
+		})
 	}
 
 	// Verify ensures clauses (validity check)
 	for _, ens := range fn.Ensures {
-		smtLib := TranslateContract(fn, ens, true)
-		result := runZ3(z3Path, smtLib, true)
-		result.FunctionName = fn.Name
-		result.ContractKind = "ensures"
-		result.ContractText = ens.RawText
-		result.IsEnsures = true
-		result.SMTOutput = smtLib
-		results = append(results, result)
+		tasks = append(tasks, func() *VerifyResult {
+			smtLib := TranslateContractWithCallees(fn, ens, true, sc.callees)
+			result := sc.run(smtLib, true)
+			result.FunctionName = fn.Name
+			result.ContractKind = "ensures"
+			result.ContractText = ens.RawText
+			result.locate(ens)
+			result.IsEnsures = true
+			attachCounterexample(result, functionModelNames(fn))
+			return result
+		})
+	}
+
+	// Verify callee preconditions at each call site
+	for _, ob := range TranslateCallRequires(fn, sc.callees) {
+		tasks = append(tasks, func() *VerifyResult {
+			result := sc.run(ob.SMT, true)
+			result.FunctionName = fn.Name
+			result.ContractKind = "call_requires"
+			result.ContractText = ob.Callee + ": " + ob.Contract.RawText
+			result.Line, result.Column = ob.Line, ob.Column
+			result.EndLine, result.EndColumn = ob.EndLine, ob.EndColumn
+			result.IsEnsures = true
+			attachCounterexample(result, functionModelNames(fn))
+			return result
+		})
 	}
 
 	// Verify loop invariants in function body
 	loops := findWhileStmts(fn.Body)
 	for i, loop := range loops {
 		for _, inv := range loop.Invariants {
-			smtLib := TranslateLoopInvariant(fn, loop, inv)
-			result := runZ3(z3Path, smtLib, true)
-			result.FunctionName = fmt.Sprintf("%s.loop_%d", fn.Name, i+1)
-			result.ContractKind = "loop_invariant"
-			result.ContractText = inv.RawText
-			result.IsEnsures = true
-			result.SMTOutput = smtLib
-			results = append(results, result)
+			tasks = append(tasks, func() *VerifyResult {
+				smtLib := TranslateLoopInvariantWithCallees(fn, loop, inv, sc.callees)
+				result := sc.run(smtLib, true)
+				result.FunctionName = fmt.Sprintf("%s.loop_%d", fn.Name, i+1)
+				result.ContractKind = "loop_invariant"
+				result.ContractText = inv.RawText
+				result.locate(inv)
+				result.IsEnsures = true
+				attachCounterexample(result, entityModelNames(nil, fn.Params, nil, false))
+				return result
+			})
 		}
 	}
 
-	return results
+	// Verify Int operations and array indexes are safe
+	for _, ob := range TranslateSafetyChecks(fn, sc.callees) {
+		tasks = append(tasks, func() *VerifyResult {
+			result := safetyResult(ob, sc, entityModelNames(nil, fn.Params, nil, false))
+			result.FunctionName = fn.Name
+			return result
+		})
+	}
+
+	return tasks
+}
+
+// safetyResult runs one runtime safety query.
+func safetyResult(ob *SafetyObligation, sc *solverContext, names []modelName) *VerifyResult {
+	result := sc.run(ob.SMT, true)
+	result.ContractKind = ob.Kind
+	result.ContractText = ir.FormatExpr(ob.Expr)
+	result.Line = ob.Line
+	result.Column = ob.Column
+	result.EndLine = ob.EndLine
+	result.EndColumn = ob.EndColumn
+	result.IsEnsures = true
+	attachCounterexample(result, names)
+	return result
 }
 
-// runZ3 executes z3 with the given SMT-LIB input.
+// runSolver checks smtLib with solver.
 // isEnsures controls result interpretation:
 //   - true (ensures/invariant): unsat = verified (negated contract has no counterexample)
 //   - false (requires): sat = verified (precondition is satisfiable/consistent)
-func runZ3(z3Path, smtLib string, isEnsures bool) *VerifyResult {
+func runSolver(solver Solver, smtLib string, isEnsures bool, timeout time.Duration) *VerifyResult {
 	result := &VerifyResult{}
+	name := solver.Name()
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// Create command
-	cmd := exec.CommandContext(ctx, z3Path, "-in", "-T:5")
-	cmd.Stdin = strings.NewReader(smtLib)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	// Run z3
-	err := cmd.Run()
+	// Ask for a model so refuted ensures come with a counterexample
+	input := smtLib
+	if isEnsures {
+		input = "(set-option :produce-models true)\n" + smtLib + "(get-model)\n"
+	}
 
-	// Check for timeout
-	if ctx.Err() == context.DeadlineExceeded {
+	stdout, err := solver.Check(input, timeout)
+	if errors.Is(err, ErrSolverTimeout) {
 		result.Status = "timeout"
-		result.Message = "z3 timed out after 5 seconds"
+		result.Message = fmt.Sprintf("%s timed out after %s", name, timeout)
 		return result
 	}
 
+	// Parse the output: the first line is the check-sat answer, anything
+	// after it is the (get-model) response. Asking for a model after unsat
+	// makes solvers report an error, so the error is only trusted without
+	// an answer.
+	output, modelText, _ := strings.Cut(strings.TrimSpace(stdout), "\n")
+	output = strings.TrimSpace(output)
+
 	// Check for other errors
-	if err != nil {
+	if err != nil && output != "sat" && output != "unsat" {
 		result.Status = "error"
-		result.Message = fmt.Sprintf("z3 error: %v", err)
-		if stderr.Len() > 0 {
-			result.Message += "\n" + stderr.String()
-		}
+		result.Message = fmt.Sprintf("%s error: %v", name, err)
 		return result
 	}
 
-	// Parse z3 output
-	output := strings.TrimSpace(stdout.String())
-
 	// For ensures/invariants (negated): unsat = verified, sat = counterexample found
 	// For requires (satisfiability): sat = verified (consistent), unsat = contradictory
 
@@ -187,65 +379,79 @@ func runZ3(z3Path, smtLib string, isEnsures bool) *VerifyResult {
 		if isEnsures {
 			result.Status = "unverified"
 			result.Message = "counterexample found (contract may not hold)"
+			result.model = parseModel(modelText)
 		} else {
 			result.Status = "verified"
 			result.Message = "precondition is satisfiable (consistent)"
 		}
 	case "timeout":
 		result.Status = "timeout"
-		result.Message = "z3 timed out"
+		result.Message = name + " timed out"
 	case "unknown":
 		result.Status = "timeout"
-		result.Message = "z3 returned unknown (likely timeout or too complex)"
+		result.Message = name + " returned unknown (likely timeout or too complex)"
 	default:
 		result.Status = "error"
-		result.Message = fmt.Sprintf("unexpected z3 output: %s", output)
+		result.Message = fmt.Sprintf("unexpected %s output: %s", name, output)
 	}
 
 	return result
 }
 
 // verifyEntityWithZ3 verifies all contracts for an entity (invariants, constructor, methods)
-func verifyEntityWithZ3(ent *ir.Entity, z3Path string) []*VerifyResult {
-	var results []*VerifyResult
+func verifyEntityWithZ3(ent *ir.Entity, sc *solverContext) []*VerifyResult {
+	return sc.runAll(entityTasks(ent, sc))
+}
+
+// entityTasks lists the queries that verify an entity.
+func entityTasks(ent *ir.Entity, sc *solverContext) []verifyTask {
+	var tasks []verifyTask
 
 	// Verify invariants
 	for _, inv := range ent.Invariants {
-		smtLib := TranslateInvariant(ent.Name, ent.Fields, inv)
-		result := runZ3(z3Path, smtLib, true) // invariants proved by contradiction like ensures
-		result.EntityName = ent.Name
-		result.FunctionName = ""
-		result.ContractKind = "invariant"
-		result.ContractText = inv.RawText
-		result.IsEnsures = true
-		result.SMTOutput = smtLib
-		results = append(results, result)
+		tasks = append(tasks, func() *VerifyResult {
+			smtLib := TranslateInvariant(ent.Name, ent.Fields, inv)
+			result := sc.run(smtLib, true) // invariants proved by contradiction like ensures
+			result.EntityName = ent.Name
+			result.FunctionName = ""
+			result.ContractKind = "invariant"
+			result.ContractText = inv.RawText
+			result.locate(inv)
+			result.IsEnsures = true
+			attachCounterexample(result, entityModelNames(ent.Fields, nil, nil, false))
+			return result
+		})
 	}
 
 	// Verify constructor contracts
 	if ent.Constructor != nil {
 		ctor := ent.Constructor
 		for _, req := range ctor.Requires {
-			smtLib := TranslateMethodContract(ent.Name, "constructor", ent.Fields, ctor.Params, nil, nil, ent.Invariants, req, false, nil)
-			result := runZ3(z3Path, smtLib, false)
-			result.EntityName = ent.Name
-			result.FunctionName = "constructor"
-			result.ContractKind = "requires"
-			result.ContractText = req.RawText
-			result.IsEnsures = false
-			result.SMTOutput = smtLib
-			results = append(results, result)
+			tasks = append(tasks, func() *VerifyResult {
+				smtLib := TranslateMethodContract(ent.Name, "constructor", ent.Fields, ctor.Params, nil, nil, ent.Invariants, req, false, nil)
+				result := sc.run(smtLib, false)
+				result.EntityName = ent.Name
+				result.FunctionName = "constructor"
+				result.ContractKind = "requires"
+				result.ContractText = req.RawText
+				result.locate(req)
+				result.IsEnsures = false
+				return result
+			})
 		}
 		for _, ens := range ctor.Ensures {
-			smtLib := TranslateMethodContract(ent.Name, "constructor", ent.Fields, ctor.Params, nil, ctor.Requires, ent.Invariants, ens, true, ctor.OldCaptures)
-			result := runZ3(z3Path, smtLib, true)
-			result.EntityName = ent.Name
-			result.FunctionName = "constructor"
-			result.ContractKind = "ensures"
-			result.ContractText = ens.RawText
-			result.IsEnsures = true
-			result.SMTOutput = smtLib
-			results = append(results, result)
+			tasks = append(tasks, func() *VerifyResult {
+				smtLib := TranslateMethodContractWithBody(ent.Name, "constructor", ent.Fields, ctor.Params, nil, ctor.Requires, ent.Invariants, ens, ctor.OldCaptures, ctor.Body, false, sc.callees)
+				result := sc.run(smtLib, true)
+				result.EntityName = ent.Name
+				result.FunctionName = "constructor"
+				result.ContractKind = "ensures"
+				result.ContractText = ens.RawText
+				result.locate(ens)
+				result.IsEnsures = true
+				attachCounterexample(result, entityModelNames(ent.Fields, ctor.Params, ctor.OldCaptures, false))
+				return result
+			})
 		}
 	}
 
@@ -254,15 +460,19 @@ func verifyEntityWithZ3(ent *ir.Entity, z3Path string) []*VerifyResult {
 		loops := findWhileStmts(ent.Constructor.Body)
 		for i, loop := range loops {
 			for _, inv := range loop.Invariants {
-				smtLib := TranslateLoopInvariantForMethod(ent.Name, "constructor", ent.Fields, ent.Constructor.Params, loop, inv)
-				result := runZ3(z3Path, smtLib, true)
-				result.EntityName = ent.Name
-				result.FunctionName = fmt.Sprintf("constructor.loop_%d", i+1)
-				result.ContractKind = "loop_invariant"
-				result.ContractText = inv.RawText
-				result.IsEnsures = true
-				result.SMTOutput = smtLib
-				results = append(results, result)
+				tasks = append(tasks, func() *VerifyResult {
+					ctor := ent.Constructor
+					smtLib := TranslateLoopInvariantForMethod(ent.Name, "constructor", ent.Fields, ctor.Params, nil, ctor.Requires, ent.Invariants, ctor.Body, false, loop, inv, sc.callees)
+					result := sc.run(smtLib, true)
+					result.EntityName = ent.Name
+					result.FunctionName = fmt.Sprintf("constructor.loop_%d", i+1)
+					result.ContractKind = "loop_invariant"
+					result.ContractText = inv.RawText
+					result.locate(inv)
+					result.IsEnsures = true
+					attachCounterexample(result, entityModelNames(ent.Fields, ent.Constructor.Params, nil, false))
+					return result
+				})
 			}
 		}
 	}
@@ -270,46 +480,138 @@ func verifyEntityWithZ3(ent *ir.Entity, z3Path string) []*VerifyResult {
 	// Verify method contracts
 	for _, m := range ent.Methods {
 		for _, req := range m.Requires {
-			smtLib := TranslateMethodContract(ent.Name, m.Name, ent.Fields, m.Params, m.ReturnType, nil, ent.Invariants, req, false, nil)
-			result := runZ3(z3Path, smtLib, false)
-			result.EntityName = ent.Name
-			result.FunctionName = m.Name
-			result.ContractKind = "requires"
-			result.ContractText = req.RawText
-			result.IsEnsures = false
-			result.SMTOutput = smtLib
-			results = append(results, result)
+			tasks = append(tasks, func() *VerifyResult {
+				smtLib := TranslateMethodContract(ent.Name, m.Name, ent.Fields, m.Params, m.ReturnType, nil, ent.Invariants, req, false, nil)
+				result := sc.run(smtLib, false)
+				result.EntityName = ent.Name
+				result.FunctionName = m.Name
+				result.ContractKind = "requires"
+				result.ContractText = req.RawText
+				result.locate(req)
+				result.IsEnsures = false
+				return result
+			})
 		}
 		for _, ens := range m.Ensures {
-			smtLib := TranslateMethodContract(ent.Name, m.Name, ent.Fields, m.Params, m.ReturnType, m.Requires, ent.Invariants, ens, true, m.OldCaptures)
-			result := runZ3(z3Path, smtLib, true)
-			result.EntityName = ent.Name
-			result.FunctionName = m.Name
-			result.ContractKind = "ensures"
-			result.ContractText = ens.RawText
-			result.IsEnsures = true
-			result.SMTOutput = smtLib
-			results = append(results, result)
+			tasks = append(tasks, func() *VerifyResult {
+				smtLib := TranslateMethodContractWithBody(ent.Name, m.Name, ent.Fields, m.Params, m.ReturnType, m.Requires, ent.Invariants, ens, m.OldCaptures, m.Body, true, sc.callees)
+				result := sc.run(smtLib, true)
+				result.EntityName = ent.Name
+				result.FunctionName = m.Name
+				result.ContractKind = "ensures"
+				result.ContractText = ens.RawText
+				result.locate(ens)
+				result.IsEnsures = true
+				attachCounterexample(result, entityModelNames(ent.Fields, m.Params, m.OldCaptures, m.ReturnType != nil && m.ReturnType.Name != "Void"))
+				return result
+			})
 		}
 
 		// Verify loop invariants in method body
 		loops := findWhileStmts(m.Body)
 		for i, loop := range loops {
 			for _, inv := range loop.Invariants {
-				smtLib := TranslateLoopInvariantForMethod(ent.Name, m.Name, ent.Fields, m.Params, loop, inv)
-				result := runZ3(z3Path, smtLib, true)
-				result.EntityName = ent.Name
-				result.FunctionName = fmt.Sprintf("%s.loop_%d", m.Name, i+1)
-				result.ContractKind = "loop_invariant"
-				result.ContractText = inv.RawText
-				result.IsEnsures = true
-				result.SMTOutput = smtLib
-				results = append(results, result)
+				tasks = append(tasks, func() *VerifyResult {
+					smtLib := TranslateLoopInvariantForMethod(ent.Name, m.Name, ent.Fields, m.Params, m.ReturnType, m.Requires, ent.Invariants, m.Body, true, loop, inv, sc.callees)
+					result := sc.run(smtLib, true)
+					result.EntityName = ent.Name
+					result.FunctionName = fmt.Sprintf("%s.loop_%d", m.Name, i+1)
+					result.ContractKind = "loop_invariant"
+					result.ContractText = inv.RawText
+					result.locate(inv)
+					result.IsEnsures = true
+					attachCounterexample(result, entityModelNames(ent.Fields, m.Params, nil, false))
+					return result
+				})
 			}
 		}
 	}
 
-	return results
+	// Prove the constructor establishes and every method preserves the invariants
+	if len(ent.Invariants) > 0 {
+		if ent.Constructor != nil {
+			ctor := ent.Constructor
+			tasks = append(tasks, func() *VerifyResult {
+				smtLib := TranslateInvariantPreservation(ent.Name, "constructor", ent.Fields, ctor.Params, nil, ctor.Requires, ent.Invariants, ctor.Body, false, sc.callees)
+				return invariantPreservedResult(ent, "constructor", ctor.Params, smtLib, sc)
+			})
+		}
+		for _, m := range ent.Methods {
+			tasks = append(tasks, func() *VerifyResult {
+				smtLib := TranslateInvariantPreservation(ent.Name, m.Name, ent.Fields, m.Params, m.ReturnType, m.Requires, ent.Invariants, m.Body, true, sc.callees)
+				return invariantPreservedResult(ent, m.Name, m.Params, smtLib, sc)
+			})
+		}
+	}
+
+	// Prove the methods refine the contracts of the traits they implement
+	tasks = append(tasks, subtypeTasks(ent, sc)...)
+
+	// Verify callee preconditions at each call site in the constructor and methods
+	for _, ob := range TranslateEntityCallRequires(ent, sc.callees) {
+		params := scopeParams(ent, ob.Scope)
+		tasks = append(tasks, func() *VerifyResult {
+			result := sc.run(ob.SMT, true)
+			result.EntityName = ent.Name
+			result.FunctionName = ob.Scope
+			result.ContractKind = "call_requires"
+			result.ContractText = ob.Callee + ": " + ob.Contract.RawText
+			result.Line, result.Column = ob.Line, ob.Column
+			result.EndLine, result.EndColumn = ob.EndLine, ob.EndColumn
+			result.IsEnsures = true
+			attachCounterexample(result, entityModelNames(ent.Fields, params, nil, false))
+			return result
+		})
+	}
+
+	// Verify Int operations and array indexes are safe
+	for _, ob := range TranslateEntitySafetyChecks(ent, sc.callees) {
+		params := scopeParams(ent, ob.Scope)
+		tasks = append(tasks, func() *VerifyResult {
+			result := safetyResult(ob, sc, entityModelNames(ent.Fields, params, nil, false))
+			result.EntityName = ent.Name
+			result.FunctionName = ob.Scope
+			return result
+		})
+	}
+
+	return tasks
+}
+
+// scopeParams returns the parameters of the constructor or method of ent
+// that scope names, or nil for its invariants.
+func scopeParams(ent *ir.Entity, scope string) []*ir.Param {
+	switch {
+	case scope == "constructor":
+		return ent.Constructor.Params
+	case scope != "":
+		for _, m := range ent.Methods {
+			if m.Name == scope {
+				return m.Params
+			}
+		}
+	}
+	return nil
+}
+
+// invariantPreservedResult runs one invariant preservation query and labels
+// it Entity.method.invariant_preserved.
+func invariantPreservedResult(ent *ir.Entity, methodName string, params []*ir.Param, smtLib string, sc *solverContext) *VerifyResult {
+	texts := make([]string, len(ent.Invariants))
+	for i, inv := range ent.Invariants {
+		texts[i] = inv.RawText
+	}
+	result := sc.run(smtLib, true)
+	result.EntityName = ent.Name
+	result.FunctionName = methodName
+	result.ContractKind = "invariant_preserved"
+	result.ContractText = strings.Join(texts, "; ")
+	if len(ent.Invariants) > 0 {
+		result.locate(ent.Invariants[0])
+	}
+	result.IsEnsures = true
+	attachCounterexample(result, entityModelNames(ent.Fields, params, nil, false))
+	return result
 }
 
 // findWhileStmts recursively finds all WhileStmt nodes in a statement list
@@ -1,13 +1,19 @@
 package verify
 
 import (
+	"encoding/json"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/lhaig/intent/internal/checker"
 	"github.com/lhaig/intent/internal/ir"
 	"github.com/lhaig/intent/internal/lexer"
+	"github.com/lhaig/intent/internal/parser"
 )
 
 func TestTranslateSimpleRequires(t *testing.T) {
@@ -516,118 +522,81 @@ func TestQualifiedName(t *testing.T) {
 }
 
 func TestTranslateLoopInvariant(t *testing.T) {
-	fn := &ir.Function{
-		Name: "sum_to_n",
-		Params: []*ir.Param{
-			{Name: "n", Type: checker.TypeInt},
-		},
-		ReturnType: checker.TypeInt,
-		Requires: []*ir.Contract{
-			{
-				Expr: &ir.BinaryExpr{
-					Left:  &ir.VarRef{Name: "n", Type: checker.TypeInt},
-					Op:    lexer.GEQ,
-					Right: &ir.IntLit{Value: 0, Type: checker.TypeInt},
-					Type:  checker.TypeBool,
-				},
-				RawText: "n >= 0",
-			},
-		},
-	}
-
+	i := &ir.VarRef{Name: "i", Type: checker.TypeInt}
+	n := &ir.VarRef{Name: "n", Type: checker.TypeInt}
 	loop := &ir.WhileStmt{
-		Condition: &ir.BinaryExpr{
-			Left:  &ir.VarRef{Name: "i", Type: checker.TypeInt},
-			Op:    lexer.LT,
-			Right: &ir.VarRef{Name: "n", Type: checker.TypeInt},
-			Type:  checker.TypeBool,
+		Condition: &ir.BinaryExpr{Left: i, Op: lexer.LT, Right: n, Type: checker.TypeBool},
+		Invariants: []*ir.Contract{{
+			Expr:    &ir.BinaryExpr{Left: i, Op: lexer.GEQ, Right: &ir.IntLit{Value: 0, Type: checker.TypeInt}, Type: checker.TypeBool},
+			RawText: "i >= 0",
+		}},
+		Body: []ir.Stmt{
+			&ir.AssignStmt{Target: i, Value: &ir.BinaryExpr{Left: i, Op: lexer.PLUS, Right: &ir.IntLit{Value: 1, Type: checker.TypeInt}, Type: checker.TypeInt}},
 		},
-		Invariants: []*ir.Contract{
-			{
-				Expr: &ir.BinaryExpr{
-					Left:  &ir.VarRef{Name: "i", Type: checker.TypeInt},
-					Op:    lexer.GEQ,
-					Right: &ir.IntLit{Value: 0, Type: checker.TypeInt},
-					Type:  checker.TypeBool,
-				},
-				RawText: "i >= 0",
-			},
+	}
+	fn := &ir.Function{
+		Name:       "sum_to_n",
+		Params:     []*ir.Param{{Name: "n", Type: checker.TypeInt}},
+		ReturnType: checker.TypeInt,
+		Requires: []*ir.Contract{{
+			Expr:    &ir.BinaryExpr{Left: n, Op: lexer.GEQ, Right: &ir.IntLit{Value: 0, Type: checker.TypeInt}, Type: checker.TypeBool},
+			RawText: "n >= 0",
+		}},
+		Body: []ir.Stmt{
+			&ir.LetStmt{Name: "i", Mutable: true, Type: checker.TypeInt, Value: &ir.IntLit{Value: 0, Type: checker.TypeInt}},
+			loop,
+			&ir.ReturnStmt{Value: i},
 		},
 	}
 
 	smtLib := TranslateLoopInvariant(fn, loop, loop.Invariants[0])
 
-	// Should declare function params
+	// Should declare function params and the havocked loop variable
 	if !strings.Contains(smtLib, "(declare-const n Int)") {
 		t.Errorf("Expected n declaration, got: %s", smtLib)
 	}
+	if !strings.Contains(smtLib, "(declare-const i@1 Int)") {
+		t.Errorf("Expected havocked loop variable declaration, got: %s", smtLib)
+	}
 	// Should assume precondition
 	if !strings.Contains(smtLib, "(assert (>= n 0))") {
 		t.Errorf("Expected precondition assumption, got: %s", smtLib)
 	}
-	// Should assume invariant (inductive hypothesis)
-	if !strings.Contains(smtLib, "(assert (>= i 0))") {
-		t.Errorf("Expected inductive hypothesis, got: %s", smtLib)
-	}
-	// Should assume loop condition
-	if !strings.Contains(smtLib, "(assert (< i n))") {
-		t.Errorf("Expected loop condition, got: %s", smtLib)
-	}
-	// Should negate invariant for contradiction proof
-	if !strings.Contains(smtLib, "(assert (not (>= i 0)))") {
-		t.Errorf("Expected negated invariant, got: %s", smtLib)
+	// Should prove the invariant on entry, where i is 0, and after an
+	// iteration that starts from the invariant and the loop condition
+	want := "(assert (not (and (=> true (>= 0 0)) (=> (and (>= i@1 0) (< i@1 n)) (>= (+ i@1 1) 0)))))"
+	if !strings.Contains(smtLib, want) {
+		t.Errorf("Expected entry and preservation obligations %q, got: %s", want, smtLib)
 	}
 }
 
 func TestTranslateLoopInvariantForMethod(t *testing.T) {
+	count := &ir.FieldAccessExpr{Object: &ir.SelfRef{Type: checker.TypeInt}, Field: "count", Type: checker.TypeInt}
 	fields := []*ir.Field{
 		{Name: "count", Type: checker.TypeInt},
 	}
 	params := []*ir.Param{
 		{Name: "limit", Type: checker.TypeInt},
 	}
-
 	loop := &ir.WhileStmt{
-		Condition: &ir.BinaryExpr{
-			Left: &ir.FieldAccessExpr{
-				Object: &ir.SelfRef{Type: checker.TypeInt},
-				Field:  "count",
-				Type:   checker.TypeInt,
-			},
-			Op:    lexer.LT,
-			Right: &ir.VarRef{Name: "limit", Type: checker.TypeInt},
-			Type:  checker.TypeBool,
-		},
-		Invariants: []*ir.Contract{
-			{
-				Expr: &ir.BinaryExpr{
-					Left: &ir.FieldAccessExpr{
-						Object: &ir.SelfRef{Type: checker.TypeInt},
-						Field:  "count",
-						Type:   checker.TypeInt,
-					},
-					Op:    lexer.GEQ,
-					Right: &ir.IntLit{Value: 0, Type: checker.TypeInt},
-					Type:  checker.TypeBool,
-				},
-				RawText: "self.count >= 0",
-			},
+		Condition: &ir.BinaryExpr{Left: count, Op: lexer.LT, Right: &ir.VarRef{Name: "limit", Type: checker.TypeInt}, Type: checker.TypeBool},
+		Invariants: []*ir.Contract{{
+			Expr:    &ir.BinaryExpr{Left: count, Op: lexer.GEQ, Right: &ir.IntLit{Value: 0, Type: checker.TypeInt}, Type: checker.TypeBool},
+			RawText: "self.count >= 0",
+		}},
+		Body: []ir.Stmt{
+			&ir.AssignStmt{Target: count, Value: &ir.BinaryExpr{Left: count, Op: lexer.PLUS, Right: &ir.IntLit{Value: 1, Type: checker.TypeInt}, Type: checker.TypeInt}},
 		},
 	}
 
-	smtLib := TranslateLoopInvariantForMethod("Counter", "increment", fields, params, loop, loop.Invariants[0])
+	smtLib := TranslateLoopInvariantForMethod("Counter", "increment", fields, params, nil, nil, nil, []ir.Stmt{loop}, true, loop, loop.Invariants[0], nil)
 
 	if !strings.Contains(smtLib, "(declare-const self_count Int)") {
 		t.Errorf("Expected self_count declaration, got: %s", smtLib)
 	}
-	if !strings.Contains(smtLib, "(assert (>= self_count 0))") {
-		t.Errorf("Expected inductive hypothesis, got: %s", smtLib)
-	}
-	if !strings.Contains(smtLib, "(assert (< self_count limit))") {
-		t.Errorf("Expected loop condition, got: %s", smtLib)
-	}
-	if !strings.Contains(smtLib, "(assert (not (>= self_count 0)))") {
-		t.Errorf("Expected negated invariant, got: %s", smtLib)
+	want := "(assert (not (and (=> true (>= self_count 0)) (=> (and (>= self_count@1 0) (< self_count@1 limit)) (>= (+ self_count@1 1) 0)))))"
+	if !strings.Contains(smtLib, want) {
+		t.Errorf("Expected entry and preservation obligations %q, got: %s", want, smtLib)
 	}
 }
 
@@ -659,44 +628,132 @@ func TestFindWhileStmts(t *testing.T) {
 }
 
 func TestLoopInvariantWithOld(t *testing.T) {
-	fn := &ir.Function{
-		Name: "accumulate",
-		Params: []*ir.Param{
-			{Name: "n", Type: checker.TypeInt},
+	sum := &ir.VarRef{Name: "sum", Type: checker.TypeInt}
+	loop := &ir.WhileStmt{
+		Condition: &ir.BinaryExpr{Left: sum, Op: lexer.LT, Right: &ir.VarRef{Name: "n", Type: checker.TypeInt}, Type: checker.TypeBool},
+		OldCaptures: []*ir.OldCapture{
+			{Name: "__old_sum", Expr: sum},
+		},
+		Invariants: []*ir.Contract{{
+			Expr:    &ir.BinaryExpr{Left: sum, Op: lexer.GEQ, Right: &ir.OldRef{Name: "__old_sum", Type: checker.TypeInt}, Type: checker.TypeBool},
+			RawText: "sum >= old(sum)",
+		}},
+		Body: []ir.Stmt{
+			&ir.AssignStmt{Target: sum, Value: &ir.BinaryExpr{Left: sum, Op: lexer.PLUS, Right: &ir.IntLit{Value: 1, Type: checker.TypeInt}, Type: checker.TypeInt}},
 		},
+	}
+	fn := &ir.Function{
+		Name:       "accumulate",
+		Params:     []*ir.Param{{Name: "n", Type: checker.TypeInt}},
 		ReturnType: checker.TypeInt,
+		Body: []ir.Stmt{
+			&ir.LetStmt{Name: "sum", Mutable: true, Type: checker.TypeInt, Value: &ir.IntLit{Value: 5, Type: checker.TypeInt}},
+			loop,
+			&ir.ReturnStmt{Value: sum},
+		},
+	}
+
+	smtLib := TranslateLoopInvariant(fn, loop, loop.Invariants[0])
+
+	// old(sum) is the value sum has where the loop is entered
+	if !strings.Contains(smtLib, "(=> true (>= 5 5))") {
+		t.Errorf("Expected old capture bound at loop entry, got: %s", smtLib)
+	}
+	if !strings.Contains(smtLib, "(>= (+ sum@1 1) 5)") {
+		t.Errorf("Expected old capture kept across the iteration, got: %s", smtLib)
 	}
+}
 
+func TestTranslateLoopInvariantBreak(t *testing.T) {
+	i := &ir.VarRef{Name: "i", Type: checker.TypeInt}
+	ten := &ir.IntLit{Value: 10, Type: checker.TypeInt}
 	loop := &ir.WhileStmt{
-		Condition: &ir.BinaryExpr{
-			Left:  &ir.VarRef{Name: "i", Type: checker.TypeInt},
-			Op:    lexer.LT,
-			Right: &ir.VarRef{Name: "n", Type: checker.TypeInt},
-			Type:  checker.TypeBool,
+		Condition: &ir.BinaryExpr{Left: i, Op: lexer.LT, Right: ten, Type: checker.TypeBool},
+		Invariants: []*ir.Contract{{
+			Expr:    &ir.BinaryExpr{Left: i, Op: lexer.LEQ, Right: ten, Type: checker.TypeBool},
+			RawText: "i <= 10",
+		}},
+		Body: []ir.Stmt{
+			&ir.AssignStmt{Target: i, Value: &ir.BinaryExpr{Left: i, Op: lexer.PLUS, Right: &ir.IntLit{Value: 100, Type: checker.TypeInt}, Type: checker.TypeInt}},
+			&ir.BreakStmt{},
 		},
-		OldCaptures: []*ir.OldCapture{
-			{Name: "__old_sum", Expr: &ir.VarRef{Name: "sum", Type: checker.TypeInt}},
+	}
+	fn := &ir.Function{
+		Name:       "jump",
+		ReturnType: checker.TypeInt,
+		Body: []ir.Stmt{
+			&ir.LetStmt{Name: "i", Mutable: true, Type: checker.TypeInt, Value: &ir.IntLit{Value: 0, Type: checker.TypeInt}},
+			loop,
+			&ir.ReturnStmt{Value: i},
 		},
-		Invariants: []*ir.Contract{
-			{
-				Expr: &ir.BinaryExpr{
-					Left:  &ir.VarRef{Name: "sum", Type: checker.TypeInt},
-					Op:    lexer.GEQ,
-					Right: &ir.OldRef{Name: "__old_sum", Type: checker.TypeInt},
-					Type:  checker.TypeBool,
+	}
+
+	// The invariant is not checked when the loop breaks, so it is only
+	// required on entry
+	smtLib := TranslateLoopInvariant(fn, loop, loop.Invariants[0])
+	if !strings.Contains(smtLib, "(assert (not (=> true (<= 0 10))))") {
+		t.Errorf("Expected only the entry obligation, got: %s", smtLib)
+	}
+
+	// Nor is it assumed after the loop
+	contract := &ir.Contract{
+		Expr:    &ir.BinaryExpr{Left: &ir.ResultRef{Type: checker.TypeInt}, Op: lexer.LEQ, Right: ten, Type: checker.TypeBool},
+		RawText: "result <= 10",
+	}
+	smtLib = TranslateContract(fn, contract, true)
+	if !strings.Contains(smtLib, "(assert (= result i@1))") {
+		t.Errorf("Expected nothing assumed on exit from a loop that breaks, got: %s", smtLib)
+	}
+}
+
+func TestVerifyLoopInvariantNotEstablished(t *testing.T) {
+	if _, err := exec.LookPath("z3"); err != nil {
+		t.Skip("z3 not found on PATH, skipping integration test")
+	}
+
+	// while i < n invariant i == 12345 { i = i + 1 } return i; would let
+	// ensures result == 12345 through if the invariant were only assumed
+	i := &ir.VarRef{Name: "i", Type: checker.TypeInt}
+	magic := &ir.IntLit{Value: 12345, Type: checker.TypeInt}
+	fn := &ir.Function{
+		Name:       "count",
+		Params:     []*ir.Param{{Name: "n", Type: checker.TypeInt}},
+		ReturnType: checker.TypeInt,
+		Ensures: []*ir.Contract{{
+			Expr:    &ir.BinaryExpr{Left: &ir.ResultRef{Type: checker.TypeInt}, Op: lexer.EQ, Right: magic, Type: checker.TypeBool},
+			RawText: "result == 12345",
+		}},
+		Body: []ir.Stmt{
+			&ir.LetStmt{Name: "i", Mutable: true, Type: checker.TypeInt, Value: &ir.IntLit{Value: 0, Type: checker.TypeInt}},
+			&ir.WhileStmt{
+				Condition: &ir.BinaryExpr{Left: i, Op: lexer.LT, Right: &ir.VarRef{Name: "n", Type: checker.TypeInt}, Type: checker.TypeBool},
+				Invariants: []*ir.Contract{{
+					Expr:    &ir.BinaryExpr{Left: i, Op: lexer.EQ, Right: magic, Type: checker.TypeBool},
+					RawText: "i == 12345",
+				}},
+				Body: []ir.Stmt{
+					&ir.AssignStmt{Target: i, Value: &ir.BinaryExpr{Left: i, Op: lexer.PLUS, Right: &ir.IntLit{Value: 1, Type: checker.TypeInt}, Type: checker.TypeInt}},
 				},
-				RawText: "sum >= old(sum)",
 			},
+			&ir.ReturnStmt{Value: i},
 		},
 	}
 
-	smtLib := TranslateLoopInvariant(fn, loop, loop.Invariants[0])
-
-	if !strings.Contains(smtLib, "(declare-const __old_sum Int)") {
-		t.Errorf("Expected old capture declaration, got: %s", smtLib)
+	solver, err := NewSolver("z3")
+	if err != nil {
+		t.Fatal(err)
 	}
-	if !strings.Contains(smtLib, "__old_sum") {
-		t.Errorf("Expected old ref in SMT, got: %s", smtLib)
+	found := false
+	for _, r := range verifyFunctionWithZ3(fn, &solverContext{solver: solver, datatypes: builtinDatatypes}) {
+		if r.ContractKind == "loop_invariant" {
+			found = true
+			if r.Status != "unverified" {
+				t.Errorf("Expected the invariant to be unverified, got %s (%s)", r.Status, r.Message)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected a loop_invariant result")
 	}
 }
 
@@ -757,3 +814,1537 @@ func TestVerifyWithRequires(t *testing.T) {
 		t.Errorf("Expected results for both requires and ensures")
 	}
 }
+
+func TestTranslateEnsuresWithBody(t *testing.T) {
+	x := &ir.VarRef{Name: "x", Type: checker.TypeInt}
+	fn := &ir.Function{
+		Name:       "abs",
+		Params:     []*ir.Param{{Name: "x", Type: checker.TypeInt}},
+		ReturnType: checker.TypeInt,
+		Body: []ir.Stmt{
+			&ir.IfStmt{
+				Condition: &ir.BinaryExpr{Left: x, Op: lexer.LT, Right: &ir.IntLit{Value: 0, Type: checker.TypeInt}, Type: checker.TypeBool},
+				Then: []ir.Stmt{
+					&ir.ReturnStmt{Value: &ir.UnaryExpr{Op: lexer.MINUS, Operand: x, Type: checker.TypeInt}},
+				},
+			},
+			&ir.LetStmt{Name: "y", Type: checker.TypeInt, Value: x},
+			&ir.ReturnStmt{Value: &ir.VarRef{Name: "y", Type: checker.TypeInt}},
+		},
+	}
+	contract := &ir.Contract{
+		Expr: &ir.BinaryExpr{
+			Left:  &ir.ResultRef{Type: checker.TypeInt},
+			Op:    lexer.GEQ,
+			Right: &ir.IntLit{Value: 0, Type: checker.TypeInt},
+			Type:  checker.TypeBool,
+		},
+		RawText: "result >= 0",
+	}
+
+	smtLib := TranslateContract(fn, contract, true)
+
+	want := "(assert (or (and (< x 0) (= result (- x))) (and (not (< x 0)) (= result x))))"
+	if !strings.Contains(smtLib, want) {
+		t.Errorf("Expected body path constraint %q, got: %s", want, smtLib)
+	}
+	if !strings.Contains(smtLib, "(assert (not (>= result 0)))") {
+		t.Errorf("Expected negated ensures, got: %s", smtLib)
+	}
+}
+
+func TestTranslateEnsuresSummarizesLoops(t *testing.T) {
+	i := &ir.VarRef{Name: "i", Type: checker.TypeInt}
+	n := &ir.VarRef{Name: "n", Type: checker.TypeInt}
+	fn := &ir.Function{
+		Name:       "count_up",
+		Params:     []*ir.Param{{Name: "n", Type: checker.TypeInt}},
+		ReturnType: checker.TypeInt,
+		Body: []ir.Stmt{
+			&ir.LetStmt{Name: "i", Mutable: true, Type: checker.TypeInt, Value: &ir.IntLit{Value: 0, Type: checker.TypeInt}},
+			&ir.WhileStmt{
+				Condition: &ir.BinaryExpr{Left: i, Op: lexer.LT, Right: n, Type: checker.TypeBool},
+				Invariants: []*ir.Contract{{
+					Expr:    &ir.BinaryExpr{Left: i, Op: lexer.GEQ, Right: &ir.IntLit{Value: 0, Type: checker.TypeInt}, Type: checker.TypeBool},
+					RawText: "i >= 0",
+				}},
+				Body: []ir.Stmt{
+					&ir.AssignStmt{Target: i, Value: &ir.BinaryExpr{Left: i, Op: lexer.PLUS, Right: &ir.IntLit{Value: 1, Type: checker.TypeInt}, Type: checker.TypeInt}},
+				},
+			},
+			&ir.ReturnStmt{Value: i},
+		},
+	}
+	contract := &ir.Contract{
+		Expr:    &ir.BinaryExpr{Left: &ir.ResultRef{Type: checker.TypeInt}, Op: lexer.GEQ, Right: n, Type: checker.TypeBool},
+		RawText: "result >= n",
+	}
+
+	smtLib := TranslateContract(fn, contract, true)
+
+	if !strings.Contains(smtLib, "(declare-const i@1 Int)") {
+		t.Errorf("Expected havocked loop variable declaration, got: %s", smtLib)
+	}
+	want := "(assert (and (>= i@1 0) (not (< i@1 n)) (= result i@1)))"
+	if !strings.Contains(smtLib, want) {
+		t.Errorf("Expected loop exit assumptions %q, got: %s", want, smtLib)
+	}
+}
+
+func TestTranslateEnsuresWithMatch(t *testing.T) {
+	color := &checker.Type{Name: "Color", IsEnum: true, EnumInfo: &checker.EnumInfo{
+		Name: "Color",
+		Variants: []*checker.EnumVariantInfo{
+			{Name: "Red"}, {Name: "Green"}, {Name: "Blue"},
+		},
+	}}
+	fn := &ir.Function{
+		Name:       "code",
+		Params:     []*ir.Param{{Name: "c", Type: color}},
+		ReturnType: checker.TypeInt,
+		Body: []ir.Stmt{
+			&ir.ReturnStmt{Value: &ir.MatchExpr{
+				Scrutinee: &ir.VarRef{Name: "c", Type: color},
+				Arms: []*ir.MatchArm{
+					{Pattern: &ir.MatchPattern{EnumName: "Color", VariantName: "Red"}, Body: &ir.IntLit{Value: 1, Type: checker.TypeInt}},
+					{Pattern: &ir.MatchPattern{EnumName: "Color", VariantName: "Blue"}, Body: &ir.IntLit{Value: 3, Type: checker.TypeInt}},
+					{Pattern: &ir.MatchPattern{IsWildcard: true}, Body: &ir.IntLit{Value: 2, Type: checker.TypeInt}},
+				},
+				Type: checker.TypeInt,
+			}},
+		},
+	}
+	contract := &ir.Contract{
+		Expr:    &ir.BinaryExpr{Left: &ir.ResultRef{Type: checker.TypeInt}, Op: lexer.GT, Right: &ir.IntLit{Value: 0, Type: checker.TypeInt}, Type: checker.TypeBool},
+		RawText: "result > 0",
+	}
+
+	smtLib := TranslateContract(fn, contract, true)
+
+	if !strings.Contains(smtLib, "(declare-const c Color)") {
+		t.Errorf("Expected enum parameter declared with its datatype sort, got: %s", smtLib)
+	}
+	want := "(= result (ite ((_ is Color.Red) c) 1 (ite ((_ is Color.Blue) c) 3 2)))"
+	if !strings.Contains(smtLib, want) {
+		t.Errorf("Expected match encoded as ite %q, got: %s", want, smtLib)
+	}
+}
+
+func TestParseModel(t *testing.T) {
+	output := `(
+  (define-fun amount () Int
+    (- 1))
+  (define-fun self_balance () Int
+    0)
+  (define-fun |__old_self_balance| () Int
+    7)
+  (define-fun ok () Bool
+    false)
+  (define-fun ratio () Real
+    (/ 1.0 2.0))
+  (define-fun f ((x!0 Int)) Int
+    x!0)
+)`
+
+	model := parseModel(output)
+
+	want := map[string]string{
+		"amount":             "-1",
+		"self_balance":       "0",
+		"__old_self_balance": "7",
+		"ok":                 "false",
+		"ratio":              "1.0/2.0",
+	}
+	for name, val := range want {
+		if model[name] != val {
+			t.Errorf("model[%q] = %q, want %q", name, model[name], val)
+		}
+	}
+	if _, ok := model["f"]; ok {
+		t.Errorf("Expected non-nullary define-fun to be skipped")
+	}
+
+	// Older z3 releases wrap the model in (model ...)
+	legacy := parseModel("(model\n  (define-fun x () Int 3)\n)")
+	if legacy["x"] != "3" {
+		t.Errorf("Expected legacy model x = 3, got %q", legacy["x"])
+	}
+}
+
+func TestAttachCounterexample(t *testing.T) {
+	fields := []*ir.Field{{Name: "balance", Type: checker.TypeInt}}
+	params := []*ir.Param{{Name: "amount", Type: checker.TypeInt}}
+	oldCaptures := []*ir.OldCapture{{
+		Name: "__old_self_balance",
+		Expr: &ir.FieldAccessExpr{Object: &ir.SelfRef{}, Field: "balance", Type: checker.TypeInt},
+	}}
+
+	result := &VerifyResult{
+		Status:  "unverified",
+		Message: "counterexample found (contract may not hold)",
+		model: map[string]string{
+			"amount":             "-1",
+			"self_balance":       "0",
+			"__old_self_balance": "1",
+			"self_balance@1":     "5",
+		},
+	}
+	attachCounterexample(result, entityModelNames(fields, params, oldCaptures, false))
+
+	if len(result.Counterexample) != 3 {
+		t.Fatalf("Expected 3 counterexample values, got %d: %v", len(result.Counterexample), result.Counterexample)
+	}
+	want := "amount = -1, self.balance = 0, old(self.balance) = 1"
+	if got := result.FormatCounterexample(); got != want {
+		t.Errorf("FormatCounterexample() = %q, want %q", got, want)
+	}
+	if result.Message != "counterexample found: fails when "+want {
+		t.Errorf("Unexpected message: %q", result.Message)
+	}
+}
+
+func TestRunZ3ReadsModel(t *testing.T) {
+	// A stand-in solver that refutes every query
+	dir := t.TempDir()
+	fake := filepath.Join(dir, "z3")
+	script := "#!/bin/sh\ncat >/dev/null\necho sat\necho '((define-fun x () Int (- 4)))'\n"
+	if err := os.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	fn := &ir.Function{
+		Name:       "id",
+		Params:     []*ir.Param{{Name: "x", Type: checker.TypeInt}},
+		ReturnType: checker.TypeInt,
+		Ensures: []*ir.Contract{{
+			Expr:    &ir.BinaryExpr{Left: &ir.ResultRef{Type: checker.TypeInt}, Op: lexer.GEQ, Right: &ir.IntLit{Value: 0, Type: checker.TypeInt}, Type: checker.TypeBool},
+			RawText: "result >= 0",
+		}},
+	}
+
+	results := verifyFunctionWithZ3(fn, &solverContext{solver: NewZ3(fake)})
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+	if results[0].Status != "unverified" {
+		t.Fatalf("Expected unverified, got %s (%s)", results[0].Status, results[0].Message)
+	}
+	if got := results[0].FormatCounterexample(); got != "x = -4" {
+		t.Errorf("Expected counterexample x = -4, got %q", got)
+	}
+}
+
+// lowerSource parses, checks and lowers a single-file program, for tests
+// that start from Intent source rather than hand-built IR.
+func lowerSource(t *testing.T, src string) *ir.Module {
+	t.Helper()
+	p := parser.New(src)
+	prog := p.Parse()
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("parse errors: %s", p.Diagnostics().Format("test"))
+	}
+	result := checker.CheckWithResult(prog)
+	if result.Diagnostics.HasErrors() {
+		t.Fatalf("check errors: %s", result.Diagnostics.Format("test"))
+	}
+	return ir.Lower(prog, result)
+}
+
+// callsSource calls inc, which requires a non-negative argument, from a
+// function and from a method.
+const callsSource = `module test version "1.0";
+
+function inc(x: Int) returns Int
+    requires x >= 0
+    ensures result == x + 1
+{
+    return x + 1;
+}
+
+function caller(n: Int) returns Int
+    requires n >= 0
+    ensures result == n
+{
+    return inc(n - 1);
+}
+
+entity Counter {
+    field n: Int;
+    invariant self.n >= 0;
+
+    constructor() {
+        self.n = inc(0);
+    }
+
+    method skip(k: Int) returns Int
+        requires k >= 0
+    {
+        return inc(self.n - k);
+    }
+}
+`
+
+func TestTranslateCallAssumesCalleeEnsures(t *testing.T) {
+	mod := lowerSource(t, callsSource)
+	caller := mod.Functions[1]
+	callees := NewContractTable(mod, nil)
+
+	smtLib := TranslateContractWithCallees(caller, caller.Ensures[0], true, callees)
+
+	if !strings.Contains(smtLib, "(declare-const inc_result@1 Int)") {
+		t.Errorf("Expected fresh callee result, got: %s", smtLib)
+	}
+	want := "(=> (>= (- n 1) 0) (= inc_result@1 (+ (- n 1) 1)))"
+	if !strings.Contains(smtLib, want) {
+		t.Errorf("Expected callee ensures assumption %q, got: %s", want, smtLib)
+	}
+	if !strings.Contains(smtLib, "(= result inc_result@1)") {
+		t.Errorf("Expected result bound to callee result, got: %s", smtLib)
+	}
+}
+
+func TestTranslateEnsuresCallAssumesCalleeEnsures(t *testing.T) {
+	mod := lowerSource(t, `module test version "1.0";
+
+function is_pos(x: Int) returns Bool
+    ensures result == (x > 0)
+{
+    return x > 0;
+}
+
+function neg() returns Int
+    ensures is_pos(result)
+{
+    return 0 - 5;
+}
+`)
+	neg := mod.Functions[1]
+
+	smtLib := TranslateContractWithCallees(neg, neg.Ensures[0], true, NewContractTable(mod, nil))
+
+	for _, want := range []string{
+		"(declare-const is_pos_result@1 Bool)",
+		"(assert (= is_pos_result@1 (> result 0)))",
+		"(assert (not is_pos_result@1))",
+	} {
+		if !strings.Contains(smtLib, want) {
+			t.Errorf("Expected %q, got: %s", want, smtLib)
+		}
+	}
+}
+
+func TestVerifyReportsUntranslatableGoals(t *testing.T) {
+	mod := lowerSource(t, `module test version "1.0";
+
+function is_pos(x: Int) returns Bool {
+    return x > 0;
+}
+
+entity Gauge {
+    field level: Int;
+    invariant is_pos(self.level);
+
+    constructor() {
+        self.level = 1;
+    }
+}
+`)
+	// Refuting every goal would prove the invariant if is_pos became true
+	solver := &ScriptedSolver{Respond: func(string) string { return "unsat" }}
+
+	for _, r := range VerifyInProgramWith(mod, nil, Options{Solver: solver}) {
+		if r.QualifiedName() != "Gauge.invariant" {
+			continue
+		}
+		if r.Status != "unverified" || !strings.Contains(r.Message, "cannot translate") {
+			t.Errorf("Expected the invariant reported untranslatable, got %s: %s", r.Status, r.Message)
+		}
+		return
+	}
+	t.Error("Expected a Gauge.invariant result")
+}
+
+func TestTranslateCallRequires(t *testing.T) {
+	mod := lowerSource(t, callsSource)
+	caller := mod.Functions[1]
+	callees := NewContractTable(mod, nil)
+
+	obligations := TranslateCallRequires(caller, callees)
+
+	if len(obligations) != 1 {
+		t.Fatalf("Expected 1 call obligation, got %d", len(obligations))
+	}
+	ob := obligations[0]
+	if ob.Callee != "inc" || ob.Contract.RawText != "x >= 0" {
+		t.Errorf("Unexpected obligation %s: %s", ob.Callee, ob.Contract.RawText)
+	}
+	if !strings.Contains(ob.SMT, "(assert (>= n 0))") {
+		t.Errorf("Expected caller requires assumed, got: %s", ob.SMT)
+	}
+	if !strings.Contains(ob.SMT, "(assert (not (>= (- n 1) 0)))") {
+		t.Errorf("Expected negated callee requires with argument substituted, got: %s", ob.SMT)
+	}
+}
+
+func TestTranslateEntityCallRequires(t *testing.T) {
+	mod := lowerSource(t, callsSource)
+	callees := NewContractTable(mod, nil)
+
+	obligations := TranslateEntityCallRequires(mod.Entities[0], callees)
+
+	if len(obligations) != 2 {
+		t.Fatalf("Expected call obligations in the constructor and the method, got %d", len(obligations))
+	}
+	if ob := obligations[0]; ob.Scope != "constructor" || !strings.Contains(ob.SMT, "(assert (not (>= 0 0)))") {
+		t.Errorf("Unexpected constructor obligation in %q: %s", ob.Scope, ob.SMT)
+	}
+	ob := obligations[1]
+	if ob.Scope != "skip" || ob.Callee != "inc" || ob.Contract.RawText != "x >= 0" {
+		t.Errorf("Unexpected obligation in %q: %s: %s", ob.Scope, ob.Callee, ob.Contract.RawText)
+	}
+	for _, want := range []string{
+		"(declare-const self_n Int)",
+		"(assert (>= self_n 0))",
+		"(assert (>= k 0))",
+		"(assert (not (>= (- self_n k) 0)))",
+	} {
+		if !strings.Contains(ob.SMT, want) {
+			t.Errorf("Expected %q in method call obligation, got: %s", want, ob.SMT)
+		}
+	}
+}
+
+func TestVerifyReportsViolatingCallFromMethod(t *testing.T) {
+	// A solver that finds a counterexample to every call-site precondition
+	solver := &ScriptedSolver{Respond: func(query string) string {
+		if strings.Contains(query, "; Call-site precondition in method: Counter.skip") {
+			return "sat"
+		}
+		return "unsat"
+	}}
+	results := VerifyInProgramWith(lowerSource(t, callsSource), nil, Options{Solver: solver})
+
+	found := false
+	for _, r := range results {
+		if r.QualifiedName() == "Counter.skip.call_requires" {
+			found = true
+			if r.Status != "unverified" || r.ContractText != "inc: x >= 0" {
+				t.Errorf("Expected inc: x >= 0 unverified, got %s: %s", r.ContractText, r.Status)
+			}
+			if r.Line != 28 || r.Column != 16 {
+				t.Errorf("Expected the call site at 28:16, got %d:%d", r.Line, r.Column)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected a call_requires result for Counter.skip")
+	}
+
+	if _, err := exec.LookPath("z3"); err != nil {
+		return
+	}
+	for _, r := range Verify(lowerSource(t, callsSource)) {
+		if r.QualifiedName() == "Counter.skip.call_requires" && r.Status != "unverified" {
+			t.Errorf("Expected z3 to refute inc(self.n - k), got %s", r.Status)
+		}
+	}
+}
+
+func TestNewContractTableQualifiesOtherModules(t *testing.T) {
+	mod := lowerSource(t, callsSource)
+	lib := &ir.Module{Name: "math", Functions: mod.Functions[:1]}
+	main := &ir.Module{Name: "main", Functions: mod.Functions[1:]}
+	prog := &ir.Program{Modules: []*ir.Module{lib, main}}
+
+	table := NewContractTable(main, prog)
+
+	if _, ok := table["math.inc"]; !ok {
+		t.Errorf("Expected math.inc in contract table")
+	}
+	if _, ok := table["caller"]; !ok {
+		t.Errorf("Expected caller in contract table")
+	}
+	if _, ok := table["inc"]; ok {
+		t.Errorf("Expected inc from another module to be qualified")
+	}
+}
+
+// accountSource has an invariant that deposit preserves and that the
+// constructor only establishes for a non-negative initial balance.
+const accountSource = `module test version "1.0";
+
+entity Account {
+    field balance: Int;
+    invariant self.balance >= 0;
+
+    constructor(initial: Int) {
+        self.balance = initial;
+    }
+
+    method deposit(amount: Int) returns Void
+        requires amount > 0
+    {
+        self.balance = self.balance + amount;
+    }
+}
+`
+
+func TestTranslateInvariantPreservationMethod(t *testing.T) {
+	ent := lowerSource(t, accountSource).Entities[0]
+	m := ent.Methods[0]
+
+	smtLib := TranslateInvariantPreservation("Account", "deposit", ent.Fields, m.Params, m.ReturnType, m.Requires, ent.Invariants, m.Body, true, nil)
+
+	if !strings.Contains(smtLib, "; Invariants (assumptions, pre-state)\n(assert (>= self_balance 0))") {
+		t.Errorf("Expected invariant assumed in pre-state, got: %s", smtLib)
+	}
+	if !strings.Contains(smtLib, "(assert (> amount 0))") {
+		t.Errorf("Expected requires assumption, got: %s", smtLib)
+	}
+	if !strings.Contains(smtLib, "(assert (not (=> true (>= (+ self_balance amount) 0))))") {
+		t.Errorf("Expected invariant checked against post-state, got: %s", smtLib)
+	}
+}
+
+func TestTranslateInvariantPreservationConstructor(t *testing.T) {
+	ent := lowerSource(t, accountSource).Entities[0]
+	ctor := ent.Constructor
+
+	smtLib := TranslateInvariantPreservation("Account", "constructor", ent.Fields, ctor.Params, nil, ctor.Requires, ent.Invariants, ctor.Body, false, nil)
+
+	if strings.Contains(smtLib, "pre-state") {
+		t.Errorf("Constructor must not assume invariants, got: %s", smtLib)
+	}
+	if !strings.Contains(smtLib, "(assert (not (=> true (>= initial 0))))") {
+		t.Errorf("Expected constructor to establish invariant, got: %s", smtLib)
+	}
+}
+
+func TestBuildIntentReportsUsesInvariantPreservation(t *testing.T) {
+	mod := &ir.Module{
+		Intents: []*ir.Intent{
+			{Description: "Balance stays non-negative", VerifiedBy: [][]string{{"Account", "invariant"}}},
+		},
+	}
+	results := []*VerifyResult{
+		{EntityName: "Account", FunctionName: "invariant", ContractKind: "invariant", Status: "unverified"},
+		{EntityName: "Account", FunctionName: "constructor", ContractKind: "invariant_preserved", Status: "verified"},
+		{EntityName: "Account", FunctionName: "deposit", ContractKind: "invariant_preserved", Status: "verified"},
+	}
+
+	reports := BuildIntentReports(mod, results)
+	ref := reports[0].Refs[0]
+	if ref.Status != "verified" {
+		t.Errorf("Expected preservation proofs to verify the invariant, got %s", ref.Status)
+	}
+
+	results[2].Status = "unverified"
+	reports = BuildIntentReports(mod, results)
+	if reports[0].Refs[0].Status != "unverified" {
+		t.Errorf("Expected a method breaking the invariant to fail the intent")
+	}
+}
+
+func TestTranslateSafetyChecks(t *testing.T) {
+	mod := lowerSource(t, callsSource)
+	inc, caller := mod.Functions[0], mod.Functions[1]
+	callees := NewContractTable(mod, nil)
+
+	// caller: requires n >= 0; return inc(n - 1)
+	obligations := TranslateSafetyChecks(caller, callees)
+
+	if len(obligations) != 1 {
+		t.Fatalf("Expected 1 arithmetic obligation, got %d", len(obligations))
+	}
+	ob := obligations[0]
+	if ob.Kind != "overflow" || ir.FormatExpr(ob.Expr) != "n - 1" || ob.Line != 14 {
+		t.Errorf("Unexpected obligation %s of %s at line %d", ob.Kind, ir.FormatExpr(ob.Expr), ob.Line)
+	}
+	if !strings.Contains(ob.SMT, "(assert (and (<= (- 9223372036854775808) n) (<= n 9223372036854775807)))") {
+		t.Errorf("Expected parameter range assumed, got: %s", ob.SMT)
+	}
+	want := "(assert (and (>= n 0) (not (and (<= (- 9223372036854775808) (- n 1)) (<= (- n 1) 9223372036854775807)))))"
+	if !strings.Contains(ob.SMT, want) {
+		t.Errorf("Expected overflow goal under the requires, got: %s", ob.SMT)
+	}
+
+	// The callee's own ensures arithmetic is checked where inc is verified,
+	// under its requires, as is its body
+	obligations = TranslateSafetyChecks(inc, callees)
+	if len(obligations) != 2 {
+		t.Fatalf("Expected inc's body and ensures arithmetic to be checked, got %d obligations", len(obligations))
+	}
+	for _, ob := range obligations {
+		if ir.FormatExpr(ob.Expr) != "x + 1" || !strings.Contains(ob.SMT, "(>= x 0)") {
+			t.Errorf("Expected x + 1 checked under inc's requires, got %s: %s", ir.FormatExpr(ob.Expr), ob.SMT)
+		}
+	}
+}
+
+func TestTranslateSafetyChecksDivision(t *testing.T) {
+	a := &ir.VarRef{Name: "a", Type: checker.TypeInt}
+	b := &ir.VarRef{Name: "b", Type: checker.TypeInt}
+	div := &ir.BinaryExpr{Left: a, Op: lexer.SLASH, Right: b, Type: checker.TypeInt, Line: 2, Column: 14}
+	fn := &ir.Function{
+		Name:       "quot",
+		Params:     []*ir.Param{{Name: "a", Type: checker.TypeInt}, {Name: "b", Type: checker.TypeInt}},
+		ReturnType: checker.TypeInt,
+		Body: []ir.Stmt{
+			&ir.IfStmt{
+				Condition: &ir.BinaryExpr{Left: b, Op: lexer.NEQ, Right: &ir.IntLit{Value: 0, Type: checker.TypeInt}, Type: checker.TypeBool},
+				Then:      []ir.Stmt{&ir.ReturnStmt{Value: div}},
+			},
+			&ir.ReturnStmt{Value: &ir.UnaryExpr{Op: lexer.MINUS, Operand: a, Type: checker.TypeInt, Line: 3, Column: 12}},
+		},
+	}
+
+	obligations := TranslateSafetyChecks(fn, nil)
+	if len(obligations) != 3 {
+		t.Fatalf("Expected div_by_zero, division overflow and negation obligations, got %d", len(obligations))
+	}
+	if obligations[0].Kind != "div_by_zero" || obligations[0].Column != 14 {
+		t.Errorf("Expected div_by_zero at column 14 first, got %s at %d", obligations[0].Kind, obligations[0].Column)
+	}
+	if !strings.Contains(obligations[0].SMT, "(assert (and (not (= b 0)) (not (not (= b 0)))))") {
+		t.Errorf("Expected divisor check under the branch condition, got: %s", obligations[0].SMT)
+	}
+	if !strings.Contains(obligations[1].SMT, "(= a (- 9223372036854775808)) (= b (- 1))") {
+		t.Errorf("Expected MIN / -1 overflow check, got: %s", obligations[1].SMT)
+	}
+	if obligations[2].Kind != "overflow" || !strings.Contains(obligations[2].SMT, "(not (not (= a (- 9223372036854775808))))") {
+		t.Errorf("Expected negation overflow check, got: %s", obligations[2].SMT)
+	}
+}
+
+func TestTranslateSafetyChecksInQuantifier(t *testing.T) {
+	i := &ir.VarRef{Name: "i", Type: checker.TypeInt}
+	n := &ir.VarRef{Name: "n", Type: checker.TypeInt}
+	fn := &ir.Function{
+		Name:       "f",
+		Params:     []*ir.Param{{Name: "n", Type: checker.TypeInt}},
+		ReturnType: checker.TypeBool,
+		Requires: []*ir.Contract{{
+			Expr: &ir.ForallExpr{
+				Variable: "i",
+				Domain:   &ir.RangeExpr{Start: &ir.IntLit{Value: 0, Type: checker.TypeInt}, End: n},
+				Body: &ir.BinaryExpr{
+					Left:  &ir.BinaryExpr{Left: i, Op: lexer.STAR, Right: i, Type: checker.TypeInt},
+					Op:    lexer.GEQ,
+					Right: &ir.IntLit{Value: 0, Type: checker.TypeInt},
+					Type:  checker.TypeBool,
+				},
+				Type: checker.TypeBool,
+			},
+			RawText: "forall i in 0..n: i * i >= 0",
+		}},
+	}
+
+	obligations := TranslateSafetyChecks(fn, nil)
+	if len(obligations) != 1 {
+		t.Fatalf("Expected 1 obligation, got %d", len(obligations))
+	}
+	want := "(assert (exists ((i Int)) (and (>= i 0) (< i n) (not (and (<= (- 9223372036854775808) (* i i)) (<= (* i i) 9223372036854775807))))))"
+	if !strings.Contains(obligations[0].SMT, want) {
+		t.Errorf("Expected violation closed over the bound variable, got: %s", obligations[0].SMT)
+	}
+}
+
+func TestVerifyReportsArithResults(t *testing.T) {
+	// A stand-in solver that refutes every query
+	dir := t.TempDir()
+	fake := filepath.Join(dir, "z3")
+	script := "#!/bin/sh\ncat >/dev/null\necho sat\necho '((define-fun a () Int 9223372036854775807))'\n"
+	if err := os.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &ir.VarRef{Name: "a", Type: checker.TypeInt}
+	fn := &ir.Function{
+		Name:       "next",
+		Params:     []*ir.Param{{Name: "a", Type: checker.TypeInt}},
+		ReturnType: checker.TypeInt,
+		Body: []ir.Stmt{&ir.ReturnStmt{Value: &ir.BinaryExpr{
+			Left: a, Op: lexer.PLUS, Right: &ir.IntLit{Value: 1, Type: checker.TypeInt}, Type: checker.TypeInt, Line: 5, Column: 14,
+		}}},
+	}
+
+	results := verifyFunctionWithZ3(fn, &solverContext{solver: NewZ3(fake)})
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+	r := results[0]
+	if r.QualifiedName() != "next.overflow" || r.ContractText != "a + 1" || r.Line != 5 || r.Column != 14 {
+		t.Errorf("Unexpected result %s: %s at %d:%d", r.QualifiedName(), r.ContractText, r.Line, r.Column)
+	}
+	if r.Status != "unverified" || r.FormatCounterexample() != "a = 9223372036854775807" {
+		t.Errorf("Expected overflow counterexample, got %s (%s)", r.Status, r.Message)
+	}
+}
+
+// arraysSource quantifies over an array parameter, and writes, pushes to
+// and reads a local copy of one.
+const arraysSource = `module test version "1.0";
+
+function all_positive(xs: Array<Int>) returns Bool
+    requires forall i in 0..len(xs): xs[i] >= 0
+{
+    return true;
+}
+
+function reset(xs: Array<Int>) returns Int {
+    let mutable ys: Array<Int> = xs;
+    for i in 0..len(ys) {
+        ys[i] = 0;
+    }
+    ys.push(1);
+    return ys[len(ys) - 1];
+}
+`
+
+func TestTranslateArrayContract(t *testing.T) {
+	fn := lowerSource(t, arraysSource).Functions[0]
+
+	smtLib := TranslateContract(fn, fn.Requires[0], false)
+
+	for _, want := range []string{
+		"(declare-const xs (Array Int Int))",
+		"(declare-const xs@len Int)",
+		"(assert (>= xs@len 0))",
+		"(forall ((i Int)) (=> (and (>= i 0) (< i xs@len)) (>= (select xs i) 0)))",
+	} {
+		if !strings.Contains(smtLib, want) {
+			t.Errorf("Expected %q, got: %s", want, smtLib)
+		}
+	}
+}
+
+func TestTranslateSafetyChecksBounds(t *testing.T) {
+	fn := lowerSource(t, arraysSource).Functions[1]
+
+	var bounds []*SafetyObligation
+	for _, ob := range TranslateSafetyChecks(fn, nil) {
+		if ob.Kind == "bounds" {
+			bounds = append(bounds, ob)
+		}
+	}
+	if len(bounds) != 2 {
+		t.Fatalf("Expected 2 bounds obligations, got %d", len(bounds))
+	}
+	if bounds[0].Line != 12 || !strings.Contains(bounds[0].SMT, "(<= 0 i@2) (< i@2 xs@len)") {
+		t.Errorf("Expected loop index bounded by the range, got: %s", bounds[0].SMT)
+	}
+	if ir.FormatExpr(bounds[1].Expr) != "ys[len(ys) - 1]" {
+		t.Errorf("Unexpected bounds expression %q", ir.FormatExpr(bounds[1].Expr))
+	}
+	for _, want := range []string{
+		"(declare-const ys@4 (Array Int Int))",
+		"(= ys@4 (store ys@1 ys@1@len 1)) (= ys@4@len (+ ys@1@len 1))",
+		"(not (and (<= 0 (- ys@4@len 1)) (< (- ys@4@len 1) ys@4@len)))",
+	} {
+		if !strings.Contains(bounds[1].SMT, want) {
+			t.Errorf("Expected %q after push, got: %s", want, bounds[1].SMT)
+		}
+	}
+}
+
+// jobSource has an enum with a data variant, held in an entity field.
+const jobSource = `module test version "1.0";
+
+enum JobStatus {
+    Pending,
+    Running(worker_id: Int),
+}
+
+entity Job {
+    field status: JobStatus;
+
+    constructor() {
+        self.status = Pending;
+    }
+
+    method assign(worker_id: Int) returns Void
+        ensures match self.status { Running(w) => w == worker_id, _ => false }
+    {
+        self.status = Running(worker_id);
+    }
+}
+`
+
+func TestTranslateDatatypes(t *testing.T) {
+	mod := lowerSource(t, jobSource)
+	mod.Enums = append(mod.Enums, &ir.Enum{Name: "Empty"})
+
+	smtLib := TranslateDatatypes(mod, nil)
+
+	for _, want := range []string{
+		"(declare-datatypes ((Option 1)) ((par (T) ((None) (Some (Some.value T))))))",
+		"(declare-datatypes ((Result 2)) ((par (T E) ((Ok (Ok.value T)) (Err (Err.error E))))))",
+		"(declare-datatypes ((JobStatus 0)) (((JobStatus.Pending) (JobStatus.Running (JobStatus.Running.worker_id Int)))))",
+	} {
+		if !strings.Contains(smtLib, want) {
+			t.Errorf("Expected %q, got: %s", want, smtLib)
+		}
+	}
+	if strings.Contains(smtLib, "Empty") {
+		t.Errorf("Expected enum without variants to be skipped, got: %s", smtLib)
+	}
+}
+
+const sharedVariantSource = `module test version "1.0.0";
+
+enum Light {
+    Off,
+    On,
+}
+
+enum Door {
+    Open,
+    Off,
+}
+
+enum Maybe {
+    None,
+    Some(value: Int),
+}
+
+function dark(l: Light) returns Int
+    ensures result >= 0
+{
+    return match l {
+        Off => 1,
+        On => 0,
+    };
+}
+
+entry function main() returns Int {
+    return 0;
+}`
+
+func TestTranslateDatatypesSharedVariants(t *testing.T) {
+	mod := lowerSource(t, sharedVariantSource)
+	other := &ir.Module{Name: "other", Enums: []*ir.Enum{{Name: "Light", Variants: []*ir.EnumVariant{{Name: "Off"}}}}}
+
+	smtLib := TranslateDatatypes(mod, &ir.Program{Modules: []*ir.Module{mod, other}})
+
+	for _, want := range []string{
+		"((Light 0) (Door 0) (Maybe 0) (other.Light 0))",
+		"((Light.Off) (Light.On))",
+		"((Door.Open) (Door.Off))",
+		"((Maybe.None) (Maybe.Some (Maybe.Some.value Int)))",
+		"((other.Light.Off))",
+	} {
+		if !strings.Contains(smtLib, want) {
+			t.Errorf("Expected %q, got: %s", want, smtLib)
+		}
+	}
+
+	fn := mod.Functions[0]
+	query := TranslateContract(fn, fn.Ensures[0], true)
+	if !strings.Contains(query, "((_ is Light.Off) l)") {
+		t.Errorf("Expected the match to test the qualified constructor, got: %s", query)
+	}
+}
+
+func TestTranslateOptionConstructor(t *testing.T) {
+	optType := &checker.Type{Name: "Option", IsEnum: true, IsGeneric: true, TypeParams: []*checker.Type{checker.TypeInt},
+		EnumInfo: &checker.EnumInfo{Name: "Option", Variants: []*checker.EnumVariantInfo{
+			{Name: "Some", Fields: []checker.ParamInfo{{Name: "value", Type: checker.TypeInt}}},
+			{Name: "None"},
+		}}}
+	fn := &ir.Function{
+		Name:       "find",
+		Params:     []*ir.Param{{Name: "x", Type: checker.TypeInt}},
+		ReturnType: optType,
+		Body: []ir.Stmt{&ir.IfStmt{
+			Condition: &ir.BinaryExpr{Left: &ir.VarRef{Name: "x", Type: checker.TypeInt}, Op: lexer.GT, Right: &ir.IntLit{Value: 0, Type: checker.TypeInt}, Type: checker.TypeBool},
+			Then:      []ir.Stmt{&ir.ReturnStmt{Value: &ir.CallExpr{Function: "Some", Args: []ir.Expr{&ir.VarRef{Name: "x", Type: checker.TypeInt}}, Kind: ir.CallVariant, Type: optType}}},
+			Else:      []ir.Stmt{&ir.ReturnStmt{Value: &ir.CallExpr{Function: "None", Kind: ir.CallVariant, Type: optType}}},
+		}},
+	}
+	contract := &ir.Contract{
+		Expr:    &ir.BinaryExpr{Left: &ir.VarRef{Name: "x", Type: checker.TypeInt}, Op: lexer.GEQ, Right: &ir.IntLit{Value: 0, Type: checker.TypeInt}, Type: checker.TypeBool},
+		RawText: "x >= 0",
+	}
+
+	smtLib := TranslateContract(fn, contract, true)
+
+	for _, want := range []string{
+		"(declare-const result (Option Int))",
+		"(= result ((as Some (Option Int)) x))",
+		"(= result (as None (Option Int)))",
+	} {
+		if !strings.Contains(smtLib, want) {
+			t.Errorf("Expected %q, got: %s", want, smtLib)
+		}
+	}
+}
+
+func TestTranslateMethodEnsuresWithEnumBody(t *testing.T) {
+	ent := lowerSource(t, jobSource).Entities[0]
+	m := ent.Methods[0]
+
+	smtLib := TranslateMethodContractWithBody("Job", "assign", ent.Fields, m.Params, m.ReturnType,
+		nil, nil, m.Ensures[0], nil, m.Body, true, nil)
+
+	for _, want := range []string{
+		"(declare-const self_status JobStatus)",
+		"(ite ((_ is JobStatus.Running) (JobStatus.Running worker_id)) (= (JobStatus.Running.worker_id (JobStatus.Running worker_id)) worker_id) false)",
+	} {
+		if !strings.Contains(smtLib, want) {
+			t.Errorf("Expected %q, got: %s", want, smtLib)
+		}
+	}
+}
+
+func TestSolverPrependsDatatypes(t *testing.T) {
+	solver := &ScriptedSolver{Respond: func(string) string { return "unsat" }}
+	sc := &solverContext{solver: solver, datatypes: TranslateDatatypes(lowerSource(t, jobSource), nil)}
+	result := sc.run("(check-sat)\n", true)
+	if result.Status != "verified" || len(solver.Queries) != 1 {
+		t.Fatalf("Expected one verified query, got %s (%s)", result.Status, result.Message)
+	}
+
+	got := solver.Queries[0]
+	if !strings.HasPrefix(got, "(set-option :produce-models true)\n(define-sort Float () Real)") {
+		t.Errorf("Expected the float model after the options, got: %s", got)
+	}
+	if strings.Index(got, "(declare-datatypes ((Option 1))") < strings.Index(got, "(define-sort Float") ||
+		strings.Index(got, "(declare-datatypes ((JobStatus 0))") > strings.Index(got, "(check-sat)") {
+		t.Errorf("Expected datatypes declared between the float model and the query, got: %s", got)
+	}
+	if result.FloatModel != "" {
+		t.Errorf("Expected no float model for a query without Float, got %q", result.FloatModel)
+	}
+}
+
+func TestTranslateFloatContract(t *testing.T) {
+	x := &ir.VarRef{Name: "x", Type: checker.TypeFloat}
+	fn := &ir.Function{
+		Name:       "half",
+		Params:     []*ir.Param{{Name: "x", Type: checker.TypeFloat}},
+		ReturnType: checker.TypeFloat,
+		Body: []ir.Stmt{&ir.ReturnStmt{Value: &ir.BinaryExpr{
+			Left: x, Op: lexer.SLASH, Right: &ir.FloatLit{Value: "2.0", Type: checker.TypeFloat}, Type: checker.TypeFloat,
+		}}},
+	}
+	contract := &ir.Contract{
+		Expr:    &ir.BinaryExpr{Left: &ir.ResultRef{Type: checker.TypeFloat}, Op: lexer.GT, Right: &ir.UnaryExpr{Op: lexer.MINUS, Operand: x, Type: checker.TypeFloat}, Type: checker.TypeBool},
+		RawText: "result > -x",
+	}
+
+	smtLib := TranslateContract(fn, contract, true)
+
+	for _, want := range []string{
+		"(declare-const x Float)",
+		"(declare-const result Float)",
+		"(= result (float.div x (float.lit 2.0)))",
+		"(assert (not (float.lt (float.neg x) result)))",
+	} {
+		if !strings.Contains(smtLib, want) {
+			t.Errorf("Expected %q, got: %s", want, smtLib)
+		}
+	}
+}
+
+func TestParseFloatModel(t *testing.T) {
+	for _, s := range []string{"real", "ieee"} {
+		if m, err := ParseFloatModel(s); err != nil || string(m) != s {
+			t.Errorf("ParseFloatModel(%q) = %q, %v", s, m, err)
+		}
+	}
+	if _, err := ParseFloatModel("f32"); err == nil {
+		t.Error("Expected an error for an unknown float model")
+	}
+}
+
+func TestParseModelIEEEValues(t *testing.T) {
+	output := `(
+  (define-fun x () (_ FloatingPoint 11 53)
+    (fp #b0 #b01111111111 #x8000000000000))
+  (define-fun y () (_ FloatingPoint 11 53)
+    (fp #b1 #b10000000000 #x0000000000000))
+  (define-fun n () (_ FloatingPoint 11 53)
+    (_ NaN 11 53))
+  (define-fun z () (_ FloatingPoint 11 53)
+    (_ -zero 11 53))
+)`
+
+	model := parseModel(output)
+
+	want := map[string]string{"x": "1.5", "y": "-2.0", "n": "NaN", "z": "-0.0"}
+	for name, val := range want {
+		if model[name] != val {
+			t.Errorf("model[%q] = %q, want %q", name, model[name], val)
+		}
+	}
+}
+
+func TestSolverUsesFloatModel(t *testing.T) {
+	solver := &ScriptedSolver{Respond: func(string) string { return "unsat" }}
+	fn := &ir.Function{
+		Name:     "pos",
+		Params:   []*ir.Param{{Name: "x", Type: checker.TypeFloat}},
+		Requires: []*ir.Contract{{Expr: &ir.BinaryExpr{Left: &ir.VarRef{Name: "x", Type: checker.TypeFloat}, Op: lexer.GT, Right: &ir.FloatLit{Value: "0.0", Type: checker.TypeFloat}, Type: checker.TypeBool}, RawText: "x > 0.0"}},
+	}
+
+	results := verifyFunctionWithZ3(fn, &solverContext{solver: solver, floats: FloatIEEE})
+	if len(results) != 1 || results[0].FloatModel != FloatIEEE {
+		t.Fatalf("Expected one result using the ieee model, got %+v", results)
+	}
+
+	data := solver.Queries[0]
+	for _, want := range []string{
+		"(define-sort Float () (_ FloatingPoint 11 53))",
+		"(define-fun float.lt ((a Float) (b Float)) Bool (fp.lt a b))",
+		"(assert (float.lt (float.lit 0.0) x))",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %q in query, got: %s", want, data)
+		}
+	}
+}
+
+func TestRunAllKeepsTaskOrder(t *testing.T) {
+	sc := &solverContext{jobs: 3}
+	var running, peak atomic.Int32
+	var tasks []verifyTask
+	for i := range 10 {
+		tasks = append(tasks, func() *VerifyResult {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Duration(10-i) * time.Millisecond)
+			running.Add(-1)
+			return &VerifyResult{FunctionName: string(rune('a' + i))}
+		})
+	}
+
+	results := sc.runAll(tasks)
+
+	var names strings.Builder
+	for _, r := range results {
+		names.WriteString(r.FunctionName)
+	}
+	if names.String() != "abcdefghij" {
+		t.Errorf("Expected results in task order, got %q", names.String())
+	}
+	if peak.Load() > 3 {
+		t.Errorf("Expected at most 3 tasks at once, got %d", peak.Load())
+	}
+}
+
+func TestRunZ3Timeout(t *testing.T) {
+	dir := t.TempDir()
+	fake := filepath.Join(dir, "z3")
+	if err := os.WriteFile(fake, []byte("#!/bin/sh\nexec sleep 5\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runSolver(NewZ3(fake), "(check-sat)\n", true, 50*time.Millisecond)
+
+	if result.Status != "timeout" || result.Message != "z3 timed out after 50ms" {
+		t.Errorf("Expected a timeout after 50ms, got %s (%s)", result.Status, result.Message)
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	// A stand-in solver that refutes every query and logs each run
+	dir := t.TempDir()
+	fake := filepath.Join(dir, "z3")
+	runs := filepath.Join(dir, "runs")
+	script := "#!/bin/sh\nif [ \"$1\" = --version ]; then echo 'Z3 version 4.13.0'; exit 0; fi\n" +
+		"cat >/dev/null\necho run >>" + runs + "\necho sat\necho '((define-fun x () Int 3))'\n"
+	if err := os.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cacheDir := filepath.Join(dir, "cache")
+	countRuns := func() int {
+		data, _ := os.ReadFile(runs)
+		return strings.Count(string(data), "run")
+	}
+
+	sc := &solverContext{solver: NewZ3(fake), cache: openCache(cacheDir, NewZ3(fake))}
+	if sc.cache == nil {
+		t.Fatal("Expected the cache to open")
+	}
+	first := sc.run("(assert (> x 2))\n(check-sat)\n", true)
+	second := sc.run("(assert (> x 2))\n(check-sat)\n", true)
+	if countRuns() != 1 {
+		t.Fatalf("Expected the solver to run once, ran %d times", countRuns())
+	}
+	if first.Cached || !second.Cached {
+		t.Errorf("Expected only the second answer from the cache, got %v and %v", first.Cached, second.Cached)
+	}
+	if second.Status != "unverified" || second.model["x"] != "3" {
+		t.Errorf("Expected the cached answer to keep its model, got %s %v", second.Status, second.model)
+	}
+
+	// The same query as a requires, or a changed query, is proved again
+	sc.run("(assert (> x 2))\n(check-sat)\n", false)
+	sc.run("(assert (> x 1))\n(check-sat)\n", true)
+	if countRuns() != 3 {
+		t.Errorf("Expected cache misses for different queries, solver ran %d times", countRuns())
+	}
+
+	// A different solver version misses too
+	input := floatPreamble("") + "(assert (> x 2))\n(check-sat)\n"
+	if _, ok := (&queryCache{dir: cacheDir, version: "z3 4.13.0"}).load(input, true); !ok {
+		t.Error("Expected a cache hit for the same solver version")
+	}
+	if _, ok := (&queryCache{dir: cacheDir, version: "z3 4.14.0"}).load(input, true); ok {
+		t.Error("Expected a cache miss for another solver version")
+	}
+}
+
+func TestNewSolver(t *testing.T) {
+	dir := t.TempDir()
+	for name, banner := range map[string]string{
+		"z3":    "Z3 version 4.13.0 - 64 bit",
+		"cvc5":  "This is cvc5 version 1.1.2 [git tag 1.1.2 branch HEAD]",
+		"yices": "Yices 2.6.4",
+	} {
+		script := "#!/bin/sh\nif [ \"$1\" = --version ]; then echo '" + banner + "'; exit 0; fi\necho \"$@\" >" + filepath.Join(dir, name+".args") + "\necho unsat\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+
+	for _, tc := range []struct{ spec, name, version, args string }{
+		{"", "z3", "4.13.0", "-in -T:2"},
+		{"cvc5", "cvc5", "1.1.2", "--lang=smt2 --tlimit-per=1500"},
+		{filepath.Join(dir, "yices"), "yices", "2.6.4", ""},
+	} {
+		s, err := NewSolver(tc.spec)
+		if err != nil {
+			t.Fatalf("NewSolver(%q): %v", tc.spec, err)
+		}
+		if s.Name() != tc.name || s.Version() != tc.version {
+			t.Errorf("NewSolver(%q) = %s %s, want %s %s", tc.spec, s.Name(), s.Version(), tc.name, tc.version)
+		}
+		out, err := s.Check("(check-sat)\n", 1500*time.Millisecond)
+		if err != nil || strings.TrimSpace(out) != "unsat" {
+			t.Errorf("%s: Check = %q, %v", tc.name, out, err)
+		}
+		args, _ := os.ReadFile(filepath.Join(dir, tc.name+".args"))
+		if strings.TrimSpace(string(args)) != tc.args {
+			t.Errorf("%s: ran with %q, want %q", tc.name, strings.TrimSpace(string(args)), tc.args)
+		}
+	}
+
+	if _, err := NewSolver("mathsat"); err == nil || err.Error() != "mathsat not found on PATH" {
+		t.Errorf("Expected a missing solver error, got %v", err)
+	}
+}
+
+func TestVerifyWithScriptedSolver(t *testing.T) {
+	// Refute ensures, accept everything else
+	solver := &ScriptedSolver{Respond: func(query string) string {
+		if strings.Contains(query, "; Ensures") {
+			return "sat\n((define-fun x () Int (- 1)))"
+		}
+		return "sat"
+	}}
+	x := &ir.VarRef{Name: "x", Type: checker.TypeInt}
+	mod := &ir.Module{Functions: []*ir.Function{{
+		Name:       "id",
+		Params:     []*ir.Param{{Name: "x", Type: checker.TypeInt}},
+		ReturnType: checker.TypeInt,
+		Requires:   []*ir.Contract{{Expr: &ir.BoolLit{Value: true, Type: checker.TypeBool}, RawText: "true"}},
+		Ensures: []*ir.Contract{{
+			Expr:    &ir.BinaryExpr{Left: &ir.ResultRef{Type: checker.TypeInt}, Op: lexer.GEQ, Right: &ir.IntLit{Value: 0, Type: checker.TypeInt}, Type: checker.TypeBool},
+			RawText: "result >= 0",
+			Line:    3,
+			Column:  5,
+		}},
+		Body: []ir.Stmt{&ir.ReturnStmt{Value: x}},
+	}}, Path: "src/id.intent"}
+
+	results := VerifyInProgramWith(mod, nil, Options{Solver: solver})
+
+	if len(results) != 2 || len(solver.Queries) != 2 {
+		t.Fatalf("Expected 2 results from 2 queries, got %d from %d", len(results), len(solver.Queries))
+	}
+	if results[0].Status != "verified" || results[1].Status != "unverified" || results[1].FormatCounterexample() != "x = -1" {
+		t.Errorf("Unexpected results: %s, %s (%s)", results[0].Status, results[1].Status, results[1].Message)
+	}
+	for _, r := range results {
+		if r.Solver != "scripted" || r.SolverVersion != "1" {
+			t.Errorf("%s: expected the scripted solver recorded, got %q %q", r.QualifiedName(), r.Solver, r.SolverVersion)
+		}
+	}
+	if r := results[1]; r.File != "src/id.intent" || r.Line != 3 || r.Column != 5 {
+		t.Errorf("Expected the ensures located at src/id.intent:3:5, got %s:%d:%d", r.File, r.Line, r.Column)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	reports := []*IntentReport{{
+		Description: "abs is non-negative",
+		Refs:        []*RefStatus{{Ref: "abs.ensures", Status: "unverified", Message: "counterexample found"}},
+	}}
+	results := []*VerifyResult{
+		{FunctionName: "abs", ContractKind: "requires", ContractText: "true", File: "abs.intent", Line: 2, Column: 5, Status: "verified", Solver: "z3", SolverVersion: "4.13.0", Cached: true},
+		{FunctionName: "abs", ContractKind: "ensures", ContractText: "result >= 0", File: "abs.intent", Line: 3, Column: 5, EndLine: 3, EndColumn: 24, Status: "unverified",
+			Message: "counterexample found: fails when x = -1", Counterexample: []ModelValue{{Name: "x", Value: "-1"}}},
+		{FunctionName: "slow", ContractKind: "ensures", ContractText: "result > 0", File: "abs.intent", Line: 9, Column: 5, Status: "timeout", Message: "z3 timed out after 5s"},
+		{Status: "error", Message: "z3 not found on PATH"},
+	}
+
+	out, err := FormatJSON(results, reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Results []struct {
+			Name           string
+			Kind           string
+			Contract       string
+			Status         string
+			File           string
+			Line, Column   int
+			EndLine        int `json:"end_line"`
+			EndColumn      int `json:"end_column"`
+			Counterexample []ModelValue
+			Cached         bool
+		}
+		Intents []struct {
+			Description string
+			Verified    bool
+			Refs        []RefStatus
+		}
+		Summary map[string]int
+	}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, out)
+	}
+	if len(doc.Results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(doc.Results))
+	}
+	r := doc.Results[1]
+	if r.Name != "abs.ensures" || r.Contract != "result >= 0" || r.Status != "unverified" || r.File != "abs.intent" || r.Line != 3 || r.Column != 5 ||
+		r.EndLine != 3 || r.EndColumn != 24 {
+		t.Errorf("Unexpected result: %+v", r)
+	}
+	if len(r.Counterexample) != 1 || r.Counterexample[0] != (ModelValue{Name: "x", Value: "-1"}) {
+		t.Errorf("Expected counterexample x = -1, got %+v", r.Counterexample)
+	}
+	if !strings.Contains(string(out), `"result >= 0"`) {
+		t.Errorf("Expected contract text left unescaped, got:\n%s", out)
+	}
+	if len(doc.Intents) != 1 || doc.Intents[0].Verified || doc.Intents[0].Refs[0].Ref != "abs.ensures" {
+		t.Errorf("Unexpected intents: %+v", doc.Intents)
+	}
+	want := map[string]int{"verified": 1, "unverified": 1, "timeouts": 1, "errors": 1, "cached": 1}
+	for k, v := range want {
+		if doc.Summary[k] != v {
+			t.Errorf("Expected summary %s = %d, got %d", k, v, doc.Summary[k])
+		}
+	}
+}
+
+func TestFormatSARIF(t *testing.T) {
+	results := []*VerifyResult{
+		{FunctionName: "abs", ContractKind: "requires", ContractText: "true", File: "abs.intent", Line: 2, Column: 5, Status: "verified", Solver: "z3", SolverVersion: "4.13.0", Cached: true},
+		{FunctionName: "abs", ContractKind: "ensures", ContractText: "result >= 0", File: "abs.intent", Line: 3, Column: 5, EndLine: 3, EndColumn: 24, Status: "unverified",
+			Message: "counterexample found: fails when x = -1", Counterexample: []ModelValue{{Name: "x", Value: "-1"}}},
+		{FunctionName: "slow", ContractKind: "ensures", ContractText: "result > 0", File: "abs.intent", Line: 9, Column: 5, Status: "timeout", Message: "z3 timed out after 5s"},
+		{Status: "error", Message: "z3 not found on PATH"},
+	}
+
+	out, err := FormatSARIF(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var log struct {
+		Version string
+		Runs    []struct {
+			Invocations []struct {
+				ExecutionSuccessful        bool
+				ToolExecutionNotifications []struct{ Message struct{ Text string } }
+			}
+			Results []struct {
+				RuleID    string
+				Level     string
+				Message   struct{ Text string }
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct{ StartLine, StartColumn, EndLine, EndColumn int }
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(out, &log); err != nil {
+		t.Fatalf("Invalid SARIF: %v\n%s", err, out)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("Expected one SARIF 2.1.0 run, got:\n%s", out)
+	}
+	run := log.Runs[0]
+
+	// Only the unverified and timed out contracts are findings
+	if len(run.Results) != 2 {
+		t.Fatalf("Expected 2 results, got %d:\n%s", len(run.Results), out)
+	}
+	r := run.Results[0]
+	if r.RuleID != "ensures" || r.Level != "error" || !strings.Contains(r.Message.Text, "x = -1") {
+		t.Errorf("Unexpected result: %+v", r)
+	}
+	loc := r.Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "abs.intent" || loc.Region.StartLine != 3 || loc.Region.StartColumn != 5 ||
+		loc.Region.EndLine != 3 || loc.Region.EndColumn != 24 {
+		t.Errorf("Expected abs.intent:3:5-3:24, got %+v", loc)
+	}
+	if run.Results[1].Level != "warning" {
+		t.Errorf("Expected a timeout to be a warning, got %s", run.Results[1].Level)
+	}
+
+	// Solver errors are notifications, not findings
+	inv := run.Invocations[0]
+	if inv.ExecutionSuccessful || len(inv.ToolExecutionNotifications) != 1 || inv.ToolExecutionNotifications[0].Message.Text != "z3 not found on PATH" {
+		t.Errorf("Expected the solver error as a notification, got %+v", inv)
+	}
+}
+
+func TestFormatSARIFLocatesCallSites(t *testing.T) {
+	solver := &ScriptedSolver{Respond: func(query string) string {
+		if strings.Contains(query, "; Call-site precondition in method: Counter.skip") ||
+			strings.Contains(query, "; Requires (checking satisfiability)") {
+			return "sat"
+		}
+		return "unsat"
+	}}
+	mod := lowerSource(t, callsSource)
+	mod.Path = "calls.intent"
+
+	out, err := FormatSARIF(VerifyInProgramWith(mod, nil, Options{Solver: solver}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log struct {
+		Runs []struct {
+			Results []struct {
+				RuleID    string
+				Locations []struct {
+					PhysicalLocation struct {
+						Region struct{ StartLine, StartColumn, EndLine, EndColumn int }
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(out, &log); err != nil {
+		t.Fatalf("Invalid SARIF: %v\n%s", err, out)
+	}
+	results := log.Runs[0].Results
+	if len(results) != 1 || results[0].RuleID != "call_requires" || len(results[0].Locations) != 1 {
+		t.Fatalf("Expected one located call_requires finding, got:\n%s", out)
+	}
+	// inc(self.n - k) spans columns 16 to 31 of line 28
+	region := results[0].Locations[0].PhysicalLocation.Region
+	if region.StartLine != 28 || region.StartColumn != 16 || region.EndLine != 28 || region.EndColumn != 31 {
+		t.Errorf("Expected the call at 28:16-28:31, got %+v", region)
+	}
+}
+
+// traitSource has an entity that weakens a trait method's requires and
+// strengthens its ensures.
+const traitSource = `module test version "1.0";
+
+trait Counter {
+    method step(n: Int) returns Int
+        requires n >= 0
+        ensures result >= n;
+}
+
+entity Up implements Counter {
+    method step(n: Int) returns Int
+        requires n + 1 > 0
+        ensures result == n + 1
+    {
+        return n + 1;
+    }
+}
+`
+
+func TestTranslateSubtypeContracts(t *testing.T) {
+	mod := lowerSource(t, traitSource)
+	ent := mod.Entities[0]
+	want, impl := mod.Traits[0].Methods[0], ent.Methods[0]
+
+	req := TranslateSubtypeRequires(ent, "Counter", want, impl)
+	for _, s := range []string{
+		"; Subtype requires for: Up.step implementing Counter.step",
+		"; Trait requires (assumptions)\n(assert (>= n 0))",
+		"(assert (not (> (+ n 1) 0)))",
+	} {
+		if !strings.Contains(req, s) {
+			t.Errorf("Expected %q in:\n%s", s, req)
+		}
+	}
+
+	ens := TranslateSubtypeEnsures(ent, "Counter", want, impl, want.Ensures[0])
+	for _, s := range []string{
+		"(declare-const result Int)",
+		"; Implementation ensures (assumptions)\n(assert (= result (+ n 1)))",
+		"(assert (not (>= result n)))",
+	} {
+		if !strings.Contains(ens, s) {
+			t.Errorf("Expected %q in:\n%s", s, ens)
+		}
+	}
+}
+
+func TestVerifySubtypeContracts(t *testing.T) {
+	mod := lowerSource(t, traitSource)
+	// Refute the trait's ensures, prove everything else
+	solver := &ScriptedSolver{Respond: func(query string) string {
+		if strings.Contains(query, "; Subtype ensures") {
+			return "sat\n((define-fun n () Int 0) (define-fun result () Int (- 1)))"
+		}
+		return "unsat"
+	}}
+
+	byName := make(map[string]*VerifyResult)
+	for _, r := range VerifyInProgramWith(mod, nil, Options{Solver: solver}) {
+		byName[r.QualifiedName()] = r
+	}
+
+	r := byName["Up.step.subtype_requires"]
+	if r == nil || r.Status != "verified" || r.ContractText != "Counter.step: n + 1 > 0" || r.Line != 11 {
+		t.Errorf("Unexpected subtype_requires result: %+v", r)
+	}
+	r = byName["Up.step.subtype_ensures"]
+	if r == nil || r.Status != "unverified" || r.ContractText != "Counter.step: result >= n" {
+		t.Fatalf("Unexpected subtype_ensures result: %+v", r)
+	}
+	if r.Line != 12 || r.Column != 9 {
+		t.Errorf("Expected the failure located at the implementation's ensures, got %d:%d", r.Line, r.Column)
+	}
+	if got := r.FormatCounterexample(); got != "n = 0, result = -1" {
+		t.Errorf("Unexpected counterexample %q", got)
+	}
+}
+
+// strictTraitSource has an entity that strengthens a trait method's
+// requires and weakens its ensures. It type checks; only the subtype
+// obligations reject it.
+const strictTraitSource = `module test version "1.0";
+
+trait Gauge {
+    method read(f: Int) returns Int
+        requires f > 0
+        ensures result > 0;
+}
+
+entity Strict implements Gauge {
+    method read(f: Int) returns Int
+        requires f > 10
+        ensures result >= 0
+    {
+        return f - 10;
+    }
+}
+
+entry function main() returns Int { return 0; }
+`
+
+func TestVerifySubtypeContractsRejected(t *testing.T) {
+	mod := lowerSource(t, strictTraitSource)
+	solver := &ScriptedSolver{Respond: func(query string) string {
+		switch {
+		case strings.Contains(query, "; Subtype requires") &&
+			strings.Contains(query, "(assert (> f 0))") &&
+			strings.Contains(query, "(assert (not (> f 10)))"):
+			return "sat\n((define-fun f () Int 1))"
+		case strings.Contains(query, "; Subtype ensures") &&
+			strings.Contains(query, "(assert (>= result 0))") &&
+			strings.Contains(query, "(assert (not (> result 0)))"):
+			return "sat\n((define-fun f () Int 10) (define-fun result () Int 0))"
+		case strings.Contains(query, "; Requires (checking satisfiability)"):
+			return "sat"
+		}
+		return "unsat"
+	}}
+
+	byName := make(map[string]*VerifyResult)
+	for _, r := range VerifyInProgramWith(mod, nil, Options{Solver: solver}) {
+		byName[r.QualifiedName()] = r
+	}
+	for name, want := range map[string]string{
+		"Strict.read.subtype_requires": "f = 1",
+		"Strict.read.subtype_ensures":  "f = 10, result = 0",
+	} {
+		r := byName[name]
+		if r == nil || r.Status != "unverified" {
+			t.Errorf("Expected %s unverified, got %+v", name, r)
+			continue
+		}
+		if got := r.FormatCounterexample(); got != want {
+			t.Errorf("%s: expected counterexample %q, got %q", name, want, got)
+		}
+	}
+}
+
+// mapsSource quantifies over a map and updates one.
+const mapsSource = `module test version "1.0";
+
+function all_present(m: Map<String, Int>) returns Bool
+    requires (forall k in m: m.contains(k)) and (exists k in m: len(m) > 0)
+{
+    return true;
+}
+
+function churn(base: Map<String, Int>, k: String) returns Bool
+    ensures not result
+{
+    let mutable m: Map<String, Int> = base;
+    m.set(k, 1);
+    m.remove(k);
+    return m.contains(k);
+}
+`
+
+func TestTranslateMapContract(t *testing.T) {
+	fn := lowerSource(t, mapsSource).Functions[0]
+
+	smtLib := TranslateContract(fn, fn.Requires[0], false)
+
+	for _, want := range []string{
+		"(declare-const m (Array Int Bool))",
+		"(declare-const m@len Int)",
+		"(forall ((k Int)) (=> (select m k) (select m k)))",
+		"(exists ((k Int)) (and (select m k) (> m@len 0)))",
+	} {
+		if !strings.Contains(smtLib, want) {
+			t.Errorf("Expected %q, got: %s", want, smtLib)
+		}
+	}
+}
+
+func TestTranslateMapUpdates(t *testing.T) {
+	fn := lowerSource(t, mapsSource).Functions[1]
+
+	smtLib := TranslateContract(fn, fn.Ensures[0], true)
+
+	for _, want := range []string{
+		"(declare-const m@1 (Array Int Bool))",
+		"(= m@1 (store base k true))",
+		"(= m@1@len (ite (select base k) base@len (+ base@len 1)))",
+		"(= m@2 (store m@1 k false))",
+		"(= m@2@len (ite (select m@1 k) (- m@1@len 1) m@1@len))",
+		"(= result (select m@2 k))",
+	} {
+		if !strings.Contains(smtLib, want) {
+			t.Errorf("Expected %q, got: %s", want, smtLib)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package wasmbe
+
+import (
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// Contract kinds passed to env.contract_violation(kind, msg_ptr, msg_len).
+// The message is the failed clause prefixed like the Rust and JS backends,
+// e.g. "Precondition failed: amount > 0".
+const (
+	violationRequires      = 0
+	violationEnsures       = 1
+	violationInvariant     = 2
+	violationLoopInvariant = 3
+	violationDecreases     = 4
+)
+
+// In debug contract mode every check is wrapped in a test of the mutable
+// global exported as __intent_contracts, which starts at 1. A host switches
+// the checks off by setting it to 0, e.g.
+// instance.exports.__intent_contracts.value = 0.
+const (
+	contractsGlobal = 1
+	contractsExport = "__intent_contracts"
+)
+
+// hasRuntimeChecks reports whether a module has any contract that compiles
+// to a runtime check, and therefore needs env.contract_violation.
+func hasRuntimeChecks(mod *ir.Module) bool {
+	for _, fn := range mod.Functions {
+		if len(fn.Requires) > 0 || len(fn.Ensures) > 0 || stmtsHaveChecks(fn.Body) {
+			return true
+		}
+	}
+	for _, ent := range mod.Entities {
+		if len(ent.Invariants) > 0 {
+			return true
+		}
+		if c := ent.Constructor; c != nil {
+			if len(c.Requires) > 0 || len(c.Ensures) > 0 || stmtsHaveChecks(c.Body) {
+				return true
+			}
+		}
+		for _, m := range ent.Methods {
+			if len(m.Requires) > 0 || len(m.Ensures) > 0 || stmtsHaveChecks(m.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stmtsHaveChecks reports whether any loop in stmts has invariants or a
+// decreases clause.
+func stmtsHaveChecks(stmts []ir.Stmt) bool {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ir.WhileStmt:
+			if len(s.Invariants) > 0 || s.Decreases != nil || stmtsHaveChecks(s.Body) {
+				return true
+			}
+		case *ir.IfStmt:
+			if stmtsHaveChecks(s.Then) || stmtsHaveChecks(s.Else) {
+				return true
+			}
+		case *ir.ForInStmt:
+			if stmtsHaveChecks(s.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compilePrologue captures old() values and checks preconditions.
+func (fc *funcCompiler) compilePrologue() {
+	for _, cap := range fc.oldCaptures {
+		fc.compileOldCapture(cap)
+	}
+	for _, req := range fc.requires {
+		fc.compileCheck(violationRequires, "Precondition failed: ", req)
+	}
+}
+
+// compileOldCapture evaluates an old() expression into a local that OldRef
+// reads back later.
+func (fc *funcCompiler) compileOldCapture(cap *ir.OldCapture) {
+	idx := fc.allocLocal(cap.Name, typeForIR(cap.Expr.ExprType()))
+	fc.compileExpr(cap.Expr)
+	fc.localSet(idx)
+}
+
+// hasPostconditions reports whether returns must run ensures or invariant checks.
+func (fc *funcCompiler) hasPostconditions() bool {
+	return len(fc.ensures) > 0 || len(fc.invariants) > 0
+}
+
+// compilePostconditions checks ensures clauses, then entity invariants.
+// ResultRef reads the local set by emitReturn.
+func (fc *funcCompiler) compilePostconditions() {
+	for _, ens := range fc.ensures {
+		fc.compileCheck(violationEnsures, "Postcondition failed: ", ens)
+	}
+	for _, inv := range fc.invariants {
+		fc.compileCheck(violationInvariant, "Invariant failed: ", inv)
+	}
+}
+
+// emitReturn returns from the function, running the postconditions first.
+// push leaves the return value on the stack; it is nil for void returns.
+func (fc *funcCompiler) emitReturn(push func()) {
+	if fc.isCtor {
+		fc.compilePostconditions()
+		fc.localGet(fc.selfIdx)
+		fc.body = append(fc.body, opReturn)
+		return
+	}
+	if push != nil {
+		push()
+	}
+	if fc.hasPostconditions() {
+		if push != nil && fc.resultIdx >= 0 {
+			fc.localSet(fc.resultIdx)
+		}
+		fc.compilePostconditions()
+		if push != nil && fc.resultIdx >= 0 {
+			fc.localGet(fc.resultIdx)
+		}
+	}
+	fc.body = append(fc.body, opReturn)
+}
+
+// compileCheck evaluates a contract and reports a violation when it is false.
+func (fc *funcCompiler) compileCheck(kind int, prefix string, c *ir.Contract) {
+	guarded := fc.beginGuard(c)
+	fc.compileExpr(c.Expr)
+	fc.body = append(fc.body, opI32Eqz, opIf, blockVoid)
+	fc.blockDepth++
+	fc.compileViolation(kind, prefix+c.RawText)
+	fc.body = append(fc.body, opEnd)
+	fc.blockDepth--
+	fc.endGuard(guarded)
+}
+
+// beginGuard opens a block that only runs while the contracts global is set,
+// in debug contract mode and unless c is marked @always_check. A nil c is a
+// decreases clause, which cannot be marked. It reports whether it opened one.
+func (fc *funcCompiler) beginGuard(c *ir.Contract) bool {
+	if !fc.gen.debugContracts || (c != nil && c.AlwaysCheck) {
+		return false
+	}
+	fc.gen.usesContracts = true
+	fc.body = append(fc.body, opGlobalGet)
+	fc.body = append(fc.body, encodeLEB128U(contractsGlobal)...)
+	fc.body = append(fc.body, opIf, blockVoid)
+	fc.blockDepth++
+	return true
+}
+
+// endGuard closes the block opened by beginGuard.
+func (fc *funcCompiler) endGuard(guarded bool) {
+	if guarded {
+		fc.body = append(fc.body, opEnd)
+		fc.blockDepth--
+	}
+}
+
+// compileViolation calls env.contract_violation with the message, then traps.
+// The trap also covers hosts whose handler returns normally.
+func (fc *funcCompiler) compileViolation(kind int, msg string) {
+	if fc.gen.violation >= 0 {
+		offset, n := fc.gen.addStringData(msg)
+		fc.i32Const(int64(kind))
+		fc.i32Const(int64(offset + 4)) // skip the length header
+		fc.i32Const(int64(n))
+		fc.call(fc.gen.violation)
+	}
+	fc.body = append(fc.body, opUnreachable)
+}
+
+// compileQuantifier evaluates forall/exists over a range, or the keys of a
+// map, with a loop that stops at the first counterexample (forall) or
+// witness (exists).
+func (fc *funcCompiler) compileQuantifier(variable string, domain *ir.RangeExpr, m ir.Expr, body ir.Expr, isForall bool) {
+	if domain == nil && m == nil {
+		// Quantifiers over other domains are verification-only
+		fc.i32Const(1)
+		return
+	}
+
+	result := fc.allocAnon(valI32)
+	saved, shadowed := fc.localMap[variable]
+
+	// forall starts true and looks for a false body; exists the opposite
+	if isForall {
+		fc.i32Const(1)
+	} else {
+		fc.i32Const(0)
+	}
+	fc.localSet(result)
+
+	var exit, bind, step func()
+	if m != nil {
+		keys := fc.allocAnon(valI32)
+		pos := fc.allocAnon(valI32)
+		keyType := typeForIR(m.ExprType().TypeParams[0])
+		iter := fc.allocLocal(variable, keyType)
+		fc.compileExpr(m)
+		fc.call(fc.gen.runtimeFunc(rtMapKeys))
+		fc.localSet(keys)
+		fc.i32Const(0)
+		fc.localSet(pos)
+		exit = func() {
+			fc.localGet(pos)
+			fc.localGet(keys)
+			fc.load(valI32, arrayLenOffset)
+			fc.body = append(fc.body, opI32GeU)
+		}
+		bind = func() {
+			fc.loadElement(keys, pos, keyType)
+			fc.localSet(iter)
+		}
+		step = func() {
+			fc.localGet(pos)
+			fc.i32Const(1)
+			fc.body = append(fc.body, opI32Add)
+			fc.localSet(pos)
+		}
+	} else {
+		end := fc.allocAnon(valI64)
+		iter := fc.allocLocal(variable, valI64)
+		fc.compileExpr(domain.Start)
+		fc.localSet(iter)
+		fc.compileExpr(domain.End)
+		fc.localSet(end)
+		exit = func() {
+			fc.localGet(iter)
+			fc.localGet(end)
+			fc.body = append(fc.body, opI64GeS)
+		}
+		bind = func() {}
+		step = func() {
+			fc.localGet(iter)
+			fc.i64Const(1)
+			fc.body = append(fc.body, opI64Add)
+			fc.localSet(iter)
+		}
+	}
+
+	fc.body = append(fc.body, opBlock, blockVoid, opLoop, blockVoid)
+	fc.blockDepth += 2
+	exit()
+	fc.body = append(fc.body, opBrIf, 1)
+	bind()
+
+	fc.compileExpr(body)
+	if isForall {
+		fc.body = append(fc.body, opI32Eqz)
+	}
+	fc.body = append(fc.body, opIf, blockVoid)
+	if isForall {
+		fc.i32Const(0)
+	} else {
+		fc.i32Const(1)
+	}
+	fc.localSet(result)
+	fc.body = append(fc.body, opBr, 2, opEnd)
+
+	step()
+	fc.body = append(fc.body, opBr, 0, opEnd, opEnd)
+	fc.blockDepth -= 2
+
+	if shadowed {
+		fc.localMap[variable] = saved
+	} else {
+		delete(fc.localMap, variable)
+	}
+	fc.localGet(result)
+}
+
+// compileLoopInvariants checks a while loop's invariants.
+func (fc *funcCompiler) compileLoopInvariants(s *ir.WhileStmt, when string) {
+	for _, inv := range s.Invariants {
+		fc.compileCheck(violationLoopInvariant, "Loop invariant failed "+when+": ", inv)
+	}
+}
+
+// compileDecreasesEntry records the termination metric before the loop and
+// checks it is non-negative. It returns the local holding the metric.
+func (fc *funcCompiler) compileDecreasesEntry(d *ir.DecreasesClause) int {
+	prev := fc.allocAnon(valI64)
+	fc.compileExpr(d.Expr)
+	fc.localSet(prev)
+	guarded := fc.beginGuard(nil)
+	fc.localGet(prev)
+	fc.i64Const(0)
+	fc.body = append(fc.body, opI64LtS, opIf, blockVoid)
+	fc.blockDepth++
+	fc.compileViolation(violationDecreases, "Decreases metric must be non-negative at entry: "+d.RawText)
+	fc.body = append(fc.body, opEnd)
+	fc.blockDepth--
+	fc.endGuard(guarded)
+	return prev
+}
+
+// compileDecreasesStep checks the metric strictly decreased and stayed
+// non-negative after an iteration, then records the new value.
+func (fc *funcCompiler) compileDecreasesStep(d *ir.DecreasesClause, prev int) {
+	next := fc.allocAnon(valI64)
+	fc.compileExpr(d.Expr)
+	fc.localSet(next)
+	guarded := fc.beginGuard(nil)
+	fc.localGet(next)
+	fc.localGet(prev)
+	fc.body = append(fc.body, opI64GeS, opIf, blockVoid)
+	fc.blockDepth++
+	fc.compileViolation(violationDecreases, "Termination metric did not decrease: "+d.RawText)
+	fc.body = append(fc.body, opEnd)
+	fc.blockDepth--
+
+	fc.localGet(next)
+	fc.i64Const(0)
+	fc.body = append(fc.body, opI64LtS, opIf, blockVoid)
+	fc.blockDepth++
+	fc.compileViolation(violationDecreases, "Termination metric became negative: "+d.RawText)
+	fc.body = append(fc.body, opEnd)
+	fc.blockDepth--
+	fc.endGuard(guarded)
+
+	fc.localGet(next)
+	fc.localSet(prev)
+}
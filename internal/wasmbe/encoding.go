@@ -29,10 +29,16 @@ const (
 	valF64 byte = 0x7C
 )
 
+// Import kinds
+const (
+	importFunc byte = 0x00
+)
+
 // Export kinds
 const (
 	exportFunc   byte = 0x00
 	exportMemory byte = 0x02
+	exportGlobal byte = 0x03
 )
 
 // WASM opcodes
@@ -50,6 +56,7 @@ const (
 	opReturn      byte = 0x0F
 	opCall        byte = 0x10
 	opDrop        byte = 0x1A
+	opSelect      byte = 0x1B
 
 	// Variables
 	opLocalGet  byte = 0x20
@@ -62,9 +69,11 @@ const (
 	opI32Load    byte = 0x28
 	opI64Load    byte = 0x29
 	opF64Load    byte = 0x2B
+	opI32Load8U  byte = 0x2D
 	opI32Store   byte = 0x36
 	opI64Store   byte = 0x37
 	opF64Store   byte = 0x39
+	opI32Store8  byte = 0x3A
 	opMemorySize byte = 0x3F
 	opMemoryGrow byte = 0x40
 
@@ -78,9 +87,13 @@ const (
 	opI32Eq   byte = 0x46
 	opI32Ne   byte = 0x47
 	opI32LtS  byte = 0x48
+	opI32LtU  byte = 0x49
 	opI32GtS  byte = 0x4A
+	opI32GtU  byte = 0x4B
 	opI32LeS  byte = 0x4C
+	opI32LeU  byte = 0x4D
 	opI32GeS  byte = 0x4E
+	opI32GeU  byte = 0x4F
 	opI32Add  byte = 0x6A
 	opI32Sub  byte = 0x6B
 	opI32Mul  byte = 0x6C
@@ -88,6 +101,9 @@ const (
 	opI32RemS byte = 0x6F
 	opI32And  byte = 0x71
 	opI32Or   byte = 0x72
+	opI32Xor  byte = 0x73
+	opI32Shl  byte = 0x74
+	opI32ShrU byte = 0x76
 
 	// i64 operations
 	opI64Eqz  byte = 0x50
@@ -97,31 +113,42 @@ const (
 	opI64GtS  byte = 0x55
 	opI64LeS  byte = 0x57
 	opI64GeS  byte = 0x59
+	opI64GeU  byte = 0x5A
 	opI64Add  byte = 0x7C
 	opI64Sub  byte = 0x7D
 	opI64Mul  byte = 0x7E
 	opI64DivS byte = 0x7F
+	opI64DivU byte = 0x80
 	opI64RemS byte = 0x81
+	opI64RemU byte = 0x82
 	opI64And  byte = 0x83
 	opI64Or   byte = 0x84
+	opI64ShrU byte = 0x88
 
 	// f64 operations
-	opF64Eq  byte = 0x61
-	opF64Ne  byte = 0x62
-	opF64Lt  byte = 0x63
-	opF64Gt  byte = 0x64
-	opF64Le  byte = 0x65
-	opF64Ge  byte = 0x66
-	opF64Add byte = 0xA0
-	opF64Sub byte = 0xA1
-	opF64Mul byte = 0xA2
-	opF64Div byte = 0xA3
+	opF64Eq      byte = 0x61
+	opF64Ne      byte = 0x62
+	opF64Lt      byte = 0x63
+	opF64Gt      byte = 0x64
+	opF64Le      byte = 0x65
+	opF64Ge      byte = 0x66
+	opF64Abs     byte = 0x99
+	opF64Nearest byte = 0x9E
+	opF64Add     byte = 0xA0
+	opF64Sub     byte = 0xA1
+	opF64Mul     byte = 0xA2
+	opF64Div     byte = 0xA3
 
 	// Conversions
 	opI32WrapI64    byte = 0xA7
 	opI64ExtendI32S byte = 0xAC
+	opI64ExtendI32U byte = 0xAD
 	opF64ConvertI64 byte = 0xB9
 
+	// Prefixed (0xFC) instructions
+	opMiscPrefix      byte = 0xFC
+	opI64TruncSatF64S byte = 0x06
+
 	// Block types
 	blockVoid byte = 0x40
 	blockI32  byte = 0x7F
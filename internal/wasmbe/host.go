@@ -0,0 +1,224 @@
+package wasmbe
+
+import (
+	"strings"
+
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// Host imports for print
+//
+// print compiles to a call to one of three imports, chosen by the type of its
+// argument. Each call prints one line:
+//
+//	env.print_i64(value i64)
+//	env.print_f64(value f64)
+//	env.print_str(ptr i32, len i32)   (UTF-8 bytes in the exported memory)
+//
+// Bool and other values are converted to a string first and use print_str.
+// Modules that never call print do not import these. Loader generates a JS
+// stub that provides them, along with env.contract_violation.
+
+// printImports holds the function indices of the print imports, -1 when absent.
+type printImports struct {
+	i64 int
+	f64 int
+	str int
+}
+
+// declarePrintImports imports the print functions when any module calls print.
+func (g *generator) declarePrintImports(mods []*ir.Module) {
+	for _, mod := range mods {
+		if moduleCallsPrint(mod) {
+			g.print.i64 = g.declareImport("env", "print_i64", []byte{valI64}, nil)
+			g.print.f64 = g.declareImport("env", "print_f64", []byte{valF64}, nil)
+			g.print.str = g.declareImport("env", "print_str", []byte{valI32, valI32}, nil)
+			return
+		}
+	}
+}
+
+// compilePrint calls the print import matching the argument type.
+func (fc *funcCompiler) compilePrint(arg ir.Expr) {
+	if fc.gen.print.str < 0 {
+		fc.compileExpr(arg)
+		fc.body = append(fc.body, opDrop)
+		return
+	}
+	name := ""
+	if t := arg.ExprType(); t != nil {
+		name = t.Name
+	}
+	switch name {
+	case "Int":
+		fc.compileExpr(arg)
+		fc.call(fc.gen.print.i64)
+	case "Float":
+		fc.compileExpr(arg)
+		fc.call(fc.gen.print.f64)
+	default:
+		// print_str takes the bytes after the length header and the length
+		s := fc.allocAnon(valI32)
+		fc.compileToString(arg)
+		fc.localTee(s)
+		fc.i32Const(4)
+		fc.body = append(fc.body, opI32Add)
+		fc.localGet(s)
+		fc.load(valI32, 0)
+		fc.call(fc.gen.print.str)
+	}
+}
+
+// moduleCallsPrint reports whether any function, constructor or method of a
+// module calls print.
+func moduleCallsPrint(mod *ir.Module) bool {
+	for _, fn := range mod.Functions {
+		if stmtsCallPrint(fn.Body) {
+			return true
+		}
+	}
+	for _, ent := range mod.Entities {
+		if ent.Constructor != nil && stmtsCallPrint(ent.Constructor.Body) {
+			return true
+		}
+		for _, m := range ent.Methods {
+			if stmtsCallPrint(m.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func stmtsCallPrint(stmts []ir.Stmt) bool {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ir.LetStmt:
+			if exprCallsPrint(s.Value) {
+				return true
+			}
+		case *ir.AssignStmt:
+			if exprCallsPrint(s.Value) {
+				return true
+			}
+		case *ir.ReturnStmt:
+			if exprCallsPrint(s.Value) {
+				return true
+			}
+		case *ir.ExprStmt:
+			if exprCallsPrint(s.Expr) {
+				return true
+			}
+		case *ir.IfStmt:
+			if stmtsCallPrint(s.Then) || stmtsCallPrint(s.Else) {
+				return true
+			}
+		case *ir.WhileStmt:
+			if stmtsCallPrint(s.Body) {
+				return true
+			}
+		case *ir.ForInStmt:
+			if stmtsCallPrint(s.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exprCallsPrint looks for print where it can appear in expression position:
+// directly, or inside a match arm.
+func exprCallsPrint(expr ir.Expr) bool {
+	switch e := expr.(type) {
+	case *ir.CallExpr:
+		return e.Kind == ir.CallBuiltin && e.Function == "print"
+	case *ir.MatchExpr:
+		for _, arm := range e.Arms {
+			if exprCallsPrint(arm.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// EntryName returns the name the entry function is exported under, or "" when
+// the program has no entry point.
+func EntryName(mods []*ir.Module) string {
+	for _, mod := range mods {
+		for _, fn := range mod.Functions {
+			if fn.IsEntry {
+				return fn.Name
+			}
+		}
+	}
+	return ""
+}
+
+// Loader returns a JS stub that instantiates wasmFile with the env imports,
+// runs the entry function and exits with its result. It runs under Node
+// (node hello.loader.js) and in browsers, where it fetches wasmFile relative
+// to the page. Debug contract checks start switched off when
+// INTENT_CONTRACTS=off under Node or globalThis.__intentContracts is false.
+func Loader(wasmFile, entry string) string {
+	r := strings.NewReplacer("{{WASM}}", wasmFile, "{{ENTRY}}", entry)
+	return r.Replace(loaderTemplate)
+}
+
+const loaderTemplate = `// Loader for {{WASM}}, generated by intentc.
+//
+//   Node:    node <this file>
+//   Browser: <script src="<this file>"></script> served next to {{WASM}}
+"use strict";
+(function () {
+  const isNode = typeof process !== "undefined" && process.versions != null && process.versions.node != null;
+  const decoder = new TextDecoder();
+  let memory;
+
+  const readString = (ptr, len) => decoder.decode(new Uint8Array(memory.buffer, ptr, len));
+  const out = isNode ? (s) => process.stdout.write(s + "\n") : (s) => console.log(s);
+  const err = isNode ? (s) => process.stderr.write(s + "\n") : (s) => console.error(s);
+  let violated = false;
+
+  const env = {
+    print_i64: (v) => out(String(v)),
+    print_f64: (v) => out(String(v)),
+    print_str: (ptr, len) => out(readString(ptr, len)),
+    contract_violation: (kind, ptr, len) => {
+      violated = true;
+      err(readString(ptr, len));
+    },
+  };
+
+  const load = isNode
+    ? Promise.resolve(require("fs").readFileSync(require("path").join(__dirname, "{{WASM}}")))
+    : fetch("{{WASM}}").then((r) => r.arrayBuffer());
+
+  load
+    .then((bytes) => WebAssembly.instantiate(bytes, { env }))
+    .then(({ instance }) => {
+      memory = instance.exports.memory;
+      // Builds with --contracts=debug export a flag that switches checks off
+      const contracts = instance.exports.__intent_contracts;
+      if (contracts && (globalThis.__intentContracts === false || (isNode && process.env.INTENT_CONTRACTS === "off"))) {
+        contracts.value = 0;
+      }
+      const entry = instance.exports["{{ENTRY}}"];
+      if (typeof entry !== "function") {
+        return;
+      }
+      const code = entry();
+      if (isNode && code !== undefined) {
+        process.exitCode = Number(code);
+      }
+    })
+    .catch((e) => {
+      if (!violated) {
+        err(String(e));
+      }
+      if (isNode) {
+        process.exitCode = 1;
+      }
+    });
+})();
+`
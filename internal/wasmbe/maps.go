@@ -0,0 +1,696 @@
+package wasmbe
+
+import (
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// Maps are hash tables (see the layout in memory.go) managed by the runtime
+// helpers below. Iteration, keys() and values() go through __map_entries,
+// which sorts the entries by key so maps are iterated in ascending key order
+// as in the other backends.
+
+const (
+	fnvOffset    = -2128831035 // 2166136261 as an i32
+	fnvPrime     = 16777619
+	fibonacciMul = -7046029254386353131 // 0x9E3779B97F4A7C15 as an i64
+)
+
+// --- Runtime helpers ---
+
+// buildMapNew allocates an empty map. Fresh memory is zeroed, so every entry
+// starts empty.
+func (fc *funcCompiler) buildMapNew() {
+	const strKeys = 0
+	m := fc.allocAnon(valI32)
+
+	fc.i32Const(mapHeaderSize)
+	fc.call(fc.gen.runtimeFunc(rtAlloc))
+	fc.localTee(m)
+	fc.i32Const(mapInitialCap)
+	fc.store(valI32, mapCapOffset)
+	fc.localGet(m)
+	fc.i32Const(mapInitialCap * mapEntrySize)
+	fc.call(fc.gen.runtimeFunc(rtAlloc))
+	fc.store(valI32, mapDataOffset)
+	fc.localGet(m)
+	fc.localGet(strKeys)
+	fc.store(valI32, mapStrKeysOffset)
+
+	fc.localGet(m)
+}
+
+// buildMapHash returns the bucket of a key: FNV-1a over the bytes of a
+// string, Fibonacci hashing for anything else.
+func (fc *funcCompiler) buildMapHash() {
+	const m, key = 0, 1
+	h := fc.allocAnon(valI32)
+	s := fc.allocAnon(valI32)
+	n := fc.allocAnon(valI32)
+	i := fc.allocAnon(valI32)
+
+	fc.localGet(m)
+	fc.load(valI32, mapStrKeysOffset)
+	fc.body = append(fc.body, opIf, blockVoid)
+	fc.i32Const(fnvOffset)
+	fc.localSet(h)
+	fc.localGet(key)
+	fc.body = append(fc.body, opI32WrapI64)
+	fc.localTee(s)
+	fc.load(valI32, 0)
+	fc.localSet(n)
+	fc.body = append(fc.body, opBlock, blockVoid, opLoop, blockVoid)
+	fc.localGet(i)
+	fc.localGet(n)
+	fc.body = append(fc.body, opI32GeU, opBrIf, 1)
+	fc.localGet(h)
+	fc.localGet(s)
+	fc.localGet(i)
+	fc.body = append(fc.body, opI32Add)
+	fc.loadByte(4)
+	fc.body = append(fc.body, opI32Xor)
+	fc.i32Const(fnvPrime)
+	fc.body = append(fc.body, opI32Mul)
+	fc.localSet(h)
+	fc.localGet(i)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(i)
+	fc.body = append(fc.body, opBr, 0, opEnd, opEnd)
+	fc.body = append(fc.body, opElse)
+	fc.localGet(key)
+	fc.i64Const(fibonacciMul)
+	fc.body = append(fc.body, opI64Mul)
+	fc.i64Const(32)
+	fc.body = append(fc.body, opI64ShrU, opI32WrapI64)
+	fc.localSet(h)
+	fc.body = append(fc.body, opEnd)
+
+	// h & (cap - 1)
+	fc.localGet(h)
+	fc.localGet(m)
+	fc.load(valI32, mapCapOffset)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Sub, opI32And)
+}
+
+// mapKeyEq pushes whether the key of entry e equals key.
+func (fc *funcCompiler) mapKeyEq(m, key, e int) {
+	fc.localGet(m)
+	fc.load(valI32, mapStrKeysOffset)
+	fc.body = append(fc.body, opIf, blockI32)
+	fc.localGet(key)
+	fc.body = append(fc.body, opI32WrapI64)
+	fc.localGet(e)
+	fc.load(valI32, mapKeyOffset)
+	fc.call(fc.gen.runtimeFunc(rtStrEq))
+	fc.body = append(fc.body, opElse)
+	fc.localGet(key)
+	fc.localGet(e)
+	fc.load(valI64, mapKeyOffset)
+	fc.body = append(fc.body, opI64Eq)
+	fc.body = append(fc.body, opEnd)
+}
+
+// mapKeyLess pushes whether the key of entry a sorts before the key of
+// entry b: strings byte by byte, anything else as a signed integer.
+func (fc *funcCompiler) mapKeyLess(m, a, b int) {
+	fc.localGet(m)
+	fc.load(valI32, mapStrKeysOffset)
+	fc.body = append(fc.body, opIf, blockI32)
+	fc.localGet(a)
+	fc.load(valI32, mapKeyOffset)
+	fc.localGet(b)
+	fc.load(valI32, mapKeyOffset)
+	fc.call(fc.gen.runtimeFunc(rtStrLt))
+	fc.body = append(fc.body, opElse)
+	fc.localGet(a)
+	fc.load(valI64, mapKeyOffset)
+	fc.localGet(b)
+	fc.load(valI64, mapKeyOffset)
+	fc.body = append(fc.body, opI64LtS)
+	fc.body = append(fc.body, opEnd)
+}
+
+// mapProbeLoop walks the entries of key's probe sequence, running visit on
+// each with its address in e. Visit returns from the function to end the
+// walk; the table always has an empty entry, so one is reached eventually.
+func (fc *funcCompiler) mapProbeLoop(m, key int, visit func(e int)) {
+	i := fc.allocAnon(valI32)
+	mask := fc.allocAnon(valI32)
+	e := fc.allocAnon(valI32)
+
+	fc.localGet(m)
+	fc.localGet(key)
+	fc.call(fc.gen.runtimeFunc(rtMapHash))
+	fc.localSet(i)
+	fc.localGet(m)
+	fc.load(valI32, mapCapOffset)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Sub)
+	fc.localSet(mask)
+
+	fc.body = append(fc.body, opLoop, blockVoid)
+	fc.localGet(m)
+	fc.load(valI32, mapDataOffset)
+	fc.localGet(i)
+	fc.i32Const(mapEntrySize)
+	fc.body = append(fc.body, opI32Mul, opI32Add)
+	fc.localSet(e)
+	visit(e)
+	fc.localGet(i)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.localGet(mask)
+	fc.body = append(fc.body, opI32And)
+	fc.localSet(i)
+	fc.body = append(fc.body, opBr, 0, opEnd)
+	fc.body = append(fc.body, opUnreachable)
+}
+
+// buildMapFind returns the entry holding key, or 0 when there is none.
+func (fc *funcCompiler) buildMapFind() {
+	const m, key = 0, 1
+	fc.mapProbeLoop(m, key, func(e int) {
+		// an empty entry ends the probe sequence
+		fc.localGet(e)
+		fc.load(valI32, mapStateOffset)
+		fc.body = append(fc.body, opI32Eqz, opIf, blockVoid)
+		fc.i32Const(0)
+		fc.body = append(fc.body, opReturn, opEnd)
+
+		fc.localGet(e)
+		fc.load(valI32, mapStateOffset)
+		fc.i32Const(mapEntryUsed)
+		fc.body = append(fc.body, opI32Eq, opIf, blockVoid)
+		fc.mapKeyEq(m, key, e)
+		fc.body = append(fc.body, opIf, blockVoid)
+		fc.localGet(e)
+		fc.body = append(fc.body, opReturn, opEnd, opEnd)
+	})
+}
+
+// buildMapProbe returns the first entry of key's probe sequence that is not
+// in use, where a key known to be absent can be inserted.
+func (fc *funcCompiler) buildMapProbe() {
+	const m, key = 0, 1
+	fc.mapProbeLoop(m, key, func(e int) {
+		fc.localGet(e)
+		fc.load(valI32, mapStateOffset)
+		fc.i32Const(mapEntryUsed)
+		fc.body = append(fc.body, opI32Ne, opIf, blockVoid)
+		fc.localGet(e)
+		fc.body = append(fc.body, opReturn, opEnd)
+	})
+}
+
+// buildMapInsert returns the value slot of key, adding an entry for it when
+// there is none. The table doubles and is rehashed, dropping deleted
+// entries, when the new entry would fill more than three quarters of it.
+func (fc *funcCompiler) buildMapInsert() {
+	const m, key = 0, 1
+	e := fc.allocAnon(valI32)
+	oldData := fc.allocAnon(valI32)
+	oldCap := fc.allocAnon(valI32)
+	j := fc.allocAnon(valI32)
+	old := fc.allocAnon(valI32)
+
+	fc.localGet(m)
+	fc.localGet(key)
+	fc.call(fc.gen.runtimeFunc(rtMapFind))
+	fc.localTee(e)
+	fc.body = append(fc.body, opIf, blockVoid)
+	fc.localGet(e)
+	fc.i32Const(mapValueOffset)
+	fc.body = append(fc.body, opI32Add, opReturn, opEnd)
+
+	// (filled + 1) * 4 > cap * 3 => grow
+	fc.localGet(m)
+	fc.load(valI32, mapFilledOffset)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.i32Const(2)
+	fc.body = append(fc.body, opI32Shl)
+	fc.localGet(m)
+	fc.load(valI32, mapCapOffset)
+	fc.localTee(oldCap)
+	fc.i32Const(3)
+	fc.body = append(fc.body, opI32Mul, opI32GtU, opIf, blockVoid)
+	fc.localGet(m)
+	fc.load(valI32, mapDataOffset)
+	fc.localSet(oldData)
+	fc.localGet(m)
+	fc.localGet(oldCap)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Shl)
+	fc.store(valI32, mapCapOffset)
+	fc.localGet(m)
+	fc.localGet(oldCap)
+	fc.i32Const(2 * mapEntrySize)
+	fc.body = append(fc.body, opI32Mul)
+	fc.call(fc.gen.runtimeFunc(rtAlloc))
+	fc.store(valI32, mapDataOffset)
+	fc.localGet(m)
+	fc.localGet(m)
+	fc.load(valI32, mapLenOffset)
+	fc.store(valI32, mapFilledOffset)
+
+	fc.body = append(fc.body, opBlock, blockVoid, opLoop, blockVoid)
+	fc.localGet(j)
+	fc.localGet(oldCap)
+	fc.body = append(fc.body, opI32GeU, opBrIf, 1)
+	fc.localGet(oldData)
+	fc.localGet(j)
+	fc.i32Const(mapEntrySize)
+	fc.body = append(fc.body, opI32Mul, opI32Add)
+	fc.localTee(old)
+	fc.load(valI32, mapStateOffset)
+	fc.i32Const(mapEntryUsed)
+	fc.body = append(fc.body, opI32Eq, opIf, blockVoid)
+	fc.localGet(m)
+	fc.localGet(old)
+	fc.load(valI64, mapKeyOffset)
+	fc.call(fc.gen.runtimeFunc(rtMapProbe))
+	fc.localGet(old)
+	fc.i32Const(mapEntrySize)
+	fc.call(fc.gen.runtimeFunc(rtMemcpy))
+	fc.body = append(fc.body, opEnd)
+	fc.localGet(j)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(j)
+	fc.body = append(fc.body, opBr, 0, opEnd, opEnd)
+	fc.body = append(fc.body, opEnd)
+
+	// Reusing a deleted entry leaves the filled count unchanged
+	fc.localGet(m)
+	fc.localGet(key)
+	fc.call(fc.gen.runtimeFunc(rtMapProbe))
+	fc.localTee(e)
+	fc.load(valI32, mapStateOffset)
+	fc.body = append(fc.body, opI32Eqz, opIf, blockVoid)
+	fc.localGet(m)
+	fc.localGet(m)
+	fc.load(valI32, mapFilledOffset)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.store(valI32, mapFilledOffset)
+	fc.body = append(fc.body, opEnd)
+
+	fc.localGet(e)
+	fc.i32Const(mapEntryUsed)
+	fc.store(valI32, mapStateOffset)
+	fc.localGet(e)
+	fc.localGet(key)
+	fc.store(valI64, mapKeyOffset)
+	fc.localGet(m)
+	fc.localGet(m)
+	fc.load(valI32, mapLenOffset)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.store(valI32, mapLenOffset)
+
+	fc.localGet(e)
+	fc.i32Const(mapValueOffset)
+	fc.body = append(fc.body, opI32Add)
+}
+
+// buildMapRemove marks the entry holding key as deleted, if there is one.
+func (fc *funcCompiler) buildMapRemove() {
+	const m, key = 0, 1
+	e := fc.allocAnon(valI32)
+
+	fc.localGet(m)
+	fc.localGet(key)
+	fc.call(fc.gen.runtimeFunc(rtMapFind))
+	fc.localTee(e)
+	fc.body = append(fc.body, opIf, blockVoid)
+	fc.localGet(e)
+	fc.i32Const(mapEntryDeleted)
+	fc.store(valI32, mapStateOffset)
+	fc.localGet(m)
+	fc.localGet(m)
+	fc.load(valI32, mapLenOffset)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Sub)
+	fc.store(valI32, mapLenOffset)
+	fc.body = append(fc.body, opEnd)
+}
+
+// buildMapEntries returns an array of the addresses of the entries in use,
+// insertion sorted by key.
+func (fc *funcCompiler) buildMapEntries() {
+	const m = 0
+	arr := fc.allocAnon(valI32)
+	out := fc.allocAnon(valI32)
+	n := fc.allocAnon(valI32)
+	j := fc.allocAnon(valI32)
+	e := fc.allocAnon(valI32)
+	k := fc.allocAnon(valI32)
+	prev := fc.allocAnon(valI32)
+
+	fc.localGet(m)
+	fc.load(valI32, mapLenOffset)
+	fc.call(fc.gen.runtimeFunc(rtArrayNew))
+	fc.localTee(arr)
+	fc.load(valI32, arrayDataOffset)
+	fc.localSet(out)
+
+	// collect the entries in use
+	fc.body = append(fc.body, opBlock, blockVoid, opLoop, blockVoid)
+	fc.localGet(j)
+	fc.localGet(m)
+	fc.load(valI32, mapCapOffset)
+	fc.body = append(fc.body, opI32GeU, opBrIf, 1)
+	fc.localGet(m)
+	fc.load(valI32, mapDataOffset)
+	fc.localGet(j)
+	fc.i32Const(mapEntrySize)
+	fc.body = append(fc.body, opI32Mul, opI32Add)
+	fc.localTee(e)
+	fc.load(valI32, mapStateOffset)
+	fc.i32Const(mapEntryUsed)
+	fc.body = append(fc.body, opI32Eq, opIf, blockVoid)
+	fc.localGet(out)
+	fc.localGet(n)
+	fc.i32Const(slotSize)
+	fc.body = append(fc.body, opI32Mul, opI32Add)
+	fc.localGet(e)
+	fc.store(valI32, 0)
+	fc.localGet(n)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(n)
+	fc.body = append(fc.body, opEnd)
+	fc.localGet(j)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(j)
+	fc.body = append(fc.body, opBr, 0, opEnd, opEnd)
+
+	// for j in 1..n: move out[j] left past every larger key
+	fc.i32Const(1)
+	fc.localSet(j)
+	fc.body = append(fc.body, opBlock, blockVoid, opLoop, blockVoid)
+	fc.localGet(j)
+	fc.localGet(n)
+	fc.body = append(fc.body, opI32GeU, opBrIf, 1)
+	fc.localGet(out)
+	fc.localGet(j)
+	fc.i32Const(slotSize)
+	fc.body = append(fc.body, opI32Mul, opI32Add)
+	fc.load(valI32, 0)
+	fc.localSet(e)
+	fc.localGet(j)
+	fc.localSet(k)
+
+	fc.body = append(fc.body, opBlock, blockVoid, opLoop, blockVoid)
+	fc.localGet(k)
+	fc.body = append(fc.body, opI32Eqz, opBrIf, 1)
+	fc.localGet(out)
+	fc.localGet(k)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Sub)
+	fc.i32Const(slotSize)
+	fc.body = append(fc.body, opI32Mul, opI32Add)
+	fc.load(valI32, 0)
+	fc.localSet(prev)
+	fc.mapKeyLess(m, e, prev)
+	fc.body = append(fc.body, opI32Eqz, opBrIf, 1)
+	fc.localGet(out)
+	fc.localGet(k)
+	fc.i32Const(slotSize)
+	fc.body = append(fc.body, opI32Mul, opI32Add)
+	fc.localGet(prev)
+	fc.store(valI32, 0)
+	fc.localGet(k)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Sub)
+	fc.localSet(k)
+	fc.body = append(fc.body, opBr, 0, opEnd, opEnd)
+
+	fc.localGet(out)
+	fc.localGet(k)
+	fc.i32Const(slotSize)
+	fc.body = append(fc.body, opI32Mul, opI32Add)
+	fc.localGet(e)
+	fc.store(valI32, 0)
+	fc.localGet(j)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(j)
+	fc.body = append(fc.body, opBr, 0, opEnd, opEnd)
+
+	fc.localGet(arr)
+}
+
+// buildMapProject returns the keys or the values of a map, in key order,
+// by replacing each entry address from __map_entries with the slot at
+// offset in that entry.
+func (fc *funcCompiler) buildMapProject(offset int) {
+	const m = 0
+	arr := fc.allocAnon(valI32)
+	slot := fc.allocAnon(valI32)
+	i := fc.allocAnon(valI32)
+
+	fc.localGet(m)
+	fc.call(fc.gen.runtimeFunc(rtMapEntries))
+	fc.localSet(arr)
+
+	fc.body = append(fc.body, opBlock, blockVoid, opLoop, blockVoid)
+	fc.localGet(i)
+	fc.localGet(arr)
+	fc.load(valI32, arrayLenOffset)
+	fc.body = append(fc.body, opI32GeU, opBrIf, 1)
+	fc.localGet(arr)
+	fc.load(valI32, arrayDataOffset)
+	fc.localGet(i)
+	fc.i32Const(slotSize)
+	fc.body = append(fc.body, opI32Mul, opI32Add)
+	fc.localTee(slot)
+	fc.localGet(slot)
+	fc.load(valI32, 0)
+	fc.load(valI64, offset)
+	fc.store(valI64, 0)
+	fc.localGet(i)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(i)
+	fc.body = append(fc.body, opBr, 0, opEnd, opEnd)
+
+	fc.localGet(arr)
+}
+
+// buildStrLt compares two strings byte by byte; a prefix sorts first.
+func (fc *funcCompiler) buildStrLt() {
+	const a, b = 0, 1
+	n := fc.allocAnon(valI32)
+	i := fc.allocAnon(valI32)
+	ca := fc.allocAnon(valI32)
+	cb := fc.allocAnon(valI32)
+
+	// n = min(len a, len b)
+	fc.localGet(a)
+	fc.load(valI32, 0)
+	fc.localGet(b)
+	fc.load(valI32, 0)
+	fc.localGet(a)
+	fc.load(valI32, 0)
+	fc.localGet(b)
+	fc.load(valI32, 0)
+	fc.body = append(fc.body, opI32LtU, opSelect)
+	fc.localSet(n)
+
+	fc.body = append(fc.body, opBlock, blockVoid, opLoop, blockVoid)
+	fc.localGet(i)
+	fc.localGet(n)
+	fc.body = append(fc.body, opI32GeU, opBrIf, 1)
+	fc.localGet(a)
+	fc.localGet(i)
+	fc.body = append(fc.body, opI32Add)
+	fc.loadByte(4)
+	fc.localSet(ca)
+	fc.localGet(b)
+	fc.localGet(i)
+	fc.body = append(fc.body, opI32Add)
+	fc.loadByte(4)
+	fc.localSet(cb)
+	fc.localGet(ca)
+	fc.localGet(cb)
+	fc.body = append(fc.body, opI32Ne, opIf, blockVoid)
+	fc.localGet(ca)
+	fc.localGet(cb)
+	fc.body = append(fc.body, opI32LtU, opReturn, opEnd)
+	fc.localGet(i)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(i)
+	fc.body = append(fc.body, opBr, 0, opEnd, opEnd)
+
+	fc.localGet(a)
+	fc.load(valI32, 0)
+	fc.localGet(b)
+	fc.load(valI32, 0)
+	fc.body = append(fc.body, opI32LtU)
+}
+
+// --- Compilation ---
+
+// compileMapNew creates an empty map of type t.
+func (fc *funcCompiler) compileMapNew(t *checker.Type) {
+	strKeys := int64(0)
+	if checker.IsMap(t) && t.TypeParams[0].Equal(checker.TypeString) {
+		strKeys = 1
+	}
+	fc.i32Const(strKeys)
+	fc.call(fc.gen.runtimeFunc(rtMapNew))
+}
+
+// compileMapKey pushes a key extended to the i64 that maps store.
+func (fc *funcCompiler) compileMapKey(key ir.Expr) {
+	fc.compileExpr(key)
+	if typeForIR(key.ExprType()) == valI32 {
+		fc.body = append(fc.body, opI64ExtendI32U)
+	}
+}
+
+// compileMapMethod compiles a call to a built-in method of a map.
+func (fc *funcCompiler) compileMapMethod(e *ir.MethodCallExpr) {
+	switch e.Method {
+	case "get":
+		fc.compileMapGet(e)
+	case "contains":
+		fc.compileExpr(e.Object)
+		fc.compileMapKey(e.Args[0])
+		fc.call(fc.gen.runtimeFunc(rtMapFind))
+		fc.i32Const(0)
+		fc.body = append(fc.body, opI32Ne)
+	case "set":
+		// Evaluate the value before inserting, so it sees the map unchanged
+		vtype := typeForIR(e.Args[1].ExprType())
+		m := fc.allocAnon(valI32)
+		key := fc.allocAnon(valI64)
+		value := fc.allocAnon(vtype)
+		fc.compileExpr(e.Object)
+		fc.localSet(m)
+		fc.compileMapKey(e.Args[0])
+		fc.localSet(key)
+		fc.compileExpr(e.Args[1])
+		fc.localSet(value)
+		fc.localGet(m)
+		fc.localGet(key)
+		fc.call(fc.gen.runtimeFunc(rtMapInsert))
+		fc.localGet(value)
+		fc.store(vtype, 0)
+	case "remove":
+		fc.compileExpr(e.Object)
+		fc.compileMapKey(e.Args[0])
+		fc.call(fc.gen.runtimeFunc(rtMapRemove))
+	case "keys":
+		fc.compileExpr(e.Object)
+		fc.call(fc.gen.runtimeFunc(rtMapKeys))
+	case "values":
+		fc.compileExpr(e.Object)
+		fc.call(fc.gen.runtimeFunc(rtMapValues))
+	default:
+		fc.i64Const(0)
+	}
+}
+
+// compileMapGet looks a key up and wraps its value in Some, or returns None.
+func (fc *funcCompiler) compileMapGet(e *ir.MethodCallExpr) {
+	some, _ := fc.gen.variantOf(e.Type, "Option", "Some")
+	none, _ := fc.gen.variantOf(e.Type, "Option", "None")
+	entry := fc.allocAnon(valI32)
+	opt := fc.allocAnon(valI32)
+
+	fc.compileExpr(e.Object)
+	fc.compileMapKey(e.Args[0])
+	fc.call(fc.gen.runtimeFunc(rtMapFind))
+	fc.localTee(entry)
+	fc.body = append(fc.body, opIf, blockI32)
+	fc.i32Const(enumPayloadOffset + slotSize)
+	fc.call(fc.gen.runtimeFunc(rtAlloc))
+	fc.localTee(opt)
+	fc.i32Const(int64(some.tag))
+	fc.store(valI32, enumTagOffset)
+	fc.localGet(opt)
+	fc.localGet(entry)
+	fc.load(valI64, mapValueOffset)
+	fc.store(valI64, enumPayloadOffset)
+	fc.localGet(opt)
+	fc.body = append(fc.body, opElse)
+	fc.i32Const(enumPayloadOffset)
+	fc.call(fc.gen.runtimeFunc(rtAlloc))
+	fc.localTee(opt)
+	fc.i32Const(int64(none.tag))
+	fc.store(valI32, enumTagOffset)
+	fc.localGet(opt)
+	fc.body = append(fc.body, opEnd)
+}
+
+// compileForMap iterates over the keys, or the keys and values, of a map.
+// Both are copied before the loop, so the body can modify the map.
+func (fc *funcCompiler) compileForMap(s *ir.ForInStmt) {
+	t := s.Iterable.ExprType()
+	m := fc.allocAnon(valI32)
+	keys := fc.allocAnon(valI32)
+	values := fc.allocAnon(valI32)
+	pos := fc.allocAnon(valI32)
+
+	fc.compileExpr(s.Iterable)
+	fc.localTee(m)
+	fc.call(fc.gen.runtimeFunc(rtMapKeys))
+	fc.localSet(keys)
+	if s.ValueVariable != "" {
+		fc.localGet(m)
+		fc.call(fc.gen.runtimeFunc(rtMapValues))
+		fc.localSet(values)
+	}
+
+	keyType := typeForIR(t.TypeParams[0])
+	valueType := typeForIR(t.TypeParams[1])
+	keyIdx := fc.allocLocal(s.Variable, keyType)
+	valueIdx := -1
+	if s.ValueVariable != "" {
+		valueIdx = fc.allocLocal(s.ValueVariable, valueType)
+	}
+
+	fc.compileCountedLoop(
+		func() {
+			// pos >= len => exit
+			fc.localGet(pos)
+			fc.localGet(keys)
+			fc.load(valI32, arrayLenOffset)
+			fc.body = append(fc.body, opI32GeU)
+		},
+		func() {
+			fc.loadElement(keys, pos, keyType)
+			fc.localSet(keyIdx)
+			if valueIdx >= 0 {
+				fc.loadElement(values, pos, valueType)
+				fc.localSet(valueIdx)
+			}
+			for _, stmt := range s.Body {
+				fc.compileStmt(stmt)
+			}
+		},
+		func() {
+			// pos = pos + 1
+			fc.localGet(pos)
+			fc.i32Const(1)
+			fc.body = append(fc.body, opI32Add)
+			fc.localSet(pos)
+		},
+	)
+}
+
+// loadElement pushes element pos of the array in local arr.
+func (fc *funcCompiler) loadElement(arr, pos int, vtype byte) {
+	fc.localGet(arr)
+	fc.load(valI32, arrayDataOffset)
+	fc.localGet(pos)
+	fc.i32Const(slotSize)
+	fc.body = append(fc.body, opI32Mul, opI32Add)
+	fc.load(vtype, 0)
+}
@@ -0,0 +1,401 @@
+package wasmbe
+
+import (
+	"github.com/lhaig/intent/internal/checker"
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// Linear memory layout
+//
+// Every heap value is addressed by an i32 pointer and is made of 8-byte
+// slots, so any field or element can hold an i64, f64 or i32 value.
+//
+//	String:  [len i32][bytes...]
+//	Entity:  [field 0][field 1]...                 (one slot per field)
+//	Enum:    [tag i32 ][payload 0][payload 1]...   (tag is the variant index)
+//	Array:   [len i32][cap i32][data i32]          (data points at cap slots)
+//	Trait:   [entity i32][object i32]              (entity identifies the implementation)
+//	Map:     [len i32][cap i32][data i32][strKeys i32][filled i32]
+//	Entry:   [state i32][key slot][value slot]     (data points at cap entries)
+//
+// A map is an open-addressing hash table with linear probing. Its capacity
+// is a power of two, and it grows before more than three quarters of its
+// entries are filled (in use or deleted). An entry's state is empty, used or
+// deleted; keys are stored as i64, with string pointers and bools extended.
+//
+// Static data (string literals) starts at 1KB. The heap starts after it and is
+// managed by a bump allocator (__alloc) that never frees.
+const (
+	slotSize          = 8
+	wasmPageSize      = 65536
+	arrayLenOffset    = 0
+	arrayCapOffset    = 4
+	arrayDataOffset   = 8
+	arrayHeaderSize   = 12
+	enumTagOffset     = 0
+	enumPayloadOffset = slotSize
+	traitEntityOffset = 0
+	traitObjectOffset = 4
+	traitValueSize    = 8
+	mapLenOffset      = 0
+	mapCapOffset      = 4
+	mapDataOffset     = 8
+	mapStrKeysOffset  = 12
+	mapFilledOffset   = 16
+	mapHeaderSize     = 20
+	mapInitialCap     = 8
+	mapEntrySize      = 3 * slotSize
+	mapStateOffset    = 0
+	mapKeyOffset      = slotSize
+	mapValueOffset    = 2 * slotSize
+	mapEntryEmpty     = 0
+	mapEntryUsed      = 1
+	mapEntryDeleted   = 2
+)
+
+// entityLayout describes how an entity is stored and which functions
+// implement its constructor and methods.
+type entityLayout struct {
+	name       string
+	id         int // identifies the entity in trait values
+	implements []string
+	fields     []*ir.Field
+	fieldIndex map[string]int
+	ctor       int            // constructor function index, -1 if none
+	methods    map[string]int // method name -> function index
+}
+
+func newEntityLayout(ent *ir.Entity) *entityLayout {
+	layout := &entityLayout{
+		name:       ent.Name,
+		implements: ent.Implements,
+		fields:     ent.Fields,
+		fieldIndex: make(map[string]int),
+		ctor:       -1,
+		methods:    make(map[string]int),
+	}
+	for i, f := range ent.Fields {
+		layout.fieldIndex[f.Name] = i
+	}
+	return layout
+}
+
+// size returns the number of bytes an instance occupies.
+func (l *entityLayout) size() int {
+	if len(l.fields) == 0 {
+		return slotSize
+	}
+	return len(l.fields) * slotSize
+}
+
+// variantInfo describes one enum variant: its tag and payload field types.
+type variantInfo struct {
+	tag    int
+	fields []*checker.Type
+}
+
+// variantOf resolves a variant from the enum type when it carries EnumInfo
+// (always the case for Result and Option), or from the enum declaration.
+func (g *generator) variantOf(t *checker.Type, enumName, variant string) (variantInfo, bool) {
+	if t != nil && t.EnumInfo != nil {
+		for i, v := range t.EnumInfo.Variants {
+			if v.Name == variant {
+				info := variantInfo{tag: i}
+				for _, f := range v.Fields {
+					info.fields = append(info.fields, f.Type)
+				}
+				return info, true
+			}
+		}
+	}
+	if enumName == "" && t != nil {
+		enumName = t.Name
+	}
+	if en, ok := g.enums[enumName]; ok {
+		for i, v := range en.Variants {
+			if v.Name == variant {
+				info := variantInfo{tag: i}
+				for _, f := range v.Fields {
+					info.fields = append(info.fields, f.Type)
+				}
+				return info, true
+			}
+		}
+	}
+	// Builtin variants without type information: Ok/Some first, Err/None second
+	switch variant {
+	case "Ok", "Some":
+		return variantInfo{tag: 0}, true
+	case "Err", "None":
+		return variantInfo{tag: 1}, true
+	}
+	return variantInfo{}, false
+}
+
+// elementType returns the element type of an array type.
+func elementType(t *checker.Type) *checker.Type {
+	if t != nil && len(t.TypeParams) == 1 {
+		return t.TypeParams[0]
+	}
+	return nil
+}
+
+// blockTypeFor returns the block type for an expression of type t.
+func blockTypeFor(t *checker.Type) byte {
+	if t == nil || t.Name == "Void" {
+		return blockVoid
+	}
+	return typeForIR(t)
+}
+
+func align4(n int) int { return (n + 3) &^ 3 }
+func align8(n int) int { return (n + 7) &^ 7 }
+
+// --- Entities ---
+
+// layoutOf returns the entity layout for an object expression.
+func (fc *funcCompiler) layoutOf(obj ir.Expr) *entityLayout {
+	if _, isSelf := obj.(*ir.SelfRef); isSelf && fc.entity != nil {
+		return fc.entity
+	}
+	if t := obj.ExprType(); t != nil {
+		return fc.gen.entities[t.Name]
+	}
+	return nil
+}
+
+// fieldSlot returns the layout, byte offset and value type of a field.
+// The layout is nil when the field cannot be resolved.
+func (fc *funcCompiler) fieldSlot(e *ir.FieldAccessExpr) (*entityLayout, int, byte) {
+	layout := fc.layoutOf(e.Object)
+	if layout == nil {
+		return nil, 0, 0
+	}
+	idx, ok := layout.fieldIndex[e.Field]
+	if !ok {
+		return nil, 0, 0
+	}
+	return layout, idx * slotSize, typeForIR(layout.fields[idx].Type)
+}
+
+func (fc *funcCompiler) compileFieldAccess(e *ir.FieldAccessExpr) {
+	layout, offset, vtype := fc.fieldSlot(e)
+	fc.compileExpr(e.Object)
+	if layout == nil {
+		fc.body = append(fc.body, opDrop)
+		fc.zero(typeForIR(e.Type))
+		return
+	}
+	fc.load(vtype, offset)
+}
+
+// compileConstructorCall calls an entity constructor, which returns the new
+// instance. Entities without a constructor are allocated zeroed.
+func (fc *funcCompiler) compileConstructorCall(entityName string, args []ir.Expr) {
+	layout, ok := fc.gen.entities[entityName]
+	if !ok {
+		fc.i32Const(0)
+		return
+	}
+	if layout.ctor < 0 {
+		fc.i32Const(int64(layout.size()))
+		fc.call(fc.gen.runtimeFunc(rtAlloc))
+		return
+	}
+	for _, arg := range args {
+		fc.compileExpr(arg)
+	}
+	fc.call(layout.ctor)
+}
+
+// --- Enums ---
+
+// compileVariant allocates an enum value and stores its tag and payload.
+func (fc *funcCompiler) compileVariant(t *checker.Type, enumName, variant string, args []ir.Expr) {
+	info, _ := fc.gen.variantOf(t, enumName, variant)
+
+	tmp := fc.allocAnon(valI32)
+	fc.i32Const(int64(enumPayloadOffset + len(args)*slotSize))
+	fc.call(fc.gen.runtimeFunc(rtAlloc))
+	fc.localTee(tmp)
+	fc.i32Const(int64(info.tag))
+	fc.store(valI32, enumTagOffset)
+
+	for i, arg := range args {
+		fc.localGet(tmp)
+		fc.compileExpr(arg)
+		fc.store(typeForIR(arg.ExprType()), enumPayloadOffset+i*slotSize)
+	}
+	fc.localGet(tmp)
+}
+
+// compileMatchExpr compiles a match into a chain of tag comparisons:
+//
+//	if (tag == A) { bind; armA } else if (tag == B) { bind; armB } else { wildcard }
+func (fc *funcCompiler) compileMatchExpr(e *ir.MatchExpr) {
+	scrut := fc.allocAnon(valI32)
+	fc.compileExpr(e.Scrutinee)
+	fc.localSet(scrut)
+
+	scrutType := e.Scrutinee.ExprType()
+	bt := blockTypeFor(e.Type)
+	opened := 0
+	exhaustive := false
+
+	for _, arm := range e.Arms {
+		if arm.Pattern.IsWildcard {
+			fc.compileArmBody(arm.Body, bt)
+			exhaustive = true
+			break
+		}
+
+		info, ok := fc.gen.variantOf(scrutType, arm.Pattern.EnumName, arm.Pattern.VariantName)
+		if !ok {
+			info.tag = -1
+		}
+		fc.localGet(scrut)
+		fc.load(valI32, enumTagOffset)
+		fc.i32Const(int64(info.tag))
+		fc.body = append(fc.body, opI32Eq)
+		fc.body = append(fc.body, opIf, bt)
+		fc.blockDepth++
+		opened++
+
+		for i, name := range arm.Pattern.Bindings {
+			if i >= len(info.fields) {
+				break
+			}
+			vtype := typeForIR(info.fields[i])
+			idx := fc.allocLocal(name, vtype)
+			fc.localGet(scrut)
+			fc.load(vtype, enumPayloadOffset+i*slotSize)
+			fc.localSet(idx)
+		}
+
+		fc.compileArmBody(arm.Body, bt)
+		fc.body = append(fc.body, opElse)
+	}
+
+	if !exhaustive {
+		// The checker guarantees exhaustiveness; reaching here is a bug
+		fc.body = append(fc.body, opUnreachable)
+	}
+	for ; opened > 0; opened-- {
+		fc.body = append(fc.body, opEnd)
+		fc.blockDepth--
+	}
+}
+
+// compileArmBody compiles a match arm, dropping its value in statement position.
+func (fc *funcCompiler) compileArmBody(body ir.Expr, bt byte) {
+	fc.compileExpr(body)
+	if bt == blockVoid {
+		if t := body.ExprType(); t != nil && t.Name != "Void" {
+			fc.body = append(fc.body, opDrop)
+		}
+	}
+}
+
+// compileTryExpr unwraps Ok/Some or returns the Err/None value unchanged.
+func (fc *funcCompiler) compileTryExpr(e *ir.TryExpr) {
+	tmp := fc.allocAnon(valI32)
+	fc.compileExpr(e.Expr)
+	fc.localSet(tmp)
+
+	fc.localGet(tmp)
+	fc.load(valI32, enumTagOffset)
+	fc.body = append(fc.body, opIf, blockVoid)
+	fc.blockDepth++
+	fc.emitReturn(func() { fc.localGet(tmp) })
+	fc.body = append(fc.body, opEnd)
+	fc.blockDepth--
+
+	fc.localGet(tmp)
+	fc.load(typeForIR(e.Type), enumPayloadOffset)
+}
+
+// --- Arrays ---
+
+// compileArrayLit allocates an array and stores each element in its slot.
+func (fc *funcCompiler) compileArrayLit(e *ir.ArrayLit) {
+	tmp := fc.allocAnon(valI32)
+	fc.i32Const(int64(len(e.Elements)))
+	fc.call(fc.gen.runtimeFunc(rtArrayNew))
+	fc.localSet(tmp)
+
+	for i, el := range e.Elements {
+		fc.localGet(tmp)
+		fc.load(valI32, arrayDataOffset)
+		fc.compileExpr(el)
+		fc.store(typeForIR(el.ExprType()), i*slotSize)
+	}
+	fc.localGet(tmp)
+}
+
+// compileElementAddr pushes the address of an array element, trapping when
+// the index is out of bounds.
+func (fc *funcCompiler) compileElementAddr(e *ir.IndexExpr) {
+	fc.compileExpr(e.Object)
+	fc.compileExpr(e.Index)
+	fc.call(fc.gen.runtimeFunc(rtArraySlot))
+}
+
+// --- Strings ---
+
+// compileStringInterp converts each part to a string and concatenates them.
+func (fc *funcCompiler) compileStringInterp(e *ir.StringInterp) {
+	first := true
+	for _, part := range e.Parts {
+		if part.IsExpr {
+			fc.compileToString(part.Expr)
+		} else {
+			if part.Static == "" {
+				continue
+			}
+			fc.stringConst(part.Static)
+		}
+		if !first {
+			fc.call(fc.gen.runtimeFunc(rtStrConcat))
+		}
+		first = false
+	}
+	if first {
+		fc.stringConst("")
+	}
+}
+
+// compileToString pushes the string form of a value, as Display would print it.
+func (fc *funcCompiler) compileToString(expr ir.Expr) {
+	t := expr.ExprType()
+	name := ""
+	if t != nil {
+		name = t.Name
+	}
+	switch name {
+	case "String":
+		fc.compileExpr(expr)
+	case "Int":
+		fc.compileExpr(expr)
+		fc.call(fc.gen.runtimeFunc(rtIntToStr))
+	case "Float":
+		fc.compileExpr(expr)
+		fc.call(fc.gen.runtimeFunc(rtFloatToStr))
+	case "Bool":
+		fc.compileExpr(expr)
+		fc.body = append(fc.body, opIf, blockI32)
+		fc.stringConst("true")
+		fc.body = append(fc.body, opElse)
+		fc.stringConst("false")
+		fc.body = append(fc.body, opEnd)
+	default:
+		fc.compileExpr(expr)
+		fc.body = append(fc.body, opDrop)
+		fc.stringConst(name)
+	}
+}
+
+// stringConst pushes a pointer to a static string.
+func (fc *funcCompiler) stringConst(s string) {
+	offset, _ := fc.gen.addStringData(s)
+	fc.i32Const(int64(offset))
+}
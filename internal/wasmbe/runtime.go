@@ -0,0 +1,616 @@
+package wasmbe
+
+// Runtime helpers are small WASM functions emitted on first use. They
+// implement allocation and the string, array and map operations that are too
+// long to inline at every use site.
+const (
+	rtAlloc      = "__alloc"        // (size i32) -> ptr i32
+	rtMemcpy     = "__memcpy"       // (dst i32, src i32, n i32)
+	rtStrConcat  = "__str_concat"   // (a i32, b i32) -> i32
+	rtStrEq      = "__str_eq"       // (a i32, b i32) -> i32
+	rtIntToStr   = "__int_to_str"   // (v i64) -> i32
+	rtFloatToStr = "__float_to_str" // (v f64) -> i32
+	rtArrayNew   = "__array_new"    // (len i32) -> i32
+	rtArrayPush  = "__array_push"   // (arr i32) -> slot address i32
+	rtArraySlot  = "__array_slot"   // (arr i32, index i64) -> slot address i32
+	rtStrLt      = "__str_lt"       // (a i32, b i32) -> i32
+	rtMapNew     = "__map_new"      // (strKeys i32) -> i32
+	rtMapHash    = "__map_hash"     // (m i32, key i64) -> bucket i32
+	rtMapFind    = "__map_find"     // (m i32, key i64) -> entry address i32, 0 if absent
+	rtMapProbe   = "__map_probe"    // (m i32, key i64) -> free entry address i32
+	rtMapInsert  = "__map_insert"   // (m i32, key i64) -> value slot address i32
+	rtMapRemove  = "__map_remove"   // (m i32, key i64)
+	rtMapEntries = "__map_entries"  // (m i32) -> array of entry addresses i32
+	rtMapKeys    = "__map_keys"     // (m i32) -> i32
+	rtMapValues  = "__map_values"   // (m i32) -> i32
+)
+
+// heapGlobal is the index of the global holding the next free heap address.
+const heapGlobal = 0
+
+// runtimeSig returns the signature of a runtime helper.
+func runtimeSig(name string) (params, results []byte) {
+	switch name {
+	case rtAlloc:
+		return []byte{valI32}, []byte{valI32}
+	case rtMemcpy:
+		return []byte{valI32, valI32, valI32}, nil
+	case rtStrConcat, rtStrEq, rtStrLt:
+		return []byte{valI32, valI32}, []byte{valI32}
+	case rtIntToStr:
+		return []byte{valI64}, []byte{valI32}
+	case rtFloatToStr:
+		return []byte{valF64}, []byte{valI32}
+	case rtArrayNew, rtArrayPush:
+		return []byte{valI32}, []byte{valI32}
+	case rtArraySlot, rtMapHash, rtMapFind, rtMapProbe, rtMapInsert:
+		return []byte{valI32, valI64}, []byte{valI32}
+	case rtMapRemove:
+		return []byte{valI32, valI64}, nil
+	case rtMapNew, rtMapEntries, rtMapKeys, rtMapValues:
+		return []byte{valI32}, []byte{valI32}
+	}
+	return nil, nil
+}
+
+// runtimeFunc returns the function index of a runtime helper, emitting it
+// the first time it is needed.
+func (g *generator) runtimeFunc(name string) int {
+	if idx, ok := g.runtime[name]; ok {
+		return idx
+	}
+	params, results := runtimeSig(name)
+	idx := g.declareFunc(name, params, results, false)
+	g.runtime[name] = idx
+
+	fc := &funcCompiler{
+		gen:        g,
+		localCount: len(params),
+		localMap:   make(map[string]int),
+		selfIdx:    -1,
+		resultIdx:  -1,
+	}
+	switch name {
+	case rtAlloc:
+		fc.buildAlloc()
+	case rtMemcpy:
+		fc.buildMemcpy()
+	case rtStrConcat:
+		fc.buildStrConcat()
+	case rtStrEq:
+		fc.buildStrEq()
+	case rtIntToStr:
+		fc.buildIntToStr()
+	case rtFloatToStr:
+		fc.buildFloatToStr()
+	case rtArrayNew:
+		fc.buildArrayNew()
+	case rtArrayPush:
+		fc.buildArrayPush()
+	case rtArraySlot:
+		fc.buildArraySlot()
+	case rtStrLt:
+		fc.buildStrLt()
+	case rtMapNew:
+		fc.buildMapNew()
+	case rtMapHash:
+		fc.buildMapHash()
+	case rtMapFind:
+		fc.buildMapFind()
+	case rtMapProbe:
+		fc.buildMapProbe()
+	case rtMapInsert:
+		fc.buildMapInsert()
+	case rtMapRemove:
+		fc.buildMapRemove()
+	case rtMapEntries:
+		fc.buildMapEntries()
+	case rtMapKeys:
+		fc.buildMapProject(mapKeyOffset)
+	case rtMapValues:
+		fc.buildMapProject(mapValueOffset)
+	}
+	g.setCode(idx, fc.finish())
+	return idx
+}
+
+// buildAlloc bumps the heap pointer by size (rounded up to 8 bytes), growing
+// memory when needed and trapping when it cannot grow.
+func (fc *funcCompiler) buildAlloc() {
+	fc.gen.usesHeap = true
+	const size = 0
+	ptr := fc.allocAnon(valI32)
+	end := fc.allocAnon(valI32)
+
+	fc.body = append(fc.body, opGlobalGet)
+	fc.body = append(fc.body, encodeLEB128U(heapGlobal)...)
+	fc.localSet(ptr)
+
+	// end = (ptr + size + 7) & ~7
+	fc.localGet(ptr)
+	fc.localGet(size)
+	fc.body = append(fc.body, opI32Add)
+	fc.i32Const(7)
+	fc.body = append(fc.body, opI32Add)
+	fc.i32Const(-8)
+	fc.body = append(fc.body, opI32And)
+	fc.localSet(end)
+
+	// if end > memory.size * 64KB, grow by the missing pages
+	fc.body = append(fc.body, opBlock, blockVoid)
+	fc.localGet(end)
+	fc.body = append(fc.body, opMemorySize, 0x00)
+	fc.i32Const(16)
+	fc.body = append(fc.body, opI32Shl, opI32LeU)
+	fc.body = append(fc.body, opBrIf, 0)
+	fc.localGet(end)
+	fc.i32Const(wasmPageSize - 1)
+	fc.body = append(fc.body, opI32Add)
+	fc.i32Const(16)
+	fc.body = append(fc.body, opI32ShrU)
+	fc.body = append(fc.body, opMemorySize, 0x00)
+	fc.body = append(fc.body, opI32Sub)
+	fc.body = append(fc.body, opMemoryGrow, 0x00)
+	fc.i32Const(-1)
+	fc.body = append(fc.body, opI32Eq)
+	fc.body = append(fc.body, opIf, blockVoid, opUnreachable, opEnd)
+	fc.body = append(fc.body, opEnd)
+
+	fc.localGet(end)
+	fc.body = append(fc.body, opGlobalSet)
+	fc.body = append(fc.body, encodeLEB128U(heapGlobal)...)
+	fc.localGet(ptr)
+}
+
+// buildMemcpy copies n bytes from src to dst, one byte at a time.
+func (fc *funcCompiler) buildMemcpy() {
+	const dst, src, n = 0, 1, 2
+	i := fc.allocAnon(valI32)
+
+	fc.body = append(fc.body, opBlock, blockVoid, opLoop, blockVoid)
+	fc.localGet(i)
+	fc.localGet(n)
+	fc.body = append(fc.body, opI32GeU, opBrIf, 1)
+	fc.localGet(dst)
+	fc.localGet(i)
+	fc.body = append(fc.body, opI32Add)
+	fc.localGet(src)
+	fc.localGet(i)
+	fc.body = append(fc.body, opI32Add)
+	fc.loadByte(0)
+	fc.storeByte(0)
+	fc.localGet(i)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(i)
+	fc.body = append(fc.body, opBr, 0, opEnd, opEnd)
+}
+
+// buildStrConcat allocates a new string holding a followed by b.
+func (fc *funcCompiler) buildStrConcat() {
+	const a, b = 0, 1
+	la := fc.allocAnon(valI32)
+	lb := fc.allocAnon(valI32)
+	p := fc.allocAnon(valI32)
+
+	fc.localGet(a)
+	fc.load(valI32, 0)
+	fc.localSet(la)
+	fc.localGet(b)
+	fc.load(valI32, 0)
+	fc.localSet(lb)
+
+	// p = alloc(4 + la + lb); p.len = la + lb
+	fc.localGet(la)
+	fc.localGet(lb)
+	fc.body = append(fc.body, opI32Add)
+	fc.i32Const(4)
+	fc.body = append(fc.body, opI32Add)
+	fc.call(fc.gen.runtimeFunc(rtAlloc))
+	fc.localSet(p)
+	fc.localGet(p)
+	fc.localGet(la)
+	fc.localGet(lb)
+	fc.body = append(fc.body, opI32Add)
+	fc.store(valI32, 0)
+
+	memcpy := fc.gen.runtimeFunc(rtMemcpy)
+	// memcpy(p + 4, a + 4, la)
+	fc.localGet(p)
+	fc.i32Const(4)
+	fc.body = append(fc.body, opI32Add)
+	fc.localGet(a)
+	fc.i32Const(4)
+	fc.body = append(fc.body, opI32Add)
+	fc.localGet(la)
+	fc.call(memcpy)
+	// memcpy(p + 4 + la, b + 4, lb)
+	fc.localGet(p)
+	fc.i32Const(4)
+	fc.body = append(fc.body, opI32Add)
+	fc.localGet(la)
+	fc.body = append(fc.body, opI32Add)
+	fc.localGet(b)
+	fc.i32Const(4)
+	fc.body = append(fc.body, opI32Add)
+	fc.localGet(lb)
+	fc.call(memcpy)
+
+	fc.localGet(p)
+}
+
+// buildStrEq compares two strings byte by byte.
+func (fc *funcCompiler) buildStrEq() {
+	const a, b = 0, 1
+	n := fc.allocAnon(valI32)
+	i := fc.allocAnon(valI32)
+
+	// lengths differ => 0
+	fc.localGet(a)
+	fc.load(valI32, 0)
+	fc.localTee(n)
+	fc.localGet(b)
+	fc.load(valI32, 0)
+	fc.body = append(fc.body, opI32Ne, opIf, blockVoid)
+	fc.i32Const(0)
+	fc.body = append(fc.body, opReturn, opEnd)
+
+	fc.body = append(fc.body, opBlock, blockVoid, opLoop, blockVoid)
+	fc.localGet(i)
+	fc.localGet(n)
+	fc.body = append(fc.body, opI32GeU, opBrIf, 1)
+	fc.localGet(a)
+	fc.localGet(i)
+	fc.body = append(fc.body, opI32Add)
+	fc.loadByte(4)
+	fc.localGet(b)
+	fc.localGet(i)
+	fc.body = append(fc.body, opI32Add)
+	fc.loadByte(4)
+	fc.body = append(fc.body, opI32Ne, opIf, blockVoid)
+	fc.i32Const(0)
+	fc.body = append(fc.body, opReturn, opEnd)
+	fc.localGet(i)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(i)
+	fc.body = append(fc.body, opBr, 0, opEnd, opEnd)
+
+	fc.i32Const(1)
+}
+
+// buildIntToStr formats a signed integer in decimal.
+func (fc *funcCompiler) buildIntToStr() {
+	const v = 0
+	neg := fc.allocAnon(valI32)
+	u := fc.allocAnon(valI64)
+	t := fc.allocAnon(valI64)
+	n := fc.allocAnon(valI32)
+	p := fc.allocAnon(valI32)
+	q := fc.allocAnon(valI32)
+
+	// neg = v < 0; u = |v| (as unsigned, so the minimum value works)
+	fc.localGet(v)
+	fc.i64Const(0)
+	fc.body = append(fc.body, opI64LtS)
+	fc.localSet(neg)
+	fc.i64Const(0)
+	fc.localGet(v)
+	fc.body = append(fc.body, opI64Sub)
+	fc.localGet(v)
+	fc.localGet(neg)
+	fc.body = append(fc.body, opSelect)
+	fc.localSet(u)
+
+	// n = number of digits
+	fc.i32Const(1)
+	fc.localSet(n)
+	fc.localGet(u)
+	fc.localSet(t)
+	fc.body = append(fc.body, opBlock, blockVoid, opLoop, blockVoid)
+	fc.localGet(t)
+	fc.i64Const(10)
+	fc.body = append(fc.body, opI64DivU)
+	fc.localTee(t)
+	fc.body = append(fc.body, opI64Eqz, opBrIf, 1)
+	fc.localGet(n)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(n)
+	fc.body = append(fc.body, opBr, 0, opEnd, opEnd)
+	fc.localGet(n)
+	fc.localGet(neg)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(n)
+
+	// p = alloc(4 + n); p.len = n
+	fc.localGet(n)
+	fc.i32Const(4)
+	fc.body = append(fc.body, opI32Add)
+	fc.call(fc.gen.runtimeFunc(rtAlloc))
+	fc.localSet(p)
+	fc.localGet(p)
+	fc.localGet(n)
+	fc.store(valI32, 0)
+
+	// write digits backwards from the end
+	fc.localGet(p)
+	fc.i32Const(4)
+	fc.body = append(fc.body, opI32Add)
+	fc.localGet(n)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(q)
+	fc.body = append(fc.body, opLoop, blockVoid)
+	fc.localGet(q)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Sub)
+	fc.localTee(q)
+	fc.localGet(u)
+	fc.i64Const(10)
+	fc.body = append(fc.body, opI64RemU, opI32WrapI64)
+	fc.i32Const('0')
+	fc.body = append(fc.body, opI32Add)
+	fc.storeByte(0)
+	fc.localGet(u)
+	fc.i64Const(10)
+	fc.body = append(fc.body, opI64DivU)
+	fc.localTee(u)
+	fc.body = append(fc.body, opI64Eqz, opI32Eqz, opBrIf, 0, opEnd)
+
+	fc.localGet(neg)
+	fc.body = append(fc.body, opIf, blockVoid)
+	fc.localGet(p)
+	fc.i32Const('-')
+	fc.storeByte(4)
+	fc.body = append(fc.body, opEnd)
+
+	fc.localGet(p)
+}
+
+// buildFloatToStr formats a float as its integer part followed by up to six
+// fractional digits with trailing zeros removed, so 3.0 prints as "3" and
+// 2.50 as "2.5" like Rust's Display. Values needing more precision are
+// rounded to six digits.
+func (fc *funcCompiler) buildFloatToStr() {
+	const v = 0
+	neg := fc.allocAnon(valI32)
+	a := fc.allocAnon(valF64)
+	ip := fc.allocAnon(valI64)
+	frac := fc.allocAnon(valI64)
+	width := fc.allocAnon(valI32)
+	p := fc.allocAnon(valI32)
+	q := fc.allocAnon(valI32)
+	s := fc.allocAnon(valI32)
+
+	fc.localGet(v)
+	fc.body = append(fc.body, opF64Const)
+	fc.body = append(fc.body, encodeF64(0)...)
+	fc.body = append(fc.body, opF64Lt)
+	fc.localSet(neg)
+	fc.localGet(v)
+	fc.body = append(fc.body, opF64Abs)
+	fc.localSet(a)
+
+	// ip = trunc(a); frac = round((a - ip) * 1e6)
+	fc.localGet(a)
+	fc.body = append(fc.body, opMiscPrefix, opI64TruncSatF64S)
+	fc.localSet(ip)
+	fc.localGet(a)
+	fc.localGet(ip)
+	fc.body = append(fc.body, opF64ConvertI64, opF64Sub)
+	fc.body = append(fc.body, opF64Const)
+	fc.body = append(fc.body, encodeF64(1e6)...)
+	fc.body = append(fc.body, opF64Mul, opF64Nearest)
+	fc.body = append(fc.body, opMiscPrefix, opI64TruncSatF64S)
+	fc.localSet(frac)
+
+	// rounding carried into the integer part
+	fc.localGet(frac)
+	fc.i64Const(1000000)
+	fc.body = append(fc.body, opI64GeS, opIf, blockVoid)
+	fc.localGet(ip)
+	fc.i64Const(1)
+	fc.body = append(fc.body, opI64Add)
+	fc.localSet(ip)
+	fc.localGet(frac)
+	fc.i64Const(1000000)
+	fc.body = append(fc.body, opI64Sub)
+	fc.localSet(frac)
+	fc.body = append(fc.body, opEnd)
+
+	concat := fc.gen.runtimeFunc(rtStrConcat)
+	fc.localGet(ip)
+	fc.call(fc.gen.runtimeFunc(rtIntToStr))
+	fc.localSet(s)
+	fc.localGet(neg)
+	fc.body = append(fc.body, opIf, blockVoid)
+	fc.stringConst("-")
+	fc.localGet(s)
+	fc.call(concat)
+	fc.localSet(s)
+	fc.body = append(fc.body, opEnd)
+
+	fc.localGet(frac)
+	fc.body = append(fc.body, opI64Eqz, opIf, blockVoid)
+	fc.localGet(s)
+	fc.body = append(fc.body, opReturn, opEnd)
+
+	// drop trailing zeros
+	fc.i32Const(6)
+	fc.localSet(width)
+	fc.body = append(fc.body, opBlock, blockVoid, opLoop, blockVoid)
+	fc.localGet(frac)
+	fc.i64Const(10)
+	fc.body = append(fc.body, opI64RemU, opI64Eqz, opI32Eqz, opBrIf, 1)
+	fc.localGet(frac)
+	fc.i64Const(10)
+	fc.body = append(fc.body, opI64DivU)
+	fc.localSet(frac)
+	fc.localGet(width)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Sub)
+	fc.localSet(width)
+	fc.body = append(fc.body, opBr, 0, opEnd, opEnd)
+
+	// p = "." followed by width zero-padded digits
+	fc.localGet(width)
+	fc.i32Const(5)
+	fc.body = append(fc.body, opI32Add)
+	fc.call(fc.gen.runtimeFunc(rtAlloc))
+	fc.localSet(p)
+	fc.localGet(p)
+	fc.localGet(width)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.store(valI32, 0)
+	fc.localGet(p)
+	fc.i32Const('.')
+	fc.storeByte(4)
+	fc.localGet(p)
+	fc.i32Const(5)
+	fc.body = append(fc.body, opI32Add)
+	fc.localGet(width)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(q)
+	fc.body = append(fc.body, opBlock, blockVoid, opLoop, blockVoid)
+	fc.localGet(width)
+	fc.body = append(fc.body, opI32Eqz, opBrIf, 1)
+	fc.localGet(q)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Sub)
+	fc.localTee(q)
+	fc.localGet(frac)
+	fc.i64Const(10)
+	fc.body = append(fc.body, opI64RemU, opI32WrapI64)
+	fc.i32Const('0')
+	fc.body = append(fc.body, opI32Add)
+	fc.storeByte(0)
+	fc.localGet(frac)
+	fc.i64Const(10)
+	fc.body = append(fc.body, opI64DivU)
+	fc.localSet(frac)
+	fc.localGet(width)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Sub)
+	fc.localSet(width)
+	fc.body = append(fc.body, opBr, 0, opEnd, opEnd)
+
+	fc.localGet(s)
+	fc.localGet(p)
+	fc.call(concat)
+}
+
+// buildArrayNew allocates an array header and room for at least len elements.
+func (fc *funcCompiler) buildArrayNew() {
+	const n = 0
+	capacity := fc.allocAnon(valI32)
+	arr := fc.allocAnon(valI32)
+
+	// capacity = max(n, 4)
+	fc.localGet(n)
+	fc.i32Const(4)
+	fc.localGet(n)
+	fc.i32Const(4)
+	fc.body = append(fc.body, opI32GtU, opSelect)
+	fc.localSet(capacity)
+
+	fc.i32Const(arrayHeaderSize)
+	fc.call(fc.gen.runtimeFunc(rtAlloc))
+	fc.localSet(arr)
+	fc.localGet(arr)
+	fc.localGet(n)
+	fc.store(valI32, arrayLenOffset)
+	fc.localGet(arr)
+	fc.localGet(capacity)
+	fc.store(valI32, arrayCapOffset)
+	fc.localGet(arr)
+	fc.localGet(capacity)
+	fc.i32Const(slotSize)
+	fc.body = append(fc.body, opI32Mul)
+	fc.call(fc.gen.runtimeFunc(rtAlloc))
+	fc.store(valI32, arrayDataOffset)
+
+	fc.localGet(arr)
+}
+
+// buildArrayPush appends an empty slot, doubling the capacity when full, and
+// returns the slot's address for the caller to store into.
+func (fc *funcCompiler) buildArrayPush() {
+	const arr = 0
+	length := fc.allocAnon(valI32)
+	capacity := fc.allocAnon(valI32)
+	data := fc.allocAnon(valI32)
+	grown := fc.allocAnon(valI32)
+
+	fc.localGet(arr)
+	fc.load(valI32, arrayLenOffset)
+	fc.localSet(length)
+	fc.localGet(arr)
+	fc.load(valI32, arrayCapOffset)
+	fc.localSet(capacity)
+	fc.localGet(arr)
+	fc.load(valI32, arrayDataOffset)
+	fc.localSet(data)
+
+	fc.localGet(length)
+	fc.localGet(capacity)
+	fc.body = append(fc.body, opI32GeU, opIf, blockVoid)
+	// capacity = capacity * 2 + 4
+	fc.localGet(capacity)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Shl)
+	fc.i32Const(4)
+	fc.body = append(fc.body, opI32Add)
+	fc.localSet(capacity)
+	fc.localGet(capacity)
+	fc.i32Const(slotSize)
+	fc.body = append(fc.body, opI32Mul)
+	fc.call(fc.gen.runtimeFunc(rtAlloc))
+	fc.localSet(grown)
+	fc.localGet(grown)
+	fc.localGet(data)
+	fc.localGet(length)
+	fc.i32Const(slotSize)
+	fc.body = append(fc.body, opI32Mul)
+	fc.call(fc.gen.runtimeFunc(rtMemcpy))
+	fc.localGet(grown)
+	fc.localSet(data)
+	fc.localGet(arr)
+	fc.localGet(data)
+	fc.store(valI32, arrayDataOffset)
+	fc.localGet(arr)
+	fc.localGet(capacity)
+	fc.store(valI32, arrayCapOffset)
+	fc.body = append(fc.body, opEnd)
+
+	fc.localGet(arr)
+	fc.localGet(length)
+	fc.i32Const(1)
+	fc.body = append(fc.body, opI32Add)
+	fc.store(valI32, arrayLenOffset)
+
+	fc.localGet(data)
+	fc.localGet(length)
+	fc.i32Const(slotSize)
+	fc.body = append(fc.body, opI32Mul, opI32Add)
+}
+
+// buildArraySlot returns the address of element index, trapping when the
+// index is negative or not below the length.
+func (fc *funcCompiler) buildArraySlot() {
+	const arr, index = 0, 1
+
+	// unsigned comparison also rejects negative indices
+	fc.localGet(index)
+	fc.localGet(arr)
+	fc.load(valI32, arrayLenOffset)
+	fc.body = append(fc.body, opI64ExtendI32U, opI64GeU)
+	fc.body = append(fc.body, opIf, blockVoid, opUnreachable, opEnd)
+
+	fc.localGet(arr)
+	fc.load(valI32, arrayDataOffset)
+	fc.localGet(index)
+	fc.body = append(fc.body, opI32WrapI64)
+	fc.i32Const(slotSize)
+	fc.body = append(fc.body, opI32Mul, opI32Add)
+}
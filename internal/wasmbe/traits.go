@@ -0,0 +1,85 @@
+package wasmbe
+
+import (
+	"github.com/lhaig/intent/internal/ir"
+)
+
+// A trait value points at a pair of the implementing entity's id and the
+// object itself (see memory.go). Each trait method gets a dispatch function
+// taking the trait value and the method's arguments, which compares the id
+// against every entity implementing the trait and calls that entity's
+// method:
+//
+//	if (id == A) { return A.m(object, args) } if (id == B) { ... } unreachable
+
+// traitLayout holds the dispatch function of each method of a trait.
+type traitLayout struct {
+	methods map[string]int // method name -> dispatch function index
+}
+
+// declareTrait declares the dispatch functions of a trait's methods.
+func (g *generator) declareTrait(prefix string, t *ir.Trait) {
+	layout := &traitLayout{methods: make(map[string]int)}
+	for _, m := range t.Methods {
+		self := []byte{valI32}
+		layout.methods[m.Name] = g.declareFunc(prefix+t.Name+"."+m.Name, paramTypes(self, m.Params), resultTypes(m.ReturnType), false)
+	}
+	g.traits[t.Name] = layout
+}
+
+// compileTraitDispatch compiles the dispatch functions of a trait's methods.
+// Every entity is declared by now, whichever module it is in.
+func (g *generator) compileTraitDispatch(prefix string, t *ir.Trait) {
+	layout := g.traits[t.Name]
+	for _, m := range t.Methods {
+		fc := newFuncCompiler(g, prefix, m.Params, 1)
+		for _, ent := range g.entityOrder {
+			idx, ok := ent.methods[m.Name]
+			if !ok || !implements(ent, t.Name) {
+				continue
+			}
+			fc.localGet(0)
+			fc.load(valI32, traitEntityOffset)
+			fc.i32Const(int64(ent.id))
+			fc.body = append(fc.body, opI32Eq, opIf, blockVoid)
+			fc.localGet(0)
+			fc.load(valI32, traitObjectOffset)
+			for i := range m.Params {
+				fc.localGet(1 + i)
+			}
+			fc.call(idx)
+			fc.body = append(fc.body, opReturn, opEnd)
+		}
+		fc.body = append(fc.body, opUnreachable)
+		g.setCode(layout.methods[m.Name], fc.finish())
+	}
+}
+
+// compileUpcast wraps an entity value in a trait value.
+func (fc *funcCompiler) compileUpcast(e *ir.UpcastExpr) {
+	id := 0
+	if t := e.Value.ExprType(); t != nil {
+		if ent, ok := fc.gen.entities[t.Name]; ok {
+			id = ent.id
+		}
+	}
+	tmp := fc.allocAnon(valI32)
+	fc.i32Const(traitValueSize)
+	fc.call(fc.gen.runtimeFunc(rtAlloc))
+	fc.localTee(tmp)
+	fc.i32Const(int64(id))
+	fc.store(valI32, traitEntityOffset)
+	fc.localGet(tmp)
+	fc.compileExpr(e.Value)
+	fc.store(valI32, traitObjectOffset)
+	fc.localGet(tmp)
+}
+
+func implements(ent *entityLayout, trait string) bool {
+	for _, name := range ent.implements {
+		if name == trait {
+			return true
+		}
+	}
+	return false
+}
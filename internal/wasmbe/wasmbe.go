@@ -1,8 +1,19 @@
 // Package wasmbe generates WASM binary format directly from IR,
 // without going through an intermediate Rust representation.
+//
+// Values that do not fit in a WASM value type (strings, entities, enums and
+// arrays) live in linear memory and are passed around as i32 pointers. See
+// memory.go for the layouts and runtime.go for the helper functions that
+// operate on them.
+//
+// Contracts are enforced at runtime like in the Rust and JS backends. A failed
+// check calls the imported env.contract_violation(kind, msg_ptr, msg_len) and
+// then traps; see contracts.go for the kind codes. print calls host imports
+// described in host.go. Modules without contracts or print import nothing.
 package wasmbe
 
 import (
+	"encoding/binary"
 	"strconv"
 
 	"github.com/lhaig/intent/internal/checker"
@@ -10,18 +21,48 @@ import (
 	"github.com/lhaig/intent/internal/lexer"
 )
 
+// Options configures code generation. The zero value selects the defaults.
+type Options struct {
+	// DebugContracts puts contract checks behind the exported mutable i32
+	// global __intent_contracts, so hosts can switch them off at runtime by
+	// setting it to 0. Clauses marked @always_check always run.
+	DebugContracts bool
+}
+
 // Generate produces a WASM binary module from a single IR module.
 func Generate(mod *ir.Module) []byte {
+	return GenerateWith(mod, Options{})
+}
+
+// GenerateWith produces a WASM binary module from a single IR module using
+// the given options.
+func GenerateWith(mod *ir.Module, opts Options) []byte {
 	g := newGenerator()
-	g.addModule(mod)
+	g.debugContracts = opts.DebugContracts
+	g.declareImports([]*ir.Module{mod})
+	g.declareModule(mod)
+	g.compileModule(mod)
 	return g.emit()
 }
 
 // GenerateAll produces a WASM binary module from a multi-module program.
 func GenerateAll(prog *ir.Program) []byte {
+	return GenerateAllWith(prog, Options{})
+}
+
+// GenerateAllWith produces a WASM binary module from a multi-module program
+// using the given options.
+func GenerateAllWith(prog *ir.Program, opts Options) []byte {
 	g := newGenerator()
+	g.debugContracts = opts.DebugContracts
+	g.declareImports(prog.Modules)
+	// Declare everything first so calls can refer to functions, constructors
+	// and methods regardless of declaration order.
+	for _, mod := range prog.Modules {
+		g.declareModule(mod)
+	}
 	for _, mod := range prog.Modules {
-		g.addModule(mod)
+		g.compileModule(mod)
 	}
 	return g.emit()
 }
@@ -40,17 +81,35 @@ type localVar struct {
 
 // generator builds a WASM binary module.
 type generator struct {
-	types     []funcSig       // type section entries
-	typeCache map[string]int  // sig string -> type index
-	funcs     []int           // function section: type index per function
-	exports   []wasmExport    // export section entries
-	codes     [][]byte        // code section: encoded function bodies
-	funcIndex map[string]int  // function name -> function index
-	dataSegs  []dataSeg       // data section entries
-	dataOff   int             // next free offset in linear memory
-	entryFunc string          // entry function name
-	isEntry   bool            // whether this module has an entry point
-	mangledFn map[string]bool // track mangled function names for multi-module
+	types          []funcSig                // type section entries
+	typeCache      map[string]int           // sig string -> type index
+	imports        []wasmImport             // import section entries (first in the function index space)
+	funcs          []int                    // function section: type index per defined function
+	exports        []wasmExport             // export section entries
+	codes          [][]byte                 // code section: encoded function bodies, parallel to funcs
+	funcIndex      map[string]int           // function name -> function index
+	dataSegs       []dataSeg                // data section entries
+	dataOff        int                      // next free offset in linear memory
+	strings        map[string]int           // string literal -> data offset
+	entryFunc      string                   // entry function name
+	isEntry        bool                     // whether this module has an entry point
+	mangledFn      map[string]bool          // track mangled function names for multi-module
+	entities       map[string]*entityLayout // entity name -> memory layout and functions
+	entityOrder    []*entityLayout          // entities in declaration order
+	traits         map[string]*traitLayout  // trait name -> method dispatch functions
+	enums          map[string]*ir.Enum      // enum name -> declaration
+	runtime        map[string]int           // runtime helper name -> function index
+	usesHeap       bool                     // whether the bump allocator is needed
+	violation      int                      // env.contract_violation function index, -1 if not imported
+	debugContracts bool                     // guard contract checks with the contracts global
+	usesContracts  bool                     // whether any check reads the contracts global
+	print          printImports             // env.print_* function indices
+}
+
+type wasmImport struct {
+	module string
+	name   string
+	tidx   int
 }
 
 type wasmExport struct {
@@ -69,6 +128,13 @@ func newGenerator() *generator {
 		typeCache: make(map[string]int),
 		funcIndex: make(map[string]int),
 		mangledFn: make(map[string]bool),
+		strings:   make(map[string]int),
+		entities:  make(map[string]*entityLayout),
+		traits:    make(map[string]*traitLayout),
+		enums:     make(map[string]*ir.Enum),
+		runtime:   make(map[string]int),
+		violation: -1,
+		print:     printImports{i64: -1, f64: -1, str: -1},
 		dataOff:   1024, // start data after a 1KB stack area
 	}
 }
@@ -110,68 +176,158 @@ func typeForIR(t *checker.Type) byte {
 	}
 }
 
-// addModule adds all functions from a module to the generator.
-func (g *generator) addModule(mod *ir.Module) {
+// modulePrefix returns the name prefix for functions of a module.
+func modulePrefix(mod *ir.Module) string {
 	if mod.IsEntry {
-		g.isEntry = true
+		return ""
 	}
+	return mod.Name + "_"
+}
 
-	prefix := ""
-	if !mod.IsEntry {
-		prefix = mod.Name + "_"
+// declareModule registers the functions, entities and enums of a module so
+// that their indices and layouts are known before any body is compiled.
+func (g *generator) declareModule(mod *ir.Module) {
+	if mod.IsEntry {
+		g.isEntry = true
 	}
 
+	prefix := modulePrefix(mod)
+
 	for _, fn := range mod.Functions {
 		name := prefix + fn.Name
 		if fn.IsEntry {
 			name = fn.Name
 			g.entryFunc = name
 		}
-		g.addFunction(name, fn)
+		g.declareFunc(name, paramTypes(nil, fn.Params), resultTypes(fn.ReturnType), true)
+	}
+
+	for _, en := range mod.Enums {
+		g.enums[en.Name] = en
+	}
+
+	for _, t := range mod.Traits {
+		g.declareTrait(prefix, t)
+	}
+
+	for _, ent := range mod.Entities {
+		layout := newEntityLayout(ent)
+		g.entityOrder = append(g.entityOrder, layout)
+		layout.id = len(g.entityOrder)
+		g.entities[ent.Name] = layout
+		if ent.Constructor != nil {
+			layout.ctor = g.declareFunc(prefix+ent.Name+".new", paramTypes(nil, ent.Constructor.Params), []byte{valI32}, false)
+		}
+		for _, m := range ent.Methods {
+			self := []byte{valI32}
+			layout.methods[m.Name] = g.declareFunc(prefix+ent.Name+"."+m.Name, paramTypes(self, m.Params), resultTypes(m.ReturnType), false)
+		}
 	}
 }
 
-// addFunction compiles a single IR function to WASM.
-func (g *generator) addFunction(name string, fn *ir.Function) {
-	// Build parameter types
-	var paramTypes []byte
-	for _, p := range fn.Params {
-		paramTypes = append(paramTypes, typeForIR(p.Type))
+// compileModule compiles the bodies of everything declared by declareModule.
+func (g *generator) compileModule(mod *ir.Module) {
+	prefix := modulePrefix(mod)
+
+	for _, fn := range mod.Functions {
+		name := prefix + fn.Name
+		if fn.IsEntry {
+			name = fn.Name
+		}
+		fc := newFuncCompiler(g, prefix, fn.Params, 0)
+		fc.setReturnType(fn.ReturnType)
+		fc.requires = fn.Requires
+		fc.ensures = fn.Ensures
+		g.setCode(g.funcIndex[name], fc.compileBody(fn.Body))
+	}
+
+	for _, ent := range mod.Entities {
+		layout := g.entities[ent.Name]
+		if ent.Constructor != nil {
+			ctor := ent.Constructor
+			fc := newFuncCompiler(g, prefix, ctor.Params, 0)
+			fc.entity = layout
+			fc.isCtor = true
+			fc.hasResult = true
+			fc.oldCaptures = ctor.OldCaptures
+			fc.requires = ctor.Requires
+			fc.ensures = ctor.Ensures
+			fc.invariants = ent.Invariants
+			g.setCode(layout.ctor, fc.compileBody(ent.Constructor.Body))
+		}
+		for _, m := range ent.Methods {
+			fc := newFuncCompiler(g, prefix, m.Params, 1)
+			fc.entity = layout
+			fc.selfIdx = 0
+			fc.setReturnType(m.ReturnType)
+			fc.oldCaptures = m.OldCaptures
+			fc.requires = m.Requires
+			fc.ensures = m.Ensures
+			fc.invariants = ent.Invariants
+			g.setCode(layout.methods[m.Name], fc.compileBody(m.Body))
+		}
+	}
+
+	for _, t := range mod.Traits {
+		g.compileTraitDispatch(prefix, t)
 	}
+}
 
-	// Build result types
-	var resultTypes []byte
-	if fn.ReturnType != nil && fn.ReturnType.Name != "Void" {
-		resultTypes = append(resultTypes, typeForIR(fn.ReturnType))
+// declareImports imports the host functions the modules need. Imports come
+// first in the function index space, so this runs before any declareFunc.
+func (g *generator) declareImports(mods []*ir.Module) {
+	for _, mod := range mods {
+		if hasRuntimeChecks(mod) {
+			g.violation = g.declareImport("env", "contract_violation", []byte{valI32, valI32, valI32}, nil)
+			break
+		}
 	}
+	g.declarePrintImports(mods)
+}
+
+// declareImport adds an imported function and returns its function index.
+func (g *generator) declareImport(module, name string, params, results []byte) int {
+	idx := len(g.imports)
+	g.imports = append(g.imports, wasmImport{module: module, name: name, tidx: g.typeIndex(params, results)})
+	return idx
+}
 
-	// Get or create type index
-	tidx := g.typeIndex(paramTypes, resultTypes)
+// declareFunc reserves a function index with the given signature. Its code
+// is filled in later with setCode.
+func (g *generator) declareFunc(name string, params, results []byte, export bool) int {
+	tidx := g.typeIndex(params, results)
 
-	// Record function index
-	fidx := len(g.funcs)
+	fidx := len(g.imports) + len(g.funcs)
 	g.funcIndex[name] = fidx
 	g.funcs = append(g.funcs, tidx)
+	g.codes = append(g.codes, nil)
 
-	// Export the function
-	g.exports = append(g.exports, wasmExport{name: name, kind: exportFunc, index: fidx})
-
-	// Compile function body
-	fc := &funcCompiler{
-		gen:        g,
-		fn:         fn,
-		localCount: len(fn.Params),
-		localMap:   make(map[string]int),
-		blockDepth: 0,
+	if export {
+		g.exports = append(g.exports, wasmExport{name: name, kind: exportFunc, index: fidx})
 	}
+	return fidx
+}
+
+// setCode stores the encoded body of a function declared with declareFunc.
+func (g *generator) setCode(fidx int, code []byte) {
+	g.codes[fidx-len(g.imports)] = code
+}
 
-	// Map parameters to local indices
-	for i, p := range fn.Params {
-		fc.localMap[p.Name] = i
+// paramTypes maps IR parameters to WASM value types, after any leading types.
+func paramTypes(leading []byte, params []*ir.Param) []byte {
+	types := append([]byte{}, leading...)
+	for _, p := range params {
+		types = append(types, typeForIR(p.Type))
 	}
+	return types
+}
 
-	body := fc.compileBody()
-	g.codes = append(g.codes, body)
+// resultTypes maps an IR return type to WASM result types.
+func resultTypes(t *checker.Type) []byte {
+	if t == nil || t.Name == "Void" {
+		return nil
+	}
+	return []byte{typeForIR(t)}
 }
 
 // emit produces the complete WASM binary.
@@ -183,12 +339,22 @@ func (g *generator) emit() []byte {
 	// Type section
 	wasm = append(wasm, g.emitTypeSection()...)
 
+	// Import section (host functions)
+	if len(g.imports) > 0 {
+		wasm = append(wasm, g.emitImportSection()...)
+	}
+
 	// Function section
 	wasm = append(wasm, g.emitFunctionSection()...)
 
 	// Memory section (1 page = 64KB)
 	wasm = append(wasm, g.emitMemorySection()...)
 
+	// Global section (heap pointer for the bump allocator, contracts flag)
+	if g.usesHeap || g.usesContracts {
+		wasm = append(wasm, g.emitGlobalSection()...)
+	}
+
 	// Export section
 	wasm = append(wasm, g.emitExportSection()...)
 
@@ -219,6 +385,18 @@ func (g *generator) emitTypeSection() []byte {
 	return encodeSection(sectionType, body)
 }
 
+func (g *generator) emitImportSection() []byte {
+	var contents []byte
+	for _, imp := range g.imports {
+		contents = append(contents, encodeString(imp.module)...)
+		contents = append(contents, encodeString(imp.name)...)
+		contents = append(contents, importFunc)
+		contents = append(contents, encodeLEB128U(uint64(imp.tidx))...)
+	}
+	body := encodeVector(len(g.imports), contents)
+	return encodeSection(sectionImport, body)
+}
+
 func (g *generator) emitFunctionSection() []byte {
 	var contents []byte
 	for _, tidx := range g.funcs {
@@ -229,15 +407,40 @@ func (g *generator) emitFunctionSection() []byte {
 }
 
 func (g *generator) emitMemorySection() []byte {
-	// One memory with initial size of 1 page (64KB), no max
+	// One memory large enough for the static data, at least 1 page (64KB), no max
+	pages := (g.heapStart() + wasmPageSize - 1) / wasmPageSize
+	if pages < 1 {
+		pages = 1
+	}
 	var contents []byte
-	// limits: flags=0 (no max), min=1
 	contents = append(contents, 0x00) // no max flag
-	contents = append(contents, encodeLEB128U(1)...)
+	contents = append(contents, encodeLEB128U(uint64(pages))...)
 	body := encodeVector(1, contents)
 	return encodeSection(sectionMemory, body)
 }
 
+func (g *generator) emitGlobalSection() []byte {
+	// global 0: mutable i32 heap pointer, starting after the static data
+	var contents []byte
+	contents = append(contents, valI32, 0x01) // type i32, mutable
+	contents = append(contents, opI32Const)
+	contents = append(contents, encodeLEB128S(int64(g.heapStart()))...)
+	contents = append(contents, opEnd)
+	n := 1
+	if g.usesContracts {
+		// global 1: mutable i32 contracts flag, starting on
+		contents = append(contents, valI32, 0x01, opI32Const, 1, opEnd)
+		n++
+	}
+	body := encodeVector(n, contents)
+	return encodeSection(sectionGlobal, body)
+}
+
+// heapStart returns the first heap address: the end of static data, 8-byte aligned.
+func (g *generator) heapStart() int {
+	return align8(g.dataOff)
+}
+
 func (g *generator) emitExportSection() []byte {
 	var contents []byte
 	for _, exp := range g.exports {
@@ -250,8 +453,16 @@ func (g *generator) emitExportSection() []byte {
 	contents = append(contents, encodeString("memory")...)
 	contents = append(contents, exportMemory)
 	contents = append(contents, encodeLEB128U(0)...) // memory index 0
+	n := len(g.exports) + 1
+
+	if g.usesContracts {
+		contents = append(contents, encodeString(contractsExport)...)
+		contents = append(contents, exportGlobal)
+		contents = append(contents, encodeLEB128U(contractsGlobal)...)
+		n++
+	}
 
-	body := encodeVector(len(g.exports)+1, contents)
+	body := encodeVector(n, contents)
 	return encodeSection(sectionExport, body)
 }
 
@@ -283,19 +494,28 @@ func (g *generator) emitDataSection() []byte {
 }
 
 // addStringData stores a string in linear memory and returns its (offset, length).
+// The offset points at a 4-byte length header followed by the bytes, which is
+// how every string value is represented at runtime. Identical strings share
+// one segment.
 func (g *generator) addStringData(s string) (int, int) {
-	offset := g.dataOff
-	data := []byte(s)
+	if offset, ok := g.strings[s]; ok {
+		return offset, len(s)
+	}
+	offset := align4(g.dataOff)
+	data := make([]byte, 4, 4+len(s))
+	binary.LittleEndian.PutUint32(data, uint32(len(s)))
+	data = append(data, s...)
 	g.dataSegs = append(g.dataSegs, dataSeg{offset: offset, data: data})
-	g.dataOff += len(data)
-	return offset, len(data)
+	g.dataOff = offset + len(data)
+	g.strings[s] = offset
+	return offset, len(s)
 }
 
 // --- Function compiler ---
 
 type funcCompiler struct {
 	gen        *generator
-	fn         *ir.Function
+	prefix     string // module prefix for resolving unqualified function names
 	localCount int
 	localMap   map[string]int
 	extraTypes []byte // additional local types beyond parameters
@@ -304,6 +524,43 @@ type funcCompiler struct {
 	// Track break/continue labels (block depth at loop entry)
 	loopBreakDepth    int
 	loopContinueDepth int
+	// Entity context for constructors and methods
+	entity     *entityLayout
+	selfIdx    int  // local holding the self pointer, -1 outside entities
+	isCtor     bool // constructors allocate self and return it
+	hasResult  bool // whether the function returns a value
+	resultType byte // WASM type of the return value when hasResult
+	// Contracts enforced at runtime
+	oldCaptures []*ir.OldCapture
+	requires    []*ir.Contract
+	ensures     []*ir.Contract
+	invariants  []*ir.Contract // entity invariants, checked on every return
+	resultIdx   int            // local holding the return value for ensures, -1 if none
+}
+
+// newFuncCompiler creates a compiler for a function whose IR parameters start
+// at local index firstParam (1 for methods, whose local 0 is self).
+func newFuncCompiler(g *generator, prefix string, params []*ir.Param, firstParam int) *funcCompiler {
+	fc := &funcCompiler{
+		gen:        g,
+		prefix:     prefix,
+		localCount: firstParam + len(params),
+		localMap:   make(map[string]int),
+		selfIdx:    -1,
+		resultIdx:  -1,
+	}
+	for i, p := range params {
+		fc.localMap[p.Name] = firstParam + i
+	}
+	return fc
+}
+
+// setReturnType records the function's IR return type.
+func (fc *funcCompiler) setReturnType(t *checker.Type) {
+	if results := resultTypes(t); len(results) > 0 {
+		fc.hasResult = true
+		fc.resultType = results[0]
+	}
 }
 
 // allocLocal allocates a new local variable and returns its index.
@@ -324,12 +581,41 @@ func (fc *funcCompiler) allocAnon(vtype byte) int {
 }
 
 // compileBody compiles the function body and returns the encoded function body bytes.
-func (fc *funcCompiler) compileBody() []byte {
+func (fc *funcCompiler) compileBody(stmts []ir.Stmt) []byte {
+	if fc.isCtor {
+		// self = alloc(entity size)
+		fc.selfIdx = fc.allocLocal("self", valI32)
+		fc.i32Const(int64(fc.entity.size()))
+		fc.call(fc.gen.runtimeFunc(rtAlloc))
+		fc.localSet(fc.selfIdx)
+	}
+	if fc.hasResult && !fc.isCtor && fc.hasPostconditions() {
+		fc.resultIdx = fc.allocAnon(fc.resultType)
+	}
+
+	fc.compilePrologue()
+
 	// Compile statements
-	for _, stmt := range fc.fn.Body {
+	for _, stmt := range stmts {
 		fc.compileStmt(stmt)
 	}
 
+	if fc.isCtor {
+		fc.compilePostconditions()
+		fc.localGet(fc.selfIdx)
+	} else if !fc.hasResult {
+		fc.compilePostconditions()
+	} else {
+		// Every path returns explicitly; this keeps the validator happy when
+		// the last statement is an if/else that returns from both branches.
+		fc.body = append(fc.body, opUnreachable)
+	}
+
+	return fc.finish()
+}
+
+// finish encodes the locals declaration followed by the compiled body.
+func (fc *funcCompiler) finish() []byte {
 	// Ensure body ends with end opcode
 	fc.body = append(fc.body, opEnd)
 
@@ -428,22 +714,29 @@ func (fc *funcCompiler) compileAssignStmt(s *ir.AssignStmt) {
 			fc.body = append(fc.body, encodeLEB128U(uint64(idx))...)
 		}
 	case *ir.FieldAccessExpr:
-		// For entity field assignment via memory store
-		// Simplified: just compile target and value for now
+		// Store into the field slot of the entity
+		layout, offset, vtype := fc.fieldSlot(target)
+		fc.compileExpr(target.Object)
 		fc.compileExpr(s.Value)
-		fc.body = append(fc.body, opDrop)
+		if layout == nil {
+			fc.body = append(fc.body, opDrop, opDrop)
+			return
+		}
+		fc.store(vtype, offset)
 	case *ir.IndexExpr:
-		// Array index assignment
+		// Store into the bounds-checked element slot
+		fc.compileElementAddr(target)
 		fc.compileExpr(s.Value)
-		fc.body = append(fc.body, opDrop)
+		fc.store(typeForIR(s.Value.ExprType()), 0)
 	}
 }
 
 func (fc *funcCompiler) compileReturnStmt(s *ir.ReturnStmt) {
-	if s.Value != nil {
-		fc.compileExpr(s.Value)
+	if s.Value == nil || fc.isCtor {
+		fc.emitReturn(nil)
+		return
 	}
-	fc.body = append(fc.body, opReturn)
+	fc.emitReturn(func() { fc.compileExpr(s.Value) })
 }
 
 func (fc *funcCompiler) compileIfStmt(s *ir.IfStmt) {
@@ -480,6 +773,16 @@ func (fc *funcCompiler) compileWhileStmt(s *ir.WhileStmt) {
 	//     end
 	//   end
 
+	// Loop contracts: capture old() values, check invariants on entry
+	for _, cap := range s.OldCaptures {
+		fc.compileOldCapture(cap)
+	}
+	fc.compileLoopInvariants(s, "at entry")
+	metric := -1
+	if s.Decreases != nil {
+		metric = fc.compileDecreasesEntry(s.Decreases)
+	}
+
 	savedBreak := fc.loopBreakDepth
 	savedContinue := fc.loopContinueDepth
 
@@ -506,6 +809,12 @@ func (fc *funcCompiler) compileWhileStmt(s *ir.WhileStmt) {
 		fc.compileStmt(stmt)
 	}
 
+	// Loop contracts after each iteration
+	fc.compileLoopInvariants(s, "after iteration")
+	if s.Decreases != nil {
+		fc.compileDecreasesStep(s.Decreases, metric)
+	}
+
 	// Branch back to loop start
 	fc.body = append(fc.body, opBr)
 	fc.body = append(fc.body, encodeLEB128U(0)...) // continue = loop label
@@ -525,7 +834,11 @@ func (fc *funcCompiler) compileForInStmt(s *ir.ForInStmt) {
 		fc.compileForRange(s.Variable, rangeExpr, s.Body)
 		return
 	}
-	// For-in over array: not yet implemented in WASM backend
+	if checker.IsMap(s.Iterable.ExprType()) {
+		fc.compileForMap(s)
+		return
+	}
+	fc.compileForArray(s)
 }
 
 func (fc *funcCompiler) compileForRange(varName string, r *ir.RangeExpr, body []ir.Stmt) {
@@ -534,52 +847,116 @@ func (fc *funcCompiler) compileForRange(varName string, r *ir.RangeExpr, body []
 
 	// Initialize: iter = start
 	fc.compileExpr(r.Start)
-	fc.body = append(fc.body, opLocalSet)
-	fc.body = append(fc.body, encodeLEB128U(uint64(iterIdx))...)
+	fc.localSet(iterIdx)
 
 	// Compile end value and store in temp
 	endIdx := fc.allocAnon(valI64)
 	fc.compileExpr(r.End)
-	fc.body = append(fc.body, opLocalSet)
-	fc.body = append(fc.body, encodeLEB128U(uint64(endIdx))...)
+	fc.localSet(endIdx)
+
+	fc.compileCountedLoop(
+		func() {
+			// iter >= end => exit
+			fc.localGet(iterIdx)
+			fc.localGet(endIdx)
+			fc.body = append(fc.body, opI64GeS)
+		},
+		func() {
+			for _, stmt := range body {
+				fc.compileStmt(stmt)
+			}
+		},
+		func() {
+			// iter = iter + 1
+			fc.localGet(iterIdx)
+			fc.i64Const(1)
+			fc.body = append(fc.body, opI64Add)
+			fc.localSet(iterIdx)
+		},
+	)
+}
+
+func (fc *funcCompiler) compileForArray(s *ir.ForInStmt) {
+	arrIdx := fc.allocAnon(valI32)
+	fc.compileExpr(s.Iterable)
+	fc.localSet(arrIdx)
+
+	posIdx := fc.allocAnon(valI32)
+	fc.i32Const(0)
+	fc.localSet(posIdx)
+
+	elemType := elementType(s.Iterable.ExprType())
+	varIdx := fc.allocLocal(s.Variable, typeForIR(elemType))
+
+	fc.compileCountedLoop(
+		func() {
+			// pos >= len => exit
+			fc.localGet(posIdx)
+			fc.localGet(arrIdx)
+			fc.load(valI32, arrayLenOffset)
+			fc.body = append(fc.body, opI32GeU)
+		},
+		func() {
+			// var = data[pos]
+			fc.localGet(arrIdx)
+			fc.load(valI32, arrayDataOffset)
+			fc.localGet(posIdx)
+			fc.i32Const(slotSize)
+			fc.body = append(fc.body, opI32Mul, opI32Add)
+			fc.load(typeForIR(elemType), 0)
+			fc.localSet(varIdx)
+			for _, stmt := range s.Body {
+				fc.compileStmt(stmt)
+			}
+		},
+		func() {
+			// pos = pos + 1
+			fc.localGet(posIdx)
+			fc.i32Const(1)
+			fc.body = append(fc.body, opI32Add)
+			fc.localSet(posIdx)
+		},
+	)
+}
 
+// compileCountedLoop emits a loop whose step runs after every iteration,
+// including ones ended by continue:
+//
+//	block $break
+//	  loop $top
+//	    br_if $break (exit condition)
+//	    block $continue
+//	      ...body...
+//	    end
+//	    ...step...
+//	    br $top
+//	  end
+//	end
+func (fc *funcCompiler) compileCountedLoop(exit, body, step func()) {
 	savedBreak := fc.loopBreakDepth
 	savedContinue := fc.loopContinueDepth
 
-	// block $break
-	fc.body = append(fc.body, opBlock)
-	fc.body = append(fc.body, blockVoid)
+	fc.body = append(fc.body, opBlock, blockVoid)
 	fc.blockDepth++
 	fc.loopBreakDepth = fc.blockDepth
 
-	// loop $continue
-	fc.body = append(fc.body, opLoop)
-	fc.body = append(fc.body, blockVoid)
+	fc.body = append(fc.body, opLoop, blockVoid)
 	fc.blockDepth++
-	fc.loopContinueDepth = fc.blockDepth
 
-	// Check: iter < end
-	fc.body = append(fc.body, opLocalGet)
-	fc.body = append(fc.body, encodeLEB128U(uint64(iterIdx))...)
-	fc.body = append(fc.body, opLocalGet)
-	fc.body = append(fc.body, encodeLEB128U(uint64(endIdx))...)
-	fc.body = append(fc.body, opI64GeS) // iter >= end => exit
+	exit()
 	fc.body = append(fc.body, opBrIf)
 	fc.body = append(fc.body, encodeLEB128U(1)...) // break
 
-	// Body
-	for _, stmt := range body {
-		fc.compileStmt(stmt)
-	}
+	fc.body = append(fc.body, opBlock, blockVoid)
+	fc.blockDepth++
+	fc.loopContinueDepth = fc.blockDepth
 
-	// Increment: iter = iter + 1
-	fc.body = append(fc.body, opLocalGet)
-	fc.body = append(fc.body, encodeLEB128U(uint64(iterIdx))...)
-	fc.body = append(fc.body, opI64Const)
-	fc.body = append(fc.body, encodeLEB128S(1)...)
-	fc.body = append(fc.body, opI64Add)
-	fc.body = append(fc.body, opLocalSet)
-	fc.body = append(fc.body, encodeLEB128U(uint64(iterIdx))...)
+	body()
+
+	fc.body = append(fc.body, opEnd) // end continue block
+	fc.blockDepth--
+
+	step()
 
 	// Branch back to loop
 	fc.body = append(fc.body, opBr)
@@ -652,19 +1029,14 @@ func (fc *funcCompiler) compileExpr(expr ir.Expr) {
 		fc.compileMethodCallExpr(e)
 
 	case *ir.FieldAccessExpr:
-		// Simplified: just push 0 for now
-		fc.body = append(fc.body, opI32Const)
-		fc.body = append(fc.body, encodeLEB128S(0)...)
+		fc.compileFieldAccess(e)
 
 	case *ir.IndexExpr:
-		// Simplified: just push 0 for now
-		fc.body = append(fc.body, opI64Const)
-		fc.body = append(fc.body, encodeLEB128S(0)...)
+		fc.compileElementAddr(e)
+		fc.load(typeForIR(e.Type), 0)
 
 	case *ir.ArrayLit:
-		// Simplified: push 0 (null pointer)
-		fc.body = append(fc.body, opI32Const)
-		fc.body = append(fc.body, encodeLEB128S(0)...)
+		fc.compileArrayLit(e)
 
 	case *ir.RangeExpr:
 		// Not directly compiled; used by ForInStmt
@@ -672,21 +1044,25 @@ func (fc *funcCompiler) compileExpr(expr ir.Expr) {
 		fc.body = append(fc.body, encodeLEB128S(0)...)
 
 	case *ir.MatchExpr:
-		// Simplified match: evaluate scrutinee and push default
-		fc.compileExpr(e.Scrutinee)
-		fc.body = append(fc.body, opDrop)
-		fc.body = append(fc.body, opI64Const)
-		fc.body = append(fc.body, encodeLEB128S(0)...)
+		fc.compileMatchExpr(e)
 
 	case *ir.SelfRef:
-		// In WASM, self would be a pointer to entity memory
-		fc.body = append(fc.body, opI32Const)
-		fc.body = append(fc.body, encodeLEB128S(0)...)
+		// self is a pointer to entity memory
+		if fc.selfIdx >= 0 {
+			fc.localGet(fc.selfIdx)
+		} else {
+			fc.i32Const(0)
+		}
 
 	case *ir.ResultRef:
-		// Result reference in ensures (not compiled to WASM)
-		fc.body = append(fc.body, opI64Const)
-		fc.body = append(fc.body, encodeLEB128S(0)...)
+		// Result reference in ensures: the value being returned
+		if fc.isCtor {
+			fc.localGet(fc.selfIdx)
+		} else if fc.resultIdx >= 0 {
+			fc.localGet(fc.resultIdx)
+		} else {
+			fc.zero(typeForIR(e.Type))
+		}
 
 	case *ir.OldRef:
 		if idx, ok := fc.localMap[e.Name]; ok {
@@ -695,28 +1071,24 @@ func (fc *funcCompiler) compileExpr(expr ir.Expr) {
 		}
 
 	case *ir.StringInterp:
-		// Simplified: store concatenated static parts
-		var s string
-		for _, part := range e.Parts {
-			if !part.IsExpr {
-				s += part.Static
-			}
-		}
-		offset, _ := fc.gen.addStringData(s)
-		fc.body = append(fc.body, opI32Const)
-		fc.body = append(fc.body, encodeLEB128S(int64(offset))...)
+		fc.compileStringInterp(e)
 
 	case *ir.StringConcat:
-		// Simplified: compile left side only
 		fc.compileExpr(e.Left)
+		fc.compileExpr(e.Right)
+		fc.call(fc.gen.runtimeFunc(rtStrConcat))
+
+	case *ir.UpcastExpr:
+		fc.compileUpcast(e)
 
 	case *ir.TryExpr:
-		fc.compileExpr(e.Expr)
+		fc.compileTryExpr(e)
 
-	case *ir.ForallExpr, *ir.ExistsExpr:
-		// Quantifiers are verification-only, push true
-		fc.body = append(fc.body, opI32Const)
-		fc.body = append(fc.body, encodeLEB128S(1)...)
+	case *ir.ForallExpr:
+		fc.compileQuantifier(e.Variable, e.Domain, e.Map, e.Body, true)
+
+	case *ir.ExistsExpr:
+		fc.compileQuantifier(e.Variable, e.Domain, e.Map, e.Body, false)
 
 	default:
 		// Unknown expression type, push 0
@@ -726,12 +1098,48 @@ func (fc *funcCompiler) compileExpr(expr ir.Expr) {
 }
 
 func (fc *funcCompiler) compileBinaryExpr(e *ir.BinaryExpr) {
+	// Logical operators short-circuit, so guards like
+	// `i < len(xs) and xs[i] > 0` never evaluate an out-of-bounds index.
+	switch e.Op {
+	case lexer.AND, lexer.OR, lexer.IMPLIES:
+		fc.compileExpr(e.Left)
+		fc.body = append(fc.body, opIf, blockI32)
+		fc.blockDepth++
+		if e.Op == lexer.OR {
+			fc.i32Const(1)
+		} else {
+			fc.compileExpr(e.Right)
+		}
+		fc.body = append(fc.body, opElse)
+		switch e.Op {
+		case lexer.AND:
+			fc.i32Const(0)
+		case lexer.OR:
+			fc.compileExpr(e.Right)
+		case lexer.IMPLIES:
+			fc.i32Const(1)
+		}
+		fc.body = append(fc.body, opEnd)
+		fc.blockDepth--
+		return
+	}
+
 	fc.compileExpr(e.Left)
 	fc.compileExpr(e.Right)
 
 	leftType := e.Left.ExprType()
 	isFloat := leftType != nil && leftType.Name == "Float"
-	isBool := leftType != nil && leftType.Name == "Bool"
+	isString := leftType != nil && leftType.Name == "String"
+	// Bools, strings, entities, enums and arrays are all i32 values
+	isBool := leftType != nil && !isFloat && typeForIR(leftType) == valI32
+
+	if isString && (e.Op == lexer.EQ || e.Op == lexer.NEQ) {
+		fc.call(fc.gen.runtimeFunc(rtStrEq))
+		if e.Op == lexer.NEQ {
+			fc.body = append(fc.body, opI32Eqz)
+		}
+		return
+	}
 
 	switch e.Op {
 	case lexer.PLUS:
@@ -779,31 +1187,35 @@ func (fc *funcCompiler) compileBinaryExpr(e *ir.BinaryExpr) {
 	case lexer.LT:
 		if isFloat {
 			fc.body = append(fc.body, opF64Lt)
+		} else if isBool {
+			fc.body = append(fc.body, opI32LtS)
 		} else {
 			fc.body = append(fc.body, opI64LtS)
 		}
 	case lexer.GT:
 		if isFloat {
 			fc.body = append(fc.body, opF64Gt)
+		} else if isBool {
+			fc.body = append(fc.body, opI32GtS)
 		} else {
 			fc.body = append(fc.body, opI64GtS)
 		}
 	case lexer.LEQ:
 		if isFloat {
 			fc.body = append(fc.body, opF64Le)
+		} else if isBool {
+			fc.body = append(fc.body, opI32LeS)
 		} else {
 			fc.body = append(fc.body, opI64LeS)
 		}
 	case lexer.GEQ:
 		if isFloat {
 			fc.body = append(fc.body, opF64Ge)
+		} else if isBool {
+			fc.body = append(fc.body, opI32GeS)
 		} else {
 			fc.body = append(fc.body, opI64GeS)
 		}
-	case lexer.AND:
-		fc.body = append(fc.body, opI32And)
-	case lexer.OR:
-		fc.body = append(fc.body, opI32Or)
 	}
 }
 
@@ -848,70 +1260,137 @@ func (fc *funcCompiler) compileCallExpr(e *ir.CallExpr) {
 		for _, arg := range e.Args {
 			fc.compileExpr(arg)
 		}
-		// Look up function index
-		if idx, ok := fc.gen.funcIndex[e.Function]; ok {
-			fc.body = append(fc.body, opCall)
-			fc.body = append(fc.body, encodeLEB128U(uint64(idx))...)
+		// Look up function index, preferring the current module's own function
+		if idx, ok := fc.lookupFunc(e.Function); ok {
+			fc.call(idx)
 		} else {
 			// Unknown function; push default
-			fc.body = append(fc.body, opI64Const)
-			fc.body = append(fc.body, encodeLEB128S(0)...)
+			fc.i64Const(0)
 		}
 	case ir.CallConstructor:
-		// Simplified: push 0 pointer
-		fc.body = append(fc.body, opI32Const)
-		fc.body = append(fc.body, encodeLEB128S(0)...)
+		fc.compileConstructorCall(e.Function, e.Args)
 	case ir.CallVariant:
-		// Simplified: push tag value
-		fc.body = append(fc.body, opI32Const)
-		fc.body = append(fc.body, encodeLEB128S(0)...)
+		fc.compileVariant(e.Type, e.EnumName, e.Function, e.Args)
+	}
+}
+
+// lookupFunc resolves a function name from the current module.
+func (fc *funcCompiler) lookupFunc(name string) (int, bool) {
+	if idx, ok := fc.gen.funcIndex[fc.prefix+name]; ok {
+		return idx, true
 	}
+	idx, ok := fc.gen.funcIndex[name]
+	return idx, ok
 }
 
 func (fc *funcCompiler) compileBuiltinCall(e *ir.CallExpr) {
 	switch e.Function {
 	case "print":
-		// In pure WASM there's no stdout. We compile the arg but can't print.
-		// The host environment would provide an imported print function.
 		if len(e.Args) > 0 {
-			fc.compileExpr(e.Args[0])
-			fc.body = append(fc.body, opDrop)
+			fc.compilePrint(e.Args[0])
 		}
 	case "len":
-		// Simplified: push 0
-		fc.body = append(fc.body, opI64Const)
-		fc.body = append(fc.body, encodeLEB128S(0)...)
-	case "push", "pop":
-		// Array operations - simplified
-		fc.body = append(fc.body, opI64Const)
-		fc.body = append(fc.body, encodeLEB128S(0)...)
+		// Strings, arrays and maps all keep their length in the first word
+		if len(e.Args) > 0 {
+			fc.compileExpr(e.Args[0])
+			fc.load(valI32, arrayLenOffset)
+			fc.body = append(fc.body, opI64ExtendI32U)
+		} else {
+			fc.i64Const(0)
+		}
+	case "Ok", "Err", "Some", "None":
+		fc.compileVariant(e.Type, "", e.Function, e.Args)
+	case "Map":
+		fc.compileMapNew(e.Type)
 	default:
 		// Unknown builtin
-		fc.body = append(fc.body, opI64Const)
-		fc.body = append(fc.body, encodeLEB128S(0)...)
+		fc.i64Const(0)
 	}
 }
 
 func (fc *funcCompiler) compileMethodCallExpr(e *ir.MethodCallExpr) {
 	if e.IsModuleCall {
+		if e.CallKind == ir.CallConstructor {
+			fc.compileConstructorCall(e.Method, e.Args)
+			return
+		}
 		// Cross-module function call: look up mangled name
 		mangledName := e.ModuleName + "_" + e.Method
 		for _, arg := range e.Args {
 			fc.compileExpr(arg)
 		}
 		if idx, ok := fc.gen.funcIndex[mangledName]; ok {
-			fc.body = append(fc.body, opCall)
-			fc.body = append(fc.body, encodeLEB128U(uint64(idx))...)
+			fc.call(idx)
 		} else {
-			fc.body = append(fc.body, opI64Const)
-			fc.body = append(fc.body, encodeLEB128S(0)...)
+			fc.i64Const(0)
 		}
 		return
 	}
 
-	// Regular method call - simplified
-	fc.body = append(fc.body, opI64Const)
-	fc.body = append(fc.body, encodeLEB128S(0)...)
+	objType := e.Object.ExprType()
+	if _, isSelf := e.Object.(*ir.SelfRef); isSelf && fc.entity != nil {
+		objType = &checker.Type{Name: fc.entity.name, IsEntity: true}
+	}
+	if objType == nil {
+		fc.i64Const(0)
+		return
+	}
+
+	switch {
+	case checker.IsMap(objType):
+		fc.compileMapMethod(e)
+		return
+
+	case objType.Name == "Array" && e.Method == "push":
+		// Reserve a slot at the end of the array, then store into it
+		fc.compileExpr(e.Object)
+		fc.call(fc.gen.runtimeFunc(rtArrayPush))
+		fc.compileExpr(e.Args[0])
+		fc.store(typeForIR(e.Args[0].ExprType()), 0)
+		return
+
+	case objType.IsEnum && (objType.Name == "Result" || objType.Name == "Option"):
+		// is_ok / is_some test for the first variant, is_err / is_none for the second
+		fc.compileExpr(e.Object)
+		fc.load(valI32, enumTagOffset)
+		switch e.Method {
+		case "is_ok", "is_some":
+			fc.body = append(fc.body, opI32Eqz)
+			return
+		case "is_err", "is_none":
+			fc.i32Const(1)
+			fc.body = append(fc.body, opI32Eq)
+			return
+		}
+		fc.body = append(fc.body, opDrop)
+
+	case objType.IsTrait:
+		if trait, ok := fc.gen.traits[objType.Name]; ok {
+			if idx, ok := trait.methods[e.Method]; ok {
+				fc.compileExpr(e.Object)
+				for _, arg := range e.Args {
+					fc.compileExpr(arg)
+				}
+				fc.call(idx)
+				return
+			}
+		}
+
+	default:
+		if layout, ok := fc.gen.entities[objType.Name]; ok {
+			if idx, ok := layout.methods[e.Method]; ok {
+				fc.compileExpr(e.Object)
+				for _, arg := range e.Args {
+					fc.compileExpr(arg)
+				}
+				fc.call(idx)
+				return
+			}
+		}
+	}
+
+	// Unknown method; push default
+	fc.i64Const(0)
 }
 
 // ensureI32 adds a conversion to i32 if the expression type is not already i32-compatible.
@@ -927,3 +1406,85 @@ func (fc *funcCompiler) ensureI32(expr ir.Expr) {
 		// Already i32
 	}
 }
+
+// --- Instruction helpers ---
+
+func (fc *funcCompiler) localGet(idx int) {
+	fc.body = append(fc.body, opLocalGet)
+	fc.body = append(fc.body, encodeLEB128U(uint64(idx))...)
+}
+
+func (fc *funcCompiler) localSet(idx int) {
+	fc.body = append(fc.body, opLocalSet)
+	fc.body = append(fc.body, encodeLEB128U(uint64(idx))...)
+}
+
+func (fc *funcCompiler) localTee(idx int) {
+	fc.body = append(fc.body, opLocalTee)
+	fc.body = append(fc.body, encodeLEB128U(uint64(idx))...)
+}
+
+func (fc *funcCompiler) i32Const(v int64) {
+	fc.body = append(fc.body, opI32Const)
+	fc.body = append(fc.body, encodeLEB128S(v)...)
+}
+
+func (fc *funcCompiler) i64Const(v int64) {
+	fc.body = append(fc.body, opI64Const)
+	fc.body = append(fc.body, encodeLEB128S(v)...)
+}
+
+func (fc *funcCompiler) call(idx int) {
+	fc.body = append(fc.body, opCall)
+	fc.body = append(fc.body, encodeLEB128U(uint64(idx))...)
+}
+
+// zero pushes the zero value of a WASM value type.
+func (fc *funcCompiler) zero(vtype byte) {
+	switch vtype {
+	case valI64:
+		fc.i64Const(0)
+	case valF64:
+		fc.body = append(fc.body, opF64Const)
+		fc.body = append(fc.body, encodeF64(0)...)
+	default:
+		fc.i32Const(0)
+	}
+}
+
+// load reads a value of the given type from (address on stack) + offset.
+func (fc *funcCompiler) load(vtype byte, offset int) {
+	switch vtype {
+	case valI64:
+		fc.body = append(fc.body, opI64Load, 3)
+	case valF64:
+		fc.body = append(fc.body, opF64Load, 3)
+	default:
+		fc.body = append(fc.body, opI32Load, 2)
+	}
+	fc.body = append(fc.body, encodeLEB128U(uint64(offset))...)
+}
+
+// store writes a value of the given type to (address on stack) + offset.
+// The stack holds the address below the value.
+func (fc *funcCompiler) store(vtype byte, offset int) {
+	switch vtype {
+	case valI64:
+		fc.body = append(fc.body, opI64Store, 3)
+	case valF64:
+		fc.body = append(fc.body, opF64Store, 3)
+	default:
+		fc.body = append(fc.body, opI32Store, 2)
+	}
+	fc.body = append(fc.body, encodeLEB128U(uint64(offset))...)
+}
+
+func (fc *funcCompiler) loadByte(offset int) {
+	fc.body = append(fc.body, opI32Load8U, 0)
+	fc.body = append(fc.body, encodeLEB128U(uint64(offset))...)
+}
+
+func (fc *funcCompiler) storeByte(offset int) {
+	fc.body = append(fc.body, opI32Store8, 0)
+	fc.body = append(fc.body, encodeLEB128U(uint64(offset))...)
+}
@@ -1,11 +1,17 @@
 package wasmbe
 
 import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/lhaig/intent/internal/checker"
 	"github.com/lhaig/intent/internal/ir"
 	"github.com/lhaig/intent/internal/lexer"
+	"github.com/lhaig/intent/internal/parser"
 )
 
 func TestWasmMagicAndVersion(t *testing.T) {
@@ -420,6 +426,340 @@ func TestWasmBooleans(t *testing.T) {
 	}
 }
 
+// lowerSource parses, checks and lowers an Intent program.
+func lowerSource(t *testing.T, src string) *ir.Module {
+	t.Helper()
+	p := parser.New(src)
+	prog := p.Parse()
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("parse errors: %s", p.Diagnostics().Format("test"))
+	}
+	result := checker.CheckWithResult(prog)
+	if result.Diagnostics.HasErrors() {
+		t.Fatalf("check errors: %s", result.Diagnostics.Format("test"))
+	}
+	return ir.Lower(prog, result)
+}
+
+// counterSource exercises entities, arrays and match.
+const counterSource = `module test version "1.0.0";
+
+enum Shape {
+    Square(side: Int),
+    Empty,
+}
+
+entity Counter {
+    field count: Int;
+
+    constructor(start: Int) {
+        self.count = start;
+    }
+
+    method bump(by: Int) returns Void {
+        self.count = self.count + by;
+    }
+
+    method get() returns Int {
+        return self.count;
+    }
+}
+
+entry function main() returns Int {
+    let mutable c: Counter = Counter(3);
+    c.bump(4);
+    let mutable xs: Array<Int> = [10, 20];
+    xs.push(30);
+    let s: Shape = Square(5);
+    return c.get() + xs[2] + len(xs) + match s { Square(n) => n * 100, Empty => 0 };
+}
+`
+
+func counterModule(t *testing.T) *ir.Module {
+	return lowerSource(t, counterSource)
+}
+
+func TestWasmEntityLayout(t *testing.T) {
+	result := Generate(counterModule(t))
+	sections := parseSections(result[8:])
+
+	hasGlobal := false
+	for _, s := range sections {
+		switch s.id {
+		case 3: // function section
+			// main, Counter.new, Counter.bump, Counter.get plus runtime helpers
+			if len(s.data) > 0 && s.data[0] < 4 {
+				t.Errorf("Expected at least 4 functions, got %d", s.data[0])
+			}
+		case 6:
+			hasGlobal = true
+		case 7: // export section
+			if containsBytes(s.data, []byte("Counter.")) {
+				t.Error("Constructors and methods should not be exported")
+			}
+		case 10: // code section
+			if !containsByte(s.data, opI64Store) {
+				t.Error("Expected i64.store for entity field assignment")
+			}
+			if !containsByte(s.data, opI64Load) {
+				t.Error("Expected i64.load for entity field access")
+			}
+		}
+	}
+	if !hasGlobal {
+		t.Error("Expected global section holding the heap pointer")
+	}
+}
+
+func TestWasmStringLiteralHasLengthHeader(t *testing.T) {
+	g := newGenerator()
+	offset, n := g.addStringData("hi")
+	again, _ := g.addStringData("hi")
+
+	if n != 2 {
+		t.Errorf("Expected length 2, got %d", n)
+	}
+	if again != offset {
+		t.Errorf("Expected identical strings to share data, got %d and %d", offset, again)
+	}
+	want := []byte{2, 0, 0, 0, 'h', 'i'}
+	if !containsBytes(g.dataSegs[0].data, want) {
+		t.Errorf("Expected length-prefixed data %v, got %v", want, g.dataSegs[0].data)
+	}
+}
+
+// runMain instantiates a WASM module with node and returns the result of
+// main, or the trap message preceded by any contract violation.
+func runMain(t *testing.T, wasm []byte) string {
+	t.Helper()
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node not found on PATH, skipping execution test")
+	}
+	path := filepath.Join(t.TempDir(), "out.wasm")
+	if err := os.WriteFile(path, wasm, 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := `let memory;
+const str = (ptr, len) => Buffer.from(memory.buffer, ptr, len).toString();
+const env = {
+  print_i64: (v) => console.log(String(v)),
+  print_f64: (v) => console.log(String(v)),
+  print_str: (ptr, len) => console.log(str(ptr, len)),
+  contract_violation: (kind, ptr, len) =>
+    console.log("violation " + kind + ": " + str(ptr, len)),
+};
+WebAssembly.instantiate(require("fs").readFileSync(process.argv[1]), {env})
+  .then(({instance}) => {
+    memory = instance.exports.memory;
+    console.log(String(instance.exports.main()));
+  })
+  .catch(e => console.log("trap: " + e.message));`
+	out, err := exec.Command("node", "-e", script, path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("node failed: %v\n%s", err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestWasmRunsEntitiesArraysAndMatch(t *testing.T) {
+	// 7 (counter) + 30 (xs[2]) + 3 (len) + 500 (match)
+	if got := runMain(t, Generate(counterModule(t))); got != "540" {
+		t.Errorf("Expected 540, got %s", got)
+	}
+}
+
+func TestWasmIndexOutOfBoundsTraps(t *testing.T) {
+	mod := lowerSource(t, strings.Replace(counterSource, "return c.get() + xs[2]", "return xs[3] + xs[2]", 1))
+
+	if got := runMain(t, Generate(mod)); !strings.HasPrefix(got, "trap:") {
+		t.Errorf("Expected out of bounds index to trap, got %s", got)
+	}
+}
+
+// withdrawSource withdraws 3 from balance under a precondition and a
+// postcondition.
+func withdrawSource(balance int64) string {
+	return fmt.Sprintf(`module test version "1.0.0";
+
+function withdraw(balance: Int, amount: Int) returns Int
+    requires amount <= balance
+    ensures result >= 0
+{
+    return balance - amount;
+}
+
+entry function main() returns Int {
+    return withdraw(%d, 3);
+}
+`, balance)
+}
+
+func withdrawModule(t *testing.T, balance int64) *ir.Module {
+	return lowerSource(t, withdrawSource(balance))
+}
+
+func TestWasmContractViolationImport(t *testing.T) {
+	result := Generate(withdrawModule(t, 10))
+	sections := parseSections(result[8:])
+
+	hasImport := false
+	for _, s := range sections {
+		if s.id == 2 {
+			hasImport = true
+			if !containsBytes(s.data, []byte("contract_violation")) {
+				t.Errorf("Expected env.contract_violation import, got %q", s.data)
+			}
+		}
+	}
+	if !hasImport {
+		t.Error("Expected import section for a module with contracts")
+	}
+
+	for _, s := range parseSections(Generate(counterModule(t))[8:]) {
+		if s.id == 2 {
+			t.Error("Expected no imports for a module without contracts")
+		}
+	}
+}
+
+func TestWasmEnforcesContracts(t *testing.T) {
+	if got := runMain(t, Generate(withdrawModule(t, 10))); got != "7" {
+		t.Errorf("Expected 7, got %s", got)
+	}
+
+	got := runMain(t, Generate(withdrawModule(t, 1)))
+	if !strings.HasPrefix(got, "violation 0: Precondition failed: amount <= balance") {
+		t.Errorf("Expected precondition violation, got %s", got)
+	}
+	if !strings.Contains(got, "trap:") {
+		t.Errorf("Expected the violation to trap, got %s", got)
+	}
+
+	// Without the precondition the postcondition catches the negative result
+	mod := lowerSource(t, strings.Replace(withdrawSource(1), "    requires amount <= balance\n", "", 1))
+	got = runMain(t, Generate(mod))
+	if !strings.HasPrefix(got, "violation 1: Postcondition failed: result >= 0") {
+		t.Errorf("Expected postcondition violation, got %s", got)
+	}
+}
+
+func TestWasmEnforcesEntityInvariants(t *testing.T) {
+	// Violated by c.bump(4) after Counter(3)
+	mod := lowerSource(t, strings.Replace(counterSource, "field count: Int;", "field count: Int;\n    invariant self.count <= 5;", 1))
+
+	got := runMain(t, Generate(mod))
+	if !strings.HasPrefix(got, "violation 2: Invariant failed: self . count <= 5") {
+		t.Errorf("Expected invariant violation, got %s", got)
+	}
+}
+
+func TestWasmQuantifiersLoop(t *testing.T) {
+	// return (forall i in 0..4: i < 4) * 10 + (exists i in 0..4: i == 9)
+	intT := &checker.Type{Name: "Int"}
+	boolT := &checker.Type{Name: "Bool"}
+	domain := func() *ir.RangeExpr {
+		return &ir.RangeExpr{Start: &ir.IntLit{Value: 0, Type: intT}, End: &ir.IntLit{Value: 4, Type: intT}}
+	}
+	asInt := func(cond ir.Expr, v int64) ir.Stmt {
+		return &ir.IfStmt{Condition: cond, Then: []ir.Stmt{
+			&ir.AssignStmt{Target: &ir.VarRef{Name: "r", Type: intT}, Value: &ir.BinaryExpr{
+				Left: &ir.VarRef{Name: "r", Type: intT}, Op: lexer.PLUS, Right: &ir.IntLit{Value: v, Type: intT}, Type: intT,
+			}},
+		}}
+	}
+	mod := &ir.Module{
+		Name:    "test",
+		IsEntry: true,
+		Functions: []*ir.Function{{
+			Name:       "main",
+			IsEntry:    true,
+			ReturnType: intT,
+			Body: []ir.Stmt{
+				&ir.LetStmt{Name: "r", Type: intT, Value: &ir.IntLit{Value: 0, Type: intT}},
+				asInt(&ir.ForallExpr{Variable: "i", Domain: domain(), Type: boolT, Body: &ir.BinaryExpr{
+					Left: &ir.VarRef{Name: "i", Type: intT}, Op: lexer.LT, Right: &ir.IntLit{Value: 4, Type: intT}, Type: boolT,
+				}}, 10),
+				asInt(&ir.ExistsExpr{Variable: "i", Domain: domain(), Type: boolT, Body: &ir.BinaryExpr{
+					Left: &ir.VarRef{Name: "i", Type: intT}, Op: lexer.EQ, Right: &ir.IntLit{Value: 9, Type: intT}, Type: boolT,
+				}}, 1),
+				&ir.ReturnStmt{Value: &ir.VarRef{Name: "r", Type: intT}},
+			},
+		}},
+	}
+
+	if got := runMain(t, Generate(mod)); got != "10" {
+		t.Errorf("Expected 10, got %s", got)
+	}
+}
+
+// printSource prints a value of each printable type.
+const printSource = `module test version "1.0.0";
+
+entry function main() returns Int {
+    print(7);
+    print(2.5);
+    print("hi");
+    print(true);
+    return 0;
+}
+`
+
+func printModule(t *testing.T) *ir.Module {
+	return lowerSource(t, printSource)
+}
+
+func TestWasmPrintImports(t *testing.T) {
+	hasImport := false
+	for _, s := range parseSections(Generate(printModule(t))[8:]) {
+		if s.id == 2 {
+			hasImport = true
+			for _, name := range []string{"print_i64", "print_f64", "print_str"} {
+				if !containsBytes(s.data, []byte(name)) {
+					t.Errorf("Expected env.%s import, got %q", name, s.data)
+				}
+			}
+		}
+	}
+	if !hasImport {
+		t.Error("Expected import section for a module that prints")
+	}
+}
+
+func TestWasmPrintRuns(t *testing.T) {
+	want := "7\n2.5\nhi\ntrue\n0"
+	if got := runMain(t, Generate(printModule(t))); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestLoader(t *testing.T) {
+	loader := Loader("hello.wasm", "main")
+	for _, want := range []string{`"hello.wasm"`, `exports["main"]`, "print_i64", "print_f64", "print_str", "contract_violation"} {
+		if !strings.Contains(loader, want) {
+			t.Errorf("Expected loader to contain %s, got:\n%s", want, loader)
+		}
+	}
+
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node not found on PATH, skipping execution test")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "out.wasm"), Generate(withdrawModule(t, 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaderPath := filepath.Join(dir, "out.loader.js")
+	if err := os.WriteFile(loaderPath, []byte(Loader("out.wasm", "main")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("node", loaderPath).CombinedOutput()
+	if err == nil {
+		t.Fatalf("Expected a non-zero exit for a contract violation, got:\n%s", out)
+	}
+	if got := strings.TrimSpace(string(out)); got != "Precondition failed: amount <= balance" {
+		t.Errorf("Expected the violation message, got %q", got)
+	}
+}
+
 func TestLEB128Encoding(t *testing.T) {
 	// Test unsigned LEB128
 	tests := []struct {
@@ -543,3 +883,129 @@ func containsBytes(data, sub []byte) bool {
 	}
 	return false
 }
+
+func TestWasmDebugContracts(t *testing.T) {
+	wasm := GenerateWith(withdrawModule(t, 1), Options{DebugContracts: true})
+	found := false
+	for _, s := range parseSections(wasm[8:]) {
+		if s.id == 7 && containsBytes(s.data, []byte(contractsExport)) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected the %s global exported", contractsExport)
+	}
+	if got := runMain(t, wasm); !strings.HasPrefix(got, "violation 0: Precondition failed: amount <= balance") {
+		t.Errorf("Expected checks on by default, got %s", got)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "out.wasm"), wasm, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaderPath := filepath.Join(dir, "out.loader.js")
+	if err := os.WriteFile(loaderPath, []byte(Loader("out.wasm", "main")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("node", loaderPath)
+	cmd.Env = append(os.Environ(), "INTENT_CONTRACTS=off")
+	out, _ := cmd.CombinedOutput()
+	if len(out) != 0 || cmd.ProcessState.ExitCode() != 254 {
+		t.Errorf("Expected checks off to return -2 (exit 254), got exit %d:\n%s", cmd.ProcessState.ExitCode(), out)
+	}
+
+	// @always_check clauses stay unconditional
+	src := strings.Replace(withdrawSource(1), "    requires", "    @always_check requires", 1)
+	mod := lowerSource(t, strings.Replace(src, "    ensures result >= 0\n", "", 1))
+	for _, s := range parseSections(GenerateWith(mod, Options{DebugContracts: true})[8:]) {
+		if s.id == 6 {
+			t.Error("Expected no globals when every check is @always_check")
+		}
+	}
+}
+
+// traitSource has two entities implementing trait Shape, with
+// Square(3).area() == 9 and Twice(5).area() == 10, and returns
+// a.area() * 100 + b.area() with both called through Shape values.
+const traitSource = `module test version "1.0.0";
+
+trait Shape {
+    method area() returns Int;
+}
+
+entity Square implements Shape {
+    field n: Int;
+
+    constructor(n: Int) {
+        self.n = n;
+    }
+
+    method area() returns Int {
+        return self.n * self.n;
+    }
+}
+
+entity Twice implements Shape {
+    field n: Int;
+
+    constructor(n: Int) {
+        self.n = n;
+    }
+
+    method area() returns Int {
+        return self.n + self.n;
+    }
+}
+
+entry function main() returns Int {
+    let a: Shape = Square(3);
+    let b: Shape = Twice(5);
+    return a.area() * 100 + b.area();
+}
+`
+
+func traitModule(t *testing.T) *ir.Module {
+	return lowerSource(t, traitSource)
+}
+
+func TestWasmTraitDispatch(t *testing.T) {
+	if got := runMain(t, Generate(traitModule(t))); got != "910" {
+		t.Errorf("Expected 910, got %s", got)
+	}
+}
+
+// mapSource fills, shrinks and iterates an Int map, and reads the values
+// of a String map in key order.
+const mapSource = `module test version "1.0.0";
+
+entry function main() returns Int {
+    let mutable m: Map<Int, Int> = Map();
+    for i in 0..50 {
+        m.set(i * 7 % 50, i);
+    }
+    for i in 0..25 {
+        m.remove(i * 2);
+    }
+    let mutable sum: Int = 0;
+    for k, v in m {
+        sum = sum + k;
+    }
+    let mutable s: Map<String, Int> = Map();
+    s.set("b", 2);
+    s.set("a", 1);
+    s.set("ab", 3);
+    let vs: Array<Int> = s.values();
+    return len(m) * 100000 + m.keys()[0] * 10000 + sum * 1000 + vs[0] * 100 + vs[1] * 10 + vs[2];
+}
+`
+
+func mapModule(t *testing.T) *ir.Module {
+	return lowerSource(t, mapSource)
+}
+
+func TestWasmMaps(t *testing.T) {
+	// 25 odd keys from 1, summing to 625; values ordered by key a, ab, b
+	if got := runMain(t, Generate(mapModule(t))); got != "3135132" {
+		t.Errorf("Expected 3135132, got %s", got)
+	}
+}